@@ -3,10 +3,10 @@ package main
 import (
 	"log"
 	"net/http"
-	"os"
 
 	"era-inventory-api/internal"
 	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/version"
 )
 
 func main() {
@@ -16,20 +16,22 @@ func main() {
 		log.Fatalf("Configuration error: %v", err)
 	}
 
-	// Validate database connection string
-	dsn := os.Getenv("DB_DSN")
-	if dsn == "" {
-		log.Fatal("DB_DSN environment variable is required")
-	}
-
 	// Create and start server
-	srv := internal.NewServer(dsn, cfg)
+	srv := internal.NewServer(cfg.DBDSN, cfg)
 
-	log.Println("Starting Era Inventory API server...")
+	log.Printf("Starting Era Inventory API server %s", version.Get())
 	log.Printf("JWT Issuer: %s", cfg.JWTIssuer)
 	log.Printf("JWT Audience: %s", cfg.JWTAudience)
 	log.Printf("JWT Expiry: %v", cfg.JWTExpiry)
-	log.Println("Listening on :8080")
 
-	log.Fatal(http.ListenAndServe(":8080", srv.Router))
+	// Operational endpoints are only reachable on the internal admin listener
+	if cfg.AdminAddr != "" {
+		go func() {
+			log.Printf("Admin listener on %s", cfg.AdminAddr)
+			log.Fatal(http.ListenAndServe(cfg.AdminAddr, srv.Admin))
+		}()
+	}
+
+	log.Println("Listening on :" + config.PublicPort)
+	log.Fatal(http.ListenAndServe(":"+config.PublicPort, srv.Router))
 }
@@ -0,0 +1,206 @@
+// Command perfgen seeds an organization with a large synthetic inventory and
+// writes a load-test scenario (vegeta targets or a k6 script) against the
+// list endpoints. Run the scenario, then compare GET /admin/perf-baseline on
+// the admin listener with PERF_BUDGET_P95.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// listQueries are the list endpoint requests a scenario replays; they cover
+// deep offsets, search and filters so pagination and index changes show up
+var listQueries = []string{
+	"/items?limit=50",
+	"/items?limit=50&offset=%d",
+	"/items?limit=50&sort=-created_at",
+	"/items?q=PERF-%d",
+	"/items?status=%s&limit=50",
+	"/items?limit=50&offset=%d&sort=name",
+	"/sites?limit=50",
+	"/vendors?limit=50",
+}
+
+var deviceTypes = []string{"laptop", "switch", "router", "server", "printer", "phone"}
+
+func main() {
+	var (
+		orgID    = flag.Int64("org", 1, "Organization to seed and query")
+		items    = flag.Int("items", 100000, "Number of inventory items to seed")
+		skipSeed = flag.Bool("skip-seed", false, "Only write the scenario, do not touch the database")
+		baseURL  = flag.String("base", "http://localhost:8080", "API base URL the scenario targets")
+		format   = flag.String("format", "vegeta", "Scenario format: vegeta or k6")
+		requests = flag.Int("requests", 1000, "Number of vegeta targets to write")
+		out      = flag.String("out", "", "Scenario file (default: stdout)")
+		seed     = flag.Int64("seed", 1, "Random seed for generated targets")
+	)
+	flag.Parse()
+
+	if *format != "vegeta" && *format != "k6" {
+		log.Fatalf("unknown -format %q (want vegeta or k6)", *format)
+	}
+
+	cfg := config.Load()
+
+	if !*skipSeed {
+		if cfg.DBDSN == "" {
+			log.Fatal("DB_DSN is required to seed (or pass -skip-seed)")
+		}
+		start := time.Now()
+		n, err := seedInventory(context.Background(), cfg.DBDSN, *orgID, *items)
+		if err != nil {
+			log.Fatalf("Failed to seed: %v", err)
+		}
+		log.Printf("seeded %d new items into org %d in %s", n, *orgID, time.Since(start).Round(time.Millisecond))
+	}
+
+	jwtManager := auth.NewJWTManager(cfg.JWTSecret, cfg.JWTIssuer, cfg.JWTAudience, 24*time.Hour)
+	token, err := jwtManager.GenerateToken(1, *orgID, []string{"org_admin"})
+	if err != nil {
+		log.Fatalf("Failed to generate token: %v", err)
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	base := strings.TrimRight(*baseURL, "/")
+	if *format == "k6" {
+		err = writeK6(w, base, token, *orgID, *items, cfg.PerfBudgetP95)
+	} else {
+		err = writeVegeta(w, base, token, *orgID, *items, *requests, rand.New(rand.NewSource(*seed)))
+	}
+	if err != nil {
+		log.Fatalf("Failed to write scenario: %v", err)
+	}
+}
+
+// seedInventory upserts the organization and bulk-inserts items with asset
+// tags PERF-<org>-<n>, so reruns only add what is missing
+func seedInventory(ctx context.Context, dsn string, orgID int64, items int) (int64, error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, `
+		INSERT INTO organizations (id, name) VALUES ($1, 'Perf org ' || $1)
+		ON CONFLICT DO NOTHING`, orgID); err != nil {
+		return 0, fmt.Errorf("organization: %w", err)
+	}
+
+	tag, err := conn.Exec(ctx, `
+		INSERT INTO inventory (org_id, asset_tag, name, device_type, site, status)
+		SELECT $1,
+		       'PERF-' || $1 || '-' || n,
+		       'Perf item ' || n,
+		       ($3::text[])[1 + n % cardinality($3::text[])],
+		       'Site ' || (n % 50),
+		       ($4::text[])[1 + n % cardinality($4::text[])]
+		FROM generate_series(1, $2::int) AS n
+		ON CONFLICT (asset_tag) DO NOTHING`,
+		orgID, items, deviceTypes, models.ItemStatuses)
+	if err != nil {
+		return 0, fmt.Errorf("inventory: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// target fills in the placeholders of a listQueries entry
+func target(q string, rng *rand.Rand, orgID int64, items int) string {
+	switch {
+	case strings.Contains(q, "offset=%d"):
+		return fmt.Sprintf(q, rng.Intn(items/50+1)*50)
+	case strings.Contains(q, "PERF-%d"):
+		return fmt.Sprintf(q, orgID) + url.QueryEscape(fmt.Sprintf("-%d", rng.Intn(items)+1))
+	case strings.Contains(q, "status=%s"):
+		return fmt.Sprintf(q, models.ItemStatuses[rng.Intn(len(models.ItemStatuses))])
+	}
+	return q
+}
+
+// writeVegeta writes targets in vegeta's HTTP format:
+//
+//	vegeta attack -targets=targets.txt -rate=50 -duration=60s | vegeta report
+func writeVegeta(w io.Writer, base, token string, orgID int64, items, n int, rng *rand.Rand) error {
+	for i := 0; i < n; i++ {
+		q := listQueries[i%len(listQueries)]
+		if _, err := fmt.Fprintf(w, "GET %s%s\nAuthorization: Bearer %s\n\n", base, target(q, rng, orgID, items), token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeK6 writes a script that picks a list query at random per iteration
+// and fails when p95 exceeds PERF_BUDGET_P95:
+//
+//	k6 run --vus 20 --duration 60s script.js
+func writeK6(w io.Writer, base, token string, orgID int64, items int, budget time.Duration) error {
+	if budget <= 0 {
+		budget = time.Hour
+	}
+	_, err := fmt.Fprintf(w, `import http from 'k6/http';
+import { check } from 'k6';
+
+const BASE = %q;
+const PARAMS = { headers: { Authorization: 'Bearer %s' } };
+const ORG = %d;
+const ITEMS = %d;
+const STATUSES = %s;
+
+const pick = (a) => a[Math.floor(Math.random() * a.length)];
+const rand = (n) => Math.floor(Math.random() * n);
+
+const QUERIES = [
+  () => '/items?limit=50',
+  () => '/items?limit=50&offset=' + rand(Math.floor(ITEMS / 50) + 1) * 50,
+  () => '/items?limit=50&sort=-created_at',
+  () => '/items?q=PERF-' + ORG + '-' + (rand(ITEMS) + 1),
+  () => '/items?status=' + pick(STATUSES) + '&limit=50',
+  () => '/items?limit=50&offset=' + rand(Math.floor(ITEMS / 50) + 1) * 50 + '&sort=name',
+  () => '/sites?limit=50',
+  () => '/vendors?limit=50',
+];
+
+export const options = {
+  thresholds: { http_req_duration: ['p(95)<%d'] },
+};
+
+export default function () {
+  const res = http.get(BASE + pick(QUERIES)(), PARAMS);
+  check(res, { 'status is 200': (r) => r.status === 200 });
+}
+`, base, token, orgID, items, jsArray(models.ItemStatuses), budget.Milliseconds())
+	return err
+}
+
+func jsArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
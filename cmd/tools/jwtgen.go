@@ -20,6 +20,7 @@ func main() {
 		secret     = flag.String("secret", "", "JWT secret (overrides JWT_SECRET env var)")
 		issuer     = flag.String("issuer", "", "JWT issuer (overrides JWT_ISS env var)")
 		audience   = flag.String("audience", "", "JWT audience (overrides JWT_AUD env var)")
+		keyFile    = flag.String("key", "", "PEM private key to sign with (overrides JWT_PRIVATE_KEY_FILE env var)")
 	)
 	flag.Parse()
 
@@ -36,6 +37,9 @@ func main() {
 	if *audience != "" {
 		cfg.JWTAudience = *audience
 	}
+	if *keyFile != "" {
+		cfg.JWTPrivateKeyFile = *keyFile
+	}
 
 	// Parse roles
 	roleList := strings.Split(*roles, ",")
@@ -45,6 +49,13 @@ func main() {
 
 	// Create JWT manager
 	jwtManager := auth.NewJWTManager(cfg.JWTSecret, cfg.JWTIssuer, cfg.JWTAudience, time.Duration(*expiryMins)*time.Minute)
+	if cfg.JWTPrivateKeyFile != "" {
+		keys, err := auth.LoadKeySet(cfg.JWTPrivateKeyFile, nil)
+		if err != nil {
+			log.Fatalf("Failed to load signing key: %v", err)
+		}
+		jwtManager.SetKeySet(keys)
+	}
 
 	// Generate token
 	token, err := jwtManager.GenerateToken(*userID, *orgID, roleList)
@@ -0,0 +1,28 @@
+-- 0007_jobs.sql
+-- Background jobs (exports, long-running work). Workers claim rows with
+-- FOR UPDATE SKIP LOCKED, so several API instances can share the queue.
+-- Every query filters by org_id explicitly; workers run outside a request
+-- and have no app.current_org_id, so this table is not under RLS.
+
+CREATE TABLE IF NOT EXISTS jobs (
+  id          BIGSERIAL PRIMARY KEY,
+  org_id      BIGINT NOT NULL,
+  kind        TEXT NOT NULL,
+  status      TEXT NOT NULL DEFAULT 'queued',
+  params      JSONB NOT NULL DEFAULT '{}'::jsonb,
+  result      JSONB,
+  error       TEXT,
+  created_by  BIGINT,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started_at  TIMESTAMPTZ,
+  finished_at TIMESTAMPTZ
+);
+
+DROP TRIGGER IF EXISTS trg_jobs_updated_at ON jobs;
+CREATE TRIGGER trg_jobs_updated_at
+BEFORE UPDATE ON jobs
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE INDEX IF NOT EXISTS idx_jobs_org_id ON jobs(org_id, id);
+CREATE INDEX IF NOT EXISTS idx_jobs_queued ON jobs(id) WHERE status = 'queued';
@@ -0,0 +1,37 @@
+-- 0008_schema_tenancy.sql
+-- Optional schema-per-tenant isolation (TENANCY_MODE=schema). An org with a
+-- schema_name gets its own copies of the tenant tables, and the API points
+-- search_path at that schema for every request made with the org's token.
+-- Orgs without a schema_name keep using the shared tables in public.
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS schema_name TEXT UNIQUE;
+
+-- provision_org_schema creates schema org_<id> with the tenant tables and
+-- records it on the organization. Run it when creating an org that requires
+-- dedicated-schema tenancy (existing rows in public are not moved):
+--   SELECT provision_org_schema(42);
+CREATE OR REPLACE FUNCTION provision_org_schema(p_org_id BIGINT)
+RETURNS TEXT AS $$
+DECLARE
+  v_schema TEXT := 'org_' || p_org_id;
+  v_table  TEXT;
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM organizations WHERE id = p_org_id) THEN
+    RAISE EXCEPTION 'organization % does not exist', p_org_id;
+  END IF;
+
+  EXECUTE format('CREATE SCHEMA IF NOT EXISTS %I', v_schema);
+
+  FOREACH v_table IN ARRAY ARRAY['sites', 'vendors', 'projects', 'inventory'] LOOP
+    EXECUTE format('CREATE TABLE IF NOT EXISTS %I.%I (LIKE public.%I INCLUDING ALL)',
+                   v_schema, v_table, v_table);
+    EXECUTE format('DROP TRIGGER IF EXISTS %I ON %I.%I',
+                   'trg_' || v_table || '_updated_at', v_schema, v_table);
+    EXECUTE format('CREATE TRIGGER %I BEFORE UPDATE ON %I.%I FOR EACH ROW EXECUTE FUNCTION public.set_updated_at()',
+                   'trg_' || v_table || '_updated_at', v_schema, v_table);
+  END LOOP;
+
+  UPDATE organizations SET schema_name = v_schema WHERE id = p_org_id;
+  RETURN v_schema;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,26 @@
+-- 0009_item_configs.sql
+-- Device configuration snapshots collected for inventory items (network gear).
+
+CREATE TABLE IF NOT EXISTS item_configs (
+  id           BIGSERIAL PRIMARY KEY,
+  org_id       BIGINT NOT NULL DEFAULT 1,
+  item_id      INTEGER NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+  content      TEXT NOT NULL,
+  hash         TEXT NOT NULL,
+  size_bytes   INTEGER NOT NULL,
+  collected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_configs_item ON item_configs(org_id, item_id, collected_at DESC);
+CREATE INDEX IF NOT EXISTS idx_item_configs_content_trgm ON item_configs USING GIN (content gin_trgm_ops);
+
+ALTER TABLE item_configs ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='item_configs' AND policyname='org_isolation_item_configs') THEN
+    CREATE POLICY org_isolation_item_configs ON item_configs
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
@@ -0,0 +1,23 @@
+-- 0010_user_site_access.sql
+-- Per-user site grants. A user with at least one grant only sees and edits
+-- items at the granted sites; users without grants keep org-wide access.
+
+CREATE TABLE IF NOT EXISTS user_site_access (
+  org_id     BIGINT NOT NULL DEFAULT 1,
+  user_id    BIGINT NOT NULL,
+  site_id    INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (org_id, user_id, site_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_site_access_site ON user_site_access(site_id);
+
+ALTER TABLE user_site_access ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='user_site_access' AND policyname='org_isolation_user_site_access') THEN
+    CREATE POLICY org_isolation_user_site_access ON user_site_access
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
@@ -0,0 +1,30 @@
+-- 0011_item_lifecycle.sql
+-- Lifecycle status and soft delete for inventory items. Deleting an item sets
+-- deleted_at; the row stays (and keeps its asset_tag) until purged.
+
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'inventory_status_check' AND conrelid = 'public.inventory'::regclass) THEN
+    ALTER TABLE inventory ADD CONSTRAINT inventory_status_check
+      CHECK (status IN ('ordered', 'in_stock', 'active', 'in_repair', 'retired', 'disposed'));
+  END IF;
+END$$;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_warranty_end ON inventory(org_id, warranty_end)
+  WHERE deleted_at IS NULL AND warranty_end IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_inventory_deleted_at ON inventory(org_id, deleted_at)
+  WHERE deleted_at IS NOT NULL;
+
+-- Tenant schemas provisioned before this migration copied the old table shape
+DO $$
+DECLARE
+  v_schema TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT %L', v_schema, 'active');
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ', v_schema);
+  END LOOP;
+END$$;
@@ -0,0 +1,24 @@
+-- 0012_trash.sql
+-- Soft delete for sites, vendors and projects, matching inventory (0011).
+-- Deleted rows stay in the trash until restored or purged after TRASH_RETENTION.
+
+ALTER TABLE sites    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE vendors  ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_sites_deleted_at    ON sites(org_id, deleted_at)    WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_vendors_deleted_at  ON vendors(org_id, deleted_at)  WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_projects_deleted_at ON projects(org_id, deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Tenant schemas provisioned before this migration copied the old table shape
+DO $$
+DECLARE
+  v_schema TEXT;
+  v_table  TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    FOREACH v_table IN ARRAY ARRAY['sites', 'vendors', 'projects'] LOOP
+      EXECUTE format('ALTER TABLE %I.%I ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ', v_schema, v_table);
+    END LOOP;
+  END LOOP;
+END$$;
@@ -0,0 +1,8 @@
+-- 0013_org_branding.sql
+-- Per-org branding: a display name and a logo kept in object storage.
+-- display_name falls back to organizations.name when unset.
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS display_name        TEXT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS logo_key            TEXT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS logo_content_type   TEXT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS branding_updated_at TIMESTAMPTZ;
@@ -0,0 +1,20 @@
+-- 0014_refresh_tokens.sql
+-- Server-side refresh tokens for POST /auth/refresh. Only a SHA-256 of each
+-- token is stored. Every refresh replaces the token with a new one in the same
+-- family; presenting a replaced token again revokes the whole family.
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id          BIGSERIAL PRIMARY KEY,
+    token_hash  TEXT        NOT NULL UNIQUE,
+    family_id   BIGINT      NOT NULL,
+    user_id     BIGINT      NOT NULL,
+    org_id      BIGINT      NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    roles       TEXT[]      NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    used_at     TIMESTAMPTZ,
+    revoked_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
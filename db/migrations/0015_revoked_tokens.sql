@@ -0,0 +1,14 @@
+-- 0015_revoked_tokens.sql
+-- Access tokens revoked by POST /auth/logout, keyed by their jti claim. Every
+-- API instance loads this list into memory and checks it on each request.
+-- Rows are deleted once the token would have expired anyway.
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti         TEXT        PRIMARY KEY,
+    user_id     BIGINT      NOT NULL,
+    org_id      BIGINT      NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
@@ -0,0 +1,23 @@
+-- 0016_inventory_keyset_indexes.sql
+-- Indexes backing cursor pagination on GET /items for each sort key. With id
+-- as the tie-breaker, a page after a cursor is an index range scan however
+-- deep it is, where OFFSET has to skip every earlier row.
+
+CREATE INDEX IF NOT EXISTS idx_inventory_keyset_name       ON inventory(org_id, name, id)       WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_inventory_keyset_created_at ON inventory(org_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_inventory_keyset_updated_at ON inventory(org_id, updated_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_inventory_keyset_status     ON inventory(org_id, status, id)     WHERE deleted_at IS NULL;
+
+-- Tenant schemas copied the table, with its indexes, when they were provisioned
+DO $$
+DECLARE
+  v_schema TEXT;
+  v_col    TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    FOREACH v_col IN ARRAY ARRAY['name', 'created_at', 'updated_at', 'status'] LOOP
+      EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON %I.inventory(org_id, %I, id) WHERE deleted_at IS NULL',
+                     'idx_inventory_keyset_' || v_col, v_schema, v_col);
+    END LOOP;
+  END LOOP;
+END$$;
@@ -0,0 +1,29 @@
+-- 0017_item_links.sql
+-- Relationships between inventory items: containment (a chassis "contains" a
+-- line card) and connectivity (an AP "uplinks_to" a switch, "connected_to").
+-- Links go from from_item_id to to_item_id. An item is contained by at most
+-- one parent; purging either item removes the link.
+
+CREATE TABLE IF NOT EXISTS item_links (
+  id           BIGSERIAL PRIMARY KEY,
+  org_id       BIGINT NOT NULL DEFAULT 1,
+  from_item_id INTEGER NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+  to_item_id   INTEGER NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+  kind         TEXT NOT NULL CHECK (kind IN ('contains', 'uplinks_to', 'connected_to')),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT item_links_not_self CHECK (from_item_id <> to_item_id),
+  CONSTRAINT item_links_unique UNIQUE (org_id, from_item_id, to_item_id, kind)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS item_links_one_parent ON item_links(to_item_id) WHERE kind = 'contains';
+CREATE INDEX IF NOT EXISTS idx_item_links_to ON item_links(org_id, to_item_id);
+
+ALTER TABLE item_links ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='item_links' AND policyname='org_isolation_item_links') THEN
+    CREATE POLICY org_isolation_item_links ON item_links
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
@@ -0,0 +1,21 @@
+-- 0018_outbox.sql
+-- Transactional outbox: change events written in the same statement as the
+-- change they describe, then delivered by the API's background dispatcher.
+-- The table is shared by every org (including schema-tenancy orgs, which
+-- reach it through the public fallback in search_path) and has no RLS: it is
+-- read only by the dispatcher, never by a request.
+
+CREATE TABLE IF NOT EXISTS outbox (
+  id              BIGSERIAL PRIMARY KEY,
+  org_id          BIGINT NOT NULL,
+  topic           TEXT NOT NULL,
+  payload         JSONB NOT NULL,
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  attempts        INTEGER NOT NULL DEFAULT 0,
+  last_error      TEXT,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  dispatched_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(next_attempt_at, id) WHERE dispatched_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_dispatched ON outbox(dispatched_at) WHERE dispatched_at IS NOT NULL;
@@ -0,0 +1,46 @@
+-- 0019_custom_fields.sql
+-- Typed custom fields per device type. An org admin defines the fields an
+-- item of a device_type may carry; item writes validate custom_fields against
+-- those definitions. Values live on the item as a JSONB object keyed by field.
+
+CREATE TABLE IF NOT EXISTS custom_fields (
+  id           BIGSERIAL PRIMARY KEY,
+  org_id       BIGINT NOT NULL DEFAULT 1,
+  device_type  TEXT NOT NULL,
+  key          TEXT NOT NULL CHECK (key ~ '^[a-z][a-z0-9_]{0,62}$'),
+  label        TEXT NOT NULL DEFAULT '',
+  type         TEXT NOT NULL CHECK (type IN ('text', 'int', 'bool', 'enum', 'date')),
+  options      JSONB NOT NULL DEFAULT '[]'::jsonb CHECK (jsonb_typeof(options) = 'array'),
+  required     BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT custom_fields_unique UNIQUE (org_id, device_type, key),
+  CONSTRAINT custom_fields_enum_options CHECK ((type = 'enum') = (jsonb_array_length(options) > 0))
+);
+
+DROP TRIGGER IF EXISTS trg_custom_fields_updated_at ON custom_fields;
+CREATE TRIGGER trg_custom_fields_updated_at
+BEFORE UPDATE ON custom_fields
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE custom_fields ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='custom_fields' AND policyname='org_isolation_custom_fields') THEN
+    CREATE POLICY org_isolation_custom_fields ON custom_fields
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
+
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS custom_fields JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+-- Tenant schemas provisioned before this migration copied the old table shape
+DO $$
+DECLARE
+  v_schema TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS custom_fields JSONB NOT NULL DEFAULT %L::jsonb', v_schema, '{}');
+  END LOOP;
+END$$;
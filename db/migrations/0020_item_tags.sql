@@ -0,0 +1,23 @@
+-- 0020_item_tags.sql
+-- Free-form tags on inventory items (many tags per item, many items per tag).
+-- Tags are normalized to lowercase by the API; purging an item removes its tags.
+
+CREATE TABLE IF NOT EXISTS item_tags (
+  org_id     BIGINT NOT NULL DEFAULT 1,
+  item_id    INTEGER NOT NULL REFERENCES inventory(id) ON DELETE CASCADE,
+  tag        TEXT NOT NULL CHECK (tag ~ '^[a-z0-9][a-z0-9_.:-]{0,49}$'),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (item_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_tags_tag ON item_tags(org_id, tag);
+
+ALTER TABLE item_tags ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='item_tags' AND policyname='org_isolation_item_tags') THEN
+    CREATE POLICY org_isolation_item_tags ON item_tags
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
@@ -0,0 +1,22 @@
+-- 0021_roles.sql
+-- Custom roles: named sets of fine-grained permissions an org admin defines on
+-- top of the built-in roles. Tokens carry role names; every API instance loads
+-- this table into memory and resolves them to permissions on each request.
+-- Like revoked_tokens, roles are read before any org context exists, so the
+-- table is global and handlers scope every statement by org_id.
+
+CREATE TABLE IF NOT EXISTS roles (
+  id           BIGSERIAL PRIMARY KEY,
+  org_id       BIGINT NOT NULL,
+  name         TEXT NOT NULL CHECK (name ~ '^[a-z][a-z0-9_]{1,49}$'),
+  description  TEXT NOT NULL DEFAULT '',
+  permissions  JSONB NOT NULL DEFAULT '[]'::jsonb CHECK (jsonb_typeof(permissions) = 'array'),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT roles_unique UNIQUE (org_id, name)
+);
+
+DROP TRIGGER IF EXISTS trg_roles_updated_at ON roles;
+CREATE TRIGGER trg_roles_updated_at
+BEFORE UPDATE ON roles
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
@@ -0,0 +1,21 @@
+-- 0022_api_keys.sql
+-- Long-lived API keys for automation, sent as X-API-Key. Only a SHA-256 of
+-- each key is stored; prefix is the start of the key, kept so people can tell
+-- their keys apart. Keys are looked up before the org is known, so like
+-- refresh_tokens the table is global.
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id            BIGSERIAL PRIMARY KEY,
+    key_hash      TEXT        NOT NULL UNIQUE,
+    prefix        TEXT        NOT NULL,
+    name          TEXT        NOT NULL,
+    user_id       BIGINT      NOT NULL,
+    org_id        BIGINT      NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    roles         TEXT[]      NOT NULL,
+    expires_at    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at  TIMESTAMPTZ,
+    revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_org_id ON api_keys(org_id);
@@ -0,0 +1,24 @@
+-- 0023_emails.sql
+-- Outgoing mail queue and send log. Callers insert pending messages; the
+-- API's background sender delivers them, retrying with backoff, and marks
+-- messages that keep failing (or fail permanently) as dead. Like the outbox,
+-- the table is shared by every org and has no RLS: the sender reads it
+-- across orgs and the send-log endpoint filters by org_id.
+
+CREATE TABLE IF NOT EXISTS emails (
+  id              BIGSERIAL PRIMARY KEY,
+  org_id          BIGINT NOT NULL,
+  kind            TEXT NOT NULL,
+  recipients      TEXT[] NOT NULL,
+  subject         TEXT NOT NULL,
+  body            TEXT NOT NULL,
+  status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'dead')),
+  attempts        INTEGER NOT NULL DEFAULT 0,
+  last_error      TEXT,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  sent_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_emails_pending ON emails(next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_emails_org ON emails(org_id, id DESC);
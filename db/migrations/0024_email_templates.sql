@@ -0,0 +1,30 @@
+-- 0024_email_templates.sql
+-- Per-org overrides of the built-in email templates. A row replaces the
+-- subject and body of one template key (test, invitation, ...); deleting it
+-- reverts the org to the built-in wording.
+
+CREATE TABLE IF NOT EXISTS email_templates (
+  id         BIGSERIAL PRIMARY KEY,
+  org_id     BIGINT NOT NULL,
+  key        TEXT NOT NULL,
+  subject    TEXT NOT NULL,
+  body       TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, key)
+);
+
+DROP TRIGGER IF EXISTS trg_email_templates_updated_at ON email_templates;
+CREATE TRIGGER trg_email_templates_updated_at
+BEFORE UPDATE ON email_templates
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE email_templates ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='email_templates' AND policyname='org_isolation_email_templates') THEN
+    CREATE POLICY org_isolation_email_templates ON email_templates
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
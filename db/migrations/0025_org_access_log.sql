@@ -0,0 +1,19 @@
+-- 0025_org_access_log.sql
+-- One row per request a main-tenant operator made in another org through
+-- X-Org-Context. GET /admin/access-log summarizes it for customer trust
+-- reports. The table spans orgs and is only read by the main tenant, so it
+-- has no RLS.
+
+CREATE TABLE IF NOT EXISTS org_access_log (
+  id          BIGSERIAL PRIMARY KEY,
+  user_id     BIGINT NOT NULL,
+  from_org_id BIGINT NOT NULL,
+  org_id      BIGINT NOT NULL,
+  method      TEXT NOT NULL,
+  path        TEXT NOT NULL,
+  status      INTEGER NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_access_log_org ON org_access_log(org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_org_access_log_created ON org_access_log(created_at);
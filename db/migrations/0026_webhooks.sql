@@ -0,0 +1,43 @@
+-- 0026_webhooks.sql
+-- Webhooks: URLs an org subscribes to item events, and the delivery log the
+-- background sender works through. The outbox subscriber and the sender
+-- read both tables across orgs, so like the emails queue they have no RLS;
+-- the API filters by org_id.
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id         BIGSERIAL PRIMARY KEY,
+  org_id     BIGINT NOT NULL,
+  url        TEXT NOT NULL,
+  events     TEXT[] NOT NULL,
+  secret     TEXT NOT NULL,
+  active     BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+DROP TRIGGER IF EXISTS trg_webhooks_updated_at ON webhooks;
+CREATE TRIGGER trg_webhooks_updated_at
+BEFORE UPDATE ON webhooks
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_org ON webhooks(org_id) WHERE active;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id              BIGSERIAL PRIMARY KEY,
+  webhook_id      BIGINT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  org_id          BIGINT NOT NULL,
+  event_id        BIGINT NOT NULL,
+  event           TEXT NOT NULL,
+  payload         JSONB NOT NULL,
+  status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+  attempts        INTEGER NOT NULL DEFAULT 0,
+  response_code   INTEGER,
+  last_error      TEXT,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  delivered_at    TIMESTAMPTZ,
+  UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id DESC);
@@ -0,0 +1,56 @@
+-- 0027_ipam.sql
+-- IP address management: subnets per org and the addresses reserved in
+-- them. Subnets of an org must not overlap (checked by the API) and an
+-- address can be reserved once per org; deleting an item keeps its
+-- reservations but unassigns them.
+
+CREATE TABLE IF NOT EXISTS subnets (
+  id          BIGSERIAL PRIMARY KEY,
+  org_id      BIGINT NOT NULL DEFAULT 1,
+  cidr        CIDR NOT NULL,
+  name        TEXT NOT NULL,
+  vlan_id     INTEGER CHECK (vlan_id BETWEEN 1 AND 4094),
+  site_id     INTEGER REFERENCES sites(id) ON DELETE SET NULL,
+  gateway     INET,
+  description TEXT,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, cidr)
+);
+
+DROP TRIGGER IF EXISTS trg_subnets_updated_at ON subnets;
+CREATE TRIGGER trg_subnets_updated_at
+BEFORE UPDATE ON subnets
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE INDEX IF NOT EXISTS idx_subnets_cidr ON subnets USING gist (cidr inet_ops);
+
+CREATE TABLE IF NOT EXISTS ip_addresses (
+  id          BIGSERIAL PRIMARY KEY,
+  org_id      BIGINT NOT NULL DEFAULT 1,
+  subnet_id   BIGINT NOT NULL REFERENCES subnets(id) ON DELETE CASCADE,
+  address     INET NOT NULL,
+  item_id     INTEGER REFERENCES inventory(id) ON DELETE SET NULL,
+  hostname    TEXT,
+  description TEXT,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_addresses_subnet ON ip_addresses(subnet_id, address);
+CREATE INDEX IF NOT EXISTS idx_ip_addresses_item ON ip_addresses(item_id) WHERE item_id IS NOT NULL;
+
+ALTER TABLE subnets ENABLE ROW LEVEL SECURITY;
+ALTER TABLE ip_addresses ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='subnets' AND policyname='org_isolation_subnets') THEN
+    CREATE POLICY org_isolation_subnets ON subnets
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='ip_addresses' AND policyname='org_isolation_ip_addresses') THEN
+    CREATE POLICY org_isolation_ip_addresses ON ip_addresses
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
@@ -0,0 +1,32 @@
+-- 0028_inventory_archive.sql
+-- Cold storage for items retired or disposed long ago. Archiving moves the
+-- inventory row here as JSON, with its tags, links, config snapshots and IP
+-- assignments, so the hot table and its indexes stay small; restoring puts
+-- them all back. Archived items are not in item lists or counts.
+
+CREATE TABLE IF NOT EXISTS inventory_archive (
+  id          INTEGER PRIMARY KEY,
+  org_id      BIGINT NOT NULL DEFAULT 1,
+  asset_tag   TEXT NOT NULL,
+  status      TEXT NOT NULL,
+  data        JSONB NOT NULL,
+  dependents  JSONB NOT NULL DEFAULT '{}',
+  archived_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_archive_org ON inventory_archive(org_id, archived_at DESC);
+CREATE INDEX IF NOT EXISTS idx_inventory_archive_tag ON inventory_archive(org_id, asset_tag);
+
+-- Finds archiving candidates without scanning live items
+CREATE INDEX IF NOT EXISTS idx_inventory_decommissioned ON inventory(org_id, updated_at)
+  WHERE status IN ('retired', 'disposed') AND deleted_at IS NULL;
+
+ALTER TABLE inventory_archive ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='inventory_archive' AND policyname='org_isolation_inventory_archive') THEN
+    CREATE POLICY org_isolation_inventory_archive ON inventory_archive
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
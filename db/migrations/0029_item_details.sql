@@ -0,0 +1,53 @@
+-- 0029_item_details.sql
+-- Typed details of routers, firewalls, access points and servers, one table
+-- per device type keyed by item. Items of other device types have no row;
+-- purging an item removes its details.
+
+CREATE TABLE IF NOT EXISTS item_routers (
+  item_id           INTEGER PRIMARY KEY REFERENCES inventory(id) ON DELETE CASCADE,
+  org_id            BIGINT NOT NULL DEFAULT 1,
+  throughput_mbps   INTEGER CHECK (throughput_mbps >= 0),
+  wan_ports         INTEGER CHECK (wan_ports >= 0),
+  routing_protocols TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS item_firewalls (
+  item_id             INTEGER PRIMARY KEY REFERENCES inventory(id) ON DELETE CASCADE,
+  org_id              BIGINT NOT NULL DEFAULT 1,
+  throughput_mbps     INTEGER CHECK (throughput_mbps >= 0),
+  vpn_throughput_mbps INTEGER CHECK (vpn_throughput_mbps >= 0),
+  max_sessions        INTEGER CHECK (max_sessions >= 0),
+  ha_mode             TEXT CHECK (ha_mode IN ('standalone', 'active_passive', 'active_active'))
+);
+
+CREATE TABLE IF NOT EXISTS item_access_points (
+  item_id        INTEGER PRIMARY KEY REFERENCES inventory(id) ON DELETE CASCADE,
+  org_id         BIGINT NOT NULL DEFAULT 1,
+  wifi_standards TEXT[] NOT NULL DEFAULT '{}',
+  radios         INTEGER CHECK (radios >= 0),
+  max_clients    INTEGER CHECK (max_clients >= 0),
+  outdoor        BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS item_servers (
+  item_id    INTEGER PRIMARY KEY REFERENCES inventory(id) ON DELETE CASCADE,
+  org_id     BIGINT NOT NULL DEFAULT 1,
+  cpu_model  TEXT,
+  cpu_cores  INTEGER CHECK (cpu_cores >= 0),
+  ram_gb     INTEGER CHECK (ram_gb >= 0),
+  storage_gb INTEGER CHECK (storage_gb >= 0),
+  os         TEXT
+);
+
+DO $$
+DECLARE
+  v_table TEXT;
+BEGIN
+  FOREACH v_table IN ARRAY ARRAY['item_routers', 'item_firewalls', 'item_access_points', 'item_servers'] LOOP
+    EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', v_table);
+    IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename=v_table AND policyname='org_isolation_' || v_table) THEN
+      EXECUTE format('CREATE POLICY %I ON %I USING (org_id = current_setting(''app.current_org_id'')::bigint)',
+        'org_isolation_' || v_table, v_table);
+    END IF;
+  END LOOP;
+END$$;
@@ -0,0 +1,50 @@
+-- 0030_racks.sql
+-- Racks per site, and where items sit in them: rack_position is the lowest
+-- rack unit (U, counted from 1 at the bottom) an item occupies and
+-- rack_units its height. Items of a rack must not overlap (checked by the
+-- API). Deleting a site removes its racks; deleting a rack unracks its items.
+
+CREATE TABLE IF NOT EXISTS racks (
+  id          BIGSERIAL PRIMARY KEY,
+  org_id      BIGINT NOT NULL DEFAULT 1,
+  site_id     INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+  name        TEXT NOT NULL,
+  units       INTEGER NOT NULL DEFAULT 42 CHECK (units BETWEEN 1 AND 60),
+  description TEXT,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, site_id, name)
+);
+
+DROP TRIGGER IF EXISTS trg_racks_updated_at ON racks;
+CREATE TRIGGER trg_racks_updated_at
+BEFORE UPDATE ON racks
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE racks ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='racks' AND policyname='org_isolation_racks') THEN
+    CREATE POLICY org_isolation_racks ON racks
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
+
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS rack_id       BIGINT REFERENCES racks(id) ON DELETE SET NULL;
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS rack_position INTEGER CHECK (rack_position >= 1);
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS rack_units    INTEGER CHECK (rack_units >= 1);
+
+CREATE INDEX IF NOT EXISTS idx_inventory_rack ON inventory(rack_id, rack_position) WHERE rack_id IS NOT NULL;
+
+-- Tenant schemas provisioned before this migration copied the old table shape
+DO $$
+DECLARE
+  v_schema TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS rack_id BIGINT', v_schema);
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS rack_position INTEGER', v_schema);
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS rack_units INTEGER', v_schema);
+  END LOOP;
+END$$;
@@ -0,0 +1,29 @@
+-- Warranty start and support contract coverage of items
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS warranty_start   DATE;
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS support_contract TEXT;
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS support_level    TEXT;
+ALTER TABLE inventory ADD COLUMN IF NOT EXISTS support_end      DATE;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'inventory_warranty_range_chk') THEN
+    ALTER TABLE inventory ADD CONSTRAINT inventory_warranty_range_chk
+      CHECK (warranty_start IS NULL OR warranty_end IS NULL OR warranty_start <= warranty_end);
+  END IF;
+END$$;
+
+CREATE INDEX IF NOT EXISTS idx_inventory_support_end ON inventory(org_id, support_end)
+  WHERE deleted_at IS NULL AND support_end IS NOT NULL;
+
+-- Tenant schemas provisioned before this migration copied the old table shape
+DO $$
+DECLARE
+  v_schema TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS warranty_start DATE', v_schema);
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS support_contract TEXT', v_schema);
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS support_level TEXT', v_schema);
+    EXECUTE format('ALTER TABLE %I.inventory ADD COLUMN IF NOT EXISTS support_end DATE', v_schema);
+  END LOOP;
+END$$;
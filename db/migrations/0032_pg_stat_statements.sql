@@ -0,0 +1,4 @@
+-- Normalized statement statistics for GET /admin/db/top-queries. The view
+-- only returns rows when the server preloads the library
+-- (shared_preload_libraries = 'pg_stat_statements').
+CREATE EXTENSION IF NOT EXISTS pg_stat_statements;
@@ -0,0 +1,32 @@
+-- 0033_sequences.sql
+-- Named per-org counters for asset tags, PO numbers, audit numbers and the
+-- like. last_value is the highest number handed out; allocating takes a row
+-- lock through a single UPDATE, so concurrent callers never share a number.
+-- Numbers are not reused, even if the caller never stores them.
+
+CREATE TABLE IF NOT EXISTS sequences (
+  id          BIGSERIAL PRIMARY KEY,
+  org_id      BIGINT NOT NULL DEFAULT 1,
+  name        TEXT NOT NULL CHECK (name ~ '^[a-z][a-z0-9_]{1,49}$'),
+  prefix      TEXT NOT NULL DEFAULT '',
+  padding     INTEGER NOT NULL DEFAULT 0 CHECK (padding BETWEEN 0 AND 18),
+  last_value  BIGINT NOT NULL DEFAULT 0 CHECK (last_value >= 0),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, name)
+);
+
+DROP TRIGGER IF EXISTS trg_sequences_updated_at ON sequences;
+CREATE TRIGGER trg_sequences_updated_at
+BEFORE UPDATE ON sequences
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE sequences ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='sequences' AND policyname='org_isolation_sequences') THEN
+    CREATE POLICY org_isolation_sequences ON sequences
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
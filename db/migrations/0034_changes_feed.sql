@@ -0,0 +1,5 @@
+-- 0034_changes_feed.sql
+-- GET /changes reads an org's recent item events from the outbox, newest
+-- first, whether or not they have been delivered yet.
+
+CREATE INDEX IF NOT EXISTS idx_outbox_org_created ON outbox(org_id, created_at);
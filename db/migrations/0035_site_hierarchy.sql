@@ -0,0 +1,33 @@
+-- 0035_site_hierarchy.sql
+-- Coordinates and a parent site (a campus and its buildings, a building and
+-- its floors). Deleting a parent for good leaves its children at the top.
+-- Names are matched case-insensitively when sites are imported from CSV.
+
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS latitude  DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90);
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180);
+ALTER TABLE sites ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES sites(id) ON DELETE SET NULL;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'sites_coordinates_chk') THEN
+    ALTER TABLE sites ADD CONSTRAINT sites_coordinates_chk CHECK ((latitude IS NULL) = (longitude IS NULL));
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'sites_parent_chk') THEN
+    ALTER TABLE sites ADD CONSTRAINT sites_parent_chk CHECK (parent_id <> id);
+  END IF;
+END$$;
+
+CREATE INDEX IF NOT EXISTS idx_sites_parent ON sites(parent_id) WHERE parent_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_sites_lower_name ON sites(org_id, lower(name)) WHERE deleted_at IS NULL;
+
+-- Tenant schemas provisioned before this migration copied the old table shape
+DO $$
+DECLARE
+  v_schema TEXT;
+BEGIN
+  FOR v_schema IN SELECT schema_name FROM organizations WHERE schema_name IS NOT NULL LOOP
+    EXECUTE format('ALTER TABLE %I.sites ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION', v_schema);
+    EXECUTE format('ALTER TABLE %I.sites ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION', v_schema);
+    EXECUTE format('ALTER TABLE %I.sites ADD COLUMN IF NOT EXISTS parent_id INTEGER', v_schema);
+  END LOOP;
+END$$;
@@ -0,0 +1,23 @@
+-- 0036_user_projects.sql
+-- Project membership. A project_admin only reads and writes items of the
+-- projects they are a member of; org admins and auditors are not affected.
+
+CREATE TABLE IF NOT EXISTS user_projects (
+  org_id     BIGINT NOT NULL DEFAULT 1,
+  user_id    BIGINT NOT NULL,
+  project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (org_id, user_id, project_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_projects_project ON user_projects(project_id);
+
+ALTER TABLE user_projects ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='user_projects' AND policyname='org_isolation_user_projects') THEN
+    CREATE POLICY org_isolation_user_projects ON user_projects
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
@@ -0,0 +1,9 @@
+-- 0037_org_retention.sql
+-- Per-org retention of history, in days by class (audit, jobs,
+-- notifications, snapshots). Classes left out follow RETENTION_DAYS; the
+-- retention purger never goes below RETENTION_MIN_DAYS.
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS retention_days JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_org_access_log_org_created ON org_access_log(org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_org_finished ON jobs(org_id, finished_at) WHERE status IN ('succeeded', 'failed');
@@ -0,0 +1,50 @@
+-- 0038_asset_groups.sql
+-- Asset groups: named collections of items, either listed by hand
+-- (asset_group_items) or defined by a saved filter evaluated on every use.
+-- A group has a filter or members, never both. Webhooks may be scoped to a
+-- group; such a group cannot be deleted until its webhooks are.
+
+CREATE TABLE IF NOT EXISTS asset_groups (
+  id          BIGSERIAL PRIMARY KEY,
+  org_id      BIGINT NOT NULL DEFAULT 1,
+  name        TEXT NOT NULL,
+  description TEXT,
+  filter      JSONB,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (org_id, name)
+);
+
+DROP TRIGGER IF EXISTS trg_asset_groups_updated_at ON asset_groups;
+CREATE TRIGGER trg_asset_groups_updated_at
+BEFORE UPDATE ON asset_groups
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- item_id has no foreign key: items of schema-tenant orgs live in their own
+-- inventory table. Members whose item is gone simply stop matching.
+CREATE TABLE IF NOT EXISTS asset_group_items (
+  org_id     BIGINT NOT NULL DEFAULT 1,
+  group_id   BIGINT NOT NULL REFERENCES asset_groups(id) ON DELETE CASCADE,
+  item_id    BIGINT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (group_id, item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_asset_group_items_item ON asset_group_items(org_id, item_id);
+
+ALTER TABLE asset_groups ENABLE ROW LEVEL SECURITY;
+ALTER TABLE asset_group_items ENABLE ROW LEVEL SECURITY;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='asset_groups' AND policyname='org_isolation_asset_groups') THEN
+    CREATE POLICY org_isolation_asset_groups ON asset_groups
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM pg_policies WHERE schemaname='public' AND tablename='asset_group_items' AND policyname='org_isolation_asset_group_items') THEN
+    CREATE POLICY org_isolation_asset_group_items ON asset_group_items
+      USING (org_id = current_setting('app.current_org_id')::bigint);
+  END IF;
+END$$;
+
+ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS group_id BIGINT REFERENCES asset_groups(id) ON DELETE RESTRICT;
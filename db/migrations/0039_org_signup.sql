@@ -0,0 +1,22 @@
+-- 0039_org_signup.sql
+-- Self-signup: POST /signup records a pending organization with a contact
+-- and the hash of a one-time claim secret. Once the main tenant approves
+-- it, the secret is exchanged for the org's first org_admin API key and
+-- cleared. Existing orgs are active.
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS status             TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS contact_name       TEXT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS contact_email      TEXT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS signup_secret_hash TEXT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS approved_at        TIMESTAMPTZ;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS approved_by        BIGINT;
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS claimed_at         TIMESTAMPTZ;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'organizations_status_check') THEN
+    ALTER TABLE organizations ADD CONSTRAINT organizations_status_check CHECK (status IN ('pending', 'active'));
+  END IF;
+END$$;
+
+CREATE INDEX IF NOT EXISTS idx_organizations_pending ON organizations(created_at) WHERE status = 'pending';
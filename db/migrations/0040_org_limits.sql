@@ -0,0 +1,7 @@
+-- 0040_org_limits.sql
+-- Per-org limits set by the main tenant: the most live items an org may
+-- hold and the most rows one import may carry. NULL means unlimited, which
+-- is what every existing org keeps.
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS max_items       INTEGER CHECK (max_items >= 0);
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS max_import_rows INTEGER CHECK (max_import_rows > 0);
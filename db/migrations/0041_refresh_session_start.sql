@@ -0,0 +1,11 @@
+-- 0041_refresh_session_start.sql
+-- When the session a refresh token belongs to was started, copied along
+-- every rotation, so a session can be held to an absolute lifetime
+-- (SESSION_MAX_AGE) however often it is refreshed. Existing families take
+-- the creation time of their first token.
+
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+UPDATE refresh_tokens t SET session_started_at = f.created_at
+FROM refresh_tokens f
+WHERE f.id = t.family_id AND t.session_started_at <> f.created_at;
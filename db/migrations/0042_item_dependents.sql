@@ -0,0 +1,87 @@
+-- 0042_item_dependents.sql
+-- Per-item tables must not reference inventory(id): the items of orgs with a
+-- dedicated schema (0008) live in that schema's inventory, not in public.
+-- Instead of foreign keys, item_dependents lists each table and column
+-- holding an item ID, and a trigger on every inventory table deletes (or
+-- unsets) those rows when an item is deleted, as ON DELETE used to.
+-- provision_org_schema gives each tenant schema its own copy of the
+-- per_tenant tables. Migrations adding a per-item table register it here.
+
+CREATE TABLE IF NOT EXISTS item_dependents (
+  table_name  TEXT NOT NULL,
+  item_column TEXT NOT NULL,
+  on_delete   TEXT NOT NULL CHECK (on_delete IN ('cascade', 'set null')),
+  per_tenant  BOOLEAN NOT NULL DEFAULT TRUE,
+  PRIMARY KEY (table_name, item_column)
+);
+
+-- Tables copied into tenant schemas are reached in the schema of the deleted
+-- item; shared ones in public, by org.
+CREATE OR REPLACE FUNCTION delete_item_dependents()
+RETURNS trigger AS $$
+DECLARE
+  d        RECORD;
+  v_schema TEXT;
+BEGIN
+  FOR d IN SELECT * FROM public.item_dependents ORDER BY table_name, item_column LOOP
+    v_schema := CASE WHEN d.per_tenant THEN TG_TABLE_SCHEMA ELSE 'public' END;
+    IF d.on_delete = 'cascade' THEN
+      EXECUTE format('DELETE FROM %I.%I WHERE org_id = $1 AND %I = $2',
+                     v_schema, d.table_name, d.item_column) USING OLD.org_id, OLD.id;
+    ELSE
+      EXECUTE format('UPDATE %I.%I SET %I = NULL WHERE org_id = $1 AND %I = $2',
+                     v_schema, d.table_name, d.item_column, d.item_column) USING OLD.org_id, OLD.id;
+    END IF;
+  END LOOP;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_inventory_dependents ON inventory;
+CREATE TRIGGER trg_inventory_dependents
+AFTER DELETE ON inventory
+FOR EACH ROW EXECUTE FUNCTION delete_item_dependents();
+
+-- As in 0008, plus the per-item tables and the dependents trigger. Running it
+-- again for a provisioned org adds the tables registered since.
+CREATE OR REPLACE FUNCTION provision_org_schema(p_org_id BIGINT)
+RETURNS TEXT AS $$
+DECLARE
+  v_schema TEXT := 'org_' || p_org_id;
+  v_table  TEXT;
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM organizations WHERE id = p_org_id) THEN
+    RAISE EXCEPTION 'organization % does not exist', p_org_id;
+  END IF;
+
+  EXECUTE format('CREATE SCHEMA IF NOT EXISTS %I', v_schema);
+
+  FOREACH v_table IN ARRAY ARRAY['sites', 'vendors', 'projects', 'inventory'] LOOP
+    EXECUTE format('CREATE TABLE IF NOT EXISTS %I.%I (LIKE public.%I INCLUDING ALL)',
+                   v_schema, v_table, v_table);
+    EXECUTE format('DROP TRIGGER IF EXISTS %I ON %I.%I',
+                   'trg_' || v_table || '_updated_at', v_schema, v_table);
+    EXECUTE format('CREATE TRIGGER %I BEFORE UPDATE ON %I.%I FOR EACH ROW EXECUTE FUNCTION public.set_updated_at()',
+                   'trg_' || v_table || '_updated_at', v_schema, v_table);
+  END LOOP;
+
+  FOR v_table IN SELECT DISTINCT table_name FROM public.item_dependents WHERE per_tenant ORDER BY table_name LOOP
+    EXECUTE format('CREATE TABLE IF NOT EXISTS %I.%I (LIKE public.%I INCLUDING ALL)',
+                   v_schema, v_table, v_table);
+  END LOOP;
+  EXECUTE format('DROP TRIGGER IF EXISTS trg_inventory_dependents ON %I.inventory', v_schema);
+  EXECUTE format('CREATE TRIGGER trg_inventory_dependents AFTER DELETE ON %I.inventory FOR EACH ROW EXECUTE FUNCTION public.delete_item_dependents()',
+                 v_schema);
+
+  UPDATE organizations SET schema_name = v_schema WHERE id = p_org_id;
+  RETURN v_schema;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Configuration snapshots
+ALTER TABLE item_configs DROP CONSTRAINT IF EXISTS item_configs_item_id_fkey;
+INSERT INTO item_dependents (table_name, item_column, on_delete) VALUES
+  ('item_configs', 'item_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+SELECT provision_org_schema(id) FROM organizations WHERE schema_name IS NOT NULL;
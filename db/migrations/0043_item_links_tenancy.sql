@@ -0,0 +1,13 @@
+-- 0043_item_links_tenancy.sql
+-- item_links loses its foreign keys to inventory, which schema-tenant orgs do
+-- not use (see 0042); deleting either item still removes the link.
+
+ALTER TABLE item_links DROP CONSTRAINT IF EXISTS item_links_from_item_id_fkey;
+ALTER TABLE item_links DROP CONSTRAINT IF EXISTS item_links_to_item_id_fkey;
+
+INSERT INTO item_dependents (table_name, item_column, on_delete) VALUES
+  ('item_links', 'from_item_id', 'cascade'),
+  ('item_links', 'to_item_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+SELECT provision_org_schema(id) FROM organizations WHERE schema_name IS NOT NULL;
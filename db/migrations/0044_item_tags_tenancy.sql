@@ -0,0 +1,11 @@
+-- 0044_item_tags_tenancy.sql
+-- item_tags loses its foreign key to inventory, which schema-tenant orgs do
+-- not use (see 0042); deleting an item still removes its tags.
+
+ALTER TABLE item_tags DROP CONSTRAINT IF EXISTS item_tags_item_id_fkey;
+
+INSERT INTO item_dependents (table_name, item_column, on_delete) VALUES
+  ('item_tags', 'item_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+SELECT provision_org_schema(id) FROM organizations WHERE schema_name IS NOT NULL;
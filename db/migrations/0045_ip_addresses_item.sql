@@ -0,0 +1,10 @@
+-- 0045_ip_addresses_item.sql
+-- ip_addresses.item_id loses its foreign key to inventory, which schema-tenant
+-- orgs do not use (see 0042). Subnets and addresses stay shared in public;
+-- deleting an item still unassigns its addresses.
+
+ALTER TABLE ip_addresses DROP CONSTRAINT IF EXISTS ip_addresses_item_id_fkey;
+
+INSERT INTO item_dependents (table_name, item_column, on_delete, per_tenant) VALUES
+  ('ip_addresses', 'item_id', 'set null', FALSE)
+ON CONFLICT DO NOTHING;
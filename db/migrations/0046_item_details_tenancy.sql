@@ -0,0 +1,18 @@
+-- 0046_item_details_tenancy.sql
+-- The typed detail tables lose their foreign keys to inventory, which
+-- schema-tenant orgs do not use (see 0042); deleting an item still removes
+-- its details.
+
+ALTER TABLE item_routers DROP CONSTRAINT IF EXISTS item_routers_item_id_fkey;
+ALTER TABLE item_firewalls DROP CONSTRAINT IF EXISTS item_firewalls_item_id_fkey;
+ALTER TABLE item_access_points DROP CONSTRAINT IF EXISTS item_access_points_item_id_fkey;
+ALTER TABLE item_servers DROP CONSTRAINT IF EXISTS item_servers_item_id_fkey;
+
+INSERT INTO item_dependents (table_name, item_column, on_delete) VALUES
+  ('item_routers', 'item_id', 'cascade'),
+  ('item_firewalls', 'item_id', 'cascade'),
+  ('item_access_points', 'item_id', 'cascade'),
+  ('item_servers', 'item_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+SELECT provision_org_schema(id) FROM organizations WHERE schema_name IS NOT NULL;
@@ -0,0 +1,8 @@
+-- 0047_job_heartbeat.sql
+-- Workers touch heartbeat_at of the jobs they run. A running job whose
+-- heartbeat stopped belonged to a worker that crashed or was killed; runners
+-- fail it so it no longer counts against its org's JOBS_PER_ORG.
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(heartbeat_at) WHERE status = 'running';
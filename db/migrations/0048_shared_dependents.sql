@@ -0,0 +1,96 @@
+-- 0048_shared_dependents.sql
+-- Shared tables in public must not reference sites(id) or projects(id) either:
+-- orgs with a dedicated schema (0008) keep their sites and projects in that
+-- schema. As item_dependents (0042) does for items, shared_dependents lists
+-- each public table and column holding a site or project ID, and a trigger
+-- on every sites and projects table deletes (or unsets) those rows, by org,
+-- when the parent row is deleted. Handlers check that referenced sites and
+-- projects belong to the caller's org.
+
+CREATE TABLE IF NOT EXISTS shared_dependents (
+  parent_table TEXT NOT NULL CHECK (parent_table IN ('sites', 'projects')),
+  table_name   TEXT NOT NULL,
+  ref_column   TEXT NOT NULL,
+  on_delete    TEXT NOT NULL CHECK (on_delete IN ('cascade', 'set null')),
+  PRIMARY KEY (table_name, ref_column)
+);
+
+CREATE OR REPLACE FUNCTION delete_shared_dependents()
+RETURNS trigger AS $$
+DECLARE
+  d RECORD;
+BEGIN
+  FOR d IN SELECT * FROM public.shared_dependents WHERE parent_table = TG_TABLE_NAME
+           ORDER BY table_name, ref_column LOOP
+    IF d.on_delete = 'cascade' THEN
+      EXECUTE format('DELETE FROM public.%I WHERE org_id = $1 AND %I = $2',
+                     d.table_name, d.ref_column) USING OLD.org_id, OLD.id;
+    ELSE
+      EXECUTE format('UPDATE public.%I SET %I = NULL WHERE org_id = $1 AND %I = $2',
+                     d.table_name, d.ref_column, d.ref_column) USING OLD.org_id, OLD.id;
+    END IF;
+  END LOOP;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_sites_dependents ON sites;
+CREATE TRIGGER trg_sites_dependents
+AFTER DELETE ON sites
+FOR EACH ROW EXECUTE FUNCTION delete_shared_dependents();
+
+DROP TRIGGER IF EXISTS trg_projects_dependents ON projects;
+CREATE TRIGGER trg_projects_dependents
+AFTER DELETE ON projects
+FOR EACH ROW EXECUTE FUNCTION delete_shared_dependents();
+
+-- As in 0042, plus the shared dependents triggers on the tenant's sites and
+-- projects
+CREATE OR REPLACE FUNCTION provision_org_schema(p_org_id BIGINT)
+RETURNS TEXT AS $$
+DECLARE
+  v_schema TEXT := 'org_' || p_org_id;
+  v_table  TEXT;
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM organizations WHERE id = p_org_id) THEN
+    RAISE EXCEPTION 'organization % does not exist', p_org_id;
+  END IF;
+
+  EXECUTE format('CREATE SCHEMA IF NOT EXISTS %I', v_schema);
+
+  FOREACH v_table IN ARRAY ARRAY['sites', 'vendors', 'projects', 'inventory'] LOOP
+    EXECUTE format('CREATE TABLE IF NOT EXISTS %I.%I (LIKE public.%I INCLUDING ALL)',
+                   v_schema, v_table, v_table);
+    EXECUTE format('DROP TRIGGER IF EXISTS %I ON %I.%I',
+                   'trg_' || v_table || '_updated_at', v_schema, v_table);
+    EXECUTE format('CREATE TRIGGER %I BEFORE UPDATE ON %I.%I FOR EACH ROW EXECUTE FUNCTION public.set_updated_at()',
+                   'trg_' || v_table || '_updated_at', v_schema, v_table);
+  END LOOP;
+
+  FOR v_table IN SELECT DISTINCT table_name FROM public.item_dependents WHERE per_tenant ORDER BY table_name LOOP
+    EXECUTE format('CREATE TABLE IF NOT EXISTS %I.%I (LIKE public.%I INCLUDING ALL)',
+                   v_schema, v_table, v_table);
+  END LOOP;
+  EXECUTE format('DROP TRIGGER IF EXISTS trg_inventory_dependents ON %I.inventory', v_schema);
+  EXECUTE format('CREATE TRIGGER trg_inventory_dependents AFTER DELETE ON %I.inventory FOR EACH ROW EXECUTE FUNCTION public.delete_item_dependents()',
+                 v_schema);
+
+  FOREACH v_table IN ARRAY ARRAY['sites', 'projects'] LOOP
+    EXECUTE format('DROP TRIGGER IF EXISTS %I ON %I.%I',
+                   'trg_' || v_table || '_dependents', v_schema, v_table);
+    EXECUTE format('CREATE TRIGGER %I AFTER DELETE ON %I.%I FOR EACH ROW EXECUTE FUNCTION public.delete_shared_dependents()',
+                   'trg_' || v_table || '_dependents', v_schema, v_table);
+  END LOOP;
+
+  UPDATE organizations SET schema_name = v_schema WHERE id = p_org_id;
+  RETURN v_schema;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Subnets; deleting a site unassigns its subnets
+ALTER TABLE subnets DROP CONSTRAINT IF EXISTS subnets_site_id_fkey;
+INSERT INTO shared_dependents (parent_table, table_name, ref_column, on_delete) VALUES
+  ('sites', 'subnets', 'site_id', 'set null')
+ON CONFLICT DO NOTHING;
+
+SELECT provision_org_schema(id) FROM organizations WHERE schema_name IS NOT NULL;
@@ -0,0 +1,9 @@
+-- 0049_racks_tenancy.sql
+-- racks.site_id loses its foreign key to sites, which schema-tenant orgs do
+-- not use (see 0048); deleting a site still removes its racks.
+
+ALTER TABLE racks DROP CONSTRAINT IF EXISTS racks_site_id_fkey;
+
+INSERT INTO shared_dependents (parent_table, table_name, ref_column, on_delete) VALUES
+  ('sites', 'racks', 'site_id', 'cascade')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,10 @@
+-- 0050_user_site_access_tenancy.sql
+-- user_site_access.site_id loses its foreign key to sites, which
+-- schema-tenant orgs do not use (see 0048); the API only grants live sites
+-- of the org, and deleting a site still removes its grants.
+
+ALTER TABLE user_site_access DROP CONSTRAINT IF EXISTS user_site_access_site_id_fkey;
+
+INSERT INTO shared_dependents (parent_table, table_name, ref_column, on_delete) VALUES
+  ('sites', 'user_site_access', 'site_id', 'cascade')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,10 @@
+-- 0051_user_projects_tenancy.sql
+-- user_projects.project_id loses its foreign key to projects, which
+-- schema-tenant orgs do not use (see 0048); the API only grants live projects
+-- of the org, and deleting a project still removes its memberships.
+
+ALTER TABLE user_projects DROP CONSTRAINT IF EXISTS user_projects_project_id_fkey;
+
+INSERT INTO shared_dependents (parent_table, table_name, ref_column, on_delete) VALUES
+  ('projects', 'user_projects', 'project_id', 'cascade')
+ON CONFLICT DO NOTHING;
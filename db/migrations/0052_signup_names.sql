@@ -0,0 +1,12 @@
+-- 0052_signup_names.sql
+-- Organization names only have to be unique among active orgs, so POST
+-- /signup answers a taken name like any other and does not reveal which
+-- tenants exist; approving a signup whose name is taken fails instead.
+-- signup_client records the address a pending signup came from, so one
+-- client cannot fill the approval queue.
+
+ALTER TABLE organizations DROP CONSTRAINT IF EXISTS organizations_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS organizations_active_name ON organizations(name) WHERE status = 'active';
+
+ALTER TABLE organizations ADD COLUMN IF NOT EXISTS signup_client TEXT;
+CREATE INDEX IF NOT EXISTS idx_organizations_pending_client ON organizations(signup_client) WHERE status = 'pending';
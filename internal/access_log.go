@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// accessLogWindow is how far back GET /admin/access-log looks without ?since=
+const accessLogWindow = 30 * 24 * time.Hour
+
+// orgAccess summarizes one operator's requests in one org
+type orgAccess struct {
+	UserID      int64     `json:"user_id"`
+	OrgID       int64     `json:"org_id"`
+	OrgName     string    `json:"org_name"`
+	FirstAccess time.Time `json:"first_access"`
+	LastAccess  time.Time `json:"last_access"`
+	Requests    int       `json:"requests"`
+	Writes      int       `json:"writes"`
+	Denied      int       `json:"denied"`
+	Resources   []string  `json:"resources"`
+}
+
+// recordOrgAccess stores a request made through X-Org-Context. The response
+// has been written by now, so a failure is only logged.
+func (s *Server) recordOrgAccess(claims *auth.Claims, orgID int64, r *http.Request, status int) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+	if _, err := s.DB.ExecContext(ctx, `
+		INSERT INTO org_access_log (user_id, from_org_id, org_id, method, path, status)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		claims.UserID, claims.OrgID, orgID, r.Method, r.URL.Path, status); err != nil {
+		log.Printf("audit: recording org override for user=%d to_org=%d: %v", claims.UserID, orgID, err)
+	}
+}
+
+// getAccessLog summarizes which main-tenant operators worked in which orgs
+// and what they touched: one entry per operator and org, with request,
+// write and denied counts and the top-level resources requested. ?org_id=
+// and ?user_id= narrow it; ?since= and ?until= (RFC 3339) bound it, the
+// default being the last 30 days.
+func (s *Server) getAccessLog(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil || s.MainTenantOrgID <= 0 || claims.OrgID != s.MainTenantOrgID {
+		problem.Write(w, r, http.StatusForbidden, "MAIN_TENANT_ONLY", "the access log is only available to main tenant tokens")
+		return
+	}
+	q := r.URL.Query()
+	params := s.parseListParams(r)
+
+	since := time.Now().Add(-accessLogWindow)
+	until := time.Now()
+	for name, dst := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.BadRequest(w, r, name+" must be an RFC 3339 timestamp")
+				return
+			}
+			*dst = t
+		}
+	}
+	args := []interface{}{since, until}
+	cond := "l.created_at >= $1 AND l.created_at < $2"
+	for _, name := range []string{"org_id", "user_id"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			problem.BadRequest(w, r, name+" must be a positive integer")
+			return
+		}
+		args = append(args, id)
+		cond += fmt.Sprintf(" AND l.%s = $%d", name, len(args))
+	}
+
+	rows, err := s.DB.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT l.user_id, l.org_id, COALESCE(o.display_name, o.name, ''),
+		       MIN(l.created_at), MAX(l.created_at), COUNT(*),
+		       COUNT(*) FILTER (WHERE l.method NOT IN ('GET', 'HEAD', 'OPTIONS')),
+		       COUNT(*) FILTER (WHERE l.status IN (401, 403)),
+		       to_json(array_agg(DISTINCT split_part(l.path, '/', 2))),
+		       COUNT(*) OVER() as total_count
+		FROM org_access_log l LEFT JOIN organizations o ON o.id = l.org_id
+		WHERE %s
+		GROUP BY l.user_id, l.org_id, o.display_name, o.name
+		ORDER BY MAX(l.created_at) DESC, l.user_id, l.org_id
+		LIMIT %d OFFSET %d`, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var a orgAccess
+		var resources []byte
+		if err := rows.Scan(&a.UserID, &a.OrgID, &a.OrgName, &a.FirstAccess, &a.LastAccess,
+			&a.Requests, &a.Writes, &a.Denied, &resources, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := json.Unmarshal(resources, &a.Resources); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
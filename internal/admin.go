@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/go-chi/chi/v5"
+
+	"era-inventory-api/internal/health"
+)
+
+// newAdminRouter builds the router for the internal-only admin listener.
+// Operational endpoints live here so the public listener never exposes them.
+func (s *Server) newAdminRouter(enableMetrics bool) *chi.Mux {
+	mux := chi.NewRouter()
+
+	// Liveness: the process is up and serving
+	mux.Method(http.MethodGet, "/healthz", health.LiveHandler())
+	mux.Method(http.MethodGet, "/readyz", s.Health.Handler())
+
+	if enableMetrics {
+		mux.Method(http.MethodGet, "/metrics", s.Metrics.Handler())
+		mux.Get("/admin/perf-baseline", s.getPerfBaseline)
+	}
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
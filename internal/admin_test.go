@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/health"
+)
+
+func TestAdminRouter(t *testing.T) {
+	s := &Server{Metrics: NewMetrics(), Health: health.NewRegistry(time.Second)}
+
+	tests := []struct {
+		name    string
+		metrics bool
+		path    string
+		want    int
+	}{
+		{"liveness", false, "/healthz", http.StatusOK},
+		{"readiness", false, "/readyz", http.StatusOK},
+		{"pprof index", false, "/debug/pprof/", http.StatusOK},
+		{"metrics enabled", true, "/metrics", http.StatusOK},
+		{"metrics disabled", false, "/metrics", http.StatusNotFound},
+		{"perf baseline", true, "/admin/perf-baseline", http.StatusOK},
+		{"perf baseline without metrics", false, "/admin/perf-baseline", http.StatusNotFound},
+		{"no API routes", true, "/items", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.newAdminRouter(tt.metrics).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// Health check errors can name hosts and paths: the public listener reports
+// that a check failed, only the admin listener why
+func TestHealthErrorsOnlyOnAdminListener(t *testing.T) {
+	s := newRoutedServer()
+	s.Health.Register("db", func(context.Context) error { return errors.New("dial tcp 10.0.3.7:5432: connection refused") })
+
+	for _, path := range []string{"/readyz", "/dbping"} {
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusServiceUnavailable || strings.Contains(w.Body.String(), "10.0.3.7") {
+			t.Errorf("public GET %s = %d: %s", path, w.Code, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	s.Admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "10.0.3.7") {
+		t.Errorf("admin GET /readyz = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var (
+	// emailPattern finds email addresses in free text
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// phonePattern finds phone numbers: 7 or more digits, optionally led by
+	// + and separated by spaces, dots, dashes or parentheses
+	phonePattern = regexp.MustCompile(`\+?\(?\d[\d\s().-]{5,}\d`)
+)
+
+// noteFiller is the text anonymized notes are cut from
+const noteFiller = "lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor incididunt ut labore et dolore magna aliqua "
+
+// anonymizer scrubs PII from exported rows while keeping their shape: the
+// same input always maps to the same pseudonym within one export, so
+// repeated values still group together, and text keeps its length. The key
+// is random per export, so pseudonyms cannot be matched across exports or
+// reversed by hashing known addresses.
+type anonymizer struct {
+	key []byte
+}
+
+func newAnonymizer() (*anonymizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &anonymizer{key: key}, nil
+}
+
+// digest is the keyed hash of s, hex encoded
+func (a *anonymizer) digest(s string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// text replaces email addresses and phone numbers in s with pseudonyms,
+// leaving the rest of s as is
+func (a *anonymizer) text(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		return "user-" + a.digest(strings.ToLower(email))[:10] + "@example.invalid"
+	})
+	return phonePattern.ReplaceAllStringFunc(s, func(phone string) string {
+		// keep the formatting, swap every digit for one derived from the number
+		d := a.digest(phone)
+		var b strings.Builder
+		i := 0
+		for _, r := range phone {
+			if r >= '0' && r <= '9' {
+				r = rune('0' + d[i%len(d)]%10)
+				i++
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	})
+}
+
+// note replaces free text entirely with filler of the same length
+func (a *anonymizer) note(s string) string {
+	n := len([]rune(s))
+	return strings.Repeat(noteFiller, n/len(noteFiller)+1)[:n]
+}
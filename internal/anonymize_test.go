@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymizer(t *testing.T) {
+	a, err := newAnonymizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := "Call Jo at +1 (415) 555-0132 or jo.smith@acme.com; rack 12"
+	out := a.text(in)
+	if strings.Contains(out, "jo.smith@acme.com") || strings.Contains(out, "555-0132") {
+		t.Errorf("PII survived: %q", out)
+	}
+	if !strings.HasPrefix(out, "Call Jo at +") || !strings.HasSuffix(out, "@example.invalid; rack 12") {
+		t.Errorf("surrounding text changed: %q", out)
+	}
+	if a.text(in) != out || a.text("JO.SMITH@acme.com") != a.text("jo.smith@acme.com") {
+		t.Error("pseudonyms are not consistent within an export")
+	}
+	if b, _ := newAnonymizer(); b.text(in) == out {
+		t.Error("pseudonyms repeat across exports")
+	}
+
+	for _, note := range []string{"", "short", strings.Repeat("Ünïcode note ", 40)} {
+		got := a.note(note)
+		if len([]rune(got)) != len([]rune(note)) || (note != "" && got == note) {
+			t.Errorf("note(%d runes) = %q", len([]rune(note)), got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/service"
+)
+
+// apiKeyInput is the body accepted by POST /auth/api-keys
+type apiKeyInput struct {
+	Name      string     `json:"name"`
+	Roles     []string   `json:"roles"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// apiKeyCreated is a new key with its secret, returned once
+type apiKeyCreated struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// createAPIKey issues an API key acting for the caller's org with the given
+// roles, none of which may grant more than the caller holds
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		problem.Write(w, r, http.StatusUnauthorized, "AUTHENTICATION_REQUIRED", "Authentication required")
+		return
+	}
+	// the key would belong to the caller's own org, where a request made
+	// through X-Org-Context cannot list or revoke it
+	if auth.OrgIDFromContext(r.Context()) != claims.OrgID {
+		problem.Write(w, r, http.StatusForbidden, "ORG_OVERRIDE_FORBIDDEN", "API keys cannot be issued through "+OrgContextHeader)
+		return
+	}
+	var in apiKeyInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	key, secret, err := s.APIKeys.Create(r.Context(), claims, models.APIKey{Name: in.Name, Roles: in.Roles, ExpiresAt: in.ExpiresAt})
+	switch {
+	case errors.Is(err, service.ErrAPIKeyIssuer):
+		problem.Write(w, r, http.StatusForbidden, "API_KEY_ISSUER", err.Error())
+		return
+	case errors.Is(err, service.ErrScopedToken):
+		problem.Write(w, r, http.StatusForbidden, "SCOPED_TOKEN", "down-scoped tokens cannot issue API keys")
+		return
+	case errors.Is(err, auth.ErrScopeEscalation):
+		problem.Write(w, r, http.StatusForbidden, "SCOPE_ESCALATION", err.Error())
+		return
+	case err != nil:
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(apiKeyCreated{APIKey: key, Key: secret}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// listAPIKeys lists the org's API keys, revoked ones included, without secrets
+func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.APIKeys.List(r.Context(), auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	out := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k)
+	}
+	sendListResponse(w, out, len(out), listParams{limit: len(out)}, nil)
+}
+
+// revokeAPIKey stops an API key from authenticating
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.APIKeys.Revoke(r.Context(), auth.OrgIDFromContext(r.Context()), id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
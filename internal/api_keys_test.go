@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/testutil"
+)
+
+func TestAPIKeyFlow(t *testing.T) {
+	s := newRoutedServer()
+	s.APIKeys = service.NewAPIKeys(testutil.NewMemAPIKeys(), nil)
+	s.JWTManager.SetAPIKeys(s.APIKeys)
+
+	do := func(method, path, bearer, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		if key != "" {
+			r.Header.Set(auth.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		return w
+	}
+
+	admin, _ := s.JWTManager.GenerateToken(3, 1, []string{"org_admin"})
+	w := do("POST", "/auth/api-keys", admin, "", `{"name":"nightly sync","roles":["org_admin"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("API key response may be cached")
+	}
+	var created apiKeyCreated
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(created.Key, created.Prefix) || created.UserID != 3 {
+		t.Errorf("created = %+v", created)
+	}
+
+	// the key authenticates as its issuer's org with its own roles
+	w = do("GET", "/auth/api-keys", "", created.Key, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"nightly sync"`) || strings.Contains(w.Body.String(), created.Key) {
+		t.Errorf("list with key = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/auth/api-keys", "", created.Key, `{"name":"child","roles":["viewer"]}`); w.Code != http.StatusForbidden {
+		t.Errorf("key issuing a key = %d, want 403", w.Code)
+	}
+
+	viewer, _ := s.JWTManager.GenerateToken(4, 1, []string{"viewer"})
+	if w := do("POST", "/auth/api-keys", viewer, "", `{"name":"x","roles":["viewer"]}`); w.Code != http.StatusForbidden {
+		t.Errorf("viewer issuing a key = %d, want 403", w.Code)
+	}
+	if w := do("POST", "/auth/api-keys", admin, "", `{"name":"x","roles":["superuser"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown role = %d, want 400", w.Code)
+	}
+
+	if w := do("DELETE", "/auth/api-keys/1", admin, "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke = %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", "/auth/api-keys", "", created.Key, "")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "INVALID_API_KEY") {
+		t.Errorf("revoked key = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/auth/api-keys", "", "era_unknown", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key = %d, want 401", w.Code)
+	}
+}
+
+// A key issued under X-Org-Context would land in the caller's home org,
+// out of reach of the org the request acts on
+func TestAPIKeysNotIssuedUnderOrgOverride(t *testing.T) {
+	s := &Server{APIKeys: service.NewAPIKeys(testutil.NewMemAPIKeys(), nil)}
+	ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 3, OrgID: 1, Roles: []string{"org_admin"}})
+	ctx = context.WithValue(ctx, auth.OrgIDKey, int64(2))
+	r := httptest.NewRequest("POST", "/auth/api-keys", strings.NewReader(`{"name":"sync","roles":["viewer"]}`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	s.createAPIKey(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "ORG_OVERRIDE_FORBIDDEN") {
+		t.Errorf("create under override = %d: %s", w.Code, w.Body.String())
+	}
+	if keys, _ := s.APIKeys.List(context.Background(), 1); len(keys) != 0 {
+		t.Errorf("keys = %+v, want none", keys)
+	}
+}
+
+// Refresh tokens and exchanged JWTs would outlive the key's revocation
+func TestAPIKeysCannotMintTokens(t *testing.T) {
+	s := newRoutedServer()
+	s.APIKeys = service.NewAPIKeys(testutil.NewMemAPIKeys(), nil)
+	s.JWTManager.SetAPIKeys(s.APIKeys)
+	s.Sessions = service.NewSessions(testutil.NewMemRefreshTokens(), s.JWTManager, 24*time.Hour, 0)
+
+	_, key, err := s.APIKeys.Create(context.Background(), &auth.Claims{UserID: 3, OrgID: 1, Roles: []string{"org_admin"}},
+		models.APIKey{Name: "sync", Roles: []string{"org_admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/auth/sessions", "/auth/token/exchange"} {
+		r := httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		r.Header.Set(auth.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "API_KEY_NOT_ALLOWED") {
+			t.Errorf("%s with an API key = %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+}
+
+// The key handed out by a signup claim has no issuing user; it must be
+// refused a session rather than leave a refresh token without an owner
+func TestBootstrapKeyCannotStartSession(t *testing.T) {
+	s := newRoutedServer()
+	s.APIKeys = service.NewAPIKeys(testutil.NewMemAPIKeys(), nil)
+	s.JWTManager.SetAPIKeys(s.APIKeys)
+	s.Sessions = service.NewSessions(testutil.NewMemRefreshTokens(), s.JWTManager, 24*time.Hour, 0)
+
+	_, key, err := s.APIKeys.Bootstrap(context.Background(), 5, "initial org admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/auth/sessions", nil)
+	r.Header.Set(auth.APIKeyHeader, key)
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "API_KEY_NOT_ALLOWED") {
+		t.Errorf("session with the bootstrap key = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,344 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+const (
+	// archiveInterval is how often cold items are archived
+	archiveInterval = 24 * time.Hour
+	// archiveBatch is how many items one archiving statement moves
+	archiveBatch = 500
+)
+
+// archiveItemsSQL moves up to $3 retired or disposed items of org $1 last
+// changed before $2 into inventory_archive, together with their tags, links,
+// config snapshots, details and IP assignments. The subqueries read the
+// snapshot the statement started with, so they see the dependents before the
+// delete cascades to them.
+var archiveItemsSQL = `
+	WITH moved AS (
+		DELETE FROM inventory WHERE id IN (
+			SELECT id FROM inventory
+			WHERE org_id = $1 AND status IN ('retired', 'disposed') AND deleted_at IS NULL AND updated_at < $2
+			ORDER BY id LIMIT $3
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *
+	)
+	INSERT INTO inventory_archive (id, org_id, asset_tag, status, data, dependents)
+	SELECT m.id, m.org_id, m.asset_tag, m.status, to_jsonb(m), jsonb_build_object(
+		'tags', COALESCE((SELECT jsonb_agg(to_jsonb(t)) FROM item_tags t WHERE t.item_id = m.id), '[]'),
+		'links', COALESCE((SELECT jsonb_agg(to_jsonb(l)) FROM item_links l WHERE l.from_item_id = m.id OR l.to_item_id = m.id), '[]'),
+		'configs', COALESCE((SELECT jsonb_agg(to_jsonb(c)) FROM item_configs c WHERE c.item_id = m.id), '[]'),
+		'ip_ids', COALESCE((SELECT jsonb_agg(a.id) FROM ip_addresses a WHERE a.item_id = m.id), '[]'),
+		'details', ` + archivedDetails() + `)
+	FROM moved m`
+
+// restoreItemSQL moves archived item $1 of org $2 back, with its dependents.
+// Links come back only where the other item is still live; an address
+// reassigned meanwhile stays with its new item, and an item whose rack is
+// gone comes back unracked.
+var restoreItemSQL = `
+	WITH a AS (
+		DELETE FROM inventory_archive WHERE id = $1 AND org_id = $2 RETURNING id, data, dependents
+	), item AS (
+		INSERT INTO inventory SELECT i.* FROM a, jsonb_populate_record(NULL::inventory, a.data ||
+			CASE WHEN EXISTS (SELECT 1 FROM racks k WHERE k.id = (a.data->>'rack_id')::bigint) THEN '{}'::jsonb
+			ELSE '{"rack_id": null, "rack_position": null}'::jsonb END) i
+		RETURNING id
+	), tags AS (
+		INSERT INTO item_tags SELECT t.* FROM a, jsonb_populate_recordset(NULL::item_tags, a.dependents->'tags') t
+		ON CONFLICT DO NOTHING
+	), configs AS (
+		INSERT INTO item_configs SELECT c.* FROM a, jsonb_populate_recordset(NULL::item_configs, a.dependents->'configs') c
+		ON CONFLICT DO NOTHING
+	), links AS (
+		INSERT INTO item_links
+		SELECT l.* FROM a, jsonb_populate_recordset(NULL::item_links, a.dependents->'links') l
+		WHERE EXISTS (SELECT 1 FROM inventory x
+			WHERE x.id = CASE WHEN l.from_item_id = a.id THEN l.to_item_id ELSE l.from_item_id END AND x.deleted_at IS NULL)
+		ON CONFLICT DO NOTHING
+	), ips AS (
+		UPDATE ip_addresses SET item_id = a.id FROM a
+		WHERE ip_addresses.item_id IS NULL
+		  AND ip_addresses.id IN (SELECT jsonb_array_elements_text(a.dependents->'ip_ids')::bigint)
+	)` + restoredDetails() + `
+	SELECT id FROM item`
+
+// detailsTables are the item details tables, in a fixed order
+func detailsTables() []string {
+	tables := make([]string, 0, len(itemSubtypes))
+	for _, st := range itemSubtypes {
+		tables = append(tables, st.table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// archivedDetails is the archived item's details row of each details table,
+// by table (null for tables without one)
+func archivedDetails() string {
+	var pairs []string
+	for _, t := range detailsTables() {
+		pairs = append(pairs, fmt.Sprintf("'%s', (SELECT to_jsonb(x) FROM %s x WHERE x.item_id = m.id)", t, t))
+	}
+	return "jsonb_build_object(" + strings.Join(pairs, ", ") + ")"
+}
+
+// restoredDetails are the restore steps putting back the details rows
+func restoredDetails() string {
+	var steps string
+	for _, t := range detailsTables() {
+		steps += fmt.Sprintf(`, restore_%s AS (
+		INSERT INTO %s SELECT d.* FROM a, jsonb_populate_record(NULL::%s, a.dependents->'details'->'%s') d
+		WHERE jsonb_typeof(a.dependents->'details'->'%s') = 'object'
+	)`, t, t, t, t, t)
+	}
+	return steps
+}
+
+// archivedItem is one entry of GET /archive; Item is the archived row and
+// is only returned by GET /archive/{id}
+type archivedItem struct {
+	ID         int             `json:"id"`
+	AssetTag   string          `json:"asset_tag"`
+	Name       string          `json:"name"`
+	Status     string          `json:"status"`
+	ArchivedAt time.Time       `json:"archived_at"`
+	Item       json.RawMessage `json:"item,omitempty"`
+}
+
+// archiveRunInput is the body of POST /admin/archive
+type archiveRunInput struct {
+	OlderThanYears *int `json:"older_than_years"`
+}
+
+// archiveOrgItems archives the org's cold items in batches and returns how
+// many were moved
+func (s *Server) archiveOrgItems(ctx context.Context, orgID int64, before time.Time) (int64, error) {
+	conn, ctx, err := withDBConn(ctx, s.DB, orgID)
+	if err != nil {
+		return 0, err
+	}
+	defer releaseDBConn(conn)
+
+	q := dbFrom(ctx, s.DB)
+	var total int64
+	for {
+		res, err := q.ExecContext(ctx, archiveItemsSQL, orgID, before, archiveBatch)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < archiveBatch {
+			return total, nil
+		}
+	}
+}
+
+// archiveCutoff is the last-change time before which decommissioned items
+// are archived
+func archiveCutoff(years int) time.Time {
+	return time.Now().AddDate(-years, 0, 0)
+}
+
+// startArchiver archives cold items of every org every archiveInterval until
+// Close. It does nothing when ArchiveAfterYears is 0.
+func (s *Server) startArchiver() {
+	if s.ArchiveAfterYears <= 0 {
+		return
+	}
+	s.archiveStop = make(chan struct{})
+	s.archiveDone = make(chan struct{})
+	go func() {
+		defer close(s.archiveDone)
+		ticker := time.NewTicker(archiveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.archiveStop:
+				return
+			case <-ticker.C:
+				s.archiveAll()
+			}
+		}
+	}()
+}
+
+// stopArchiver stops the loop started by startArchiver and waits for it
+func (s *Server) stopArchiver() {
+	if s.archiveStop == nil {
+		return
+	}
+	close(s.archiveStop)
+	<-s.archiveDone
+	s.archiveStop = nil
+}
+
+// archiveAll archives org by org, so RLS and schema tenancy apply as they do
+// for requests
+func (s *Server) archiveAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	rows, err := s.DB.QueryContext(ctx, `SELECT id FROM organizations ORDER BY id`)
+	if err != nil {
+		log.Printf("archive failed: %v", err)
+		return
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Printf("archive failed: %v", err)
+			return
+		}
+		orgIDs = append(orgIDs, id)
+	}
+	rows.Close()
+
+	before := archiveCutoff(s.ArchiveAfterYears)
+	for _, orgID := range orgIDs {
+		n, err := s.archiveOrgItems(ctx, orgID, before)
+		if err != nil {
+			log.Printf("archive failed for org %d: %v", orgID, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("archived %d items of org %d", n, orgID)
+		}
+	}
+}
+
+// runArchive archives the caller's org now. older_than_years defaults to
+// ARCHIVE_AFTER_YEARS.
+func (s *Server) runArchive(w http.ResponseWriter, r *http.Request) {
+	var in archiveRunInput
+	if !s.decodeOptionalJSON(w, r, &in) {
+		return
+	}
+	years := s.ArchiveAfterYears
+	if in.OlderThanYears != nil {
+		years = *in.OlderThanYears
+	}
+	if years < 1 {
+		problem.BadRequest(w, r, "older_than_years must be at least 1 (archiving is not configured)")
+		return
+	}
+	// the request already holds the org's connection, so archive on it
+	q := dbFrom(r.Context(), s.DB)
+	orgID := auth.OrgIDFromContext(r.Context())
+	var total int64
+	for {
+		res, err := q.ExecContext(r.Context(), archiveItemsSQL, orgID, archiveCutoff(years), archiveBatch)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if n < archiveBatch {
+			break
+		}
+	}
+	writeJSON(w, r, http.StatusOK, map[string]int64{"archived": total})
+}
+
+// listArchive lists the org's archived items, most recently archived first.
+// ?q= matches the asset tag or name.
+func (s *Server) listArchive(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	args := []interface{}{auth.OrgIDFromContext(r.Context())}
+	cond := "org_id = $1"
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		args = append(args, "%"+q+"%")
+		cond += fmt.Sprintf(" AND (asset_tag ILIKE $%d OR data->>'name' ILIKE $%d)", len(args), len(args))
+	}
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT id, asset_tag, COALESCE(data->>'name', ''), status, archived_at, COUNT(*) OVER() as total_count
+		FROM inventory_archive WHERE %s
+		ORDER BY archived_at DESC, id DESC
+		LIMIT %d OFFSET %d`, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var a archivedItem
+		if err := rows.Scan(&a.ID, &a.AssetTag, &a.Name, &a.Status, &a.ArchivedAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+// getArchivedItem returns an archived item with its archived row
+func (s *Server) getArchivedItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var a archivedItem
+	err := dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		SELECT id, asset_tag, COALESCE(data->>'name', ''), status, archived_at, data
+		FROM inventory_archive WHERE id = $1 AND org_id = $2`, id, auth.OrgIDFromContext(r.Context())).
+		Scan(&a.ID, &a.AssetTag, &a.Name, &a.Status, &a.ArchivedAt, &a.Item)
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, a)
+}
+
+// restoreArchivedItem moves an archived item back into the inventory and
+// returns it. It gets 409 when its asset tag has been reused meanwhile.
+func (s *Server) restoreArchivedItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if !s.checkItemQuota(w, r, 1) {
+		return
+	}
+	var restored int
+	err := dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), restoreItemSQL, id, auth.OrgIDFromContext(r.Context())).Scan(&restored)
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "asset_tag") {
+			problem.Conflict(w, r, "the item's asset_tag is now used by another item")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getItem(w, r)
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunArchiveNeedsAnAge(t *testing.T) {
+	for _, body := range []string{"", `{}`, `{"older_than_years":0}`} {
+		w := httptest.NewRecorder()
+		(&Server{}).runArchive(w, httptest.NewRequest(http.MethodPost, "/admin/archive", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("body %q: status = %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestArchiverStops(t *testing.T) {
+	s := &Server{}
+	s.startArchiver() // not configured: nothing started
+	s.stopArchiver()
+
+	s.ArchiveAfterYears = 3
+	s.startArchiver()
+	done := make(chan struct{})
+	go func() {
+		s.stopArchiver()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stopArchiver did not return")
+	}
+}
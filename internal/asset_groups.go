@@ -0,0 +1,448 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/outbox"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+)
+
+// maxAssetGroupItemIDs caps item_ids in one POST /asset-groups/{id}/items
+const maxAssetGroupItemIDs = 1000
+
+// assetGroupColumns is what asset group queries select, in scanAssetGroup order
+const assetGroupColumns = "id, name, description, filter, created_at, updated_at"
+
+// assetGroupInput is the body of POST /asset-groups and PUT /asset-groups/{id};
+// on update, omitted fields are left unchanged. A group created with a filter
+// is a filter group for good, and one created without is a manual group.
+type assetGroupInput struct {
+	Name        *string                  `json:"name"`
+	Description *string                  `json:"description"`
+	Filter      *models.AssetGroupFilter `json:"filter"`
+}
+
+// assetGroupItemsInput is the body of POST /asset-groups/{id}/items
+type assetGroupItemsInput struct {
+	ItemIDs []int64 `json:"item_ids"`
+}
+
+// assetGroupItemsResult reports how many items were added to a manual group
+type assetGroupItemsResult struct {
+	GroupID int64 `json:"group_id"`
+	Added   int   `json:"added"`
+}
+
+// andAssetGroup narrows an item filter to the members of an asset group; an
+// unknown group matches nothing
+func andAssetGroup(where *query.Where, groupID int64) {
+	where.AndNumbered(assetGroupMatch(fmt.Sprintf("$%d", where.Next()), "inventory"), []interface{}{groupID})
+}
+
+// groupParam parses ?group=, the asset group a list or report is narrowed to
+func groupParam(r *http.Request) (int64, bool, error) {
+	v := r.URL.Query().Get("group")
+	if v == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 1 {
+		return 0, false, errors.New("group must be a positive integer")
+	}
+	return id, true, nil
+}
+
+// reportGroupClause is the ?group= condition of a report on the item rows of
+// table, numbered from arg; it is empty without ?group= and writes 400 when
+// the parameter is malformed
+func reportGroupClause(w http.ResponseWriter, r *http.Request, table string, arg int) (string, []interface{}, bool) {
+	groupID, ok, err := groupParam(r)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return "", nil, false
+	}
+	if !ok {
+		return "", nil, true
+	}
+	return assetGroupMatch(fmt.Sprintf("$%d", arg), table), []interface{}{groupID}, true
+}
+
+// normalizeAssetGroupFilter trims and checks a saved filter, which must set
+// at least one field
+func normalizeAssetGroupFilter(f *models.AssetGroupFilter) error {
+	f.Q = strings.TrimSpace(f.Q)
+	f.Site = strings.TrimSpace(f.Site)
+	f.DeviceType = strings.TrimSpace(f.DeviceType)
+	if f.Status != "" && !validItemStatus(f.Status) {
+		return errors.New("filter.status must be one of: " + strings.Join(models.ItemStatuses, ", "))
+	}
+	if len(f.Tags) > 0 {
+		tags, err := normalizeTags(f.Tags)
+		if err != nil {
+			return err
+		}
+		f.Tags = tags
+	}
+	if f.Q == "" && f.Status == "" && len(f.Tags) == 0 && f.Site == "" && f.DeviceType == "" {
+		return errors.New("filter needs q, status, tags, site or device_type")
+	}
+	return nil
+}
+
+func checkAssetGroupFields(in assetGroupInput) error {
+	if in.Name != nil && (strings.TrimSpace(*in.Name) == "" || len(*in.Name) > 100) {
+		return errors.New("name must be 1 to 100 characters")
+	}
+	if in.Filter != nil {
+		return normalizeAssetGroupFilter(in.Filter)
+	}
+	return nil
+}
+
+// scanAssetGroup reads assetGroupColumns, then any extra columns into extra
+func scanAssetGroup(row interface{ Scan(...any) error }, extra ...any) (*models.AssetGroup, error) {
+	var g models.AssetGroup
+	var filter []byte
+	dest := append([]any{&g.ID, &g.Name, &g.Description, &filter, &g.CreatedAt, &g.UpdatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	g.Kind = models.AssetGroupKindManual
+	if filter != nil {
+		g.Kind = models.AssetGroupKindFilter
+		g.Filter = &models.AssetGroupFilter{}
+		if err := json.Unmarshal(filter, g.Filter); err != nil {
+			return nil, err
+		}
+	}
+	return &g, nil
+}
+
+// assetGroupInOrg loads the {id} asset group of the caller's org, writing 404
+// if there is none
+func (s *Server) assetGroupInOrg(w http.ResponseWriter, r *http.Request) (*models.AssetGroup, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, false
+	}
+	g, err := scanAssetGroup(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(),
+		`SELECT `+assetGroupColumns+` FROM asset_groups WHERE id = $1 AND org_id = $2`, id, auth.OrgIDFromContext(r.Context())))
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return nil, false
+	}
+	return g, true
+}
+
+// assetGroupExists reports whether id names an asset group of the caller's org
+func (s *Server) assetGroupExists(ctx context.Context, id int64) (bool, error) {
+	var ok bool
+	err := dbFrom(ctx, s.DB).QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM asset_groups WHERE id = $1 AND org_id = $2)`,
+		id, auth.OrgIDFromContext(ctx)).Scan(&ok)
+	return ok, err
+}
+
+// listAssetGroups lists the org's asset groups by name; ?q= searches names
+func (s *Server) listAssetGroups(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	where := query.OrgScoped(auth.OrgIDFromContext(r.Context()))
+	if params.q != "" {
+		where.And("name ILIKE ?", "%"+params.q+"%")
+	}
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER() as total_count
+		FROM asset_groups%s
+		ORDER BY name, id
+		LIMIT %d OFFSET %d`, assetGroupColumns, where.Clause(), params.limit, params.offset), where.Args()...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		g, err := scanAssetGroup(rows, &totalCount)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+func (s *Server) getAssetGroup(w http.ResponseWriter, r *http.Request) {
+	if g, ok := s.assetGroupInOrg(w, r); ok {
+		writeJSON(w, r, http.StatusOK, g)
+	}
+}
+
+// createAssetGroup creates a filter group when the body has a filter and a
+// manual group, empty until items are added, when it has none
+func (s *Server) createAssetGroup(w http.ResponseWriter, r *http.Request) {
+	var in assetGroupInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.Name == nil {
+		problem.BadRequest(w, r, "name is required")
+		return
+	}
+	if err := checkAssetGroupFields(in); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	var filter []byte
+	if in.Filter != nil {
+		var err error
+		if filter, err = json.Marshal(in.Filter); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+	}
+
+	name := strings.TrimSpace(*in.Name)
+	g, err := scanAssetGroup(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		INSERT INTO asset_groups (org_id, name, description, filter) VALUES ($1, $2, $3, $4)
+		RETURNING `+assetGroupColumns, auth.OrgIDFromContext(r.Context()), name, in.Description, filter))
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, "an asset group named "+name+" already exists")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/asset-groups/%d", g.ID))
+	writeJSON(w, r, http.StatusCreated, g)
+}
+
+// updateAssetGroup renames a group or replaces its description or, for a
+// filter group, its filter
+func (s *Server) updateAssetGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.assetGroupInOrg(w, r)
+	if !ok {
+		return
+	}
+	var in assetGroupInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.Name == nil && in.Description == nil && in.Filter == nil {
+		problem.BadRequest(w, r, "no fields to update")
+		return
+	}
+	if in.Filter != nil && g.Kind == models.AssetGroupKindManual {
+		problem.BadRequest(w, r, "a manual group has no filter; create a filter group instead")
+		return
+	}
+	if err := checkAssetGroupFields(in); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	var filter []byte
+	if in.Filter != nil {
+		var err error
+		if filter, err = json.Marshal(in.Filter); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+	}
+	var name *string
+	if in.Name != nil {
+		trimmed := strings.TrimSpace(*in.Name)
+		name = &trimmed
+	}
+
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		UPDATE asset_groups SET name = COALESCE($2, name), description = COALESCE($3, description),
+		       filter = COALESCE($4, filter)
+		WHERE id = $1`, g.ID, name, in.Description, filter); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, "an asset group with that name already exists")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getAssetGroup(w, r)
+}
+
+// deleteAssetGroup removes a group and its member list; the items themselves
+// are untouched. A group webhooks are scoped to is kept until they are
+// deleted or unscoped.
+func (s *Server) deleteAssetGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.assetGroupInOrg(w, r)
+	if !ok {
+		return
+	}
+	q := dbFrom(r.Context(), s.DB)
+	var hooks int
+	if err := q.QueryRowContext(r.Context(),
+		`SELECT COUNT(*) FROM webhooks WHERE group_id = $1`, g.ID).Scan(&hooks); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if hooks > 0 {
+		problem.Conflict(w, r, fmt.Sprintf("asset group %s is used by %d webhooks", g.Name, hooks))
+		return
+	}
+	if _, err := q.ExecContext(r.Context(), `DELETE FROM asset_groups WHERE id = $1`, g.ID); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listAssetGroupItems lists the items of a group as GET /items?group={id}
+// does, with the same filters, sort and envelope
+func (s *Server) listAssetGroupItems(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.assetGroupInOrg(w, r)
+	if !ok {
+		return
+	}
+	values := r.URL.Query()
+	values.Set("group", strconv.FormatInt(g.ID, 10))
+	r.URL.RawQuery = values.Encode()
+	s.listItems(w, r)
+}
+
+// addAssetGroupItems adds visible items to a manual group. Every item_id must
+// name one or nothing is added; items already in the group are not counted.
+func (s *Server) addAssetGroupItems(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.assetGroupInOrg(w, r)
+	if !ok {
+		return
+	}
+	if g.Kind == models.AssetGroupKindFilter {
+		problem.Conflict(w, r, "the members of a filter group follow its filter")
+		return
+	}
+	var in assetGroupItemsInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if len(in.ItemIDs) == 0 {
+		problem.BadRequest(w, r, "item_ids is required")
+		return
+	}
+	if len(in.ItemIDs) > maxAssetGroupItemIDs {
+		problem.BadRequest(w, r, fmt.Sprintf("at most %d item_ids per request", maxAssetGroupItemIDs))
+		return
+	}
+
+	where, err := itemFilterFor(r.Context(), "", "", nil)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	where.And("id = ANY(?)", in.ItemIDs)
+	q := dbFrom(r.Context(), s.DB)
+	missing, err := missingItemIDs(r, q, where, in.ItemIDs)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if len(missing) > 0 {
+		problem.BadRequest(w, r, "unknown item_ids: "+joinIDs(missing))
+		return
+	}
+
+	res, err := q.ExecContext(r.Context(), `
+		INSERT INTO asset_group_items (org_id, group_id, item_id)
+		SELECT $1, $2, unnest($3::bigint[])
+		ON CONFLICT DO NOTHING`, auth.OrgIDFromContext(r.Context()), g.ID, in.ItemIDs)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	n, _ := res.RowsAffected()
+	writeJSON(w, r, http.StatusOK, assetGroupItemsResult{GroupID: g.ID, Added: int(n)})
+}
+
+// removeAssetGroupItem takes an item out of a manual group
+func (s *Server) removeAssetGroupItem(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.assetGroupInOrg(w, r)
+	if !ok {
+		return
+	}
+	if g.Kind == models.AssetGroupKindFilter {
+		problem.Conflict(w, r, "the members of a filter group follow its filter")
+		return
+	}
+	itemID, err := strconv.ParseInt(chi.URLParam(r, "itemID"), 10, 64)
+	if err != nil {
+		problem.NotFound(w, r)
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(),
+		`DELETE FROM asset_group_items WHERE group_id = $1 AND item_id = $2`, g.ID, itemID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookItemGroups returns which of groups hold the item of an item event,
+// as the item is after the change. It runs in the event's org, so schema
+// tenants' items are found.
+func (s *Server) webhookItemGroups(ctx context.Context, e outbox.Event, groups []int64) ([]int64, error) {
+	var item struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(e.Payload, &item); err != nil {
+		return nil, err
+	}
+	conn, ctx, err := withDBConn(ctx, s.DB, e.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseDBConn(conn)
+
+	rows, err := dbFrom(ctx, s.DB).QueryContext(ctx, `
+		SELECT sg.id FROM unnest($3::bigint[]) AS sg(id)
+		WHERE EXISTS (SELECT 1 FROM inventory WHERE id = $1 AND org_id = $2 AND `+assetGroupMatch("sg.id", "inventory")+`)`,
+		item.ID, e.OrgID, groups)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
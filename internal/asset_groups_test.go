@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+)
+
+func TestAssetGroupMatch(t *testing.T) {
+	clause := assetGroupMatch("$4", "i")
+	for _, want := range []string{"ag.id = $4", "ag.org_id = i.org_id", "am.item_id = i.id", "lower(i.site)", "it.item_id = i.id"} {
+		if !strings.Contains(clause, want) {
+			t.Errorf("clause lacks %q: %s", want, clause)
+		}
+	}
+	if strings.ContainsAny(clause, "{}") {
+		t.Errorf("placeholders left in %s", clause)
+	}
+}
+
+func TestItemFilterGroup(t *testing.T) {
+	ctx := context.WithValue(context.Background(), auth.OrgIDKey, int64(3))
+	r := httptest.NewRequest(http.MethodGet, "/items?status=active&group=9", nil).WithContext(ctx)
+	where, err := itemFilter(r, listParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// after the org, status and site grant arguments
+	if !strings.Contains(where.Clause(), "ag.id = $4") {
+		t.Errorf("group is not the last argument: %s", where.Clause())
+	}
+	if args := where.Args(); len(args) != 4 || args[3] != int64(9) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	for _, v := range []string{"abc", "0", "-2"} {
+		r := httptest.NewRequest(http.MethodGet, "/items?group="+v, nil).WithContext(ctx)
+		if _, err := itemFilter(r, listParams{}); err == nil {
+			t.Errorf("group=%s accepted", v)
+		}
+	}
+}
+
+func TestNormalizeAssetGroupFilter(t *testing.T) {
+	f := models.AssetGroupFilter{Q: "  core ", Tags: []string{"Network", "network"}, Site: " HQ "}
+	if err := normalizeAssetGroupFilter(&f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Q != "core" || f.Site != "HQ" || !reflect.DeepEqual(f.Tags, []string{"network"}) {
+		t.Errorf("Unexpected filter %+v", f)
+	}
+
+	for _, bad := range []models.AssetGroupFilter{{}, {Q: "   "}, {Status: "lost"}} {
+		if err := normalizeAssetGroupFilter(&bad); err == nil {
+			t.Errorf("filter %+v accepted", bad)
+		}
+	}
+}
+
+func TestCreateAssetGroupValidation(t *testing.T) {
+	for body, want := range map[string]string{
+		`{}`:                               "name is required",
+		`{"name":" "}`:                     "name must be",
+		`{"name":"Core","filter":{}}`:      "filter needs",
+		`{"name":"Core","filter":{"x":1}}`: "unknown field",
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/asset-groups", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		(&Server{}).createAssetGroup(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: status = %d, body %s", body, w.Code, w.Body)
+		}
+	}
+}
@@ -2,13 +2,25 @@ package auth
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"era-inventory-api/internal/problem"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -383,7 +395,12 @@ func TestPublicPaths(t *testing.T) {
 		want bool
 	}{
 		{"/health", true},
+		{"/healthz", true},
 		{"/dbping", true},
+		{"/readyz", true},
+		{"/version", true},
+		{"/.well-known/jwks.json", true},
+		{"/status.json", true},
 		{"/items", false},
 		{"/sites", false},
 		{"/vendors", false},
@@ -465,7 +482,7 @@ func TestAuthMiddleware_InvalidTokenFormat(t *testing.T) {
 		t.Errorf("Expected status Unauthorized, got %d", w.Code)
 	}
 	
-	var errorResp ErrorResponse
+	var errorResp problem.Details
 	if err := json.NewDecoder(w.Body).Decode(&errorResp); err != nil {
 		t.Errorf("Failed to decode error response: %v", err)
 	}
@@ -562,26 +579,436 @@ func TestMustRole_SufficientPermissions(t *testing.T) {
 func TestSendErrorResponse(t *testing.T) {
 	w := httptest.NewRecorder()
 	
-	sendErrorResponse(w, "Test error", "TEST_ERROR", http.StatusBadRequest)
+	req := httptest.NewRequest("GET", "/items/7", nil)
+	
+	sendErrorResponse(w, req, "Test error", "TEST_ERROR", http.StatusBadRequest)
 	
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status BadRequest, got %d", w.Code)
 	}
 	
-	if w.Header().Get("Content-Type") != "application/json" {
-		t.Errorf("Expected Content-Type application/json, got %s", w.Header().Get("Content-Type"))
+	if w.Header().Get("Content-Type") != problem.ContentType {
+		t.Errorf("Expected Content-Type %s, got %s", problem.ContentType, w.Header().Get("Content-Type"))
 	}
 	
-	var errorResp ErrorResponse
+	var errorResp problem.Details
 	if err := json.NewDecoder(w.Body).Decode(&errorResp); err != nil {
 		t.Errorf("Failed to decode error response: %v", err)
 	}
 	
-	if errorResp.Error != "Test error" {
-		t.Errorf("Expected error message 'Test error', got %s", errorResp.Error)
+	if errorResp.Detail != "Test error" {
+		t.Errorf("Expected detail 'Test error', got %s", errorResp.Detail)
 	}
 	
 	if errorResp.Code != "TEST_ERROR" {
 		t.Errorf("Expected error code 'TEST_ERROR', got %s", errorResp.Code)
 	}
+	
+	if errorResp.Status != http.StatusBadRequest {
+		t.Errorf("Expected status member 400, got %d", errorResp.Status)
+	}
+	
+	if errorResp.Title != "Bad Request" {
+		t.Errorf("Expected title 'Bad Request', got %s", errorResp.Title)
+	}
+	
+	if errorResp.Instance != "/items/7" {
+		t.Errorf("Expected instance '/items/7', got %s", errorResp.Instance)
+	}
+}
+
+func TestClaims_IsReadOnly(t *testing.T) {
+	tests := []struct {
+		roles []string
+		want  bool
+	}{
+		{[]string{"auditor"}, true},
+		{[]string{"auditor", "org_admin"}, false},
+		{[]string{"viewer"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		c := &Claims{Roles: tt.roles}
+		if got := c.IsReadOnly(); got != tt.want {
+			t.Errorf("IsReadOnly(%v) = %v, want %v", tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestDenyReadOnlyWrites(t *testing.T) {
+	handler := DenyReadOnlyWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		roles  []string
+		want   int
+	}{
+		{"GET", []string{"auditor"}, http.StatusOK},
+		{"HEAD", []string{"auditor"}, http.StatusOK},
+		{"POST", []string{"auditor"}, http.StatusForbidden},
+		{"PUT", []string{"auditor"}, http.StatusForbidden},
+		{"DELETE", []string{"auditor"}, http.StatusForbidden},
+		{"POST", []string{"org_admin"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/items", nil)
+		req = req.WithContext(context.WithValue(req.Context(), ClaimsKey, &Claims{UserID: 1, OrgID: 1, Roles: tt.roles}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s as %v: expected %d, got %d", tt.method, tt.roles, tt.want, w.Code)
+		}
+	}
+
+	// Comparisons change nothing, so auditors may post them
+	req := httptest.NewRequest("POST", "/reconcile", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ClaimsKey, &Claims{UserID: 1, OrgID: 1, Roles: []string{"auditor"}}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("POST /reconcile as auditor: expected 200, got %d", w.Code)
+	}
+}
+
+func TestValidateToken_MultipleAudiences(t *testing.T) {
+	secret := "this-is-a-very-long-secret-key-for-testing-purposes-only"
+	portal := NewJWTManager(secret, "era-portal", "portal", time.Hour)
+	mobile := NewJWTManager(secret, "era-portal", "mobile", time.Hour)
+	other := NewJWTManager(secret, "someone-else", "portal", time.Hour)
+	api := NewJWTManager(secret, "era-portal, era-mobile", "portal,mobile", time.Hour)
+
+	if api.issuer != "era-portal" || api.audience != "portal" {
+		t.Errorf("Expected first entries to be used for minting, got %s/%s", api.issuer, api.audience)
+	}
+
+	for name, minter := range map[string]*JWTManager{"portal": portal, "mobile": mobile} {
+		token, err := minter.GenerateToken(1, 1, []string{"viewer"})
+		if err != nil {
+			t.Fatalf("Failed to generate %s token: %v", name, err)
+		}
+		if _, err := api.ValidateToken(token); err != nil {
+			t.Errorf("Expected %s token to be accepted: %v", name, err)
+		}
+	}
+
+	token, err := other.GenerateToken(1, 1, []string{"viewer"})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if _, err := api.ValidateToken(token); err == nil {
+		t.Error("Expected token from an unknown issuer to be rejected")
+	}
+
+	token, err = api.GenerateToken(1, 1, []string{"viewer"})
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	if _, err := NewJWTManager(secret, "era-portal", "reports", time.Hour).ValidateToken(token); err == nil {
+		t.Error("Expected token for another audience to be rejected")
+	}
+}
+
+func TestValidateToken_Leeway(t *testing.T) {
+	secret := "this-is-a-very-long-secret-key-for-testing-purposes-only"
+	manager := NewJWTManager(secret, "era", "era", time.Hour)
+	sign := func(nbf, exp time.Time) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+			UserID: 1, OrgID: 1, Roles: []string{"viewer"},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer: "era", Audience: []string{"era"},
+				NotBefore: jwt.NewNumericDate(nbf), ExpiresAt: jwt.NewNumericDate(exp),
+			},
+		}).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	now := time.Now()
+	early := sign(now.Add(10*time.Second), now.Add(time.Hour))
+	late := sign(now.Add(-time.Hour), now.Add(-10*time.Second))
+
+	if _, err := manager.ValidateToken(early); !errors.Is(err, ErrTokenNotValidYet) {
+		t.Errorf("Expected ErrTokenNotValidYet without leeway, got %v", err)
+	}
+	if _, err := manager.ValidateToken(late); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired without leeway, got %v", err)
+	}
+
+	manager.SetLeeway(30 * time.Second)
+	for name, token := range map[string]string{"early": early, "late": late} {
+		if _, err := manager.ValidateToken(token); err != nil {
+			t.Errorf("Expected %s token within leeway to be accepted: %v", name, err)
+		}
+	}
+
+	manager.SetLeeway(0)
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Header.Set("Authorization", "Bearer "+early)
+	w := httptest.NewRecorder()
+	AuthMiddleware(manager)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("Handler should not be called with a token that is not valid yet")
+	})).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "TOKEN_NOT_YET_VALID") {
+		t.Errorf("Expected 401 TOKEN_NOT_YET_VALID, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGenerateScopedToken(t *testing.T) {
+	manager := NewJWTManager("this-is-a-very-long-secret-key-for-testing-purposes-only", "test-issuer", "test-audience", time.Hour)
+	parentExpiry := time.Now().Add(10 * time.Minute)
+	parent := &Claims{
+		UserID: 7,
+		OrgID:  3,
+		Roles:  []string{"org_admin", "viewer"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(parentExpiry),
+		},
+	}
+
+	token, expiresAt, err := manager.GenerateScopedToken(parent, []string{"viewer"}, []int64{4, 5}, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate scoped token: %v", err)
+	}
+	if expiresAt.After(parentExpiry) {
+		t.Errorf("Scoped token must not outlive its parent: %v > %v", expiresAt, parentExpiry)
+	}
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("Scoped token should validate: %v", err)
+	}
+	if claims.UserID != 7 || claims.OrgID != 3 {
+		t.Errorf("Unexpected identity %d/%d", claims.UserID, claims.OrgID)
+	}
+	if len(claims.Roles) != 1 || claims.Roles[0] != "viewer" {
+		t.Errorf("Expected roles [viewer], got %v", claims.Roles)
+	}
+	if len(claims.SiteIDs) != 2 {
+		t.Errorf("Expected two sites, got %v", claims.SiteIDs)
+	}
+
+	if _, _, err := manager.GenerateScopedToken(parent, []string{"project_admin"}, nil, time.Minute); !errors.Is(err, ErrScopeEscalation) {
+		t.Errorf("Expected ErrScopeEscalation for a role the parent lacks, got %v", err)
+	}
+	if _, _, err := manager.GenerateScopedToken(claims, nil, []int64{6}, time.Minute); !errors.Is(err, ErrScopeEscalation) {
+		t.Errorf("Expected ErrScopeEscalation for a site outside the parent's, got %v", err)
+	}
+}
+
+func TestRevokedTokensAreRejected(t *testing.T) {
+	manager := NewJWTManager("test-secret-key-that-is-long-enough-for-testing", "test-issuer", "test-audience", time.Hour)
+	revoked := NewRevocations()
+	manager.SetRevocations(revoked)
+
+	token, _ := manager.GenerateToken(1, 1, []string{"viewer"})
+	other, _ := manager.GenerateToken(1, 1, []string{"viewer"})
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID == "" {
+		t.Fatal("token has no jti")
+	}
+
+	revoked.Revoke(claims.ID, claims.ExpiresAt.Time)
+	if _, err := manager.ValidateToken(token); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("revoked token: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := manager.ValidateToken(other); err != nil {
+		t.Errorf("another token of the same user was rejected: %v", err)
+	}
+
+	handler := AuthMiddleware(manager)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "TOKEN_REVOKED") {
+		t.Errorf("middleware = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRevocationsExpire(t *testing.T) {
+	r := NewRevocations()
+	r.Revoke("live", time.Now().Add(time.Hour))
+	r.Merge(map[string]time.Time{"expired": time.Now().Add(-time.Second)})
+
+	if !r.IsRevoked("live") || r.IsRevoked("expired") || r.IsRevoked("unknown") {
+		t.Error("IsRevoked disagrees with the entries' expiry")
+	}
+	r.Prune(time.Now())
+	if r.Len() != 1 {
+		t.Errorf("Len after Prune = %d, want 1", r.Len())
+	}
+}
+
+func TestCustomRolePermissions(t *testing.T) {
+	manager := NewJWTManager("test-secret-key-that-is-long-enough-for-testing", "test-issuer", "test-audience", time.Hour)
+	roles := NewRoleRegistry()
+	roles.Set(1, "stock_clerk", []string{PermAssetsRead, PermAssetsWrite})
+	roles.Set(1, "importer", []string{PermImportsRun})
+	manager.SetRoles(roles)
+
+	token, _ := manager.GenerateToken(1, 1, []string{"stock_clerk"})
+	claims, err := manager.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.Can(PermAssetsWrite) || claims.Can(PermUsersManage) {
+		t.Errorf("stock_clerk permissions resolved wrong")
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		mw   func(http.Handler) http.Handler
+		want int
+	}{
+		{MustRole("org_admin", "project_admin"), http.StatusOK},
+		{MustRole("org_admin"), http.StatusForbidden},
+		{MustPermission(PermAssetsRead, PermAssetsWrite), http.StatusOK},
+		{MustPermission(PermImportsRun), http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/items", nil)
+		r = r.WithContext(context.WithValue(r.Context(), ClaimsKey, claims))
+		w := httptest.NewRecorder()
+		tc.mw(ok).ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("status = %d, want %d", w.Code, tc.want)
+		}
+	}
+
+	// a role of another org grants nothing, and a deleted role stops working
+	other, _ := manager.GenerateToken(1, 2, []string{"stock_clerk"})
+	if c, _ := manager.ValidateToken(other); c.Can(PermAssetsRead) {
+		t.Error("role of org 1 applied to org 2")
+	}
+	roles.Delete(1, "stock_clerk")
+	if c, _ := manager.ValidateToken(token); c.Can(PermAssetsRead) {
+		t.Error("deleted role still grants permissions")
+	}
+}
+
+func TestBuiltinRolesWithoutRegistry(t *testing.T) {
+	claims := &Claims{UserID: 1, OrgID: 1, Roles: []string{"auditor"}}
+	if !claims.Can(PermAuditRead) || claims.Can(PermAssetsWrite) {
+		t.Error("auditor permissions resolved wrong")
+	}
+	if !claims.ActsAs("viewer", "org_admin") || claims.ActsAs("project_admin") {
+		t.Error("ActsAs disagrees with the built-in permissions")
+	}
+}
+
+func TestKeySetSignsAndRotates(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "this-is-a-very-long-secret-key-for-testing-purposes-only"
+	newManager := func(signer crypto.Signer, previous ...crypto.PublicKey) *JWTManager {
+		ks, err := NewKeySet(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pub := range previous {
+			if err := ks.AddPublicKey(pub); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m := NewJWTManager(secret, "era", "era", time.Hour)
+		m.SetKeySet(ks)
+		return m
+	}
+
+	before := newManager(rsaKey)
+	oldToken, err := before.GenerateToken(1, 1, []string{"viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.ValidateToken(oldToken); err != nil {
+		t.Fatalf("Expected RS256 token to validate: %v", err)
+	}
+
+	after := newManager(ecKey, rsaKey.Public())
+	newToken, err := after.GenerateToken(1, 1, []string{"viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"previous key": oldToken, "current key": newToken} {
+		if _, err := after.ValidateToken(token); err != nil {
+			t.Errorf("Expected token signed with the %s to validate: %v", name, err)
+		}
+	}
+	if _, err := before.ValidateToken(newToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey for a key outside the set, got %v", err)
+	}
+	hsToken, err := NewJWTManager(secret, "era", "era", time.Hour).GenerateToken(1, 1, []string{"viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.ValidateToken(hsToken); err == nil {
+		t.Error("Expected HS256 token to be rejected once a key set is configured")
+	}
+
+	jwks := after.JWKS()
+	if len(jwks) != 2 || jwks[0].Alg != "ES256" || jwks[0].Crv != "P-256" || jwks[1].Alg != "RS256" || jwks[1].E != "AQAB" {
+		t.Errorf("JWKS = %+v", jwks)
+	}
+	if jwks[1].Kid != before.JWKS()[0].Kid {
+		t.Error("Expected key IDs to be stable across key sets")
+	}
+	if got := NewJWTManager(secret, "era", "era", time.Hour).JWKS(); len(got) != 0 {
+		t.Errorf("Expected no keys without a key set, got %+v", got)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	current, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentFile := write("current.pem", "EC PRIVATE KEY", der)
+	previous, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(previous.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousFile := write("previous.pem", "PUBLIC KEY", der)
+
+	ks, err := LoadKeySet(currentFile, []string{previousFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwks := ks.JWKS(); len(jwks) != 2 || jwks[0].Kty != "EC" || jwks[1].Kty != "RSA" {
+		t.Errorf("JWKS = %+v", jwks)
+	}
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakFile := write("weak.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(weak))
+	if _, err := LoadKeySet(weakFile, nil); err == nil || !strings.Contains(err.Error(), "2048") {
+		t.Errorf("Expected short RSA key to be refused, got %v", err)
+	}
 }
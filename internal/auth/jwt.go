@@ -11,18 +11,34 @@ import (
 
 // Claims represents the JWT claims structure
 type Claims struct {
-	UserID int64    `json:"sub"`
-	OrgID  int64    `json:"org_id"`
-	Roles  []string `json:"roles"`
+	UserID  int64    `json:"sub"`
+	OrgID   int64    `json:"org_id"`
+	Roles   []string `json:"roles"`
+	SiteIDs []int64  `json:"site_ids,omitempty"` // set on down-scoped tokens only
+	// Exchanged marks tokens minted by GenerateScopedToken, which cannot
+	// start sessions whatever scope they kept
+	Exchanged bool `json:"exchanged,omitempty"`
 	jwt.RegisteredClaims
+
+	// perms are the permissions Roles grant, resolved by ValidateToken
+	perms map[string]bool
+	// apiKeyID is set when an API key, not a token, authenticated the request
+	apiKeyID int64
 }
 
 // JWTManager handles JWT operations
 type JWTManager struct {
-	secret   string
-	issuer   string
-	audience string
-	expiry   time.Duration
+	secret    string
+	issuer    string // issuer used when minting (first configured)
+	audience  string // audience used when minting (first configured)
+	issuers   []string
+	audiences []string
+	expiry    time.Duration
+	leeway    time.Duration
+	keys      *KeySet // nil signs with HS256 and the shared secret
+	revoked   *Revocations
+	roles     *RoleRegistry
+	apiKeys   APIKeyValidator
 }
 
 // JWT validation errors
@@ -34,16 +50,60 @@ var (
 	ErrInvalidClaims        = errors.New("invalid claims")
 	ErrEmptySecret          = errors.New("JWT secret cannot be empty")
 	ErrSecretTooShort       = errors.New("JWT secret must be at least 32 characters")
+	ErrScopeEscalation      = errors.New("requested scope exceeds the presented token")
+	ErrTokenRevoked         = errors.New("token revoked")
 )
 
-// NewJWTManager creates a new JWT manager
+// NewJWTManager creates a new JWT manager. issuer and audience may be
+// comma-separated lists: tokens carrying any of them are accepted, and new
+// tokens are minted with the first entry of each.
 func NewJWTManager(secret, issuer, audience string, expiry time.Duration) *JWTManager {
-	return &JWTManager{
-		secret:   secret,
-		issuer:   issuer,
-		audience: audience,
-		expiry:   expiry,
+	issuers := splitList(issuer)
+	audiences := splitList(audience)
+	j := &JWTManager{
+		secret:    secret,
+		issuers:   issuers,
+		audiences: audiences,
+		expiry:    expiry,
+	}
+	if len(issuers) > 0 {
+		j.issuer = issuers[0]
+	}
+	if len(audiences) > 0 {
+		j.audience = audiences[0]
+	}
+	return j
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
 	}
+	return out
+}
+
+// containsID reports whether ids holds id
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether list holds v
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
 }
 
 // ValidateConfig validates the JWT configuration
@@ -66,6 +126,50 @@ func (j *JWTManager) ValidateConfig() error {
 	return nil
 }
 
+// SetRevocations makes ValidateToken reject tokens whose ID is in r
+func (j *JWTManager) SetRevocations(r *Revocations) {
+	j.revoked = r
+}
+
+// SetLeeway makes ValidateToken accept tokens up to d past their exp or
+// before their nbf, to tolerate clock skew between client and server
+func (j *JWTManager) SetLeeway(d time.Duration) {
+	j.leeway = d
+}
+
+// SetKeySet signs tokens with the current key of ks instead of the shared
+// secret, and accepts only tokens signed by one of its keys
+func (j *JWTManager) SetKeySet(ks *KeySet) {
+	j.keys = ks
+}
+
+// JWKS lists the public keys tokens are verified with; empty when tokens
+// are signed with the shared secret
+func (j *JWTManager) JWKS() []JWK {
+	if j.keys == nil {
+		return []JWK{}
+	}
+	return j.keys.JWKS()
+}
+
+// sign signs claims with the key set, or with HS256 and the shared secret
+func (j *JWTManager) sign(claims jwt.Claims) (string, error) {
+	if j.keys != nil {
+		return j.keys.sign(claims)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.secret))
+}
+
+// SetRoles makes ValidateToken resolve custom role names through g
+func (j *JWTManager) SetRoles(g *RoleRegistry) {
+	j.roles = g
+}
+
+// Expiry is the lifetime of tokens minted by GenerateToken
+func (j *JWTManager) Expiry() time.Duration {
+	return j.expiry
+}
+
 // GenerateToken creates a new JWT token
 func (j *JWTManager) GenerateToken(userID, orgID int64, roles []string) (string, error) {
 	// Validate configuration
@@ -108,11 +212,69 @@ func (j *JWTManager) GenerateToken(userID, orgID int64, roles []string) (string,
 			Issuer:    j.issuer,
 			Audience:  []string{j.audience},
 			Subject:   fmt.Sprintf("%d", userID),
+			ID:        newTokenID(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.secret))
+	return j.sign(claims)
+}
+
+// GenerateScopedToken mints a token for a subset of parent's roles and sites.
+// Empty roles or siteIDs keep the parent's. The token expires after ttl or
+// with the parent token, whichever comes first.
+func (j *JWTManager) GenerateScopedToken(parent *Claims, roles []string, siteIDs []int64, ttl time.Duration) (string, time.Time, error) {
+	if err := j.ValidateConfig(); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid JWT configuration: %w", err)
+	}
+	if ttl <= 0 {
+		return "", time.Time{}, errors.New("ttl must be positive")
+	}
+
+	if len(roles) == 0 {
+		roles = parent.Roles
+	}
+	for _, role := range roles {
+		if !contains(parent.Roles, role) {
+			return "", time.Time{}, fmt.Errorf("%w: role %s", ErrScopeEscalation, role)
+		}
+	}
+	if len(siteIDs) == 0 {
+		siteIDs = parent.SiteIDs
+	} else if len(parent.SiteIDs) > 0 {
+		for _, id := range siteIDs {
+			if !containsID(parent.SiteIDs, id) {
+				return "", time.Time{}, fmt.Errorf("%w: site %d", ErrScopeEscalation, id)
+			}
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	if parent.ExpiresAt != nil && parent.ExpiresAt.Time.Before(expiresAt) {
+		expiresAt = parent.ExpiresAt.Time
+	}
+	claims := &Claims{
+		UserID:    parent.UserID,
+		OrgID:     parent.OrgID,
+		Roles:     roles,
+		SiteIDs:   siteIDs,
+		Exchanged: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    j.issuer,
+			Audience:  []string{j.audience},
+			Subject:   fmt.Sprintf("%d", parent.UserID),
+			ID:        newTokenID(),
+		},
+	}
+
+	token, err := j.sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, claims.ExpiresAt.Time, nil
 }
 
 // ValidateToken validates and parses a JWT token
@@ -124,6 +286,10 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 
 	// Parse token with custom validation
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if j.keys != nil {
+			return j.keys.verificationKey(token)
+		}
+
 		// Validate signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("%w: %v", ErrInvalidSigningMethod, token.Header["alg"])
@@ -135,15 +301,15 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		}
 
 		return []byte(j.secret), nil
-	})
+	}, jwt.WithLeeway(j.leeway))
 
 	if err != nil {
-		// Map JWT errors to our custom errors based on error message
+		// Map JWT errors to our custom errors
 		errStr := err.Error()
-		if strings.Contains(errStr, "expired") {
+		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrTokenExpired
 		}
-		if strings.Contains(errStr, "not valid yet") {
+		if errors.Is(err, jwt.ErrTokenNotValidYet) {
 			return nil, ErrTokenNotValidYet
 		}
 		if strings.Contains(errStr, "malformed") {
@@ -163,6 +329,12 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, fmt.Errorf("claims validation failed: %w", err)
 	}
 
+	// Tokens minted before jti was added carry no ID and cannot be revoked
+	if j.revoked != nil && claims.ID != "" && j.revoked.IsRevoked(claims.ID) {
+		return nil, ErrTokenRevoked
+	}
+
+	claims.perms = j.roles.permissions(claims.OrgID, claims.Roles)
 	return claims, nil
 }
 
@@ -177,13 +349,15 @@ func (j *JWTManager) validateClaims(claims *Claims) error {
 	if len(claims.Roles) == 0 {
 		return errors.New("no roles in claims")
 	}
-	if claims.Issuer != j.issuer {
-		return fmt.Errorf("invalid issuer: expected %s, got %s", j.issuer, claims.Issuer)
+	if !contains(j.issuers, claims.Issuer) {
+		return fmt.Errorf("invalid issuer: expected one of %v, got %s", j.issuers, claims.Issuer)
 	}
-	if len(claims.Audience) == 0 || claims.Audience[0] != j.audience {
-		return fmt.Errorf("invalid audience: expected %s, got %v", j.audience, claims.Audience)
+	for _, aud := range claims.Audience {
+		if contains(j.audiences, aud) {
+			return nil
+		}
 	}
-	return nil
+	return fmt.Errorf("invalid audience: expected one of %v, got %v", j.audiences, claims.Audience)
 }
 
 // HasRole checks if the user has any of the required roles
@@ -202,6 +376,24 @@ func (c *Claims) HasRole(requiredRoles ...string) bool {
 	return false
 }
 
+// ReadOnlyRoles are roles that grant read access only
+var ReadOnlyRoles = map[string]bool{
+	"auditor": true,
+}
+
+// IsReadOnly reports whether every role of the user is read-only
+func (c *Claims) IsReadOnly() bool {
+	if len(c.Roles) == 0 {
+		return false
+	}
+	for _, role := range c.Roles {
+		if !ReadOnlyRoles[role] {
+			return false
+		}
+	}
+	return true
+}
+
 // IsExpiringSoon checks if the token expires within the given duration
 func (c *Claims) IsExpiringSoon(duration time.Duration) bool {
 	if c.ExpiresAt == nil {
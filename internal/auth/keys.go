@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownKey means a token names a key ID the key set does not hold
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// minRSABits is the smallest RSA modulus accepted for RS256
+const minRSABits = 2048
+
+// signingKey is an asymmetric key tokens are signed or verified with. Its
+// ID is the RFC 7638 thumbprint, so it is stable across restarts and
+// instances without being configured.
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// KeySet holds the key new tokens are signed with and the public keys of
+// earlier ones, which are still accepted so tokens signed before a rotation
+// keep working until they expire
+type KeySet struct {
+	signer  crypto.Signer
+	current signingKey
+	keys    map[string]signingKey
+	order   []string
+}
+
+// LoadKeySet reads the PEM private key new tokens are signed with and the
+// PEM keys (public or private) of earlier signing keys. RSA keys sign with
+// RS256 and P-256 keys with ES256.
+func LoadKeySet(privateKeyFile string, previousKeyFiles []string) (*KeySet, error) {
+	data, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", privateKeyFile, err)
+	}
+	ks, err := NewKeySet(signer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", privateKeyFile, err)
+	}
+	for _, file := range previousKeyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := parsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if _, err := ks.add(pub); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return ks, nil
+}
+
+// NewKeySet signs with signer, an *rsa.PrivateKey or a P-256 *ecdsa.PrivateKey
+func NewKeySet(signer crypto.Signer) (*KeySet, error) {
+	ks := &KeySet{signer: signer, keys: map[string]signingKey{}}
+	current, err := ks.add(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	ks.current = current
+	return ks, nil
+}
+
+// AddPublicKey accepts tokens signed by the private half of pub
+func (ks *KeySet) AddPublicKey(pub crypto.PublicKey) error {
+	_, err := ks.add(pub)
+	return err
+}
+
+func (ks *KeySet) add(pub crypto.PublicKey) (signingKey, error) {
+	key := signingKey{public: pub}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return key, fmt.Errorf("RSA keys must have at least %d bits, got %d", minRSABits, k.N.BitLen())
+		}
+		key.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return key, errors.New("EC keys must use the P-256 curve")
+		}
+		key.method = jwt.SigningMethodES256
+	default:
+		return key, fmt.Errorf("unsupported key type %T; use RSA or P-256", pub)
+	}
+	key.id = thumbprint(jwkOf(key))
+	if _, ok := ks.keys[key.id]; !ok {
+		ks.keys[key.id] = key
+		ks.order = append(ks.order, key.id)
+	}
+	return key, nil
+}
+
+// sign signs claims with the current key, naming it in the kid header
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.current.method, claims)
+	token.Header["kid"] = ks.current.id
+	return token.SignedString(ks.signer)
+}
+
+// verificationKey is the public key of the token's kid, provided the token
+// is signed with that key's algorithm
+func (ks *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("%w: key %s signs with %s, got %s", ErrInvalidSigningMethod, kid, key.method.Alg(), token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK is a public key in JSON Web Key form (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS lists the public keys tokens may be signed with, current key first
+func (ks *KeySet) JWKS() []JWK {
+	out := make([]JWK, 0, len(ks.order))
+	for _, id := range ks.order {
+		out = append(out, jwkOf(ks.keys[id]))
+	}
+	return out
+}
+
+func jwkOf(key signingKey) JWK {
+	jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+	switch k := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(k.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty, jwk.Crv = "EC", "P-256"
+		jwk.X = b64(k.X.FillBytes(make([]byte, 32)))
+		jwk.Y = b64(k.Y.FillBytes(make([]byte, 32)))
+	}
+	return jwk
+}
+
+// thumbprint is the RFC 7638 thumbprint of a key: the SHA-256 of its
+// required members, in lexical order and without whitespace
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return b64(sum[:])
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parsePrivateKey reads a PKCS#8, PKCS#1 or SEC 1 PEM private key
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// parsePublicKey reads a PKIX PEM public key, or takes the public half of a
+// private key
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type == "PUBLIC KEY" {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	signer, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Public(), nil
+}
@@ -2,11 +2,12 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
 	"time"
+
+	"era-inventory-api/internal/problem"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
@@ -23,12 +24,6 @@ const (
 	RolesKey contextKey = "roles"
 )
 
-// ErrorResponse represents a standardized error response
-type ErrorResponse struct {
-	Error string `json:"error"`
-	Code  string `json:"code"`
-}
-
 // TokenExpirationWarning represents a token expiration warning
 type TokenExpirationWarning struct {
 	Warning     string    `json:"warning"`
@@ -77,8 +72,14 @@ func RolesFromContext(ctx context.Context) []string {
 
 // Public paths that don't require authentication
 var publicPaths = map[string]bool{
-	"/health": true,
-	"/dbping": true,
+	"/health":  true,
+	"/healthz": true,
+	"/dbping":  true,
+	"/readyz":  true,
+	"/version": true,
+
+	"/.well-known/jwks.json": true,
+	"/status.json":           true,
 }
 
 // isPublicPath checks if the given path is public (no auth required)
@@ -86,17 +87,9 @@ func isPublicPath(path string) bool {
 	return publicPaths[path]
 }
 
-// sendErrorResponse sends a standardized error response
-func sendErrorResponse(w http.ResponseWriter, message, code string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	response := ErrorResponse{
-		Error: message,
-		Code:  code,
-	}
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	}
+// sendErrorResponse sends a standardized problem+json error response
+func sendErrorResponse(w http.ResponseWriter, r *http.Request, message, code string, statusCode int) {
+	problem.Write(w, r, statusCode, code, message)
 }
 
 // sendTokenExpirationWarning adds a warning header when token expires soon
@@ -124,7 +117,8 @@ func validateTokenFormat(tokenString string) error {
 	return nil
 }
 
-// AuthMiddleware validates JWT tokens and sets user context
+// AuthMiddleware validates JWT tokens, or API keys sent as X-API-Key, and
+// sets user context
 func AuthMiddleware(jwtManager *JWTManager) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -134,29 +128,44 @@ func AuthMiddleware(jwtManager *JWTManager) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Automation authenticates with an API key instead of a bearer token
+			if key := r.Header.Get(APIKeyHeader); key != "" && r.Header.Get("Authorization") == "" {
+				claims, err := jwtManager.ValidateAPIKey(r.Context(), key)
+				if errors.Is(err, ErrInvalidAPIKey) {
+					sendErrorResponse(w, r, "API key is invalid, expired or revoked", "INVALID_API_KEY", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					sendErrorResponse(w, r, "API key could not be verified", "API_KEY_CHECK_FAILED", http.StatusInternalServerError)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+				return
+			}
+
 			// Extract Authorization header
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				sendErrorResponse(w, "Authorization header required", "MISSING_AUTH_HEADER", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Authorization header required", "MISSING_AUTH_HEADER", http.StatusUnauthorized)
 				return
 			}
 
 			// Check Bearer token format
 			if !strings.HasPrefix(authHeader, "Bearer ") {
-				sendErrorResponse(w, "Invalid authorization header format. Expected: Bearer <token>", "INVALID_AUTH_FORMAT", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Invalid authorization header format. Expected: Bearer <token>", "INVALID_AUTH_FORMAT", http.StatusUnauthorized)
 				return
 			}
 
 			// Extract token
 			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 			if tokenString == "" {
-				sendErrorResponse(w, "Token is required", "MISSING_TOKEN", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Token is required", "MISSING_TOKEN", http.StatusUnauthorized)
 				return
 			}
 
 			// Validate token format
 			if err := validateTokenFormat(tokenString); err != nil {
-				sendErrorResponse(w, "Invalid token format: "+err.Error(), "INVALID_TOKEN_FORMAT", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Invalid token format: "+err.Error(), "INVALID_TOKEN_FORMAT", http.StatusUnauthorized)
 				return
 			}
 
@@ -167,7 +176,13 @@ func AuthMiddleware(jwtManager *JWTManager) func(http.Handler) http.Handler {
 				var errorCode string
 				var errorMessage string
 				
-				if strings.Contains(err.Error(), "expired") {
+				if errors.Is(err, ErrTokenRevoked) {
+					errorCode = "TOKEN_REVOKED"
+					errorMessage = "Token has been revoked"
+				} else if errors.Is(err, ErrTokenNotValidYet) {
+					errorCode = "TOKEN_NOT_YET_VALID"
+					errorMessage = "Token is not valid yet; check the client clock"
+				} else if strings.Contains(err.Error(), "expired") {
 					errorCode = "TOKEN_EXPIRED"
 					errorMessage = "Token has expired"
 				} else if strings.Contains(err.Error(), "signing method") {
@@ -181,29 +196,26 @@ func AuthMiddleware(jwtManager *JWTManager) func(http.Handler) http.Handler {
 					errorMessage = "Invalid or expired token"
 				}
 				
-				sendErrorResponse(w, errorMessage, errorCode, http.StatusUnauthorized)
+				sendErrorResponse(w, r, errorMessage, errorCode, http.StatusUnauthorized)
 				return
 			}
 
 			// Validate claims
 			if claims.UserID <= 0 {
-				sendErrorResponse(w, "Invalid user ID in token", "INVALID_USER_ID", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Invalid user ID in token", "INVALID_USER_ID", http.StatusUnauthorized)
 				return
 			}
 			if claims.OrgID <= 0 {
-				sendErrorResponse(w, "Invalid organization ID in token", "INVALID_ORG_ID", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Invalid organization ID in token", "INVALID_ORG_ID", http.StatusUnauthorized)
 				return
 			}
 			if len(claims.Roles) == 0 {
-				sendErrorResponse(w, "No roles assigned to user", "NO_ROLES", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "No roles assigned to user", "NO_ROLES", http.StatusUnauthorized)
 				return
 			}
 
 			// Set user context
-			ctx := context.WithValue(r.Context(), ClaimsKey, claims)
-			ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, OrgIDKey, claims.OrgID)
-			ctx = context.WithValue(ctx, RolesKey, claims.Roles)
+			ctx := withClaims(r.Context(), claims)
 
 			// Add token expiration warning header if needed
 			if claims.ExpiresAt != nil {
@@ -215,19 +227,28 @@ func AuthMiddleware(jwtManager *JWTManager) func(http.Handler) http.Handler {
 	}
 }
 
-// MustRole creates middleware that requires specific roles
+// withClaims stores claims and the user, org and roles they name in ctx
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, ClaimsKey, claims)
+	ctx = context.WithValue(ctx, UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, OrgIDKey, claims.OrgID)
+	return context.WithValue(ctx, RolesKey, claims.Roles)
+}
+
+// MustRole creates middleware that requires one of the given roles, or custom
+// roles granting every permission of one of them
 func MustRole(requiredRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			claims := ClaimsFromContext(r.Context())
 			if claims == nil {
-				sendErrorResponse(w, "Authentication required", "AUTHENTICATION_REQUIRED", http.StatusUnauthorized)
+				sendErrorResponse(w, r, "Authentication required", "AUTHENTICATION_REQUIRED", http.StatusUnauthorized)
 				return
 			}
 
 			// Validate required roles
 			if len(requiredRoles) == 0 {
-				sendErrorResponse(w, "No roles specified for this endpoint", "NO_ROLES_SPECIFIED", http.StatusInternalServerError)
+				sendErrorResponse(w, r, "No roles specified for this endpoint", "NO_ROLES_SPECIFIED", http.StatusInternalServerError)
 				return
 			}
 
@@ -239,8 +260,8 @@ func MustRole(requiredRoles ...string) func(http.Handler) http.Handler {
 				}
 			}
 
-			if !claims.HasRole(sanitizedRoles...) {
-				sendErrorResponse(w, "Insufficient permissions", "INSUFFICIENT_PERMISSIONS", http.StatusForbidden)
+			if !claims.HasRole(sanitizedRoles...) && !claims.ActsAs(sanitizedRoles...) {
+				sendErrorResponse(w, r, "Insufficient permissions", "INSUFFICIENT_PERMISSIONS", http.StatusForbidden)
 				return
 			}
 
@@ -248,3 +269,31 @@ func MustRole(requiredRoles ...string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// readOnlyPosts are POST routes that change nothing; they take a body too
+// large for a query string
+var readOnlyPosts = map[string]bool{
+	"/reconcile": true,
+}
+
+// DenyReadOnlyWrites rejects every non-safe request from users whose roles are
+// all read-only (e.g. auditor), regardless of the route's own role checks
+func DenyReadOnlyWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		case http.MethodPost:
+			if readOnlyPosts[r.URL.Path] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if claims := ClaimsFromContext(r.Context()); claims != nil && claims.IsReadOnly() {
+			sendErrorResponse(w, r, "Read-only role cannot modify data", "READ_ONLY_ROLE", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Fine-grained permissions. Routes still name the built-in roles they allow
+// (MustRole); a custom role is let through when its permissions cover those
+// of one of the named roles.
+const (
+	PermAssetsRead  = "assets:read"
+	PermAssetsWrite = "assets:write"
+	PermImportsRun  = "imports:run"
+	PermUsersManage = "users:manage"
+	PermAuditRead   = "audit:read"
+)
+
+// Permissions lists every permission a role may grant
+var Permissions = []string{PermAssetsRead, PermAssetsWrite, PermImportsRun, PermUsersManage, PermAuditRead}
+
+// BuiltinRoles are the fixed roles and the permissions they stand for
+var BuiltinRoles = map[string][]string{
+	"org_admin":     Permissions,
+	"project_admin": {PermAssetsRead, PermAssetsWrite},
+	"viewer":        {PermAssetsRead},
+	"auditor":       {PermAssetsRead, PermAuditRead},
+}
+
+// ValidPermission reports whether p is a known permission
+func ValidPermission(p string) bool {
+	for _, known := range Permissions {
+		if known == p {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleRegistry holds the custom roles of every org, by name, with their
+// permissions. The API keeps it in sync with the roles table.
+type RoleRegistry struct {
+	mu    sync.RWMutex
+	roles map[int64]map[string][]string
+}
+
+// NewRoleRegistry returns an empty registry
+func NewRoleRegistry() *RoleRegistry {
+	return &RoleRegistry{roles: map[int64]map[string][]string{}}
+}
+
+// Replace swaps in the complete set of custom roles, by org and name
+func (g *RoleRegistry) Replace(roles map[int64]map[string][]string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.roles = roles
+}
+
+// Set defines or redefines a custom role of orgID
+func (g *RoleRegistry) Set(orgID int64, name string, perms []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.roles[orgID] == nil {
+		g.roles[orgID] = map[string][]string{}
+	}
+	g.roles[orgID][name] = perms
+}
+
+// Delete removes a custom role of orgID
+func (g *RoleRegistry) Delete(orgID int64, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.roles[orgID], name)
+}
+
+// Lookup returns the permissions of a built-in role or a custom role of orgID
+func (g *RoleRegistry) Lookup(orgID int64, role string) ([]string, bool) {
+	if perms, ok := BuiltinRoles[role]; ok {
+		return perms, true
+	}
+	if g == nil {
+		return nil, false
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	perms, ok := g.roles[orgID][role]
+	return perms, ok
+}
+
+// permissions is the union of the permissions of roles in orgID, built-in or
+// custom. A nil registry knows the built-in roles only.
+func (g *RoleRegistry) permissions(orgID int64, roles []string) map[string]bool {
+	out := map[string]bool{}
+	if g != nil {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+	}
+	for _, role := range roles {
+		perms, ok := BuiltinRoles[role]
+		if !ok && g != nil {
+			perms = g.roles[orgID][role]
+		}
+		for _, p := range perms {
+			out[p] = true
+		}
+	}
+	return out
+}
+
+// Can reports whether the user holds every one of perms
+func (c *Claims) Can(perms ...string) bool {
+	held := c.perms
+	if held == nil {
+		held = (*RoleRegistry)(nil).permissions(c.OrgID, c.Roles)
+	}
+	for _, p := range perms {
+		if !held[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve fills in the permissions of claims that did not come from
+// ValidateToken, such as those a background job acts under. A nil manager
+// knows the built-in roles only.
+func (j *JWTManager) Resolve(c *Claims) *Claims {
+	var roles *RoleRegistry
+	if j != nil {
+		roles = j.roles
+	}
+	c.perms = roles.permissions(c.OrgID, c.Roles)
+	return c
+}
+
+// ActsAs reports whether the user's permissions cover those of one of the
+// built-in roles
+func (c *Claims) ActsAs(roles ...string) bool {
+	for _, role := range roles {
+		if perms, ok := BuiltinRoles[role]; ok && c.Can(perms...) {
+			return true
+		}
+	}
+	return false
+}
+
+// MustPermission creates middleware that requires every one of perms
+func MustPermission(perms ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := ClaimsFromContext(r.Context())
+			if claims == nil {
+				sendErrorResponse(w, r, "Authentication required", "AUTHENTICATION_REQUIRED", http.StatusUnauthorized)
+				return
+			}
+			if !claims.Can(perms...) {
+				sendErrorResponse(w, r, "Insufficient permissions", "INSUFFICIENT_PERMISSIONS", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
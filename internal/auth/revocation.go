@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Revocations is the set of revoked token IDs (jti) a JWTManager rejects. An
+// entry is only kept until the token it revokes would have expired anyway.
+type Revocations struct {
+	mu  sync.RWMutex
+	ids map[string]time.Time // jti -> token expiry
+}
+
+// NewRevocations returns an empty revocation list
+func NewRevocations() *Revocations {
+	return &Revocations{ids: map[string]time.Time{}}
+}
+
+// Revoke rejects the token with ID jti until expiresAt
+func (r *Revocations) Revoke(jti string, expiresAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids[jti] = expiresAt
+}
+
+// Merge adds revocations recorded elsewhere, such as by other instances
+func (r *Revocations) Merge(ids map[string]time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for jti, expiresAt := range ids {
+		r.ids[jti] = expiresAt
+	}
+}
+
+// IsRevoked reports whether the token with ID jti is revoked
+func (r *Revocations) IsRevoked(jti string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	expiresAt, ok := r.ids[jti]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Prune drops entries for tokens that have expired by now
+func (r *Revocations) Prune(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for jti, expiresAt := range r.ids {
+		if !now.Before(expiresAt) {
+			delete(r.ids, jti)
+		}
+	}
+}
+
+// Len is the number of revocations held
+func (r *Revocations) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.ids)
+}
+
+// newTokenID returns a random jti so single tokens can be revoked
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("auth: reading random token ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
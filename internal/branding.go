@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/storage"
+)
+
+const (
+	// maxLogoBytes bounds an uploaded logo
+	maxLogoBytes = 512 << 10
+	// maxDisplayNameLen bounds the branding display name
+	maxDisplayNameLen = 100
+)
+
+// logoTypes are the accepted logo formats, detected from the content. SVG is
+// not accepted: it can carry script and would be served from the API origin.
+var logoTypes = map[string]bool{"image/png": true, "image/jpeg": true}
+
+// branding is the response of GET /org/branding
+type branding struct {
+	DisplayName string     `json:"display_name"`
+	LogoURL     string     `json:"logo_url,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// brandingInput is the body of PUT /org/branding
+type brandingInput struct {
+	DisplayName *string `json:"display_name"`
+}
+
+// orgBranding loads the org's branding; display_name defaults to the org name
+func (s *Server) orgBranding(r *http.Request) (*branding, string, string, error) {
+	var (
+		b           branding
+		logoKey     sql.NullString
+		contentType sql.NullString
+	)
+	err := dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		SELECT COALESCE(display_name, name), logo_key, logo_content_type, branding_updated_at
+		FROM organizations WHERE id = $1`, auth.OrgIDFromContext(r.Context())).
+		Scan(&b.DisplayName, &logoKey, &contentType, &b.UpdatedAt)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if logoKey.Valid {
+		b.LogoURL = "/org/branding/logo"
+	}
+	return &b, logoKey.String, contentType.String, nil
+}
+
+func (s *Server) getBranding(w http.ResponseWriter, r *http.Request) {
+	b, _, _, err := s.orgBranding(r)
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if b.UpdatedAt != nil {
+		setLastModified(w, *b.UpdatedAt)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(b); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// updateBranding sets the display name; an empty name reverts to the org name
+func (s *Server) updateBranding(w http.ResponseWriter, r *http.Request) {
+	var in brandingInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.DisplayName == nil {
+		problem.BadRequest(w, r, "no fields to update")
+		return
+	}
+	name := strings.TrimSpace(*in.DisplayName)
+	if len([]rune(name)) > maxDisplayNameLen {
+		problem.BadRequest(w, r, fmt.Sprintf("display_name must be at most %d characters", maxDisplayNameLen))
+		return
+	}
+
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		UPDATE organizations SET display_name = NULLIF($2, ''), branding_updated_at = NOW()
+		WHERE id = $1`, auth.OrgIDFromContext(r.Context()), name); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getBranding(w, r)
+}
+
+// uploadLogo stores the request body (PNG or JPEG, at most 512KB) as the org logo
+func (s *Server) uploadLogo(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLogoBytes))
+	if err != nil {
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, "LOGO_TOO_LARGE", "logo must be at most 512KB")
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if !logoTypes[contentType] {
+		problem.Write(w, r, http.StatusUnsupportedMediaType, "UNSUPPORTED_LOGO_TYPE", "logo must be a PNG or JPEG image")
+		return
+	}
+
+	orgID := auth.OrgIDFromContext(r.Context())
+	key := fmt.Sprintf("branding/%d/logo", orgID)
+	if _, err := s.Storage.Put(r.Context(), key, bytes.NewReader(data)); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		UPDATE organizations SET logo_key = $2, logo_content_type = $3, branding_updated_at = NOW()
+		WHERE id = $1`, orgID, key, contentType); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getBranding(w, r)
+}
+
+// getLogo serves the org logo with validators so clients can cache it
+func (s *Server) getLogo(w http.ResponseWriter, r *http.Request) {
+	_, key, contentType, err := s.orgBranding(r)
+	if err != nil && err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return
+	}
+	if key == "" {
+		problem.NotFound(w, r)
+		return
+	}
+	obj, err := s.Storage.Open(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer obj.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", storage.ETag(obj))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, "", obj.ModTime(), obj)
+}
+
+// deleteLogo removes the org logo
+func (s *Server) deleteLogo(w http.ResponseWriter, r *http.Request) {
+	_, key, _, err := s.orgBranding(r)
+	if err != nil && err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return
+	}
+	if key == "" {
+		problem.NotFound(w, r)
+		return
+	}
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		UPDATE organizations SET logo_key = NULL, logo_content_type = NULL, branding_updated_at = NOW()
+		WHERE id = $1`, auth.OrgIDFromContext(r.Context())); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err := s.Storage.Delete(r.Context(), key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadLogoRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), http.StatusUnsupportedMediaType},
+		{"text", []byte("not an image"), http.StatusUnsupportedMediaType},
+		{"too large", append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, maxLogoBytes)...), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			(&Server{}).uploadLogo(w, httptest.NewRequest(http.MethodPut, "/org/branding/logo", bytes.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateBrandingValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid JSON", `{`},
+		{"no fields", `{}`},
+		{"name too long", `{"display_name":"` + strings.Repeat("x", maxDisplayNameLen+1) + `"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			(&Server{}).updateBranding(w, httptest.NewRequest(http.MethodPut, "/org/branding", strings.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/version"
+)
+
+// getVersion reports which build is serving the request
+func (s *Server) getVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version.Get()); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// specWithVersion stamps the running build's version into the info block of
+// the OpenAPI spec, replacing the placeholder checked into the repository
+func specWithVersion(spec []byte, v string) []byte {
+	const marker = "\n  version: "
+	infoAt := bytes.Index(spec, []byte("\ninfo:"))
+	if infoAt < 0 {
+		return spec
+	}
+	start := bytes.Index(spec[infoAt:], []byte(marker))
+	if start < 0 {
+		return spec
+	}
+	start += infoAt + len(marker)
+	end := bytes.IndexByte(spec[start:], '\n')
+	if end < 0 {
+		return spec
+	}
+	out := make([]byte, 0, len(spec)+len(v))
+	out = append(out, spec[:start]...)
+	out = append(out, v...)
+	return append(out, spec[start+end:]...)
+}
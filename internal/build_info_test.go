@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/version"
+)
+
+func TestGetVersion(t *testing.T) {
+	old := version.Version
+	version.Version = "v9.9.9"
+	defer func() { version.Version = old }()
+
+	w := httptest.NewRecorder()
+	(&Server{}).getVersion(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var info version.Info
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v9.9.9" {
+		t.Errorf("version = %q, want v9.9.9", info.Version)
+	}
+}
+
+func TestSpecWithVersion(t *testing.T) {
+	spec := "openapi: 3.1.0\ninfo:\n  title: Era Inventory API\n  version: 1.0.0\n  contact:\n    name: Team\npaths:\n  /x:\n    get:\n      parameters:\n        - name: version\n"
+	got := string(specWithVersion([]byte(spec), "v2.0.0-3-gabc"))
+	if !strings.Contains(got, "\n  version: v2.0.0-3-gabc\n  contact:") {
+		t.Errorf("info.version not replaced:\n%s", got)
+	}
+	if strings.Count(got, "v2.0.0-3-gabc") != 1 {
+		t.Errorf("expected exactly one replacement:\n%s", got)
+	}
+
+	if got := string(specWithVersion([]byte("paths: {}\n"), "v1")); got != "paths: {}\n" {
+		t.Errorf("spec without info block changed: %q", got)
+	}
+}
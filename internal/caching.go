@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// conditionalGET buffers successful GET responses, tags them with an ETag of
+// the body and answers If-None-Match / If-Modified-Since with 304 Not Modified.
+// Handlers opt into Last-Modified by calling setLastModified. Downloads,
+// responses with an attachment Content-Disposition, are streamed as written
+// rather than held in memory, and carry no validators.
+func conditionalGET(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &cachingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+
+		if cw.streaming {
+			return
+		}
+		if cw.status != http.StatusOK {
+			w.WriteHeader(cw.status)
+			_, _ = w.Write(cw.buf.Bytes())
+			return
+		}
+
+		h := w.Header()
+		if h.Get("ETag") == "" {
+			sum := sha256.Sum256(cw.buf.Bytes())
+			h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		}
+		if h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", "private, no-cache")
+		}
+
+		if notModified(r, h) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(cw.buf.Bytes())
+	})
+}
+
+// notModified evaluates the request's validators against the response headers.
+// If-None-Match takes precedence over If-Modified-Since (RFC 9110 13.2.2).
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(h.Get("ETag"), "W/")
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(ims)
+}
+
+// setLastModified sets Last-Modified (second precision, as HTTP dates are)
+func setLastModified(w http.ResponseWriter, t time.Time) {
+	w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// cachingWriter holds a response back until its validators are known, or
+// passes it straight through (streaming) when it is a download
+type cachingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	streaming   bool
+	buf         bytes.Buffer
+}
+
+func (cw *cachingWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+	if status == http.StatusOK && isAttachment(cw.Header()) {
+		cw.streaming = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *cachingWriter) Write(b []byte) (int, error) {
+	cw.WriteHeader(http.StatusOK)
+	if cw.streaming {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.buf.Write(b)
+}
+
+// FlushError flushes a streaming response to the client; a buffered one is
+// sent when the handler returns. http.ResponseController calls it.
+func (cw *cachingWriter) FlushError() error {
+	if !cw.streaming {
+		return nil
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *cachingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// isAttachment reports whether h announces a download
+func isAttachment(h http.Header) bool {
+	return strings.HasPrefix(strings.ToLower(h.Get("Content-Disposition")), "attachment")
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConditionalGET(t *testing.T) {
+	updated := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := conditionalGET(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setLastModified(w, updated)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1}`))
+	}))
+
+	// First request: full body plus validators
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/items/1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":1}` {
+		t.Fatalf("Unexpected first response %d %q", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+	if w.Header().Get("Last-Modified") != "Fri, 01 May 2026 12:00:00 GMT" {
+		t.Errorf("Unexpected Last-Modified %q", w.Header().Get("Last-Modified"))
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		want   int
+	}{
+		{"matching etag", "If-None-Match", etag, http.StatusNotModified},
+		{"etag in list", "If-None-Match", `"other", ` + etag, http.StatusNotModified},
+		{"weak comparison", "If-None-Match", "W/" + etag, http.StatusNotModified},
+		{"stale etag", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", "Fri, 01 May 2026 12:00:00 GMT", http.StatusNotModified},
+		{"modified since", "If-Modified-Since", "Thu, 30 Apr 2026 12:00:00 GMT", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/items/1", nil)
+		req.Header.Set(tt.header, tt.value)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+			t.Errorf("%s: 304 must not have a body", tt.name)
+		}
+	}
+}
+
+func TestConditionalGETPassesErrorsAndWrites(t *testing.T) {
+	handler := conditionalGET(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("missing"))
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/items/9", nil)
+	req.Header.Set("If-None-Match", "*")
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || w.Body.String() != "missing" || w.Header().Get("ETag") != "" {
+		t.Errorf("Errors must pass through untouched, got %d %q etag=%q", w.Code, w.Body.String(), w.Header().Get("ETag"))
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/items", nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("POST must not be buffered, got %d", w.Code)
+	}
+}
+
+func TestConditionalGETStreamsDownloads(t *testing.T) {
+	flushed := make(chan struct{})
+	release := make(chan struct{})
+	handler := conditionalGET(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="items.csv"`)
+		_, _ = flushWriter{w}.Write([]byte("id\n1\n"))
+		close(flushed)
+		<-release
+		_, _ = flushWriter{w}.Write([]byte("2\n"))
+	}))
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/items/export", nil))
+		close(done)
+	}()
+	<-flushed
+	if !w.Flushed || w.Body.String() != "id\n1\n" {
+		t.Errorf("before the handler returned: flushed=%v body %q", w.Flushed, w.Body.String())
+	}
+	close(release)
+	<-done
+	if w.Code != http.StatusOK || w.Body.String() != "id\n1\n2\n" || w.Header().Get("ETag") != "" {
+		t.Errorf("Unexpected download %d %q etag=%q", w.Code, w.Body.String(), w.Header().Get("ETag"))
+	}
+}
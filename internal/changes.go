@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// defaultChangesWindow is how far back GET /changes looks without ?since=
+const defaultChangesWindow = 24 * time.Hour
+
+// change is one entry of the activity feed
+type change struct {
+	Type   string    `json:"type"`
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Action string    `json:"action"` // created, updated or deleted
+	At     time.Time `json:"at"`
+}
+
+// listChanges is a lightweight activity feed of the org, newest first, for
+// dashboard panels. Item changes come from the outbox, one entry per event
+// (until delivered events pass OUTBOX_RETENTION); sites, vendors and projects
+// have no events and show their latest change only. ?since= (RFC3339,
+// default 24 hours ago) bounds it and ?type= narrows it to one resource.
+func (s *Server) listChanges(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	ctx := r.Context()
+
+	since := time.Now().Add(-defaultChangesWindow)
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			problem.BadRequest(w, r, "since must be an RFC3339 timestamp")
+			return
+		}
+		since = t
+	}
+
+	types := trashTypes
+	if name := r.URL.Query().Get("type"); name != "" {
+		t, ok := lookupTrashType(name)
+		if !ok {
+			problem.BadRequest(w, r, "type must be one of: item, site, vendor, project")
+			return
+		}
+		types = []trashType{t}
+	}
+
+	args := []interface{}{auth.OrgIDFromContext(ctx), since}
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		if t.table == "inventory" {
+			where := "o.org_id = $1 AND o.created_at > $2 AND o.topic IN ('" +
+				strings.Join([]string{topicItemCreated, topicItemUpdated, topicItemDeleted}, "', '") + "')"
+			if clause, siteArgs := siteAccessClause(ctx, "i", len(args)+1); clause != "" {
+				where += " AND i.id IS NOT NULL AND " + clause
+				args = append(args, siteArgs...)
+			}
+			parts = append(parts, `
+				SELECT 'item' AS type, (o.payload->>'id')::int AS id,
+				       COALESCE(i.name, o.payload->>'name', '') AS name,
+				       split_part(o.topic, '.', 2) AS action, o.created_at AS at, o.id AS seq
+				FROM outbox o
+				LEFT JOIN inventory i ON i.id = (o.payload->>'id')::int AND i.org_id = o.org_id
+				WHERE `+where)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(`
+			SELECT '%s' AS type, id, name,
+			       CASE WHEN deleted_at IS NOT NULL THEN 'deleted'
+			            WHEN updated_at = created_at THEN 'created'
+			            ELSE 'updated' END AS action,
+			       COALESCE(deleted_at, updated_at) AS at, 0::bigint AS seq
+			FROM %s WHERE org_id = $1 AND COALESCE(deleted_at, updated_at) > $2`, t.name, t.table))
+	}
+
+	rows, err := dbFrom(ctx, s.DB).QueryContext(ctx, fmt.Sprintf(`
+		SELECT type, id, name, action, at, COUNT(*) OVER()
+		FROM (%s) changes
+		ORDER BY at DESC, seq DESC, type, id
+		LIMIT %d OFFSET %d`, strings.Join(parts, " UNION ALL "), params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := []interface{}{}
+	var totalCount int
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.Type, &c.ID, &c.Name, &c.Action, &c.At, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		entries = append(entries, c)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	sendListResponse(w, entries, totalCount, params, nil)
+}
@@ -0,0 +1,17 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListChangesValidatesQuery(t *testing.T) {
+	for _, q := range []string{"since=yesterday", "since=2026-10-01", "type=widget"} {
+		w := httptest.NewRecorder()
+		(&Server{}).listChanges(w, httptest.NewRequest(http.MethodGet, "/changes?"+q, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", q, w.Code)
+		}
+	}
+}
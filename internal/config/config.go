@@ -1,84 +1,577 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// PublicPort is the port the public API listens on
+const PublicPort = "8080"
+
 type Config struct {
 	JWTSecret   string
 	JWTIssuer   string
 	JWTAudience string
 	JWTExpiry   time.Duration
+
+	// JWTLeeway is the clock skew tolerated when checking exp and nbf, so
+	// clients with slightly wrong clocks are not turned away
+	JWTLeeway time.Duration
+
+	// JWTPrivateKeyFile is a PEM RSA or P-256 key that signs tokens (RS256
+	// or ES256) instead of JWT_SECRET; JWTPreviousKeyFiles are keys of
+	// earlier rotations, still accepted and published at /.well-known/jwks.json
+	JWTPrivateKeyFile   string
+	JWTPreviousKeyFiles []string
+
+	// RefreshTokenTTL is how long a refresh token stays valid after it is
+	// issued or rotated by POST /auth/refresh. 0 disables refresh tokens.
+	RefreshTokenTTL time.Duration
+	// SessionMaxAge is how long a session may be refreshed after it started,
+	// however often it is. 0 lets sessions be refreshed indefinitely.
+	SessionMaxAge time.Duration
+
+	// RevocationSyncInterval is how often each instance reloads the tokens
+	// revoked by POST /auth/logout on other instances. 0 loads them only at
+	// startup, which suits a single instance.
+	RevocationSyncInterval time.Duration
+
+	// ListScanBudget is the planner row estimate above which list endpoints
+	// skip the exact total count and report an estimate instead. 0 disables it.
+	ListScanBudget int
+
+	// ListDefaultLimit is the page size of list endpoints without ?limit=;
+	// larger limits are capped at ListMaxLimit, or at the ListMaxLimits
+	// entry of the route (e.g. "/items"). 0 keeps the built-in 50 and 200.
+	ListDefaultLimit int
+	ListMaxLimit     int
+	ListMaxLimits    map[string]int
+
+	// DeprecatedRoutes are announced as deprecated, and when they will be
+	// removed, on every response they serve. Entries with Fields deprecate
+	// those fields of the route instead.
+	DeprecatedRoutes []RouteDeprecation
+
+	// ConfigRetention is how many configuration snapshots are kept per item
+	ConfigRetention int
+
+	// TrashRetention is how long soft-deleted records stay restorable before
+	// they are purged. 0 keeps them forever.
+	TrashRetention time.Duration
+
+	// RetentionDays is how many days each class of history (RetentionClasses)
+	// is kept in orgs that did not choose; a class without an entry is kept
+	// forever. RetentionMinDays are the compliance minimums no org can go
+	// below; keeping forever always satisfies them.
+	RetentionDays    map[string]int
+	RetentionMinDays map[string]int
+
+	// ArchiveAfterYears moves retired and disposed items unchanged for this
+	// many years to the archive table. 0 disables archiving.
+	ArchiveAfterYears int
+
+	// MainTenantOrgID is the operator organization whose tokens may act on
+	// other orgs through the X-Org-Context header. 0 disables the header.
+	MainTenantOrgID int64
+
+	// SignupEnabled serves the public POST /signup and the main tenant's
+	// approval queue; it requires MainTenantOrgID. SignupMaxPending caps the
+	// signups awaiting approval, SignupMaxPendingPerClient those from one
+	// client address.
+	SignupEnabled             bool
+	SignupMaxPending          int
+	SignupMaxPendingPerClient int
+
+	// Database connection and pool settings (0 keeps the database/sql default)
+	DBDSN             string
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+
+	// StorageDir is where generated files such as exports are written
+	StorageDir string
+	// ExportRetention is how long the files of finished exports are kept;
+	// the jobs themselves follow the jobs retention class. 0 keeps them.
+	ExportRetention time.Duration
+	// ExportSigningKey signs export download links. Unset, a key derived
+	// from JWTSecret is used, which rotating JWT_SECRET then also changes.
+	ExportSigningKey string
+
+	// Outgoing mail. MailProvider is "smtp", "ses", "sendgrid" or "log";
+	// empty disables mail, and defaults to "smtp" when SMTPHost is set.
+	// MailFrom defaults to SMTPFrom.
+	MailProvider string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SESRegion    string
+	SESAccessKey string
+	SESSecretKey string
+	SendGridKey  string
+
+	// MailPollInterval is how often queued mail is sent; MailMaxAttempts is
+	// how many failed sends make a message a dead letter
+	MailPollInterval time.Duration
+	MailMaxAttempts  int
+
+	// WebhookPollInterval is how often pending webhook deliveries are sent
+	// (0 disables sending); WebhookMaxAttempts is how many failures make a
+	// delivery dead. WebhookAllowPrivate permits endpoints on loopback and
+	// private addresses, which are refused by default.
+	WebhookPollInterval time.Duration
+	WebhookMaxAttempts  int
+	WebhookAllowPrivate bool
+
+	// StatusInterval is how often the components behind GET /status.json
+	// are checked (0 leaves the page unknown). Transitions are posted to
+	// StatusWebhookURL, signed with StatusWebhookSecret when set. The job
+	// and webhook components fail above StatusJobBacklog queued jobs and
+	// StatusWebhookBacklog deliveries awaiting a retry.
+	StatusInterval       time.Duration
+	StatusWebhookURL     string
+	StatusWebhookSecret  string
+	StatusJobBacklog     int
+	StatusWebhookBacklog int
+
+	// CORSAllowedOrigins lists browser origins allowed to call the API.
+	// Empty disables CORS headers; "*" allows any origin.
+	CORSAllowedOrigins []string
+
+	// MaxBodyBytes caps the size of JSON request bodies; larger ones get 413
+	MaxBodyBytes int
+
+	// OutboxPollInterval is how often undelivered change events are
+	// dispatched; 0 disables dispatching (events still accumulate).
+	// OutboxRetention is how long delivered events are kept; 0 keeps them.
+	OutboxPollInterval time.Duration
+	OutboxRetention    time.Duration
+
+	// JobsPerOrg caps the background jobs (exports) of one org running at
+	// once; the rest wait in the queue. 0 removes the cap.
+	JobsPerOrg int
+
+	// ReportsPerOrg caps the /reports requests of one org served at once;
+	// further ones wait up to ReportsQueueTimeout for a slot before getting
+	// 503. 0 removes the cap. Past ReportsQueueMax waiting requests of an
+	// org, further ones get 503 at once; 0 lets any number wait.
+	ReportsPerOrg       int
+	ReportsQueueTimeout time.Duration
+	ReportsQueueMax     int
+
+	// PerfBudgetP95 is the p95 latency each route should stay under, as
+	// reported by /admin/perf-baseline on the admin listener. 0 disables it.
+	PerfBudgetP95 time.Duration
+
+	// AdminAddr is the internal-only listen address for /metrics, /healthz and
+	// /debug/pprof; empty disables the admin listener
+	AdminAddr string
+
+	// Feature flags
+	EnableMetrics bool
+	EnableSwagger bool
+	RLSEnabled    bool
+	TenancyMode   string // "shared" (default) or "schema"
+
+	// EnableTopQueries serves pg_stat_statements to main tenant tokens at
+	// GET /admin/db/top-queries; it requires MainTenantOrgID
+	EnableTopQueries bool
+
+	// Environment is the deployment name; "production" enables stricter checks
+	Environment string
+
+	// loadErrs collects values Load could not parse so Validate reports them
+	// together with every other problem
+	loadErrs []error
 }
 
 // Load loads configuration from environment variables
 func Load() *Config {
 	config := &Config{
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		JWTSecret:   getEnv("JWT_SECRET", defaultJWTSecret),
 		JWTIssuer:   getEnv("JWT_ISS", "era-inventory-api"),
 		JWTAudience: getEnv("JWT_AUD", "era-inventory-api"),
-		JWTExpiry:   24 * time.Hour, // Default to 24 hours
+
+		JWTPrivateKeyFile:   os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		JWTPreviousKeyFiles: splitList(os.Getenv("JWT_PREVIOUS_KEY_FILES")),
+
+		DBDSN:      getEnv("DB_DSN", os.Getenv("DATABASE_URL")),
+		StorageDir: getEnv("STORAGE_DIR", "data"),
+
+		ExportSigningKey: os.Getenv("EXPORT_SIGNING_KEY"),
+
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:     os.Getenv("SMTP_FROM"),
+		SESRegion:    os.Getenv("SES_REGION"),
+		SESAccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SESSecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SendGridKey:  os.Getenv("SENDGRID_API_KEY"),
+
+		CORSAllowedOrigins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS")),
+
+		AdminAddr: getEnv("ADMIN_ADDR", ":9090"),
+
+		TenancyMode: getEnv("TENANCY_MODE", "shared"),
+		Environment: getEnv("ENVIRONMENT", "development"),
 	}
 
-	// Parse JWT expiry from environment if provided
-	if expiryStr := os.Getenv("JWT_EXPIRY"); expiryStr != "" {
-		if expiry, err := time.ParseDuration(expiryStr); err == nil {
-			config.JWTExpiry = expiry
-		}
+	config.JWTExpiry = config.envDuration("JWT_EXPIRY", 24*time.Hour)
+	config.JWTLeeway = config.envDuration("JWT_LEEWAY", 30*time.Second)
+	config.RefreshTokenTTL = config.envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	config.SessionMaxAge = config.envDuration("SESSION_MAX_AGE", 90*24*time.Hour)
+	config.RevocationSyncInterval = config.envDuration("REVOCATION_SYNC_INTERVAL", 30*time.Second)
+	config.ListScanBudget = config.envInt("LIST_SCAN_BUDGET", 100000)
+	config.ListDefaultLimit = config.envInt("LIST_DEFAULT_LIMIT", 50)
+	config.ListMaxLimit = config.envInt("LIST_MAX_LIMIT", 200)
+	config.ListMaxLimits = config.envIntMap("LIST_MAX_LIMITS")
+	config.DeprecatedRoutes = config.envDeprecations("DEPRECATED_ROUTES")
+	config.ConfigRetention = config.envInt("CONFIG_RETENTION", 30)
+	config.TrashRetention = config.envDuration("TRASH_RETENTION", 30*24*time.Hour)
+	config.ExportRetention = config.envDuration("EXPORT_RETENTION", 7*24*time.Hour)
+	config.RetentionDays = config.envIntMap("RETENTION_DAYS")
+	config.RetentionMinDays = config.envIntMap("RETENTION_MIN_DAYS")
+	config.ArchiveAfterYears = config.envInt("ARCHIVE_AFTER_YEARS", 0)
+	config.MainTenantOrgID = int64(config.envInt("MAIN_TENANT_ORG_ID", 0))
+	config.SignupEnabled = config.envBool("SIGNUP_ENABLED")
+	config.SignupMaxPending = config.envInt("SIGNUP_MAX_PENDING", 100)
+	config.SignupMaxPendingPerClient = config.envInt("SIGNUP_MAX_PENDING_PER_CLIENT", 3)
+
+	config.DBMaxOpenConns = config.envInt("DB_MAX_OPEN_CONNS", 25)
+	config.DBMaxIdleConns = config.envInt("DB_MAX_IDLE_CONNS", 5)
+	config.DBConnMaxLifetime = config.envDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+
+	config.SMTPPort = config.envInt("SMTP_PORT", 587)
+	config.MailFrom = getEnv("MAIL_FROM", config.SMTPFrom)
+	config.MailProvider = os.Getenv("MAIL_PROVIDER")
+	if config.MailProvider == "" && config.SMTPHost != "" {
+		config.MailProvider = "smtp"
 	}
+	config.MailPollInterval = config.envDuration("MAIL_POLL_INTERVAL", 5*time.Second)
+	config.MailMaxAttempts = config.envInt("MAIL_MAX_ATTEMPTS", 8)
+
+	config.WebhookPollInterval = config.envDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second)
+	config.WebhookMaxAttempts = config.envInt("WEBHOOK_MAX_ATTEMPTS", 10)
+
+	config.StatusInterval = config.envDuration("STATUS_INTERVAL", 30*time.Second)
+	config.StatusWebhookURL = os.Getenv("STATUS_WEBHOOK_URL")
+	config.StatusWebhookSecret = os.Getenv("STATUS_WEBHOOK_SECRET")
+	config.StatusJobBacklog = config.envInt("STATUS_JOB_BACKLOG", 100)
+	config.StatusWebhookBacklog = config.envInt("STATUS_WEBHOOK_BACKLOG", 50)
+
+	config.MaxBodyBytes = config.envInt("MAX_BODY_BYTES", 1<<20)
+
+	config.OutboxPollInterval = config.envDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	config.OutboxRetention = config.envDuration("OUTBOX_RETENTION", 7*24*time.Hour)
+
+	config.PerfBudgetP95 = config.envDuration("PERF_BUDGET_P95", 500*time.Millisecond)
+
+	config.JobsPerOrg = config.envInt("JOBS_PER_ORG", 1)
+	config.ReportsPerOrg = config.envInt("REPORTS_PER_ORG", 2)
+	config.ReportsQueueTimeout = config.envDuration("REPORTS_QUEUE_TIMEOUT", 30*time.Second)
+	config.ReportsQueueMax = config.envInt("REPORTS_QUEUE_MAX", 10)
+
+	config.EnableMetrics = config.envBool("ENABLE_METRICS")
+	config.EnableSwagger = config.envBool("ENABLE_SWAGGER")
+	config.EnableTopQueries = config.envBool("ENABLE_TOP_QUERIES")
+	config.RLSEnabled = config.envBool("RLS_ENABLED")
+	config.WebhookAllowPrivate = config.envBool("WEBHOOK_ALLOW_PRIVATE")
 
 	return config
 }
 
-// Validate performs comprehensive configuration validation
+// Validate checks every setting and reports all problems at once, joined
+// into a single error, so a misconfigured deployment can be fixed in one go.
 func (c *Config) Validate() error {
-	// Validate JWT configuration
-	if c.JWTSecret == "" {
-		return fmt.Errorf("JWT_SECRET environment variable is required")
+	errs := append([]error(nil), c.loadErrs...)
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
 	}
-	
-	// Check if using default secret in production
-	if c.JWTSecret == "your-secret-key-change-in-production" {
-		if os.Getenv("ENVIRONMENT") == "production" {
-			return fmt.Errorf("JWT_SECRET must be changed from default value in production")
-		}
+
+	// JWT
+	if c.JWTSecret == "" {
+		add("JWT_SECRET environment variable is required")
+	} else if len(c.JWTSecret) < 32 {
+		add("JWT_SECRET must be at least 32 characters long (current: %d)", len(c.JWTSecret))
 	}
-	
-	// Validate JWT secret length
-	if len(c.JWTSecret) < 32 {
-		return fmt.Errorf("JWT_SECRET must be at least 32 characters long (current: %d)", len(c.JWTSecret))
+	if c.JWTSecret == defaultJWTSecret && c.Environment == "production" {
+		add("JWT_SECRET must be changed from default value in production")
 	}
-	
 	if c.JWTIssuer == "" {
-		return fmt.Errorf("JWT_ISS environment variable is required")
+		add("JWT_ISS environment variable is required")
 	}
-	
 	if c.JWTAudience == "" {
-		return fmt.Errorf("JWT_AUD environment variable is required")
+		add("JWT_AUD environment variable is required")
+	}
+	switch {
+	case c.JWTExpiry <= 0:
+		add("JWT_EXPIRY must be positive (current: %v)", c.JWTExpiry)
+	case c.JWTExpiry < time.Minute:
+		add("JWT_EXPIRY too short: %v (minimum: 1m)", c.JWTExpiry)
+	case c.JWTExpiry > 30*24*time.Hour:
+		add("JWT_EXPIRY too long: %v (maximum: 30d)", c.JWTExpiry)
+	}
+	if c.JWTPrivateKeyFile == "" && len(c.JWTPreviousKeyFiles) > 0 {
+		add("JWT_PREVIOUS_KEY_FILES requires JWT_PRIVATE_KEY_FILE")
+	}
+	for _, file := range append([]string{c.JWTPrivateKeyFile}, c.JWTPreviousKeyFiles...) {
+		if _, err := os.Stat(file); file != "" && err != nil {
+			add("JWT key file %q cannot be read: %v", file, err)
+		}
+	}
+	if c.JWTLeeway < 0 || c.JWTLeeway > 5*time.Minute {
+		add("JWT_LEEWAY must be between 0 and 5m (current: %v)", c.JWTLeeway)
+	}
+	if c.RefreshTokenTTL < 0 || c.RefreshTokenTTL > 0 && c.RefreshTokenTTL <= c.JWTExpiry {
+		add("REFRESH_TOKEN_TTL must be 0 or longer than JWT_EXPIRY (current: %v)", c.RefreshTokenTTL)
+	}
+	if c.SessionMaxAge < 0 || c.SessionMaxAge > 0 && c.SessionMaxAge <= c.JWTExpiry {
+		add("SESSION_MAX_AGE must be 0 or longer than JWT_EXPIRY (current: %v)", c.SessionMaxAge)
+	}
+	if c.RevocationSyncInterval < 0 {
+		add("REVOCATION_SYNC_INTERVAL must not be negative (current: %v)", c.RevocationSyncInterval)
+	}
+
+	if c.ListScanBudget < 0 {
+		add("LIST_SCAN_BUDGET must not be negative (current: %d)", c.ListScanBudget)
 	}
-	
-	if c.JWTExpiry <= 0 {
-		return fmt.Errorf("JWT_EXPIRY must be positive (current: %v)", c.JWTExpiry)
+	if c.ListMaxLimit < 0 {
+		add("LIST_MAX_LIMIT must not be negative (current: %d)", c.ListMaxLimit)
 	}
-	
-	// Validate reasonable expiry limits
-	if c.JWTExpiry < time.Minute {
-		return fmt.Errorf("JWT_EXPIRY too short: %v (minimum: 1m)", c.JWTExpiry)
+	if c.ListDefaultLimit < 0 || (c.ListMaxLimit > 0 && c.ListDefaultLimit > c.ListMaxLimit) {
+		add("LIST_DEFAULT_LIMIT must be between 1 and LIST_MAX_LIMIT (current: %d)", c.ListDefaultLimit)
 	}
-	if c.JWTExpiry > 30*24*time.Hour {
-		return fmt.Errorf("JWT_EXPIRY too long: %v (maximum: 30d)", c.JWTExpiry)
+	for route, max := range c.ListMaxLimits {
+		if !strings.HasPrefix(route, "/") || max < 1 {
+			add("LIST_MAX_LIMITS entries must look like /route=N with N at least 1 (current: %s=%d)", route, max)
+		}
+	}
+	for _, d := range c.DeprecatedRoutes {
+		switch {
+		case !validMethod(d.Method) || !strings.HasPrefix(d.Route, "/"):
+			add("DEPRECATED_ROUTES entries must start with a method and a /route (current: %s %s)", d.Method, d.Route)
+		case d.Since.IsZero():
+			add("DEPRECATED_ROUTES entry %s %s needs since=YYYY-MM-DD", d.Method, d.Route)
+		case !d.Sunset.IsZero() && !d.Sunset.After(d.Since):
+			add("DEPRECATED_ROUTES entry %s %s must have its sunset after since", d.Method, d.Route)
+		}
+	}
+	if c.ConfigRetention < 0 {
+		add("CONFIG_RETENTION must not be negative (current: %d)", c.ConfigRetention)
+	}
+	if c.TrashRetention < 0 {
+		add("TRASH_RETENTION must not be negative (current: %v)", c.TrashRetention)
+	}
+	for _, env := range []struct {
+		key  string
+		days map[string]int
+	}{{"RETENTION_DAYS", c.RetentionDays}, {"RETENTION_MIN_DAYS", c.RetentionMinDays}} {
+		for class, days := range env.days {
+			if !ValidRetentionClass(class) || days < 0 {
+				add("%s entries must look like class=N with a class among %s and N not negative (current: %s=%d)",
+					env.key, strings.Join(RetentionClasses, ", "), class, days)
+			}
+		}
+	}
+	for class, days := range c.RetentionDays {
+		if minDays := c.RetentionMinDays[class]; days > 0 && days < minDays {
+			add("RETENTION_DAYS for %s must not be below its RETENTION_MIN_DAYS of %d (current: %d)", class, minDays, days)
+		}
+	}
+	if c.ArchiveAfterYears < 0 {
+		add("ARCHIVE_AFTER_YEARS must not be negative (current: %d)", c.ArchiveAfterYears)
+	}
+	if c.MainTenantOrgID < 0 {
+		add("MAIN_TENANT_ORG_ID must not be negative (current: %d)", c.MainTenantOrgID)
+	}
+	if c.JobsPerOrg < 0 {
+		add("JOBS_PER_ORG must not be negative (current: %d)", c.JobsPerOrg)
+	}
+	if c.ReportsPerOrg < 0 {
+		add("REPORTS_PER_ORG must not be negative (current: %d)", c.ReportsPerOrg)
+	}
+	if c.ReportsPerOrg > 0 && c.ReportsQueueTimeout <= 0 {
+		add("REPORTS_QUEUE_TIMEOUT must be positive when REPORTS_PER_ORG is set (current: %v)", c.ReportsQueueTimeout)
+	}
+	if c.ReportsQueueMax < 0 {
+		add("REPORTS_QUEUE_MAX must not be negative (current: %d)", c.ReportsQueueMax)
+	}
+	if c.EnableTopQueries && c.MainTenantOrgID <= 0 {
+		add("ENABLE_TOP_QUERIES requires MAIN_TENANT_ORG_ID")
+	}
+	if c.SignupEnabled && c.MainTenantOrgID <= 0 {
+		add("SIGNUP_ENABLED requires MAIN_TENANT_ORG_ID")
+	}
+	if c.SignupEnabled && c.SignupMaxPending <= 0 {
+		add("SIGNUP_MAX_PENDING must be positive (current: %d)", c.SignupMaxPending)
+	}
+	if c.SignupEnabled && c.SignupMaxPendingPerClient <= 0 {
+		add("SIGNUP_MAX_PENDING_PER_CLIENT must be positive (current: %d)", c.SignupMaxPendingPerClient)
+	}
+
+	// Database
+	if c.DBDSN == "" {
+		add("DB_DSN environment variable is required")
 	}
-	
-	return nil
+	if c.DBMaxOpenConns < 0 {
+		add("DB_MAX_OPEN_CONNS must not be negative (current: %d)", c.DBMaxOpenConns)
+	}
+	if c.DBMaxIdleConns < 0 {
+		add("DB_MAX_IDLE_CONNS must not be negative (current: %d)", c.DBMaxIdleConns)
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		add("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", c.DBMaxIdleConns, c.DBMaxOpenConns)
+	}
+	if c.DBConnMaxLifetime < 0 {
+		add("DB_CONN_MAX_LIFETIME must not be negative (current: %v)", c.DBConnMaxLifetime)
+	}
+
+	// Storage
+	if c.StorageDir == "" {
+		add("STORAGE_DIR must not be empty")
+	} else if fi, err := os.Stat(c.StorageDir); err == nil && !fi.IsDir() {
+		add("STORAGE_DIR %q is not a directory", c.StorageDir)
+	}
+	if c.ExportRetention < 0 {
+		add("EXPORT_RETENTION must not be negative (current: %v)", c.ExportRetention)
+	}
+	if c.ExportSigningKey != "" && len(c.ExportSigningKey) < 32 {
+		add("EXPORT_SIGNING_KEY must be at least 32 characters long (current: %d)", len(c.ExportSigningKey))
+	}
+
+	// Mail is optional, but once a provider is chosen it must be usable
+	from := c.Sender()
+	if c.SMTPHost != "" {
+		if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+			add("SMTP_PORT must be between 1 and 65535 (current: %d)", c.SMTPPort)
+		}
+		if from == "" {
+			add("SMTP_FROM (or MAIL_FROM) is required when SMTP_HOST is set")
+		}
+		if c.SMTPUsername != "" && c.SMTPPassword == "" {
+			add("SMTP_PASSWORD is required when SMTP_USERNAME is set")
+		}
+	}
+	switch c.MailProvider {
+	case "", "log":
+	case "smtp":
+		if c.SMTPHost == "" {
+			add("SMTP_HOST is required when MAIL_PROVIDER is smtp")
+		}
+	case "ses":
+		if c.SESRegion == "" || c.SESAccessKey == "" || c.SESSecretKey == "" {
+			add("SES_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when MAIL_PROVIDER is ses")
+		}
+		if from == "" {
+			add("MAIL_FROM is required when MAIL_PROVIDER is ses")
+		}
+	case "sendgrid":
+		if c.SendGridKey == "" {
+			add("SENDGRID_API_KEY is required when MAIL_PROVIDER is sendgrid")
+		}
+		if from == "" {
+			add("MAIL_FROM is required when MAIL_PROVIDER is sendgrid")
+		}
+	default:
+		add("MAIL_PROVIDER must be smtp, ses, sendgrid or log (current: %q)", c.MailProvider)
+	}
+	if from != "" {
+		if _, err := mail.ParseAddress(from); err != nil {
+			add("MAIL_FROM %q is not a valid address", from)
+		}
+	}
+	if c.MailPollInterval < 0 {
+		add("MAIL_POLL_INTERVAL must not be negative (current: %v)", c.MailPollInterval)
+	}
+	if c.MailMaxAttempts < 1 && c.MailProvider != "" {
+		add("MAIL_MAX_ATTEMPTS must be at least 1 (current: %d)", c.MailMaxAttempts)
+	}
+	if c.WebhookPollInterval < 0 {
+		add("WEBHOOK_POLL_INTERVAL must not be negative (current: %v)", c.WebhookPollInterval)
+	}
+	if c.WebhookMaxAttempts < 1 && c.WebhookPollInterval > 0 {
+		add("WEBHOOK_MAX_ATTEMPTS must be at least 1 (current: %d)", c.WebhookMaxAttempts)
+	}
+	if c.StatusInterval < 0 {
+		add("STATUS_INTERVAL must not be negative (current: %v)", c.StatusInterval)
+	}
+	if c.StatusWebhookURL != "" {
+		if u, err := url.Parse(c.StatusWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("STATUS_WEBHOOK_URL must be an http(s) URL (current: %q)", c.StatusWebhookURL)
+		}
+	}
+	if (c.StatusJobBacklog < 1 || c.StatusWebhookBacklog < 1) && c.StatusInterval > 0 {
+		add("STATUS_JOB_BACKLOG and STATUS_WEBHOOK_BACKLOG must be at least 1 (current: %d, %d)", c.StatusJobBacklog, c.StatusWebhookBacklog)
+	}
+
+	// CORS
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			add("CORS_ALLOWED_ORIGINS entry %q must be \"*\" or an http(s) origin such as https://app.example.com", origin)
+		}
+	}
+
+	if c.MaxBodyBytes < 0 {
+		add("MAX_BODY_BYTES must not be negative (current: %d)", c.MaxBodyBytes)
+	}
+	if c.OutboxPollInterval < 0 {
+		add("OUTBOX_POLL_INTERVAL must not be negative (current: %v)", c.OutboxPollInterval)
+	}
+	if c.OutboxRetention < 0 {
+		add("OUTBOX_RETENTION must not be negative (current: %v)", c.OutboxRetention)
+	}
+
+	// Admin listener
+	if c.PerfBudgetP95 < 0 {
+		add("PERF_BUDGET_P95 must not be negative (current: %v)", c.PerfBudgetP95)
+	}
+	if c.AdminAddr != "" {
+		if _, port, err := net.SplitHostPort(c.AdminAddr); err != nil || port == "" {
+			add("ADMIN_ADDR must be host:port or :port (current: %q)", c.AdminAddr)
+		} else if port == PublicPort {
+			add("ADMIN_ADDR must not use the public port %s", PublicPort)
+		}
+	}
+
+	// Feature flags
+	switch c.TenancyMode {
+	case "", "shared", "schema":
+	default:
+		add("TENANCY_MODE must be \"shared\" or \"schema\" (current: %q)", c.TenancyMode)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Sender is the From address of outgoing mail: MAIL_FROM, else SMTP_FROM
+func (c *Config) Sender() string {
+	if c.MailFrom != "" {
+		return c.MailFrom
+	}
+	return c.SMTPFrom
 }
 
 // LoadAndValidate loads and validates configuration
 func LoadAndValidate() (*Config, error) {
 	config := Load()
 	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("configuration validation failed: %w", err)
+		return nil, fmt.Errorf("configuration validation failed:\n%w", err)
 	}
 	return config, nil
 }
@@ -89,3 +582,163 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// envInt parses an integer variable, recording a problem if it is malformed
+func (c *Config) envInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		c.loadErrs = append(c.loadErrs, fmt.Errorf("%s must be an integer (current: %q)", key, value))
+		return defaultValue
+	}
+	return n
+}
+
+// envDuration parses a duration variable such as "30m", recording a problem if it is malformed
+func (c *Config) envDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		c.loadErrs = append(c.loadErrs, fmt.Errorf("%s must be a duration such as 30m or 24h (current: %q)", key, value))
+		return defaultValue
+	}
+	return d
+}
+
+// envBool reads a feature flag. Only "true" and "false" are accepted, matching
+// the components that read the same variables directly.
+func (c *Config) envBool(key string) bool {
+	switch value := os.Getenv(key); value {
+	case "", "false":
+		return false
+	case "true":
+		return true
+	default:
+		c.loadErrs = append(c.loadErrs, fmt.Errorf("%s must be \"true\" or \"false\" (current: %q)", key, value))
+		return false
+	}
+}
+
+// envIntMap parses "key=N,key=N" pairs, recording a problem for malformed ones
+func (c *Config) envIntMap(key string) map[string]int {
+	out := map[string]int{}
+	for _, pair := range splitList(os.Getenv(key)) {
+		k, v, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if !ok || err != nil {
+			c.loadErrs = append(c.loadErrs, fmt.Errorf("%s entries must look like key=N (current: %q)", key, pair))
+			continue
+		}
+		out[strings.TrimSpace(k)] = n
+	}
+	return out
+}
+
+// RouteDeprecation announces that a route is deprecated: since when, when it
+// will be removed (zero if undecided), where the deprecation is documented
+// and what replaces it. Route is the route pattern, e.g. /items/{id}. With
+// Fields, only those top-level fields of the route's request and response
+// bodies are deprecated, and Successor names the field replacing them.
+type RouteDeprecation struct {
+	Method    string
+	Route     string
+	Since     time.Time
+	Sunset    time.Time
+	Link      string
+	Successor string
+	Fields    []string
+}
+
+// envDeprecations parses comma-separated entries like
+// "GET /routers since=2026-10-01 sunset=2027-04-01 successor=/items?device_type=router",
+// where sunset, link and successor are optional; fields=site|notes
+// deprecates those fields of the route
+func (c *Config) envDeprecations(key string) []RouteDeprecation {
+	var out []RouteDeprecation
+	for _, entry := range splitList(os.Getenv(key)) {
+		fields := strings.Fields(entry)
+		if len(fields) < 2 {
+			c.loadErrs = append(c.loadErrs, fmt.Errorf("%s entries must look like METHOD /route since=YYYY-MM-DD (current: %q)", key, entry))
+			continue
+		}
+		d := RouteDeprecation{Method: strings.ToUpper(fields[0]), Route: fields[1]}
+		for _, f := range fields[2:] {
+			k, v, _ := strings.Cut(f, "=")
+			var err error
+			switch k {
+			case "since":
+				d.Since, err = time.Parse(time.DateOnly, v)
+			case "sunset":
+				d.Sunset, err = time.Parse(time.DateOnly, v)
+			case "link":
+				d.Link = v
+			case "successor":
+				d.Successor = v
+			case "fields":
+				d.Fields = strings.Split(v, "|")
+				for _, field := range d.Fields {
+					if field == "" {
+						err = fmt.Errorf("fields has an empty name")
+					}
+				}
+			default:
+				err = fmt.Errorf("unknown field %q", k)
+			}
+			if err == nil && v == "" {
+				err = fmt.Errorf("%s is empty", k)
+			}
+			if err != nil {
+				c.loadErrs = append(c.loadErrs, fmt.Errorf("%s entry %q: %v", key, entry, err))
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// validMethod reports whether m is an HTTP method routes are declared for
+func validMethod(m string) bool {
+	switch m {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+// splitList splits a comma-separated variable, dropping empty entries
+func splitList(value string) []string {
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// Classes of history whose retention orgs choose
+const (
+	RetentionAudit         = "audit"
+	RetentionJobs          = "jobs"
+	RetentionNotifications = "notifications"
+	RetentionSnapshots     = "snapshots"
+)
+
+// RetentionClasses lists the retention classes in display order
+var RetentionClasses = []string{RetentionAudit, RetentionJobs, RetentionNotifications, RetentionSnapshots}
+
+// ValidRetentionClass reports whether class is one of RetentionClasses
+func ValidRetentionClass(class string) bool {
+	for _, known := range RetentionClasses {
+		if known == class {
+			return true
+		}
+	}
+	return false
+}
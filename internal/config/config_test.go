@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -73,6 +75,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: false,
 		},
@@ -83,6 +87,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -93,6 +99,21 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
+			},
+			expectError: true,
+		},
+		{
+			name: "export signing key too short",
+			config: &Config{
+				JWTSecret:        "valid-secret-that-is-long-enough-for-testing",
+				JWTIssuer:        "test-issuer",
+				JWTAudience:      "test-audience",
+				JWTExpiry:        time.Hour,
+				DBDSN:            "postgres://localhost/era_test",
+				StorageDir:       "data",
+				ExportSigningKey: "short",
 			},
 			expectError: true,
 		},
@@ -103,6 +124,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "",
 				JWTAudience: "test-audience",
 				JWTExpiry:   time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -113,6 +136,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "",
 				JWTExpiry:   time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -123,6 +148,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   -time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -133,6 +160,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   0,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -143,6 +172,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   30 * time.Second,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -153,6 +184,8 @@ func TestValidate(t *testing.T) {
 				JWTIssuer:   "test-issuer",
 				JWTAudience: "test-audience",
 				JWTExpiry:   31 * 24 * time.Hour,
+				DBDSN:       "postgres://localhost/era_test",
+				StorageDir:  "data",
 			},
 			expectError: true,
 		},
@@ -174,6 +207,8 @@ func TestLoadAndValidate(t *testing.T) {
 	os.Setenv("JWT_ISS", "test-issuer")
 	os.Setenv("JWT_AUD", "test-audience")
 	os.Setenv("JWT_EXPIRY", "1h")
+	os.Setenv("DB_DSN", "postgres://localhost/era_test")
+	defer os.Unsetenv("DB_DSN")
 
 	cfg, err := LoadAndValidate()
 	if err != nil {
@@ -202,6 +237,8 @@ func TestProductionSecretValidation(t *testing.T) {
 	// Test production environment validation
 	os.Setenv("ENVIRONMENT", "production")
 	os.Setenv("JWT_SECRET", "your-secret-key-change-in-production")
+	os.Setenv("DB_DSN", "postgres://localhost/era_test")
+	defer os.Unsetenv("DB_DSN")
 
 	cfg := Load()
 	err := cfg.Validate()
@@ -222,3 +259,290 @@ func TestProductionSecretValidation(t *testing.T) {
 	os.Unsetenv("ENVIRONMENT")
 	os.Unsetenv("JWT_SECRET")
 }
+
+func TestLoadListScanBudget(t *testing.T) {
+	os.Unsetenv("LIST_SCAN_BUDGET")
+	if cfg := Load(); cfg.ListScanBudget != 100000 {
+		t.Errorf("Expected default LIST_SCAN_BUDGET 100000, got %d", cfg.ListScanBudget)
+	}
+
+	os.Setenv("LIST_SCAN_BUDGET", "0")
+	defer os.Unsetenv("LIST_SCAN_BUDGET")
+	if cfg := Load(); cfg.ListScanBudget != 0 {
+		t.Errorf("Expected LIST_SCAN_BUDGET 0 from env, got %d", cfg.ListScanBudget)
+	}
+
+	cfg := &Config{
+		JWTSecret:      "valid-secret-that-is-long-enough-for-testing",
+		JWTIssuer:      "test-issuer",
+		JWTAudience:    "test-audience",
+		JWTExpiry:      time.Hour,
+		DBDSN:          "postgres://localhost/era_test",
+		StorageDir:     "data",
+		ListScanBudget: -1,
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative LIST_SCAN_BUDGET")
+	}
+}
+
+func TestLoadJWTLeeway(t *testing.T) {
+	os.Unsetenv("JWT_LEEWAY")
+	if cfg := Load(); cfg.JWTLeeway != 30*time.Second {
+		t.Errorf("Expected default JWT_LEEWAY 30s, got %v", cfg.JWTLeeway)
+	}
+
+	os.Setenv("JWT_LEEWAY", "10m")
+	defer os.Unsetenv("JWT_LEEWAY")
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "JWT_LEEWAY") {
+		t.Errorf("Expected JWT_LEEWAY error, got %v", err)
+	}
+}
+
+func TestLoadListLimits(t *testing.T) {
+	os.Setenv("LIST_MAX_LIMIT", "300")
+	os.Setenv("LIST_MAX_LIMITS", "/items=500, /changes=100")
+	defer os.Unsetenv("LIST_MAX_LIMIT")
+	defer os.Unsetenv("LIST_MAX_LIMITS")
+	cfg := Load()
+	if cfg.ListDefaultLimit != 50 || cfg.ListMaxLimit != 300 {
+		t.Errorf("Expected limits 50/300, got %d/%d", cfg.ListDefaultLimit, cfg.ListMaxLimit)
+	}
+	if cfg.ListMaxLimits["/items"] != 500 || cfg.ListMaxLimits["/changes"] != 100 {
+		t.Errorf("Expected route caps from LIST_MAX_LIMITS, got %v", cfg.ListMaxLimits)
+	}
+
+	os.Setenv("LIST_DEFAULT_LIMIT", "400")
+	os.Setenv("LIST_MAX_LIMITS", "items")
+	defer os.Unsetenv("LIST_DEFAULT_LIMIT")
+	err := Load().Validate()
+	if err == nil || !strings.Contains(err.Error(), "LIST_DEFAULT_LIMIT") || !strings.Contains(err.Error(), "LIST_MAX_LIMITS") {
+		t.Errorf("Expected LIST_DEFAULT_LIMIT and LIST_MAX_LIMITS errors, got %v", err)
+	}
+}
+
+func TestLoadRetention(t *testing.T) {
+	os.Setenv("RETENTION_DAYS", "audit=365, notifications=30")
+	os.Setenv("RETENTION_MIN_DAYS", "audit=180")
+	defer os.Unsetenv("RETENTION_DAYS")
+	defer os.Unsetenv("RETENTION_MIN_DAYS")
+	cfg := Load()
+	if cfg.RetentionDays[RetentionAudit] != 365 || cfg.RetentionDays[RetentionNotifications] != 30 || cfg.RetentionMinDays[RetentionAudit] != 180 {
+		t.Errorf("Unexpected retention %v, minimums %v", cfg.RetentionDays, cfg.RetentionMinDays)
+	}
+
+	os.Setenv("RETENTION_DAYS", "audit=90, logs=30")
+	err := Load().Validate()
+	if err == nil || !strings.Contains(err.Error(), "below its RETENTION_MIN_DAYS") || !strings.Contains(err.Error(), "logs=30") {
+		t.Errorf("Expected minimum and unknown class errors, got %v", err)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	cfg := &Config{
+		JWTSecret:          "",
+		JWTIssuer:          "test-issuer",
+		JWTAudience:        "test-audience",
+		JWTExpiry:          time.Hour,
+		DBDSN:              "",
+		DBMaxOpenConns:     5,
+		DBMaxIdleConns:     10,
+		StorageDir:         "data",
+		SMTPHost:           "smtp.example.com",
+		SMTPPort:           587,
+		CORSAllowedOrigins: []string{"https://app.example.com", "app.example.com"},
+		TenancyMode:        "per-org",
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+	for _, want := range []string{
+		"JWT_SECRET",
+		"DB_DSN",
+		"DB_MAX_IDLE_CONNS",
+		"SMTP_FROM",
+		`"app.example.com"`,
+		"TENANCY_MODE",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), `"https://app.example.com"`) {
+		t.Errorf("Valid CORS origin reported as a problem:\n%v", err)
+	}
+}
+
+func TestLoadReportsMalformedValues(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test-secret-key-that-is-long-enough-for-testing")
+	os.Setenv("DB_DSN", "postgres://localhost/era_test")
+	os.Setenv("JWT_EXPIRY", "soon")
+	os.Setenv("DB_MAX_OPEN_CONNS", "many")
+	os.Setenv("ENABLE_METRICS", "yes")
+	defer func() {
+		for _, key := range []string{"JWT_SECRET", "DB_DSN", "JWT_EXPIRY", "DB_MAX_OPEN_CONNS", "ENABLE_METRICS"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	_, err := LoadAndValidate()
+	if err == nil {
+		t.Fatal("Expected LoadAndValidate to fail on malformed values")
+	}
+	for _, want := range []string{"JWT_EXPIRY", "DB_MAX_OPEN_CONNS", "ENABLE_METRICS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateAdminAddr(t *testing.T) {
+	tests := []struct {
+		addr        string
+		expectError bool
+	}{
+		{"", false},
+		{":9090", false},
+		{"127.0.0.1:9090", false},
+		{"9090", true},
+		{":" + PublicPort, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{
+			JWTSecret:   "valid-secret-that-is-long-enough-for-testing",
+			JWTIssuer:   "test-issuer",
+			JWTAudience: "test-audience",
+			JWTExpiry:   time.Hour,
+			DBDSN:       "postgres://localhost/era_test",
+			StorageDir:  "data",
+			AdminAddr:   tt.addr,
+		}
+		if err := cfg.Validate(); (err != nil) != tt.expectError {
+			t.Errorf("ADMIN_ADDR %q: Validate() error = %v, expectError %v", tt.addr, err, tt.expectError)
+		}
+	}
+}
+
+func TestValidateMailProvider(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(c *Config)
+		expectError bool
+	}{
+		{"disabled", func(c *Config) {}, false},
+		{"log", func(c *Config) { c.MailProvider = "log" }, false},
+		{"smtp", func(c *Config) {
+			c.MailProvider, c.SMTPHost, c.SMTPPort, c.SMTPFrom = "smtp", "smtp.example.com", 587, "ops@example.com"
+		}, false},
+		{"smtp without host", func(c *Config) { c.MailProvider, c.MailFrom = "smtp", "ops@example.com" }, true},
+		{"ses", func(c *Config) {
+			c.MailProvider, c.MailFrom, c.SESRegion, c.SESAccessKey, c.SESSecretKey = "ses", "ops@example.com", "eu-west-1", "AKID", "secret"
+		}, false},
+		{"ses without credentials", func(c *Config) { c.MailProvider, c.MailFrom, c.SESRegion = "ses", "ops@example.com", "eu-west-1" }, true},
+		{"sendgrid", func(c *Config) { c.MailProvider, c.MailFrom, c.SendGridKey = "sendgrid", "ops@example.com", "SG.key" }, false},
+		{"sendgrid without sender", func(c *Config) { c.MailProvider, c.SendGridKey = "sendgrid", "SG.key" }, true},
+		{"bad sender", func(c *Config) { c.MailProvider, c.MailFrom = "log", "not an address" }, true},
+		{"unknown provider", func(c *Config) { c.MailProvider = "pigeon" }, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{
+			JWTSecret:       "valid-secret-that-is-long-enough-for-testing",
+			JWTIssuer:       "test-issuer",
+			JWTAudience:     "test-audience",
+			JWTExpiry:       time.Hour,
+			DBDSN:           "postgres://localhost/era_test",
+			StorageDir:      "data",
+			MailMaxAttempts: 8,
+		}
+		tt.mutate(cfg)
+		if err := cfg.Validate(); (err != nil) != tt.expectError {
+			t.Errorf("%s: Validate() error = %v, expectError %v", tt.name, err, tt.expectError)
+		}
+	}
+}
+
+func TestValidateTopQueriesNeedsMainTenant(t *testing.T) {
+	for _, mainTenant := range []int64{0, 1} {
+		cfg := &Config{
+			JWTSecret:        "valid-secret-that-is-long-enough-for-testing",
+			JWTIssuer:        "test-issuer",
+			JWTAudience:      "test-audience",
+			JWTExpiry:        time.Hour,
+			DBDSN:            "postgres://localhost/era_test",
+			StorageDir:       "data",
+			EnableTopQueries: true,
+			MainTenantOrgID:  mainTenant,
+		}
+		if err := cfg.Validate(); (err != nil) != (mainTenant == 0) {
+			t.Errorf("MAIN_TENANT_ORG_ID %d: Validate() error = %v", mainTenant, err)
+		}
+	}
+}
+
+func TestValidateSignup(t *testing.T) {
+	for _, tt := range []struct {
+		mainTenant int64
+		maxPending int
+		perClient  int
+		wantErr    bool
+	}{
+		{0, 100, 3, true},
+		{1, 0, 3, true},
+		{1, 100, 0, true},
+		{1, 100, 3, false},
+	} {
+		cfg := &Config{
+			JWTSecret:                 "valid-secret-that-is-long-enough-for-testing",
+			JWTIssuer:                 "test-issuer",
+			JWTAudience:               "test-audience",
+			JWTExpiry:                 time.Hour,
+			DBDSN:                     "postgres://localhost/era_test",
+			StorageDir:                "data",
+			SignupEnabled:             true,
+			SignupMaxPending:          tt.maxPending,
+			SignupMaxPendingPerClient: tt.perClient,
+			MainTenantOrgID:           tt.mainTenant,
+		}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("MAIN_TENANT_ORG_ID %d, SIGNUP_MAX_PENDING %d, SIGNUP_MAX_PENDING_PER_CLIENT %d: Validate() error = %v",
+				tt.mainTenant, tt.maxPending, tt.perClient, err)
+		}
+	}
+}
+
+func TestDeprecatedRoutes(t *testing.T) {
+	os.Setenv("DEPRECATED_ROUTES", "GET /routers since=2026-10-01 sunset=2027-04-01 successor=/items?device_type=router, delete /items/{id} since=2026-11-01 link=https://docs.example.com/deletes, POST /items since=2026-12-01 fields=site|notes successor=site_id")
+	defer os.Unsetenv("DEPRECATED_ROUTES")
+
+	cfg := Load()
+	if len(cfg.loadErrs) > 0 {
+		t.Fatalf("Unexpected load errors: %v", cfg.loadErrs)
+	}
+	want := []RouteDeprecation{
+		{Method: "GET", Route: "/routers", Since: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), Sunset: time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC), Successor: "/items?device_type=router"},
+		{Method: "DELETE", Route: "/items/{id}", Since: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), Link: "https://docs.example.com/deletes"},
+		{Method: "POST", Route: "/items", Since: time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), Successor: "site_id", Fields: []string{"site", "notes"}},
+	}
+	if !reflect.DeepEqual(cfg.DeprecatedRoutes, want) {
+		t.Errorf("DeprecatedRoutes = %+v, want %+v", cfg.DeprecatedRoutes, want)
+	}
+
+	for value, want := range map[string]string{
+		"GET":                                 "must look like",
+		"GET /routers since=soon":             "since",
+		"GET /routers since=2026-10-01 eol=1": "unknown field",
+		"GET /items since=2026-10-01 fields=site||notes":  "empty name",
+		"FETCH /routers since=2026-10-01":                 "must start with a method",
+		"GET /routers":                                    "needs since",
+		"GET /routers since=2026-10-01 sunset=2026-09-01": "sunset after since",
+	} {
+		os.Setenv("DEPRECATED_ROUTES", value)
+		cfg := Load()
+		cfg.JWTSecret, cfg.DBDSN = "valid-secret-that-is-long-enough-for-testing", "postgres://localhost/era_test"
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: Validate() error = %v, want %q", value, err, want)
+		}
+	}
+}
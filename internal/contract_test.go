@@ -0,0 +1,305 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/health"
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/testutil"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// spec is the parsed openapi.yaml the server embeds
+type spec struct {
+	root map[string]interface{}
+}
+
+func loadSpec(t *testing.T) *spec {
+	t.Helper()
+	data, err := openapiFS.ReadFile("openapi/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := parseSpecYAML(data)
+	if err != nil {
+		t.Fatalf("parse openapi.yaml: %v", err)
+	}
+	return &spec{root: root.(map[string]interface{})}
+}
+
+// deref follows a local $ref such as #/components/schemas/Site
+func (s *spec) deref(node interface{}) map[string]interface{} {
+	m, _ := node.(map[string]interface{})
+	for m != nil {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		var cur interface{} = s.root
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			next, _ := cur.(map[string]interface{})
+			cur = next[part]
+		}
+		m, _ = cur.(map[string]interface{})
+	}
+	return m
+}
+
+// checkResponse reports how the recorded response departs from the
+// documented one for the operation at path (a spec path template)
+func (s *spec) checkResponse(method, path string, w *httptest.ResponseRecorder) []string {
+	paths := s.root["paths"].(map[string]interface{})
+	op := s.deref(s.deref(paths[path])[strings.ToLower(method)])
+	if op == nil {
+		return []string{"operation is not documented"}
+	}
+	responses := s.deref(op["responses"])
+	resp := s.deref(responses[strconv.Itoa(w.Code)])
+	if resp == nil {
+		resp = s.deref(responses["default"])
+	}
+	if resp == nil {
+		return []string{fmt.Sprintf("status %d is not documented", w.Code)}
+	}
+
+	content := s.deref(resp["content"])
+	if len(content) == 0 {
+		if w.Body.Len() > 0 {
+			return []string{"documented without a body but returned one"}
+		}
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	media := s.deref(content[mediaType])
+	if media == nil {
+		return []string{fmt.Sprintf("content type %q is not documented", mediaType)}
+	}
+	if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil
+	}
+	var body interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		return []string{"invalid JSON body: " + err.Error()}
+	}
+	return s.validate(media["schema"], body, "body")
+}
+
+// validate checks v against the OpenAPI schema keywords the spec uses: type,
+// nullable, enum, properties, required, items and additionalProperties
+func (s *spec) validate(node interface{}, v interface{}, at string) []string {
+	schema := s.deref(node)
+	if schema == nil {
+		return nil
+	}
+	if v == nil {
+		if schema["nullable"] == true || schema["type"] == nil {
+			return nil
+		}
+		return []string{at + ": null is not allowed"}
+	}
+
+	if typ, ok := schema["type"].(string); ok && !jsonTypeIs(v, typ) {
+		return []string{fmt.Sprintf("%s: want %s, got %T", at, typ, v)}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(v)
+		}
+		if !found {
+			return []string{fmt.Sprintf("%s: %v is not one of %v", at, v, enum)}
+		}
+	}
+
+	var errs []string
+	switch val := v.(type) {
+	case map[string]interface{}:
+		props := s.deref(schema["properties"])
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := val[name.(string)]; !present {
+					errs = append(errs, fmt.Sprintf("%s: missing required %q", at, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := props[k]; ok {
+				errs = append(errs, s.validate(prop, val[k], at+"."+k)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					errs = append(errs, fmt.Sprintf("%s: unexpected property %q", at, k))
+				}
+			case map[string]interface{}:
+				errs = append(errs, s.validate(extra, val[k], at+"."+k)...)
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			errs = append(errs, s.validate(schema["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	}
+	return errs
+}
+
+func jsonTypeIs(v interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return true
+}
+
+func TestParseSpecYAML(t *testing.T) {
+	doc := `
+a:
+  b: [x, 'y z', {k: 1}]
+  '200': &ok
+    $ref: '#/c'
+  "201": *ok
+list:
+  - name: q
+    in: query
+  - plain
+text: |
+  one
+  two
+folded: >-
+  one
+  two
+empty: {}
+n: 3
+200: int key
+`
+	v, err := parseSpecYAML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := json.Marshal(v)
+	want := `{"200":"int key","a":{"200":{"$ref":"#/c"},"201":{"$ref":"#/c"},"b":["x","y z",{"k":1}]},` +
+		`"empty":{},"folded":"one two","list":[{"in":"query","name":"q"},"plain"],"n":3,"text":"one\ntwo\n"}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if _, ok := v.(map[string]interface{})["n"].(float64); !ok {
+		t.Errorf("n decoded to %T, want float64", v.(map[string]interface{})["n"])
+	}
+
+	if _, err := parseSpecYAML([]byte("a: [unclosed\n")); err == nil {
+		t.Error("malformed YAML parsed without error")
+	}
+}
+
+// TestHandlersMatchSpec replays canonical requests through the real router
+// and checks every response against the embedded openapi.yaml, so handler
+// changes and spec edits cannot drift apart unnoticed.
+func TestHandlersMatchSpec(t *testing.T) {
+	sp := loadSpec(t)
+
+	f := testutil.NewFixtures(t)
+	hq := f.Site("HQ").Location("Berlin").Create()
+	acme := f.Vendor("Acme").Email("sales@acme.test").Create()
+
+	s := fixtureServer(f)
+	s.Router = chi.NewRouter()
+	s.JWTManager = auth.NewJWTManager("supersecretkeyforunittestingonly!", "era-inventory-api", "era-inventory-api", time.Hour)
+	s.Metrics = NewMetrics()
+	s.Health = health.NewRegistry(time.Second)
+	s.Sessions = service.NewSessions(testutil.NewMemRefreshTokens(), s.JWTManager, 24*time.Hour, 0)
+	s.RevokedTokens = testutil.NewMemRevokedTokens()
+	s.Revocations = auth.NewRevocations()
+	s.JWTManager.SetRevocations(s.Revocations)
+	s.mountRoutes(&config.Config{RefreshTokenTTL: 24 * time.Hour})
+
+	token, err := s.JWTManager.GenerateToken(1, 1, []string{"org_admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site := "/sites/" + itoa(hq.ID)
+	vendor := "/vendors/" + itoa(acme.ID)
+	cases := []struct {
+		method, specPath, url, body string
+		anonymous                   bool
+		want                        int
+	}{
+		{"GET", "/health", "/health", "", true, 200},
+		{"GET", "/readyz", "/readyz", "", true, 200},
+		{"GET", "/version", "/version", "", true, 200},
+		{"GET", "/items", "/items", "", true, 401},
+
+		{"GET", "/sites", "/sites?q=hq", "", false, 200},
+		{"GET", "/sites/{id}", site, "", false, 200},
+		{"GET", "/sites/{id}", "/sites/999", "", false, 404},
+		{"POST", "/sites", "/sites", `{"name":"Annex","notes":"2nd floor"}`, false, 201},
+		{"POST", "/sites", "/sites", `{}`, false, 400},
+		{"PUT", "/sites/{id}", site, `{"location":""}`, false, 200},
+
+		{"GET", "/vendors", "/vendors", "", false, 200},
+		{"GET", "/vendors/{id}", vendor, "", false, 200},
+		{"POST", "/vendors", "/vendors", `{"name":"Globex"}`, false, 201},
+		{"PUT", "/vendors/{id}", vendor, `{}`, false, 400},
+		{"DELETE", "/vendors/{id}", vendor, "", false, 204},
+
+		{"GET", "/trash", "/trash?type=widget", "", false, 400},
+
+		{"POST", "/auth/sessions", "/auth/sessions", "", false, 201},
+		{"POST", "/auth/refresh", "/auth/refresh", `{"refresh_token":"unknown"}`, true, 401},
+		{"POST", "/auth/refresh/revoke", "/auth/refresh/revoke", `{`, true, 400},
+
+		// logout revokes the token every case above used, so it runs last
+		{"POST", "/auth/logout", "/auth/logout", "", false, 204},
+		{"GET", "/sites", "/sites", "", false, 401},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			if !tc.anonymous {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			s.Router.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+			for _, problem := range sp.checkResponse(tc.method, tc.specPath, w) {
+				t.Errorf("%s %s: %s", tc.method, tc.specPath, problem)
+			}
+		})
+	}
+}
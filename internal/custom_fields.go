@@ -0,0 +1,390 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// customFieldKey is the shape of a custom field key, as enforced by the table
+var customFieldKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+
+// customFieldUpdate is the body of PUT /custom-fields/{id}. The key, type and
+// device type of a field are fixed once created; options apply to enums only.
+type customFieldUpdate struct {
+	Label    *string  `json:"label"`
+	Options  []string `json:"options"`
+	Required *bool    `json:"required"`
+}
+
+func validCustomFieldType(typ string) bool {
+	for _, t := range models.CustomFieldTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// checkEnumOptions requires a non-empty list of distinct, non-blank options
+func checkEnumOptions(options []string) error {
+	if len(options) == 0 {
+		return errors.New("an enum field needs options")
+	}
+	seen := map[string]bool{}
+	for _, o := range options {
+		if strings.TrimSpace(o) == "" {
+			return errors.New("options must not be blank")
+		}
+		if seen[o] {
+			return fmt.Errorf("option %q is listed twice", o)
+		}
+		seen[o] = true
+	}
+	return nil
+}
+
+// scanCustomField reads the columns selected by customFieldColumns
+func scanCustomField(row interface{ Scan(...interface{}) error }, f *models.CustomField) error {
+	var options []byte
+	if err := row.Scan(&f.ID, &f.DeviceType, &f.Key, &f.Label, &f.Type, &options, &f.Required, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(options, &f.Options)
+}
+
+const customFieldColumns = "id, device_type, key, label, type, options, required, created_at, updated_at"
+
+// listCustomFields lists the org's field definitions, optionally for one device type
+func (s *Server) listCustomFields(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	args := []interface{}{auth.OrgIDFromContext(r.Context())}
+	cond := ""
+	if dt := r.URL.Query().Get("device_type"); dt != "" {
+		args = append(args, dt)
+		cond = " AND device_type = $2"
+	}
+
+	q := dbFrom(r.Context(), s.DB)
+	rows, err := q.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER() as total_count
+		FROM custom_fields WHERE org_id = $1%s
+		ORDER BY device_type, key
+		LIMIT %d OFFSET %d`, customFieldColumns, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	fields := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var f models.CustomField
+		var options []byte
+		if err := rows.Scan(&f.ID, &f.DeviceType, &f.Key, &f.Label, &f.Type, &options, &f.Required, &f.CreatedAt, &f.UpdatedAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := json.Unmarshal(options, &f.Options); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		fields = append(fields, f)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, fields, totalCount, params, nil)
+}
+
+func (s *Server) getCustomField(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var f models.CustomField
+	err := scanCustomField(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(),
+		`SELECT `+customFieldColumns+` FROM custom_fields WHERE id = $1 AND org_id = $2`,
+		id, auth.OrgIDFromContext(r.Context())), &f)
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	setLastModified(w, f.UpdatedAt)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) createCustomField(w http.ResponseWriter, r *http.Request) {
+	var in models.CustomField
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if strings.TrimSpace(in.DeviceType) == "" {
+		problem.BadRequest(w, r, "device_type is required")
+		return
+	}
+	if !customFieldKey.MatchString(in.Key) {
+		problem.BadRequest(w, r, "key must start with a lowercase letter and use only a-z, 0-9 and _ (at most 63 characters)")
+		return
+	}
+	if !validCustomFieldType(in.Type) {
+		problem.BadRequest(w, r, "type must be one of: "+strings.Join(models.CustomFieldTypes, ", "))
+		return
+	}
+	if in.Type == models.FieldEnum {
+		if err := checkEnumOptions(in.Options); err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+	} else if len(in.Options) > 0 {
+		problem.BadRequest(w, r, "options apply to enum fields only")
+		return
+	}
+	options, _ := json.Marshal(append([]string{}, in.Options...))
+
+	var out models.CustomField
+	err := scanCustomField(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		INSERT INTO custom_fields (org_id, device_type, key, label, type, options, required)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING `+customFieldColumns,
+		auth.OrgIDFromContext(r.Context()), in.DeviceType, in.Key, in.Label, in.Type, string(options), in.Required), &out)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, fmt.Sprintf("%s already has a field %q", in.DeviceType, in.Key))
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// updateCustomField changes a field's label, required flag or enum options.
+// Values already stored on items are not rechecked.
+func (s *Server) updateCustomField(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in customFieldUpdate
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.Label == nil && in.Options == nil && in.Required == nil {
+		problem.BadRequest(w, r, "no fields to update")
+		return
+	}
+	if in.Options != nil {
+		if err := checkEnumOptions(in.Options); err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	var options interface{}
+	if in.Options != nil {
+		b, _ := json.Marshal(in.Options)
+		options = string(b)
+	}
+	var out models.CustomField
+	err := scanCustomField(q.QueryRowContext(r.Context(), `
+		UPDATE custom_fields SET
+			label = COALESCE($3, label),
+			options = COALESCE($4::jsonb, options),
+			required = COALESCE($5, required)
+		WHERE id = $1 AND org_id = $2 AND ($4::jsonb IS NULL OR type = 'enum')
+		RETURNING `+customFieldColumns, id, orgID, in.Label, options, in.Required), &out)
+	if err == sql.ErrNoRows && in.Options != nil {
+		// tell a non-enum field apart from a missing one
+		var exists bool
+		if err := q.QueryRowContext(r.Context(),
+			`SELECT EXISTS (SELECT 1 FROM custom_fields WHERE id = $1 AND org_id = $2)`, id, orgID).Scan(&exists); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if exists {
+			problem.BadRequest(w, r, "options apply to enum fields only")
+			return
+		}
+	}
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// deleteCustomField removes a definition. Values items already hold stay in
+// their custom_fields but can no longer be written.
+func (s *Server) deleteCustomField(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(),
+		`DELETE FROM custom_fields WHERE id = $1 AND org_id = $2`, id, auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// customFieldDefs loads the fields defined for a device type, by key
+func customFieldDefs(ctx context.Context, q querier, orgID int64, deviceType string) (map[string]models.CustomField, error) {
+	defs := map[string]models.CustomField{}
+	if deviceType == "" {
+		return defs, nil
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT `+customFieldColumns+` FROM custom_fields WHERE org_id = $1 AND device_type = $2`, orgID, deviceType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f models.CustomField
+		if err := scanCustomField(rows, &f); err != nil {
+			return nil, err
+		}
+		defs[f.Key] = f
+	}
+	return defs, rows.Err()
+}
+
+// mergeCustomValues applies a write to stored values: set keys replace, null
+// keys are removed
+func mergeCustomValues(stored, values models.CustomValues) models.CustomValues {
+	out := models.CustomValues{}
+	for k, v := range stored {
+		out[k] = v
+	}
+	for k, v := range values {
+		if v == nil {
+			delete(out, k)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// validateCustomValues checks the values an item write sets against defs, and
+// that merged, the item's values after the write, has every required field
+func validateCustomValues(defs map[string]models.CustomField, values, merged models.CustomValues) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		def, ok := defs[k]
+		if !ok {
+			return fmt.Errorf("custom_fields.%s is not defined for this device_type", k)
+		}
+		if v := values[k]; v != nil {
+			if err := checkCustomValue(def, v); err != nil {
+				return fmt.Errorf("custom_fields.%s %s", k, err)
+			}
+		}
+	}
+
+	var missing []string
+	for k, def := range defs {
+		if def.Required && merged[k] == nil {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.New("custom_fields missing required: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkCustomValue checks one JSON-decoded value against its field's type
+func checkCustomValue(def models.CustomField, v interface{}) error {
+	switch def.Type {
+	case models.FieldText:
+		if _, ok := v.(string); !ok {
+			return errors.New("must be a string")
+		}
+	case models.FieldInt:
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) || math.Abs(n) > 1<<53 {
+			return errors.New("must be an integer")
+		}
+	case models.FieldBool:
+		if _, ok := v.(bool); !ok {
+			return errors.New("must be true or false")
+		}
+	case models.FieldEnum:
+		str, _ := v.(string)
+		for _, o := range def.Options {
+			if o == str {
+				return nil
+			}
+		}
+		return errors.New("must be one of: " + strings.Join(def.Options, ", "))
+	case models.FieldDate:
+		str, _ := v.(string)
+		if _, err := time.Parse("2006-01-02", str); err != nil {
+			return errors.New("must be a date (YYYY-MM-DD)")
+		}
+	}
+	return nil
+}
+
+// checkItemCustomFields validates an item write's custom_fields for the
+// item's device type and returns the values to store, answering 400 on failure
+func (s *Server) checkItemCustomFields(w http.ResponseWriter, r *http.Request, deviceType string, stored, values models.CustomValues) (models.CustomValues, bool) {
+	defs, err := customFieldDefs(r.Context(), dbFrom(r.Context(), s.DB), auth.OrgIDFromContext(r.Context()), deviceType)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return nil, false
+	}
+	merged := mergeCustomValues(stored, values)
+	if err := validateCustomValues(defs, values, merged); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return nil, false
+	}
+	return merged, true
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"era-inventory-api/internal/models"
+)
+
+func TestValidateCustomValues(t *testing.T) {
+	defs := map[string]models.CustomField{
+		"ports":    {Key: "ports", Type: models.FieldInt, Required: true},
+		"poe":      {Key: "poe", Type: models.FieldBool},
+		"band":     {Key: "band", Type: models.FieldEnum, Options: []string{"2.4GHz", "5GHz"}},
+		"eol":      {Key: "eol", Type: models.FieldDate},
+		"location": {Key: "location", Type: models.FieldText},
+	}
+	values := func(js string) models.CustomValues {
+		var v models.CustomValues
+		if err := json.Unmarshal([]byte(js), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cases := []struct {
+		stored, values string
+		wantErr        string
+	}{
+		{`{}`, `{"ports":48,"poe":true,"band":"5GHz","eol":"2030-01-31","location":"rack 2"}`, ""},
+		{`{"ports":24}`, `{"poe":false}`, ""},
+		{`{}`, `{"poe":true}`, "custom_fields missing required: ports"},
+		{`{"ports":24}`, `{"ports":null}`, "custom_fields missing required: ports"},
+		{`{}`, `{"ports":4.5}`, "custom_fields.ports must be an integer"},
+		{`{}`, `{"ports":"48"}`, "custom_fields.ports must be an integer"},
+		{`{"ports":1}`, `{"poe":"yes"}`, "custom_fields.poe must be true or false"},
+		{`{"ports":1}`, `{"band":"6GHz"}`, "custom_fields.band must be one of: 2.4GHz, 5GHz"},
+		{`{"ports":1}`, `{"eol":"31/01/2030"}`, "custom_fields.eol must be a date (YYYY-MM-DD)"},
+		{`{"ports":1}`, `{"location":7}`, "custom_fields.location must be a string"},
+		{`{"ports":1}`, `{"colour":"red"}`, "custom_fields.colour is not defined for this device_type"},
+	}
+	for _, c := range cases {
+		v := values(c.values)
+		err := validateCustomValues(defs, v, mergeCustomValues(values(c.stored), v))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.wantErr {
+			t.Errorf("stored %s + %s: error %q, want %q", c.stored, c.values, got, c.wantErr)
+		}
+	}
+}
+
+func TestMergeCustomValues(t *testing.T) {
+	got := mergeCustomValues(models.CustomValues{"a": "1", "b": "2"}, models.CustomValues{"b": nil, "c": true})
+	if len(got) != 2 || got["a"] != "1" || got["c"] != true {
+		t.Errorf("merged = %v", got)
+	}
+}
+
+func TestCreateCustomFieldRejectsBadDefinitions(t *testing.T) {
+	s := &Server{}
+	for _, body := range []string{
+		`{"key":"ports","type":"int"}`,
+		`{"device_type":"switch","key":"Ports","type":"int"}`,
+		`{"device_type":"switch","key":"ports","type":"float"}`,
+		`{"device_type":"switch","key":"band","type":"enum"}`,
+		`{"device_type":"switch","key":"band","type":"enum","options":["a","a"]}`,
+		`{"device_type":"switch","key":"ports","type":"int","options":["1"]}`,
+	} {
+		w := serveAs(1, http.MethodPost, "/custom-fields", "/custom-fields", body, s.createCustomField)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+const (
+	// dashboardListSize caps each list in the dashboard payload
+	dashboardListSize = 10
+	// warrantyHorizonDays is how far ahead the dashboard looks for expiring warranties
+	warrantyHorizonDays = 90
+)
+
+// dashboardCounts holds resource totals for the caller's org
+type dashboardCounts struct {
+	Items    int `json:"items"`
+	Sites    int `json:"sites"`
+	Vendors  int `json:"vendors"`
+	Projects int `json:"projects"`
+}
+
+// dashboardResponse is the landing page payload of GET /dashboard
+type dashboardResponse struct {
+	Counts             dashboardCounts `json:"counts"`
+	RecentChanges      []models.Item   `json:"recent_changes"`
+	ExpiringWarranties []models.Item   `json:"expiring_warranties"`
+	FailedJobs         []models.Job    `json:"failed_jobs"`
+	GeneratedAt        time.Time       `json:"generated_at"`
+}
+
+func (s *Server) getDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	orgID := auth.OrgIDFromContext(ctx)
+
+	out := dashboardResponse{GeneratedAt: time.Now().UTC()}
+
+	itemWhere := "org_id = $1 AND deleted_at IS NULL"
+	itemArgs := []interface{}{orgID}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", 2); clause != "" {
+		itemWhere += " AND " + clause
+		itemArgs = append(itemArgs, siteArgs...)
+	}
+
+	q := dbFrom(ctx, s.DB)
+	if err := q.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM inventory WHERE `+itemWhere+`),
+		       (SELECT COUNT(*) FROM sites WHERE org_id = $1 AND deleted_at IS NULL),
+		       (SELECT COUNT(*) FROM vendors WHERE org_id = $1 AND deleted_at IS NULL),
+		       (SELECT COUNT(*) FROM projects WHERE org_id = $1 AND deleted_at IS NULL)`, itemArgs...).
+		Scan(&out.Counts.Items, &out.Counts.Sites, &out.Counts.Vendors, &out.Counts.Projects); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	var err error
+	out.RecentChanges, err = s.dashboardItems(ctx, `
+		WHERE `+itemWhere+` ORDER BY updated_at DESC, id DESC`, itemArgs)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	out.ExpiringWarranties, err = s.dashboardItems(ctx, `
+		WHERE `+itemWhere+` AND warranty_end BETWEEN CURRENT_DATE AND CURRENT_DATE + `+
+		strconv.Itoa(warrantyHorizonDays)+` ORDER BY warranty_end, id`, itemArgs)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	out.FailedJobs, err = s.Jobs.RecentFailed(ctx, orgID, dashboardListSize)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// dashboardItems returns up to dashboardListSize items matching the given WHERE/ORDER BY tail
+func (s *Server) dashboardItems(ctx context.Context, tail string, args []interface{}) ([]models.Item, error) {
+	q := dbFrom(ctx, s.DB)
+	rows, err := q.QueryContext(ctx, `
+		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
+		       installed_at, warranty_end, notes, status, created_at, updated_at
+		FROM inventory `+tail+` LIMIT `+strconv.Itoa(dashboardListSize), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.Item{}
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(
+			&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
+			&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes, &it.Status, &it.CreatedAt, &it.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"era-inventory-api/internal/problem"
+)
+
+const (
+	// defaultMaxBodyBytes caps JSON request bodies when MAX_BODY_BYTES is unset
+	defaultMaxBodyBytes = 1 << 20
+	// maxJSONDepth caps how deeply objects and arrays may nest in a request body
+	maxJSONDepth = 32
+)
+
+// decodeJSON reads the request body into dst, rejecting bodies larger than
+// MAX_BODY_BYTES, nested deeper than maxJSONDepth, carrying fields dst does
+// not declare or followed by trailing data. On failure it writes the problem
+// response and returns false.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return readJSON(w, r, dst, s.bodyLimit(), false)
+}
+
+// decodeOptionalJSON is decodeJSON for endpoints whose body may be omitted;
+// an empty body leaves dst untouched
+func (s *Server) decodeOptionalJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	return readJSON(w, r, dst, s.bodyLimit(), true)
+}
+
+func (s *Server) bodyLimit() int64 {
+	if s.MaxBodyBytes > 0 {
+		return s.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// readJSON implements decodeJSON with an explicit size limit, for the few
+// endpoints (config snapshots) that accept larger bodies
+func readJSON(w http.ResponseWriter, r *http.Request, dst interface{}, limit int64, optional bool) bool {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE",
+				fmt.Sprintf("request body must be at most %d bytes", limit))
+			return false
+		}
+		problem.BadRequest(w, r, "could not read request body")
+		return false
+	}
+	if optional && len(bytes.TrimSpace(data)) == 0 {
+		return true
+	}
+	if jsonDepth(data) > maxJSONDepth {
+		problem.BadRequest(w, r, fmt.Sprintf("JSON nested deeper than %d levels", maxJSONDepth))
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		problem.BadRequest(w, r, decodeErrorDetail(err))
+		return false
+	}
+	if dec.More() {
+		problem.BadRequest(w, r, "request body must contain a single JSON value")
+		return false
+	}
+	return true
+}
+
+// decodeErrorDetail turns a json decode error into a client-facing detail
+func decodeErrorDetail(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Sprintf("%s must be %s", typeErr.Field, jsonKind(typeErr.Type.Kind().String()))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return strings.TrimPrefix(err.Error(), "json: ")
+	}
+	return "invalid JSON"
+}
+
+// jsonKind names a Go kind the way a JSON client would think of it
+func jsonKind(kind string) string {
+	switch kind {
+	case "string":
+		return "a string"
+	case "bool":
+		return "a boolean"
+	case "slice", "array":
+		return "an array"
+	case "struct", "map":
+		return "an object"
+	case "float32", "float64":
+		return "a number"
+	}
+	return "an integer"
+}
+
+// jsonDepth returns the deepest object/array nesting in data without
+// decoding it, so hostile bodies are rejected before any allocation
+func jsonDepth(data []byte) int {
+	depth, deepest := 0, 0
+	inString, escaped := false, false
+	for _, c := range data {
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > deepest {
+				deepest = depth
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return deepest
+}
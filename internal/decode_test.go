@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/testutil"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	s := &Server{MaxBodyBytes: 128}
+	type input struct {
+		Name  string   `json:"name"`
+		Count int      `json:"count"`
+		Tags  []string `json:"tags"`
+	}
+
+	cases := []struct {
+		name, body string
+		optional   bool
+		want       int
+		detail     string
+	}{
+		{"valid", `{"name":"a","count":2}`, false, http.StatusOK, ""},
+		{"malformed", `{"name":`, false, http.StatusBadRequest, "invalid JSON"},
+		{"unknown field", `{"name":"a","nmae":"b"}`, false, http.StatusBadRequest, `unknown field \"nmae\"`},
+		{"wrong type", `{"count":"two"}`, false, http.StatusBadRequest, "count must be an integer"},
+		{"trailing value", `{"name":"a"}{"name":"b"}`, false, http.StatusBadRequest, "single JSON value"},
+		{"too large", `{"name":"` + strings.Repeat("x", 128) + `"}`, false, http.StatusRequestEntityTooLarge, "at most 128 bytes"},
+		{"too deep", `{"tags":` + strings.Repeat("[", maxJSONDepth) + strings.Repeat("]", maxJSONDepth) + `}`, false, http.StatusBadRequest, "nested deeper"},
+		{"brackets in strings", `{"name":"` + strings.Repeat("[", 40) + `"}`, false, http.StatusOK, ""},
+		{"empty", ``, false, http.StatusBadRequest, "invalid JSON"},
+		{"empty optional", ` `, true, http.StatusOK, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			var in input
+			var ok bool
+			if tc.optional {
+				ok = s.decodeOptionalJSON(w, r, &in)
+			} else {
+				ok = s.decodeJSON(w, r, &in)
+			}
+			if ok != (tc.want == http.StatusOK) {
+				t.Fatalf("ok = %v, want status %d: %s", ok, tc.want, w.Body.String())
+			}
+			if !ok && (w.Code != tc.want || !strings.Contains(w.Body.String(), tc.detail)) {
+				t.Errorf("got %d %s, want %d mentioning %q", w.Code, w.Body.String(), tc.want, tc.detail)
+			}
+		})
+	}
+}
+
+func TestHandlersRejectUnknownFields(t *testing.T) {
+	s := fixtureServer(testutil.NewFixtures(t))
+	w := serveAs(1, http.MethodPost, "/sites", "/sites", `{"name":"Annex","adress":"Main St"}`, s.createSite)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "adress") {
+		t.Errorf("typo'd field = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/config"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// deprecationKey indexes Server.Deprecations by method and route pattern
+func deprecationKey(method, route string) string {
+	return method + " " + route
+}
+
+// deprecationHeaders announces deprecated routes (DEPRECATED_ROUTES) on every
+// response they serve: Deprecation (RFC 9745) with the date of the
+// deprecation, Sunset (RFC 8594) with the removal date, and Link to the
+// documentation and the successor. List responses repeat it in
+// meta.warnings. The route is looked up before the handler runs, as it may
+// write the headers at any point.
+//
+// Deprecated fields of a route (entries with fields=) are reported when the
+// request body or the response carries them, as a "Warning: 299" header per
+// field and, on lists, in meta.warnings. Those routes' responses are
+// buffered to find the fields before the headers go out.
+func (s *Server) deprecationHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := s.Router.Find(chi.NewRouteContext(), r.Method, r.URL.Path)
+		key := deprecationKey(r.Method, route)
+		if d, ok := s.Deprecations[key]; ok {
+			setDeprecationHeaders(w.Header(), d)
+		}
+		fields := s.FieldDeprecations[key]
+		if len(fields) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fw := &fieldWarningWriter{ResponseWriter: w, fields: fields, sent: s.requestFields(r)}
+		next.ServeHTTP(fw, r)
+		fw.finish()
+	})
+}
+
+// requestFields returns the top-level fields of a JSON request body (or of
+// the objects of a JSON array body) and puts the body back for the handler.
+// Bodies over the size limit are left to the handler to refuse.
+func (s *Server) requestFields(r *http.Request) map[string]bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, s.bodyLimit()+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil {
+		return nil
+	}
+	return jsonFields(buf)
+}
+
+// jsonFields is the set of top-level keys of the JSON object in b, or of the
+// objects in b when it is an array; nil when b is neither
+func jsonFields(b []byte) map[string]bool {
+	var objects []map[string]json.RawMessage
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(b, &object); err == nil {
+		objects = append(objects, object)
+	} else if err := json.Unmarshal(b, &objects); err != nil {
+		return nil
+	}
+	out := map[string]bool{}
+	for _, o := range objects {
+		for k := range o {
+			out[k] = true
+		}
+	}
+	return out
+}
+
+// fieldWarningWriter holds back a response of a route with deprecated
+// fields until finish, which adds the warnings for the fields found
+type fieldWarningWriter struct {
+	http.ResponseWriter
+	fields []config.RouteDeprecation
+	sent   map[string]bool
+	code   int
+	buf    bytes.Buffer
+}
+
+func (fw *fieldWarningWriter) WriteHeader(code int) {
+	if fw.code == 0 {
+		fw.code = code
+	}
+}
+
+func (fw *fieldWarningWriter) Write(b []byte) (int, error) {
+	return fw.buf.Write(b)
+}
+
+// FlushError does nothing: the response is sent by finish
+func (fw *fieldWarningWriter) FlushError() error { return nil }
+
+func (fw *fieldWarningWriter) Unwrap() http.ResponseWriter { return fw.ResponseWriter }
+
+// finish warns about the deprecated fields the request or the response
+// carries and sends the response
+func (fw *fieldWarningWriter) finish() {
+	code, body, h := fw.code, fw.buf.Bytes(), fw.ResponseWriter.Header()
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	var list struct {
+		Data []json.RawMessage `json:"data"`
+		Page json.RawMessage   `json:"page"`
+		Meta *listMeta         `json:"meta,omitempty"`
+	}
+	isList := false
+	returned := map[string]bool{}
+	if code < 300 && strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+		if err := json.Unmarshal(body, &list); err == nil && list.Data != nil && list.Page != nil {
+			isList = true
+			for _, row := range list.Data {
+				for k := range jsonFields(row) {
+					returned[k] = true
+				}
+			}
+		} else {
+			returned = jsonFields(body)
+		}
+	}
+
+	var warnings []string
+	for _, d := range fw.fields {
+		for _, field := range d.Fields {
+			if fw.sent[field] || returned[field] {
+				warnings = append(warnings, fieldDeprecationWarning(field, d))
+			}
+		}
+	}
+	for _, warning := range warnings {
+		h.Add("Warning", fmt.Sprintf("299 - %q", warning))
+	}
+	if isList && len(warnings) > 0 {
+		if list.Meta == nil {
+			list.Meta = &listMeta{}
+		}
+		list.Meta.Warnings = append(list.Meta.Warnings, warnings...)
+		var out bytes.Buffer
+		if err := json.NewEncoder(&out).Encode(list); err == nil {
+			body = out.Bytes()
+			h.Del("Content-Length")
+		}
+	}
+	fw.ResponseWriter.WriteHeader(code)
+	fw.ResponseWriter.Write(body)
+}
+
+// fieldDeprecationWarning describes the deprecation of field by d
+func fieldDeprecationWarning(field string, d config.RouteDeprecation) string {
+	msg := fmt.Sprintf("field %s is deprecated", field)
+	if !d.Sunset.IsZero() {
+		msg += " and will be removed on " + d.Sunset.Format(time.DateOnly)
+	}
+	if d.Successor != "" {
+		msg += "; use " + d.Successor + " instead"
+	}
+	if d.Link != "" {
+		msg += "; see " + d.Link
+	}
+	return msg
+}
+
+func setDeprecationHeaders(h http.Header, d config.RouteDeprecation) {
+	h.Set("Deprecation", fmt.Sprintf("@%d", d.Since.Unix()))
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		h.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, d.Link))
+	}
+	if d.Successor != "" {
+		h.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, d.Successor))
+	}
+}
+
+// deprecationWarning is the meta warning of a response whose headers
+// announce a deprecation, "" for any other
+func deprecationWarning(h http.Header) string {
+	if h.Get("Deprecation") == "" {
+		return ""
+	}
+	msg := "this endpoint is deprecated"
+	if sunset, err := http.ParseTime(h.Get("Sunset")); err == nil {
+		msg += " and will be removed on " + sunset.Format(time.DateOnly)
+	}
+	for _, link := range h.Values("Link") {
+		if strings.Contains(link, `rel="successor-version"`) {
+			msg += "; see the successor-version Link header for its replacement"
+			break
+		}
+	}
+	return msg
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/config"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDeprecationHeaders(t *testing.T) {
+	s := &Server{Router: chi.NewRouter(), Deprecations: map[string]config.RouteDeprecation{
+		deprecationKey("GET", "/routers/{id}/ports"): {
+			Since:     time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			Sunset:    time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+			Link:      "https://docs.example.com/ports",
+			Successor: "/items/{id}/links",
+		},
+	}}
+	s.Router.Use(s.deprecationHeaders)
+	list := func(w http.ResponseWriter, r *http.Request) {
+		sendListResponse(w, []interface{}{}, 0, s.parseListParams(r), nil)
+	}
+	s.Router.Get("/routers/{id}/ports", list)
+	s.Router.Post("/routers/{id}/ports", list)
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/routers/7/ports", nil))
+	if got := w.Header().Get("Deprecation"); got != "@1790812800" {
+		t.Errorf("Deprecation = %q", got)
+	}
+	if got := w.Header().Get("Sunset"); got != "Thu, 01 Apr 2027 00:00:00 GMT" {
+		t.Errorf("Sunset = %q", got)
+	}
+	if links := w.Header().Values("Link"); len(links) != 2 || links[1] != `</items/{id}/links>; rel="successor-version"` {
+		t.Errorf("Link = %q", links)
+	}
+	var resp listResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := "this endpoint is deprecated and will be removed on 2027-04-01; see the successor-version Link header for its replacement"
+	if resp.Meta == nil || len(resp.Meta.Warnings) != 1 || resp.Meta.Warnings[0] != want {
+		t.Errorf("meta = %+v", resp.Meta)
+	}
+
+	// Other methods of the route are not deprecated
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routers/7/ports", nil))
+	if w.Header().Get("Deprecation") != "" || w.Header().Get("Link") != "" {
+		t.Errorf("POST headers = %v", w.Header())
+	}
+}
+
+func TestDeprecationWarning(t *testing.T) {
+	h := http.Header{}
+	if got := deprecationWarning(h); got != "" {
+		t.Errorf("no deprecation: %q", got)
+	}
+	setDeprecationHeaders(h, config.RouteDeprecation{Since: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)})
+	if got := deprecationWarning(h); got != "this endpoint is deprecated" {
+		t.Errorf("without sunset: %q", got)
+	}
+}
+
+func TestFieldDeprecationWarnings(t *testing.T) {
+	d := config.RouteDeprecation{
+		Since:     time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		Sunset:    time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+		Successor: "site_id",
+		Fields:    []string{"site"},
+	}
+	s := &Server{Router: chi.NewRouter(), FieldDeprecations: map[string][]config.RouteDeprecation{
+		deprecationKey("GET", "/items"):  {d},
+		deprecationKey("POST", "/items"): {d},
+	}}
+	s.Router.Use(s.deprecationHeaders)
+	s.Router.Get("/items", func(w http.ResponseWriter, r *http.Request) {
+		rows := []interface{}{map[string]string{"name": "a"}}
+		if r.URL.Query().Get("with_site") != "" {
+			rows = append(rows, map[string]string{"name": "b", "site": "HQ"})
+		}
+		sendListResponse(w, rows, len(rows), s.parseListParams(r), nil)
+	})
+	s.Router.Post("/items", func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]string
+		if !s.decodeJSON(w, r, &in) {
+			return
+		}
+		writeJSON(w, r, http.StatusCreated, map[string]string{"name": in["name"]})
+	})
+	want := "field site is deprecated and will be removed on 2027-04-01; use site_id instead"
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items?with_site=1", nil))
+	if got := w.Header().Get("Warning"); got != `299 - "`+want+`"` {
+		t.Errorf("Warning = %q", got)
+	}
+	var resp listResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Page.Total != 2 || resp.Meta == nil || len(resp.Meta.Warnings) != 1 || resp.Meta.Warnings[0] != want {
+		t.Errorf("response = %s", w.Body)
+	}
+
+	// rows without the field warn about nothing
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items", nil))
+	if w.Header().Get("Warning") != "" || strings.Contains(w.Body.String(), "warnings") {
+		t.Errorf("without the field: %v %s", w.Header(), w.Body)
+	}
+
+	// a request sending the field is warned, and the handler still reads the body
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"c","site":"HQ"}`)))
+	if w.Code != http.StatusCreated || w.Body.String() != "{\"name\":\"c\"}\n" || w.Header().Get("Warning") != `299 - "`+want+`"` {
+		t.Errorf("POST = %d %v %s", w.Code, w.Header(), w.Body)
+	}
+}
@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/mail"
+	"era-inventory-api/internal/problem"
+)
+
+// emailTemplate is the effective template of one key for the caller's org
+type emailTemplate struct {
+	mail.Template
+	Overridden bool       `json:"overridden"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// emailTemplateInput is the body of PUT /email-templates/{key}
+type emailTemplateInput struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// previewInput is the body of POST /email-templates/{key}/preview. Subject
+// and body default to the stored template, data to the key's sample data.
+type previewInput struct {
+	Subject *string                `json:"subject"`
+	Body    *string                `json:"body"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// previewResponse is a rendered template
+type previewResponse struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// templateKey reads {key}, answering 404 for keys without a built-in template
+func templateKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := chi.URLParam(r, "key")
+	if _, ok := mail.Defaults[key]; !ok {
+		problem.NotFound(w, r)
+		return "", false
+	}
+	return key, true
+}
+
+// emailTemplate returns the org's override of key, or the built-in template
+func (s *Server) emailTemplate(r *http.Request, key string) (emailTemplate, error) {
+	t := emailTemplate{Template: mail.Defaults[key]}
+	var updatedAt time.Time
+	err := dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		SELECT subject, body, updated_at FROM email_templates WHERE org_id = $1 AND key = $2`,
+		auth.OrgIDFromContext(r.Context()), key).Scan(&t.Subject, &t.Text, &updatedAt)
+	if err == sql.ErrNoRows {
+		return t, nil
+	}
+	if err != nil {
+		return t, err
+	}
+	t.Overridden, t.UpdatedAt = true, &updatedAt
+	return t, nil
+}
+
+// orgName is the name templates address the org by: its branding display
+// name, else its name
+func (s *Server) orgName(r *http.Request) (string, error) {
+	b, _, _, err := s.orgBranding(r)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return b.DisplayName, nil
+}
+
+// renderEmail builds a message of kind for the caller's org from its
+// effective template; OrgName is added to data
+func (s *Server) renderEmail(r *http.Request, kind string, to []string, data map[string]interface{}) (mail.Message, error) {
+	t, err := s.emailTemplate(r, kind)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	name, err := s.orgName(r)
+	if err != nil {
+		return mail.Message{}, err
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["OrgName"] = name
+	return t.Render(to, data)
+}
+
+// listEmailTemplates lists the effective template of every key
+func (s *Server) listEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	out := []interface{}{}
+	for _, key := range mail.TemplateKeys() {
+		t, err := s.emailTemplate(r, key)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, t)
+	}
+	sendListResponse(w, out, len(out), listParams{limit: len(out)}, nil)
+}
+
+func (s *Server) getEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	key, ok := templateKey(w, r)
+	if !ok {
+		return
+	}
+	t, err := s.emailTemplate(r, key)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(t); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// putEmailTemplate overrides a template for the org. The override must
+// render against the key's sample data, so a typo cannot break sending.
+func (s *Server) putEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	key, ok := templateKey(w, r)
+	if !ok {
+		return
+	}
+	var in emailTemplateInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	name, err := s.orgName(r)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	t := mail.Template{Key: key, Subject: in.Subject, Text: in.Body}
+	if err := t.Validate(name); err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, "INVALID_TEMPLATE", err.Error())
+		return
+	}
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		INSERT INTO email_templates (org_id, key, subject, body) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id, key) DO UPDATE SET subject = EXCLUDED.subject, body = EXCLUDED.body`,
+		auth.OrgIDFromContext(r.Context()), key, t.Subject, t.Text); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getEmailTemplate(w, r)
+}
+
+// deleteEmailTemplate drops the org's override, reverting to the built-in
+// template
+func (s *Server) deleteEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	key, ok := templateKey(w, r)
+	if !ok {
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		DELETE FROM email_templates WHERE org_id = $1 AND key = $2`, auth.OrgIDFromContext(r.Context()), key)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// previewEmailTemplate renders a template without sending or saving it
+func (s *Server) previewEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	key, ok := templateKey(w, r)
+	if !ok {
+		return
+	}
+	var in previewInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	t, err := s.emailTemplate(r, key)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if in.Subject != nil {
+		t.Subject = *in.Subject
+	}
+	if in.Body != nil {
+		t.Text = *in.Body
+	}
+	name, err := s.orgName(r)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	data := mail.SampleData(key, name)
+	for k, v := range in.Data {
+		data[k] = v
+	}
+	m, err := t.Render(nil, data)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnprocessableEntity, "INVALID_TEMPLATE", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(previewResponse{Subject: m.Subject, Body: m.Text}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
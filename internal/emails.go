@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/mail"
+	"era-inventory-api/internal/problem"
+)
+
+// testEmailInput is the body of POST /admin/emails/test
+type testEmailInput struct {
+	To string `json:"to"`
+}
+
+// newMailer builds the configured mail provider; nil means mail is disabled
+func newMailer(cfg *config.Config) mail.Mailer {
+	switch cfg.MailProvider {
+	case "smtp":
+		return &mail.SMTP{Host: cfg.SMTPHost, Port: cfg.SMTPPort, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.Sender()}
+	case "ses":
+		return &mail.SES{Region: cfg.SESRegion, AccessKeyID: cfg.SESAccessKey, SecretAccessKey: cfg.SESSecretKey, From: cfg.Sender()}
+	case "sendgrid":
+		return &mail.SendGrid{APIKey: cfg.SendGridKey, From: cfg.Sender()}
+	case "log":
+		return mail.Log{}
+	}
+	return nil
+}
+
+// listEmails is the org's send log, newest first. ?status= narrows to
+// pending, sent or dead messages and ?kind= to one kind.
+func (s *Server) listEmails(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	args := []interface{}{auth.OrgIDFromContext(r.Context())}
+	cond := "org_id = $1"
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != mail.StatusPending && status != mail.StatusSent && status != mail.StatusDead {
+			problem.BadRequest(w, r, "status must be pending, sent or dead")
+			return
+		}
+		args = append(args, status)
+		cond += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		args = append(args, kind)
+		cond += fmt.Sprintf(" AND kind = $%d", len(args))
+	}
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT id, kind, to_json(recipients), subject, status, attempts, last_error, next_attempt_at, created_at, sent_at,
+		       COUNT(*) OVER() as total_count
+		FROM emails WHERE %s
+		ORDER BY id DESC
+		LIMIT %d OFFSET %d`, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	emails := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var e mail.Email
+		var to []byte
+		if err := rows.Scan(&e.ID, &e.Kind, &to, &e.Subject, &e.Status, &e.Attempts, &e.LastError,
+			&e.NextAttemptAt, &e.CreatedAt, &e.SentAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if err := json.Unmarshal(to, &e.To); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		emails = append(emails, e)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, emails, totalCount, params, nil)
+}
+
+// retryEmail puts a dead letter back in the queue with a fresh set of attempts
+func (s *Server) retryEmail(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		UPDATE emails SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND org_id = $2 AND status = 'dead'`, id, auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendTestEmail queues a message to check the mail setup end to end
+func (s *Server) sendTestEmail(w http.ResponseWriter, r *http.Request) {
+	if s.Mail == nil {
+		problem.Write(w, r, http.StatusServiceUnavailable, "MAIL_DISABLED", "mail is not configured; set MAIL_PROVIDER")
+		return
+	}
+	var in testEmailInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	to, err := netmail.ParseAddress(strings.TrimSpace(in.To))
+	if err != nil || to.Name != "" {
+		problem.BadRequest(w, r, "to must be a bare email address")
+		return
+	}
+	m, err := s.renderEmail(r, mail.KindTest, []string{to.Address}, nil)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	id, err := mail.Enqueue(r.Context(), dbFrom(r.Context(), s.DB), auth.OrgIDFromContext(r.Context()), mail.KindTest, m)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]int64{"id": id}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -0,0 +1,488 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/i18n"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/storage"
+	"era-inventory-api/internal/xlsx"
+)
+
+// exportItemsJob is the job kind producing an inventory items export
+const exportItemsJob = "export.items"
+
+// downloadURLTTL is how long a signed export download link stays valid
+const downloadURLTTL = 15 * time.Minute
+
+// exportRequest is the body accepted by POST /exports. Anonymize scrubs
+// PII for seeding staging: notes become filler of the same length, and
+// email addresses and phone numbers elsewhere become consistent pseudonyms.
+// Lang is the language of the header, by default the caller's
+// Accept-Language when the export is requested. GroupID narrows the export
+// to the members of an asset group when the job runs.
+type exportRequest struct {
+	Format    string `json:"format"`
+	Q         string `json:"q,omitempty"`
+	GroupID   int64  `json:"group_id,omitempty"`
+	Anonymize bool   `json:"anonymize,omitempty"`
+	Lang      string `json:"lang,omitempty"`
+}
+
+// exportParams are the params of an export job: the request and the scope
+// of the caller, as the job runs outside the request
+type exportParams struct {
+	exportRequest
+	Scope *exportScope `json:"scope,omitempty"`
+}
+
+// exportScope is who requested an export. The job rebuilds the caller's
+// claims from it so its queries honour the same site and project grants as
+// the caller's own requests.
+type exportScope struct {
+	UserID  int64    `json:"user_id"`
+	Roles   []string `json:"roles"`
+	SiteIDs []int64  `json:"site_ids,omitempty"`
+}
+
+// callerExportScope is the scope of the request's caller
+func callerExportScope(ctx context.Context) *exportScope {
+	claims := auth.ClaimsFromContext(ctx)
+	if claims == nil {
+		return nil
+	}
+	return &exportScope{UserID: claims.UserID, Roles: claims.Roles, SiteIDs: claims.SiteIDs}
+}
+
+// exportContext returns ctx acting as the caller who requested the export.
+// Jobs queued before the scope was recorded run with the org-wide view they
+// were requested with.
+func (s *Server) exportContext(ctx context.Context, orgID int64, scope *exportScope) context.Context {
+	if scope == nil {
+		return ctx
+	}
+	claims := s.JWTManager.Resolve(&auth.Claims{
+		UserID: scope.UserID, OrgID: orgID, Roles: scope.Roles, SiteIDs: scope.SiteIDs,
+	})
+	ctx = context.WithValue(ctx, auth.ClaimsKey, claims)
+	ctx = context.WithValue(ctx, auth.UserIDKey, scope.UserID)
+	ctx = context.WithValue(ctx, auth.OrgIDKey, orgID)
+	return context.WithValue(ctx, auth.RolesKey, scope.Roles)
+}
+
+// exportResult is stored on a finished export job. Once the file is swept
+// after ExportRetention, Key is cleared and Expired set.
+type exportResult struct {
+	Key      string `json:"key,omitempty"`
+	Filename string `json:"filename"`
+	Rows     int    `json:"rows"`
+	Bytes    int64  `json:"bytes"`
+	Expired  bool   `json:"expired,omitempty"`
+}
+
+// exportResponse is the job view returned by the exports endpoints
+type exportResponse struct {
+	*models.Job
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+	// QueuePosition is where a queued export stands in the org's queue
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+func (s *Server) createExport(w http.ResponseWriter, r *http.Request) {
+	var in exportRequest
+	if !s.decodeOptionalJSON(w, r, &in) {
+		return
+	}
+	if in.Format == "" {
+		in.Format = "csv"
+	}
+	if _, ok := itemExportFormats[in.Format]; !ok {
+		problem.BadRequest(w, r, "format must be csv or xlsx")
+		return
+	}
+	if in.Lang == "" {
+		in.Lang = i18n.FromAcceptLanguage(r.Header.Get("Accept-Language"))
+	} else if lang, ok := i18n.Parse(in.Lang); ok {
+		in.Lang = lang
+	} else {
+		problem.BadRequest(w, r, "lang must be one of: "+i18n.Supported())
+		return
+	}
+	if in.GroupID != 0 {
+		ok, err := s.assetGroupExists(r.Context(), in.GroupID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !ok {
+			problem.BadRequest(w, r, "group_id does not name an asset group")
+			return
+		}
+	}
+
+	orgID := auth.OrgIDFromContext(r.Context())
+	userID := auth.UserIDFromContext(r.Context())
+
+	params := exportParams{exportRequest: in, Scope: callerExportScope(r.Context())}
+	job, err := s.Jobs.Enqueue(r.Context(), orgID, userID, exportItemsJob, params)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	view, err := s.exportView(r.Context(), job)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) getExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	job, err := s.Jobs.Get(r.Context(), orgID, id)
+	if err == sql.ErrNoRows || (err == nil && !isExportJob(job.Kind)) {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	view, err := s.exportView(r.Context(), job)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// downloadExport streams a finished export. It is mounted outside the JWT
+// group: the signed, expiring URL handed out by getExport is the credential,
+// so browsers can follow it directly.
+func (s *Server) downloadExport(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	orgID, _ := strconv.ParseInt(query.Get("org"), 10, 64)
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if !s.validDownloadSignature(id, orgID, expires, query.Get("sig")) {
+		problem.Write(w, r, http.StatusForbidden, "INVALID_SIGNATURE", "download link is invalid or has expired")
+		return
+	}
+
+	job, err := s.Jobs.Get(r.Context(), orgID, id)
+	if err == sql.ErrNoRows || (err == nil && (!isExportJob(job.Kind) || job.Status != models.JobSucceeded)) {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	var res exportResult
+	if err := json.Unmarshal(job.Result, &res); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if res.Expired {
+		problem.Write(w, r, http.StatusGone, "EXPORT_EXPIRED", "the export file has been deleted; request a new export")
+		return
+	}
+	obj, err := s.Storage.Open(r.Context(), res.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer obj.Close()
+
+	// ServeContent handles Range/If-Range and the conditional headers, so
+	// interrupted downloads over slow site links can resume
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", res.Filename))
+	w.Header().Set("ETag", storage.ETag(obj))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, res.Filename, obj.ModTime(), obj)
+}
+
+// isExportJob reports whether a job kind produces a downloadable export
+func isExportJob(kind string) bool {
+	return kind == exportItemsJob || kind == exportServiceNowJob
+}
+
+// exportView decorates a job with its queue position while queued, and with
+// a fresh signed download link once it has succeeded, until its file expires
+func (s *Server) exportView(ctx context.Context, job *models.Job) (exportResponse, error) {
+	view := exportResponse{Job: job}
+	if job.Status == models.JobQueued {
+		pos, err := s.Jobs.Position(ctx, job)
+		view.QueuePosition = pos
+		return view, err
+	}
+	if job.Status != models.JobSucceeded {
+		return view, nil
+	}
+	var res exportResult
+	if len(job.Result) > 0 {
+		if err := json.Unmarshal(job.Result, &res); err != nil {
+			return view, err
+		}
+	}
+	if res.Expired {
+		return view, nil
+	}
+	expires := time.Now().Add(downloadURLTTL).Truncate(time.Second)
+	view.DownloadURL = fmt.Sprintf("/exports/%d/download?org=%d&expires=%d&sig=%s",
+		job.ID, job.OrgID, expires.Unix(), s.signDownload(job.ID, job.OrgID, expires.Unix()))
+	view.DownloadExpiresAt = &expires
+	return view, nil
+}
+
+// sweepExports deletes the files of exports finished before now minus
+// ExportRetention, returning how many it deleted. The jobs stay, marked
+// expired, so polling one tells why it has no download; they go with the
+// jobs retention class. Files are unlinked from their job first, so no
+// link to a deleted file is handed out.
+func (s *Server) sweepExports(ctx context.Context, now time.Time) (int, error) {
+	if s.ExportRetention <= 0 || s.Storage == nil {
+		return 0, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		UPDATE jobs j SET result = (j.result - 'key') || '{"expired": true}'::jsonb
+		FROM (
+			SELECT id, result->>'key' AS key FROM jobs
+			WHERE kind IN ($1, $2) AND status = 'succeeded' AND finished_at < $3 AND result ? 'key'
+			FOR UPDATE SKIP LOCKED
+		) old
+		WHERE j.id = old.id
+		RETURNING old.key`, exportItemsJob, exportServiceNowJob, now.Add(-s.ExportRetention))
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, key := range keys {
+		if err := s.Storage.Delete(ctx, key); err != nil {
+			log.Printf("export sweep: deleting %s: %v", key, err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// exportSigningKey is the key of download links: EXPORT_SIGNING_KEY, else
+// one derived from JWT_SECRET, so that a link signature never doubles as a
+// token signature
+func exportSigningKey(cfg *config.Config) []byte {
+	if cfg.ExportSigningKey != "" {
+		return []byte(cfg.ExportSigningKey)
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.JWTSecret))
+	mac.Write([]byte("era-inventory-api export downloads"))
+	return mac.Sum(nil)
+}
+
+func (s *Server) signDownload(id, orgID, expires int64) string {
+	mac := hmac.New(sha256.New, s.downloadKey)
+	fmt.Fprintf(mac, "export:%d:%d:%d", id, orgID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) validDownloadSignature(id, orgID, expires int64, sig string) bool {
+	if orgID <= 0 || expires < time.Now().Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.signDownload(id, orgID, expires)))
+}
+
+// runItemsExport is the job handler writing the items the requester may see
+// to storage as CSV or XLSX
+func (s *Server) runItemsExport(ctx context.Context, job *models.Job) (interface{}, error) {
+	var in exportParams
+	if err := json.Unmarshal(job.Params, &in); err != nil {
+		return nil, fmt.Errorf("invalid export params: %w", err)
+	}
+	ctx = s.exportContext(ctx, job.OrgID, in.Scope)
+
+	conn, ctx, err := withDBConn(ctx, s.DB, job.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseDBConn(conn)
+
+	sqlStr := `
+		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
+		       installed_at, warranty_end, notes, created_at, updated_at
+		FROM inventory WHERE org_id = $1 AND deleted_at IS NULL`
+	args := []interface{}{job.OrgID}
+	if in.Q != "" {
+		sqlStr += " AND (name ILIKE $2 OR asset_tag ILIKE $2)"
+		args = append(args, "%"+in.Q+"%")
+	}
+	if in.GroupID != 0 {
+		sqlStr += " AND " + assetGroupMatch(fmt.Sprintf("$%d", len(args)+1), "inventory")
+		args = append(args, in.GroupID)
+	}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", len(args)+1); clause != "" {
+		sqlStr += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+	sqlStr += " ORDER BY id"
+
+	q := dbFrom(ctx, s.DB)
+	rows, err := q.QueryContext(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// jobs queued before xlsx was offered have no format
+	format := in.Format
+	if format == "" {
+		format = "csv"
+	}
+	res := exportResult{
+		Key:      fmt.Sprintf("exports/%d/%d.%s", job.OrgID, job.ID, format),
+		Filename: fmt.Sprintf("items-export-%d.%s", job.ID, format),
+	}
+	var anon *anonymizer
+	if in.Anonymize {
+		if anon, err = newAnonymizer(); err != nil {
+			return nil, err
+		}
+		res.Filename = fmt.Sprintf("items-export-%d-anonymized.%s", job.ID, format)
+	}
+
+	// Stream rows straight into storage instead of buffering the whole file
+	pr, pw := io.Pipe()
+	written := make(chan int, 1)
+	go func() {
+		var out rowWriter = csvRows{csv.NewWriter(pw)}
+		if format == "xlsx" {
+			xw, err := xlsx.NewWriterLayout(pw, "Items", exportLayout)
+			if err != nil {
+				written <- 0
+				pw.CloseWithError(err)
+				return
+			}
+			out = xw
+		}
+		n, err := writeExportRows(out, rows, anon, in.Lang)
+		if err == nil {
+			err = out.Close()
+		}
+		written <- n
+		pw.CloseWithError(err)
+	}()
+	res.Bytes, err = s.Storage.Put(ctx, res.Key, pr)
+	pr.CloseWithError(err)
+	res.Rows = <-written
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// exportColumns is the header row of POST /exports files
+var exportColumns = []string{
+	"id", "asset_tag", "name", "manufacturer", "model", "device_type", "site",
+	"installed_at", "warranty_end", "notes", "created_at", "updated_at",
+}
+
+// exportLayout is itemExportLayout without the status column
+var exportLayout = xlsx.Layout{
+	Widths:     []float64{8, 16, 30, 18, 18, 14, 20, 12, 12, 40, 21, 21},
+	FreezeRows: 1,
+}
+
+// writeExportRows writes a header in lang and one row per item, returning
+// the row count; the caller closes out. A non-nil anon scrubs each row.
+func writeExportRows(out rowWriter, rows *sql.Rows, anon *anonymizer, lang string) (int, error) {
+	writeHeader := out.WriteRow
+	if h, ok := out.(interface{ WriteHeader([]string) error }); ok {
+		writeHeader = h.WriteHeader
+	}
+	if err := writeHeader(i18n.Headers(lang, exportColumns)); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(
+			&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
+			&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes, &it.CreatedAt, &it.UpdatedAt,
+		); err != nil {
+			return n, err
+		}
+		if anon != nil {
+			it.Name, it.Site = anon.text(it.Name), anon.text(it.Site)
+			it.Notes = anon.note(it.Notes)
+		}
+		if err := out.WriteRow([]string{
+			strconv.Itoa(it.ID), it.AssetTag, it.Name, it.Manufacturer, it.Model, it.DeviceType, it.Site,
+			formatDate(it.InstalledAt), formatDate(it.WarrantyEnd), it.Notes,
+			it.CreatedAt.Format(time.RFC3339), it.UpdatedAt.Format(time.RFC3339),
+		}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// formatDate renders an optional date column as YYYY-MM-DD
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
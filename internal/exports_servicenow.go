@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// exportServiceNowJob is the job kind producing a ServiceNow CMDB import set
+const exportServiceNowJob = "export.servicenow"
+
+// serviceNowClasses maps item device types to ServiceNow CI classes.
+// Anything not listed is exported as generic hardware.
+var serviceNowClasses = map[string]string{
+	"switch":       "cmdb_ci_ip_switch",
+	"router":       "cmdb_ci_ip_router",
+	"firewall":     "cmdb_ci_ip_firewall",
+	"access point": "cmdb_ci_wap_network",
+	"ap":           "cmdb_ci_wap_network",
+	"server":       "cmdb_ci_server",
+	"ups":          "cmdb_ci_ups",
+	"printer":      "cmdb_ci_printer",
+}
+
+// serviceNowClass returns the CI class for an item device type
+func serviceNowClass(deviceType string) string {
+	if class, ok := serviceNowClasses[strings.ToLower(strings.TrimSpace(deviceType))]; ok {
+		return class
+	}
+	return "cmdb_ci_hardware"
+}
+
+// serviceNowRecord is one row of the import set. correlation_id is stable
+// across exports so a transform map can coalesce on it.
+type serviceNowRecord struct {
+	SysClassName       string `json:"sys_class_name"`
+	CorrelationID      string `json:"correlation_id"`
+	Name               string `json:"name"`
+	AssetTag           string `json:"asset_tag,omitempty"`
+	Manufacturer       string `json:"manufacturer,omitempty"`
+	ModelID            string `json:"model_id,omitempty"`
+	Location           string `json:"location,omitempty"`
+	Street             string `json:"street,omitempty"`
+	InstallDate        string `json:"install_date,omitempty"`
+	WarrantyExpiration string `json:"warranty_expiration,omitempty"`
+	Comments           string `json:"comments,omitempty"`
+}
+
+func (s *Server) createServiceNowExport(w http.ResponseWriter, r *http.Request) {
+	orgID := auth.OrgIDFromContext(r.Context())
+	userID := auth.UserIDFromContext(r.Context())
+
+	params := exportParams{Scope: callerExportScope(r.Context())}
+	job, err := s.Jobs.Enqueue(r.Context(), orgID, userID, exportServiceNowJob, params)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	view, err := s.exportView(r.Context(), job)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// runServiceNowExport is the job handler writing the sites (as cmn_location)
+// and items (as CIs) the requester may see to storage in import set JSON
+// format
+func (s *Server) runServiceNowExport(ctx context.Context, job *models.Job) (interface{}, error) {
+	var in exportParams
+	if err := json.Unmarshal(job.Params, &in); err != nil {
+		return nil, fmt.Errorf("invalid export params: %w", err)
+	}
+	ctx = s.exportContext(ctx, job.OrgID, in.Scope)
+
+	conn, ctx, err := withDBConn(ctx, s.DB, job.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseDBConn(conn)
+
+	res := exportResult{
+		Key:      fmt.Sprintf("exports/%d/%d.json", job.OrgID, job.ID),
+		Filename: fmt.Sprintf("servicenow-export-%d.json", job.ID),
+	}
+
+	pr, pw := io.Pipe()
+	written := make(chan int, 1)
+	go func() {
+		n, err := s.writeServiceNowImportSet(ctx, pw, job.OrgID)
+		written <- n
+		pw.CloseWithError(err)
+	}()
+	res.Bytes, err = s.Storage.Put(ctx, res.Key, pr)
+	pr.CloseWithError(err)
+	res.Rows = <-written
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// writeServiceNowImportSet writes {"records":[...]} and returns the record count
+func (s *Server) writeServiceNowImportSet(ctx context.Context, w io.Writer, orgID int64) (int, error) {
+	q := dbFrom(ctx, s.DB)
+	n := 0
+	emit := func(rec serviceNowRecord) error {
+		sep := ","
+		if n == 0 {
+			sep = ""
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep+"\n"+string(b)); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}
+
+	if _, err := io.WriteString(w, `{"records":[`); err != nil {
+		return 0, err
+	}
+
+	siteSQL := `SELECT id, name, location, notes FROM sites WHERE org_id = $1 AND deleted_at IS NULL`
+	siteArgs := []interface{}{orgID}
+	if clause, accessArgs := siteRowAccessClause(ctx, "sites", 2); clause != "" {
+		siteSQL += " AND " + clause
+		siteArgs = append(siteArgs, accessArgs...)
+	}
+	sites, err := q.QueryContext(ctx, siteSQL+" ORDER BY id", siteArgs...)
+	if err != nil {
+		return n, err
+	}
+	for sites.Next() {
+		var st models.Site
+		if err := sites.Scan(&st.ID, &st.Name, &st.Location, &st.Notes); err != nil {
+			sites.Close()
+			return n, err
+		}
+		rec := serviceNowRecord{
+			SysClassName:  "cmn_location",
+			CorrelationID: fmt.Sprintf("era:site:%d", st.ID),
+			Name:          st.Name,
+		}
+		if st.Location != nil {
+			rec.Street = *st.Location
+		}
+		if st.Notes != nil {
+			rec.Comments = *st.Notes
+		}
+		if err := emit(rec); err != nil {
+			sites.Close()
+			return n, err
+		}
+	}
+	sites.Close()
+	if err := sites.Err(); err != nil {
+		return n, err
+	}
+
+	itemSQL := `
+		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
+		       installed_at, warranty_end, notes
+		FROM inventory WHERE org_id = $1 AND deleted_at IS NULL`
+	itemArgs := []interface{}{orgID}
+	if clause, accessArgs := siteAccessClause(ctx, "inventory", 2); clause != "" {
+		itemSQL += " AND " + clause
+		itemArgs = append(itemArgs, accessArgs...)
+	}
+	items, err := q.QueryContext(ctx, itemSQL+" ORDER BY id", itemArgs...)
+	if err != nil {
+		return n, err
+	}
+	defer items.Close()
+	for items.Next() {
+		var it models.Item
+		if err := items.Scan(&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
+			&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes); err != nil {
+			return n, err
+		}
+		if err := emit(serviceNowItem(it)); err != nil {
+			return n, err
+		}
+	}
+	if err := items.Err(); err != nil {
+		return n, err
+	}
+
+	_, err = io.WriteString(w, "\n]}\n")
+	return n, err
+}
+
+// serviceNowItem maps an inventory item to an import set record
+func serviceNowItem(it models.Item) serviceNowRecord {
+	return serviceNowRecord{
+		SysClassName:       serviceNowClass(it.DeviceType),
+		CorrelationID:      fmt.Sprintf("era:item:%d", it.ID),
+		Name:               it.Name,
+		AssetTag:           it.AssetTag,
+		Manufacturer:       it.Manufacturer,
+		ModelID:            it.Model,
+		Location:           it.Site,
+		InstallDate:        formatDate(it.InstalledAt),
+		WarrantyExpiration: formatDate(it.WarrantyEnd),
+		Comments:           it.Notes,
+	}
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/testutil"
+)
+
+func TestExportDownloadSignature(t *testing.T) {
+	s := &Server{downloadKey: []byte("test-signing-key-that-is-long-enough")}
+	expires := time.Now().Add(time.Minute).Unix()
+	sig := s.signDownload(7, 1, expires)
+
+	if !s.validDownloadSignature(7, 1, expires, sig) {
+		t.Error("Expected signature to validate")
+	}
+	if s.validDownloadSignature(8, 1, expires, sig) {
+		t.Error("Signature must not validate for another job")
+	}
+	if s.validDownloadSignature(7, 2, expires, sig) {
+		t.Error("Signature must not validate for another org")
+	}
+	if s.validDownloadSignature(7, 1, expires+1, sig) {
+		t.Error("Signature must not validate for a different expiry")
+	}
+
+	past := time.Now().Add(-time.Minute).Unix()
+	if s.validDownloadSignature(7, 1, past, s.signDownload(7, 1, past)) {
+		t.Error("Expired link must not validate")
+	}
+}
+
+func TestExportSigningKey(t *testing.T) {
+	secret := "jwt-secret-that-is-long-enough-for-hs256"
+	derived := exportSigningKey(&config.Config{JWTSecret: secret})
+	if len(derived) == 0 || string(derived) == secret {
+		t.Errorf("download links must not be signed with JWT_SECRET itself, got %q", derived)
+	}
+	if other := exportSigningKey(&config.Config{JWTSecret: secret + "2"}); string(other) == string(derived) {
+		t.Error("derived key does not depend on JWT_SECRET")
+	}
+	key := "export-signing-key-that-is-long-enough"
+	if got := exportSigningKey(&config.Config{JWTSecret: secret, ExportSigningKey: key}); string(got) != key {
+		t.Errorf("EXPORT_SIGNING_KEY ignored, got %q", got)
+	}
+}
+
+func TestCreateExportFormats(t *testing.T) {
+	w := serveAs(1, "POST", "/exports", "/exports", `{"format":"pdf"}`, (&Server{}).createExport)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "csv or xlsx") {
+		t.Errorf("pdf export = %d: %s", w.Code, w.Body.String())
+	}
+	if len(exportLayout.Widths) != len(exportColumns) {
+		t.Errorf("%d column widths for %d columns", len(exportLayout.Widths), len(exportColumns))
+	}
+}
+
+func TestExportViewDownloadURL(t *testing.T) {
+	s := &Server{downloadKey: []byte("test-signing-key-that-is-long-enough")}
+
+	for _, status := range []string{models.JobRunning, models.JobFailed} {
+		view, err := s.exportView(context.Background(), &models.Job{ID: 3, OrgID: 1, Status: status})
+		if err != nil || view.DownloadURL != "" || view.QueuePosition != 0 {
+			t.Errorf("%s export must have neither a download URL nor a queue position, got %+v (%v)", status, view, err)
+		}
+	}
+
+	done, err := s.exportView(context.Background(), &models.Job{ID: 3, OrgID: 1, Status: models.JobSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(done.DownloadURL)
+	if err != nil {
+		t.Fatalf("Invalid download URL %q: %v", done.DownloadURL, err)
+	}
+	if u.Path != "/exports/3/download" {
+		t.Errorf("Unexpected download path %s", u.Path)
+	}
+	expires, _ := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if !s.validDownloadSignature(3, 1, expires, u.Query().Get("sig")) {
+		t.Error("Download URL signature should validate")
+	}
+
+	swept, err := s.exportView(context.Background(), &models.Job{ID: 3, OrgID: 1, Status: models.JobSucceeded,
+		Result: json.RawMessage(`{"filename":"items-export-3.csv","rows":2,"bytes":90,"expired":true}`)})
+	if err != nil || swept.DownloadURL != "" {
+		t.Errorf("expired export must have no download URL, got %+v (%v)", swept, err)
+	}
+}
+
+func TestExportContextScope(t *testing.T) {
+	s := &Server{}
+	req := testutil.AsUser(httptest.NewRequest("POST", "/exports", nil), 1, 9, "viewer")
+	scope := callerExportScope(req.Context())
+	scope.SiteIDs = []int64{4}
+
+	// the job only has the params to go by, as a round trip through the queue
+	raw, err := json.Marshal(exportParams{exportRequest: exportRequest{Format: "csv"}, Scope: scope})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var params exportParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		t.Fatal(err)
+	}
+	ctx := s.exportContext(context.Background(), 1, params.Scope)
+	clause, args := siteAccessClause(ctx, "inventory", 2)
+	if !strings.Contains(clause, "a.user_id = $2") || !strings.Contains(clause, "ANY($3)") {
+		t.Errorf("Expected the requester's grants and token sites, got %q", clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(9), []int64{4}}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+	if clause, _ := siteRowAccessClause(ctx, "sites", 2); !strings.Contains(clause, "sites.id = ANY($3)") {
+		t.Errorf("Expected sites narrowed to the token's, got %q", clause)
+	}
+
+	admin := s.exportContext(context.Background(), 1, &exportScope{UserID: 1, Roles: []string{"org_admin"}})
+	if clause, _ := siteAccessClause(admin, "inventory", 2); clause != "" {
+		t.Errorf("org_admin exports must not be restricted, got %q", clause)
+	}
+}
+
+func TestServiceNowClass(t *testing.T) {
+	cases := map[string]string{
+		"Switch":   "cmdb_ci_ip_switch",
+		" router ": "cmdb_ci_ip_router",
+		"server":   "cmdb_ci_server",
+		"":         "cmdb_ci_hardware",
+		"camera":   "cmdb_ci_hardware",
+	}
+	for deviceType, want := range cases {
+		if got := serviceNowClass(deviceType); got != want {
+			t.Errorf("serviceNowClass(%q) = %s, want %s", deviceType, got, want)
+		}
+	}
+}
+
+func TestServiceNowItem(t *testing.T) {
+	warranty := time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC)
+	rec := serviceNowItem(models.Item{
+		ID: 42, AssetTag: "ERA-042", Name: "core-sw-1", DeviceType: "switch",
+		Site: "HQ", WarrantyEnd: &warranty,
+	})
+	if rec.CorrelationID != "era:item:42" {
+		t.Errorf("Unexpected correlation_id %s", rec.CorrelationID)
+	}
+	if rec.SysClassName != "cmdb_ci_ip_switch" || rec.Location != "HQ" {
+		t.Errorf("Unexpected mapping %+v", rec)
+	}
+	if rec.WarrantyExpiration != "2027-03-01" || rec.InstallDate != "" {
+		t.Errorf("Unexpected dates %+v", rec)
+	}
+}
@@ -0,0 +1,162 @@
+// Package health lets components register readiness checks, reported
+// together with their latency by the /readyz endpoint. Liveness (/healthz)
+// runs no checks: a slow database must not get the process restarted.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status values reported for checks and the overall result
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Checker reports whether a dependency is usable; it must honour ctx cancellation
+type Checker func(ctx context.Context) error
+
+// Result is the outcome of a single check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the combined outcome of all checks run
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+type namedChecker struct {
+	name  string
+	check Checker
+}
+
+// Registry holds the checks registered by components
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedChecker
+}
+
+// NewRegistry creates a registry running each check with the given timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a named check. Registering a name twice replaces the check.
+func (r *Registry) Register(name string, check Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i].check = check
+			return
+		}
+	}
+	r.checks = append(r.checks, namedChecker{name: name, check: check})
+}
+
+// Run executes the named checks (all when none are given) concurrently
+func (r *Registry) Run(ctx context.Context, names ...string) Report {
+	r.mu.RLock()
+	var selected []namedChecker
+	for _, c := range r.checks {
+		if len(names) == 0 || contains(names, c.name) {
+			selected = append(selected, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(selected))}
+	var wg sync.WaitGroup
+	for i, c := range selected {
+		wg.Add(1)
+		go func(i int, c namedChecker) {
+			defer wg.Done()
+			report.Checks[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		if res.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c namedChecker) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	res := Result{
+		Name:      c.name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// Handler serves a JSON report of the named checks (all when none are
+// given), with 503 Service Unavailable when any of them fails. Error messages
+// can name hosts and paths, so only serve it on the admin listener.
+func (r *Registry) Handler(names ...string) http.Handler {
+	return r.handler(false, names)
+}
+
+// PublicHandler is Handler without the checks' error messages, for the
+// public listener's load balancer probes
+func (r *Registry) PublicHandler(names ...string) http.Handler {
+	return r.handler(true, names)
+}
+
+func (r *Registry) handler(redact bool, names []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := r.Run(req.Context(), names...)
+		if redact {
+			for i := range report.Checks {
+				report.Checks[i].Error = ""
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// LiveHandler serves the liveness report: ok whenever the process can answer
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(Report{Status: StatusOK, Checks: []Result{}})
+	})
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistryReport(t *testing.T) {
+	reg := NewRegistry(50 * time.Millisecond)
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	reg.Register("storage", func(ctx context.Context) error { return errors.New("read-only file system") })
+	reg.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	w := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when a check fails, got %d", w.Code)
+	}
+
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if report.Status != StatusFail || len(report.Checks) != 3 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+	want := map[string]string{"db": StatusOK, "storage": StatusFail, "slow": StatusFail}
+	for _, res := range report.Checks {
+		if res.Status != want[res.Name] {
+			t.Errorf("Check %s: expected %s, got %s", res.Name, want[res.Name], res.Status)
+		}
+	}
+	if report.Checks[2].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected slow check to time out, got %q", report.Checks[2].Error)
+	}
+}
+
+func TestRegistryHandlerSubset(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	reg.Register("storage", func(ctx context.Context) error { return errors.New("down") })
+
+	w := httptest.NewRecorder()
+	reg.Handler("db").ServeHTTP(w, httptest.NewRequest("GET", "/dbping", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for healthy subset, got %d", w.Code)
+	}
+
+	// Re-registering replaces the check
+	reg.Register("storage", func(ctx context.Context) error { return nil })
+	if report := reg.Run(context.Background()); report.Status != StatusOK || len(report.Checks) != 2 {
+		t.Errorf("Unexpected report after replacing check: %+v", report)
+	}
+}
+
+func TestLiveHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+	if w.Code != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("Expected 200 ok, got %d %+v", w.Code, report)
+	}
+}
+
+func TestMonitorTransitions(t *testing.T) {
+	var dbErr error
+	reg := NewRegistry(time.Second)
+	reg.Register("db", func(ctx context.Context) error { return dbErr })
+	reg.Register("jobs", func(ctx context.Context) error { return errors.New("120 jobs queued") })
+	m := NewMonitor(reg, time.Minute)
+	var seen []Transition
+	m.Subscribe(func(tr Transition) { seen = append(seen, tr) })
+
+	if page := m.Status(); page.Status != StatusUnknown || len(page.Components) != 0 {
+		t.Errorf("Expected unknown status before the first poll, got %+v", page)
+	}
+
+	// Only components failing from the start are reported on the first poll
+	if got := m.Poll(context.Background()); len(got) != 1 || got[0].Component != "jobs" || got[0].From != StatusUnknown {
+		t.Errorf("Unexpected first poll transitions %+v", got)
+	}
+	page := m.Status()
+	if page.Status != StatusDegraded || len(page.Components) != 2 || page.CheckedAt == nil {
+		t.Errorf("Expected degraded page with 2 components, got %+v", page)
+	}
+	since := page.Components[0].Since
+
+	if got := m.Poll(context.Background()); len(got) != 0 {
+		t.Errorf("Expected no transitions without changes, got %+v", got)
+	}
+	dbErr = errors.New("connection refused")
+	got := m.Poll(context.Background())
+	if len(got) != 1 || got[0].Component != "db" || got[0].From != StatusOK || got[0].To != StatusFail || got[0].Error != "connection refused" {
+		t.Errorf("Unexpected transitions %+v", got)
+	}
+	if c := m.Status().Components[0]; !c.Since.After(since) {
+		t.Errorf("Expected db since to move with the transition, got %v", c.Since)
+	}
+	if len(seen) != 2 {
+		t.Errorf("Expected subscribers to see 2 transitions, got %+v", seen)
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/status.json", nil))
+	if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("connection refused")) {
+		t.Errorf("Expected 200 without error details, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMonitorStartStop(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.Register("db", func(ctx context.Context) error { return nil })
+	m := NewMonitor(reg, time.Hour)
+	polled := make(chan struct{})
+	m.Start()
+	go func() {
+		for m.Status().Status == StatusUnknown {
+			time.Sleep(time.Millisecond)
+		}
+		close(polled)
+	}()
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Start to poll right away")
+	}
+	m.Stop()
+	m.Stop()
+}
+
+func TestPublicHandlerHidesErrors(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.Register("db", func(ctx context.Context) error { return errors.New("dial tcp 10.0.3.7:5432: connection refused") })
+
+	w := httptest.NewRecorder()
+	reg.PublicHandler().ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when a check fails, got %d", w.Code)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("10.0.3.7")) || bytes.Contains(w.Body.Bytes(), []byte(`"error"`)) {
+		t.Errorf("Public report leaks the error: %s", w.Body)
+	}
+	var report Report
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil || report.Checks[0].Status != StatusFail {
+		t.Errorf("Unexpected public report %+v (%v)", report, err)
+	}
+}
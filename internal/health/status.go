@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Overall states of the status page
+const (
+	StatusDegraded = "degraded"
+	StatusUnknown  = "unknown"
+)
+
+// Component is the last observed state of one check and when it began
+type Component struct {
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+	Since  time.Time `json:"since"`
+}
+
+// Transition is a component changing state. A component failing when first
+// checked is a transition from unknown.
+type Transition struct {
+	Component string    `json:"component"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// StatusPage is the public summary of all components. It carries no error
+// messages, which may name internal hosts.
+type StatusPage struct {
+	Status     string      `json:"status"`
+	CheckedAt  *time.Time  `json:"checked_at,omitempty"`
+	Components []Component `json:"components"`
+}
+
+// Monitor runs the checks of a registry every interval and keeps the state
+// of each, so a status page can be served without running checks per
+// request. Transitions are passed to the subscribers.
+type Monitor struct {
+	reg      *Registry
+	interval time.Duration
+
+	mu        sync.Mutex
+	order     []string
+	state     map[string]Component
+	checkedAt time.Time
+	subs      []func(Transition)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMonitor checks reg every interval once started
+func NewMonitor(reg *Registry, interval time.Duration) *Monitor {
+	return &Monitor{reg: reg, interval: interval, state: map[string]Component{}}
+}
+
+// Subscribe calls fn for every transition, from the monitor's goroutine
+func (m *Monitor) Subscribe(fn func(Transition)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs = append(m.subs, fn)
+}
+
+// Poll runs every check once, records the results and notifies the
+// subscribers of the transitions, which it also returns
+func (m *Monitor) Poll(ctx context.Context) []Transition {
+	report := m.reg.Run(ctx)
+	now := time.Now()
+
+	m.mu.Lock()
+	var changes []Transition
+	for _, res := range report.Checks {
+		prev, seen := m.state[res.Name]
+		if seen && prev.Status == res.Status {
+			continue
+		}
+		if !seen {
+			m.order = append(m.order, res.Name)
+		}
+		m.state[res.Name] = Component{Name: res.Name, Status: res.Status, Since: now}
+		if seen || res.Status != StatusOK {
+			from := StatusUnknown
+			if seen {
+				from = prev.Status
+			}
+			changes = append(changes, Transition{Component: res.Name, From: from, To: res.Status, Error: res.Error, At: now})
+		}
+	}
+	m.checkedAt = now
+	subs := append([]func(Transition){}, m.subs...)
+	m.mu.Unlock()
+
+	for _, t := range changes {
+		for _, fn := range subs {
+			fn(t)
+		}
+	}
+	return changes
+}
+
+// Status summarizes the last poll: ok when every component is, degraded
+// when any fails, unknown before the first poll
+func (m *Monitor) Status() StatusPage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	page := StatusPage{Status: StatusUnknown, Components: make([]Component, 0, len(m.order))}
+	if m.checkedAt.IsZero() {
+		return page
+	}
+	checkedAt := m.checkedAt
+	page.Status, page.CheckedAt = StatusOK, &checkedAt
+	for _, name := range m.order {
+		c := m.state[name]
+		if c.Status != StatusOK {
+			page.Status = StatusDegraded
+		}
+		page.Components = append(page.Components, c)
+	}
+	return page
+}
+
+// Handler serves Status as JSON; it always answers 200, the page being
+// about other components than this process
+func (m *Monitor) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=15")
+		_ = json.NewEncoder(w).Encode(m.Status())
+	})
+}
+
+// Start polls right away and then every interval until Stop; a zero
+// interval leaves it stopped
+func (m *Monitor) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.interval <= 0 || m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			// each check is bounded by the registry's timeout
+			m.Poll(context.Background())
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(m.stop, m.done)
+}
+
+// Stop ends the loop started by Start and waits for the current poll. The
+// lock is released first, as the poll takes it too.
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	stop, done := m.stop, m.done
+	m.stop = nil
+	m.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
@@ -0,0 +1,144 @@
+// Package i18n translates the column headers of exports and reports.
+package i18n
+
+import (
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Default is the language of untranslated output. Its headers are the field
+// names themselves, which scripts reading the files rely on.
+const Default = "en"
+
+// Languages lists the supported languages, Default first
+var Languages = []string{Default, "de", "fr", "es"}
+
+// matcher picks the closest supported language, e.g. de for de-AT
+var matcher = language.NewMatcher([]language.Tag{
+	language.English, language.German, language.French, language.Spanish,
+})
+
+// headers are the translations of the header keys, by language. A key
+// without a translation is written as is.
+var headers = map[string]map[string]string{
+	"de": {
+		"id":               "ID",
+		"asset_tag":        "Inventarnummer",
+		"name":             "Name",
+		"manufacturer":     "Hersteller",
+		"model":            "Modell",
+		"device_type":      "Gerätetyp",
+		"site":             "Standort",
+		"status":           "Status",
+		"installed_at":     "Installiert am",
+		"warranty_end":     "Garantieende",
+		"notes":            "Notizen",
+		"created_at":       "Erstellt am",
+		"updated_at":       "Geändert am",
+		"vendor":           "Lieferant",
+		"support_contract": "Supportvertrag",
+		"support_level":    "Supportstufe",
+		"support_end":      "Supportende",
+		"coverage_end":     "Abdeckungsende",
+		"days_left":        "Verbleibende Tage",
+		"total":            "Gesamt",
+		"unknown":          "unbekannt",
+	},
+	"fr": {
+		"id":               "ID",
+		"asset_tag":        "Numéro d'inventaire",
+		"name":             "Nom",
+		"manufacturer":     "Fabricant",
+		"model":            "Modèle",
+		"device_type":      "Type d'appareil",
+		"site":             "Site",
+		"status":           "Statut",
+		"installed_at":     "Installé le",
+		"warranty_end":     "Fin de garantie",
+		"notes":            "Notes",
+		"created_at":       "Créé le",
+		"updated_at":       "Modifié le",
+		"vendor":           "Fournisseur",
+		"support_contract": "Contrat de support",
+		"support_level":    "Niveau de support",
+		"support_end":      "Fin du support",
+		"coverage_end":     "Fin de couverture",
+		"days_left":        "Jours restants",
+		"total":            "Total",
+		"unknown":          "inconnu",
+	},
+	"es": {
+		"id":               "ID",
+		"asset_tag":        "Etiqueta de activo",
+		"name":             "Nombre",
+		"manufacturer":     "Fabricante",
+		"model":            "Modelo",
+		"device_type":      "Tipo de dispositivo",
+		"site":             "Sede",
+		"status":           "Estado",
+		"installed_at":     "Instalado el",
+		"warranty_end":     "Fin de garantía",
+		"notes":            "Notas",
+		"created_at":       "Creado el",
+		"updated_at":       "Actualizado el",
+		"vendor":           "Proveedor",
+		"support_contract": "Contrato de soporte",
+		"support_level":    "Nivel de soporte",
+		"support_end":      "Fin del soporte",
+		"coverage_end":     "Fin de cobertura",
+		"days_left":        "Días restantes",
+		"total":            "Total",
+		"unknown":          "desconocido",
+	},
+}
+
+// Parse returns the supported language named by lang, a BCP 47 tag such as
+// "de" or "fr-CH", and false when it is malformed or not supported
+func Parse(lang string) (string, bool) {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return "", false
+	}
+	_, i, conf := matcher.Match(tag)
+	if conf < language.High {
+		return "", false
+	}
+	return Languages[i], true
+}
+
+// FromAcceptLanguage returns the supported language best matching an
+// Accept-Language header, or Default
+func FromAcceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return Default
+	}
+	_, i, conf := matcher.Match(tags...)
+	if conf < language.High {
+		return Default
+	}
+	return Languages[i]
+}
+
+// Header translates one header key into lang
+func Header(lang, key string) string {
+	if h, ok := headers[lang][key]; ok {
+		return h
+	}
+	return key
+}
+
+// Headers translates a header row into lang
+func Headers(lang string, keys []string) []string {
+	out := make([]string, len(keys))
+	for i, key := range keys {
+		out[i] = Header(lang, key)
+	}
+	return out
+}
+
+// Supported lists the supported languages for error messages
+func Supported() string {
+	return strings.Join(Languages, ", ")
+}
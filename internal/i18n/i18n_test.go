@@ -0,0 +1,52 @@
+package i18n
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for lang, want := range map[string]string{"de": "de", "de-AT": "de", "fr-CH": "fr", "es-419": "es", "en-GB": "en", "it": "", "x!": ""} {
+		got, ok := Parse(lang)
+		if got != want || ok != (want != "") {
+			t.Errorf("Parse(%q) = %q, %v; want %q", lang, got, ok, want)
+		}
+	}
+}
+
+func TestFromAcceptLanguage(t *testing.T) {
+	for header, want := range map[string]string{
+		"":                        Default,
+		"de-DE,de;q=0.9,en;q=0.8": "de",
+		"it,fr;q=0.5":             "fr",
+		"pt-BR":                   Default,
+		"not a header;;":          Default,
+	} {
+		if got := FromAcceptLanguage(header); got != want {
+			t.Errorf("FromAcceptLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	keys := []string{"asset_tag", "warranty_end", "0-1y"}
+	if got := Headers(Default, keys); !reflect.DeepEqual(got, keys) {
+		t.Errorf("Default headers must be the keys, got %v", got)
+	}
+	if got := Headers("fr", keys); !reflect.DeepEqual(got, []string{"Numéro d'inventaire", "Fin de garantie", "0-1y"}) {
+		t.Errorf("Unexpected French headers %v", got)
+	}
+}
+
+// every language translates the same keys, so a header never mixes languages
+func TestCatalogsComplete(t *testing.T) {
+	for lang, catalog := range headers {
+		for other, keys := range headers {
+			for key := range keys {
+				if _, ok := catalog[key]; !ok {
+					t.Errorf("%s lacks %q, which %s translates", lang, key, other)
+				}
+			}
+		}
+	}
+}
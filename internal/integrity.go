@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// integritySampleSize caps the item IDs listed per finding
+const integritySampleSize = 100
+
+// integrityCheck finds inventory rows matching cond (alias i, $1 = org) and
+// optionally repairs them with set. Checks run and repair in order, so an
+// earlier repair can make rows eligible for a later one.
+type integrityCheck struct {
+	name        string
+	description string
+	repair      string
+	cond        string
+	set         string
+}
+
+var integrityChecks = []integrityCheck{
+	{
+		name:        "items_foreign_site",
+		description: "Items whose site_id points to a site that is missing or belongs to another organization",
+		repair:      "clear site_id",
+		cond:        "i.site_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sites s WHERE s.id = i.site_id AND s.org_id = i.org_id)",
+		set:         "site_id = NULL",
+	},
+	{
+		name:        "items_foreign_vendor",
+		description: "Items whose vendor_id points to a vendor that is missing or belongs to another organization",
+		repair:      "clear vendor_id",
+		cond:        "i.vendor_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM vendors v WHERE v.id = i.vendor_id AND v.org_id = i.org_id)",
+		set:         "vendor_id = NULL",
+	},
+	{
+		name:        "items_foreign_project",
+		description: "Items whose project_id points to a project that is missing or belongs to another organization",
+		repair:      "clear project_id",
+		cond:        "i.project_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM projects p WHERE p.id = i.project_id AND p.org_id = i.org_id)",
+		set:         "project_id = NULL",
+	},
+	{
+		name:        "items_unlinked_site",
+		description: "Items naming a site that exists but without site_id set",
+		repair:      "set site_id to the site with that name",
+		cond:        "i.site_id IS NULL AND EXISTS (SELECT 1 FROM sites s WHERE s.org_id = i.org_id AND s.deleted_at IS NULL AND lower(s.name) = lower(i.site))",
+		set:         "site_id = (SELECT min(s.id) FROM sites s WHERE s.org_id = i.org_id AND s.deleted_at IS NULL AND lower(s.name) = lower(i.site))",
+	},
+	{
+		name:        "items_unknown_site",
+		description: "Items naming a site that does not exist in the organization",
+		repair:      "create the site or correct the item's site (manual)",
+		cond:        "i.site_id IS NULL AND COALESCE(i.site, '') <> '' AND NOT EXISTS (SELECT 1 FROM sites s WHERE s.org_id = i.org_id AND s.deleted_at IS NULL AND lower(s.name) = lower(i.site))",
+	},
+}
+
+// integrityFinding is one check's result in the integrity report
+type integrityFinding struct {
+	Check       string `json:"check"`
+	Description string `json:"description"`
+	Count       int    `json:"count"`
+	ItemIDs     []int  `json:"item_ids"`
+	Repair      string `json:"repair"`
+	Fixable     bool   `json:"fixable"`
+}
+
+// integrityReport is the response of the /admin/integrity endpoints
+type integrityReport struct {
+	Findings []integrityFinding `json:"findings"`
+	Repaired map[string]int64   `json:"repaired,omitempty"`
+}
+
+// getIntegrity reports inconsistencies in the caller's organization without changing anything
+func (s *Server) getIntegrity(w http.ResponseWriter, r *http.Request) {
+	report, err := s.integrityReport(r.Context())
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// repairIntegrity applies every automatic repair and returns the report
+// afterwards. Repairs and report run in one transaction: a failed repair
+// undoes the earlier ones, and the report shows exactly what was committed.
+func (s *Server) repairIntegrity(w http.ResponseWriter, r *http.Request) {
+	orgID := auth.OrgIDFromContext(r.Context())
+	tx, err := beginTx(r.Context(), s.DB)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	repaired := map[string]int64{}
+	for _, c := range integrityChecks {
+		if c.set == "" {
+			continue
+		}
+		res, err := tx.ExecContext(r.Context(),
+			"UPDATE inventory AS i SET "+c.set+" WHERE i.org_id = $1 AND "+c.cond, orgID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		repaired[c.name] = n
+	}
+
+	report, err := integrityReportFrom(r.Context(), tx)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	report.Repaired = repaired
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) integrityReport(ctx context.Context) (*integrityReport, error) {
+	return integrityReportFrom(ctx, dbFrom(ctx, s.DB))
+}
+
+// integrityReportFrom runs every check of the caller's org through q
+func integrityReportFrom(ctx context.Context, q querier) (*integrityReport, error) {
+	orgID := auth.OrgIDFromContext(ctx)
+
+	report := &integrityReport{Findings: []integrityFinding{}}
+	for _, c := range integrityChecks {
+		f := integrityFinding{
+			Check:       c.name,
+			Description: c.description,
+			ItemIDs:     []int{},
+			Repair:      c.repair,
+			Fixable:     c.set != "",
+		}
+		rows, err := q.QueryContext(ctx, `
+			SELECT i.id, COUNT(*) OVER() FROM inventory i
+			WHERE i.org_id = $1 AND `+c.cond+`
+			ORDER BY i.id LIMIT $2`, orgID, integritySampleSize)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id, &f.Count); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			f.ItemIDs = append(f.ItemIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if f.Count > 0 {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,570 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// subnetColumns is what subnet queries select, in scanSubnet order
+const subnetColumns = `s.id, s.cidr::text, s.name, s.vlan_id, s.site_id, host(s.gateway), s.description, s.created_at, s.updated_at,
+	(SELECT COUNT(*) FROM ip_addresses a WHERE a.subnet_id = s.id)`
+
+// ipColumns is what address queries select, in scanIP order
+const ipColumns = "id, subnet_id, host(address), item_id, hostname, description, created_at"
+
+// subnetInput is the body of POST /subnets and PUT /subnets/{id}. The CIDR
+// cannot change once the subnet exists.
+type subnetInput struct {
+	CIDR        *string `json:"cidr"`
+	Name        *string `json:"name"`
+	VLANID      *int    `json:"vlan_id"`
+	SiteID      *int    `json:"site_id"`
+	Gateway     *string `json:"gateway"`
+	Description *string `json:"description"`
+}
+
+// ipInput is the body of POST /subnets/{id}/ips; without an address the
+// next free one is allocated
+type ipInput struct {
+	Address     *string `json:"address"`
+	ItemID      *int    `json:"item_id"`
+	Hostname    *string `json:"hostname"`
+	Description *string `json:"description"`
+}
+
+// ipLookup is the response of GET /subnets/lookup
+type ipLookup struct {
+	Address     string            `json:"address"`
+	Subnet      *models.Subnet    `json:"subnet"`
+	Reservation *models.IPAddress `json:"reservation"`
+}
+
+// parseSubnet parses a CIDR, rejecting ones with host bits set
+func parseSubnet(s string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("cidr must be a network such as 10.0.0.0/24")
+	}
+	if p.Masked() != p {
+		return netip.Prefix{}, fmt.Errorf("cidr %s has host bits set; did you mean %s?", p, p.Masked())
+	}
+	return p, nil
+}
+
+// lastAddr is the highest address of p
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// usableRange is the first and last assignable address of p. An IPv4
+// network loses its network and broadcast addresses unless it is a /31 or
+// /32; an IPv6 network loses its subnet-router anycast address.
+func usableRange(p netip.Prefix) (netip.Addr, netip.Addr) {
+	first, last := p.Addr(), lastAddr(p)
+	hostBits := p.Addr().BitLen() - p.Bits()
+	if p.Addr().Is4() && hostBits >= 2 {
+		return first.Next(), last.Prev()
+	}
+	if p.Addr().Is6() && hostBits >= 1 {
+		return first.Next(), last
+	}
+	return first, last
+}
+
+// usableSize is the number of assignable addresses of p, in decimal
+func usableSize(p netip.Prefix) string {
+	first, last := usableRange(p)
+	n := new(big.Int).Sub(new(big.Int).SetBytes(last.AsSlice()), new(big.Int).SetBytes(first.AsSlice()))
+	return n.Add(n, big.NewInt(1)).String()
+}
+
+// usable reports whether a lies within the assignable range of p
+func usable(p netip.Prefix, a netip.Addr) bool {
+	first, last := usableRange(p)
+	return p.Contains(a) && a.Compare(first) >= 0 && a.Compare(last) <= 0
+}
+
+// nextFree is the lowest assignable address of p that is neither reserved
+// nor the gateway. It walks at most len(reserved)+2 addresses.
+func nextFree(p netip.Prefix, gateway netip.Addr, reserved map[netip.Addr]bool) (netip.Addr, bool) {
+	first, last := usableRange(p)
+	for a := first; a.IsValid() && a.Compare(last) <= 0; a = a.Next() {
+		if !reserved[a] && a != gateway {
+			return a, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+func scanSubnet(row interface{ Scan(...any) error }) (*models.Subnet, error) {
+	var sn models.Subnet
+	if err := row.Scan(&sn.ID, &sn.CIDR, &sn.Name, &sn.VLANID, &sn.SiteID, &sn.Gateway, &sn.Description,
+		&sn.CreatedAt, &sn.UpdatedAt, &sn.Used); err != nil {
+		return nil, err
+	}
+	if p, err := netip.ParsePrefix(sn.CIDR); err == nil {
+		sn.Size = usableSize(p)
+	}
+	return &sn, nil
+}
+
+func scanIP(row interface{ Scan(...any) error }) (*models.IPAddress, error) {
+	var ip models.IPAddress
+	err := row.Scan(&ip.ID, &ip.SubnetID, &ip.Address, &ip.ItemID, &ip.Hostname, &ip.Description, &ip.CreatedAt)
+	return &ip, err
+}
+
+// writeJSON encodes v with status
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// subnetInOrg loads the path subnet, writing 404 when the org has none
+func (s *Server) subnetInOrg(w http.ResponseWriter, r *http.Request) (*models.Subnet, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, false
+	}
+	sn, err := scanSubnet(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(),
+		`SELECT `+subnetColumns+` FROM subnets s WHERE s.id = $1 AND s.org_id = $2`, id, auth.OrgIDFromContext(r.Context())))
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return nil, false
+	}
+	return sn, true
+}
+
+// listSubnets lists the org's subnets in address order, with utilization.
+// ?site_id= and ?vlan_id= narrow the list.
+func (s *Server) listSubnets(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	args := []interface{}{auth.OrgIDFromContext(r.Context())}
+	cond := "s.org_id = $1"
+	for _, f := range []string{"site_id", "vlan_id"} {
+		v := r.URL.Query().Get(f)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			problem.BadRequest(w, r, f+" must be an integer")
+			return
+		}
+		args = append(args, n)
+		cond += fmt.Sprintf(" AND s.%s = $%d", f, len(args))
+	}
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER() as total_count
+		FROM subnets s WHERE %s
+		ORDER BY s.cidr
+		LIMIT %d OFFSET %d`, subnetColumns, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var sn models.Subnet
+		if err := rows.Scan(&sn.ID, &sn.CIDR, &sn.Name, &sn.VLANID, &sn.SiteID, &sn.Gateway, &sn.Description,
+			&sn.CreatedAt, &sn.UpdatedAt, &sn.Used, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if p, err := netip.ParsePrefix(sn.CIDR); err == nil {
+			sn.Size = usableSize(p)
+		}
+		out = append(out, sn)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+func (s *Server) getSubnet(w http.ResponseWriter, r *http.Request) {
+	if sn, ok := s.subnetInOrg(w, r); ok {
+		writeJSON(w, r, http.StatusOK, sn)
+	}
+}
+
+// checkSubnetFields validates the fields shared by create and update against
+// the subnet's network p
+func checkSubnetFields(in subnetInput, p netip.Prefix) error {
+	if in.Name != nil && (strings.TrimSpace(*in.Name) == "" || len(*in.Name) > 100) {
+		return fmt.Errorf("name must be 1 to 100 characters")
+	}
+	if in.VLANID != nil && (*in.VLANID < 1 || *in.VLANID > 4094) {
+		return fmt.Errorf("vlan_id must be between 1 and 4094")
+	}
+	if in.Gateway != nil {
+		gw, err := netip.ParseAddr(strings.TrimSpace(*in.Gateway))
+		if err != nil || !usable(p, gw) {
+			return fmt.Errorf("gateway must be an assignable address of %s", p)
+		}
+	}
+	return nil
+}
+
+// createSubnet adds a subnet. One that overlaps a subnet of the org is
+// refused with 409 SUBNET_OVERLAP naming the other subnet.
+func (s *Server) createSubnet(w http.ResponseWriter, r *http.Request) {
+	var in subnetInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.CIDR == nil || in.Name == nil {
+		problem.BadRequest(w, r, "cidr and name are required")
+		return
+	}
+	p, err := parseSubnet(*in.CIDR)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	if err := checkSubnetFields(in, p); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	if in.SiteID != nil {
+		if ok, err := s.siteInOrg(r.Context(), *in.SiteID); err != nil || !ok {
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+			problem.BadRequest(w, r, "site_id does not name a site")
+			return
+		}
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	var otherID int64
+	var otherCIDR, otherName string
+	err = q.QueryRowContext(r.Context(), `
+		SELECT id, cidr::text, name FROM subnets WHERE org_id = $1 AND cidr && $2::cidr ORDER BY cidr LIMIT 1`,
+		orgID, p.String()).Scan(&otherID, &otherCIDR, &otherName)
+	if err == nil {
+		problem.Write(w, r, http.StatusConflict, "SUBNET_OVERLAP",
+			fmt.Sprintf("%s overlaps subnet %d (%s, %s)", p, otherID, otherCIDR, otherName))
+		return
+	}
+	if err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	var id int64
+	err = q.QueryRowContext(r.Context(), `
+		INSERT INTO subnets (org_id, cidr, name, vlan_id, site_id, gateway, description)
+		VALUES ($1, $2, $3, $4, $5, $6::inet, $7) RETURNING id`,
+		orgID, p.String(), strings.TrimSpace(*in.Name), in.VLANID, in.SiteID, in.Gateway, in.Description).Scan(&id)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Write(w, r, http.StatusConflict, "SUBNET_OVERLAP", fmt.Sprintf("%s already exists", p))
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	sn, err := scanSubnet(q.QueryRowContext(r.Context(), `SELECT `+subnetColumns+` FROM subnets s WHERE s.id = $1`, id))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/subnets/%d", id))
+	writeJSON(w, r, http.StatusCreated, sn)
+}
+
+// updateSubnet changes a subnet's name, VLAN, site, gateway or description
+func (s *Server) updateSubnet(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.subnetInOrg(w, r)
+	if !ok {
+		return
+	}
+	var in subnetInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.CIDR != nil && *in.CIDR != sn.CIDR {
+		problem.BadRequest(w, r, "cidr cannot be changed; create a new subnet instead")
+		return
+	}
+	p, err := netip.ParsePrefix(sn.CIDR)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err := checkSubnetFields(in, p); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	if in.SiteID != nil {
+		if ok, err := s.siteInOrg(r.Context(), *in.SiteID); err != nil || !ok {
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+			problem.BadRequest(w, r, "site_id does not name a site")
+			return
+		}
+	}
+	q := dbFrom(r.Context(), s.DB)
+	if _, err := q.ExecContext(r.Context(), `
+		UPDATE subnets SET name = COALESCE($2, name), vlan_id = COALESCE($3, vlan_id), site_id = COALESCE($4, site_id),
+		       gateway = COALESCE($5::inet, gateway), description = COALESCE($6, description)
+		WHERE id = $1`, sn.ID, in.Name, in.VLANID, in.SiteID, in.Gateway, in.Description); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getSubnet(w, r)
+}
+
+// deleteSubnet removes an empty subnet; one with reservations gets 409
+func (s *Server) deleteSubnet(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.subnetInOrg(w, r)
+	if !ok {
+		return
+	}
+	if sn.Used > 0 {
+		problem.Conflict(w, r, fmt.Sprintf("subnet %s still has %d reserved addresses", sn.CIDR, sn.Used))
+		return
+	}
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `DELETE FROM subnets WHERE id = $1`, sn.ID); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listSubnetIPs lists a subnet's reserved addresses in address order
+func (s *Server) listSubnetIPs(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.subnetInOrg(w, r)
+	if !ok {
+		return
+	}
+	params := s.parseListParams(r)
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER() as total_count
+		FROM ip_addresses WHERE subnet_id = $1
+		ORDER BY address
+		LIMIT %d OFFSET %d`, ipColumns, params.limit, params.offset), sn.ID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var ip models.IPAddress
+		if err := rows.Scan(&ip.ID, &ip.SubnetID, &ip.Address, &ip.ItemID, &ip.Hostname, &ip.Description,
+			&ip.CreatedAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, ip)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+// reserveIP reserves an address of the subnet, optionally for an item the
+// caller may see under their site and project grants. An address that is
+// already reserved gets 409 IP_IN_USE; without an address, the lowest free
+// one is allocated, or 409 SUBNET_FULL when none is left.
+func (s *Server) reserveIP(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.subnetInOrg(w, r)
+	if !ok {
+		return
+	}
+	var in ipInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	p, err := netip.ParsePrefix(sn.CIDR)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if in.Hostname != nil && len(*in.Hostname) > 253 {
+		problem.BadRequest(w, r, "hostname must be at most 253 characters")
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	if in.ItemID != nil {
+		itemSQL := `SELECT 1 FROM inventory WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`
+		args := []interface{}{*in.ItemID, orgID}
+		if clause, siteArgs := siteAccessClause(r.Context(), "inventory", 3); clause != "" {
+			itemSQL += " AND " + clause
+			args = append(args, siteArgs...)
+		}
+		var exists bool
+		if err := q.QueryRowContext(r.Context(), `SELECT EXISTS (`+itemSQL+`)`, args...).Scan(&exists); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !exists {
+			problem.BadRequest(w, r, "item_id does not name an item in this organization")
+			return
+		}
+	}
+
+	var addr netip.Addr
+	if in.Address != nil {
+		if addr, err = netip.ParseAddr(strings.TrimSpace(*in.Address)); err != nil || !usable(p, addr) {
+			problem.BadRequest(w, r, fmt.Sprintf("address must be an assignable address of %s", p))
+			return
+		}
+	} else {
+		reserved, err := s.reservedIPs(r, sn.ID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		var gateway netip.Addr
+		if sn.Gateway != nil {
+			gateway, _ = netip.ParseAddr(*sn.Gateway)
+		}
+		var free bool
+		if addr, free = nextFree(p, gateway, reserved); !free {
+			problem.Write(w, r, http.StatusConflict, "SUBNET_FULL", fmt.Sprintf("subnet %s has no free addresses", p))
+			return
+		}
+	}
+
+	ip, err := scanIP(q.QueryRowContext(r.Context(), `
+		INSERT INTO ip_addresses (org_id, subnet_id, address, item_id, hostname, description)
+		VALUES ($1, $2, $3::inet, $4, $5, $6)
+		RETURNING `+ipColumns, orgID, sn.ID, addr.String(), in.ItemID, in.Hostname, in.Description))
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Write(w, r, http.StatusConflict, "IP_IN_USE", fmt.Sprintf("%s is already reserved", addr))
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, ip)
+}
+
+// reservedIPs is the set of reserved addresses of a subnet
+func (s *Server) reservedIPs(r *http.Request, subnetID int64) (map[netip.Addr]bool, error) {
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(),
+		`SELECT host(address) FROM ip_addresses WHERE subnet_id = $1`, subnetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reserved := map[netip.Addr]bool{}
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+		if addr, err := netip.ParseAddr(a); err == nil {
+			reserved[addr] = true
+		}
+	}
+	return reserved, rows.Err()
+}
+
+// releaseIP deletes a reservation of the subnet
+func (s *Server) releaseIP(w http.ResponseWriter, r *http.Request) {
+	sn, ok := s.subnetInOrg(w, r)
+	if !ok {
+		return
+	}
+	ipID, err := strconv.ParseInt(chi.URLParam(r, "ipID"), 10, 64)
+	if err != nil {
+		problem.NotFound(w, r)
+		return
+	}
+	// addresses of items out of the caller's reach are not theirs to release
+	sqlStr := `DELETE FROM ip_addresses WHERE id = $1 AND subnet_id = $2`
+	args := []interface{}{ipID, sn.ID}
+	if clause, siteArgs := siteAccessClause(r.Context(), "inventory", 3); clause != "" {
+		sqlStr += ` AND (item_id IS NULL OR EXISTS (SELECT 1 FROM inventory
+			WHERE inventory.id = ip_addresses.item_id AND ` + clause + `))`
+		args = append(args, siteArgs...)
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), sqlStr, args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupIP answers which subnet an address belongs to and whether it is
+// reserved, so callers can check for conflicts before assigning it
+func (s *Server) lookupIP(w http.ResponseWriter, r *http.Request) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(r.URL.Query().Get("address")))
+	if err != nil {
+		problem.BadRequest(w, r, "address must be an IP address")
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+	out := ipLookup{Address: addr.String()}
+
+	sn, err := scanSubnet(q.QueryRowContext(r.Context(), `
+		SELECT `+subnetColumns+` FROM subnets s WHERE s.org_id = $1 AND s.cidr >>= $2::inet
+		ORDER BY masklen(s.cidr) DESC LIMIT 1`, orgID, addr.String()))
+	if err != nil && err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err == nil {
+		out.Subnet = sn
+	}
+	ip, err := scanIP(q.QueryRowContext(r.Context(), `
+		SELECT `+ipColumns+` FROM ip_addresses WHERE org_id = $1 AND address = $2::inet`, orgID, addr.String()))
+	if err != nil && err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err == nil {
+		out.Reservation = ip
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
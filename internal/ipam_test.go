@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseSubnet(t *testing.T) {
+	if _, err := parseSubnet("10.0.0.0/24"); err != nil {
+		t.Errorf("valid subnet: %v", err)
+	}
+	for _, bad := range []string{"10.0.0.1/24", "10.0.0.0", "nope", "2001:db8::1/64"} {
+		if _, err := parseSubnet(bad); err == nil {
+			t.Errorf("parseSubnet(%q) accepted", bad)
+		}
+	}
+}
+
+func TestUsableRange(t *testing.T) {
+	tests := []struct {
+		cidr, first, last, size string
+	}{
+		{"10.0.0.0/24", "10.0.0.1", "10.0.0.254", "254"},
+		{"10.0.0.0/31", "10.0.0.0", "10.0.0.1", "2"},
+		{"10.0.0.7/32", "10.0.0.7", "10.0.0.7", "1"},
+		{"2001:db8::/126", "2001:db8::1", "2001:db8::3", "3"},
+		{"2001:db8::/64", "2001:db8::1", "2001:db8::ffff:ffff:ffff:ffff", "18446744073709551615"},
+	}
+	for _, tt := range tests {
+		p := netip.MustParsePrefix(tt.cidr)
+		first, last := usableRange(p)
+		if first.String() != tt.first || last.String() != tt.last || usableSize(p) != tt.size {
+			t.Errorf("%s: range %s-%s size %s, want %s-%s size %s", tt.cidr, first, last, usableSize(p), tt.first, tt.last, tt.size)
+		}
+	}
+}
+
+func TestNextFree(t *testing.T) {
+	p := netip.MustParsePrefix("192.168.1.0/29")
+	gw := netip.MustParseAddr("192.168.1.1")
+	reserved := map[netip.Addr]bool{
+		netip.MustParseAddr("192.168.1.2"): true,
+		netip.MustParseAddr("192.168.1.4"): true,
+	}
+	if a, ok := nextFree(p, gw, reserved); !ok || a.String() != "192.168.1.3" {
+		t.Errorf("nextFree = %s, %v; want 192.168.1.3", a, ok)
+	}
+	for _, a := range []string{"192.168.1.3", "192.168.1.5", "192.168.1.6"} {
+		reserved[netip.MustParseAddr(a)] = true
+	}
+	if a, ok := nextFree(p, gw, reserved); ok {
+		t.Errorf("full subnet allocated %s", a)
+	}
+	if usable(p, netip.MustParseAddr("192.168.1.7")) || usable(p, netip.MustParseAddr("192.168.1.0")) {
+		t.Error("network or broadcast address is usable")
+	}
+}
@@ -0,0 +1,364 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/textdiff"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxConfigBytes bounds a single uploaded configuration snapshot
+const maxConfigBytes = 5 << 20
+
+// maxConfigDiffEdits bounds the changed lines of a config diff; diff time
+// grows with them, and past a few thousand a diff is no longer readable
+const maxConfigDiffEdits = 5000
+
+// configInput is the body accepted by POST /items/{id}/configs
+type configInput struct {
+	Content     string     `json:"content"`
+	CollectedAt *time.Time `json:"collected_at,omitempty"`
+}
+
+// configDiff is the response of GET /items/{id}/configs/diff
+type configDiff struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	textdiff.Stats
+	Diff string `json:"diff"`
+}
+
+// configMatch is one hit returned by GET /configs/search
+type configMatch struct {
+	ID          int64     `json:"id"`
+	ItemID      int       `json:"item_id"`
+	AssetTag    string    `json:"asset_tag"`
+	ItemName    string    `json:"item_name"`
+	CollectedAt time.Time `json:"collected_at"`
+	Line        int       `json:"line"`
+	Match       string    `json:"match"`
+}
+
+func (s *Server) createItemConfig(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+
+	var in configInput
+	if !readJSON(w, r, &in, maxConfigBytes, false) {
+		return
+	}
+	if strings.TrimSpace(in.Content) == "" {
+		problem.BadRequest(w, r, "content is required")
+		return
+	}
+	collectedAt := time.Now()
+	if in.CollectedAt != nil {
+		collectedAt = *in.CollectedAt
+	}
+	sum := sha256.Sum256([]byte(in.Content))
+	hash := hex.EncodeToString(sum[:])
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	// Re-uploading an unchanged config returns the latest snapshot instead of a duplicate
+	var latest models.ItemConfig
+	err := q.QueryRowContext(r.Context(), `
+		SELECT id, item_id, hash, size_bytes, collected_at, created_at
+		FROM item_configs WHERE org_id = $1 AND item_id = $2
+		ORDER BY collected_at DESC, id DESC LIMIT 1`, orgID, itemID).
+		Scan(&latest.ID, &latest.ItemID, &latest.Hash, &latest.SizeBytes, &latest.CollectedAt, &latest.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err == nil && latest.Hash == hash {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(latest); err != nil {
+			problem.Internal(w, r, err)
+		}
+		return
+	}
+
+	var out models.ItemConfig
+	err = q.QueryRowContext(r.Context(), `
+		INSERT INTO item_configs (org_id, item_id, content, hash, size_bytes, collected_at)
+		VALUES ($1,$2,$3,$4,$5,$6)
+		RETURNING id, item_id, hash, size_bytes, collected_at, created_at
+	`, orgID, itemID, in.Content, hash, len(in.Content), collectedAt).
+		Scan(&out.ID, &out.ItemID, &out.Hash, &out.SizeBytes, &out.CollectedAt, &out.CreatedAt)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	if s.ConfigRetention > 0 {
+		if _, err := q.ExecContext(r.Context(), `
+			DELETE FROM item_configs
+			WHERE org_id = $1 AND item_id = $2 AND id NOT IN (
+				SELECT id FROM item_configs WHERE org_id = $1 AND item_id = $2
+				ORDER BY collected_at DESC, id DESC LIMIT $3
+			)`, orgID, itemID, s.ConfigRetention); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) listItemConfigs(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	params := s.parseListParams(r)
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	q := dbFrom(r.Context(), s.DB)
+	rows, err := q.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT id, item_id, hash, size_bytes, collected_at, created_at,
+		       COUNT(*) OVER() as total_count
+		FROM item_configs WHERE org_id = $1 AND item_id = $2
+		ORDER BY collected_at DESC, id DESC
+		LIMIT %d OFFSET %d`, params.limit, params.offset), orgID, itemID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	configs := []interface{}{}
+	var totalCount int
+	for rows.Next() {
+		var c models.ItemConfig
+		if err := rows.Scan(&c.ID, &c.ItemID, &c.Hash, &c.SizeBytes, &c.CollectedAt, &c.CreatedAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		configs = append(configs, c)
+	}
+
+	sendListResponse(w, configs, totalCount, params, nil)
+}
+
+func (s *Server) getItemConfig(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	configID, err := strconv.ParseInt(chi.URLParam(r, "configID"), 10, 64)
+	if err != nil {
+		problem.NotFound(w, r)
+		return
+	}
+
+	c, err := s.loadItemConfig(r, itemID, configID)
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	setLastModified(w, c.CreatedAt)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// diffItemConfigs compares two snapshots of an item. Without from/to it
+// compares the two most recent snapshots.
+func (s *Server) diffItemConfigs(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	var ids [2]int64
+	values := r.URL.Query()
+	if values.Get("from") != "" || values.Get("to") != "" {
+		for i, key := range []string{"from", "to"} {
+			id, err := strconv.ParseInt(values.Get(key), 10, 64)
+			if err != nil {
+				problem.BadRequest(w, r, "from and to must both be snapshot IDs")
+				return
+			}
+			ids[i] = id
+		}
+	} else {
+		rows, err := q.QueryContext(r.Context(), `
+			SELECT id FROM item_configs WHERE org_id = $1 AND item_id = $2
+			ORDER BY collected_at DESC, id DESC LIMIT 2`, orgID, itemID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		var latest []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				problem.Internal(w, r, err)
+				return
+			}
+			latest = append(latest, id)
+		}
+		rows.Close()
+		if len(latest) < 2 {
+			problem.Write(w, r, http.StatusUnprocessableEntity, "NOT_ENOUGH_SNAPSHOTS", "at least two snapshots are needed for a diff")
+			return
+		}
+		ids = [2]int64{latest[1], latest[0]}
+	}
+
+	var snaps [2]*models.ItemConfig
+	for i, id := range ids {
+		c, err := s.loadItemConfig(r, itemID, id)
+		if err == sql.ErrNoRows {
+			problem.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		snaps[i] = c
+	}
+
+	ops, err := textdiff.DiffLimit(textdiff.Lines(snaps[0].Content), textdiff.Lines(snaps[1].Content), maxConfigDiffEdits)
+	if errors.Is(err, textdiff.ErrTooDifferent) {
+		problem.Write(w, r, http.StatusUnprocessableEntity, "TOO_DIFFERENT",
+			fmt.Sprintf("the snapshots differ in more than %d lines, too different to diff", maxConfigDiffEdits))
+		return
+	}
+	out := configDiff{
+		From:  ids[0],
+		To:    ids[1],
+		Stats: textdiff.Count(ops),
+		Diff:  textdiff.Unified(fmt.Sprintf("config/%d", ids[0]), fmt.Sprintf("config/%d", ids[1]), ops, 3),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// searchConfigs finds snapshots whose content contains q, across all items of the org
+func (s *Server) searchConfigs(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	if params.q == "" {
+		problem.BadRequest(w, r, "q is required")
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	where := "c.org_id = $1 AND c.content ILIKE $2"
+	args := []interface{}{orgID, "%" + params.q + "%"}
+	if clause, siteArgs := siteAccessClause(r.Context(), "i", 3); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+
+	q := dbFrom(r.Context(), s.DB)
+	rows, err := q.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT c.id, c.item_id, i.asset_tag, i.name, c.collected_at, c.content,
+		       COUNT(*) OVER() as total_count
+		FROM item_configs c
+		JOIN inventory i ON i.id = c.item_id AND i.org_id = c.org_id AND i.deleted_at IS NULL
+		WHERE %s
+		ORDER BY c.collected_at DESC, c.id DESC
+		LIMIT %d OFFSET %d`, where, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	matches := []interface{}{}
+	var totalCount int
+	needle := strings.ToLower(params.q)
+	for rows.Next() {
+		var m configMatch
+		var content string
+		if err := rows.Scan(&m.ID, &m.ItemID, &m.AssetTag, &m.ItemName, &m.CollectedAt, &content, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		for i, line := range textdiff.Lines(content) {
+			if strings.Contains(strings.ToLower(line), needle) {
+				m.Line = i + 1
+				m.Match = line
+				break
+			}
+		}
+		matches = append(matches, m)
+	}
+
+	sendListResponse(w, matches, totalCount, params, nil)
+}
+
+// itemInOrg resolves the {id} item of the caller's org, writing a 404 when it does not exist
+func (s *Server) itemInOrg(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return 0, false
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	cond := "id = $1 AND org_id = $2 AND deleted_at IS NULL"
+	args := []interface{}{id, orgID}
+	if clause, siteArgs := siteAccessClause(r.Context(), "inventory", 3); clause != "" {
+		cond += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+
+	var exists bool
+	q := dbFrom(r.Context(), s.DB)
+	if err := q.QueryRowContext(r.Context(),
+		`SELECT EXISTS (SELECT 1 FROM inventory WHERE `+cond+`)`, args...).Scan(&exists); err != nil {
+		problem.Internal(w, r, err)
+		return 0, false
+	}
+	if !exists {
+		problem.NotFound(w, r)
+		return 0, false
+	}
+	return int(id), true
+}
+
+func (s *Server) loadItemConfig(r *http.Request, itemID int, configID int64) (*models.ItemConfig, error) {
+	orgID := auth.OrgIDFromContext(r.Context())
+	var c models.ItemConfig
+	q := dbFrom(r.Context(), s.DB)
+	err := q.QueryRowContext(r.Context(), `
+		SELECT id, item_id, hash, size_bytes, collected_at, created_at, content
+		FROM item_configs WHERE id = $1 AND item_id = $2 AND org_id = $3`, configID, itemID, orgID).
+		Scan(&c.ID, &c.ItemID, &c.Hash, &c.SizeBytes, &c.CollectedAt, &c.CreatedAt, &c.Content)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/i18n"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/xlsx"
+)
+
+// expiringItem is an item of the warranty expiry report. Its coverage ends
+// at the later of its warranty and support contract.
+type expiringItem struct {
+	ID              int        `json:"id"`
+	AssetTag        string     `json:"asset_tag"`
+	Name            string     `json:"name"`
+	WarrantyEnd     *time.Time `json:"warranty_end,omitempty"`
+	SupportContract *string    `json:"support_contract,omitempty"`
+	SupportLevel    *string    `json:"support_level,omitempty"`
+	SupportEnd      *time.Time `json:"support_end,omitempty"`
+	CoverageEnd     time.Time  `json:"coverage_end"`
+	DaysLeft        int        `json:"days_left"`
+}
+
+// expiringGroup is the expiring items of one site and vendor
+type expiringGroup struct {
+	Site     string         `json:"site"`
+	VendorID *int64         `json:"vendor_id"`
+	Vendor   string         `json:"vendor"`
+	Count    int            `json:"count"`
+	Items    []expiringItem `json:"items"`
+}
+
+// expiringReport is the response of GET /reports/warranty-expiring
+type expiringReport struct {
+	Days   int             `json:"days"`
+	Total  int             `json:"total"`
+	Groups []expiringGroup `json:"groups"`
+}
+
+// add appends it to the report, opening a group when site or vendor change;
+// rows come ordered by site and vendor
+func (rep *expiringReport) add(site string, vendorID *int64, vendor string, it expiringItem) {
+	n := len(rep.Groups)
+	if n == 0 || rep.Groups[n-1].Site != site || !sameVendor(rep.Groups[n-1].VendorID, vendorID) {
+		rep.Groups = append(rep.Groups, expiringGroup{Site: site, VendorID: vendorID, Vendor: vendor, Items: []expiringItem{}})
+		n++
+	}
+	g := &rep.Groups[n-1]
+	g.Items = append(g.Items, it)
+	g.Count++
+	rep.Total++
+}
+
+func sameVendor(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// getWarrantyExpiringReport lists the items whose coverage (warranty or
+// support contract, whichever ends last) lapses within ?days= (default 90),
+// grouped by site and vendor. Retired and disposed items are left out.
+// ?format=csv or ?format=xlsx returns one line per item as a download.
+func (s *Server) getWarrantyExpiringReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	format, ok := reportFormat(w, r)
+	if !ok {
+		return
+	}
+	lang, ok := exportLang(w, r)
+	if !ok {
+		return
+	}
+
+	days := warrantyHorizonDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxWarrantyAlertDays {
+			problem.BadRequest(w, r, fmt.Sprintf("days must be an integer between 0 and %d", maxWarrantyAlertDays))
+			return
+		}
+		days = n
+	}
+
+	where := `i.org_id = $1 AND i.deleted_at IS NULL AND i.status NOT IN ('retired', 'disposed')
+		AND GREATEST(i.warranty_end, i.support_end) BETWEEN CURRENT_DATE AND CURRENT_DATE + $2::int`
+	args := []interface{}{auth.OrgIDFromContext(ctx), days}
+	if clause, siteArgs := siteAccessClause(ctx, "i", 3); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+	if clause, groupArgs, ok := reportGroupClause(w, r, "i", len(args)+1); !ok {
+		return
+	} else if clause != "" {
+		where += " AND " + clause
+		args = append(args, groupArgs...)
+	}
+
+	rows, err := dbFrom(ctx, s.DB).QueryContext(ctx, `
+		SELECT COALESCE(i.site, ''), i.vendor_id, COALESCE(v.name, ''),
+		       i.id, i.asset_tag, i.name, i.warranty_end, i.support_contract, i.support_level, i.support_end,
+		       GREATEST(i.warranty_end, i.support_end), GREATEST(i.warranty_end, i.support_end) - CURRENT_DATE
+		FROM inventory i
+		LEFT JOIN vendors v ON v.id = i.vendor_id AND v.org_id = i.org_id
+		WHERE `+where+`
+		ORDER BY 1, 3, 2, 11, i.id`, args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	report := expiringReport{Days: days, Groups: []expiringGroup{}}
+	for rows.Next() {
+		var (
+			site, vendor string
+			vendorID     *int64
+			it           expiringItem
+		)
+		if err := rows.Scan(&site, &vendorID, &vendor,
+			&it.ID, &it.AssetTag, &it.Name, &it.WarrantyEnd, &it.SupportContract, &it.SupportLevel, &it.SupportEnd,
+			&it.CoverageEnd, &it.DaysLeft,
+		); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		report.add(site, vendorID, vendor, it)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	switch format {
+	case "csv":
+		sendReportFile(w, format, "warranty-expiring", lang, func(out io.Writer) error { return writeExpiringCSV(out, report, lang) })
+		return
+	case "xlsx":
+		sendReportFile(w, format, "warranty-expiring", lang, func(out io.Writer) error { return writeExpiringXLSX(out, report, lang) })
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// expiringColumns is the header of the csv and xlsx expiry reports
+var expiringColumns = []string{
+	"site", "vendor", "asset_tag", "name", "warranty_end",
+	"support_contract", "support_level", "support_end", "coverage_end", "days_left",
+}
+
+// writeExpiringCSV writes one line per item, in report order, with headers in lang
+func writeExpiringCSV(w io.Writer, report expiringReport, lang string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(i18n.Headers(lang, expiringColumns)); err != nil {
+		return err
+	}
+	for _, g := range report.Groups {
+		for _, it := range g.Items {
+			if err := cw.Write([]string{
+				g.Site, g.Vendor, it.AssetTag, it.Name, formatDate(it.WarrantyEnd),
+				textOf(it.SupportContract), textOf(it.SupportLevel), formatDate(it.SupportEnd),
+				formatDate(&it.CoverageEnd), strconv.Itoa(it.DaysLeft),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeExpiringXLSX writes the CSV lines as a formatted sheet with real dates
+func writeExpiringXLSX(w io.Writer, report expiringReport, lang string) error {
+	xw, err := xlsx.NewWriterLayout(w, "Warranty expiring", xlsx.Layout{
+		Widths:     []float64{24, 20, 16, 30, 13, 18, 18, 13, 13, 10},
+		FreezeRows: 1,
+	})
+	if err != nil {
+		return err
+	}
+	if err := xw.WriteHeader(i18n.Headers(lang, expiringColumns)); err != nil {
+		return err
+	}
+	for _, g := range report.Groups {
+		for _, it := range g.Items {
+			coverageEnd := it.CoverageEnd
+			if err := xw.WriteCells([]xlsx.Cell{
+				xlsx.Text(g.Site), xlsx.Text(g.Vendor), xlsx.Text(it.AssetTag), xlsx.Text(it.Name), xlsx.Date(it.WarrantyEnd),
+				xlsx.Text(textOf(it.SupportContract)), xlsx.Text(textOf(it.SupportLevel)), xlsx.Date(it.SupportEnd),
+				xlsx.Date(&coverageEnd), xlsx.Int(it.DaysLeft),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return xw.Close()
+}
+
+// textOf is *s, or "" for nil
+func textOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
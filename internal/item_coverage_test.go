@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/i18n"
+)
+
+func TestExpiringReportGroupsBySiteAndVendor(t *testing.T) {
+	one, two := int64(1), int64(2)
+	var rep expiringReport
+	rep.add("Berlin", &one, "Cisco", expiringItem{ID: 1})
+	rep.add("Berlin", &one, "Cisco", expiringItem{ID: 2})
+	rep.add("Berlin", &two, "Juniper", expiringItem{ID: 3})
+	rep.add("Berlin", nil, "", expiringItem{ID: 4})
+	rep.add("Hamburg", nil, "", expiringItem{ID: 5})
+
+	if rep.Total != 5 {
+		t.Errorf("total = %d, want 5", rep.Total)
+	}
+	want := []struct {
+		site  string
+		count int
+	}{{"Berlin", 2}, {"Berlin", 1}, {"Berlin", 1}, {"Hamburg", 1}}
+	if len(rep.Groups) != len(want) {
+		t.Fatalf("groups = %+v", rep.Groups)
+	}
+	for i, g := range rep.Groups {
+		if g.Site != want[i].site || g.Count != want[i].count || len(g.Items) != g.Count {
+			t.Errorf("group %d = %+v, want site %s count %d", i, g, want[i].site, want[i].count)
+		}
+	}
+}
+
+func TestWarrantyExpiringReportDays(t *testing.T) {
+	for _, days := range []string{"-1", "x", "3651"} {
+		w := httptest.NewRecorder()
+		(&Server{}).getWarrantyExpiringReport(w, httptest.NewRequest(http.MethodGet, "/reports/warranty-expiring?days="+days, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("days=%s: status = %d, want 400", days, w.Code)
+		}
+	}
+}
+
+func TestWriteExpiringCSV(t *testing.T) {
+	end := time.Date(2026, 11, 30, 0, 0, 0, 0, time.UTC)
+	contract := "SC-1"
+	var rep expiringReport
+	rep.add("Berlin", nil, "", expiringItem{AssetTag: "A-1", Name: "core", SupportContract: &contract, SupportEnd: &end, CoverageEnd: end, DaysLeft: 44})
+
+	var sb strings.Builder
+	if err := writeExpiringCSV(&sb, rep, i18n.Default); err != nil {
+		t.Fatal(err)
+	}
+	want := "site,vendor,asset_tag,name,warranty_end,support_contract,support_level,support_end,coverage_end,days_left\n" +
+		"Berlin,,A-1,core,,SC-1,,2026-11-30,2026-11-30,44\n"
+	if sb.String() != want {
+		t.Errorf("CSV:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestReportFormat(t *testing.T) {
+	for format, ok := range map[string]bool{"": true, "json": true, "csv": true, "xlsx": true, "pdf": false} {
+		w := httptest.NewRecorder()
+		_, got := reportFormat(w, httptest.NewRequest(http.MethodGet, "/reports/aging?format="+format, nil))
+		if got != ok || (!ok && w.Code != http.StatusBadRequest) {
+			t.Errorf("format %q: ok = %v, status %d", format, got, w.Code)
+		}
+	}
+}
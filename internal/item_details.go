@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+	"era-inventory-api/internal/repo"
+)
+
+// itemSubtype is a device type whose items carry typed details in a table of
+// their own, one row per item
+type itemSubtype struct {
+	table string
+	new   func() models.Details
+}
+
+// itemSubtypes are the subtypes by device type
+var itemSubtypes = map[string]itemSubtype{
+	models.DeviceRouter:      {"item_routers", func() models.Details { return &models.RouterDetails{} }},
+	models.DeviceFirewall:    {"item_firewalls", func() models.Details { return &models.FirewallDetails{} }},
+	models.DeviceAccessPoint: {"item_access_points", func() models.Details { return &models.AccessPointDetails{} }},
+	models.DeviceServer:      {"item_servers", func() models.Details { return &models.ServerDetails{} }},
+}
+
+// itemDetailsColumn is the details of a subtype row as a JSON object,
+// without its keys and unset fields
+const itemDetailsColumn = "jsonb_strip_nulls(to_jsonb(d) - 'item_id' - 'org_id')"
+
+// parseItemDetails decodes and checks the details of an item of deviceType
+// from a write body
+func parseItemDetails(deviceType string, raw json.RawMessage) (models.Details, error) {
+	st, ok := itemSubtypes[deviceType]
+	if !ok {
+		return nil, fmt.Errorf("items of device type %q have no details; details are for: %s, %s, %s, %s",
+			deviceType, models.DeviceRouter, models.DeviceFirewall, models.DeviceAccessPoint, models.DeviceServer)
+	}
+	d := st.new()
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(d); err != nil {
+		return nil, fmt.Errorf("details are invalid for a %s: %v", deviceType, err)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// itemDetailsStep is the outbox.Wrap step storing d for the changed item,
+// with its arguments numbered from next. It is empty when d sets nothing.
+func itemDetailsStep(deviceType string, d models.Details, next int) (string, []interface{}) {
+	cols := d.Columns()
+	if len(cols) == 0 {
+		return "", nil
+	}
+	keys := make([]string, 0, len(cols))
+	for k := range cols {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	names := []string{"item_id", "org_id"}
+	vals := []string{"id", "org_id"}
+	sets := make([]string, 0, len(keys))
+	args := make([]interface{}, 0, len(keys))
+	for i, k := range keys {
+		names = append(names, k)
+		vals = append(vals, fmt.Sprintf("$%d", next+i))
+		sets = append(sets, k+" = EXCLUDED."+k)
+		args = append(args, cols[k])
+	}
+	return fmt.Sprintf(`details AS (
+		INSERT INTO %s (%s) SELECT %s FROM changed
+		ON CONFLICT (item_id) DO UPDATE SET %s)`,
+		itemSubtypes[deviceType].table, strings.Join(names, ", "), strings.Join(vals, ", "), strings.Join(sets, ", ")), args
+}
+
+// itemDetailsWrite stores d for an item of deviceType as part of its write
+func itemDetailsWrite(deviceType string, d models.Details) repo.DetailsStep {
+	return func(next int) (string, []any) {
+		return itemDetailsStep(deviceType, d, next)
+	}
+}
+
+// loadItemDetails sets it.Details when its device type has details
+func (s *Server) loadItemDetails(ctx context.Context, it *models.Item) error {
+	st, ok := itemSubtypes[it.DeviceType]
+	if !ok {
+		return nil
+	}
+	var raw []byte
+	err := dbFrom(ctx, s.DB).QueryRowContext(ctx,
+		`SELECT `+itemDetailsColumn+` FROM `+st.table+` d WHERE item_id = $1 AND org_id = $2`,
+		it.ID, auth.OrgIDFromContext(ctx)).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	it.Details = raw
+	return nil
+}
+
+func (s *Server) listRouters(w http.ResponseWriter, r *http.Request) {
+	s.listSubtype(w, r, models.DeviceRouter)
+}
+
+func (s *Server) listFirewalls(w http.ResponseWriter, r *http.Request) {
+	s.listSubtype(w, r, models.DeviceFirewall)
+}
+
+func (s *Server) listAccessPoints(w http.ResponseWriter, r *http.Request) {
+	s.listSubtype(w, r, models.DeviceAccessPoint)
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	s.listSubtype(w, r, models.DeviceServer)
+}
+
+// listSubtype lists the items of deviceType with their details, with the
+// GET /items filters and sort (offset paging only)
+func (s *Server) listSubtype(w http.ResponseWriter, r *http.Request, deviceType string) {
+	params := s.parseListParams(r)
+	where, err := itemFilter(r, params)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	where.And("device_type = ?", deviceType)
+
+	sqlStr := fmt.Sprintf(`
+		SELECT %s,
+		       (SELECT %s FROM %s d WHERE d.item_id = inventory.id),
+		       COUNT(*) OVER() as total_count
+		FROM inventory%s%s LIMIT %d OFFSET %d`,
+		itemColumns, itemDetailsColumn, itemSubtypes[deviceType].table, where.Clause(),
+		query.OrderBy(params.sort, itemSort), params.limit, params.offset)
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), sqlStr, where.Args()...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var it models.Item
+		var details []byte
+		if err := rows.Scan(append(itemScanDest(&it), &details, &totalCount)...); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		it.Details = details
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, items, totalCount, params, nil)
+}
+
+// detailsGiven reports whether a write body sets details; null counts as absent
+func detailsGiven(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/models"
+)
+
+func TestParseItemDetails(t *testing.T) {
+	d, err := parseItemDetails(models.DeviceAccessPoint, json.RawMessage(`{"wifi_standards":["802.11ax"],"max_clients":200}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ap := d.(*models.AccessPointDetails); *ap.MaxClients != 200 || ap.Radios != nil {
+		t.Errorf("details = %+v", ap)
+	}
+
+	for _, tc := range []struct{ deviceType, body string }{
+		{"switch", `{"ram_gb":4}`},
+		{models.DeviceServer, `{"ram":4}`},
+		{models.DeviceServer, `{"ram_gb":-1}`},
+		{models.DeviceRouter, `{"routing_protocols":["bgp","carrier pigeon"]}`},
+		{models.DeviceFirewall, `{"ha_mode":"cluster"}`},
+		{models.DeviceAccessPoint, `{"wifi_standards":"802.11ax"}`},
+	} {
+		if _, err := parseItemDetails(tc.deviceType, json.RawMessage(tc.body)); err == nil {
+			t.Errorf("%s %s accepted", tc.deviceType, tc.body)
+		}
+	}
+}
+
+func TestItemDetailsStep(t *testing.T) {
+	cores, os := 16, " "
+	step, args := itemDetailsStep(models.DeviceServer, &models.ServerDetails{CPUCores: &cores, OS: &os}, 13)
+	for _, part := range []string{
+		"INSERT INTO item_servers (item_id, org_id, cpu_cores, os) SELECT id, org_id, $13, $14 FROM changed",
+		"ON CONFLICT (item_id) DO UPDATE SET cpu_cores = EXCLUDED.cpu_cores, os = EXCLUDED.os",
+	} {
+		if !strings.Contains(step, part) {
+			t.Errorf("step = %s\nmissing %q", step, part)
+		}
+	}
+	// a blank text clears the field
+	if len(args) != 2 || args[0] != 16 || args[1] != nil {
+		t.Errorf("args = %v", args)
+	}
+	if step, _ := itemDetailsStep(models.DeviceServer, &models.ServerDetails{}, 1); step != "" {
+		t.Errorf("empty details write %s", step)
+	}
+}
+
+func TestDetailsGiven(t *testing.T) {
+	for raw, want := range map[string]bool{"": false, "null": false, "{}": true} {
+		if got := detailsGiven(json.RawMessage(raw)); got != want {
+			t.Errorf("detailsGiven(%q) = %v", raw, got)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// itemLinkInput is the body accepted by POST /items/{id}/links: a link of
+// kind from the path item to item_id
+type itemLinkInput struct {
+	Kind   string `json:"kind"`
+	ItemID int    `json:"item_id"`
+}
+
+func validLinkKind(kind string) bool {
+	for _, k := range models.ItemLinkKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// listItemLinks lists the links of an item in both directions, each with a
+// summary of the item at the other end. Links to items in the trash are hidden.
+func (s *Server) listItemLinks(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	params := s.parseListParams(r)
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	cond := ""
+	args := []interface{}{orgID, itemID}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		if !validLinkKind(kind) {
+			problem.BadRequest(w, r, "kind must be one of: "+strings.Join(models.ItemLinkKinds, ", "))
+			return
+		}
+		args = append(args, kind)
+		cond += fmt.Sprintf(" AND l.kind = $%d", len(args))
+	}
+	switch dir := r.URL.Query().Get("direction"); dir {
+	case "":
+	case "outgoing":
+		cond += " AND l.from_item_id = $2"
+	case "incoming":
+		cond += " AND l.to_item_id = $2"
+	default:
+		problem.BadRequest(w, r, "direction must be outgoing or incoming")
+		return
+	}
+
+	q := dbFrom(r.Context(), s.DB)
+	rows, err := q.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT l.id, l.kind, l.from_item_id, l.to_item_id, l.created_at,
+		       i.id, i.asset_tag, i.name, COALESCE(i.device_type, ''),
+		       COUNT(*) OVER() as total_count
+		FROM item_links l
+		JOIN inventory i ON i.id = CASE WHEN l.from_item_id = $2 THEN l.to_item_id ELSE l.from_item_id END
+		WHERE l.org_id = $1 AND (l.from_item_id = $2 OR l.to_item_id = $2)
+		  AND i.org_id = $1 AND i.deleted_at IS NULL%s
+		ORDER BY l.kind, l.id
+		LIMIT %d OFFSET %d`, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	links := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var l models.ItemLink
+		var other models.LinkedItem
+		if err := rows.Scan(&l.ID, &l.Kind, &l.FromItemID, &l.ToItemID, &l.CreatedAt,
+			&other.ID, &other.AssetTag, &other.Name, &other.DeviceType, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		l.Direction = "outgoing"
+		if l.ToItemID == itemID {
+			l.Direction = "incoming"
+		}
+		l.Item = &other
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, links, totalCount, params, nil)
+}
+
+// createItemLink links the path item to another item of the org. A
+// "contains" link is refused when the target already has a parent or when it
+// would close a containment cycle.
+func (s *Server) createItemLink(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	var in itemLinkInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if !validLinkKind(in.Kind) {
+		problem.BadRequest(w, r, "kind must be one of: "+strings.Join(models.ItemLinkKinds, ", "))
+		return
+	}
+	if in.ItemID == itemID {
+		problem.BadRequest(w, r, "an item cannot be linked to itself")
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	// the target must be visible to the caller, exactly as GET /items/{id} would
+	cond := "id = $1 AND org_id = $2 AND deleted_at IS NULL"
+	args := []interface{}{in.ItemID, orgID}
+	if clause, siteArgs := siteAccessClause(r.Context(), "inventory", 3); clause != "" {
+		cond += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+	var exists bool
+	if err := q.QueryRowContext(r.Context(),
+		`SELECT EXISTS (SELECT 1 FROM inventory WHERE `+cond+`)`, args...).Scan(&exists); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if !exists {
+		problem.BadRequest(w, r, "item_id does not name an item in this organization")
+		return
+	}
+
+	if in.Kind == models.LinkContains {
+		// the new child must not already be an ancestor of the parent
+		var cycle bool
+		if err := q.QueryRowContext(r.Context(), `
+			WITH RECURSIVE ancestors AS (
+				SELECT from_item_id FROM item_links WHERE org_id = $1 AND to_item_id = $2 AND kind = 'contains'
+				UNION
+				SELECT l.from_item_id FROM item_links l JOIN ancestors a ON l.to_item_id = a.from_item_id
+				WHERE l.org_id = $1 AND l.kind = 'contains'
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE from_item_id = $3)`, orgID, itemID, in.ItemID).Scan(&cycle); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if cycle {
+			problem.Conflict(w, r, fmt.Sprintf("item %d already contains item %d", in.ItemID, itemID))
+			return
+		}
+	}
+
+	var out models.ItemLink
+	err := q.QueryRowContext(r.Context(), `
+		INSERT INTO item_links (org_id, from_item_id, to_item_id, kind)
+		VALUES ($1,$2,$3,$4)
+		RETURNING id, kind, from_item_id, to_item_id, created_at
+	`, orgID, itemID, in.ItemID, in.Kind).Scan(&out.ID, &out.Kind, &out.FromItemID, &out.ToItemID, &out.CreatedAt)
+	if err != nil {
+		msg := strings.ToLower(err.Error())
+		switch {
+		case strings.Contains(msg, "item_links_one_parent"):
+			problem.Conflict(w, r, fmt.Sprintf("item %d is already contained in another item", in.ItemID))
+		case strings.Contains(msg, "unique"):
+			problem.Conflict(w, r, "the items are already linked this way")
+		default:
+			problem.Internal(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// deleteItemLink removes a link touching the path item, in either direction
+func (s *Server) deleteItemLink(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	linkID, err := strconv.ParseInt(chi.URLParam(r, "linkID"), 10, 64)
+	if err != nil {
+		problem.NotFound(w, r)
+		return
+	}
+
+	q := dbFrom(r.Context(), s.DB)
+	res, err := q.ExecContext(r.Context(), `
+		DELETE FROM item_links
+		WHERE id = $1 AND org_id = $2 AND (from_item_id = $3 OR to_item_id = $3)`,
+		linkID, auth.OrgIDFromContext(r.Context()), itemID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
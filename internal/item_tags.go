@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxItemTags caps the tags one POST /items/{id}/tags may add
+const maxItemTags = 50
+
+// tagPattern is the shape of a normalized tag, as enforced by the table
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:-]{0,49}$`)
+
+// itemTagsInput is the body of POST /items/{id}/tags
+type itemTagsInput struct {
+	Tags []string `json:"tags"`
+}
+
+// itemTagsResponse lists an item's tags
+type itemTagsResponse struct {
+	ItemID int      `json:"item_id"`
+	Tags   []string `json:"tags"`
+}
+
+// tagCount is one entry of GET /tags
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// normalizeTags lowercases and trims tags, drops duplicates and rejects
+// malformed ones
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if !tagPattern.MatchString(t) {
+			return nil, fmt.Errorf("tag %q must be 1-50 characters of a-z, 0-9, _ . : - starting with a letter or digit", t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// listItemTags returns the item's tags
+func (s *Server) listItemTags(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	s.writeItemTags(w, r, itemID)
+}
+
+// addItemTags tags an item; tags it already has are left as they are
+func (s *Server) addItemTags(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	var in itemTagsInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if len(in.Tags) == 0 {
+		problem.BadRequest(w, r, "tags is required")
+		return
+	}
+	if len(in.Tags) > maxItemTags {
+		problem.BadRequest(w, r, fmt.Sprintf("at most %d tags per request", maxItemTags))
+		return
+	}
+	tags, err := normalizeTags(in.Tags)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		INSERT INTO item_tags (org_id, item_id, tag)
+		SELECT $1, $2, unnest($3::text[])
+		ON CONFLICT (item_id, tag) DO NOTHING`,
+		auth.OrgIDFromContext(r.Context()), itemID, tags); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.writeItemTags(w, r, itemID)
+}
+
+// deleteItemTag removes one tag from an item
+func (s *Server) deleteItemTag(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := s.itemInOrg(w, r)
+	if !ok {
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(),
+		`DELETE FROM item_tags WHERE item_id = $1 AND org_id = $2 AND tag = $3`,
+		itemID, auth.OrgIDFromContext(r.Context()), strings.ToLower(chi.URLParam(r, "tag")))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeItemTags responds with the item's tags in name order
+func (s *Server) writeItemTags(w http.ResponseWriter, r *http.Request, itemID int) {
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(),
+		`SELECT tag FROM item_tags WHERE item_id = $1 AND org_id = $2 ORDER BY tag`,
+		itemID, auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+	out := itemTagsResponse{ItemID: itemID, Tags: []string{}}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out.Tags = append(out.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// listTags lists the org's tags with the number of live items carrying each,
+// most used first. ?q= narrows to tags starting with the given prefix.
+func (s *Server) listTags(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	cond := "t.org_id = $1 AND i.org_id = $1 AND i.deleted_at IS NULL"
+	args := []interface{}{orgID}
+	if params.q != "" {
+		args = append(args, strings.ToLower(params.q))
+		cond += fmt.Sprintf(" AND starts_with(t.tag, $%d)", len(args))
+	}
+	if clause, siteArgs := siteAccessClause(r.Context(), "i", len(args)+1); clause != "" {
+		cond += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT t.tag, COUNT(*), COUNT(*) OVER() as total_count
+		FROM item_tags t JOIN inventory i ON i.id = t.item_id
+		WHERE %s
+		GROUP BY t.tag
+		ORDER BY COUNT(*) DESC, t.tag
+		LIMIT %d OFFSET %d`, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	tags := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var tc tagCount
+		if err := rows.Scan(&tc.Tag, &tc.Count, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		tags = append(tags, tc)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, tags, totalCount, params, nil)
+}
@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := normalizeTags([]string{" Core ", "prod", "core", "site:ber-1"})
+	if err != nil || strings.Join(got, ",") != "core,prod,site:ber-1" {
+		t.Errorf("normalizeTags = %q, %v", got, err)
+	}
+	for _, bad := range []string{"", "-x", "two words", strings.Repeat("a", 51)} {
+		if _, err := normalizeTags([]string{bad}); err == nil {
+			t.Errorf("normalizeTags(%q) accepted", bad)
+		}
+	}
+}
+
+func TestListItemsRejectsBadTag(t *testing.T) {
+	s := &Server{}
+	w := serveAs(1, http.MethodGet, "/items", "/items?tag=ok&tag=not+ok", "", s.listItems)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// maxWarrantyAlertDays bounds the ?days= look-ahead of warranty alerts
+const maxWarrantyAlertDays = 3650
+
+// warrantyAlert is an item whose warranty has ended or ends within the window
+type warrantyAlert struct {
+	models.Item
+	DaysLeft int  `json:"days_left"`
+	Expired  bool `json:"expired"`
+}
+
+// listWarrantyAlerts lists items whose warranty ends within ?days= (default
+// 90), soonest first. ?include_expired=true adds items already out of
+// warranty. Retired and disposed items never alert.
+func (s *Server) listWarrantyAlerts(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	ctx := r.Context()
+
+	days := warrantyHorizonDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxWarrantyAlertDays {
+			problem.BadRequest(w, r, fmt.Sprintf("days must be an integer between 0 and %d", maxWarrantyAlertDays))
+			return
+		}
+		days = n
+	}
+	includeExpired := r.URL.Query().Get("include_expired") == "true"
+
+	where := `org_id = $1 AND deleted_at IS NULL AND warranty_end IS NOT NULL
+		AND status NOT IN ('retired', 'disposed') AND warranty_end <= CURRENT_DATE + $2::int`
+	if !includeExpired {
+		where += " AND warranty_end >= CURRENT_DATE"
+	}
+	args := []interface{}{auth.OrgIDFromContext(ctx), days}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", 3); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+
+	q := dbFrom(ctx, s.DB)
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
+		       installed_at, warranty_end, notes, status, created_at, updated_at,
+		       warranty_end - CURRENT_DATE, COUNT(*) OVER()
+		FROM inventory WHERE %s
+		ORDER BY warranty_end, id
+		LIMIT %d OFFSET %d`, where, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []interface{}{}
+	var totalCount int
+	for rows.Next() {
+		var a warrantyAlert
+		if err := rows.Scan(
+			&a.ID, &a.AssetTag, &a.Name, &a.Manufacturer, &a.Model, &a.DeviceType,
+			&a.Site, &a.InstalledAt, &a.WarrantyEnd, &a.Notes, &a.Status, &a.CreatedAt, &a.UpdatedAt,
+			&a.DaysLeft, &totalCount,
+		); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		a.Expired = a.DaysLeft < 0
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	sendListResponse(w, alerts, totalCount, params, nil)
+}
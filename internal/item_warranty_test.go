@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListWarrantyAlertsRejectsBadDays(t *testing.T) {
+	for _, days := range []string{"soon", "-1", "3651"} {
+		w := httptest.NewRecorder()
+		(&Server{}).listWarrantyAlerts(w, httptest.NewRequest(http.MethodGet, "/items/warranty-alerts?days="+days, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("days=%s: status = %d, want 400", days, w.Code)
+		}
+	}
+}
+
+func TestValidItemStatus(t *testing.T) {
+	for _, status := range []string{"ordered", "in_stock", "active", "in_repair", "retired", "disposed"} {
+		if !validItemStatus(status) {
+			t.Errorf("validItemStatus(%q) = false, want true", status)
+		}
+	}
+	for _, status := range []string{"", "Active", "lost"} {
+		if validItemStatus(status) {
+			t.Errorf("validItemStatus(%q) = true, want false", status)
+		}
+	}
+}
@@ -1,245 +1,358 @@
 package internal
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+	"era-inventory-api/internal/repo"
+	"era-inventory-api/internal/service"
 
 	"era-inventory-api/internal/auth"
-
-	"github.com/go-chi/chi/v5"
 )
 
+// itemFilter builds the WHERE clause GET /items and GET /items/export share:
+// the caller's org, not deleted, the status, q, tag and group parameters and
+// site grants
+func itemFilter(r *http.Request, params listParams) (*query.Where, error) {
+	f, err := itemListFilter(r, params)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ItemWhere(auth.OrgIDFromContext(r.Context()), f, itemScope(r.Context())), nil
+}
+
+// itemListFilter reads the status, q, tag and group parameters of an item list
+func itemListFilter(r *http.Request, params listParams) (repo.ItemFilter, error) {
+	f, err := checkItemFilter(r.URL.Query().Get("status"), params.q, r.URL.Query()["tag"])
+	if err != nil {
+		return repo.ItemFilter{}, err
+	}
+	// ?group= narrows to the members of an asset group
+	groupID, ok, err := groupParam(r)
+	if err != nil {
+		return repo.ItemFilter{}, err
+	}
+	if ok {
+		f.GroupID = groupID
+	}
+	return f, nil
+}
+
+// itemFilterFor is itemFilter for a status, search text and tags given directly
+func itemFilterFor(ctx context.Context, status, q string, tags []string) (*query.Where, error) {
+	f, err := checkItemFilter(status, q, tags)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ItemWhere(auth.OrgIDFromContext(ctx), f, itemScope(ctx)), nil
+}
+
+// checkItemFilter validates the status and normalizes the tags of an item
+// filter; repeated tags narrow, as an item must carry every one
+func checkItemFilter(status, q string, tags []string) (repo.ItemFilter, error) {
+	if status != "" && !validItemStatus(status) {
+		return repo.ItemFilter{}, errors.New("status must be one of: " + strings.Join(models.ItemStatuses, ", "))
+	}
+	if len(tags) > 0 {
+		var err error
+		if tags, err = normalizeTags(tags); err != nil {
+			return repo.ItemFilter{}, err
+		}
+	}
+	return repo.ItemFilter{Status: status, Query: q, Tags: tags}, nil
+}
+
 // LIST with basic filters & pagination
 func (s *Server) listItems(w http.ResponseWriter, r *http.Request) {
-	params := parseListParams(r)
-	orgID := auth.OrgIDFromContext(r.Context())
+	params := s.parseListParams(r)
+	f, err := itemListFilter(r, params)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
 
-	clauses := []string{}
-	args := []interface{}{}
-	arg := 1
+	// cursor or after_id switch to keyset pagination, which stays fast at any depth
+	opts := repo.ItemListOptions{ListOptions: params.options()}
+	if params.cursor != "" || params.afterID != "" {
+		after, err := parseItemKeyset(params)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+		opts.After = &after
+	}
 
-	// org filter - use context value instead of query param
-	clauses = append(clauses, fmt.Sprintf("org_id = $%d", arg))
-	args = append(args, orgID)
-	arg++
+	page, err := s.Items.List(r.Context(), auth.OrgIDFromContext(r.Context()), f, opts, itemScope(r.Context()))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
 
-	// optional text search on name/code/sku/serial → map to name or asset_tag
-	if params.q != "" {
-		clauses = append(clauses, fmt.Sprintf("(name ILIKE $%d OR asset_tag ILIKE $%d)", arg, arg))
-		args = append(args, "%"+params.q+"%")
-		arg++ // increment for next parameter position
+	items := make([]interface{}, 0, len(page.Rows))
+	for _, it := range page.Rows {
+		items = append(items, it)
+	}
+	var meta *listMeta
+	if page.Estimated {
+		meta = s.estimateMeta(page.Total)
 	}
 
-	whereClause := ""
-	if len(clauses) > 0 {
-		whereClause = " WHERE " + strings.Join(clauses, " AND ")
+	// Offer a cursor for the next page whenever the sort allows keyset paging
+	if page.More && len(page.Rows) > 0 {
+		if ks, err := query.ParseKeyset(params.sort, itemSort); err == nil {
+			last := page.Rows[len(page.Rows)-1]
+			params.nextCursor = query.Cursor{Sort: ks.Sort, Value: itemCursorValue(last, ks.Sort), ID: int64(last.ID)}.Encode()
+		}
 	}
 
-	// Build the main query with COUNT(*) OVER() to get total count
-	sqlStr := fmt.Sprintf(`
-		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
-		       installed_at, warranty_end, notes, created_at, updated_at,
-		       COUNT(*) OVER() as total_count
-		FROM inventory%s`, whereClause)
+	sendListResponse(w, items, page.Total, params, meta)
+}
 
-	allowedSort := map[string]string{
-		"id":         "id",
-		"name":       "name",
-		"created_at": "created_at",
-		"updated_at": "updated_at",
+// parseItemKeyset reads ?cursor= or its shorthand ?after_id=N (sort=id only)
+func parseItemKeyset(params listParams) (repo.ItemCursor, error) {
+	if params.offset > 0 {
+		return repo.ItemCursor{}, errors.New("offset cannot be combined with cursor or after_id")
+	}
+	var c query.Cursor
+	switch {
+	case params.cursor != "" && params.afterID != "":
+		return repo.ItemCursor{}, errors.New("use either cursor or after_id, not both")
+	case params.cursor != "":
+		var err error
+		if c, err = query.DecodeCursor(params.cursor); err != nil {
+			return repo.ItemCursor{}, errors.New("cursor is invalid")
+		}
+	default:
+		id, err := strconv.ParseInt(params.afterID, 10, 64)
+		if err != nil || id <= 0 {
+			return repo.ItemCursor{}, errors.New("after_id must be a positive integer")
+		}
+		c = query.Cursor{Sort: "id", ID: id}
+	}
+	if params.sort != "" && params.sort != c.Sort {
+		return repo.ItemCursor{}, fmt.Errorf("cursor was issued for sort=%s; keep the sort while paging", c.Sort)
 	}
-	sqlStr += buildOrderBy(params.sort, allowedSort)
-	sqlStr += fmt.Sprintf(" LIMIT %d OFFSET %d", params.limit, params.offset)
 
-	q := dbFrom(r.Context(), s.DB)
-	rows, err := q.QueryContext(r.Context(), sqlStr, args...)
+	ks, err := query.ParseKeyset(c.Sort, itemSort)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
+		return repo.ItemCursor{}, err
 	}
-	defer rows.Close()
-
-	items := []interface{}{}
-	var totalCount int
-	for rows.Next() {
-		var it models.Item
-		if err := rows.Scan(
-			&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
-			&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes, &it.CreatedAt, &it.UpdatedAt,
-			&totalCount,
-		); err != nil {
-			http.Error(w, err.Error(), 500)
-			return
+	out := repo.ItemCursor{Keyset: ks, Value: c.Value, ID: c.ID}
+	if ks.Column == "created_at" || ks.Column == "updated_at" {
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return repo.ItemCursor{}, errors.New("cursor is invalid")
 		}
-		items = append(items, it)
+		out.Value = t
 	}
+	return out, nil
+}
 
-	sendListResponse(w, items, totalCount, params)
+// itemCursorValue is the value of sort's key for it, as stored in a cursor
+func itemCursorValue(it models.Item, sort string) string {
+	switch strings.TrimPrefix(sort, "-") {
+	case "name":
+		return it.Name
+	case "status":
+		return it.Status
+	case "created_at":
+		return it.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		return it.UpdatedAt.Format(time.RFC3339Nano)
+	}
+	return ""
 }
 
 func (s *Server) getItem(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	var it models.Item
-	q := dbFrom(r.Context(), s.DB)
-	err := q.QueryRowContext(r.Context(), `
-		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
-		       installed_at, warranty_end, notes, created_at, updated_at
-		FROM inventory WHERE id = $1 AND org_id = $2`, id, orgID).Scan(
-		&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
-		&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes, &it.CreatedAt, &it.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		http.Error(w, "not found", http.StatusNotFound)
+	id, ok := pathID(w, r)
+	if !ok {
 		return
 	}
+	it, err := s.Items.Get(r.Context(), auth.OrgIDFromContext(r.Context()), id, itemScope(r.Context()))
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeServiceError(w, r, err)
 		return
 	}
+	if err := s.loadItemDetails(r.Context(), &it); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	setLastModified(w, it.UpdatedAt)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(it); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, err)
 	}
 }
 
 func (s *Server) createItem(w http.ResponseWriter, r *http.Request) {
 	var in models.Item
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "invalid JSON", 400)
+	if !s.decodeJSON(w, r, &in) {
 		return
 	}
-	if in.AssetTag == "" || in.Name == "" {
-		http.Error(w, "asset_tag and name are required", 400)
+	customFields, ok := s.checkItemCustomFields(w, r, in.DeviceType, nil, in.CustomFields)
+	if !ok {
 		return
 	}
-
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	q := dbFrom(r.Context(), s.DB)
-	err := q.QueryRowContext(r.Context(), `
-		INSERT INTO inventory (asset_tag, name, manufacturer, model, device_type, site, installed_at, warranty_end, notes, org_id)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-		RETURNING id, created_at, updated_at
-	`, in.AssetTag, in.Name, in.Manufacturer, in.Model, in.DeviceType, in.Site, in.InstalledAt, in.WarrantyEnd, in.Notes, orgID).
-		Scan(&in.ID, &in.CreatedAt, &in.UpdatedAt)
-	if err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "inventory_asset_tag_key") || strings.Contains(strings.ToLower(err.Error()), "unique") {
-			http.Error(w, "asset_tag already exists", http.StatusConflict)
+	in.CustomFields = customFields
+	if !s.itemRackFields(w, r, 0, nil, &in) {
+		return
+	}
+	if !s.checkItemQuota(w, r, 1) {
+		return
+	}
+	var details repo.DetailsStep
+	if detailsGiven(in.Details) {
+		d, err := parseItemDetails(in.DeviceType, in.Details)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
 			return
 		}
-		http.Error(w, err.Error(), 500)
+		details = itemDetailsWrite(in.DeviceType, d)
+	}
+
+	out, err := s.Items.Create(r.Context(), auth.OrgIDFromContext(r.Context()), in, details)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if err := s.loadItemDetails(r.Context(), &out); err != nil {
+		problem.Internal(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(in); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
 	}
 }
 
 func (s *Server) updateItem(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	var in models.Item
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "invalid JSON", 400)
+	id, ok := pathID(w, r)
+	if !ok {
 		return
 	}
+	orgID := auth.OrgIDFromContext(r.Context())
 
-	type set struct {
-		sql string
-		val interface{}
-	}
-	sets := make([]set, 0, 10)
-	if in.AssetTag != "" {
-		sets = append(sets, set{"asset_tag = $%d", in.AssetTag})
-	}
-	if in.Name != "" {
-		sets = append(sets, set{"name = $%d", in.Name})
-	}
-	if in.Manufacturer != "" {
-		sets = append(sets, set{"manufacturer = $%d", in.Manufacturer})
-	}
-	if in.Model != "" {
-		sets = append(sets, set{"model = $%d", in.Model})
-	}
-	if in.DeviceType != "" {
-		sets = append(sets, set{"device_type = $%d", in.DeviceType})
-	}
-	if in.Site != "" {
-		sets = append(sets, set{"site = $%d", in.Site})
-	}
-	if in.InstalledAt != nil {
-		sets = append(sets, set{"installed_at = $%d", in.InstalledAt})
-	}
-	if in.WarrantyEnd != nil {
-		sets = append(sets, set{"warranty_end = $%d", in.WarrantyEnd})
-	}
-	if in.Notes != "" {
-		sets = append(sets, set{"notes = $%d", in.Notes})
-	}
-	if len(sets) == 0 {
-		http.Error(w, "no fields to update", 400)
+	var in models.Item
+	if !s.decodeJSON(w, r, &in) {
 		return
 	}
+	upd := service.ItemUpdate{Item: in}
 
-	args := make([]interface{}, 0, len(sets)+2)
-	sqlStr := "UPDATE inventory SET "
-	for i, sset := range sets {
-		if i > 0 {
-			sqlStr += ", "
-		}
-		sqlStr += fmt.Sprintf(sset.sql, i+1)
-		args = append(args, sset.val)
-	}
-	sqlStr += fmt.Sprintf(" WHERE id = $%d AND org_id = $%d RETURNING id, asset_tag, name, manufacturer, model, device_type, site, installed_at, warranty_end, notes, created_at, updated_at", len(args)+1, len(args)+2)
-	args = append(args, id, orgID)
-
-	q := dbFrom(r.Context(), s.DB)
-	var out models.Item
-	if err := q.QueryRowContext(r.Context(), sqlStr, args...).Scan(
-		&out.ID, &out.AssetTag, &out.Name, &out.Manufacturer, &out.Model, &out.DeviceType,
-		&out.Site, &out.InstalledAt, &out.WarrantyEnd, &out.Notes, &out.CreatedAt, &out.UpdatedAt,
-	); err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "not found", http.StatusNotFound)
+	// rack placement, custom fields and details build on the stored item
+	placing := in.RackID != nil || in.RackPosition != nil || in.RackUnits != nil
+	if placing || in.CustomFields != nil || in.DeviceType != "" || detailsGiven(in.Details) {
+		stored, err := s.Items.Get(r.Context(), orgID, id, itemScope(r.Context()))
+		if err != nil {
+			writeServiceError(w, r, err)
 			return
 		}
-		if strings.Contains(strings.ToLower(err.Error()), "inventory_asset_tag_key") || strings.Contains(strings.ToLower(err.Error()), "unique") {
-			http.Error(w, "asset_tag already exists", http.StatusConflict)
+		if placing {
+			if !s.itemRackFields(w, r, int(id), &stored, &upd.Item) {
+				return
+			}
+			upd.Placed = true
+		}
+		deviceType := stored.DeviceType
+		if in.DeviceType != "" {
+			deviceType = in.DeviceType
+		}
+		customFields, ok := s.checkItemCustomFields(w, r, deviceType, stored.CustomFields, in.CustomFields)
+		if !ok {
 			return
 		}
-		http.Error(w, err.Error(), 500)
+		if in.CustomFields != nil {
+			upd.CustomFields = customFields
+		}
+		if detailsGiven(in.Details) {
+			d, err := parseItemDetails(deviceType, in.Details)
+			if err != nil {
+				problem.BadRequest(w, r, err.Error())
+				return
+			}
+			upd.Details = itemDetailsWrite(deviceType, d)
+		}
+	}
+
+	out, err := s.Items.Update(r.Context(), orgID, id, upd, itemScope(r.Context()))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if err := s.loadItemDetails(r.Context(), &out); err != nil {
+		problem.Internal(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(out); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, err)
 	}
 }
 
+// deleteItem soft-deletes: the item moves to the trash and disappears from
+// every other endpoint, but keeps its row, configs and asset_tag. An item that
+// contains others (item links) is only deleted with ?cascade=true, which
+// trashes everything it contains, recursively, along with it.
 func (s *Server) deleteItem(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	q := dbFrom(r.Context(), s.DB)
-	res, err := q.ExecContext(r.Context(), `DELETE FROM inventory WHERE id = $1 AND org_id = $2`, id, orgID)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
+	id, ok := pathID(w, r)
+	if !ok {
 		return
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		http.Error(w, "not found", http.StatusNotFound)
+	cascade := r.URL.Query().Get("cascade") == "true"
+	if err := s.Items.Delete(r.Context(), auth.OrgIDFromContext(r.Context()), id, cascade, itemScope(r.Context())); err != nil {
+		writeServiceError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// itemScope is the caller's site and project grants as a repo.Scope
+func itemScope(ctx context.Context) repo.Scope {
+	return func(table string, arg int) (string, []any) {
+		return siteAccessClause(ctx, table, arg)
+	}
+}
+
+// itemAccess answers the item service's questions about the caller's grants
+type itemAccess struct {
+	s *Server
+}
+
+func (a itemAccess) CanUseSite(ctx context.Context, site string) (bool, error) {
+	return a.s.canUseSite(ctx, site)
+}
+
+func (a itemAccess) CanUseProject(ctx context.Context, projectID int64) (bool, bool, error) {
+	return a.s.canUseProject(ctx, projectID)
+}
+
+func (itemAccess) ProjectRestricted(ctx context.Context) bool {
+	return projectRestricted(ctx)
+}
+
+// The item statements still written here share the repository's columns,
+// sort keys and outbox topics
+const (
+	topicItemCreated = repo.TopicItemCreated
+	topicItemUpdated = repo.TopicItemUpdated
+	topicItemDeleted = repo.TopicItemDeleted
+
+	itemEventColumns = repo.ItemEventColumns
+	itemColumns      = repo.ItemColumns
+)
+
+var (
+	itemScanDest    = repo.ItemScanDest
+	itemSort        = repo.ItemSort
+	assetGroupMatch = repo.AssetGroupMatch
+	validItemStatus = service.ValidItemStatus
+)
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"era-inventory-api/internal/i18n"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+	"era-inventory-api/internal/xlsx"
+)
+
+// itemExportColumns is the header row of GET /items/export
+var itemExportColumns = []string{
+	"id", "asset_tag", "name", "manufacturer", "model", "device_type", "site", "status",
+	"installed_at", "warranty_end", "notes", "created_at", "updated_at",
+}
+
+// itemExportLayout keeps the xlsx header in view with readable column widths
+var itemExportLayout = xlsx.Layout{
+	Widths:     []float64{8, 16, 30, 18, 18, 14, 20, 10, 12, 12, 40, 21, 21},
+	FreezeRows: 1,
+}
+
+// itemExportFormats maps ?format= to the response content type
+var itemExportFormats = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"xlsx": xlsx.ContentType,
+}
+
+// rowWriter is the part of csv and xlsx output exportItemsFile needs
+type rowWriter interface {
+	WriteRow(cells []string) error
+	Close() error
+}
+
+// csvRows adapts csv.Writer to rowWriter
+type csvRows struct{ *csv.Writer }
+
+func (c csvRows) WriteRow(cells []string) error { return c.Write(cells) }
+
+func (c csvRows) Close() error {
+	c.Flush()
+	return c.Error()
+}
+
+// exportItemsFile streams every item matching the GET /items filters and sort,
+// unpaged, as a CSV or XLSX download. Unlike POST /exports nothing is stored:
+// rows go to the client as they are read.
+func (s *Server) exportItemsFile(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := itemExportFormats[format]
+	if !ok {
+		problem.BadRequest(w, r, "format must be csv or xlsx")
+		return
+	}
+	lang, ok := exportLang(w, r)
+	if !ok {
+		return
+	}
+	params := s.parseListParams(r)
+	where, err := itemFilter(r, params)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	sqlStr := `
+		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
+		       installed_at, warranty_end, notes, status, created_at, updated_at
+		FROM inventory` + where.Clause() + query.OrderBy(params.sort, itemSort)
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), sqlStr, where.Args()...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="items-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+	w.Header().Set("Content-Language", lang)
+
+	// From here on the status is sent; a failure can only cut the download short
+	var out rowWriter = csvRows{csv.NewWriter(flushWriter{w})}
+	if format == "xlsx" {
+		if out, err = xlsx.NewWriterLayout(flushWriter{w}, "Items", itemExportLayout); err != nil {
+			log.Printf("items export: %v", err)
+			return
+		}
+	}
+	n, err := writeItemRows(out, rows, lang)
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		log.Printf("items export: stopped after %d rows: %v", n, err)
+	}
+}
+
+// flushWriter sends every write on to the client at once, so a long download
+// starts arriving while rows are still read
+type flushWriter struct{ w http.ResponseWriter }
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	if err := http.NewResponseController(f.w).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return n, err
+	}
+	return n, nil
+}
+
+// writeItemRows writes the header, in lang, and one row per item, returning
+// the item count
+func writeItemRows(out rowWriter, rows *sql.Rows, lang string) (int, error) {
+	writeHeader := out.WriteRow
+	if h, ok := out.(interface{ WriteHeader([]string) error }); ok {
+		writeHeader = h.WriteHeader
+	}
+	if err := writeHeader(i18n.Headers(lang, itemExportColumns)); err != nil {
+		return 0, err
+	}
+	n := 0
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(
+			&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
+			&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes, &it.Status, &it.CreatedAt, &it.UpdatedAt,
+		); err != nil {
+			return n, err
+		}
+		if err := out.WriteRow(itemExportRecord(it)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// itemExportRecord renders it in itemExportColumns order
+func itemExportRecord(it models.Item) []string {
+	return []string{
+		strconv.Itoa(it.ID), it.AssetTag, it.Name, it.Manufacturer, it.Model, it.DeviceType, it.Site, it.Status,
+		formatDate(it.InstalledAt), formatDate(it.WarrantyEnd), it.Notes,
+		it.CreatedAt.Format(time.RFC3339), it.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"encoding/csv"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/models"
+)
+
+func TestExportItemsFileRejectsBadParams(t *testing.T) {
+	s := &Server{}
+	for _, path := range []string{"/items/export?format=pdf", "/items/export?status=lost"} {
+		w := serveAs(1, http.MethodGet, "/items/export", path, "", s.exportItemsFile)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", path, w.Code)
+		}
+	}
+}
+
+func TestItemExportRecord(t *testing.T) {
+	installed := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	it := models.Item{
+		ID: 7, AssetTag: "SW-1", Name: "Core switch", DeviceType: "switch", Site: "HQ",
+		Status: "active", InstalledAt: &installed, Notes: "rack 2, U12", CreatedAt: created, UpdatedAt: created,
+	}
+	got := itemExportRecord(it)
+	want := []string{"7", "SW-1", "Core switch", "", "", "switch", "HQ", "active",
+		"2023-04-01", "", "rack 2, U12", "2024-01-02T03:04:05Z", "2024-01-02T03:04:05Z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("record = %q, want %q", got, want)
+	}
+	if len(got) != len(itemExportColumns) {
+		t.Errorf("%d cells for %d columns", len(got), len(itemExportColumns))
+	}
+
+	var sb strings.Builder
+	out := csvRows{csv.NewWriter(&sb)}
+	if err := out.WriteRow(got); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), `"rack 2, U12"`) {
+		t.Errorf("csv = %s", sb.String())
+	}
+}
@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/query"
+)
+
+func TestParseItemKeyset(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC)
+	byCreated := query.Cursor{Sort: "-created_at", Value: itemCursorValue(models.Item{CreatedAt: created}, "-created_at"), ID: 7}.Encode()
+
+	ks, err := parseItemKeyset(listParams{cursor: byCreated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Column != "created_at" || !ks.Desc || ks.ID != 7 || !ks.Value.(time.Time).Equal(created) {
+		t.Errorf("keyset = %+v", ks)
+	}
+
+	ks, err = parseItemKeyset(listParams{afterID: "120"})
+	if err != nil || ks.Column != "id" || ks.ID != 120 {
+		t.Errorf("after_id keyset = %+v, %v", ks, err)
+	}
+
+	for name, p := range map[string]listParams{
+		"garbage cursor":     {cursor: "x"},
+		"cursor and offset":  {cursor: byCreated, offset: 50},
+		"cursor and after":   {cursor: byCreated, afterID: "1"},
+		"sort changed":       {cursor: byCreated, sort: "name"},
+		"after_id not an id": {afterID: "abc"},
+		"after_id by name":   {afterID: "5", sort: "name"},
+		"bad cursor time":    {cursor: query.Cursor{Sort: "created_at", Value: "yesterday", ID: 1}.Encode()},
+		"unsortable cursor":  {cursor: query.Cursor{Sort: "asset_tag", ID: 1}.Encode()},
+	} {
+		if _, err := parseItemKeyset(p); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package jobs runs long-running work (exports, bulk operations) outside the
+// request that asked for it. Jobs are persisted in the jobs table so their
+// status survives restarts and can be polled by clients.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"era-inventory-api/internal/models"
+)
+
+// Handler executes a job and returns a JSON-serialisable result
+type Handler func(ctx context.Context, job *models.Job) (interface{}, error)
+
+// ErrUnknownKind is returned when enqueuing a job kind with no registered handler
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// pollInterval is how often idle workers look for queued jobs enqueued by
+// other instances.
+const pollInterval = time.Second
+
+// Running jobs are marked alive every heartbeatInterval. One not marked for
+// staleAfter lost its worker (a crash or kill skips the outcome update) and
+// is failed, so it does not hold its org's share of workers forever.
+const (
+	heartbeatInterval = 30 * time.Second
+	staleAfter        = 5 * heartbeatInterval
+)
+
+// errAbandoned is recorded on the jobs whose worker stopped heartbeating
+const errAbandoned = "job abandoned: its worker stopped before finishing it"
+
+const jobColumns = `id, org_id, kind, status, params, result, error, created_by,
+	created_at, updated_at, started_at, finished_at`
+
+// Runner claims queued jobs from the database and dispatches them to handlers
+type Runner struct {
+	db       *sql.DB
+	handlers map[string]Handler
+	wake     chan struct{}
+	// perOrg caps the jobs of one organization running at once (0 = no cap)
+	perOrg int
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRunner creates a runner backed by the jobs table
+func NewRunner(db *sql.DB) *Runner {
+	return &Runner{
+		db:       db,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register associates a handler with a job kind. It must be called before Start.
+func (r *Runner) Register(kind string, h Handler) {
+	r.handlers[kind] = h
+}
+
+// LimitPerOrg caps how many jobs of one organization run at once, so a
+// single tenant's heavy work queues behind itself instead of occupying every
+// worker. It must be called before Start; 0 removes the cap. Instances check
+// the cap independently, so it is soft across several instances.
+func (r *Runner) LimitPerOrg(n int) {
+	r.perOrg = n
+}
+
+// Start launches the given number of worker goroutines
+func (r *Runner) Start(workers int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	for i := 0; i < workers; i++ {
+		r.wg.Add(1)
+		go r.work(ctx)
+	}
+}
+
+// Stop cancels running jobs and waits for workers to exit
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	r.wg.Wait()
+}
+
+// Enqueue records a new job and wakes an idle worker
+func (r *Runner) Enqueue(ctx context.Context, orgID, userID int64, kind string, params interface{}) (*models.Job, error) {
+	if _, ok := r.handlers[kind]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKind, kind)
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var createdBy interface{}
+	if userID > 0 {
+		createdBy = userID
+	}
+	job, err := scanJob(r.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (org_id, kind, params, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+jobColumns, orgID, kind, raw, createdBy))
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns a job owned by the given organization, or sql.ErrNoRows
+func (r *Runner) Get(ctx context.Context, orgID, id int64) (*models.Job, error) {
+	return scanJob(r.db.QueryRowContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs WHERE id = $1 AND org_id = $2`, id, orgID))
+}
+
+// Position returns where a queued job stands in its organization's queue,
+// 1 being next; 0 when it is no longer queued
+func (r *Runner) Position(ctx context.Context, job *models.Job) (int, error) {
+	if job.Status != models.JobQueued {
+		return 0, nil
+	}
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM jobs WHERE org_id = $1 AND status = 'queued' AND id <= $2`,
+		job.OrgID, job.ID).Scan(&n)
+	return n, err
+}
+
+// RecentFailed returns the organization's most recently failed jobs
+func (r *Runner) RecentFailed(ctx context.Context, orgID int64, limit int) ([]models.Job, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE org_id = $1 AND status = 'failed'
+		ORDER BY finished_at DESC NULLS LAST, id DESC
+		LIMIT $2`, orgID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *j)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *Runner) work(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.failStale(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("jobs: failing stale jobs: %v", err)
+		}
+		for {
+			job, err := r.claim(ctx)
+			if err != nil {
+				if ctx.Err() == nil && err != sql.ErrNoRows {
+					log.Printf("jobs: claim failed: %v", err)
+				}
+				break
+			}
+			r.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim atomically moves the oldest queued job to running, skipping
+// organizations already running their share of jobs
+func (r *Runner) claim(ctx context.Context) (*models.Job, error) {
+	return scanJob(r.db.QueryRowContext(ctx, `
+		UPDATE jobs SET status = 'running', started_at = NOW(), heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs q WHERE status = 'queued'
+			  AND ($1 = 0 OR (SELECT COUNT(*) FROM jobs j WHERE j.org_id = q.org_id AND j.status = 'running') < $1)
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING `+jobColumns, r.perOrg))
+}
+
+// failStale fails the running jobs whose heartbeat is older than staleAfter
+func (r *Runner) failStale(ctx context.Context) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE jobs SET status = $1, error = $2, finished_at = NOW()
+		WHERE status = 'running'
+		  AND COALESCE(heartbeat_at, started_at, updated_at) < NOW() - $3 * INTERVAL '1 second'`,
+		models.JobFailed, errAbandoned, staleAfter.Seconds())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("jobs: failed %d abandoned jobs", n)
+	}
+	return nil
+}
+
+// heartbeat marks the job alive every heartbeatInterval until ctx is done
+func (r *Runner) heartbeat(ctx context.Context, id int64) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.db.ExecContext(ctx, `
+				UPDATE jobs SET heartbeat_at = NOW() WHERE id = $1 AND status = 'running'`, id); err != nil && ctx.Err() == nil {
+				log.Printf("jobs: heartbeat of job %d: %v", id, err)
+			}
+		}
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job *models.Job) {
+	beatCtx, stopBeat := context.WithCancel(ctx)
+	go r.heartbeat(beatCtx, job.ID)
+	defer stopBeat()
+
+	var (
+		result interface{}
+		err    error
+	)
+	if h, ok := r.handlers[job.Kind]; ok {
+		result, err = safeRun(ctx, h, job)
+	} else {
+		err = fmt.Errorf("%w: %s", ErrUnknownKind, job.Kind)
+	}
+
+	status := models.JobSucceeded
+	var errMsg interface{}
+	var raw []byte
+	if err != nil {
+		status = models.JobFailed
+		errMsg = err.Error()
+	} else if result != nil {
+		if raw, err = json.Marshal(result); err != nil {
+			status = models.JobFailed
+			errMsg = err.Error()
+		}
+	}
+
+	// Use a fresh context so a shutdown still records the outcome
+	finishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := r.db.ExecContext(finishCtx, `
+		UPDATE jobs SET status = $1, result = $2, error = $3, finished_at = NOW()
+		WHERE id = $4`, status, raw, errMsg, job.ID); err != nil {
+		log.Printf("jobs: failed to record outcome of job %d: %v", job.ID, err)
+	}
+}
+
+// safeRun converts handler panics into job failures
+func safeRun(ctx context.Context, h Handler, job *models.Job) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return h(ctx, job)
+}
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*models.Job, error) {
+	var j models.Job
+	var params, result []byte
+	if err := row.Scan(&j.ID, &j.OrgID, &j.Kind, &j.Status, &params, &result, &j.Error, &j.CreatedBy,
+		&j.CreatedAt, &j.UpdatedAt, &j.StartedAt, &j.FinishedAt); err != nil {
+		return nil, err
+	}
+	j.Params = params
+	if result != nil {
+		j.Result = result
+	}
+	return &j, nil
+}
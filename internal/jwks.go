@@ -0,0 +1,19 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"era-inventory-api/internal/problem"
+)
+
+// getJWKS publishes the public keys tokens are signed with, so other services
+// can verify them without the shared secret. The set is empty while tokens
+// are signed with JWT_SECRET.
+func (s *Server) getJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.JWTManager.JWKS()}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
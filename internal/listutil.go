@@ -1,10 +1,26 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+	"era-inventory-api/internal/repo"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Built-in page sizes of list endpoints: ?limit= defaults to
+// defaultListLimit and larger values are capped at maxListLimit. The server
+// configuration may change both, and the cap of single routes; see listLimits.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
 )
 
 // listParams holds common query parameters for list endpoints
@@ -13,12 +29,33 @@ type listParams struct {
 	offset int
 	q      string
 	sort   string
+
+	// the page size policy of the route, and the ?limit= it cut down (0 if none)
+	defaultLimit int
+	maxLimit     int
+	capped       int
+
+	// keyset pagination, on endpoints that support it
+	cursor     string
+	afterID    string
+	nextCursor string
 }
 
 // listResponse wraps list data with pagination information
 type listResponse struct {
 	Data []interface{} `json:"data"`
 	Page pageInfo      `json:"page"`
+	Meta *listMeta     `json:"meta,omitempty"`
+}
+
+// listMeta carries hints about how a list result was produced, and the
+// page size policy of the endpoint
+type listMeta struct {
+	DefaultLimit   int      `json:"default_limit,omitempty"`
+	MaxLimit       int      `json:"max_limit,omitempty"`
+	Estimate       bool     `json:"estimate,omitempty"`
+	EstimatedTotal int      `json:"estimated_total,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
 }
 
 // pageInfo contains pagination metadata
@@ -26,44 +63,99 @@ type pageInfo struct {
 	Limit  int `json:"limit"`
 	Offset int `json:"offset"`
 	Total  int `json:"total"`
+	// NextCursor fetches the following page with ?cursor=; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// options converts the parameters for the repositories
+func (p listParams) options() repo.ListOptions {
+	return repo.ListOptions{Query: p.q, Sort: p.sort, Limit: p.limit, Offset: p.offset}
 }
 
-// sendListResponse sends a JSON response wrapped in the standard list envelope
-func sendListResponse(w http.ResponseWriter, data []interface{}, total int, params listParams) {
+// sendListResponse sends a JSON response wrapped in the standard list envelope.
+// meta may be nil when there is nothing to report beyond pagination; the
+// page size policy from params, and the deprecation of the route, are added
+// to it either way.
+func sendListResponse(w http.ResponseWriter, data []interface{}, total int, params listParams, meta *listMeta) {
 	w.Header().Set("Content-Type", "application/json")
 
+	if params.maxLimit > 0 {
+		if meta == nil {
+			meta = &listMeta{}
+		}
+		meta.DefaultLimit, meta.MaxLimit = params.defaultLimit, params.maxLimit
+		if params.capped > 0 {
+			meta.Warnings = append(meta.Warnings,
+				fmt.Sprintf("limit %d is above the maximum of %d; page.limit was capped", params.capped, params.maxLimit))
+		}
+	}
+	if warning := deprecationWarning(w.Header()); warning != "" {
+		if meta == nil {
+			meta = &listMeta{}
+		}
+		meta.Warnings = append(meta.Warnings, warning)
+	}
+
 	response := listResponse{
 		Data: data,
 		Page: pageInfo{
-			Limit:  params.limit,
-			Offset: params.offset,
-			Total:  total,
+			Limit:      params.limit,
+			Offset:     params.offset,
+			Total:      total,
+			NextCursor: params.nextCursor,
 		},
+		Meta: meta,
 	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, nil, err)
 	}
 }
 
-// parseListParams parses limit, offset, q, and sort from the request
-// Defaults: limit=50 (max 200), offset=0
-func parseListParams(r *http.Request) listParams {
+// listLimits is the default and maximum ?limit= of the list endpoint
+// mounted at path: the configured page sizes, or the built-in ones where
+// unset, with the route's own cap taking precedence
+func (s *Server) listLimits(path string) (def, max int) {
+	def, max = defaultListLimit, maxListLimit
+	if s.ListMaxLimit > 0 {
+		max = s.ListMaxLimit
+	}
+	if n := s.ListMaxLimits[path]; n > 0 {
+		max = n
+	}
+	if s.ListDefaultLimit > 0 {
+		def = s.ListDefaultLimit
+	}
+	if def > max {
+		def = max
+	}
+	return def, max
+}
+
+// parseListParams parses limit, offset, q, and sort from the request.
+// limit follows listLimits of the matched route and offset defaults to 0.
+func (s *Server) parseListParams(r *http.Request) listParams {
 	values := r.URL.Query()
 
-	limit := 50
-	if s := strings.TrimSpace(values.Get("limit")); s != "" {
-		if v, err := strconv.Atoi(s); err == nil && v > 0 {
-			if v > 200 {
-				v = 200
+	path := r.URL.Path
+	if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+		path = rc.RoutePattern()
+	}
+	def, max := s.listLimits(path)
+
+	limit, capped := def, 0
+	if raw := strings.TrimSpace(values.Get("limit")); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			if v > max {
+				capped, v = v, max
 			}
 			limit = v
 		}
 	}
 
 	offset := 0
-	if s := strings.TrimSpace(values.Get("offset")); s != "" {
-		if v, err := strconv.Atoi(s); err == nil && v >= 0 {
+	if raw := strings.TrimSpace(values.Get("offset")); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
 			offset = v
 		}
 	}
@@ -73,48 +165,34 @@ func parseListParams(r *http.Request) listParams {
 		offset: offset,
 		q:      strings.TrimSpace(values.Get("q")),
 		sort:   strings.TrimSpace(values.Get("sort")),
+
+		defaultLimit: def,
+		maxLimit:     max,
+		capped:       capped,
+
+		cursor:  strings.TrimSpace(values.Get("cursor")),
+		afterID: strings.TrimSpace(values.Get("after_id")),
 	}
 }
 
-// buildOrderBy builds a safe ORDER BY clause using a whitelist of allowed keys.
-// allowed maps incoming sort keys (e.g., "name") to actual column identifiers.
-// Input sort is comma-separated; prefix with '-' for DESC.
-// Returns a string starting with " ORDER BY ...". Defaults to " ORDER BY id ASC".
-func buildOrderBy(sortParam string, allowed map[string]string) string {
-	if sortParam == "" {
-		if col, ok := allowed["id"]; ok {
-			return " ORDER BY " + col + " ASC"
-		}
-		return " ORDER BY id ASC"
+// countExpr picks the total_count expression for a list query over from
+// (a table name followed by its WHERE clause); see query.CountExpr. When the
+// count is skipped the returned meta reports the planner estimate.
+func (s *Server) countExpr(ctx context.Context, q querier, from string, args []interface{}) (string, *listMeta) {
+	expr, estimate := query.CountExpr(ctx, q, from, args, s.ListScanBudget)
+	if estimate == 0 {
+		return expr, nil
 	}
+	return expr, s.estimateMeta(estimate)
+}
 
-	parts := strings.Split(sortParam, ",")
-	clauses := make([]string, 0, len(parts))
-	for _, raw := range parts {
-		s := strings.TrimSpace(raw)
-		if s == "" {
-			continue
-		}
-		desc := false
-		if strings.HasPrefix(s, "-") {
-			desc = true
-			s = strings.TrimPrefix(s, "-")
-		}
-		col, ok := allowed[s]
-		if !ok {
-			continue
-		}
-		if desc {
-			clauses = append(clauses, col+" DESC")
-		} else {
-			clauses = append(clauses, col+" ASC")
-		}
-	}
-	if len(clauses) == 0 {
-		if col, ok := allowed["id"]; ok {
-			return " ORDER BY " + col + " ASC"
-		}
-		return " ORDER BY id ASC"
+// estimateMeta explains a page.total that is a planner estimate
+func (s *Server) estimateMeta(estimate int) *listMeta {
+	return &listMeta{
+		Estimate:       true,
+		EstimatedTotal: estimate,
+		Warnings: []string{
+			fmt.Sprintf("query matches roughly %d rows, above the scan budget of %d; page.total is an estimate. Add filters (e.g. q) to narrow the result.", estimate, s.ListScanBudget),
+		},
 	}
-	return " ORDER BY " + strings.Join(clauses, ", ")
 }
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/testutil"
+)
+
+func TestListLimits(t *testing.T) {
+	s := &Server{}
+	if def, max := s.listLimits("/items"); def != defaultListLimit || max != maxListLimit {
+		t.Errorf("built-in limits = %d/%d", def, max)
+	}
+
+	s = &Server{ListDefaultLimit: 25, ListMaxLimit: 100, ListMaxLimits: map[string]int{"/items": 500, "/changes": 10}}
+	for path, want := range map[string][2]int{"/sites": {25, 100}, "/items": {25, 500}, "/changes": {10, 10}} {
+		if def, max := s.listLimits(path); def != want[0] || max != want[1] {
+			t.Errorf("%s: limits = %d/%d, want %d/%d", path, def, max, want[0], want[1])
+		}
+	}
+}
+
+func TestListResponseReportsLimits(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	f.Site("Berlin").Create()
+	s := fixtureServer(f)
+	s.ListMaxLimits = map[string]int{"/sites": 5}
+
+	for query, want := range map[string]struct {
+		limit  int
+		capped bool
+	}{"": {defaultListLimit, false}, "?limit=3": {3, false}, "?limit=500": {5, true}} {
+		w := serveAs(1, http.MethodGet, "/sites", "/sites"+query, "", s.listSites)
+		var resp struct {
+			Page pageInfo `json:"page"`
+			Meta listMeta `json:"meta"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Page.Limit != min(want.limit, 5) || resp.Meta.DefaultLimit != 5 || resp.Meta.MaxLimit != 5 {
+			t.Errorf("%q: page %+v meta %+v", query, resp.Page, resp.Meta)
+		}
+		if warned := len(resp.Meta.Warnings) == 1 && strings.Contains(resp.Meta.Warnings[0], "limit 500"); warned != want.capped {
+			t.Errorf("%q: warnings = %q", query, resp.Meta.Warnings)
+		}
+	}
+}
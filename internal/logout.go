@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/service"
+)
+
+// logoutRequest is the optional body of POST /auth/logout
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// logout revokes the presented access token so it stops working before it
+// expires, and ends the session of refresh_token when one is given
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		problem.Write(w, r, http.StatusUnauthorized, "AUTHENTICATION_REQUIRED", "Authentication required")
+		return
+	}
+
+	var in logoutRequest
+	if !s.decodeOptionalJSON(w, r, &in) {
+		return
+	}
+	if claims.ID == "" {
+		problem.BadRequest(w, r, "token has no ID (jti) and cannot be revoked; request a new token")
+		return
+	}
+
+	expiresAt := time.Now().Add(s.JWTManager.Expiry())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := s.RevokedTokens.Revoke(r.Context(), claims.ID, claims.UserID, claims.OrgID, expiresAt); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.Revocations.Revoke(claims.ID, expiresAt)
+
+	if in.RefreshToken != "" && s.Sessions != nil {
+		// an unknown or already revoked session is as good as ended
+		if err := s.Sessions.Revoke(r.Context(), in.RefreshToken); err != nil && !errors.Is(err, service.ErrInvalidRefreshToken) {
+			problem.Internal(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncRevocations loads revocations recorded by every instance into the
+// in-memory list and deletes those of tokens that have expired
+func (s *Server) syncRevocations(ctx context.Context) error {
+	active, err := s.RevokedTokens.Active(ctx)
+	if err != nil {
+		return err
+	}
+	s.Revocations.Merge(active)
+	s.Revocations.Prune(time.Now())
+	_, err = s.RevokedTokens.Prune(ctx, time.Now())
+	return err
+}
+
+// startRevocationSync runs syncRevocations every interval until Close, so a
+// logout on one instance takes effect on the others within that interval.
+// Custom roles are reloaded on the same tick.
+// A zero interval disables it.
+func (s *Server) startRevocationSync(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.revocationStop = make(chan struct{})
+	s.revocationDone = make(chan struct{})
+	go func() {
+		defer close(s.revocationDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.revocationStop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				if err := s.syncRevocations(ctx); err != nil {
+					log.Printf("revocation sync failed: %v", err)
+				}
+				if s.Roles != nil {
+					if err := s.Roles.Sync(ctx); err != nil {
+						log.Printf("role sync failed: %v", err)
+					}
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// stopRevocationSync stops the loop started by startRevocationSync and waits for it
+func (s *Server) stopRevocationSync() {
+	if s.revocationStop == nil {
+		return
+	}
+	close(s.revocationStop)
+	<-s.revocationDone
+	s.revocationStop = nil
+}
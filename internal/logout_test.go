@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/testutil"
+)
+
+func TestLogoutRevokesToken(t *testing.T) {
+	s := newRoutedServer()
+	s.RevokedTokens = testutil.NewMemRevokedTokens()
+	s.Revocations = auth.NewRevocations()
+	s.JWTManager.SetRevocations(s.Revocations)
+	s.Sessions = service.NewSessions(testutil.NewMemRefreshTokens(), s.JWTManager, 24*time.Hour, 0)
+
+	do := func(path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		return w
+	}
+
+	token, _ := s.JWTManager.GenerateToken(1, 1, []string{"auditor"})
+	other, _ := s.JWTManager.GenerateToken(1, 1, []string{"auditor"})
+	session, err := s.Sessions.Start(context.Background(), &auth.Claims{UserID: 1, OrgID: 1, Roles: []string{"auditor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := do("/auth/logout", token, `{"refresh_token":"`+session.RefreshToken+`"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("logout = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("/auth/token/exchange", token, `{}`); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "TOKEN_REVOKED") {
+		t.Errorf("logged-out token = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("/auth/token/exchange", other, `{}`); w.Code != http.StatusOK {
+		t.Errorf("other token of the same user = %d, want 200", w.Code)
+	}
+	if _, err := s.Sessions.Refresh(context.Background(), session.RefreshToken); err == nil {
+		t.Error("session survived logout")
+	}
+	if w := do("/auth/logout", other, `{`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", w.Code)
+	}
+
+	// another instance picks the revocation up on its next sync
+	peer := &Server{RevokedTokens: s.RevokedTokens, Revocations: auth.NewRevocations()}
+	if err := peer.syncRevocations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := s.JWTManager.ValidateToken(other)
+	if peer.Revocations.Len() != 1 || peer.Revocations.IsRevoked(claims.ID) {
+		t.Errorf("peer holds %d revocations", peer.Revocations.Len())
+	}
+}
@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultClient bounds provider API calls
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// SendGrid sends through the SendGrid v3 mail API
+type SendGrid struct {
+	APIKey string
+	From   string
+	// Endpoint overrides the API URL (tests); Client defaults to a 30s timeout
+	Endpoint string
+	Client   *http.Client
+}
+
+func (s *SendGrid) Send(ctx context.Context, m Message) error {
+	if err := m.validate(); err != nil {
+		return Permanent(err)
+	}
+	to := make([]map[string]string, len(m.To))
+	for i, addr := range m.To {
+		to[i] = map[string]string{"email": addr}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"personalizations": []interface{}{map[string]interface{}{"to": to}},
+		"from":             map[string]string{"email": s.From},
+		"subject":          m.Subject,
+		"content":          []interface{}{map[string]string{"type": "text/plain", "value": m.Text}},
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://api.sendgrid.com/v3/mail/send"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return do(s.Client, req, "sendgrid")
+}
+
+// SES sends through the Amazon SES v2 API, signing requests with AWS
+// Signature Version 4
+type SES struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	From            string
+	// Endpoint overrides the regional API URL (tests); Client defaults to a 30s timeout
+	Endpoint string
+	Client   *http.Client
+}
+
+func (s *SES) Send(ctx context.Context, m Message) error {
+	if err := m.validate(); err != nil {
+		return Permanent(err)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": s.From,
+		"Destination":      map[string]interface{}{"ToAddresses": m.To},
+		"Content": map[string]interface{}{"Simple": map[string]interface{}{
+			"Subject": map[string]string{"Data": m.Subject, "Charset": "UTF-8"},
+			"Body":    map[string]interface{}{"Text": map[string]string{"Data": m.Text, "Charset": "UTF-8"}},
+		}},
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://email." + s.Region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signV4(req, body, s.Region, "ses", s.AccessKeyID, s.SecretAccessKey, time.Now())
+	return do(s.Client, req, "ses")
+}
+
+// do sends req and maps the response: 2xx is success, 429 and 5xx are worth
+// retrying and any other status is permanent
+func do(client *http.Client, req *http.Request, provider string) error {
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s: %s", provider, resp.Status, strings.TrimSpace(string(detail)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return Permanent(err)
+}
+
+// signV4 adds AWS Signature Version 4 headers to req, signing host,
+// x-amz-date and content-type (when set)
+func signV4(req *http.Request, body []byte, region, service, keyID, secret string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host, "x-amz-date": amzDate}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, req.URL.Query().Encode(), canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,70 @@
+// Package mail sends email through a pluggable provider. Callers never send
+// directly: they Enqueue a message in the database, and a Queue delivers it
+// in the background, retrying failures with backoff and parking messages
+// that keep failing as dead letters that an admin can inspect and retry.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Message is one plain-text email
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers a message through one provider
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the queue gives up on the message at once
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// validate rejects messages no provider could deliver
+func (m Message) validate() error {
+	if len(m.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	for _, to := range m.To {
+		if strings.ContainsAny(to, "\r\n") {
+			return fmt.Errorf("recipient %q contains a line break", to)
+		}
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return errors.New("subject contains a line break")
+	}
+	return nil
+}
+
+// Log writes messages to the standard logger instead of sending them, for
+// development
+type Log struct{}
+
+func (Log) Send(_ context.Context, m Message) error {
+	if err := m.validate(); err != nil {
+		return Permanent(err)
+	}
+	log.Printf("mail: to=%s subject=%q (%d bytes, not sent: MAIL_PROVIDER=log)", strings.Join(m.To, ","), m.Subject, len(m.Text))
+	return nil
+}
@@ -0,0 +1,133 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The get-vanilla case of the AWS Signature Version 4 test suite
+func TestSignV4(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signV4(req, nil, "us-east-1", "service", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+	if req.Header.Get("X-Amz-Date") != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %s", req.Header.Get("X-Amz-Date"))
+	}
+}
+
+func TestSendGrid(t *testing.T) {
+	status := http.StatusAccepted
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer SG.key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := &SendGrid{APIKey: "SG.key", From: "ops@example.com", Endpoint: srv.URL}
+	m := Message{To: []string{"a@example.com"}, Subject: "Hi", Text: "Body"}
+	if err := s.Send(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if got["subject"] != "Hi" || got["from"].(map[string]interface{})["email"] != "ops@example.com" {
+		t.Errorf("payload = %v", got)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := s.Send(context.Background(), m); err == nil || IsPermanent(err) {
+		t.Errorf("503: err = %v, want a retryable error", err)
+	}
+	status = http.StatusBadRequest
+	if err := s.Send(context.Background(), m); !IsPermanent(err) {
+		t.Errorf("400: err = %v, want a permanent error", err)
+	}
+}
+
+func TestSESSignsRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/ses/aws4_request, SignedHeaders=content-type;host;x-amz-date,") {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s := &SES{Region: "eu-west-1", AccessKeyID: "AKID", SecretAccessKey: "secret", From: "ops@example.com", Endpoint: srv.URL}
+	if err := s.Send(context.Background(), Message{To: []string{"a@example.com"}, Subject: "Hi", Text: "Body"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSMTPRender(t *testing.T) {
+	s := &SMTP{From: "ops@example.com"}
+	msg := string(s.render(Message{To: []string{"a@example.com", "b@example.com"}, Subject: "Prüfung", Text: "line 1\nline 2"}, time.Unix(0, 0).UTC()))
+
+	for _, want := range []string{
+		"From: ops@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: =?utf-8?q?Pr=C3=BCfung?=\r\n",
+		"\r\n\r\nline 1\r\nline 2",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message lacks %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestMessagesWithHeaderInjectionArePermanentFailures(t *testing.T) {
+	err := Log{}.Send(context.Background(), Message{To: []string{"a@example.com\r\nBcc: x@example.com"}, Subject: "Hi"})
+	if !IsPermanent(err) {
+		t.Errorf("err = %v, want a permanent error", err)
+	}
+}
+
+func TestDefaultTemplatesRenderSampleData(t *testing.T) {
+	for _, key := range TemplateKeys() {
+		if err := Defaults[key].Validate("Acme"); err != nil {
+			t.Errorf("default %s: %v", key, err)
+		}
+	}
+	m, err := Defaults[KindInvitation].Render([]string{"a@example.com"}, SampleData(KindInvitation, "Acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Subject != "You have been invited to Acme" || !strings.Contains(m.Text, "expires 2030-01-02 15:04 UTC") {
+		t.Errorf("rendered %+v", m)
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	for name, tmpl := range map[string]Template{
+		"unknown key":       {Key: "nope", Subject: "s", Text: "b"},
+		"empty body":        {Key: KindTest, Subject: "s", Text: " "},
+		"syntax error":      {Key: KindTest, Subject: "{{.OrgName", Text: "b"},
+		"missing field":     {Key: KindTest, Subject: "s", Text: "{{.ResetURL}}"},
+		"multiline subject": {Key: KindReport, Subject: "{{.ReportName}}\nBcc: x@example.com", Text: "b"},
+	} {
+		if err := tmpl.Validate("Acme"); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	ok := Template{Key: KindTest, Subject: "Hello from {{.OrgName}}", Text: "{{.OrgName}} says hi"}
+	if err := ok.Validate("Acme"); err != nil {
+		t.Errorf("valid override: %v", err)
+	}
+}
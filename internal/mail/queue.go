@@ -0,0 +1,200 @@
+package mail
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"era-inventory-api/internal/outbox"
+)
+
+// batchSize is how many messages one send pass claims
+const batchSize = 50
+
+// Email statuses
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"
+)
+
+// Email kinds, recorded in the send log
+const (
+	KindTest          = "test"
+	KindInvitation    = "invitation"
+	KindPasswordReset = "password_reset"
+	KindDigest        = "digest"
+	KindReport        = "report"
+)
+
+// Email is one entry of the send log; the body is not exposed
+type Email struct {
+	ID            int64      `json:"id"`
+	Kind          string     `json:"kind"`
+	To            []string   `json:"to"`
+	Subject       string     `json:"subject"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// Querier is what Enqueue needs, so a message can be queued inside the
+// caller's transaction
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Enqueue stores m for delivery on behalf of orgID and returns its ID
+func Enqueue(ctx context.Context, q Querier, orgID int64, kind string, m Message) (int64, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := q.QueryRowContext(ctx, `
+		INSERT INTO emails (org_id, kind, recipients, subject, body)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`, orgID, kind, m.To, m.Subject, m.Text).Scan(&id)
+	return id, err
+}
+
+// Queue delivers pending messages through a Mailer
+type Queue struct {
+	db          *sql.DB
+	mailer      Mailer
+	interval    time.Duration
+	maxAttempts int
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewQueue sends due messages every interval once started. A message that
+// has failed maxAttempts times, or failed permanently, becomes dead.
+func NewQueue(db *sql.DB, mailer Mailer, interval time.Duration, maxAttempts int) *Queue {
+	return &Queue{db: db, mailer: mailer, interval: interval, maxAttempts: maxAttempts}
+}
+
+// Start runs send passes until Stop; a zero interval leaves it stopped
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.interval <= 0 || q.stop != nil {
+		return
+	}
+	q.stop = make(chan struct{})
+	q.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(q.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				q.pass()
+			}
+		}
+	}(q.stop, q.done)
+}
+
+// Stop ends the loop started by Start and waits for the current pass
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stop == nil {
+		return
+	}
+	close(q.stop)
+	<-q.done
+	q.stop = nil
+}
+
+func (q *Queue) pass() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	for {
+		n, err := q.SendOnce(ctx)
+		if err != nil {
+			log.Printf("mail send failed: %v", err)
+			return
+		}
+		if n < batchSize {
+			return
+		}
+	}
+}
+
+// SendOnce claims up to batchSize due messages, oldest first, and sends each.
+// Claimed rows are locked, so several instances can send concurrently
+// without delivering a message twice in one pass. It returns the number of
+// messages claimed.
+func (q *Queue) SendOnce(ctx context.Context) (int, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, to_json(recipients), subject, body, attempts
+		FROM emails
+		WHERE status = 'pending' AND next_attempt_at <= NOW()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	type claimed struct {
+		id       int64
+		msg      Message
+		attempts int
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		var to []byte
+		if err := rows.Scan(&c.id, &to, &c.msg.Subject, &c.msg.Text, &c.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(to, &c.msg.To); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range batch {
+		sendErr := q.mailer.Send(ctx, c.msg)
+		switch {
+		case sendErr == nil:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE emails SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), last_error = NULL
+				WHERE id = $1`, c.id)
+		case IsPermanent(sendErr) || c.attempts+1 >= q.maxAttempts:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE emails SET status = 'dead', attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+				c.id, sendErr.Error())
+		default:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE emails SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + $3 * INTERVAL '1 second'
+				WHERE id = $1`, c.id, sendErr.Error(), outbox.Backoff(c.attempts+1).Seconds())
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), tx.Commit()
+}
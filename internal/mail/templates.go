@@ -0,0 +1,139 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxTemplateLen caps the subject and body of a stored template
+const maxTemplateLen = 64 << 10
+
+// Template is the wording of one kind of email. Subject and Text are Go
+// text/template sources rendered against the data of that kind.
+type Template struct {
+	Key     string `json:"key"`
+	Subject string `json:"subject"`
+	Text    string `json:"body"`
+}
+
+// Defaults are the built-in templates by key; orgs may override each one
+var Defaults = map[string]Template{
+	KindTest: {
+		Key:     KindTest,
+		Subject: "{{.OrgName}}: test email",
+		Text:    "This message confirms that Era Inventory can send mail for {{.OrgName}}.\n",
+	},
+	KindInvitation: {
+		Key:     KindInvitation,
+		Subject: "You have been invited to {{.OrgName}}",
+		Text: "{{.InvitedBy}} invited you to {{.OrgName}} on Era Inventory.\n\n" +
+			"Accept the invitation: {{.AcceptURL}}\n" +
+			"The link expires {{.ExpiresAt.Format \"2006-01-02 15:04 MST\"}}.\n",
+	},
+	KindPasswordReset: {
+		Key:     KindPasswordReset,
+		Subject: "Reset your {{.OrgName}} password",
+		Text: "Someone asked to reset your password. If it was you, open:\n{{.ResetURL}}\n\n" +
+			"The link expires {{.ExpiresAt.Format \"2006-01-02 15:04 MST\"}}. Otherwise ignore this message.\n",
+	},
+	KindDigest: {
+		Key:     KindDigest,
+		Subject: "{{.OrgName}} inventory digest: {{.Period}}",
+		Text: "Inventory changes in {{.OrgName}} ({{.Period}}):\n\n" +
+			"  Items created:   {{.ItemsCreated}}\n" +
+			"  Items updated:   {{.ItemsUpdated}}\n" +
+			"  Warranties ending in 30 days: {{.WarrantyExpiring}}\n",
+	},
+	KindReport: {
+		Key:     KindReport,
+		Subject: "{{.OrgName}}: {{.ReportName}} is ready",
+		Text:    "Your scheduled report {{.ReportName}} is ready:\n{{.DownloadURL}}\n",
+	},
+}
+
+// TemplateKeys lists the keys of Defaults in order
+func TemplateKeys() []string {
+	keys := make([]string, 0, len(Defaults))
+	for k := range Defaults {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SampleData returns example data for a template key, for previews and for
+// checking that an override renders. OrgName is filled in by the caller.
+func SampleData(key, orgName string) map[string]interface{} {
+	expires := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+	data := map[string]interface{}{"OrgName": orgName}
+	switch key {
+	case KindInvitation:
+		data["InvitedBy"] = "admin@example.com"
+		data["AcceptURL"] = "https://inventory.example.com/invitations/SAMPLE"
+		data["ExpiresAt"] = expires
+	case KindPasswordReset:
+		data["ResetURL"] = "https://inventory.example.com/reset/SAMPLE"
+		data["ExpiresAt"] = expires
+	case KindDigest:
+		data["Period"] = "2030-01-01 to 2030-01-07"
+		data["ItemsCreated"] = 12
+		data["ItemsUpdated"] = 40
+		data["WarrantyExpiring"] = 3
+	case KindReport:
+		data["ReportName"] = "Warranty aging"
+		data["DownloadURL"] = "https://inventory.example.com/exports/SAMPLE/download"
+	}
+	return data
+}
+
+// Render executes t against data. Referring to a field the data does not
+// have is an error, so typos surface when a template is saved or previewed.
+func (t Template) Render(to []string, data interface{}) (Message, error) {
+	subject, err := execute(t.Key+".subject", t.Subject, data)
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := execute(t.Key+".body", t.Text, data)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: strings.TrimSpace(subject), Text: text}, nil
+}
+
+// Validate checks an override: bounded size, and that it renders against
+// the sample data of its key
+func (t Template) Validate(orgName string) error {
+	if _, ok := Defaults[t.Key]; !ok {
+		return fmt.Errorf("unknown template %q", t.Key)
+	}
+	if strings.TrimSpace(t.Subject) == "" || strings.TrimSpace(t.Text) == "" {
+		return fmt.Errorf("subject and body are required")
+	}
+	if len(t.Subject) > maxTemplateLen || len(t.Text) > maxTemplateLen {
+		return fmt.Errorf("subject and body must be at most %d bytes", maxTemplateLen)
+	}
+	m, err := t.Render([]string{"preview@example.com"}, SampleData(t.Key, orgName))
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("subject must render to a single line")
+	}
+	return nil
+}
+
+func execute(name, src string, data interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(src)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+	"era-inventory-api/internal/repo"
+)
+
+// resourceFilter is a query parameter narrowing a list
+type resourceFilter struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // string, integer or timestamp (RFC3339)
+	Description string   `json:"description"`
+	Values      []string `json:"values,omitempty"`
+	Repeatable  bool     `json:"repeatable,omitempty"`
+}
+
+// resourceMeta describes the list endpoint of a resource. Sort is empty for
+// lists in a fixed order, which Order then describes.
+type resourceMeta struct {
+	Name         string           `json:"name"`
+	Path         string           `json:"path"`
+	Filters      []resourceFilter `json:"filters"`
+	Sort         []string         `json:"sort"`
+	Order        string           `json:"order,omitempty"`
+	Cursor       bool             `json:"cursor"`
+	DefaultLimit int              `json:"default_limit"`
+	MaxLimit     int              `json:"max_limit"`
+}
+
+// listResources describes the list endpoints. Sort keys and limits are read
+// from the maps and page size policy the handlers use, so they cannot drift;
+// keep the filters in step with the handlers when adding one.
+func (s *Server) listResources() []resourceMeta {
+	q := func(what string) resourceFilter {
+		return resourceFilter{Name: "q", Type: "string", Description: "case-insensitive substring of " + what}
+	}
+	trashNames := make([]string, len(trashTypes))
+	for i, t := range trashTypes {
+		trashNames[i] = t.name
+	}
+
+	resources := []resourceMeta{
+		{
+			Name: "items", Path: "/items",
+			Filters: []resourceFilter{
+				q("name or asset_tag"),
+				{Name: "status", Type: "string", Description: "lifecycle status", Values: models.ItemStatuses},
+				{Name: "tag", Type: "string", Description: "items carrying every given tag", Repeatable: true},
+				{Name: "group", Type: "integer", Description: "members of one asset group"},
+			},
+			Sort:   query.SortKeys(itemSort),
+			Cursor: true,
+		},
+		{Name: "sites", Path: "/sites", Filters: []resourceFilter{q("name")}, Sort: repo.SiteSortKeys()},
+		{Name: "vendors", Path: "/vendors", Filters: []resourceFilter{q("name")}, Sort: repo.VendorSortKeys()},
+		{Name: "projects", Path: "/projects", Filters: []resourceFilter{q("code or name")}, Sort: query.SortKeys(projectSort)},
+		{Name: "asset-groups", Path: "/asset-groups", Filters: []resourceFilter{q("name")}, Order: "name"},
+		{
+			Name: "racks", Path: "/racks",
+			Filters: []resourceFilter{{Name: "site_id", Type: "integer", Description: "racks of one site"}},
+			Order:   "site_id, name",
+		},
+		{
+			Name: "subnets", Path: "/subnets",
+			Filters: []resourceFilter{
+				{Name: "site_id", Type: "integer", Description: "subnets of one site"},
+				{Name: "vlan_id", Type: "integer", Description: "subnets of one VLAN"},
+			},
+			Order: "cidr",
+		},
+		{
+			Name: "trash", Path: "/trash",
+			Filters: []resourceFilter{{Name: "type", Type: "string", Description: "one kind of deleted record", Values: trashNames}},
+			Order:   "deleted_at descending",
+		},
+		{
+			Name: "changes", Path: "/changes",
+			Filters: []resourceFilter{
+				{Name: "since", Type: "timestamp", Description: "changes after this time; defaults to 24 hours ago"},
+				{Name: "type", Type: "string", Description: "changes of one kind of record", Values: trashNames},
+			},
+			Order: "at descending",
+		},
+	}
+	for i := range resources {
+		resources[i].DefaultLimit, resources[i].MaxLimit = s.listLimits(resources[i].Path)
+		if resources[i].Sort == nil {
+			resources[i].Sort = []string{}
+		}
+	}
+	return resources
+}
+
+// getResourceMeta describes the filters, sort keys and page limits of the
+// list endpoints, so clients can build queries without hard-coding them
+func (s *Server) getResourceMeta(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"sort_syntax": "comma-separated keys, each optionally prefixed with - for descending; cursor pagination accepts a single key",
+		"resources":   s.listResources(),
+	}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestResourceMetaDescribesMountedLists(t *testing.T) {
+	s := newRoutedServer()
+	routes := map[string]bool{}
+	_ = chi.Walk(s.Router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes[method+" "+strings.TrimSuffix(route, "/")] = true
+		return nil
+	})
+
+	for _, res := range (&Server{}).listResources() {
+		if !routes["GET "+res.Path] {
+			t.Errorf("%s: GET %s is not mounted", res.Name, res.Path)
+		}
+		if (len(res.Sort) == 0) == (res.Order == "") {
+			t.Errorf("%s: want either sort keys or a fixed order", res.Name)
+		}
+		if res.DefaultLimit != defaultListLimit || res.MaxLimit != maxListLimit {
+			t.Errorf("%s: limits %d/%d", res.Name, res.DefaultLimit, res.MaxLimit)
+		}
+	}
+}
+
+func TestGetResourceMeta(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).getResourceMeta(w, httptest.NewRequest(http.MethodGet, "/meta/resources", nil))
+	var resp struct {
+		Resources []resourceMeta `json:"resources"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range resp.Resources {
+		if res.Name != "items" {
+			continue
+		}
+		if strings.Join(res.Sort, ",") != "created_at,id,name,status,updated_at" || !res.Cursor {
+			t.Errorf("items = %+v", res)
+		}
+		return
+	}
+	t.Error("items missing from the response")
+}
@@ -1,18 +1,39 @@
 package internal
 
 import (
+	"context"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
 	"time"
 
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/outbox"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// orgBuckets is the number of buckets org IDs are hashed into for the
+// per-org latency breakdown, bounding label cardinality regardless of tenant count
+const orgBuckets = 16
+
+// metricsLabelsKey carries the per-request labels filled in by inner middleware
+const metricsLabelsKey contextKey = "metricsLabels"
+
+// requestLabels collects labels only known after authentication
+type requestLabels struct {
+	orgID int64
+}
+
 // Metrics provides Prometheus metrics collection for HTTP requests
 type Metrics struct {
 	reqTotal   *prometheus.CounterVec
 	reqLatency *prometheus.HistogramVec
+	orgLatency *prometheus.HistogramVec
+	outboxSent *prometheus.CounterVec
 	registry   *prometheus.Registry
 }
 
@@ -37,11 +58,30 @@ func NewMetrics() *Metrics {
 		[]string{"method", "path", "status"},
 	)
 
-	registry.MustRegister(reqTotal, reqLatency)
+	orgLatency := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_org_request_duration_seconds",
+			Help:    "Request latency in seconds of authenticated requests by hashed org bucket",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "org_bucket"},
+	)
+
+	outboxSent := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "outbox_events_dispatched_total",
+			Help: "Outbox events delivered to subscribers, by topic",
+		},
+		[]string{"topic"},
+	)
+
+	registry.MustRegister(reqTotal, reqLatency, orgLatency, outboxSent)
 
 	return &Metrics{
 		reqTotal:   reqTotal,
 		reqLatency: reqLatency,
+		orgLatency: orgLatency,
+		outboxSent: outboxSent,
 		registry:   registry,
 	}
 }
@@ -55,6 +95,10 @@ func (m *Metrics) Middleware() func(http.Handler) http.Handler {
 			// Create a response writer that captures the status code
 			rw := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
 
+			// Let TagOrg report the org once the request is authenticated
+			labels := &requestLabels{}
+			r = r.WithContext(context.WithValue(r.Context(), metricsLabelsKey, labels))
+
 			// Process the request
 			next.ServeHTTP(rw, r)
 
@@ -66,15 +110,44 @@ func (m *Metrics) Middleware() func(http.Handler) http.Handler {
 
 			// Record metrics
 			status := http.StatusText(rw.code)
+			elapsed := time.Since(start).Seconds()
 			m.reqTotal.WithLabelValues(r.Method, path, status).Inc()
-			m.reqLatency.WithLabelValues(r.Method, path, status).Observe(time.Since(start).Seconds())
+			latency := m.reqLatency.WithLabelValues(r.Method, path, status)
+			if labels.orgID <= 0 {
+				latency.Observe(elapsed)
+				return
+			}
+
+			// The exact org rides along as an exemplar; only the hashed bucket becomes a label
+			latency.(prometheus.ExemplarObserver).ObserveWithExemplar(elapsed,
+				prometheus.Labels{"org_id": strconv.FormatInt(labels.orgID, 10)})
+			m.orgLatency.WithLabelValues(r.Method, orgBucket(labels.orgID)).Observe(elapsed)
 		})
 	}
 }
 
+// TagOrg records the authenticated org for the metrics middleware. It must run
+// after authentication; requests not passing through it are recorded without an org.
+func (m *Metrics) TagOrg(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if labels, ok := r.Context().Value(metricsLabelsKey).(*requestLabels); ok {
+			labels.orgID = auth.OrgIDFromContext(r.Context())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// orgBucket hashes an org ID into one of orgBuckets label values
+func orgBucket(orgID int64) string {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(orgID, 10)))
+	return fmt.Sprintf("%02d", h.Sum32()%orgBuckets)
+}
+
 // Handler returns an http.Handler that serves Prometheus metrics
 func (m *Metrics) Handler() http.Handler {
-	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	// OpenMetrics is required for exemplars; plain scrapers still get text format
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
 }
 
 // statusRecorder captures the HTTP status code for metrics
@@ -91,3 +164,15 @@ func (sr *statusRecorder) WriteHeader(code int) {
 func (sr *statusRecorder) Write(b []byte) (int, error) {
 	return sr.ResponseWriter.Write(b)
 }
+
+// Unwrap lets http.ResponseController reach the connection, to flush
+// streamed downloads
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// CountOutboxEvent is an outbox subscriber counting delivered events by topic
+func (m *Metrics) CountOutboxEvent(_ context.Context, e outbox.Event) error {
+	m.outboxSent.WithLabelValues(e.Topic).Inc()
+	return nil
+}
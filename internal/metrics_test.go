@@ -1,12 +1,15 @@
 package internal
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
 
+	"era-inventory-api/internal/auth"
+
 	"github.com/go-chi/chi/v5"
 )
 
@@ -179,3 +182,51 @@ func TestMetricsWithChiRoutePatterns(t *testing.T) {
 		t.Error("Expected metrics to contain Chi route pattern, not actual path")
 	}
 }
+
+func TestMetricsOrgBreakdown(t *testing.T) {
+	metrics := NewMetrics()
+	router := chi.NewRouter()
+	router.Use(metrics.Middleware())
+	router.Get("/metrics", metrics.Handler().ServeHTTP)
+	router.Group(func(r chi.Router) {
+		// Stand-in for AuthMiddleware
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auth.OrgIDKey, int64(42))))
+			})
+		})
+		r.Use(metrics.TagOrg)
+		r.Get("/items", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items", nil))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	body := w.Body.String()
+
+	bucket := orgBucket(42)
+	if !strings.Contains(body, `http_org_request_duration_seconds_count{method="GET",org_bucket="`+bucket+`"} 1`) {
+		t.Errorf("Expected org bucket %s in metrics:\n%s", bucket, body)
+	}
+	if !strings.Contains(body, `org_id="42"`) {
+		t.Error("Expected org_id exemplar in OpenMetrics output")
+	}
+}
+
+func TestOrgBucketIsBounded(t *testing.T) {
+	seen := map[string]bool{}
+	for id := int64(1); id <= 1000; id++ {
+		seen[orgBucket(id)] = true
+	}
+	if len(seen) > orgBuckets {
+		t.Errorf("Expected at most %d buckets, got %d", orgBuckets, len(seen))
+	}
+	if orgBucket(7) != orgBucket(7) {
+		t.Error("orgBucket must be stable")
+	}
+}
@@ -2,53 +2,67 @@ package internal
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/requestid"
 )
 
 // contextKey is a custom type for context keys to avoid collisions
 type contextKey string
 
-const (
-	// OrgIDKey is the context key for organization ID
-	OrgIDKey contextKey = "orgID"
-)
-
-// OrgIDFromContext extracts the organization ID from the request context.
-// Returns 1 as default if not found or invalid.
-func OrgIDFromContext(ctx context.Context) int64 {
-	if v := ctx.Value(OrgIDKey); v != nil {
-		if id, ok := v.(int64); ok {
-			return id
-		}
-	}
-	return 1
-}
+// OrgContextHeader lets a main-tenant token act on another organization for
+// a single request
+const OrgContextHeader = "X-Org-Context"
 
-// RBACMiddleware reads the X-Org-ID header and stores the organization ID in the request context.
-// If the header is missing or invalid, it defaults to orgID=1.
-// This is a scaffold for future JWT validation and role-based access control.
-func RBACMiddleware(next http.Handler) http.Handler {
+// orgOverride switches the effective organization to the one named in
+// X-Org-Context. Only tokens issued to the main tenant (MAIN_TENANT_ORG_ID)
+// may use it; the caller keeps its own roles and every switch is logged for
+// audit, both as a log line and in org_access_log. It runs after authentication and before the RLS session, so the
+// app.current_org_id GUC and search_path follow the new org. The claims are
+// left as issued and still describe the token.
+func (s *Server) orgOverride(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Read X-Org-ID header, default to "1" if missing
-		orgIDStr := r.Header.Get("X-Org-ID")
-		if orgIDStr == "" {
-			orgIDStr = "1"
+		value := r.Header.Get(OrgContextHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		// Parse the organization ID
-		orgID, err := strconv.ParseInt(orgIDStr, 10, 64)
-		if err != nil {
-			// If parsing fails, default to 1
-			orgID = 1
+		ctx := r.Context()
+		claims := auth.ClaimsFromContext(ctx)
+		if claims == nil || s.MainTenantOrgID <= 0 || claims.OrgID != s.MainTenantOrgID {
+			problem.Write(w, r, http.StatusForbidden, "ORG_OVERRIDE_FORBIDDEN", OrgContextHeader+" is only available to main tenant tokens")
+			return
+		}
+		orgID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || orgID <= 0 {
+			problem.BadRequest(w, r, OrgContextHeader+" must be a positive organization ID")
+			return
+		}
+		if orgID == claims.OrgID {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		// Store orgID in request context using custom key type
-		ctx := context.WithValue(r.Context(), OrgIDKey, orgID)
-
-		// TODO: Add JWT validation and role checking here
-		// For now, just pass the request with orgID in context
+		var exists bool
+		if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1)`, orgID).Scan(&exists); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if !exists {
+			problem.Write(w, r, http.StatusNotFound, "ORG_NOT_FOUND", fmt.Sprintf("organization %d does not exist", orgID))
+			return
+		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		log.Printf("audit: org override user=%d from_org=%d to_org=%d %s %s request_id=%s",
+			claims.UserID, claims.OrgID, orgID, r.Method, r.URL.Path, requestid.FromContext(r.Context()))
+		rw := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(ctx, auth.OrgIDKey, orgID)))
+		s.recordOrgAccess(claims, orgID, r, rw.code)
 	})
 }
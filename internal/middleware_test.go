@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"era-inventory-api/internal/auth"
+)
+
+func TestOrgOverride(t *testing.T) {
+	tests := []struct {
+		name       string
+		mainTenant int64
+		tokenOrg   int64
+		header     string
+		wantStatus int
+		wantOrg    int64
+	}{
+		{"no header", 1, 5, "", http.StatusOK, 5},
+		{"feature disabled", 0, 1, "7", http.StatusForbidden, 0},
+		{"not main tenant", 1, 5, "7", http.StatusForbidden, 0},
+		{"malformed", 1, 1, "abc", http.StatusBadRequest, 0},
+		{"negative", 1, 1, "-3", http.StatusBadRequest, 0},
+		{"own org", 1, 1, "1", http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{MainTenantOrgID: tt.mainTenant}
+			var gotOrg int64
+			h := s.orgOverride(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotOrg = auth.OrgIDFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/items", nil)
+			if tt.header != "" {
+				r.Header.Set(OrgContextHeader, tt.header)
+			}
+			ctx := context.WithValue(r.Context(), auth.ClaimsKey, &auth.Claims{UserID: 3, OrgID: tt.tokenOrg, Roles: []string{"org_admin"}})
+			ctx = context.WithValue(ctx, auth.OrgIDKey, tt.tokenOrg)
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r.WithContext(ctx))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if gotOrg != tt.wantOrg {
+				t.Errorf("effective org = %d, want %d", gotOrg, tt.wantOrg)
+			}
+		})
+	}
+}
+
+func TestOrgOverrideIgnoresLegacyHeader(t *testing.T) {
+	s := &Server{MainTenantOrgID: 1}
+	var gotOrg int64
+	h := s.orgOverride(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOrg = auth.OrgIDFromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set("X-Org-ID", "7")
+	ctx := context.WithValue(r.Context(), auth.ClaimsKey, &auth.Claims{UserID: 3, OrgID: 1, Roles: []string{"org_admin"}})
+	ctx = context.WithValue(ctx, auth.OrgIDKey, int64(1))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.WithContext(ctx))
+	if w.Code != http.StatusOK || gotOrg != 1 {
+		t.Errorf("X-Org-ID must be ignored: status %d, org %d", w.Code, gotOrg)
+	}
+}
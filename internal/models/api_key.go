@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// APIKey is an issued API key. The secret is shown once, when the key is
+// created; Prefix identifies it afterwards.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	UserID     int64      `json:"user_id"`
+	OrgID      int64      `json:"-"`
+	Roles      []string   `json:"roles"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Asset group kinds: members listed by hand, or every item matching a filter
+const (
+	AssetGroupKindManual = "manual"
+	AssetGroupKindFilter = "filter"
+)
+
+// AssetGroup is a named collection of items. A filter group has Filter and
+// is evaluated whenever it is used; a manual group has members added and
+// removed one by one.
+type AssetGroup struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	Description *string           `json:"description,omitempty"`
+	Kind        string            `json:"kind"`
+	Filter      *AssetGroupFilter `json:"filter,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// AssetGroupFilter matches items the way GET /items does, plus exact site
+// and device type; an item must match every field set
+type AssetGroupFilter struct {
+	Q          string   `json:"q,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Site       string   `json:"site,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+}
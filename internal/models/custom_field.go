@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Custom field types
+const (
+	FieldText = "text"
+	FieldInt  = "int"
+	FieldBool = "bool"
+	FieldEnum = "enum"
+	FieldDate = "date"
+)
+
+// CustomFieldTypes lists the accepted custom field types
+var CustomFieldTypes = []string{FieldText, FieldInt, FieldBool, FieldEnum, FieldDate}
+
+// CustomField defines a typed field items of DeviceType may carry in their
+// custom_fields. Options are the allowed values of an enum field.
+type CustomField struct {
+	ID         int64     `json:"id"`
+	DeviceType string    `json:"device_type"`
+	Key        string    `json:"key"`
+	Label      string    `json:"label,omitempty"`
+	Type       string    `json:"type"`
+	Options    []string  `json:"options,omitempty"`
+	Required   bool      `json:"required"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CustomValues holds an item's custom field values by key, stored as JSONB
+type CustomValues map[string]interface{}
+
+// Scan reads a JSONB object
+func (v *CustomValues) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return fmt.Errorf("custom values: cannot scan %T", src)
+	}
+	return json.Unmarshal(data, (*map[string]interface{})(v))
+}
@@ -1,18 +1,48 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Item struct {
-	ID           int        `json:"id"`
-	AssetTag     string     `json:"asset_tag"`
-	Name         string     `json:"name"`
-	Manufacturer string     `json:"manufacturer,omitempty"`
-	Model        string     `json:"model,omitempty"`
-	DeviceType   string     `json:"device_type,omitempty"`
-	Site         string     `json:"site,omitempty"`
-	InstalledAt  *time.Time `json:"installed_at,omitempty"`
-	WarrantyEnd  *time.Time `json:"warranty_end,omitempty"`
-	Notes        string     `json:"notes,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID            int        `json:"id"`
+	AssetTag      string     `json:"asset_tag"`
+	Name          string     `json:"name"`
+	Manufacturer  string     `json:"manufacturer,omitempty"`
+	Model         string     `json:"model,omitempty"`
+	DeviceType    string     `json:"device_type,omitempty"`
+	Site          string     `json:"site,omitempty"`
+	InstalledAt   *time.Time `json:"installed_at,omitempty"`
+	WarrantyStart *time.Time `json:"warranty_start,omitempty"`
+	WarrantyEnd   *time.Time `json:"warranty_end,omitempty"`
+	// SupportContract is the reference of the support contract covering the
+	// item; coverage lapses at the later of warranty_end and support_end
+	SupportContract *string         `json:"support_contract,omitempty"`
+	SupportLevel    *string         `json:"support_level,omitempty"`
+	SupportEnd      *time.Time      `json:"support_end,omitempty"`
+	Notes           string          `json:"notes,omitempty"`
+	Status          string          `json:"status,omitempty"`
+	CustomFields    CustomValues    `json:"custom_fields,omitempty"`
+	Details         json.RawMessage `json:"details,omitempty"`
+	RackID          *int64          `json:"rack_id,omitempty"`
+	RackPosition    *int            `json:"rack_position,omitempty"`
+	RackUnits       *int            `json:"rack_units,omitempty"`
+	ProjectID       *int64          `json:"project_id,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	DeletedAt       *time.Time      `json:"deleted_at,omitempty"`
 }
+
+// Item lifecycle status values
+const (
+	ItemOrdered  = "ordered"
+	ItemInStock  = "in_stock"
+	ItemActive   = "active"
+	ItemInRepair = "in_repair"
+	ItemRetired  = "retired"
+	ItemDisposed = "disposed"
+)
+
+// ItemStatuses lists the accepted item statuses in lifecycle order
+var ItemStatuses = []string{ItemOrdered, ItemInStock, ItemActive, ItemInRepair, ItemRetired, ItemDisposed}
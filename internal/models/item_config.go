@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type ItemConfig struct {
+	ID          int64     `json:"id"`
+	ItemID      int       `json:"item_id"`
+	Hash        string    `json:"hash"`
+	SizeBytes   int       `json:"size_bytes"`
+	CollectedAt time.Time `json:"collected_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	Content     string    `json:"content,omitempty"`
+}
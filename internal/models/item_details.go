@@ -0,0 +1,208 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Device types with typed details of their own, stored in a table per type
+// (item_routers, item_firewalls, item_access_points, item_servers) keyed by
+// item. Other device types only carry custom fields.
+const (
+	DeviceRouter      = "router"
+	DeviceFirewall    = "firewall"
+	DeviceAccessPoint = "access_point"
+	DeviceServer      = "server"
+)
+
+// RoutingProtocols lists the accepted router routing_protocols values
+var RoutingProtocols = []string{"static", "rip", "ospf", "isis", "eigrp", "bgp"}
+
+// FirewallHAModes lists the accepted firewall ha_mode values
+var FirewallHAModes = []string{"standalone", "active_passive", "active_active"}
+
+// WifiStandards lists the accepted access point wifi_standards values
+var WifiStandards = []string{"802.11a", "802.11b", "802.11g", "802.11n", "802.11ac", "802.11ax", "802.11be"}
+
+// Details are the typed details of an item of a subtype device type. On
+// writes, only fields present in the body are stored; the others keep their
+// value.
+type Details interface {
+	// Validate checks the fields present
+	Validate() error
+	// Columns returns the present fields by column name
+	Columns() map[string]interface{}
+}
+
+// RouterDetails are the details of a router
+type RouterDetails struct {
+	ThroughputMbps   *int     `json:"throughput_mbps,omitempty"`
+	WANPorts         *int     `json:"wan_ports,omitempty"`
+	RoutingProtocols []string `json:"routing_protocols,omitempty"`
+}
+
+// Validate implements Details
+func (d *RouterDetails) Validate() error {
+	return firstError(
+		nonNegative("throughput_mbps", d.ThroughputMbps),
+		nonNegative("wan_ports", d.WANPorts),
+		oneOfEach("routing_protocols", d.RoutingProtocols, RoutingProtocols),
+	)
+}
+
+// Columns implements Details
+func (d *RouterDetails) Columns() map[string]interface{} {
+	c := map[string]interface{}{}
+	setInt(c, "throughput_mbps", d.ThroughputMbps)
+	setInt(c, "wan_ports", d.WANPorts)
+	setList(c, "routing_protocols", d.RoutingProtocols)
+	return c
+}
+
+// FirewallDetails are the details of a firewall
+type FirewallDetails struct {
+	ThroughputMbps    *int    `json:"throughput_mbps,omitempty"`
+	VPNThroughputMbps *int    `json:"vpn_throughput_mbps,omitempty"`
+	MaxSessions       *int    `json:"max_sessions,omitempty"`
+	HAMode            *string `json:"ha_mode,omitempty"`
+}
+
+// Validate implements Details
+func (d *FirewallDetails) Validate() error {
+	var ha error
+	if d.HAMode != nil {
+		ha = oneOfEach("ha_mode", []string{*d.HAMode}, FirewallHAModes)
+	}
+	return firstError(
+		nonNegative("throughput_mbps", d.ThroughputMbps),
+		nonNegative("vpn_throughput_mbps", d.VPNThroughputMbps),
+		nonNegative("max_sessions", d.MaxSessions),
+		ha,
+	)
+}
+
+// Columns implements Details
+func (d *FirewallDetails) Columns() map[string]interface{} {
+	c := map[string]interface{}{}
+	setInt(c, "throughput_mbps", d.ThroughputMbps)
+	setInt(c, "vpn_throughput_mbps", d.VPNThroughputMbps)
+	setInt(c, "max_sessions", d.MaxSessions)
+	setText(c, "ha_mode", d.HAMode)
+	return c
+}
+
+// AccessPointDetails are the details of a wireless access point
+type AccessPointDetails struct {
+	WifiStandards []string `json:"wifi_standards,omitempty"`
+	Radios        *int     `json:"radios,omitempty"`
+	MaxClients    *int     `json:"max_clients,omitempty"`
+	Outdoor       *bool    `json:"outdoor,omitempty"`
+}
+
+// Validate implements Details
+func (d *AccessPointDetails) Validate() error {
+	return firstError(
+		oneOfEach("wifi_standards", d.WifiStandards, WifiStandards),
+		nonNegative("radios", d.Radios),
+		nonNegative("max_clients", d.MaxClients),
+	)
+}
+
+// Columns implements Details
+func (d *AccessPointDetails) Columns() map[string]interface{} {
+	c := map[string]interface{}{}
+	setList(c, "wifi_standards", d.WifiStandards)
+	setInt(c, "radios", d.Radios)
+	setInt(c, "max_clients", d.MaxClients)
+	if d.Outdoor != nil {
+		c["outdoor"] = *d.Outdoor
+	}
+	return c
+}
+
+// ServerDetails are the details of a server
+type ServerDetails struct {
+	CPUModel  *string `json:"cpu_model,omitempty"`
+	CPUCores  *int    `json:"cpu_cores,omitempty"`
+	RAMGB     *int    `json:"ram_gb,omitempty"`
+	StorageGB *int    `json:"storage_gb,omitempty"`
+	OS        *string `json:"os,omitempty"`
+}
+
+// Validate implements Details
+func (d *ServerDetails) Validate() error {
+	return firstError(
+		nonNegative("cpu_cores", d.CPUCores),
+		nonNegative("ram_gb", d.RAMGB),
+		nonNegative("storage_gb", d.StorageGB),
+	)
+}
+
+// Columns implements Details
+func (d *ServerDetails) Columns() map[string]interface{} {
+	c := map[string]interface{}{}
+	setText(c, "cpu_model", d.CPUModel)
+	setInt(c, "cpu_cores", d.CPUCores)
+	setInt(c, "ram_gb", d.RAMGB)
+	setInt(c, "storage_gb", d.StorageGB)
+	setText(c, "os", d.OS)
+	return c
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nonNegative(key string, v *int) error {
+	if v != nil && *v < 0 {
+		return fmt.Errorf("%s must not be negative", key)
+	}
+	return nil
+}
+
+// oneOfEach requires every value to be one of allowed
+func oneOfEach(key string, values, allowed []string) error {
+	for _, v := range values {
+		ok := false
+		for _, a := range allowed {
+			if v == a {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errors.New(key + " values must be one of: " + strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+func setInt(c map[string]interface{}, key string, v *int) {
+	if v != nil {
+		c[key] = *v
+	}
+}
+
+// setText stores a blank string as NULL, clearing the field
+func setText(c map[string]interface{}, key string, v *string) {
+	if v == nil {
+		return
+	}
+	if s := strings.TrimSpace(*v); s != "" {
+		c[key] = s
+	} else {
+		c[key] = nil
+	}
+}
+
+func setList(c map[string]interface{}, key string, v []string) {
+	if v != nil {
+		c[key] = v
+	}
+}
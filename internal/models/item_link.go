@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Item link kinds. A "contains" link gives the target item its (single)
+// parent; the other kinds describe connectivity.
+const (
+	LinkContains    = "contains"
+	LinkUplinksTo   = "uplinks_to"
+	LinkConnectedTo = "connected_to"
+)
+
+// ItemLinkKinds lists the accepted link kinds
+var ItemLinkKinds = []string{LinkContains, LinkUplinksTo, LinkConnectedTo}
+
+// ItemLink relates two items, from FromItemID to ToItemID
+type ItemLink struct {
+	ID         int64     `json:"id"`
+	Kind       string    `json:"kind"`
+	FromItemID int       `json:"from_item_id"`
+	ToItemID   int       `json:"to_item_id"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Direction ("outgoing" or "incoming") and Item describe the other end,
+	// relative to the item whose links were listed
+	Direction string      `json:"direction,omitempty"`
+	Item      *LinkedItem `json:"item,omitempty"`
+}
+
+// LinkedItem is the summary of the item at the other end of a link
+type LinkedItem struct {
+	ID         int    `json:"id"`
+	AssetTag   string `json:"asset_tag"`
+	Name       string `json:"name"`
+	DeviceType string `json:"device_type,omitempty"`
+}
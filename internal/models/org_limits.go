@@ -0,0 +1,13 @@
+package models
+
+// OrgLimits caps what an organization may hold; nil fields are unlimited
+type OrgLimits struct {
+	MaxItems      *int `json:"max_items"`
+	MaxImportRows *int `json:"max_import_rows"`
+}
+
+// OrgUsage is an organization's limits next to what it uses of them
+type OrgUsage struct {
+	Limits OrgLimits `json:"limits"`
+	Items  int       `json:"items"`
+}
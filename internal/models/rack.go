@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Rack is an equipment rack at a site, Units (U) high
+type Rack struct {
+	ID          int64     `json:"id"`
+	SiteID      int       `json:"site_id"`
+	Name        string    `json:"name"`
+	Units       int       `json:"units"`
+	Description *string   `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// UsedUnits is how many units items occupy
+	UsedUnits int `json:"used_units"`
+}
+
+// RackSlot is a run of units in a rack elevation, from Position (its lowest
+// U) up: either one item or free space
+type RackSlot struct {
+	Position int         `json:"position"`
+	Units    int         `json:"units"`
+	Item     *RackedItem `json:"item,omitempty"`
+}
+
+// RackedItem is the summary of an item in a rack elevation
+type RackedItem struct {
+	ID         int    `json:"id"`
+	AssetTag   string `json:"asset_tag"`
+	Name       string `json:"name"`
+	DeviceType string `json:"device_type,omitempty"`
+	Status     string `json:"status"`
+}
+
+// RackElevation is the layout of a rack, top unit first
+type RackElevation struct {
+	Rack      Rack       `json:"rack"`
+	FreeUnits int        `json:"free_units"`
+	Slots     []RackSlot `json:"slots"`
+}
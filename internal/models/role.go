@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Role is a named set of permissions. Built-in roles have no ID and cannot be
+// changed.
+type Role struct {
+	ID          int64     `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	Builtin     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
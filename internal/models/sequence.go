@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Sequence is a named per-org counter. Values are rendered as Prefix followed
+// by the number, zero-padded to Padding digits.
+type Sequence struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Padding   int       `json:"padding"`
+	LastValue int64     `json:"last_value"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SequenceValues is a run of allocated numbers, First to Last, and their
+// rendered values
+type SequenceValues struct {
+	Sequence string   `json:"sequence"`
+	First    int64    `json:"first"`
+	Last     int64    `json:"last"`
+	Values   []string `json:"values"`
+}
@@ -3,11 +3,14 @@ package models
 import "time"
 
 type Site struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Location  *string   `json:"location,omitempty"`
-	Notes     *string   `json:"notes,omitempty"`
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Location  *string  `json:"location,omitempty"`
+	Notes     *string  `json:"notes,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// ParentID is the site this one belongs to; 0 in an update detaches it
+	ParentID  *int      `json:"parent_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
-
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Subnet is an IP network the org manages addresses in
+type Subnet struct {
+	ID          int64     `json:"id"`
+	CIDR        string    `json:"cidr"`
+	Name        string    `json:"name"`
+	VLANID      *int      `json:"vlan_id,omitempty"`
+	SiteID      *int      `json:"site_id,omitempty"`
+	Gateway     *string   `json:"gateway,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Used and Size describe utilization: reserved addresses, and the usable
+	// addresses of the subnet (capped for very large IPv6 networks)
+	Used int    `json:"used"`
+	Size string `json:"size"`
+}
+
+// IPAddress is a reserved address of a subnet, optionally assigned to an item
+type IPAddress struct {
+	ID          int64     `json:"id"`
+	SubnetID    int64     `json:"subnet_id"`
+	Address     string    `json:"address"`
+	ItemID      *int      `json:"item_id,omitempty"`
+	Hostname    *string   `json:"hostname,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
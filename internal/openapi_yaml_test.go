@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseSpecYAML decodes openapi.yaml into the values encoding/json would
+// produce for the same document: string-keyed maps, []interface{} and
+// float64 numbers, so schemas and enums compare against JSON bodies.
+func parseSpecYAML(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return jsonValue(v)
+}
+
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ev, err := jsonValue(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = ev
+		}
+		return out, nil
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key := fmt.Sprint(k)
+			ev, err := jsonValue(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			out[key] = ev
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			ev, err := jsonValue(e)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = ev
+		}
+		return out, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float64, string, bool, nil:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported YAML value %T", v)
+	}
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// orgGate is a soft per-org concurrency limit for expensive endpoints. A
+// request over the limit waits for one of its org's slots instead of being
+// rejected; only one that waits longer than the timeout, or that finds
+// maxWaiting requests of its org already waiting, gets 503 with Retry-After.
+// Other orgs are never held up by a busy one.
+type orgGate struct {
+	limit      int
+	timeout    time.Duration
+	maxWaiting int
+
+	mu      sync.Mutex
+	slots   map[int64]chan struct{}
+	waiting map[int64]int
+}
+
+// newOrgGate allows limit concurrent requests per org, and maxWaiting more
+// waiting for a slot; limit 0 disables it, maxWaiting 0 does not cap waiters
+func newOrgGate(limit int, timeout time.Duration, maxWaiting int) *orgGate {
+	return &orgGate{
+		limit:      limit,
+		timeout:    timeout,
+		maxWaiting: maxWaiting,
+		slots:      make(map[int64]chan struct{}),
+		waiting:    make(map[int64]int),
+	}
+}
+
+// slot returns the org's semaphore, creating it on first use
+func (g *orgGate) slot(orgID int64) chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ch, ok := g.slots[orgID]
+	if !ok {
+		ch = make(chan struct{}, g.limit)
+		g.slots[orgID] = ch
+	}
+	return ch
+}
+
+// queue records a waiting request of the org and returns its position, 1
+// being next; the returned func leaves the queue. ok is false, and nothing
+// recorded, when the queue is full.
+func (g *orgGate) queue(orgID int64) (position int, leave func(), ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.maxWaiting > 0 && g.waiting[orgID] >= g.maxWaiting {
+		return 0, nil, false
+	}
+	g.waiting[orgID]++
+	return g.waiting[orgID], func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.waiting[orgID]--; g.waiting[orgID] == 0 {
+			delete(g.waiting, orgID)
+		}
+	}, true
+}
+
+// busy writes 503 ORG_BUSY, asking the client to retry after retryAfter
+func (g *orgGate) busy(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	problem.Write(w, r, http.StatusServiceUnavailable, "ORG_BUSY",
+		"your organization already has "+strconv.Itoa(g.limit)+" of these requests running; retry shortly")
+}
+
+// Middleware applies the gate to the caller's org. It must run before the
+// request takes a database connection, or waiters hold pool connections.
+func (g *orgGate) Middleware(next http.Handler) http.Handler {
+	if g == nil || g.limit <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID := auth.OrgIDFromContext(r.Context())
+		ch := g.slot(orgID)
+		select {
+		case ch <- struct{}{}:
+		default:
+			position, leave, ok := g.queue(orgID)
+			if !ok {
+				g.busy(w, r, 0)
+				return
+			}
+			timer := time.NewTimer(g.timeout)
+			select {
+			case ch <- struct{}{}:
+				leave()
+				timer.Stop()
+				w.Header().Set("X-Queue-Position", strconv.Itoa(position))
+			case <-timer.C:
+				leave()
+				g.busy(w, r, g.timeout)
+				return
+			case <-r.Context().Done():
+				leave()
+				timer.Stop()
+				return
+			}
+		}
+		defer func() { <-ch }()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gatePrefix applies the gate only to requests whose path starts with prefix,
+// so it can sit in a group's middleware ahead of the connection it would
+// otherwise wait on
+func (g *orgGate) gatePrefix(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		gated := g.Middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				gated.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/testutil"
+)
+
+// blockingHandler holds requests until release is closed
+func blockingHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func gateRequest(h http.Handler, orgID int64) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, testutil.AsUser(httptest.NewRequest(http.MethodGet, "/reports/aging", nil), orgID, 1, "viewer"))
+	return w
+}
+
+func TestOrgGateQueuesOverTheLimit(t *testing.T) {
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	h := newOrgGate(1, 5*time.Second, 0).Middleware(blockingHandler(started, release))
+
+	var wg sync.WaitGroup
+	codes := make(chan *httptest.ResponseRecorder, 3)
+	serve := func(orgID int64) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- gateRequest(h, orgID)
+		}()
+	}
+
+	serve(1)
+	<-started
+	serve(1) // waits for org 1's slot
+	serve(2) // another org is not held up
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("org 2 was held up by org 1")
+	}
+	select {
+	case <-started:
+		t.Fatal("second org 1 request ran over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	queued := 0
+	for w := range codes {
+		if w.Code != http.StatusOK {
+			t.Errorf("status = %d, want 200", w.Code)
+		}
+		if w.Header().Get("X-Queue-Position") == "1" {
+			queued++
+		}
+	}
+	if queued != 1 {
+		t.Errorf("%d responses report a queue position, want 1", queued)
+	}
+}
+
+func TestOrgGateTimesOut(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	h := newOrgGate(1, 20*time.Millisecond, 0).Middleware(blockingHandler(started, release))
+
+	done := make(chan struct{})
+	go func() {
+		gateRequest(h, 1)
+		close(done)
+	}()
+	<-started
+
+	w := gateRequest(h, 1)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q; want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	close(release)
+	<-done
+}
+
+func TestOrgGateDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	var nilGate *orgGate
+	for _, g := range []*orgGate{nilGate, newOrgGate(0, time.Second, 0)} {
+		if h := g.Middleware(next); h == nil {
+			t.Error("disabled gate must pass requests through")
+		}
+	}
+}
+
+func TestOrgGateRejectsOverTheQueue(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	g := newOrgGate(1, 5*time.Second, 1)
+	h := g.Middleware(blockingHandler(started, release))
+
+	var wg sync.WaitGroup
+	serve := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gateRequest(h, 1)
+		}()
+	}
+	serve()
+	<-started
+	serve()
+	for waiting := 0; waiting == 0; {
+		time.Sleep(time.Millisecond)
+		g.mu.Lock()
+		waiting = g.waiting[1]
+		g.mu.Unlock()
+	}
+
+	begin := time.Now()
+	w := gateRequest(h, 1)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q; want 503 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	if time.Since(begin) > time.Second {
+		t.Error("a request over the queue waited instead of failing fast")
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestOrgGatePrefix(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	h := newOrgGate(1, 20*time.Millisecond, 0).gatePrefix("/reports/")(blockingHandler(started, release))
+
+	done := make(chan struct{})
+	go func() {
+		gateRequest(h, 1)
+		close(done)
+	}()
+	<-started
+
+	// other paths of the org are not gated
+	go func() {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, testutil.AsUser(httptest.NewRequest(http.MethodGet, "/items", nil), 1, 1, "viewer"))
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("/items waited for the reports gate")
+	}
+	if w := gateRequest(h, 1); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("second report: status = %d, want 503", w.Code)
+	}
+	close(release)
+	<-done
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"net/http"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+)
+
+// getOrgUsage reports the caller's org limits and how many items count
+// against them
+func (s *Server) getOrgUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := s.Limits.Usage(r.Context(), auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, usage)
+}
+
+// setOrgLimits replaces an org's limits; fields left out or null are
+// unlimited. Orgs cannot raise their own limits, so only main tenant tokens
+// may set them.
+func (s *Server) setOrgLimits(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMainTenant(w, r, "organization limits are only set by main tenant tokens") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in models.OrgLimits
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	out, err := s.Limits.Set(r.Context(), id, in)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// checkItemQuota writes 402 QUOTA_EXCEEDED unless the caller's org has room
+// for n more items
+func (s *Server) checkItemQuota(w http.ResponseWriter, r *http.Request, n int) bool {
+	if err := s.Limits.CheckItems(r.Context(), auth.OrgIDFromContext(r.Context()), n); err != nil {
+		writeServiceError(w, r, err)
+		return false
+	}
+	return true
+}
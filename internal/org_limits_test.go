@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/testutil"
+)
+
+func TestSetOrgLimits(t *testing.T) {
+	mem := testutil.NewMemOrgLimits()
+	s := &Server{MainTenantOrgID: 1, Limits: service.NewLimits(mem)}
+
+	if w := serveAs(2, http.MethodPut, "/organizations/{id}/limits", "/organizations/2/limits", `{"max_items":1000}`, s.setOrgLimits); w.Code != http.StatusForbidden {
+		t.Errorf("own limits = %d, want 403", w.Code)
+	}
+	if w := serveAs(1, http.MethodPut, "/organizations/{id}/limits", "/organizations/2/limits", `{"max_items":-1}`, s.setOrgLimits); w.Code != http.StatusBadRequest {
+		t.Errorf("negative max_items = %d, want 400", w.Code)
+	}
+	w := serveAs(1, http.MethodPut, "/organizations/{id}/limits", "/organizations/2/limits", `{"max_items":3}`, s.setOrgLimits)
+	if w.Code != http.StatusOK || w.Body.String() != `{"max_items":3,"max_import_rows":null}`+"\n" {
+		t.Fatalf("set = %d: %s", w.Code, w.Body.String())
+	}
+
+	mem.SetItems(2, 3)
+	w = serveAs(2, http.MethodGet, "/org/usage", "/org/usage", "", s.getOrgUsage)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"items":3`) {
+		t.Errorf("usage = %d: %s", w.Code, w.Body.String())
+	}
+	w = serveAs(2, http.MethodPost, "/items", "/items", "", func(w http.ResponseWriter, r *http.Request) {
+		if s.checkItemQuota(w, r, 1) {
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+	if w.Code != http.StatusPaymentRequired || !strings.Contains(w.Body.String(), "QUOTA_EXCEEDED") {
+		t.Errorf("item over the limit = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,215 @@
+// Package outbox publishes change events reliably. Handlers write an event
+// row in the same statement as the data change it describes (see Wrap), so
+// an event exists if and only if the change committed. A Dispatcher then
+// delivers stored events to subscribers in the background, retrying failures
+// with backoff: delivery is at-least-once and survives crashes and restarts.
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchSize is how many events one dispatch pass claims
+const batchSize = 100
+
+// maxBackoff caps the delay between delivery attempts of a failing event
+const maxBackoff = time.Hour
+
+// Event is one stored change event
+type Event struct {
+	ID        int64           `json:"id"`
+	OrgID     int64           `json:"org_id"`
+	Topic     string          `json:"topic"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"attempts"`
+}
+
+// Handler receives dispatched events. Returning an error schedules the event
+// for another attempt, so handlers must tolerate duplicates.
+type Handler func(ctx context.Context, e Event) error
+
+// Wrap turns a data-modifying statement ending in RETURNING (which must
+// include org_id) into one that also writes a topic event per affected row,
+// with the returned columns minus org_id as payload, and then selects cols
+// from the affected rows. Both writes commit or fail together. topic must be
+// a constant; it is spliced into the SQL. Each of also ("name AS (stmt)") is
+// a further data-modifying step that may read changed, written with them.
+func Wrap(stmt, topic, cols string, also ...string) string {
+	s := `WITH changed AS (` + stmt + `), events AS (
+		INSERT INTO outbox (org_id, topic, payload)
+		SELECT org_id, '` + strings.ReplaceAll(topic, "'", "''") + `', to_jsonb(changed) - 'org_id' FROM changed
+	)`
+	for _, cte := range also {
+		s += `, ` + cte
+	}
+	return s + `
+	SELECT ` + cols + ` FROM changed`
+}
+
+// Dispatcher delivers stored events to its subscribers
+type Dispatcher struct {
+	db        *sql.DB
+	interval  time.Duration
+	retention time.Duration
+	handlers  []Handler
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDispatcher polls for undelivered events every interval once started, and
+// deletes delivered events older than retention (0 keeps them)
+func NewDispatcher(db *sql.DB, interval, retention time.Duration) *Dispatcher {
+	return &Dispatcher{db: db, interval: interval, retention: retention}
+}
+
+// Subscribe adds a handler for every event. It must be called before Start.
+func (d *Dispatcher) Subscribe(h Handler) {
+	d.handlers = append(d.handlers, h)
+}
+
+// Start runs dispatch passes until Stop; a zero interval leaves it stopped
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.interval <= 0 || d.stop != nil {
+		return
+	}
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				d.pass()
+			}
+		}
+	}(d.stop, d.done)
+}
+
+// Stop ends the loop started by Start and waits for the current pass
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	<-d.done
+	d.stop = nil
+}
+
+// pass drains due events, then prunes delivered ones
+func (d *Dispatcher) pass() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for {
+		n, err := d.DispatchOnce(ctx)
+		if err != nil {
+			log.Printf("outbox dispatch failed: %v", err)
+			return
+		}
+		if n < batchSize {
+			break
+		}
+	}
+	if d.retention > 0 {
+		if _, err := d.db.ExecContext(ctx,
+			`DELETE FROM outbox WHERE dispatched_at < $1`, time.Now().Add(-d.retention)); err != nil {
+			log.Printf("outbox prune failed: %v", err)
+		}
+	}
+}
+
+// DispatchOnce claims up to batchSize due events, oldest first, and hands each
+// to every subscriber. Claimed rows are locked, so several instances can
+// dispatch concurrently without delivering the same event twice in one pass.
+// It returns the number of events claimed.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, org_id, topic, payload, created_at, attempts
+		FROM outbox
+		WHERE dispatched_at IS NULL AND next_attempt_at <= NOW()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.OrgID, &e.Topic, &e.Payload, &e.CreatedAt, &e.Attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		if err := d.deliver(ctx, e); err != nil {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + $3 * INTERVAL '1 second'
+				WHERE id = $1`, e.ID, err.Error(), Backoff(e.Attempts+1).Seconds())
+		} else {
+			_, err = tx.ExecContext(ctx, `UPDATE outbox SET dispatched_at = NOW() WHERE id = $1`, e.ID)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(events), tx.Commit()
+}
+
+// deliver runs every handler and reports their failures together
+func (d *Dispatcher) deliver(ctx context.Context, e Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panic: %v", p)
+		}
+	}()
+	var errs []error
+	for _, h := range d.handlers {
+		if err := h(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Backoff is the delay before the given delivery attempt: 2^attempts
+// seconds, capped at maxBackoff
+func Backoff(attempts int) time.Duration {
+	if attempts >= 12 {
+		return maxBackoff
+	}
+	if b := time.Duration(1<<attempts) * time.Second; b < maxBackoff {
+		return b
+	}
+	return maxBackoff
+}
@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:  time.Second,
+		1:  2 * time.Second,
+		5:  32 * time.Second,
+		11: 34*time.Minute + 8*time.Second,
+		12: time.Hour,
+		64: time.Hour,
+	} {
+		if got := Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	got := Wrap("DELETE FROM t WHERE id = $1 RETURNING id, org_id", "t.deleted", "COUNT(*)")
+	for _, part := range []string{
+		"WITH changed AS (DELETE FROM t WHERE id = $1 RETURNING id, org_id)",
+		"SELECT org_id, 't.deleted', to_jsonb(changed) - 'org_id' FROM changed",
+		"SELECT COUNT(*) FROM changed",
+	} {
+		if !strings.Contains(got, part) {
+			t.Errorf("Wrap() = %s\nmissing %q", got, part)
+		}
+	}
+	if got := Wrap("x", "it's", "id"); !strings.Contains(got, "'it''s'") {
+		t.Errorf("topic not quoted: %s", got)
+	}
+	got = Wrap("x", "t", "id", "extra AS (INSERT INTO u SELECT id FROM changed)")
+	if !strings.Contains(got, "), extra AS (INSERT INTO u SELECT id FROM changed)") || !strings.HasSuffix(got, "SELECT id FROM changed") {
+		t.Errorf("Wrap() with also = %s", got)
+	}
+}
+
+func TestDeliverJoinsErrorsAndRecovers(t *testing.T) {
+	d := NewDispatcher(nil, 0, 0)
+	calls := 0
+	d.Subscribe(func(context.Context, Event) error { calls++; return errors.New("first") })
+	d.Subscribe(func(context.Context, Event) error { calls++; return nil })
+	if err := d.deliver(context.Background(), Event{}); err == nil || err.Error() != "first" || calls != 2 {
+		t.Errorf("deliver = %v after %d calls", err, calls)
+	}
+
+	d.Subscribe(func(context.Context, Event) error { panic("boom") })
+	if err := d.deliver(context.Background(), Event{}); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("deliver with panicking handler = %v", err)
+	}
+}
+
+func TestStartWithoutIntervalIsNoop(t *testing.T) {
+	d := NewDispatcher(nil, 0, 0)
+	d.Start()
+	d.Stop()
+
+	d = NewDispatcher(nil, time.Hour, 0)
+	d.Start()
+	done := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
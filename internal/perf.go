@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"era-inventory-api/internal/problem"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// routeLatency is one route's observed latency in GET /admin/perf-baseline
+type routeLatency struct {
+	Method       string  `json:"method"`
+	Path         string  `json:"path"`
+	Count        uint64  `json:"count"`
+	P95Ms        float64 `json:"p95_ms"`
+	WithinBudget bool    `json:"within_budget"`
+}
+
+// perfBaseline is the body of GET /admin/perf-baseline
+type perfBaseline struct {
+	BudgetP95Ms float64        `json:"budget_p95_ms"`
+	OverBudget  int            `json:"over_budget"`
+	Routes      []routeLatency `json:"routes"`
+}
+
+// routeP95 estimates the 95th percentile latency of every route seen since
+// startup from the request duration histogram, merging status codes
+func (m *Metrics) routeP95() ([]routeLatency, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ method, path string }
+	merged := map[key]*dto.Histogram{}
+	for _, mf := range families {
+		if mf.GetName() != "http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			var k key
+			for _, l := range metric.GetLabel() {
+				switch l.GetName() {
+				case "method":
+					k.method = l.GetValue()
+				case "path":
+					k.path = l.GetValue()
+				}
+			}
+			h := metric.GetHistogram()
+			if acc, ok := merged[k]; ok {
+				*acc.SampleCount += h.GetSampleCount()
+				for i, b := range acc.Bucket {
+					*b.CumulativeCount += h.GetBucket()[i].GetCumulativeCount()
+				}
+				continue
+			}
+			merged[k] = cloneHistogram(h)
+		}
+	}
+
+	routes := make([]routeLatency, 0, len(merged))
+	for k, h := range merged {
+		routes = append(routes, routeLatency{
+			Method: k.method,
+			Path:   k.path,
+			Count:  h.GetSampleCount(),
+			P95Ms:  math.Round(histogramQuantile(0.95, h)*1e5) / 100,
+		})
+	}
+	return routes, nil
+}
+
+func cloneHistogram(h *dto.Histogram) *dto.Histogram {
+	count := h.GetSampleCount()
+	c := &dto.Histogram{SampleCount: &count}
+	for _, b := range h.GetBucket() {
+		upper, cum := b.GetUpperBound(), b.GetCumulativeCount()
+		c.Bucket = append(c.Bucket, &dto.Bucket{UpperBound: &upper, CumulativeCount: &cum})
+	}
+	return c
+}
+
+// histogramQuantile interpolates the q-quantile in seconds within the bucket
+// containing it, as PromQL's histogram_quantile does. Observations beyond the
+// last bucket report that bucket's upper bound.
+func histogramQuantile(q float64, h *dto.Histogram) float64 {
+	total := h.GetSampleCount()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	lower, below := 0.0, 0.0
+	for _, b := range h.GetBucket() {
+		cum := float64(b.GetCumulativeCount())
+		if cum >= rank {
+			if cum == below {
+				return b.GetUpperBound()
+			}
+			return lower + (b.GetUpperBound()-lower)*(rank-below)/(cum-below)
+		}
+		lower, below = b.GetUpperBound(), cum
+	}
+	return lower
+}
+
+// getPerfBaseline reports each route's p95 latency against the PERF_BUDGET_P95
+// budget, slowest first, so list endpoint changes can be checked after a load test
+func (s *Server) getPerfBaseline(w http.ResponseWriter, r *http.Request) {
+	routes, err := s.Metrics.routeP95()
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	budgetMs := float64(s.PerfBudgetP95) / float64(time.Millisecond)
+	out := perfBaseline{BudgetP95Ms: budgetMs, Routes: routes}
+	for i := range out.Routes {
+		out.Routes[i].WithinBudget = budgetMs <= 0 || out.Routes[i].P95Ms <= budgetMs
+		if !out.Routes[i].WithinBudget {
+			out.OverBudget++
+		}
+	}
+	sort.Slice(out.Routes, func(i, j int) bool {
+		a, b := out.Routes[i], out.Routes[j]
+		if a.P95Ms != b.P95Ms {
+			return a.P95Ms > b.P95Ms
+		}
+		return a.Method+" "+a.Path < b.Method+" "+b.Path
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestHistogramQuantile(t *testing.T) {
+	hist := func(total uint64, bounds []float64, cums []uint64) *dto.Histogram {
+		h := &dto.Histogram{SampleCount: &total}
+		for i := range bounds {
+			h.Bucket = append(h.Bucket, &dto.Bucket{UpperBound: &bounds[i], CumulativeCount: &cums[i]})
+		}
+		return h
+	}
+
+	tests := []struct {
+		name string
+		h    *dto.Histogram
+		want float64
+	}{
+		{"empty", hist(0, []float64{0.1}, []uint64{0}), 0},
+		{"first bucket", hist(100, []float64{0.1, 0.5}, []uint64{100, 100}), 0.095},
+		{"interpolated", hist(100, []float64{0.1, 0.5}, []uint64{90, 100}), 0.3},
+		{"beyond last bucket", hist(100, []float64{0.1, 0.5}, []uint64{10, 50}), 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := histogramQuantile(0.95, tt.h); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("p95 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerfBaseline(t *testing.T) {
+	s := &Server{Metrics: NewMetrics(), PerfBudgetP95: 200 * time.Millisecond}
+	for i := 0; i < 20; i++ {
+		s.Metrics.reqLatency.WithLabelValues("GET", "/items", "200").Observe(0.9)
+		s.Metrics.reqLatency.WithLabelValues("GET", "/items", "500").Observe(0.9)
+		s.Metrics.reqLatency.WithLabelValues("GET", "/sites", "200").Observe(0.004)
+	}
+
+	w := httptest.NewRecorder()
+	s.getPerfBaseline(w, httptest.NewRequest(http.MethodGet, "/admin/perf-baseline", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var got perfBaseline
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.BudgetP95Ms != 200 || got.OverBudget != 1 || len(got.Routes) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	items, sites := got.Routes[0], got.Routes[1]
+	if items.Path != "/items" || items.Count != 40 || items.WithinBudget || items.P95Ms <= 500 {
+		t.Errorf("items = %+v, want 40 samples over budget listed first", items)
+	}
+	if sites.Path != "/sites" || !sites.WithinBudget || sites.P95Ms > 5 {
+		t.Errorf("sites = %+v, want within budget", sites)
+	}
+}
@@ -0,0 +1,79 @@
+// Package problem writes RFC 7807 application/problem+json error responses.
+package problem
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"era-inventory-api/internal/requestid"
+)
+
+// ContentType is the media type for problem details responses
+const ContentType = "application/problem+json"
+
+// Details represents an RFC 7807 problem details object.
+// Code is an extension member carrying a stable, machine-readable error code.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// RequestID matches the X-Request-ID response header and the server logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// New builds a problem for the given status, code and human-readable detail
+func New(status int, code, detail string) *Details {
+	return &Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write sends a problem details response. The request path is used as the
+// instance and the request ID is included when a request is available.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	p := New(status, code, detail)
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+	WriteDetails(w, p)
+}
+
+// WriteDetails sends an already-built problem details response
+func WriteDetails(w http.ResponseWriter, p *Details) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// BadRequest sends a 400 problem with the given detail
+func BadRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, http.StatusBadRequest, "BAD_REQUEST", detail)
+}
+
+// NotFound sends a 404 problem
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusNotFound, "NOT_FOUND", "resource not found")
+}
+
+// Conflict sends a 409 problem with the given detail
+func Conflict(w http.ResponseWriter, r *http.Request, detail string) {
+	Write(w, r, http.StatusConflict, "CONFLICT", detail)
+}
+
+// Internal sends a 500 problem for an unexpected error and logs it with the
+// request ID
+func Internal(w http.ResponseWriter, r *http.Request, err error) {
+	if r != nil {
+		log.Printf("request_id=%s %s %s: internal error: %v", requestid.FromContext(r.Context()), r.Method, r.URL.Path, err)
+	}
+	Write(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+}
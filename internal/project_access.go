@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/service"
+)
+
+// projectAccessInput is the body accepted by PUT /users/{id}/projects
+type projectAccessInput struct {
+	ProjectIDs []int64 `json:"project_ids"`
+}
+
+// projectRestricted reports whether project membership applies to the
+// caller: project admins only touch items of their projects, unless they
+// also hold a role that sees the whole organization
+func projectRestricted(ctx context.Context) bool {
+	claims := auth.ClaimsFromContext(ctx)
+	return claims != nil && (claims.HasRole("project_admin") || claims.ActsAs("project_admin")) &&
+		!(claims.HasRole("org_admin", "auditor") || claims.ActsAs("org_admin", "auditor"))
+}
+
+// projectAccessClause returns a condition limiting rows of table to the
+// projects the caller is a member of, or "" when the caller is not
+// restricted. A project admin without projects sees no items.
+func projectAccessClause(ctx context.Context, table string, arg int) (string, []interface{}) {
+	if !projectRestricted(ctx) {
+		return "", nil
+	}
+	return fmt.Sprintf(`%[1]s.project_id IN (SELECT p.project_id FROM user_projects p
+		WHERE p.org_id = %[1]s.org_id AND p.user_id = $%[2]d)`, table, arg),
+		[]interface{}{auth.UserIDFromContext(ctx)}
+}
+
+// canUseProject reports whether projectID is a live project of the caller's
+// org and, for restricted callers, one they are a member of
+func (s *Server) canUseProject(ctx context.Context, projectID int64) (exists, member bool, err error) {
+	err = dbFrom(ctx, s.DB).QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL),
+		       EXISTS (SELECT 1 FROM user_projects WHERE project_id = $1 AND org_id = $2 AND user_id = $3)`,
+		projectID, auth.OrgIDFromContext(ctx), auth.UserIDFromContext(ctx)).Scan(&exists, &member)
+	if !projectRestricted(ctx) {
+		member = true
+	}
+	return exists, member, err
+}
+
+// checkProjectAllowed validates the project_id of an item write (see
+// service.CheckItemProject). It writes the error and returns false when the
+// project is not allowed.
+func (s *Server) checkProjectAllowed(w http.ResponseWriter, r *http.Request, projectID *int64) bool {
+	if err := service.CheckItemProject(r.Context(), itemAccess{s}, projectID); err != nil {
+		writeServiceError(w, r, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) listUserProjects(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), `
+		SELECT p.id, p.code, p.name, p.description, p.created_at, p.updated_at
+		FROM user_projects m JOIN projects p ON p.id = m.project_id
+		WHERE m.org_id = $1 AND m.user_id = $2 AND p.deleted_at IS NULL
+		ORDER BY p.code`, orgID, userID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	projects := []models.Project{}
+	for rows.Next() {
+		var p models.Project
+		if err := rows.Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": projects}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// replaceUserProjects sets the projects a user is a member of. Membership
+// only restricts project admins; an empty list leaves them no items.
+func (s *Server) replaceUserProjects(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in projectAccessInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	ids := uniqueIDs(in.ProjectIDs)
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	// the old grants must not be dropped unless the new ones are in place
+	tx, err := beginTx(r.Context(), s.DB)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err := tx.QueryRowContext(r.Context(),
+		`SELECT COUNT(*) FROM projects WHERE org_id = $1 AND id = ANY($2) AND deleted_at IS NULL`, orgID, ids).Scan(&found); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if found != len(ids) {
+		problem.BadRequest(w, r, "project_ids contains unknown projects")
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `
+		DELETE FROM user_projects
+		WHERE org_id = $1 AND user_id = $2 AND project_id <> ALL($3)`, orgID, userID, ids); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `
+		INSERT INTO user_projects (org_id, user_id, project_id)
+		SELECT $1, $2, id FROM projects WHERE org_id = $1 AND id = ANY($3)
+		ON CONFLICT DO NOTHING`, orgID, userID, ids); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	s.listUserProjects(w, r)
+}
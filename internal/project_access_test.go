@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+)
+
+func TestProjectAccessClause(t *testing.T) {
+	for _, roles := range [][]string{{"org_admin"}, {"auditor"}, {"viewer"}, {"project_admin", "org_admin"}} {
+		ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 1, Roles: roles})
+		if clause, args := projectAccessClause(ctx, "inventory", 3); clause != "" || args != nil {
+			t.Errorf("%v must not be restricted, got %q %v", roles, clause, args)
+		}
+	}
+
+	ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 7, Roles: []string{"project_admin"}})
+	ctx = context.WithValue(ctx, auth.UserIDKey, int64(7))
+	clause, args := projectAccessClause(ctx, "i", 5)
+	if !strings.Contains(clause, "i.project_id IN") || !strings.Contains(clause, "p.user_id = $5") {
+		t.Errorf("Unexpected clause %q", clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(7)}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+func TestProjectRestrictedCustomRoles(t *testing.T) {
+	manager := auth.NewJWTManager("test-secret-key-that-is-long-enough-for-testing", "test-issuer", "test-audience", time.Hour)
+	roles := auth.NewRoleRegistry()
+	roles.Set(1, "stock_clerk", []string{auth.PermAssetsRead, auth.PermAssetsWrite})
+	roles.Set(1, "deputy", auth.Permissions)
+	manager.SetRoles(roles)
+
+	for role, want := range map[string]bool{"stock_clerk": true, "deputy": false} {
+		claims := manager.Resolve(&auth.Claims{UserID: 7, OrgID: 1, Roles: []string{role}})
+		ctx := context.WithValue(context.Background(), auth.ClaimsKey, claims)
+		if got := projectRestricted(ctx); got != want {
+			t.Errorf("%s: projectRestricted = %v, want %v", role, got, want)
+		}
+	}
+}
+
+func TestSiteAccessClauseAddsProjects(t *testing.T) {
+	ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 7, Roles: []string{"project_admin"}, SiteIDs: []int64{4}})
+	ctx = context.WithValue(ctx, auth.UserIDKey, int64(7))
+	clause, args := siteAccessClause(ctx, "inventory", 2)
+	if !strings.Contains(clause, "a.user_id = $2") || !strings.Contains(clause, "ANY($3)") || !strings.Contains(clause, "p.user_id = $4") {
+		t.Errorf("Expected grant, token and project conditions, got %q", clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(7), []int64{4}, int64(7)}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+func TestCheckProjectAllowedRequiresProject(t *testing.T) {
+	ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 7, Roles: []string{"project_admin"}})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/items", nil).WithContext(ctx)
+	if (&Server{}).checkProjectAllowed(w, r, nil) || w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "PROJECT_FORBIDDEN") {
+		t.Errorf("status = %d, body %s", w.Code, w.Body)
+	}
+
+	ctx = context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 1, Roles: []string{"org_admin"}})
+	w = httptest.NewRecorder()
+	if !(&Server{}).checkProjectAllowed(w, r.WithContext(ctx), nil) {
+		t.Errorf("org_admin may create items outside projects, got %d", w.Code)
+	}
+}
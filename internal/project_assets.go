@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/outbox"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
+)
+
+// maxProjectAssetIDs caps item_ids in one POST /projects/{id}/assets
+const maxProjectAssetIDs = 1000
+
+// projectAssetsInput is the body of POST /projects/{id}/assets: either explicit
+// item ids or a filter matching items the way GET /items does
+type projectAssetsInput struct {
+	ItemIDs []int64             `json:"item_ids"`
+	Filter  *projectAssetFilter `json:"filter"`
+}
+
+type projectAssetFilter struct {
+	Q       string   `json:"q"`
+	Status  string   `json:"status"`
+	Tags    []string `json:"tags"`
+	GroupID int64    `json:"group_id"`
+}
+
+// projectAssetsResult reports how many items a bulk attach moved into the project
+type projectAssetsResult struct {
+	ProjectID int64 `json:"project_id"`
+	Attached  int   `json:"attached"`
+}
+
+// projectInOrg resolves {id} to a live project of the caller's org, answering
+// 404 otherwise
+func (s *Server) projectInOrg(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return 0, false
+	}
+	var exists bool
+	err := dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(),
+		`SELECT EXISTS (SELECT 1 FROM projects WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)`,
+		id, auth.OrgIDFromContext(r.Context())).Scan(&exists)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return 0, false
+	}
+	if !exists {
+		problem.NotFound(w, r)
+		return 0, false
+	}
+	return id, true
+}
+
+// listProjectAssets lists the items attached to a project, with the GET /items
+// filters, sort and envelope
+func (s *Server) listProjectAssets(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := s.projectInOrg(w, r)
+	if !ok {
+		return
+	}
+	params := s.parseListParams(r)
+	where, err := itemFilter(r, params)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	where.And("project_id = ?", projectID)
+
+	q := dbFrom(r.Context(), s.DB)
+	countExpr, meta := s.countExpr(r.Context(), q, "inventory"+where.Clause(), where.Args())
+	sqlStr := fmt.Sprintf(`
+		SELECT id, asset_tag, name, manufacturer, model, device_type, site,
+		       installed_at, warranty_end, notes, status, created_at, updated_at,
+		       %s as total_count
+		FROM inventory%s`, countExpr, where.Clause())
+	sqlStr += query.OrderBy(params.sort, itemSort)
+	sqlStr += fmt.Sprintf(" LIMIT %d OFFSET %d", params.limit, params.offset)
+
+	rows, err := q.QueryContext(r.Context(), sqlStr, where.Args()...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []interface{}{}
+	var totalCount int
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(
+			&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType,
+			&it.Site, &it.InstalledAt, &it.WarrantyEnd, &it.Notes, &it.Status, &it.CreatedAt, &it.UpdatedAt,
+			&totalCount,
+		); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if meta != nil {
+		totalCount = meta.EstimatedTotal
+	}
+	sendListResponse(w, items, totalCount, params, meta)
+}
+
+// attachProjectAssets attaches items to a project in one statement. An item
+// belongs to at most one project, so attaching moves it from any other.
+// Explicit item_ids must all name visible items or nothing is attached.
+func (s *Server) attachProjectAssets(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := s.projectInOrg(w, r)
+	if !ok || !s.checkProjectAllowed(w, r, &projectID) {
+		return
+	}
+	var in projectAssetsInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if (len(in.ItemIDs) > 0) == (in.Filter != nil) {
+		problem.BadRequest(w, r, "provide either item_ids or filter")
+		return
+	}
+	if len(in.ItemIDs) > maxProjectAssetIDs {
+		problem.BadRequest(w, r, fmt.Sprintf("at most %d item_ids per request", maxProjectAssetIDs))
+		return
+	}
+
+	var where *query.Where
+	var err error
+	if in.Filter != nil {
+		if in.Filter.Q == "" && in.Filter.Status == "" && len(in.Filter.Tags) == 0 && in.Filter.GroupID == 0 {
+			problem.BadRequest(w, r, "filter needs q, status, tags or group_id")
+			return
+		}
+		where, err = itemFilterFor(r.Context(), in.Filter.Status, in.Filter.Q, in.Filter.Tags)
+		if err == nil && in.Filter.GroupID != 0 {
+			andAssetGroup(where, in.Filter.GroupID)
+		}
+	} else {
+		where, err = itemFilterFor(r.Context(), "", "", nil)
+	}
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	q := dbFrom(r.Context(), s.DB)
+	if len(in.ItemIDs) > 0 {
+		where.And("id = ANY(?)", in.ItemIDs)
+		missing, err := missingItemIDs(r, q, where, in.ItemIDs)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if len(missing) > 0 {
+			problem.BadRequest(w, r, "unknown item_ids: "+joinIDs(missing))
+			return
+		}
+	}
+
+	// items already in the project are left alone and not counted
+	args := append(where.Args(), projectID)
+	sqlStr := fmt.Sprintf(`UPDATE inventory SET project_id = $%[1]d%[2]s AND project_id IS DISTINCT FROM $%[1]d
+		RETURNING `+itemEventColumns, len(args), where.Clause())
+	out := projectAssetsResult{ProjectID: projectID}
+	if err := q.QueryRowContext(r.Context(), outbox.Wrap(sqlStr, topicItemUpdated, "COUNT(*)"), args...).Scan(&out.Attached); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// missingItemIDs returns the ids that where does not match, sorted
+func missingItemIDs(r *http.Request, q querier, where *query.Where, ids []int64) ([]int64, error) {
+	rows, err := q.QueryContext(r.Context(), "SELECT id FROM inventory"+where.Clause(), where.Args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	found := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var missing []int64
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !found[id] && !seen[id] {
+			missing = append(missing, id)
+			seen[id] = true
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	return missing, nil
+}
+
+// joinIDs renders ids as a comma-separated list
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ", ")
+}
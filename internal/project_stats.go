@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// unspecifiedDeviceType is the by_device_type key of items without a device type
+const unspecifiedDeviceType = "unspecified"
+
+// projectStats is the GET /projects/{id}/stats rollup of a project's assets
+type projectStats struct {
+	ProjectID    int64          `json:"project_id"`
+	Assets       int            `json:"assets"`
+	ByDeviceType map[string]int `json:"by_device_type"`
+	ByStatus     map[string]int `json:"by_status"`
+	GeneratedAt  time.Time      `json:"generated_at"`
+}
+
+// getProjectStats counts the project's live items by device type and status,
+// limited to the sites the caller may see
+func (s *Server) getProjectStats(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := s.projectInOrg(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+
+	where := "org_id = $1 AND project_id = $2 AND deleted_at IS NULL"
+	args := []interface{}{auth.OrgIDFromContext(ctx), projectID}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", 3); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+
+	rows, err := dbFrom(ctx, s.DB).QueryContext(ctx, `
+		SELECT COALESCE(NULLIF(device_type, ''), '`+unspecifiedDeviceType+`'), status, COUNT(*)
+		FROM inventory WHERE `+where+`
+		GROUP BY 1, 2`, args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := projectStats{
+		ProjectID:    projectID,
+		ByDeviceType: map[string]int{},
+		ByStatus:     map[string]int{},
+		GeneratedAt:  time.Now().UTC(),
+	}
+	for rows.Next() {
+		var deviceType, status string
+		var n int
+		if err := rows.Scan(&deviceType, &status, &n); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out.Assets += n
+		out.ByDeviceType[deviceType] += n
+		out.ByStatus[status] += n
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -9,55 +9,53 @@ import (
 
 	"era-inventory-api/internal/auth"
 	"era-inventory-api/internal/models"
-
-	"github.com/go-chi/chi/v5"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/query"
 )
 
+// projectSort maps the project sort keys to columns
+var projectSort = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
 // LIST with basic filters & pagination
 func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
-	params := parseListParams(r)
+	params := s.parseListParams(r)
 	orgID := auth.OrgIDFromContext(r.Context())
 
-	clauses := []string{}
-	args := []interface{}{}
-	arg := 1
-
 	// org filter - use context value instead of query param
-	clauses = append(clauses, fmt.Sprintf("org_id = $%d", arg))
-	args = append(args, orgID)
-	arg++
+	where := query.OrgScoped(orgID)
+
+	// deleted rows live in the trash until restored or purged
+	where.And("deleted_at IS NULL")
 
 	// optional text search on name
 	if params.q != "" {
-		clauses = append(clauses, fmt.Sprintf("(code ILIKE $%d OR name ILIKE $%d)", arg, arg))
-		args = append(args, "%"+params.q+"%")
-		arg++
+		pattern := "%" + params.q + "%"
+		where.And("(code ILIKE ? OR name ILIKE ?)", pattern, pattern)
 	}
 
-	whereClause := ""
-	if len(clauses) > 0 {
-		whereClause = " WHERE " + strings.Join(clauses, " AND ")
-	}
+	whereClause := where.Clause()
+	args := where.Args()
 
-	// Build the main query with COUNT(*) OVER() to get total count
+	q := dbFrom(r.Context(), s.DB)
+	countExpr, meta := s.countExpr(r.Context(), q, "projects"+whereClause, args)
+
+	// Build the main query; total_count is COUNT(*) OVER() unless the scan budget is exceeded
 	sqlStr := fmt.Sprintf(`
 		SELECT id, code, name, description, created_at, updated_at,
-		       COUNT(*) OVER() as total_count
-		FROM projects%s`, whereClause)
+		       %s as total_count
+		FROM projects%s`, countExpr, whereClause)
 
-	allowedSort := map[string]string{
-		"id":         "id",
-		"name":       "name",
-		"created_at": "created_at",
-		"updated_at": "updated_at",
-	}
-	sqlStr += buildOrderBy(params.sort, allowedSort)
+	sqlStr += query.OrderBy(params.sort, projectSort)
 	sqlStr += fmt.Sprintf(" LIMIT %d OFFSET %d", params.limit, params.offset)
 
-	q := dbFrom(r.Context(), s.DB)
 	rows, err := q.QueryContext(r.Context(), sqlStr, args...)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		problem.Internal(w, r, err)
 		return
 	}
 	defer rows.Close()
@@ -67,46 +65,53 @@ func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var p models.Project
 		if err := rows.Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt, &totalCount); err != nil {
-			http.Error(w, err.Error(), 500)
+			problem.Internal(w, r, err)
 			return
 		}
 		projects = append(projects, p)
 	}
 
-	sendListResponse(w, projects, totalCount, params)
+	if meta != nil {
+		totalCount = meta.EstimatedTotal
+	}
+
+	sendListResponse(w, projects, totalCount, params, meta)
 }
 
 func (s *Server) getProject(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
 	orgID := auth.OrgIDFromContext(r.Context())
 
 	var p models.Project
 	q := dbFrom(r.Context(), s.DB)
 	err := q.QueryRowContext(r.Context(), `
 		SELECT id, code, name, description, created_at, updated_at
-		FROM projects WHERE id = $1 AND org_id = $2`, id, orgID).Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt)
+		FROM projects WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`, id, orgID).Scan(&p.ID, &p.Code, &p.Name, &p.Description, &p.CreatedAt, &p.UpdatedAt)
 	if err == sql.ErrNoRows {
-		http.Error(w, "not found", http.StatusNotFound)
+		problem.NotFound(w, r)
 		return
 	}
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		problem.Internal(w, r, err)
 		return
 	}
+	setLastModified(w, p.UpdatedAt)
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, err)
 	}
 }
 
 func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 	var in models.Project
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "invalid JSON", 400)
+	if !s.decodeJSON(w, r, &in) {
 		return
 	}
 	if strings.TrimSpace(in.Code) == "" || strings.TrimSpace(in.Name) == "" {
-		http.Error(w, "code and name are required", 400)
+		problem.BadRequest(w, r, "code and name are required")
 		return
 	}
 
@@ -120,93 +125,88 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 	`, in.Code, in.Name, nullIfEmpty(in.Description), orgID).Scan(&in.ID, &in.Code, &in.Name, &in.Description, &in.CreatedAt, &in.UpdatedAt)
 	if err != nil {
 		if strings.Contains(strings.ToLower(err.Error()), "unique") {
-			http.Error(w, "code already exists", http.StatusConflict)
+			problem.Conflict(w, r, "code already exists")
 			return
 		}
-		http.Error(w, err.Error(), 500)
+		problem.Internal(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(in); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, err)
 	}
 }
 
 func (s *Server) updateProject(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
 	orgID := auth.OrgIDFromContext(r.Context())
 
 	var in models.Project
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "invalid JSON", 400)
+	if !s.decodeJSON(w, r, &in) {
 		return
 	}
 
-	type set struct {
-		sql string
-		val interface{}
-	}
-	sets := make([]set, 0, 5)
+	upd := query.NewUpdate("projects", orgID)
 	if strings.TrimSpace(in.Code) != "" {
-		sets = append(sets, set{"code = $%d", in.Code})
+		upd.Set("code", in.Code)
 	}
 	if strings.TrimSpace(in.Name) != "" {
-		sets = append(sets, set{"name = $%d", in.Name})
+		upd.Set("name", in.Name)
 	}
 	if in.Description != nil {
-		sets = append(sets, set{"description = $%d", nullIfEmpty(in.Description)})
+		upd.Set("description", nullIfEmpty(in.Description))
 	}
-	if len(sets) == 0 {
-		http.Error(w, "no fields to update", 400)
+	if upd.Empty() {
+		problem.BadRequest(w, r, "no fields to update")
 		return
 	}
 
-	args := make([]interface{}, 0, len(sets)+2)
-	sqlStr := "UPDATE projects SET "
-	for i, sset := range sets {
-		if i > 0 {
-			sqlStr += ", "
-		}
-		sqlStr += fmt.Sprintf(sset.sql, i+1)
-		args = append(args, sset.val)
-	}
-	sqlStr += fmt.Sprintf(" WHERE id = $%d AND org_id = $%d RETURNING id, code, name, description, created_at, updated_at", len(args)+1, len(args)+2)
-	args = append(args, id, orgID)
+	upd.And("id = ?", id)
+	upd.And("deleted_at IS NULL")
+	sqlStr := upd.SQL("RETURNING id, code, name, description, created_at, updated_at")
 
 	q := dbFrom(r.Context(), s.DB)
 	var out models.Project
-	if err := q.QueryRowContext(r.Context(), sqlStr, args...).Scan(&out.ID, &out.Code, &out.Name, &out.Description, &out.CreatedAt, &out.UpdatedAt); err != nil {
+	if err := q.QueryRowContext(r.Context(), sqlStr, upd.Args()...).Scan(&out.ID, &out.Code, &out.Name, &out.Description, &out.CreatedAt, &out.UpdatedAt); err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, "not found", http.StatusNotFound)
+			problem.NotFound(w, r)
 			return
 		}
 		if strings.Contains(strings.ToLower(err.Error()), "unique") {
-			http.Error(w, "code already exists", http.StatusConflict)
+			problem.Conflict(w, r, "code already exists")
 			return
 		}
-		http.Error(w, err.Error(), 500)
+		problem.Internal(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(out); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, err)
 	}
 }
 
+// deleteProject soft-deletes; the project can be restored from the trash
 func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
 	orgID := auth.OrgIDFromContext(r.Context())
 
 	q := dbFrom(r.Context(), s.DB)
-	res, err := q.ExecContext(r.Context(), `DELETE FROM projects WHERE id = $1 AND org_id = $2`, id, orgID)
+	res, err := q.ExecContext(r.Context(),
+		`UPDATE projects SET deleted_at = NOW() WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`, id, orgID)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		problem.Internal(w, r, err)
 		return
 	}
 	n, _ := res.RowsAffected()
 	if n == 0 {
-		http.Error(w, "not found", http.StatusNotFound)
+		problem.NotFound(w, r)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
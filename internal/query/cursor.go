@@ -0,0 +1,103 @@
+package query
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for cursors that do not decode or do not
+// match the requested sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a keyset page: the value of its sort key and
+// its id, which breaks ties. Clients treat the encoded form as opaque.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// Encode returns the opaque form handed to clients as next_cursor
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Encode
+func DecodeCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Keyset is a single-key sort usable for keyset pagination, with id as the
+// tie-breaker so every row has a unique position
+type Keyset struct {
+	Sort   string // the sort parameter, e.g. "-created_at"
+	Column string
+	Desc   bool
+}
+
+// ParseKeyset resolves sort against allowed (as for OrderBy). Keyset pages
+// need a total order, so only one key is accepted; empty means "id".
+func ParseKeyset(sort string, allowed map[string]string) (Keyset, error) {
+	sort = strings.TrimSpace(sort)
+	if sort == "" {
+		sort = "id"
+	}
+	key := strings.TrimPrefix(sort, "-")
+	col, ok := allowed[key]
+	if !ok || strings.Contains(sort, ",") {
+		return Keyset{}, errors.New("cursor pagination supports a single sort key")
+	}
+	return Keyset{Sort: sort, Column: col, Desc: strings.HasPrefix(sort, "-")}, nil
+}
+
+// OrderBy returns the ORDER BY clause for the keyset
+func (k Keyset) OrderBy() string {
+	dir := " ASC"
+	if k.Desc {
+		dir = " DESC"
+	}
+	if k.Column == "id" {
+		return " ORDER BY id" + dir
+	}
+	return " ORDER BY " + k.Column + dir + ", id" + dir
+}
+
+// After narrows w to the rows following the cursor row; value is the
+// cursor's sort value converted to the column's type
+func (k Keyset) After(w *Where, value any, id int64) {
+	op := ">"
+	if k.Desc {
+		op = "<"
+	}
+	if k.Column == "id" {
+		w.And("id "+op+" ?", id)
+		return
+	}
+	w.And("("+k.Column+", id) "+op+" (?, ?)", value, id)
+}
+
+// Count returns the number of rows a SELECT over from would return: an exact
+// COUNT(*) when the planner expects at most budget rows (or budget is 0), the
+// planner estimate otherwise, with estimated set.
+func Count(ctx context.Context, q RowQuerier, from string, args []interface{}, budget int) (total int, estimated bool, err error) {
+	if budget > 0 {
+		estimate, err := EstimateRows(ctx, q, from, args)
+		if err == nil && estimate > budget {
+			return estimate, true, nil
+		}
+	}
+	err = q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from, args...).Scan(&total)
+	return total, false, err
+}
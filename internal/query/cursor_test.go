@@ -0,0 +1,50 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{Sort: "-created_at", Value: "2024-05-01T10:00:00.123456Z", ID: 42}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil || got != c {
+		t.Fatalf("DecodeCursor = %+v, %v; want %+v", got, err, c)
+	}
+	for _, bad := range []string{"", "not base64!", Cursor{Sort: "id"}.Encode()} {
+		if _, err := DecodeCursor(bad); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) err = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	allowed := map[string]string{"id": "id", "name": "name"}
+
+	if _, err := ParseKeyset("name,-id", allowed); err == nil {
+		t.Error("multi-key sort accepted")
+	}
+	if _, err := ParseKeyset("color", allowed); err == nil {
+		t.Error("unknown sort key accepted")
+	}
+
+	ks, err := ParseKeyset("-name", allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := OrgScoped(1)
+	ks.After(w, "Router", 9)
+	if got, want := w.Clause()+ks.OrderBy(), " WHERE org_id = $1 AND (name, id) < ($2, $3) ORDER BY name DESC, id DESC"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if !reflect.DeepEqual(w.Args(), []interface{}{int64(1), "Router", int64(9)}) {
+		t.Errorf("Args = %v", w.Args())
+	}
+
+	ks, _ = ParseKeyset("", allowed)
+	w = OrgScoped(1)
+	ks.After(w, "", 9)
+	if got, want := w.Clause()+ks.OrderBy(), " WHERE org_id = $1 AND id > $2 ORDER BY id ASC"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
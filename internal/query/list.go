@@ -0,0 +1,105 @@
+package query
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RowQuerier runs single-row queries; *sql.DB, *sql.Conn and *sql.Tx satisfy it
+type RowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// OrderBy builds a safe ORDER BY clause using a whitelist of allowed keys.
+// allowed maps incoming sort keys (e.g., "name") to actual column identifiers.
+// Input sort is comma-separated; prefix with '-' for DESC.
+// Returns a string starting with " ORDER BY ...". Defaults to " ORDER BY id ASC".
+func OrderBy(sortParam string, allowed map[string]string) string {
+	if sortParam == "" {
+		if col, ok := allowed["id"]; ok {
+			return " ORDER BY " + col + " ASC"
+		}
+		return " ORDER BY id ASC"
+	}
+
+	parts := strings.Split(sortParam, ",")
+	clauses := make([]string, 0, len(parts))
+	for _, raw := range parts {
+		s := strings.TrimSpace(raw)
+		if s == "" {
+			continue
+		}
+		desc := false
+		if strings.HasPrefix(s, "-") {
+			desc = true
+			s = strings.TrimPrefix(s, "-")
+		}
+		col, ok := allowed[s]
+		if !ok {
+			continue
+		}
+		if desc {
+			clauses = append(clauses, col+" DESC")
+		} else {
+			clauses = append(clauses, col+" ASC")
+		}
+	}
+	if len(clauses) == 0 {
+		if col, ok := allowed["id"]; ok {
+			return " ORDER BY " + col + " ASC"
+		}
+		return " ORDER BY id ASC"
+	}
+	return " ORDER BY " + strings.Join(clauses, ", ")
+}
+
+// SortKeys lists the keys OrderBy accepts for allowed, in alphabetical order
+func SortKeys(allowed map[string]string) []string {
+	keys := make([]string, 0, len(allowed))
+	for k := range allowed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CountExpr picks the total_count expression for a list query over from
+// (a table name followed by its WHERE clause). Counting with COUNT(*) OVER()
+// forces a scan of every matching row, so when the planner expects more rows
+// than budget the count is skipped: the expression is "0" and the planner
+// estimate is returned instead. A zero budget or a failed estimate falls back
+// to an exact count, reported with a zero estimate.
+func CountExpr(ctx context.Context, q RowQuerier, from string, args []interface{}, budget int) (string, int) {
+	if budget <= 0 {
+		return "COUNT(*) OVER()", 0
+	}
+	estimate, err := EstimateRows(ctx, q, from, args)
+	if err != nil || estimate <= budget {
+		return "COUNT(*) OVER()", 0
+	}
+	return "0", estimate
+}
+
+// EstimateRows asks the planner how many rows a SELECT over from would return
+func EstimateRows(ctx context.Context, q RowQuerier, from string, args []interface{}) (int, error) {
+	var raw []byte
+	if err := q.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) SELECT 1 FROM "+from, args...).Scan(&raw); err != nil {
+		return 0, err
+	}
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &plans); err != nil {
+		return 0, err
+	}
+	if len(plans) == 0 {
+		return 0, fmt.Errorf("empty plan")
+	}
+	return int(plans[0].Plan.Rows), nil
+}
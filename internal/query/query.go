@@ -0,0 +1,105 @@
+// Package query builds the dynamic parts of handler SQL (filters and partial
+// updates) with placeholders numbered as values are added, so a clause can
+// never point at the wrong argument. Org-scoped builders start with the
+// org_id condition, so tenant filtering cannot be forgotten.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Where accumulates AND-ed conditions and their arguments
+type Where struct {
+	conds []string
+	args  []interface{}
+}
+
+// OrgScoped returns conditions restricted to one organization
+func OrgScoped(orgID int64) *Where {
+	w := &Where{}
+	w.And("org_id = ?", orgID)
+	return w
+}
+
+// And adds a condition. Each ? in cond is replaced by the placeholder of the
+// matching value; the number of ? must match the number of values.
+func (w *Where) And(cond string, vals ...interface{}) {
+	if n := strings.Count(cond, "?"); n != len(vals) {
+		panic(fmt.Sprintf("query: %q has %d placeholders but %d values", cond, n, len(vals)))
+	}
+	var b strings.Builder
+	for _, v := range vals {
+		i := strings.IndexByte(cond, '?')
+		b.WriteString(cond[:i])
+		b.WriteString(w.arg(v))
+		cond = cond[i+1:]
+	}
+	b.WriteString(cond)
+	w.conds = append(w.conds, b.String())
+}
+
+// AndNumbered adds a condition whose placeholders were already numbered from
+// Next, for helpers such as siteAccessClause that build their own SQL
+func (w *Where) AndNumbered(cond string, vals []interface{}) {
+	w.conds = append(w.conds, cond)
+	w.args = append(w.args, vals...)
+}
+
+// Next is the number the next placeholder will get
+func (w *Where) Next() int {
+	return len(w.args) + 1
+}
+
+// Args returns the values in placeholder order
+func (w *Where) Args() []interface{} {
+	return w.args
+}
+
+// Clause renders " WHERE ..." or "" when there are no conditions
+func (w *Where) Clause() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func (w *Where) arg(v interface{}) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+// Update builds an org-scoped partial UPDATE; only columns passed to Set are
+// written
+type Update struct {
+	Where
+	table string
+	sets  []string
+}
+
+// NewUpdate starts an UPDATE of table restricted to one organization
+func NewUpdate(table string, orgID int64) *Update {
+	u := &Update{table: table}
+	u.And("org_id = ?", orgID)
+	return u
+}
+
+// Set writes column to v
+func (u *Update) Set(column string, v interface{}) {
+	u.sets = append(u.sets, column+" = "+u.arg(v))
+}
+
+// Empty reports whether no column has been set
+func (u *Update) Empty() bool {
+	return len(u.sets) == 0
+}
+
+// SQL renders the statement; suffix (e.g. "RETURNING ...") is appended as is
+func (u *Update) SQL(suffix string) string {
+	s := "UPDATE " + u.table + " SET " + strings.Join(u.sets, ", ") + u.Clause()
+	if suffix != "" {
+		s += " " + suffix
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhere(t *testing.T) {
+	w := OrgScoped(7)
+	w.And("deleted_at IS NULL")
+	w.And("(name ILIKE ? OR asset_tag ILIKE ?)", "%a%", "%a%")
+	if w.Next() != 4 {
+		t.Fatalf("Next = %d, want 4", w.Next())
+	}
+	w.AndNumbered("site_id = ANY($4)", []interface{}{[]int64{1}})
+
+	want := " WHERE org_id = $1 AND deleted_at IS NULL AND (name ILIKE $2 OR asset_tag ILIKE $3) AND site_id = ANY($4)"
+	if got := w.Clause(); got != want {
+		t.Errorf("Clause =\n%q\nwant\n%q", got, want)
+	}
+	if got := w.Args(); !reflect.DeepEqual(got, []interface{}{int64(7), "%a%", "%a%", []int64{1}}) {
+		t.Errorf("Args = %v", got)
+	}
+	if (&Where{}).Clause() != "" {
+		t.Error("empty Where should render nothing")
+	}
+}
+
+func TestWherePlaceholderMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a missing value")
+		}
+	}()
+	(&Where{}).And("a = ? AND b = ?", 1)
+}
+
+func TestUpdate(t *testing.T) {
+	u := NewUpdate("sites", 3)
+	if !u.Empty() {
+		t.Error("new update should be empty")
+	}
+	u.Set("name", "HQ")
+	u.Set("notes", nil)
+	u.And("id = ?", "12")
+	u.And("deleted_at IS NULL")
+
+	want := "UPDATE sites SET name = $2, notes = $3 WHERE org_id = $1 AND id = $4 AND deleted_at IS NULL RETURNING id"
+	if got := u.SQL("RETURNING id"); got != want {
+		t.Errorf("SQL =\n%q\nwant\n%q", got, want)
+	}
+	if got := u.Args(); !reflect.DeepEqual(got, []interface{}{int64(3), "HQ", nil, "12"}) {
+		t.Errorf("Args = %v", got)
+	}
+}
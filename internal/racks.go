@@ -0,0 +1,420 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// maxRackUnits is the tallest rack accepted, as the table enforces
+const maxRackUnits = 60
+
+// rackColumns is what rack queries select, in scanRack order
+const rackColumns = `k.id, k.site_id, k.name, k.units, k.description, k.created_at, k.updated_at,
+	(SELECT COALESCE(SUM(COALESCE(i.rack_units, 1)), 0) FROM inventory i WHERE i.rack_id = k.id AND i.deleted_at IS NULL)`
+
+// rackInput is the body of POST /racks and PUT /racks/{id}
+type rackInput struct {
+	SiteID      *int    `json:"site_id"`
+	Name        *string `json:"name"`
+	Units       *int    `json:"units"`
+	Description *string `json:"description"`
+}
+
+// rackPlacement is where an item sits in a rack
+type rackPlacement struct {
+	rackID   int64
+	position int
+	units    int
+}
+
+// top is the highest unit the placement occupies
+func (p rackPlacement) top() int {
+	return p.position + p.units - 1
+}
+
+func scanRack(row interface{ Scan(...any) error }) (*models.Rack, error) {
+	var k models.Rack
+	if err := row.Scan(&k.ID, &k.SiteID, &k.Name, &k.Units, &k.Description, &k.CreatedAt, &k.UpdatedAt, &k.UsedUnits); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func checkRackFields(in rackInput) error {
+	if in.Name != nil && (strings.TrimSpace(*in.Name) == "" || len(*in.Name) > 100) {
+		return fmt.Errorf("name must be 1 to 100 characters")
+	}
+	if in.Units != nil && (*in.Units < 1 || *in.Units > maxRackUnits) {
+		return fmt.Errorf("units must be between 1 and %d", maxRackUnits)
+	}
+	return nil
+}
+
+// elevation lays out the items of a rack, sorted by position, top unit first
+// as racks are drawn, with a free slot for each gap between them
+func elevation(units int, placed []rackPlacement, items []models.RackedItem) []models.RackSlot {
+	order := make([]int, len(placed))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return placed[order[a]].position > placed[order[b]].position })
+
+	slots := []models.RackSlot{}
+	free := units // highest unit not yet laid out
+	for _, i := range order {
+		p := placed[i]
+		if p.top() < free {
+			slots = append(slots, models.RackSlot{Position: p.top() + 1, Units: free - p.top()})
+		}
+		item := items[i]
+		slots = append(slots, models.RackSlot{Position: p.position, Units: p.units, Item: &item})
+		if p.position-1 < free {
+			free = p.position - 1
+		}
+	}
+	if free >= 1 {
+		slots = append(slots, models.RackSlot{Position: 1, Units: free})
+	}
+	return slots
+}
+
+// rackInOrg loads the {id} rack of the caller's org, writing 404 if there is none
+func (s *Server) rackInOrg(w http.ResponseWriter, r *http.Request) (*models.Rack, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return nil, false
+	}
+	k, err := scanRack(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(),
+		`SELECT `+rackColumns+` FROM racks k WHERE k.id = $1 AND k.org_id = $2`, id, auth.OrgIDFromContext(r.Context())))
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return nil, false
+	}
+	return k, true
+}
+
+// siteInOrg reports whether siteID names a live site of the caller's org
+func (s *Server) siteInOrg(ctx context.Context, siteID int) (bool, error) {
+	var ok bool
+	err := dbFrom(ctx, s.DB).QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM sites WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL)`,
+		siteID, auth.OrgIDFromContext(ctx)).Scan(&ok)
+	return ok, err
+}
+
+// checkRackPlacement writes 400 when p does not fit its rack and 409 when
+// another live item holds one of its units. itemID is the item being placed
+// (0 for a new one).
+func (s *Server) checkRackPlacement(w http.ResponseWriter, r *http.Request, itemID int, p rackPlacement) bool {
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+	var units int
+	err := q.QueryRowContext(r.Context(), `SELECT units FROM racks WHERE id = $1 AND org_id = $2`, p.rackID, orgID).Scan(&units)
+	if err == sql.ErrNoRows {
+		problem.BadRequest(w, r, "rack_id does not name a rack")
+		return false
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return false
+	}
+	if p.position < 1 || p.units < 1 || p.top() > units {
+		problem.BadRequest(w, r, fmt.Sprintf("rack_position and rack_units must fit in the rack's %d units", units))
+		return false
+	}
+
+	var otherID, otherPos, otherUnits int
+	var otherName string
+	err = q.QueryRowContext(r.Context(), `
+		SELECT id, name, rack_position, COALESCE(rack_units, 1) FROM inventory
+		WHERE org_id = $1 AND rack_id = $2 AND deleted_at IS NULL AND id <> $3
+		  AND rack_position <= $5 AND rack_position + COALESCE(rack_units, 1) - 1 >= $4
+		ORDER BY rack_position LIMIT 1`,
+		orgID, p.rackID, itemID, p.position, p.top()).Scan(&otherID, &otherName, &otherPos, &otherUnits)
+	if err == nil {
+		problem.Write(w, r, http.StatusConflict, "RACK_UNITS_TAKEN",
+			fmt.Sprintf("item %d (%s) occupies U%d-U%d", otherID, otherName, otherPos, otherPos+otherUnits-1))
+		return false
+	}
+	if err != sql.ErrNoRows {
+		problem.Internal(w, r, err)
+		return false
+	}
+	return true
+}
+
+// listRacks lists the org's racks by site and name, optionally for one site
+func (s *Server) listRacks(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	args := []interface{}{auth.OrgIDFromContext(r.Context())}
+	cond := "k.org_id = $1"
+	if v := r.URL.Query().Get("site_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			problem.BadRequest(w, r, "site_id must be an integer")
+			return
+		}
+		args = append(args, n)
+		cond += " AND k.site_id = $2"
+	}
+
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER() as total_count
+		FROM racks k WHERE %s
+		ORDER BY k.site_id, k.name
+		LIMIT %d OFFSET %d`, rackColumns, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var k models.Rack
+		if err := rows.Scan(&k.ID, &k.SiteID, &k.Name, &k.Units, &k.Description, &k.CreatedAt, &k.UpdatedAt,
+			&k.UsedUnits, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, k)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+func (s *Server) getRack(w http.ResponseWriter, r *http.Request) {
+	if k, ok := s.rackInOrg(w, r); ok {
+		writeJSON(w, r, http.StatusOK, k)
+	}
+}
+
+func (s *Server) createRack(w http.ResponseWriter, r *http.Request) {
+	var in rackInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.SiteID == nil || in.Name == nil {
+		problem.BadRequest(w, r, "site_id and name are required")
+		return
+	}
+	if err := checkRackFields(in); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	if ok, err := s.siteInOrg(r.Context(), *in.SiteID); err != nil || !ok {
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		problem.BadRequest(w, r, "site_id does not name a site")
+		return
+	}
+	units := 42
+	if in.Units != nil {
+		units = *in.Units
+	}
+
+	q := dbFrom(r.Context(), s.DB)
+	var id int64
+	err := q.QueryRowContext(r.Context(), `
+		INSERT INTO racks (org_id, site_id, name, units, description)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		auth.OrgIDFromContext(r.Context()), *in.SiteID, strings.TrimSpace(*in.Name), units, in.Description).Scan(&id)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, "the site already has a rack named "+strings.TrimSpace(*in.Name))
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	k, err := scanRack(q.QueryRowContext(r.Context(), `SELECT `+rackColumns+` FROM racks k WHERE k.id = $1`, id))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/racks/%d", id))
+	writeJSON(w, r, http.StatusCreated, k)
+}
+
+// updateRack changes a rack's fields; it cannot shrink below its highest
+// occupied unit
+func (s *Server) updateRack(w http.ResponseWriter, r *http.Request) {
+	k, ok := s.rackInOrg(w, r)
+	if !ok {
+		return
+	}
+	var in rackInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if err := checkRackFields(in); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	if in.SiteID != nil {
+		if ok, err := s.siteInOrg(r.Context(), *in.SiteID); err != nil || !ok {
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+			problem.BadRequest(w, r, "site_id does not name a site")
+			return
+		}
+	}
+	q := dbFrom(r.Context(), s.DB)
+	if in.Units != nil && *in.Units < k.Units {
+		var highest int
+		if err := q.QueryRowContext(r.Context(), `
+			SELECT COALESCE(MAX(rack_position + COALESCE(rack_units, 1) - 1), 0) FROM inventory
+			WHERE rack_id = $1 AND deleted_at IS NULL`, k.ID).Scan(&highest); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if highest > *in.Units {
+			problem.Conflict(w, r, fmt.Sprintf("an item occupies U%d; move it before shrinking the rack", highest))
+			return
+		}
+	}
+	if _, err := q.ExecContext(r.Context(), `
+		UPDATE racks SET site_id = COALESCE($2, site_id), name = COALESCE($3, name), units = COALESCE($4, units),
+		       description = COALESCE($5, description)
+		WHERE id = $1`, k.ID, in.SiteID, in.Name, in.Units, in.Description); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, "the site already has a rack with that name")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getRack(w, r)
+}
+
+// deleteRack removes an empty rack
+func (s *Server) deleteRack(w http.ResponseWriter, r *http.Request) {
+	k, ok := s.rackInOrg(w, r)
+	if !ok {
+		return
+	}
+	if k.UsedUnits > 0 {
+		problem.Conflict(w, r, fmt.Sprintf("rack %s still holds items in %d units", k.Name, k.UsedUnits))
+		return
+	}
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `DELETE FROM racks WHERE id = $1`, k.ID); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getRackElevation returns what occupies which units of a rack, top first.
+// Items the caller cannot see show as free units.
+func (s *Server) getRackElevation(w http.ResponseWriter, r *http.Request) {
+	k, ok := s.rackInOrg(w, r)
+	if !ok {
+		return
+	}
+	sqlStr := `
+		SELECT id, asset_tag, name, COALESCE(device_type, ''), status, rack_position, COALESCE(rack_units, 1)
+		FROM inventory WHERE rack_id = $1 AND org_id = $2 AND deleted_at IS NULL AND rack_position IS NOT NULL`
+	args := []interface{}{k.ID, auth.OrgIDFromContext(r.Context())}
+	if clause, siteArgs := siteAccessClause(r.Context(), "inventory", 3); clause != "" {
+		sqlStr += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(), sqlStr+" ORDER BY rack_position DESC", args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	var (
+		placed []rackPlacement
+		items  []models.RackedItem
+		used   int
+	)
+	for rows.Next() {
+		var it models.RackedItem
+		p := rackPlacement{rackID: k.ID}
+		if err := rows.Scan(&it.ID, &it.AssetTag, &it.Name, &it.DeviceType, &it.Status, &p.position, &p.units); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		placed = append(placed, p)
+		items = append(items, it)
+		used += p.units
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	k.UsedUnits = used
+	writeJSON(w, r, http.StatusOK, models.RackElevation{
+		Rack:      *k,
+		FreeUnits: k.Units - used,
+		Slots:     elevation(k.Units, placed, items),
+	})
+}
+
+// itemRackFields resolves the rack fields of an item write, in over stored
+// (nil for a new item), into in. rack_id 0 takes the item out of its rack;
+// rack_units defaults to 1 for a racked item. It writes 400 or 409 and
+// returns false when the placement is not possible.
+func (s *Server) itemRackFields(w http.ResponseWriter, r *http.Request, itemID int, stored, in *models.Item) bool {
+	rackID, position, units := in.RackID, in.RackPosition, in.RackUnits
+	if stored != nil {
+		if rackID == nil {
+			rackID = stored.RackID
+		}
+		if position == nil && (in.RackID == nil || *in.RackID != 0) {
+			position = stored.RackPosition
+		}
+		if units == nil {
+			units = stored.RackUnits
+		}
+	}
+	if rackID != nil && *rackID == 0 {
+		rackID = nil
+	}
+	if units != nil && *units < 1 {
+		problem.BadRequest(w, r, "rack_units must be at least 1")
+		return false
+	}
+	switch {
+	case rackID == nil && position != nil:
+		problem.BadRequest(w, r, "rack_position needs a rack_id")
+		return false
+	case rackID != nil && position == nil:
+		problem.BadRequest(w, r, "rack_id needs a rack_position")
+		return false
+	case rackID != nil:
+		if units == nil {
+			one := 1
+			units = &one
+		}
+		if !s.checkRackPlacement(w, r, itemID, rackPlacement{rackID: *rackID, position: *position, units: *units}) {
+			return false
+		}
+	}
+	in.RackID, in.RackPosition, in.RackUnits = rackID, position, units
+	return true
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"era-inventory-api/internal/models"
+)
+
+func TestElevation(t *testing.T) {
+	placed := []rackPlacement{{position: 1, units: 2}, {position: 10, units: 1}, {position: 5, units: 4}}
+	items := []models.RackedItem{{ID: 1}, {ID: 2}, {ID: 3}}
+	var got []string
+	for _, sl := range elevation(12, placed, items) {
+		s := "free"
+		if sl.Item != nil {
+			s = "item"
+		}
+		got = append(got, s+":"+itoa(sl.Position)+"+"+itoa(sl.Units))
+		if sl.Item != nil && sl.Position == 5 && sl.Item.ID != 3 {
+			t.Errorf("U5 holds item %d, want 3", sl.Item.ID)
+		}
+	}
+	want := []string{"free:11+2", "item:10+1", "free:9+1", "item:5+4", "free:3+2", "item:1+2"}
+	if len(got) != len(want) {
+		t.Fatalf("elevation = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("elevation = %v, want %v", got, want)
+		}
+	}
+
+	if slots := elevation(42, nil, nil); len(slots) != 1 || slots[0].Position != 1 || slots[0].Units != 42 {
+		t.Errorf("empty rack = %+v", slots)
+	}
+}
+
+func TestItemRackFieldsNeedBoth(t *testing.T) {
+	rack, pos, zero := int64(3), 4, 0
+	for _, in := range []models.Item{
+		{RackPosition: &pos},
+		{RackID: &rack},
+		{RackID: &rack, RackPosition: &pos, RackUnits: &zero},
+	} {
+		w := httptest.NewRecorder()
+		if (&Server{}).itemRackFields(w, httptest.NewRequest(http.MethodPost, "/items", nil), 0, nil, &in) || w.Code != http.StatusBadRequest {
+			t.Errorf("%+v: status = %d, want 400", in, w.Code)
+		}
+	}
+
+	// rack_id 0 unracks, keeping the height
+	units := 2
+	stored := models.Item{RackID: &rack, RackPosition: &pos, RackUnits: &units}
+	in := models.Item{RackID: new(int64)}
+	if !(&Server{}).itemRackFields(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/items/1", nil), 1, &stored, &in) {
+		t.Fatal("unracking was refused")
+	}
+	if in.RackID != nil || in.RackPosition != nil || in.RackUnits == nil || *in.RackUnits != 2 {
+		t.Errorf("unracked = %+v", in)
+	}
+}
@@ -0,0 +1,385 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// Bounds of a POST /reconcile body
+const (
+	maxReconcileBytes = 5 << 20
+	maxReconcileRows  = 10000
+)
+
+// reconcileFields are the item fields an external record may be compared
+// on, besides the asset_tag it is matched by; dates are YYYY-MM-DD
+var reconcileFields = []string{
+	"name", "manufacturer", "model", "device_type", "site", "status", "notes",
+	"installed_at", "warranty_start", "warranty_end",
+	"support_contract", "support_level", "support_end",
+}
+
+var reconcileDateFields = map[string]bool{
+	"installed_at": true, "warranty_start": true, "warranty_end": true, "support_end": true,
+}
+
+// reconcileRecord is one asset of the external list: the fields it states,
+// by name. Line is its CSV line or 1-based array position.
+type reconcileRecord struct {
+	Line   int
+	Fields map[string]string
+}
+
+// reconcileDiff is a field whose values disagree
+type reconcileDiff struct {
+	Field     string `json:"field"`
+	External  string `json:"external"`
+	Inventory string `json:"inventory"`
+}
+
+// reconcileMatch is an external asset found in the inventory
+type reconcileMatch struct {
+	Line        int             `json:"line"`
+	AssetTag    string          `json:"asset_tag"`
+	ID          int             `json:"id"`
+	Differences []reconcileDiff `json:"differences"`
+}
+
+// reconcileRow is an external asset that is not in the inventory or could
+// not be compared
+type reconcileRow struct {
+	Line     int    `json:"line"`
+	AssetTag string `json:"asset_tag,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// reconcileExtra is an inventory item the external list does not have
+type reconcileExtra struct {
+	ID       int    `json:"id"`
+	AssetTag string `json:"asset_tag"`
+	Name     string `json:"name"`
+	Site     string `json:"site,omitempty"`
+}
+
+// reconcileSummary counts the outcome; identical and differing split matched
+type reconcileSummary struct {
+	External  int `json:"external"`
+	Matched   int `json:"matched"`
+	Identical int `json:"identical"`
+	Differing int `json:"differing"`
+	Missing   int `json:"missing"`
+	Extra     int `json:"extra"`
+	Invalid   int `json:"invalid"`
+}
+
+// reconcileResult is the response of POST /reconcile
+type reconcileResult struct {
+	Summary reconcileSummary `json:"summary"`
+	Matched []reconcileMatch `json:"matched"`
+	Missing []reconcileRow   `json:"missing"`
+	Extra   []reconcileExtra `json:"extra"`
+	Invalid []reconcileRow   `json:"invalid"`
+}
+
+// reconcile compares an external asset list, the source of truth of an
+// audit, with the inventory and never writes. Assets are matched by
+// asset_tag, ignoring case and surrounding blanks, and compared on the
+// fields each record states. missing are external assets the inventory
+// lacks; extra are inventory items the list lacks, within ?site= when
+// given. The body is a JSON array of objects, or a CSV with a header row
+// when sent as text/csv.
+func (s *Server) reconcile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var (
+		records []reconcileRecord
+		err     error
+	)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		data, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReconcileBytes))
+		if readErr != nil {
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", "asset list must be at most 5MB")
+			return
+		}
+		records, err = parseReconcileCSV(bytes.NewReader(data))
+	} else {
+		var objects []map[string]*string
+		if !readJSON(w, r, &objects, maxReconcileBytes, false) {
+			return
+		}
+		records, err = reconcileRecordsFromJSON(objects)
+	}
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	where := "org_id = $1 AND deleted_at IS NULL"
+	args := []interface{}{auth.OrgIDFromContext(ctx)}
+	if site := strings.TrimSpace(r.URL.Query().Get("site")); site != "" {
+		args = append(args, site)
+		where += fmt.Sprintf(" AND site = $%d", len(args))
+	}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", len(args)+1); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+	rows, err := dbFrom(ctx, s.DB).QueryContext(ctx, `SELECT `+itemColumns+` FROM inventory WHERE `+where+` ORDER BY id`, args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+	var items []models.Item
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(itemScanDest(&it)...); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reconcileItems(records, items)); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// reconcileKey is the natural key assets are matched by
+func reconcileKey(assetTag string) string {
+	return strings.ToLower(strings.TrimSpace(assetTag))
+}
+
+// reconcileItems compares records with items
+func reconcileItems(records []reconcileRecord, items []models.Item) reconcileResult {
+	res := reconcileResult{
+		Matched: []reconcileMatch{}, Missing: []reconcileRow{},
+		Extra: []reconcileExtra{}, Invalid: []reconcileRow{},
+	}
+	byTag := make(map[string]*models.Item, len(items))
+	for i := range items {
+		if key := reconcileKey(items[i].AssetTag); byTag[key] == nil {
+			byTag[key] = &items[i]
+		}
+	}
+
+	seen := map[string]int{}
+	for _, rec := range records {
+		tag := strings.TrimSpace(rec.Fields["asset_tag"])
+		key := reconcileKey(tag)
+		if err := checkReconcileRecord(rec, key, seen); err != "" {
+			res.Invalid = append(res.Invalid, reconcileRow{Line: rec.Line, AssetTag: tag, Error: err})
+			continue
+		}
+		seen[key] = rec.Line
+
+		it := byTag[key]
+		if it == nil {
+			res.Missing = append(res.Missing, reconcileRow{Line: rec.Line, AssetTag: tag})
+			continue
+		}
+		match := reconcileMatch{Line: rec.Line, AssetTag: it.AssetTag, ID: it.ID, Differences: []reconcileDiff{}}
+		for _, field := range reconcileFields {
+			external, stated := rec.Fields[field]
+			if !stated {
+				continue
+			}
+			external = strings.TrimSpace(external)
+			if reconcileDateFields[field] && external != "" {
+				d, _ := time.Parse("2006-01-02", external)
+				external = d.Format("2006-01-02")
+			}
+			if inventory := itemFieldText(it, field); inventory != external {
+				match.Differences = append(match.Differences, reconcileDiff{Field: field, External: external, Inventory: inventory})
+			}
+		}
+		if len(match.Differences) == 0 {
+			res.Summary.Identical++
+		} else {
+			res.Summary.Differing++
+		}
+		res.Matched = append(res.Matched, match)
+	}
+
+	for i := range items {
+		if _, ok := seen[reconcileKey(items[i].AssetTag)]; !ok {
+			it := items[i]
+			res.Extra = append(res.Extra, reconcileExtra{ID: it.ID, AssetTag: it.AssetTag, Name: it.Name, Site: it.Site})
+		}
+	}
+
+	res.Summary.External = len(records)
+	res.Summary.Matched = len(res.Matched)
+	res.Summary.Missing = len(res.Missing)
+	res.Summary.Extra = len(res.Extra)
+	res.Summary.Invalid = len(res.Invalid)
+	return res
+}
+
+// checkReconcileRecord explains why rec cannot be compared, or is ""
+func checkReconcileRecord(rec reconcileRecord, key string, seen map[string]int) string {
+	if key == "" {
+		return "asset_tag is required"
+	}
+	if line, dup := seen[key]; dup {
+		return fmt.Sprintf("asset_tag repeats line %d", line)
+	}
+	for field := range reconcileDateFields {
+		if v := strings.TrimSpace(rec.Fields[field]); v != "" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return field + " must be a date (YYYY-MM-DD)"
+			}
+		}
+	}
+	return ""
+}
+
+// itemFieldText is the value of a reconcileFields field of it, as text
+func itemFieldText(it *models.Item, field string) string {
+	switch field {
+	case "name":
+		return it.Name
+	case "manufacturer":
+		return it.Manufacturer
+	case "model":
+		return it.Model
+	case "device_type":
+		return it.DeviceType
+	case "site":
+		return it.Site
+	case "status":
+		return it.Status
+	case "notes":
+		return it.Notes
+	case "installed_at":
+		return formatDate(it.InstalledAt)
+	case "warranty_start":
+		return formatDate(it.WarrantyStart)
+	case "warranty_end":
+		return formatDate(it.WarrantyEnd)
+	case "support_contract":
+		return textOf(it.SupportContract)
+	case "support_level":
+		return textOf(it.SupportLevel)
+	case "support_end":
+		return formatDate(it.SupportEnd)
+	}
+	return ""
+}
+
+// validReconcileField reports whether name may appear in an external record
+func validReconcileField(name string) bool {
+	if name == "asset_tag" {
+		return true
+	}
+	for _, f := range reconcileFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseReconcileCSV reads an asset list with a header row naming asset_tag
+// and any of reconcileFields
+func parseReconcileCSV(r io.Reader) ([]reconcileRecord, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("asset list is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !validReconcileField(name) {
+			return nil, fmt.Errorf("unknown column %q; columns are asset_tag, %s", name, strings.Join(reconcileFields, ", "))
+		}
+		columns[i] = name
+	}
+	if !validReconcileColumns(columns) {
+		return nil, errors.New("the header must name asset_tag once, and each other column at most once")
+	}
+
+	var records []reconcileRecord
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if len(records) == maxReconcileRows {
+			return nil, fmt.Errorf("asset list has more than %d rows", maxReconcileRows)
+		}
+		fields := make(map[string]string, len(columns))
+		for i, name := range columns {
+			if i < len(rec) {
+				fields[name] = rec[i]
+			} else {
+				fields[name] = ""
+			}
+		}
+		records = append(records, reconcileRecord{Line: line, Fields: fields})
+	}
+	return records, nil
+}
+
+// validReconcileColumns reports whether columns name asset_tag and no
+// column twice
+func validReconcileColumns(columns []string) bool {
+	sorted := append([]string(nil), columns...)
+	sort.Strings(sorted)
+	hasTag := false
+	for i, name := range sorted {
+		if i > 0 && sorted[i-1] == name {
+			return false
+		}
+		hasTag = hasTag || name == "asset_tag"
+	}
+	return hasTag
+}
+
+// reconcileRecordsFromJSON takes the fields of each object; null stands for
+// an empty value
+func reconcileRecordsFromJSON(objects []map[string]*string) ([]reconcileRecord, error) {
+	if len(objects) > maxReconcileRows {
+		return nil, fmt.Errorf("asset list has more than %d rows", maxReconcileRows)
+	}
+	records := make([]reconcileRecord, 0, len(objects))
+	for i, obj := range objects {
+		fields := make(map[string]string, len(obj))
+		for name, v := range obj {
+			if !validReconcileField(name) {
+				return nil, fmt.Errorf("asset %d: unknown field %q; fields are asset_tag, %s", i+1, name, strings.Join(reconcileFields, ", "))
+			}
+			fields[name] = textOf(v)
+		}
+		records = append(records, reconcileRecord{Line: i + 1, Fields: fields})
+	}
+	return records, nil
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/models"
+)
+
+func TestReconcileItems(t *testing.T) {
+	end := time.Date(2027, 3, 31, 0, 0, 0, 0, time.UTC)
+	items := []models.Item{
+		{ID: 1, AssetTag: "SW-001", Name: "core switch", Site: "Berlin", Status: "active", WarrantyEnd: &end},
+		{ID: 2, AssetTag: "SW-002", Name: "access switch", Site: "Berlin", Status: "active"},
+		{ID: 3, AssetTag: "FW-001", Name: "firewall", Site: "Hamburg"},
+	}
+	records, err := parseReconcileCSV(strings.NewReader("\ufeffAsset_Tag,name,site,warranty_end\n" +
+		" sw-001 ,core switch,Berlin,2027-03-31\n" +
+		"SW-002,access switch,Hamburg,\n" +
+		"AP-001,access point,Berlin,\n" +
+		",no tag,Berlin,\n" +
+		"SW-001,again,Berlin,\n" +
+		"SW-009,bad date,Berlin,31.03.2027\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := reconcileItems(records, items)
+	want := reconcileSummary{External: 6, Matched: 2, Identical: 1, Differing: 1, Missing: 1, Extra: 1, Invalid: 3}
+	if res.Summary != want {
+		t.Errorf("summary = %+v, want %+v", res.Summary, want)
+	}
+	if m := res.Matched[1]; m.ID != 2 || len(m.Differences) != 1 || m.Differences[0] != (reconcileDiff{Field: "site", External: "Hamburg", Inventory: "Berlin"}) {
+		t.Errorf("SW-002 = %+v", m)
+	}
+	if res.Missing[0].AssetTag != "AP-001" || res.Missing[0].Line != 4 {
+		t.Errorf("missing = %+v", res.Missing)
+	}
+	if res.Extra[0].ID != 3 {
+		t.Errorf("extra = %+v", res.Extra)
+	}
+	for i, msg := range []string{"asset_tag is required", "asset_tag repeats line 2", "warranty_end must be a date"} {
+		if !strings.Contains(res.Invalid[i].Error, msg) {
+			t.Errorf("invalid[%d] = %+v, want %q", i, res.Invalid[i], msg)
+		}
+	}
+}
+
+func TestReconcileComparesStatedFieldsOnly(t *testing.T) {
+	items := []models.Item{{ID: 1, AssetTag: "SW-001", Name: "core switch", Model: "C9300"}}
+	notes := "rack 4"
+	records, err := reconcileRecordsFromJSON([]map[string]*string{
+		{"asset_tag": strPtr("SW-001"), "notes": &notes, "model": nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := reconcileItems(records, items)
+	diffs := res.Matched[0].Differences
+	if len(diffs) != 2 || diffs[0].Field != "model" || diffs[0].External != "" || diffs[1].Field != "notes" {
+		t.Errorf("differences = %+v", diffs)
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestReconcileRejectsBadLists(t *testing.T) {
+	for name, tc := range map[string]struct{ contentType, body string }{
+		"unknown column":  {"text/csv", "asset_tag,colour\nSW-001,red\n"},
+		"no asset_tag":    {"text/csv", "name\ncore\n"},
+		"repeated column": {"text/csv", "asset_tag,name,name\n"},
+		"empty csv":       {"text/csv", ""},
+		"unknown field":   {"application/json", `[{"asset_tag":"SW-001","colour":"red"}]`},
+		"not an array":    {"application/json", `{"asset_tag":"SW-001"}`},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/reconcile", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", tc.contentType)
+		w := httptest.NewRecorder()
+		(&Server{}).reconcile(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400: %s", name, w.Code, w.Body.String())
+		}
+	}
+}
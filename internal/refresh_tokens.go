@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/service"
+)
+
+// refreshRequest is the body accepted by POST /auth/refresh and /auth/refresh/revoke
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sessionResponse is an access token and the refresh token that renews it
+type sessionResponse struct {
+	Token            string    `json:"token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ExpiresIn        int       `json:"expires_in"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// startSession opens a session for the presented access token, returning a
+// fresh access token and the first refresh token
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		problem.Write(w, r, http.StatusUnauthorized, "AUTHENTICATION_REQUIRED", "Authentication required")
+		return
+	}
+	tokens, err := s.Sessions.Start(r.Context(), claims)
+	if errors.Is(err, service.ErrScopedToken) {
+		problem.Write(w, r, http.StatusForbidden, "SCOPED_TOKEN", err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrAPIKeySession) {
+		problem.Write(w, r, http.StatusForbidden, "API_KEY_NOT_ALLOWED", err.Error())
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeSession(w, r, http.StatusCreated, tokens)
+}
+
+// refreshSession trades a refresh token for a new access token and a new
+// refresh token; the presented refresh token stops working
+func (s *Server) refreshSession(w http.ResponseWriter, r *http.Request) {
+	var in refreshRequest
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	tokens, err := s.Sessions.Refresh(r.Context(), in.RefreshToken)
+	if err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+	writeSession(w, r, http.StatusOK, tokens)
+}
+
+// revokeSession invalidates a refresh token and every token rotated from the same session
+func (s *Server) revokeSession(w http.ResponseWriter, r *http.Request) {
+	var in refreshRequest
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if err := s.Sessions.Revoke(r.Context(), in.RefreshToken); err != nil {
+		writeSessionError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSessionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, service.ErrInvalidRefreshToken) {
+		problem.Write(w, r, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN", err.Error())
+		return
+	}
+	problem.Internal(w, r, err)
+}
+
+func writeSession(w http.ResponseWriter, r *http.Request, status int, t service.Tokens) {
+	out := sessionResponse{
+		Token:            t.AccessToken,
+		TokenType:        "Bearer",
+		ExpiresAt:        t.AccessExpiresAt,
+		ExpiresIn:        int(time.Until(t.AccessExpiresAt).Seconds()),
+		RefreshToken:     t.RefreshToken,
+		RefreshExpiresAt: t.RefreshExpiresAt,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/testutil"
+)
+
+func TestRefreshTokenFlow(t *testing.T) {
+	s := newRoutedServer()
+	s.Sessions = service.NewSessions(testutil.NewMemRefreshTokens(), s.JWTManager, 24*time.Hour, 0)
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) sessionResponse {
+		t.Helper()
+		var out sessionResponse
+		if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	access, _ := s.JWTManager.GenerateToken(3, 1, []string{"org_admin"})
+	w := do("POST", "/auth/sessions", access, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start = %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("session response may be cached")
+	}
+	first := decode(w)
+
+	w = do("POST", "/auth/refresh", "", `{"refresh_token":"`+first.RefreshToken+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh = %d: %s", w.Code, w.Body.String())
+	}
+	second := decode(w)
+	if second.RefreshToken == first.RefreshToken || second.Token == "" || second.TokenType != "Bearer" {
+		t.Errorf("refresh response = %+v", second)
+	}
+	if claims, err := s.JWTManager.ValidateToken(second.Token); err != nil || claims.UserID != 3 {
+		t.Errorf("refreshed access token: claims %+v, err %v", claims, err)
+	}
+
+	if w := do("POST", "/auth/refresh", "", `{"refresh_token":"`+first.RefreshToken+`"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token = %d, want 401", w.Code)
+	}
+	if w := do("POST", "/auth/refresh", "", `{"refresh_token":"`+second.RefreshToken+`"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of a reused family = %d, want 401", w.Code)
+	}
+
+	third := decode(do("POST", "/auth/sessions", access, ""))
+	if w := do("POST", "/auth/refresh/revoke", "", `{"refresh_token":"`+third.RefreshToken+`"}`); w.Code != http.StatusNoContent {
+		t.Errorf("revoke = %d, want 204", w.Code)
+	}
+	if w := do("POST", "/auth/refresh", "", `{"refresh_token":"`+third.RefreshToken+`"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after revoke = %d, want 401", w.Code)
+	}
+	if w := do("POST", "/auth/refresh", "", `not json`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+
+	"era-inventory-api/internal/models"
+)
+
+// APIKeyRepo stores API keys by hash. Keys are looked up before the org is
+// known, so the store is global; org-facing methods filter by org.
+type APIKeyRepo interface {
+	// Create stores k under hash
+	Create(ctx context.Context, hash string, k models.APIKey) (models.APIKey, error)
+	// GetByHash returns the key with that hash, revoked or not
+	GetByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// List returns the org's keys, newest first, revoked ones included
+	List(ctx context.Context, orgID int64) ([]models.APIKey, error)
+	// Revoke revokes a live key of the org
+	Revoke(ctx context.Context, orgID, id int64) error
+	// Touch records that key id was just used; it writes at most once a minute
+	Touch(ctx context.Context, id int64) error
+}
+
+// roles are read back as JSON, as for refresh tokens
+const apiKeyColumns = `id, name, prefix, user_id, org_id, to_json(roles), expires_at, created_at, last_used_at, revoked_at`
+
+type pgAPIKeys struct {
+	db DBFunc
+}
+
+// NewAPIKeyRepo returns the Postgres APIKeyRepo
+func NewAPIKeyRepo(db DBFunc) APIKeyRepo {
+	return &pgAPIKeys{db: db}
+}
+
+func scanAPIKey(row interface{ Scan(...any) error }) (models.APIKey, error) {
+	var k models.APIKey
+	var roles []byte
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.UserID, &k.OrgID, &roles, &k.ExpiresAt, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt); err != nil {
+		return models.APIKey{}, rowErr(err)
+	}
+	return k, json.Unmarshal(roles, &k.Roles)
+}
+
+func (r *pgAPIKeys) Create(ctx context.Context, hash string, k models.APIKey) (models.APIKey, error) {
+	return scanAPIKey(r.db(ctx).QueryRowContext(ctx, `
+		INSERT INTO api_keys (key_hash, prefix, name, user_id, org_id, roles, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+apiKeyColumns,
+		hash, k.Prefix, k.Name, k.UserID, k.OrgID, k.Roles, k.ExpiresAt))
+}
+
+func (r *pgAPIKeys) GetByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	return scanAPIKey(r.db(ctx).QueryRowContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, hash))
+}
+
+func (r *pgAPIKeys) List(ctx context.Context, orgID int64) ([]models.APIKey, error) {
+	rows, err := r.db(ctx).QueryContext(ctx,
+		`SELECT `+apiKeyColumns+` FROM api_keys WHERE org_id = $1 ORDER BY id DESC`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgAPIKeys) Revoke(ctx context.Context, orgID, id int64) error {
+	res, err := r.db(ctx).ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND org_id = $2 AND revoked_at IS NULL`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgAPIKeys) Touch(ctx context.Context, id int64) error {
+	_, err := r.db(ctx).ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = now()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - INTERVAL '1 minute')`, id)
+	return err
+}
@@ -0,0 +1,432 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/outbox"
+	"era-inventory-api/internal/query"
+)
+
+// ItemRepo stores an org's inventory items. Deleted items stay in the trash
+// and are invisible to every method. Each method takes the caller's Scope,
+// which hides the items outside their site and project grants; writes only
+// change items in scope.
+type ItemRepo interface {
+	// List returns the page of items matching f that opts selects
+	List(ctx context.Context, orgID int64, f ItemFilter, opts ItemListOptions, scope Scope) (ItemPage, error)
+	Get(ctx context.Context, orgID, id int64, scope Scope) (models.Item, error)
+	// Create adds in and writes a TopicItemCreated event; details, when set,
+	// stores its device details in the same statement
+	Create(ctx context.Context, orgID int64, in models.Item, details DetailsStep) (models.Item, error)
+	// Update applies p and writes a TopicItemUpdated event
+	Update(ctx context.Context, orgID, id int64, p ItemPatch, scope Scope) (models.Item, error)
+	// Contained counts the live items id contains through "contains" links
+	Contained(ctx context.Context, orgID, id int64, scope Scope) (int, error)
+	// Delete moves the item to the trash and, with cascade, everything it
+	// contains, recursively; each trashed item gets a TopicItemDeleted event
+	Delete(ctx context.Context, orgID, id int64, cascade bool, scope Scope) error
+}
+
+// ErrWarrantyRange is a write that would leave an item's warranty starting
+// after it ends
+var ErrWarrantyRange = errors.New("warranty_start must not be after warranty_end")
+
+// ItemFilter narrows item lists; zero fields match every item
+type ItemFilter struct {
+	Status string
+	// Query matches the name or asset tag
+	Query string
+	// Tags are normalized tags an item must all carry
+	Tags []string
+	// GroupID is an asset group the items must belong to
+	GroupID int64
+}
+
+// ItemListOptions are the list parameters of items. After switches to keyset
+// paging: the page starts past the row it names, in its sort, and Offset
+// and Sort are ignored.
+type ItemListOptions struct {
+	ListOptions
+	After *ItemCursor
+}
+
+// ItemCursor is a keyset position: the row's value of the sort column, typed
+// for it, and its ID as the tie-breaker
+type ItemCursor struct {
+	query.Keyset
+	Value any
+	ID    int64
+}
+
+// ItemPage is a page of items. More is set when rows follow it, whether or
+// not Total was estimated.
+type ItemPage struct {
+	Page[models.Item]
+	More bool
+}
+
+// ItemPatch lists the fields to change; nil fields are left alone. An empty
+// SupportContract or SupportLevel clears it.
+type ItemPatch struct {
+	AssetTag, Name, Manufacturer, Model, DeviceType, Site, Notes, Status *string
+
+	InstalledAt, WarrantyStart, WarrantyEnd, SupportEnd *time.Time
+	SupportContract, SupportLevel                       *string
+
+	// Rack, when set, replaces the whole rack placement
+	Rack      *ItemPlacement
+	ProjectID *int64
+	// CustomFields, when set, replaces the stored values
+	CustomFields models.CustomValues
+	// Details stores the item's device details along with the update
+	Details DetailsStep
+}
+
+// ItemPlacement is where an item sits in a rack; a nil RackID takes it out
+type ItemPlacement struct {
+	RackID   *int64
+	Position *int
+	Units    *int
+}
+
+// Empty reports whether the patch changes nothing
+func (p ItemPatch) Empty() bool {
+	return p.AssetTag == nil && p.Name == nil && p.Manufacturer == nil && p.Model == nil &&
+		p.DeviceType == nil && p.Site == nil && p.Notes == nil && p.Status == nil &&
+		p.InstalledAt == nil && p.WarrantyStart == nil && p.WarrantyEnd == nil && p.SupportEnd == nil &&
+		p.SupportContract == nil && p.SupportLevel == nil &&
+		p.Rack == nil && p.ProjectID == nil && p.CustomFields == nil && p.Details == nil
+}
+
+// DetailsStep is the outbox.Wrap step writing an item's device details from
+// the changed row, with its arguments numbered from next. It returns "" when
+// the details set nothing.
+type DetailsStep func(next int) (string, []any)
+
+// Scope narrows statements to the rows a caller may see. It returns a
+// condition on the columns of table whose placeholders start at $arg, and
+// its arguments; "" means no restriction. A nil Scope restricts nothing.
+type Scope func(table string, arg int) (string, []any)
+
+func (sc Scope) clause(table string, arg int) (string, []any) {
+	if sc == nil {
+		return "", nil
+	}
+	return sc(table, arg)
+}
+
+// Outbox topics for item changes. Each event's payload is the item row as
+// ItemEventColumns returns it; a cascading delete writes one event per item.
+const (
+	TopicItemCreated = "item.created"
+	TopicItemUpdated = "item.updated"
+	TopicItemDeleted = "item.deleted"
+)
+
+// ItemEventColumns is what item writes return for their outbox events
+const ItemEventColumns = `id, asset_tag, name, manufacturer, model, device_type, site,
+	installed_at, warranty_start, warranty_end, support_contract, support_level, support_end,
+	notes, status, custom_fields, rack_id, rack_position, rack_units, project_id, created_at, updated_at, org_id`
+
+// ItemColumns is what item reads select, in ItemScanDest order
+const ItemColumns = `id, asset_tag, name, manufacturer, model, device_type, site,
+	installed_at, warranty_start, warranty_end, support_contract, support_level, support_end,
+	notes, status, custom_fields, rack_id, rack_position, rack_units, project_id, created_at, updated_at`
+
+// ItemScanDest is where the ItemColumns of a row are scanned to
+func ItemScanDest(it *models.Item) []interface{} {
+	return []interface{}{
+		&it.ID, &it.AssetTag, &it.Name, &it.Manufacturer, &it.Model, &it.DeviceType, &it.Site,
+		&it.InstalledAt, &it.WarrantyStart, &it.WarrantyEnd, &it.SupportContract, &it.SupportLevel, &it.SupportEnd,
+		&it.Notes, &it.Status, &it.CustomFields, &it.RackID, &it.RackPosition, &it.RackUnits, &it.ProjectID, &it.CreatedAt, &it.UpdatedAt,
+	}
+}
+
+// ItemSort maps the item sort keys to columns
+var ItemSort = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"status":     "status",
+}
+
+// ItemWhere is the condition item lists share: the org's live items that
+// match f and are in scope. Other item queries add their own conditions.
+func ItemWhere(orgID int64, f ItemFilter, scope Scope) *query.Where {
+	where := query.OrgScoped(orgID)
+
+	// deleted items live in the trash until restored or purged
+	where.And("deleted_at IS NULL")
+
+	if f.Status != "" {
+		where.And("status = ?", f.Status)
+	}
+	if f.Query != "" {
+		pattern := "%" + f.Query + "%"
+		where.And("(name ILIKE ? OR asset_tag ILIKE ?)", pattern, pattern)
+	}
+	if len(f.Tags) > 0 {
+		where.And(`id IN (SELECT item_id FROM item_tags WHERE org_id = inventory.org_id AND tag = ANY(?)
+			GROUP BY item_id HAVING COUNT(*) = ?)`, f.Tags, len(f.Tags))
+	}
+	if clause, scopeArgs := scope.clause("inventory", where.Next()); clause != "" {
+		where.AndNumbered(clause, scopeArgs)
+	}
+	if f.GroupID != 0 {
+		where.AndNumbered(AssetGroupMatch(fmt.Sprintf("$%d", where.Next()), "inventory"), []any{f.GroupID})
+	}
+	return where
+}
+
+// AssetGroupMatch is a condition true when the item row of table is in the
+// asset group named by group, a placeholder or column holding its id. Filter
+// groups are evaluated against the item as it is now, field by field as
+// ItemWhere does; manual groups look up their members. An unknown group
+// matches nothing.
+func AssetGroupMatch(group, table string) string {
+	return strings.NewReplacer("{group}", group, "{item}", table).Replace(`EXISTS (SELECT 1 FROM asset_groups ag
+		WHERE ag.id = {group} AND ag.org_id = {item}.org_id AND CASE WHEN ag.filter IS NULL THEN
+			EXISTS (SELECT 1 FROM asset_group_items am WHERE am.group_id = ag.id AND am.item_id = {item}.id)
+		ELSE
+			(ag.filter->>'status' IS NULL OR {item}.status = ag.filter->>'status')
+			AND (ag.filter->>'q' IS NULL OR {item}.name ILIKE '%' || (ag.filter->>'q') || '%' OR {item}.asset_tag ILIKE '%' || (ag.filter->>'q') || '%')
+			AND (ag.filter->>'site' IS NULL OR lower({item}.site) = lower(ag.filter->>'site'))
+			AND (ag.filter->>'device_type' IS NULL OR lower({item}.device_type) = lower(ag.filter->>'device_type'))
+			AND NOT EXISTS (SELECT 1 FROM jsonb_array_elements_text(COALESCE(ag.filter->'tags', '[]'::jsonb)) ft(tag)
+				WHERE NOT EXISTS (SELECT 1 FROM item_tags it WHERE it.org_id = {item}.org_id AND it.item_id = {item}.id AND it.tag = ft.tag))
+		END)`)
+}
+
+type pgItems struct {
+	db         DBFunc
+	scanBudget int
+}
+
+// NewItemRepo returns the Postgres ItemRepo. Lists expected to match more
+// than scanBudget rows report an estimated total (0 always counts).
+func NewItemRepo(db DBFunc, scanBudget int) ItemRepo {
+	return &pgItems{db: db, scanBudget: scanBudget}
+}
+
+// itemErr is rowErr, plus the warranty range check of inventory
+func itemErr(err error) error {
+	if err != nil && strings.Contains(err.Error(), "inventory_warranty_range_chk") {
+		return ErrWarrantyRange
+	}
+	return rowErr(err)
+}
+
+func (r *pgItems) List(ctx context.Context, orgID int64, f ItemFilter, opts ItemListOptions, scope Scope) (ItemPage, error) {
+	where := ItemWhere(orgID, f, scope)
+	q := r.db(ctx)
+
+	// COUNT(*) OVER() would only see the rows after a cursor, so keyset pages
+	// count the filter separately
+	var (
+		page      = ItemPage{Page: Page[models.Item]{Rows: []models.Item{}}}
+		countExpr = "0"
+		estimate  int
+	)
+	if opts.After == nil {
+		countExpr, estimate = query.CountExpr(ctx, q, "inventory"+where.Clause(), where.Args(), r.scanBudget)
+	} else {
+		total, estimated, err := query.Count(ctx, q, "inventory"+where.Clause(), where.Args(), r.scanBudget)
+		if err != nil {
+			return ItemPage{}, err
+		}
+		page.Total, page.Estimated = total, estimated
+		opts.After.Keyset.After(where, opts.After.Value, opts.After.ID)
+	}
+
+	sqlStr := fmt.Sprintf(`SELECT %s, %s FROM inventory%s`, ItemColumns, countExpr, where.Clause())
+	if opts.After != nil {
+		sqlStr += opts.After.OrderBy() + fmt.Sprintf(" LIMIT %d", opts.Limit+1)
+	} else {
+		sqlStr += query.OrderBy(opts.Sort, ItemSort) + fmt.Sprintf(" LIMIT %d OFFSET %d", opts.Limit+1, opts.Offset)
+	}
+	rows, err := q.QueryContext(ctx, sqlStr, where.Args()...)
+	if err != nil {
+		return ItemPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var it models.Item
+		var total int
+		if err := rows.Scan(append(ItemScanDest(&it), &total)...); err != nil {
+			return ItemPage{}, err
+		}
+		if len(page.Rows) == opts.Limit {
+			page.More = true
+			break
+		}
+		if opts.After == nil {
+			page.Total = total
+		}
+		page.Rows = append(page.Rows, it)
+	}
+	if estimate > 0 {
+		page.Total, page.Estimated = estimate, true
+	}
+	return page, rows.Err()
+}
+
+func (r *pgItems) Get(ctx context.Context, orgID, id int64, scope Scope) (models.Item, error) {
+	sqlStr := `SELECT ` + ItemColumns + ` FROM inventory WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`
+	args := []interface{}{id, orgID}
+	if clause, scopeArgs := scope.clause("inventory", 3); clause != "" {
+		sqlStr += " AND " + clause
+		args = append(args, scopeArgs...)
+	}
+
+	var it models.Item
+	err := r.db(ctx).QueryRowContext(ctx, sqlStr, args...).Scan(ItemScanDest(&it)...)
+	return it, rowErr(err)
+}
+
+func (r *pgItems) Create(ctx context.Context, orgID int64, in models.Item, details DetailsStep) (models.Item, error) {
+	customFields := []byte("{}")
+	if in.CustomFields != nil {
+		var err error
+		if customFields, err = json.Marshal(in.CustomFields); err != nil {
+			return models.Item{}, err
+		}
+	}
+	args := []any{in.AssetTag, in.Name, in.Manufacturer, in.Model, in.DeviceType, in.Site, in.InstalledAt, in.WarrantyEnd, in.Notes, in.Status, string(customFields), orgID,
+		in.RackID, in.RackPosition, in.RackUnits, in.WarrantyStart, nullIfEmpty(in.SupportContract), nullIfEmpty(in.SupportLevel), in.SupportEnd, in.ProjectID}
+	var steps []string
+	if details != nil {
+		if step, detailArgs := details(len(args) + 1); step != "" {
+			steps, args = append(steps, step), append(args, detailArgs...)
+		}
+	}
+
+	var out models.Item
+	err := r.db(ctx).QueryRowContext(ctx, outbox.Wrap(`
+		INSERT INTO inventory (asset_tag, name, manufacturer, model, device_type, site, installed_at, warranty_end, notes, status, custom_fields, org_id,
+		                       rack_id, rack_position, rack_units, warranty_start, support_contract, support_level, support_end, project_id)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20)
+		RETURNING `+ItemEventColumns, TopicItemCreated, ItemColumns, steps...), args...).Scan(ItemScanDest(&out)...)
+	return out, itemErr(err)
+}
+
+func (r *pgItems) Update(ctx context.Context, orgID, id int64, p ItemPatch, scope Scope) (models.Item, error) {
+	upd := query.NewUpdate("inventory", orgID)
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{
+		{"asset_tag", p.AssetTag}, {"name", p.Name}, {"manufacturer", p.Manufacturer}, {"model", p.Model},
+		{"device_type", p.DeviceType}, {"site", p.Site}, {"notes", p.Notes}, {"status", p.Status},
+	} {
+		if f.value != nil {
+			upd.Set(f.column, *f.value)
+		}
+	}
+	for _, f := range []struct {
+		column string
+		value  *time.Time
+	}{
+		{"installed_at", p.InstalledAt}, {"warranty_start", p.WarrantyStart}, {"warranty_end", p.WarrantyEnd}, {"support_end", p.SupportEnd},
+	} {
+		if f.value != nil {
+			upd.Set(f.column, *f.value)
+		}
+	}
+	if p.SupportContract != nil {
+		upd.Set("support_contract", nullIfEmpty(p.SupportContract))
+	}
+	if p.SupportLevel != nil {
+		upd.Set("support_level", nullIfEmpty(p.SupportLevel))
+	}
+	if p.Rack != nil {
+		upd.Set("rack_id", p.Rack.RackID)
+		upd.Set("rack_position", p.Rack.Position)
+		upd.Set("rack_units", p.Rack.Units)
+	}
+	if p.ProjectID != nil {
+		upd.Set("project_id", *p.ProjectID)
+	}
+	if p.CustomFields != nil {
+		b, err := json.Marshal(p.CustomFields)
+		if err != nil {
+			return models.Item{}, err
+		}
+		upd.Set("custom_fields", string(b))
+	}
+	// details alone still change the item
+	if upd.Empty() {
+		upd.Set("updated_at", time.Now())
+	}
+
+	upd.And("id = ?", id)
+	upd.And("deleted_at IS NULL")
+	if clause, scopeArgs := scope.clause("inventory", upd.Next()); clause != "" {
+		upd.AndNumbered(clause, scopeArgs)
+	}
+	args := upd.Args()
+	var steps []string
+	if p.Details != nil {
+		if step, detailArgs := p.Details(len(args) + 1); step != "" {
+			steps, args = append(steps, step), append(args, detailArgs...)
+		}
+	}
+
+	var out models.Item
+	err := r.db(ctx).QueryRowContext(ctx, outbox.Wrap(upd.SQL("RETURNING "+ItemEventColumns), TopicItemUpdated, ItemColumns, steps...), args...).
+		Scan(ItemScanDest(&out)...)
+	return out, itemErr(err)
+}
+
+func (r *pgItems) Contained(ctx context.Context, orgID, id int64, scope Scope) (int, error) {
+	sqlStr := `
+		SELECT COUNT(*) FROM item_links l
+		JOIN inventory p ON p.id = l.from_item_id AND p.deleted_at IS NULL
+		JOIN inventory c ON c.id = l.to_item_id AND c.deleted_at IS NULL
+		WHERE l.from_item_id = $1 AND l.org_id = $2 AND l.kind = 'contains'`
+	args := []interface{}{id, orgID}
+	if clause, scopeArgs := scope.clause("p", 3); clause != "" {
+		sqlStr += " AND " + clause
+		args = append(args, scopeArgs...)
+	}
+	var n int
+	err := r.db(ctx).QueryRowContext(ctx, sqlStr, args...).Scan(&n)
+	return n, err
+}
+
+func (r *pgItems) Delete(ctx context.Context, orgID, id int64, cascade bool, scope Scope) error {
+	sqlStr := `UPDATE inventory SET deleted_at = NOW() WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`
+	if cascade {
+		sqlStr = `
+			WITH RECURSIVE subtree AS (
+				SELECT $1::int AS id
+				UNION
+				SELECT l.to_item_id FROM item_links l JOIN subtree t ON l.from_item_id = t.id
+				WHERE l.org_id = $2 AND l.kind = 'contains'
+			)
+			UPDATE inventory SET deleted_at = NOW()
+			WHERE id IN (SELECT id FROM subtree) AND org_id = $2 AND deleted_at IS NULL`
+	}
+	args := []interface{}{id, orgID}
+	if clause, scopeArgs := scope.clause("inventory", 3); clause != "" {
+		sqlStr += " AND " + clause
+		args = append(args, scopeArgs...)
+	}
+	sqlStr = outbox.Wrap(sqlStr+" RETURNING id, org_id, deleted_at", TopicItemDeleted, "COUNT(*)")
+
+	var n int
+	if err := r.db(ctx).QueryRowContext(ctx, sqlStr, args...).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+
+	"era-inventory-api/internal/models"
+)
+
+// OrgLimitRepo stores the limits on the organization record and counts what
+// they apply to
+type OrgLimitRepo interface {
+	Get(ctx context.Context, orgID int64) (models.OrgLimits, error)
+	// Set replaces the org's limits
+	Set(ctx context.Context, orgID int64, l models.OrgLimits) (models.OrgLimits, error)
+	// CountItems counts the org's live items; trashed and archived ones are
+	// not counted
+	CountItems(ctx context.Context, orgID int64) (int, error)
+}
+
+type pgOrgLimits struct {
+	db DBFunc
+}
+
+// NewOrgLimitRepo returns the Postgres OrgLimitRepo
+func NewOrgLimitRepo(db DBFunc) OrgLimitRepo {
+	return &pgOrgLimits{db: db}
+}
+
+func (r *pgOrgLimits) Get(ctx context.Context, orgID int64) (models.OrgLimits, error) {
+	var l models.OrgLimits
+	err := r.db(ctx).QueryRowContext(ctx,
+		`SELECT max_items, max_import_rows FROM organizations WHERE id = $1`, orgID).Scan(&l.MaxItems, &l.MaxImportRows)
+	return l, rowErr(err)
+}
+
+func (r *pgOrgLimits) Set(ctx context.Context, orgID int64, l models.OrgLimits) (models.OrgLimits, error) {
+	var out models.OrgLimits
+	err := r.db(ctx).QueryRowContext(ctx, `
+		UPDATE organizations SET max_items = $2, max_import_rows = $3
+		WHERE id = $1
+		RETURNING max_items, max_import_rows`, orgID, l.MaxItems, l.MaxImportRows).Scan(&out.MaxItems, &out.MaxImportRows)
+	return out, rowErr(err)
+}
+
+func (r *pgOrgLimits) CountItems(ctx context.Context, orgID int64) (int, error) {
+	var n int
+	err := r.db(ctx).QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM inventory WHERE org_id = $1 AND deleted_at IS NULL`, orgID).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// RefreshToken is a stored refresh token. The token itself is never stored,
+// only its hash. Tokens minted by rotation share the FamilyID and StartedAt
+// of the first.
+type RefreshToken struct {
+	ID        int64
+	FamilyID  int64
+	UserID    int64
+	OrgID     int64
+	Roles     []string
+	StartedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+// RefreshTokenRepo stores refresh tokens by hash. Refresh tokens are looked up
+// before the org is known, so they are not org-scoped.
+type RefreshTokenRepo interface {
+	// Create stores a token opening a new family
+	Create(ctx context.Context, hash string, t RefreshToken) (RefreshToken, error)
+	// GetByHash returns the token with that hash, used or not
+	GetByHash(ctx context.Context, hash string) (RefreshToken, error)
+	// Rotate marks token id used and stores its successor, with the same
+	// family, session start, user, org and roles, under hash. It returns ErrConflict when id
+	// was already used or revoked, so a token can be exchanged only once.
+	Rotate(ctx context.Context, id int64, hash string, expiresAt time.Time) (RefreshToken, error)
+	// RevokeFamily revokes every token of a family
+	RevokeFamily(ctx context.Context, familyID int64) error
+}
+
+// roles are read back as JSON, which database/sql can scan without a
+// driver-specific array type
+const refreshTokenColumns = `id, family_id, user_id, org_id, to_json(roles), session_started_at, expires_at, used_at, revoked_at`
+
+type pgRefreshTokens struct {
+	db DBFunc
+}
+
+// NewRefreshTokenRepo returns the Postgres RefreshTokenRepo
+func NewRefreshTokenRepo(db DBFunc) RefreshTokenRepo {
+	return &pgRefreshTokens{db: db}
+}
+
+func scanRefreshToken(row interface{ Scan(...any) error }) (RefreshToken, error) {
+	var t RefreshToken
+	var roles []byte
+	if err := row.Scan(&t.ID, &t.FamilyID, &t.UserID, &t.OrgID, &roles, &t.StartedAt, &t.ExpiresAt, &t.UsedAt, &t.RevokedAt); err != nil {
+		return RefreshToken{}, rowErr(err)
+	}
+	return t, json.Unmarshal(roles, &t.Roles)
+}
+
+func (r *pgRefreshTokens) Create(ctx context.Context, hash string, t RefreshToken) (RefreshToken, error) {
+	return scanRefreshToken(r.db(ctx).QueryRowContext(ctx, `
+		WITH next AS (SELECT nextval(pg_get_serial_sequence('refresh_tokens', 'id')) AS id)
+		INSERT INTO refresh_tokens (id, token_hash, family_id, user_id, org_id, roles, session_started_at, expires_at)
+		SELECT id, $1::text, id, $2::bigint, $3::bigint, $4::text[], $5::timestamptz, $6::timestamptz FROM next
+		RETURNING `+refreshTokenColumns, hash, t.UserID, t.OrgID, t.Roles, t.StartedAt, t.ExpiresAt))
+}
+
+func (r *pgRefreshTokens) GetByHash(ctx context.Context, hash string) (RefreshToken, error) {
+	return scanRefreshToken(r.db(ctx).QueryRowContext(ctx,
+		`SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = $1`, hash))
+}
+
+func (r *pgRefreshTokens) Rotate(ctx context.Context, id int64, hash string, expiresAt time.Time) (RefreshToken, error) {
+	t, err := scanRefreshToken(r.db(ctx).QueryRowContext(ctx, `
+		WITH used AS (
+			UPDATE refresh_tokens SET used_at = now()
+			WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+			RETURNING family_id, user_id, org_id, roles, session_started_at
+		)
+		INSERT INTO refresh_tokens (token_hash, family_id, user_id, org_id, roles, session_started_at, expires_at)
+		SELECT $2::text, family_id, user_id, org_id, roles, session_started_at, $3::timestamptz FROM used
+		RETURNING `+refreshTokenColumns, id, hash, expiresAt))
+	if err == ErrNotFound {
+		return RefreshToken{}, ErrConflict
+	}
+	return t, err
+}
+
+func (r *pgRefreshTokens) RevokeFamily(ctx context.Context, familyID int64) error {
+	_, err := r.db(ctx).ExecContext(ctx,
+		`UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`, familyID)
+	return err
+}
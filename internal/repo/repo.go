@@ -0,0 +1,74 @@
+// Package repo holds the data access for API resources behind interfaces, so
+// the service layer can be exercised without a database. The Postgres
+// implementations run every statement on the querier of the request, which
+// carries the org's RLS session when one is active.
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNotFound means no live record with that ID exists in the org
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a unique key is already taken
+	ErrConflict = errors.New("conflict")
+)
+
+// Querier is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// DBFunc returns the querier to use for a request
+type DBFunc func(ctx context.Context) Querier
+
+// ListOptions are the common list parameters
+type ListOptions struct {
+	Query  string // free-text filter
+	Sort   string // comma-separated keys, "-" prefix for descending
+	Limit  int
+	Offset int
+}
+
+// Page is one page of a list. When Estimated is set, Total is the planner's
+// estimate because an exact count would exceed the scan budget.
+type Page[T any] struct {
+	Rows      []T
+	Total     int
+	Estimated bool
+}
+
+// nullIfEmpty converts an empty string pointer to nil for nullable columns
+func nullIfEmpty(s *string) interface{} {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil
+	}
+	return *s
+}
+
+// nullIfZero converts 0, which clears optional references in patches, to nil
+func nullIfZero(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// rowErr maps driver errors to the package's sentinel errors
+func rowErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case strings.Contains(strings.ToLower(err.Error()), "unique"):
+		return ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// RevokedTokenRepo records revoked access tokens by jti. Like refresh tokens,
+// revocations are checked before any org context exists, so they are global.
+type RevokedTokenRepo interface {
+	// Revoke records that the token jti of userID in orgID is revoked until expiresAt
+	Revoke(ctx context.Context, jti string, userID, orgID int64, expiresAt time.Time) error
+	// Active returns every revocation of a token that has not expired yet
+	Active(ctx context.Context) (map[string]time.Time, error)
+	// Prune deletes revocations of tokens that expired before cutoff
+	Prune(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type pgRevokedTokens struct {
+	db DBFunc
+}
+
+// NewRevokedTokenRepo returns the Postgres RevokedTokenRepo
+func NewRevokedTokenRepo(db DBFunc) RevokedTokenRepo {
+	return &pgRevokedTokens{db: db}
+}
+
+func (r *pgRevokedTokens) Revoke(ctx context.Context, jti string, userID, orgID int64, expiresAt time.Time) error {
+	_, err := r.db(ctx).ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, org_id, expires_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING`, jti, userID, orgID, expiresAt)
+	return err
+}
+
+func (r *pgRevokedTokens) Active(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := r.db(ctx).QueryContext(ctx, `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > now()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]time.Time{}
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return nil, err
+		}
+		out[jti] = expiresAt
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRevokedTokens) Prune(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.db(ctx).ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+
+	"era-inventory-api/internal/models"
+)
+
+// RoleRepo stores the custom roles of every org. Roles are resolved while
+// authenticating, before any org context exists, so the table is global.
+type RoleRepo interface {
+	List(ctx context.Context, orgID int64) ([]models.Role, error)
+	Get(ctx context.Context, orgID, id int64) (models.Role, error)
+	Create(ctx context.Context, orgID int64, in models.Role) (models.Role, error)
+	// Update replaces the description and permissions of a role
+	Update(ctx context.Context, orgID, id int64, in models.Role) (models.Role, error)
+	// Delete removes a role and returns its name
+	Delete(ctx context.Context, orgID, id int64) (string, error)
+	// All returns the permissions of every custom role, by org and name
+	All(ctx context.Context) (map[int64]map[string][]string, error)
+}
+
+const roleColumns = `id, name, description, permissions, created_at, updated_at`
+
+type pgRoles struct {
+	db DBFunc
+}
+
+// NewRoleRepo returns the Postgres RoleRepo
+func NewRoleRepo(db DBFunc) RoleRepo {
+	return &pgRoles{db: db}
+}
+
+func scanRole(row interface{ Scan(...any) error }) (models.Role, error) {
+	var r models.Role
+	var perms []byte
+	if err := row.Scan(&r.ID, &r.Name, &r.Description, &perms, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return r, err
+	}
+	return r, json.Unmarshal(perms, &r.Permissions)
+}
+
+func (r *pgRoles) List(ctx context.Context, orgID int64) ([]models.Role, error) {
+	rows, err := r.db(ctx).QueryContext(ctx,
+		`SELECT `+roleColumns+` FROM roles WHERE org_id = $1 ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, role)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRoles) Get(ctx context.Context, orgID, id int64) (models.Role, error) {
+	role, err := scanRole(r.db(ctx).QueryRowContext(ctx,
+		`SELECT `+roleColumns+` FROM roles WHERE id = $1 AND org_id = $2`, id, orgID))
+	return role, rowErr(err)
+}
+
+func (r *pgRoles) Create(ctx context.Context, orgID int64, in models.Role) (models.Role, error) {
+	perms, err := json.Marshal(in.Permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+	role, err := scanRole(r.db(ctx).QueryRowContext(ctx, `
+		INSERT INTO roles (org_id, name, description, permissions)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+roleColumns, orgID, in.Name, in.Description, perms))
+	return role, rowErr(err)
+}
+
+func (r *pgRoles) Update(ctx context.Context, orgID, id int64, in models.Role) (models.Role, error) {
+	perms, err := json.Marshal(in.Permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+	role, err := scanRole(r.db(ctx).QueryRowContext(ctx, `
+		UPDATE roles SET description = $3, permissions = $4
+		WHERE id = $1 AND org_id = $2
+		RETURNING `+roleColumns, id, orgID, in.Description, perms))
+	return role, rowErr(err)
+}
+
+func (r *pgRoles) Delete(ctx context.Context, orgID, id int64) (string, error) {
+	var name string
+	err := r.db(ctx).QueryRowContext(ctx,
+		`DELETE FROM roles WHERE id = $1 AND org_id = $2 RETURNING name`, id, orgID).Scan(&name)
+	return name, rowErr(err)
+}
+
+func (r *pgRoles) All(ctx context.Context) (map[int64]map[string][]string, error) {
+	rows, err := r.db(ctx).QueryContext(ctx, `SELECT org_id, name, permissions FROM roles`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]map[string][]string{}
+	for rows.Next() {
+		var orgID int64
+		var name string
+		var raw []byte
+		if err := rows.Scan(&orgID, &name, &raw); err != nil {
+			return nil, err
+		}
+		var perms []string
+		if err := json.Unmarshal(raw, &perms); err != nil {
+			return nil, err
+		}
+		if out[orgID] == nil {
+			out[orgID] = map[string][]string{}
+		}
+		out[orgID][name] = perms
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+
+	"era-inventory-api/internal/models"
+)
+
+// SequenceRepo stores an org's named counters, addressed by name
+type SequenceRepo interface {
+	List(ctx context.Context, orgID int64) ([]models.Sequence, error)
+	Get(ctx context.Context, orgID int64, name string) (models.Sequence, error)
+	// Create adds a sequence whose next number is in.LastValue+1
+	Create(ctx context.Context, orgID int64, in models.Sequence) (models.Sequence, error)
+	Update(ctx context.Context, orgID int64, name string, p SequencePatch) (models.Sequence, error)
+	Delete(ctx context.Context, orgID int64, name string) error
+	// Next allocates count consecutive numbers and returns the sequence as
+	// of the allocation; the run is LastValue-count+1 to LastValue. Callers
+	// allocating at the same time never get overlapping runs.
+	Next(ctx context.Context, orgID int64, name string, count int) (models.Sequence, error)
+}
+
+// SequencePatch lists the fields to change; nil fields are left alone
+type SequencePatch struct {
+	Prefix  *string
+	Padding *int
+}
+
+// Empty reports whether the patch changes nothing
+func (p SequencePatch) Empty() bool {
+	return p.Prefix == nil && p.Padding == nil
+}
+
+const sequenceColumns = `id, name, prefix, padding, last_value, created_at, updated_at`
+
+type pgSequences struct {
+	db DBFunc
+}
+
+// NewSequenceRepo returns the Postgres SequenceRepo
+func NewSequenceRepo(db DBFunc) SequenceRepo {
+	return &pgSequences{db: db}
+}
+
+func scanSequence(row interface{ Scan(...any) error }) (models.Sequence, error) {
+	var s models.Sequence
+	err := row.Scan(&s.ID, &s.Name, &s.Prefix, &s.Padding, &s.LastValue, &s.CreatedAt, &s.UpdatedAt)
+	return s, err
+}
+
+func (r *pgSequences) List(ctx context.Context, orgID int64) ([]models.Sequence, error) {
+	rows, err := r.db(ctx).QueryContext(ctx,
+		`SELECT `+sequenceColumns+` FROM sequences WHERE org_id = $1 ORDER BY name`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Sequence{}
+	for rows.Next() {
+		seq, err := scanSequence(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, seq)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgSequences) Get(ctx context.Context, orgID int64, name string) (models.Sequence, error) {
+	seq, err := scanSequence(r.db(ctx).QueryRowContext(ctx,
+		`SELECT `+sequenceColumns+` FROM sequences WHERE name = $1 AND org_id = $2`, name, orgID))
+	return seq, rowErr(err)
+}
+
+func (r *pgSequences) Create(ctx context.Context, orgID int64, in models.Sequence) (models.Sequence, error) {
+	seq, err := scanSequence(r.db(ctx).QueryRowContext(ctx, `
+		INSERT INTO sequences (org_id, name, prefix, padding, last_value)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+sequenceColumns, orgID, in.Name, in.Prefix, in.Padding, in.LastValue))
+	return seq, rowErr(err)
+}
+
+func (r *pgSequences) Update(ctx context.Context, orgID int64, name string, p SequencePatch) (models.Sequence, error) {
+	seq, err := scanSequence(r.db(ctx).QueryRowContext(ctx, `
+		UPDATE sequences
+		SET prefix = COALESCE($3, prefix), padding = COALESCE($4, padding)
+		WHERE name = $1 AND org_id = $2
+		RETURNING `+sequenceColumns, name, orgID, p.Prefix, p.Padding))
+	return seq, rowErr(err)
+}
+
+func (r *pgSequences) Delete(ctx context.Context, orgID int64, name string) error {
+	res, err := r.db(ctx).ExecContext(ctx, `DELETE FROM sequences WHERE name = $1 AND org_id = $2`, name, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgSequences) Next(ctx context.Context, orgID int64, name string, count int) (models.Sequence, error) {
+	// The row lock taken by the UPDATE serializes concurrent allocations
+	seq, err := scanSequence(r.db(ctx).QueryRowContext(ctx, `
+		UPDATE sequences SET last_value = last_value + $3
+		WHERE name = $1 AND org_id = $2
+		RETURNING `+sequenceColumns, name, orgID, count))
+	return seq, rowErr(err)
+}
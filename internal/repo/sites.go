@@ -0,0 +1,264 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/query"
+)
+
+// SiteRepo stores an org's sites. Deleted sites stay in the trash and are
+// invisible to every method.
+type SiteRepo interface {
+	List(ctx context.Context, orgID int64, opts ListOptions) (Page[models.Site], error)
+	Get(ctx context.Context, orgID, id int64) (models.Site, error)
+	Create(ctx context.Context, orgID int64, in models.Site) (models.Site, error)
+	Update(ctx context.Context, orgID, id int64, p SitePatch) (models.Site, error)
+	Delete(ctx context.Context, orgID, id int64) error
+	// FindByNames returns the live sites whose names match one of names,
+	// ignoring case
+	FindByNames(ctx context.Context, orgID int64, names []string) ([]models.Site, error)
+	// CreateMany adds the sites in one statement: all of them or none
+	CreateMany(ctx context.Context, orgID int64, in []NewSite) ([]models.Site, error)
+}
+
+// NewSite is a site of a CreateMany batch. Its parent is either an existing
+// site (Site.ParentID) or, when ParentIndex is set, an earlier entry of the
+// same batch.
+type NewSite struct {
+	Site        models.Site
+	ParentIndex *int
+}
+
+// SitePatch lists the fields to change; nil fields are left alone, an empty
+// Location or Notes clears it and ParentID 0 detaches the site
+type SitePatch struct {
+	Name      *string
+	Location  *string
+	Notes     *string
+	Latitude  *float64
+	Longitude *float64
+	ParentID  *int
+}
+
+// Empty reports whether the patch changes nothing
+func (p SitePatch) Empty() bool {
+	return p.Name == nil && p.Location == nil && p.Notes == nil &&
+		p.Latitude == nil && p.Longitude == nil && p.ParentID == nil
+}
+
+const siteColumns = `id, name, location, notes, latitude, longitude, parent_id, created_at, updated_at`
+
+var siteSort = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// SiteSortKeys lists the keys sites can be sorted by
+func SiteSortKeys() []string { return query.SortKeys(siteSort) }
+
+type pgSites struct {
+	db         DBFunc
+	scanBudget int
+}
+
+// NewSiteRepo returns the Postgres SiteRepo. Lists expected to match more
+// than scanBudget rows report an estimated total (0 always counts).
+func NewSiteRepo(db DBFunc, scanBudget int) SiteRepo {
+	return &pgSites{db: db, scanBudget: scanBudget}
+}
+
+func scanSite(row interface{ Scan(...any) error }, extra ...any) (models.Site, error) {
+	var sc models.Site
+	err := row.Scan(append([]any{&sc.ID, &sc.Name, &sc.Location, &sc.Notes,
+		&sc.Latitude, &sc.Longitude, &sc.ParentID, &sc.CreatedAt, &sc.UpdatedAt}, extra...)...)
+	return sc, err
+}
+
+func (r *pgSites) List(ctx context.Context, orgID int64, opts ListOptions) (Page[models.Site], error) {
+	where := query.OrgScoped(orgID)
+	where.And("deleted_at IS NULL")
+	if opts.Query != "" {
+		where.And("name ILIKE ?", "%"+opts.Query+"%")
+	}
+
+	q := r.db(ctx)
+	countExpr, estimate := query.CountExpr(ctx, q, "sites"+where.Clause(), where.Args(), r.scanBudget)
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`SELECT %s, %s FROM sites%s%s LIMIT %d OFFSET %d`,
+		siteColumns, countExpr, where.Clause(), query.OrderBy(opts.Sort, siteSort), opts.Limit, opts.Offset), where.Args()...)
+	if err != nil {
+		return Page[models.Site]{}, err
+	}
+	defer rows.Close()
+
+	page := Page[models.Site]{Rows: []models.Site{}}
+	for rows.Next() {
+		sc, err := scanSite(rows, &page.Total)
+		if err != nil {
+			return Page[models.Site]{}, err
+		}
+		page.Rows = append(page.Rows, sc)
+	}
+	if estimate > 0 {
+		page.Total, page.Estimated = estimate, true
+	}
+	return page, rows.Err()
+}
+
+func (r *pgSites) Get(ctx context.Context, orgID, id int64) (models.Site, error) {
+	sc, err := scanSite(r.db(ctx).QueryRowContext(ctx, `
+		SELECT `+siteColumns+`
+		FROM sites WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`, id, orgID))
+	return sc, rowErr(err)
+}
+
+func (r *pgSites) Create(ctx context.Context, orgID int64, in models.Site) (models.Site, error) {
+	sc, err := scanSite(r.db(ctx).QueryRowContext(ctx, `
+		INSERT INTO sites (name, location, notes, latitude, longitude, parent_id, org_id)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING `+siteColumns,
+		in.Name, nullIfEmpty(in.Location), nullIfEmpty(in.Notes), in.Latitude, in.Longitude, in.ParentID, orgID))
+	return sc, rowErr(err)
+}
+
+func (r *pgSites) Update(ctx context.Context, orgID, id int64, p SitePatch) (models.Site, error) {
+	upd := query.NewUpdate("sites", orgID)
+	if p.Name != nil {
+		upd.Set("name", *p.Name)
+	}
+	if p.Location != nil {
+		upd.Set("location", nullIfEmpty(p.Location))
+	}
+	if p.Notes != nil {
+		upd.Set("notes", nullIfEmpty(p.Notes))
+	}
+	if p.Latitude != nil {
+		upd.Set("latitude", *p.Latitude)
+	}
+	if p.Longitude != nil {
+		upd.Set("longitude", *p.Longitude)
+	}
+	if p.ParentID != nil {
+		upd.Set("parent_id", nullIfZero(*p.ParentID))
+	}
+	upd.And("id = ?", id)
+	upd.And("deleted_at IS NULL")
+
+	sc, err := scanSite(r.db(ctx).QueryRowContext(ctx, upd.SQL("RETURNING "+siteColumns), upd.Args()...))
+	return sc, rowErr(err)
+}
+
+func (r *pgSites) Delete(ctx context.Context, orgID, id int64) error {
+	res, err := r.db(ctx).ExecContext(ctx,
+		`UPDATE sites SET deleted_at = NOW() WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgSites) FindByNames(ctx context.Context, orgID int64, names []string) ([]models.Site, error) {
+	lower := make([]string, len(names))
+	for i, n := range names {
+		lower[i] = strings.ToLower(n)
+	}
+	rows, err := r.db(ctx).QueryContext(ctx, `
+		SELECT `+siteColumns+`
+		FROM sites WHERE org_id = $1 AND deleted_at IS NULL AND lower(name) = ANY($2)
+		ORDER BY id`, orgID, lower)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []models.Site{}
+	for rows.Next() {
+		sc, err := scanSite(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// newSiteRow is a CreateMany entry as passed to Postgres
+type newSiteRow struct {
+	N           int      `json:"n"`
+	Name        string   `json:"name"`
+	Location    *string  `json:"location"`
+	Notes       *string  `json:"notes"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
+	ParentID    *int     `json:"parent_id"`
+	ParentIndex *int     `json:"parent_n"`
+}
+
+func (r *pgSites) CreateMany(ctx context.Context, orgID int64, in []NewSite) ([]models.Site, error) {
+	if len(in) == 0 {
+		return []models.Site{}, nil
+	}
+	batch := make([]newSiteRow, len(in))
+	for i, ns := range in {
+		batch[i] = newSiteRow{
+			N: i, Name: ns.Site.Name, Latitude: ns.Site.Latitude, Longitude: ns.Site.Longitude,
+			ParentID: ns.Site.ParentID, ParentIndex: ns.ParentIndex,
+		}
+		if nullIfEmpty(ns.Site.Location) != nil {
+			batch[i].Location = ns.Site.Location
+		}
+		if nullIfEmpty(ns.Site.Notes) != nil {
+			batch[i].Notes = ns.Site.Notes
+		}
+	}
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	// IDs are drawn up front, in batch order, so entries can point at parents
+	// of the same batch; foreign keys are checked at the end of the statement
+	rows, err := r.db(ctx).QueryContext(ctx, `
+		WITH input AS (
+			SELECT * FROM jsonb_to_recordset($2::jsonb) AS x(
+				n int, name text, location text, notes text,
+				latitude float8, longitude float8, parent_id int, parent_n int)
+		), ids AS (
+			SELECT n, nextval(pg_get_serial_sequence('public.sites', 'id'))::int AS id FROM input ORDER BY n
+		)
+		INSERT INTO sites (id, name, location, notes, latitude, longitude, parent_id, org_id)
+		SELECT ids.id, x.name, x.location, x.notes, x.latitude, x.longitude, COALESCE(p.id, x.parent_id), $1
+		FROM input x
+		JOIN ids ON ids.n = x.n
+		LEFT JOIN ids p ON p.n = x.parent_n
+		ORDER BY x.n
+		RETURNING `+siteColumns, orgID, string(payload))
+	if err != nil {
+		return nil, rowErr(err)
+	}
+	defer rows.Close()
+
+	out := make([]models.Site, 0, len(in))
+	for rows.Next() {
+		sc, err := scanSite(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, rowErr(err)
+	}
+	// IDs ascend with the batch, so this restores its order
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
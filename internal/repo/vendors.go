@@ -0,0 +1,141 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/query"
+)
+
+// VendorRepo stores an org's vendors. Deleted vendors stay in the trash and
+// are invisible to every method.
+type VendorRepo interface {
+	List(ctx context.Context, orgID int64, opts ListOptions) (Page[models.Vendor], error)
+	Get(ctx context.Context, orgID, id int64) (models.Vendor, error)
+	Create(ctx context.Context, orgID int64, in models.Vendor) (models.Vendor, error)
+	Update(ctx context.Context, orgID, id int64, p VendorPatch) (models.Vendor, error)
+	Delete(ctx context.Context, orgID, id int64) error
+}
+
+// VendorPatch lists the fields to change; nil fields are left alone and an
+// empty Email, Phone or Notes clears it
+type VendorPatch struct {
+	Name  *string
+	Email *string
+	Phone *string
+	Notes *string
+}
+
+// Empty reports whether the patch changes nothing
+func (p VendorPatch) Empty() bool {
+	return p.Name == nil && p.Email == nil && p.Phone == nil && p.Notes == nil
+}
+
+const vendorColumns = `id, name, email, phone, notes, created_at, updated_at`
+
+var vendorSort = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// VendorSortKeys lists the keys vendors can be sorted by
+func VendorSortKeys() []string { return query.SortKeys(vendorSort) }
+
+type pgVendors struct {
+	db         DBFunc
+	scanBudget int
+}
+
+// NewVendorRepo returns the Postgres VendorRepo. Lists expected to match more
+// than scanBudget rows report an estimated total (0 always counts).
+func NewVendorRepo(db DBFunc, scanBudget int) VendorRepo {
+	return &pgVendors{db: db, scanBudget: scanBudget}
+}
+
+func scanVendor(row interface{ Scan(...any) error }, extra ...any) (models.Vendor, error) {
+	var v models.Vendor
+	err := row.Scan(append([]any{&v.ID, &v.Name, &v.Email, &v.Phone, &v.Notes, &v.CreatedAt, &v.UpdatedAt}, extra...)...)
+	return v, err
+}
+
+func (r *pgVendors) List(ctx context.Context, orgID int64, opts ListOptions) (Page[models.Vendor], error) {
+	where := query.OrgScoped(orgID)
+	where.And("deleted_at IS NULL")
+	if opts.Query != "" {
+		where.And("name ILIKE ?", "%"+opts.Query+"%")
+	}
+
+	q := r.db(ctx)
+	countExpr, estimate := query.CountExpr(ctx, q, "vendors"+where.Clause(), where.Args(), r.scanBudget)
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`SELECT %s, %s FROM vendors%s%s LIMIT %d OFFSET %d`,
+		vendorColumns, countExpr, where.Clause(), query.OrderBy(opts.Sort, vendorSort), opts.Limit, opts.Offset), where.Args()...)
+	if err != nil {
+		return Page[models.Vendor]{}, err
+	}
+	defer rows.Close()
+
+	page := Page[models.Vendor]{Rows: []models.Vendor{}}
+	for rows.Next() {
+		v, err := scanVendor(rows, &page.Total)
+		if err != nil {
+			return Page[models.Vendor]{}, err
+		}
+		page.Rows = append(page.Rows, v)
+	}
+	if estimate > 0 {
+		page.Total, page.Estimated = estimate, true
+	}
+	return page, rows.Err()
+}
+
+func (r *pgVendors) Get(ctx context.Context, orgID, id int64) (models.Vendor, error) {
+	v, err := scanVendor(r.db(ctx).QueryRowContext(ctx, `
+		SELECT `+vendorColumns+`
+		FROM vendors WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`, id, orgID))
+	return v, rowErr(err)
+}
+
+func (r *pgVendors) Create(ctx context.Context, orgID int64, in models.Vendor) (models.Vendor, error) {
+	v, err := scanVendor(r.db(ctx).QueryRowContext(ctx, `
+		INSERT INTO vendors (name, email, phone, notes, org_id)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING `+vendorColumns,
+		in.Name, nullIfEmpty(in.Email), nullIfEmpty(in.Phone), nullIfEmpty(in.Notes), orgID))
+	return v, rowErr(err)
+}
+
+func (r *pgVendors) Update(ctx context.Context, orgID, id int64, p VendorPatch) (models.Vendor, error) {
+	upd := query.NewUpdate("vendors", orgID)
+	if p.Name != nil {
+		upd.Set("name", *p.Name)
+	}
+	if p.Email != nil {
+		upd.Set("email", nullIfEmpty(p.Email))
+	}
+	if p.Phone != nil {
+		upd.Set("phone", nullIfEmpty(p.Phone))
+	}
+	if p.Notes != nil {
+		upd.Set("notes", nullIfEmpty(p.Notes))
+	}
+	upd.And("id = ?", id)
+	upd.And("deleted_at IS NULL")
+
+	v, err := scanVendor(r.db(ctx).QueryRowContext(ctx, upd.SQL("RETURNING "+vendorColumns), upd.Args()...))
+	return v, rowErr(err)
+}
+
+func (r *pgVendors) Delete(ctx context.Context, orgID, id int64) error {
+	res, err := r.db(ctx).ExecContext(ctx,
+		`UPDATE vendors SET deleted_at = NOW() WHERE id = $1 AND org_id = $2 AND deleted_at IS NULL`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
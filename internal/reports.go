@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/i18n"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/xlsx"
+)
+
+// agingBuckets are the age ranges of the aging report, youngest first
+var agingBuckets = []string{"0-1y", "1-3y", "3-5y", ">5y", "unknown"}
+
+// agingRow counts items of one site and device type per age bucket
+type agingRow struct {
+	Site       string         `json:"site"`
+	DeviceType string         `json:"device_type"`
+	Buckets    map[string]int `json:"buckets"`
+	Total      int            `json:"total"`
+}
+
+// agingReport is the response of GET /reports/aging
+type agingReport struct {
+	Data   []agingRow     `json:"data"`
+	Totals map[string]int `json:"totals"`
+}
+
+// reportFormat reads ?format= of a report: json (the default), csv or xlsx
+func reportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		return "json", true
+	case "csv", "xlsx":
+		return format, true
+	default:
+		problem.BadRequest(w, r, "format must be json, csv or xlsx")
+		return "", false
+	}
+}
+
+// exportLang reads the language of a download's headers: ?lang= or else the
+// caller's Accept-Language, defaulting to the field names (i18n.Default)
+func exportLang(w http.ResponseWriter, r *http.Request) (string, bool) {
+	v := r.URL.Query().Get("lang")
+	if v == "" {
+		return i18n.FromAcceptLanguage(r.Header.Get("Accept-Language")), true
+	}
+	lang, ok := i18n.Parse(v)
+	if !ok {
+		problem.BadRequest(w, r, "lang must be one of: "+i18n.Supported())
+	}
+	return lang, ok
+}
+
+// sendReportFile sets the download headers of a csv or xlsx report named
+// name, with headers in lang, and writes it; the status is sent by then, so
+// a failure is only logged
+func sendReportFile(w http.ResponseWriter, format, name, lang string, write func(io.Writer) error) {
+	contentType := "text/csv"
+	if format == "xlsx" {
+		contentType = xlsx.ContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, format))
+	w.Header().Set("Content-Language", lang)
+	if err := write(w); err != nil {
+		log.Printf("%s report: %v", name, err)
+	}
+}
+
+// getAgingReport buckets items by age since installation per site and type.
+// ?format=csv or ?format=xlsx returns the same table as a download.
+func (s *Server) getAgingReport(w http.ResponseWriter, r *http.Request) {
+	format, ok := reportFormat(w, r)
+	if !ok {
+		return
+	}
+	lang, ok := exportLang(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	where := "org_id = $1 AND deleted_at IS NULL"
+	args := []interface{}{auth.OrgIDFromContext(ctx)}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", 2); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+	if clause, groupArgs, ok := reportGroupClause(w, r, "inventory", len(args)+1); !ok {
+		return
+	} else if clause != "" {
+		where += " AND " + clause
+		args = append(args, groupArgs...)
+	}
+
+	q := dbFrom(ctx, s.DB)
+	rows, err := q.QueryContext(ctx, `
+		SELECT COALESCE(site, ''), COALESCE(device_type, ''),
+		       COUNT(*) FILTER (WHERE installed_at > CURRENT_DATE - INTERVAL '1 year'),
+		       COUNT(*) FILTER (WHERE installed_at <= CURRENT_DATE - INTERVAL '1 year' AND installed_at > CURRENT_DATE - INTERVAL '3 years'),
+		       COUNT(*) FILTER (WHERE installed_at <= CURRENT_DATE - INTERVAL '3 years' AND installed_at > CURRENT_DATE - INTERVAL '5 years'),
+		       COUNT(*) FILTER (WHERE installed_at <= CURRENT_DATE - INTERVAL '5 years'),
+		       COUNT(*) FILTER (WHERE installed_at IS NULL)
+		FROM inventory WHERE `+where+`
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	report := agingReport{Data: []agingRow{}, Totals: map[string]int{"total": 0}}
+	for _, b := range agingBuckets {
+		report.Totals[b] = 0
+	}
+	for rows.Next() {
+		row := agingRow{Buckets: make(map[string]int, len(agingBuckets))}
+		counts := make([]int, len(agingBuckets))
+		dest := []interface{}{&row.Site, &row.DeviceType}
+		for i := range counts {
+			dest = append(dest, &counts[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		for i, b := range agingBuckets {
+			row.Buckets[b] = counts[i]
+			row.Total += counts[i]
+			report.Totals[b] += counts[i]
+		}
+		report.Totals["total"] += row.Total
+		report.Data = append(report.Data, row)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	switch format {
+	case "csv":
+		sendReportFile(w, format, "aging-report", lang, func(out io.Writer) error { return writeAgingCSV(out, report, lang) })
+		return
+	case "xlsx":
+		sendReportFile(w, format, "aging-report", lang, func(out io.Writer) error { return writeAgingXLSX(out, report, lang) })
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// agingHeader is the header row of the csv and xlsx aging reports in lang
+func agingHeader(lang string) []string {
+	return i18n.Headers(lang, append(append([]string{"site", "device_type"}, agingBuckets...), "total"))
+}
+
+// agingTotalLabel names the totals line in lang
+func agingTotalLabel(lang string) string {
+	return strings.ToUpper(i18n.Header(lang, "total"))
+}
+
+// writeAgingCSV writes one line per site/type followed by a totals line,
+// with headers in lang
+func writeAgingCSV(w io.Writer, report agingReport, lang string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(agingHeader(lang)); err != nil {
+		return err
+	}
+	line := func(site, deviceType string, buckets map[string]int, total int) error {
+		rec := []string{site, deviceType}
+		for _, b := range agingBuckets {
+			rec = append(rec, strconv.Itoa(buckets[b]))
+		}
+		return cw.Write(append(rec, strconv.Itoa(total)))
+	}
+	for _, row := range report.Data {
+		if err := line(row.Site, row.DeviceType, row.Buckets, row.Total); err != nil {
+			return err
+		}
+	}
+	if err := line(agingTotalLabel(lang), "", report.Totals, report.Totals["total"]); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeAgingXLSX writes the CSV table as a formatted sheet: a frozen header,
+// counts as numbers and a bold totals line
+func writeAgingXLSX(w io.Writer, report agingReport, lang string) error {
+	widths := []float64{24, 18}
+	for range agingBuckets {
+		widths = append(widths, 10)
+	}
+	xw, err := xlsx.NewWriterLayout(w, "Aging", xlsx.Layout{Widths: append(widths, 10), FreezeRows: 1})
+	if err != nil {
+		return err
+	}
+	if err := xw.WriteHeader(agingHeader(lang)); err != nil {
+		return err
+	}
+	line := func(site, deviceType string, buckets map[string]int, total int) []xlsx.Cell {
+		cells := []xlsx.Cell{xlsx.Text(site), xlsx.Text(deviceType)}
+		for _, b := range agingBuckets {
+			cells = append(cells, xlsx.Int(buckets[b]))
+		}
+		return append(cells, xlsx.Int(total))
+	}
+	for _, row := range report.Data {
+		if err := xw.WriteCells(line(row.Site, row.DeviceType, row.Buckets, row.Total)); err != nil {
+			return err
+		}
+	}
+	totals := line(agingTotalLabel(lang), "", report.Totals, report.Totals["total"])
+	for i := range totals {
+		totals[i] = totals[i].Styled(xlsx.StyleTotal)
+	}
+	if err := xw.WriteCells(totals); err != nil {
+		return err
+	}
+	return xw.Close()
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/i18n"
+	"era-inventory-api/internal/xlsx"
+)
+
+func TestWriteAgingCSV(t *testing.T) {
+	report := agingReport{
+		Data: []agingRow{
+			{Site: "HQ", DeviceType: "switch", Buckets: map[string]int{"0-1y": 2, ">5y": 1}, Total: 3},
+			{Site: "Lab", DeviceType: "", Buckets: map[string]int{"unknown": 4}, Total: 4},
+		},
+		Totals: map[string]int{"0-1y": 2, "1-3y": 0, "3-5y": 0, ">5y": 1, "unknown": 4, "total": 7},
+	}
+
+	var sb strings.Builder
+	if err := writeAgingCSV(&sb, report, i18n.Default); err != nil {
+		t.Fatalf("writeAgingCSV failed: %v", err)
+	}
+	want := "site,device_type,0-1y,1-3y,3-5y,>5y,unknown,total\n" +
+		"HQ,switch,2,0,0,1,0,3\n" +
+		"Lab,,0,0,0,0,4,4\n" +
+		"TOTAL,,2,0,0,1,4,7\n"
+	if sb.String() != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestWriteAgingCSVLocalized(t *testing.T) {
+	report := agingReport{Totals: map[string]int{"total": 0}}
+	var sb strings.Builder
+	if err := writeAgingCSV(&sb, report, "de"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Standort,Gerätetyp,0-1y,1-3y,3-5y,>5y,unbekannt,Gesamt\n" +
+		"GESAMT,,0,0,0,0,0,0\n"
+	if sb.String() != want {
+		t.Errorf("Unexpected CSV:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestExportLang(t *testing.T) {
+	for _, tc := range []struct {
+		query, accept, want string
+		ok                  bool
+	}{
+		{"", "", "en", true},
+		{"", "de-DE,de;q=0.9", "de", true},
+		{"lang=fr", "de-DE", "fr", true},
+		{"lang=es-MX", "", "es", true},
+		{"lang=it", "", "", false},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/reports/aging?"+tc.query, nil)
+		r.Header.Set("Accept-Language", tc.accept)
+		lang, ok := exportLang(w, r)
+		if lang != tc.want || ok != tc.ok || (!ok && w.Code != http.StatusBadRequest) {
+			t.Errorf("%q / %q: got %q %v (status %d), want %q %v", tc.query, tc.accept, lang, ok, w.Code, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestWriteAgingXLSX(t *testing.T) {
+	report := agingReport{
+		Data: []agingRow{
+			{Site: "HQ", DeviceType: "switch", Buckets: map[string]int{"0-1y": 2, ">5y": 1}, Total: 3},
+		},
+		Totals: map[string]int{"0-1y": 2, "1-3y": 0, "3-5y": 0, ">5y": 1, "unknown": 0, "total": 3},
+	}
+	var buf bytes.Buffer
+	if err := writeAgingXLSX(&buf, report, i18n.Default); err != nil {
+		t.Fatalf("writeAgingXLSX failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sheet struct {
+		Pane struct {
+			YSplit int `xml:"ySplit,attr"`
+		} `xml:"sheetViews>sheetView>pane"`
+		Rows []struct {
+			Cells []struct {
+				Style int    `xml:"s,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, _ := f.Open()
+		err = xml.NewDecoder(rc).Decode(&sheet)
+		rc.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Pane.YSplit != 1 || len(sheet.Rows) != 3 {
+		t.Fatalf("sheet = %+v, want a frozen header, one row and totals", sheet)
+	}
+	header, row, totals := sheet.Rows[0].Cells, sheet.Rows[1].Cells, sheet.Rows[2].Cells
+	if header[0].Text != "site" || header[0].Style != int(xlsx.StyleHeader) {
+		t.Errorf("header = %+v", header[0])
+	}
+	if row[2].Value != "2" || row[2].Style != int(xlsx.StyleInteger) || row[len(row)-1].Value != "3" {
+		t.Errorf("row = %+v, want counts as numbers", row)
+	}
+	if totals[0].Text != "TOTAL" || totals[len(totals)-1].Style != int(xlsx.StyleTotal) {
+		t.Errorf("totals = %+v", totals)
+	}
+}
@@ -0,0 +1,65 @@
+// Package requestid tags every request with an ID that is returned in the
+// X-Request-ID response header, included in error responses and written to
+// logs, so a client's failed call can be found in the server logs. A client
+// may send its own ID; otherwise one is generated.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the request ID in both directions
+const Header = "X-Request-ID"
+
+// maxLen bounds client-supplied IDs so they cannot bloat logs
+const maxLen = 128
+
+type ctxKey struct{}
+
+// FromContext returns the request's ID, or "" outside a request
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// WithID returns a context carrying id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// Middleware accepts a valid X-Request-ID from the client or generates one,
+// stores it in the request context and sets it on the response
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = generate()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(WithID(r.Context(), id)))
+	})
+}
+
+// valid accepts IDs of visible ASCII characters without quotes or
+// backslashes, so they are safe to echo into headers, JSON and log lines
+func valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func generate() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,50 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name  string
+		sent  string
+		keeps bool
+	}{
+		{"generated", "", false},
+		{"client id", "client-7f3a", true},
+		{"too long", strings.Repeat("a", maxLen+1), false},
+		{"control characters", "abc\ndef", false},
+		{"quotes", `abc"def`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				r.Header.Set(Header, tt.sent)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			got := w.Header().Get(Header)
+			if got == "" || got != seen {
+				t.Fatalf("response id %q, context id %q", got, seen)
+			}
+			if (got == tt.sent) != tt.keeps {
+				t.Errorf("id = %q for sent %q", got, tt.sent)
+			}
+		})
+	}
+}
+
+func TestGeneratedIDsDiffer(t *testing.T) {
+	if a, b := generate(), generate(); a == b || len(a) != 32 {
+		t.Errorf("generate() = %q, %q", a, b)
+	}
+}
@@ -0,0 +1,346 @@
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/problem"
+)
+
+// retentionPurgeInterval is how often history past its retention is purged
+const retentionPurgeInterval = time.Hour
+
+// maxRetentionDays bounds a retention setting (100 years)
+const maxRetentionDays = 36500
+
+// retentionSetting is one class of GET /org/retention. Days is the org's
+// choice, unset when it follows the default; EffectiveDays is what the purger
+// applies, 0 meaning the history is kept forever.
+type retentionSetting struct {
+	Class         string `json:"class"`
+	Days          *int   `json:"days"`
+	DefaultDays   int    `json:"default_days"`
+	MinDays       int    `json:"min_days"`
+	EffectiveDays int    `json:"effective_days"`
+}
+
+// effectiveRetention is the days of history kept for class given the org's
+// choice: the choice or the default, never below the minimum, which may have
+// been raised since the org chose
+func (s *Server) effectiveRetention(class string, orgDays map[string]int) int {
+	days, ok := orgDays[class]
+	if !ok {
+		days = s.RetentionDays[class]
+	}
+	if minDays := s.RetentionMinDays[class]; days > 0 && days < minDays {
+		days = minDays
+	}
+	return days
+}
+
+// retentionSettings lists every class with the org's choices applied
+func (s *Server) retentionSettings(orgDays map[string]int) []retentionSetting {
+	out := make([]retentionSetting, 0, len(config.RetentionClasses))
+	for _, class := range config.RetentionClasses {
+		setting := retentionSetting{
+			Class:         class,
+			DefaultDays:   s.RetentionDays[class],
+			MinDays:       s.RetentionMinDays[class],
+			EffectiveDays: s.effectiveRetention(class, orgDays),
+		}
+		if days, ok := orgDays[class]; ok {
+			setting.Days = &days
+		}
+		out = append(out, setting)
+	}
+	return out
+}
+
+// orgRetentionDays loads the retention choices of the caller's org
+func (s *Server) orgRetentionDays(ctx context.Context) (map[string]int, error) {
+	var raw []byte
+	if err := dbFrom(ctx, s.DB).QueryRowContext(ctx,
+		`SELECT retention_days FROM organizations WHERE id = $1`, auth.OrgIDFromContext(ctx)).Scan(&raw); err != nil {
+		return nil, err
+	}
+	days := map[string]int{}
+	return days, json.Unmarshal(raw, &days)
+}
+
+func (s *Server) getRetention(w http.ResponseWriter, r *http.Request) {
+	days, err := s.orgRetentionDays(r.Context())
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": s.retentionSettings(days)}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// updateRetention merges the body, days by class, into the org's choices:
+// 0 keeps a class forever and null reverts it to the default. Values below
+// the minimum of a class are rejected.
+func (s *Server) updateRetention(w http.ResponseWriter, r *http.Request) {
+	var in map[string]*int
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if len(in) == 0 {
+		problem.BadRequest(w, r, "no fields to update")
+		return
+	}
+	if err := s.checkRetention(in); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	days, err := s.orgRetentionDays(r.Context())
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	for class, v := range in {
+		if v == nil {
+			delete(days, class)
+		} else {
+			days[class] = *v
+		}
+	}
+	raw, err := json.Marshal(days)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if _, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(),
+		`UPDATE organizations SET retention_days = $2 WHERE id = $1`, auth.OrgIDFromContext(r.Context()), raw); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	s.getRetention(w, r)
+}
+
+// checkRetention validates the classes and days of a PUT /org/retention body
+func (s *Server) checkRetention(in map[string]*int) error {
+	classes := make([]string, 0, len(in))
+	for class := range in {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		v := in[class]
+		if !config.ValidRetentionClass(class) {
+			return fmt.Errorf("unknown retention class %q", class)
+		}
+		if v == nil {
+			continue
+		}
+		if *v < 0 || *v > maxRetentionDays {
+			return fmt.Errorf("%s must be between 0 and %d days", class, maxRetentionDays)
+		}
+		if minDays := s.RetentionMinDays[class]; *v > 0 && *v < minDays {
+			return fmt.Errorf("%s must be kept at least %d days", class, minDays)
+		}
+	}
+	return nil
+}
+
+// startRetentionPurger deletes history past the retention of its org, and
+// export files past ExportRetention, every retentionPurgeInterval until Close
+func (s *Server) startRetentionPurger() {
+	s.retentionStop = make(chan struct{})
+	s.retentionDone = make(chan struct{})
+	go func() {
+		defer close(s.retentionDone)
+		ticker := time.NewTicker(retentionPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.retentionStop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				n, err := s.purgeHistory(ctx, time.Now())
+				if err != nil {
+					log.Printf("retention purge failed: %v", err)
+				} else if n > 0 {
+					log.Printf("retention purge removed %d records", n)
+				}
+				files, err := s.sweepExports(ctx, time.Now())
+				cancel()
+				if err != nil {
+					log.Printf("export sweep failed: %v", err)
+				} else if files > 0 {
+					log.Printf("export sweep removed %d files", files)
+				}
+			}
+		}
+	}()
+}
+
+// stopRetentionPurger stops the purger started by startRetentionPurger and waits for it
+func (s *Server) stopRetentionPurger() {
+	if s.retentionStop == nil {
+		return
+	}
+	close(s.retentionStop)
+	<-s.retentionDone
+	s.retentionStop = nil
+}
+
+// purgeHistory deletes, org by org, the history older than the org's
+// retention of its class as of now
+func (s *Server) purgeHistory(ctx context.Context, now time.Time) (int64, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, retention_days FROM organizations ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	orgs := map[int64]map[string]int{}
+	var orgIDs []int64
+	for rows.Next() {
+		var (
+			id  int64
+			raw []byte
+		)
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		days := map[string]int{}
+		if err := json.Unmarshal(raw, &days); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("org %d: %w", id, err)
+		}
+		orgs[id] = days
+		orgIDs = append(orgIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, orgID := range orgIDs {
+		cutoffs := map[string]time.Time{}
+		for _, class := range config.RetentionClasses {
+			if days := s.effectiveRetention(class, orgs[orgID]); days > 0 {
+				cutoffs[class] = now.AddDate(0, 0, -days)
+			}
+		}
+		if len(cutoffs) == 0 {
+			continue
+		}
+		n, err := s.purgeOrgHistory(ctx, orgID, cutoffs)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("org %d: %w", orgID, err)
+		}
+	}
+	return total, nil
+}
+
+// retentionPurges are the deletes of each class; $1 is the org and $2 the
+// cutoff. Only finished work is purged, and the newest config snapshot of
+// an item is kept however old it is.
+var retentionPurges = map[string][]string{
+	config.RetentionAudit: {
+		`DELETE FROM org_access_log WHERE org_id = $1 AND created_at < $2`,
+	},
+	config.RetentionNotifications: {
+		`DELETE FROM emails WHERE org_id = $1 AND status <> 'pending' AND created_at < $2`,
+		`DELETE FROM webhook_deliveries WHERE org_id = $1 AND status <> 'pending' AND created_at < $2`,
+	},
+	config.RetentionSnapshots: {
+		`DELETE FROM item_configs c WHERE c.org_id = $1 AND c.collected_at < $2
+		   AND EXISTS (SELECT 1 FROM item_configs n
+		               WHERE n.org_id = c.org_id AND n.item_id = c.item_id AND n.collected_at > c.collected_at)`,
+	},
+}
+
+func (s *Server) purgeOrgHistory(ctx context.Context, orgID int64, cutoffs map[string]time.Time) (int64, error) {
+	conn, ctx, err := withDBConn(ctx, s.DB, orgID)
+	if err != nil {
+		return 0, err
+	}
+	defer releaseDBConn(conn)
+
+	q := dbFrom(ctx, s.DB)
+	var total int64
+	for _, class := range config.RetentionClasses {
+		cutoff, ok := cutoffs[class]
+		if !ok {
+			continue
+		}
+		if class == config.RetentionJobs {
+			n, err := s.purgeJobs(ctx, q, orgID, cutoff)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			continue
+		}
+		for _, stmt := range retentionPurges[class] {
+			res, err := q.ExecContext(ctx, stmt, orgID, cutoff)
+			if err != nil {
+				return total, err
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// purgeJobs deletes the org's jobs finished before cutoff along with the
+// files their exports left in storage
+func (s *Server) purgeJobs(ctx context.Context, q querier, orgID int64, cutoff time.Time) (int64, error) {
+	rows, err := q.QueryContext(ctx, `
+		DELETE FROM jobs WHERE org_id = $1 AND status IN ('succeeded', 'failed') AND finished_at < $2
+		RETURNING COALESCE(result->>'key', '')`, orgID, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	var n int64
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return n, err
+		}
+		n++
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if s.Storage == nil {
+		return n, nil
+	}
+	for _, key := range keys {
+		if err := s.Storage.Delete(ctx, key); err != nil {
+			log.Printf("retention purge: deleting %s: %v", key, err)
+		}
+	}
+	return n, nil
+}
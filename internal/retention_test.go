@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEffectiveRetention(t *testing.T) {
+	s := &Server{
+		RetentionDays:    map[string]int{"audit": 365, "notifications": 30},
+		RetentionMinDays: map[string]int{"audit": 180, "snapshots": 90},
+	}
+	for _, tc := range []struct {
+		class   string
+		orgDays map[string]int
+		want    int
+	}{
+		{"audit", nil, 365},
+		{"audit", map[string]int{"audit": 200}, 200},
+		{"audit", map[string]int{"audit": 0}, 0},
+		// a minimum raised after the org chose still applies
+		{"audit", map[string]int{"audit": 30}, 180},
+		{"notifications", map[string]int{"audit": 200}, 30},
+		{"jobs", nil, 0},
+		{"snapshots", map[string]int{"snapshots": 7}, 90},
+	} {
+		if got := s.effectiveRetention(tc.class, tc.orgDays); got != tc.want {
+			t.Errorf("%s with %v: %d days, want %d", tc.class, tc.orgDays, got, tc.want)
+		}
+	}
+}
+
+func TestRetentionSettings(t *testing.T) {
+	s := &Server{RetentionDays: map[string]int{"audit": 365}, RetentionMinDays: map[string]int{"audit": 180}}
+	settings := s.retentionSettings(map[string]int{"jobs": 14})
+	if len(settings) != 4 || settings[0].Class != "audit" || settings[0].Days != nil || settings[0].EffectiveDays != 365 || settings[0].MinDays != 180 {
+		t.Fatalf("Unexpected settings %+v", settings)
+	}
+	if jobs := settings[1]; jobs.Class != "jobs" || jobs.Days == nil || *jobs.Days != 14 || jobs.EffectiveDays != 14 {
+		t.Errorf("Unexpected jobs setting %+v", jobs)
+	}
+}
+
+func TestCheckRetention(t *testing.T) {
+	s := &Server{RetentionMinDays: map[string]int{"audit": 180}}
+	days := func(n int) *int { return &n }
+	for _, tc := range []struct {
+		in      map[string]*int
+		wantErr string
+	}{
+		{map[string]*int{"audit": days(365), "jobs": nil, "snapshots": days(0)}, ""},
+		{map[string]*int{"audit": days(0)}, ""},
+		{map[string]*int{"audit": days(30)}, "at least 180 days"},
+		{map[string]*int{"jobs": days(-1)}, "between 0 and"},
+		{map[string]*int{"logs": days(30)}, "unknown retention class"},
+	} {
+		err := s.checkRetention(tc.in)
+		if (tc.wantErr == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%v: err = %v, want %q", tc.in, err, tc.wantErr)
+		}
+	}
+}
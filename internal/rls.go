@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"os"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type ctxKey string
@@ -13,24 +15,72 @@ func rlsEnabled() bool {
 	return os.Getenv("RLS_ENABLED") == "true"
 }
 
+// schemaTenancy reports whether orgs may live in their own Postgres schema
+// (TENANCY_MODE=schema). Orgs without a schema_name keep using public.
+func schemaTenancy() bool {
+	return os.Getenv("TENANCY_MODE") == "schema"
+}
+
+// sessionScoped reports whether each request needs a dedicated connection
+// carrying per-org session state.
+func sessionScoped() bool {
+	return rlsEnabled() || schemaTenancy()
+}
+
 func withDBConn(ctx context.Context, db *sql.DB, orgID int64) (*sql.Conn, context.Context, error) {
-	if !rlsEnabled() {
+	if !sessionScoped() {
 		return nil, ctx, nil
 	}
 	conn, err := db.Conn(ctx)
 	if err != nil {
 		return nil, ctx, err
 	}
-	// Set session GUC for RLS
-	_, err = conn.ExecContext(ctx, "SET app.current_org_id = $1", orgID)
-	if err != nil {
-		conn.Close()
-		return nil, ctx, err
+	if rlsEnabled() {
+		// Set session GUC for RLS
+		_, err = conn.ExecContext(ctx, "SET app.current_org_id = $1", orgID)
+		if err != nil {
+			conn.Close()
+			return nil, ctx, err
+		}
+	}
+	if schemaTenancy() {
+		if err := setTenantSearchPath(ctx, conn, orgID); err != nil {
+			conn.Close()
+			return nil, ctx, err
+		}
 	}
 	ctx2 := context.WithValue(ctx, dbConnKey, conn)
 	return conn, ctx2, nil
 }
 
+// setTenantSearchPath points unqualified table names at the org's schema,
+// falling back to public for shared objects and shared-table orgs.
+func setTenantSearchPath(ctx context.Context, conn *sql.Conn, orgID int64) error {
+	var schema sql.NullString
+	err := conn.QueryRowContext(ctx, `SELECT schema_name FROM organizations WHERE id = $1`, orgID).Scan(&schema)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	path := "public"
+	if schema.Valid && schema.String != "" {
+		path = pgx.Identifier{schema.String}.Sanitize() + ", public"
+	}
+	_, err = conn.ExecContext(ctx, "SET search_path TO "+path)
+	return err
+}
+
+// releaseDBConn clears per-org session state before returning conn to the
+// pool, so unscoped queries never inherit another tenant's search_path.
+func releaseDBConn(conn *sql.Conn) {
+	if conn == nil {
+		return
+	}
+	if schemaTenancy() {
+		_, _ = conn.ExecContext(context.Background(), "RESET search_path")
+	}
+	conn.Close()
+}
+
 // Prefer DB from context when RLS on; else use pool directly.
 type querier interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
@@ -39,7 +89,7 @@ type querier interface {
 }
 
 func dbFrom(ctx context.Context, db *sql.DB) querier {
-	if !rlsEnabled() {
+	if !sessionScoped() {
 		return db
 	}
 	if v := ctx.Value(dbConnKey); v != nil {
@@ -50,4 +100,13 @@ func dbFrom(ctx context.Context, db *sql.DB) querier {
 	return db // fallback
 }
 
-
+// beginTx starts a transaction on the request's connection when it holds
+// one, so the transaction keeps the org's RLS setting and search_path
+func beginTx(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	if sessionScoped() {
+		if c, ok := ctx.Value(dbConnKey).(*sql.Conn); ok {
+			return c.BeginTx(ctx, nil)
+		}
+	}
+	return db.BeginTx(ctx, nil)
+}
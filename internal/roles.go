@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// listRoles lists the built-in roles and the org's custom roles
+func (s *Server) listRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.Roles.List(r.Context(), auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	out := make([]interface{}, 0, len(roles))
+	for _, role := range roles {
+		out = append(out, role)
+	}
+	sendListResponse(w, out, len(out), listParams{limit: len(out)}, nil)
+}
+
+func (s *Server) getRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	out, err := s.Roles.Get(r.Context(), auth.OrgIDFromContext(r.Context()), id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) createRole(w http.ResponseWriter, r *http.Request) {
+	var in models.Role
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	out, err := s.Roles.Create(r.Context(), auth.OrgIDFromContext(r.Context()), in)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) updateRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in models.Role
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	out, err := s.Roles.Update(r.Context(), auth.OrgIDFromContext(r.Context()), id, in)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) deleteRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Roles.Delete(r.Context(), auth.OrgIDFromContext(r.Context()), id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+
+	"era-inventory-api/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Cross-org policy: a record outside the caller's org, or outside the sites a
+// restricted user was granted, is answered exactly like one that does not
+// exist - 404 NOT_FOUND with the same body - so ids cannot be used to probe
+// other tenants. 403 is reserved for what the caller is trying to do (role,
+// read-only token, scope, site in a request body), never for which record
+// they named. Handlers get there by filtering every lookup on org_id (and
+// siteAccessClause for items) and by resolving {id} through pathID.
+
+// pathID parses the {id} URL parameter. Anything that is not a positive
+// integer cannot name a record in any org, so it gets the same 404.
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		problem.NotFound(w, r)
+		return 0, false
+	}
+	return id, true
+}
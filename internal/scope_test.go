@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/testutil"
+)
+
+func TestPathID(t *testing.T) {
+	for _, raw := range []string{"abc", "0", "-3", "1.5", "99999999999999999999"} {
+		w := serveAs(1, http.MethodGet, "/x/{id}", "/x/"+raw, "", func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := pathID(w, r); ok {
+				t.Errorf("%q parsed as an id", raw)
+			}
+		})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%q = %d, want 404", raw, w.Code)
+		}
+	}
+}
+
+// TestCrossOrgIsNotFound pins the cross-org policy: every operation on another
+// org's record answers exactly as it would for an id that does not exist
+func TestCrossOrgIsNotFound(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	site := f.Site("Other HQ").InOrg(2).Create()
+	vendor := f.Vendor("Other Vendor").InOrg(2).Create()
+	s := fixtureServer(f)
+
+	cases := []struct {
+		method, pattern, path, body string
+		handler                     http.HandlerFunc
+	}{
+		{http.MethodGet, "/sites/{id}", "/sites/", "", s.getSite},
+		{http.MethodPut, "/sites/{id}", "/sites/", `{"name":"Taken"}`, s.updateSite},
+		{http.MethodDelete, "/sites/{id}", "/sites/", "", s.deleteSite},
+		{http.MethodGet, "/vendors/{id}", "/vendors/", "", s.getVendor},
+		{http.MethodPut, "/vendors/{id}", "/vendors/", `{"name":"Taken"}`, s.updateVendor},
+		{http.MethodDelete, "/vendors/{id}", "/vendors/", "", s.deleteVendor},
+	}
+	for _, tc := range cases {
+		id := site.ID
+		if tc.pattern == "/vendors/{id}" {
+			id = vendor.ID
+		}
+		other := serveAs(1, tc.method, tc.pattern, tc.path+itoa(id), tc.body, tc.handler)
+		missing := serveAs(1, tc.method, tc.pattern, tc.path+"999999", tc.body, tc.handler)
+		if other.Code != http.StatusNotFound {
+			t.Errorf("%s %s in another org = %d, want 404", tc.method, tc.pattern, other.Code)
+		}
+		if a, b := problemWithoutInstance(t, other), problemWithoutInstance(t, missing); a != b {
+			t.Errorf("%s %s: other-org problem %+v differs from missing %+v", tc.method, tc.pattern, a, b)
+		}
+	}
+}
+
+// problemWithoutInstance decodes a problem body, dropping the request path
+func problemWithoutInstance(t *testing.T, w *httptest.ResponseRecorder) problem.Details {
+	t.Helper()
+	var p problem.Details
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode problem: %v", err)
+	}
+	p.Instance = ""
+	return p
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/repo"
+)
+
+// listSequences lists the org's sequences by name
+func (s *Server) listSequences(w http.ResponseWriter, r *http.Request) {
+	seqs, err := s.Sequences.List(r.Context(), auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	out := make([]interface{}, 0, len(seqs))
+	for _, seq := range seqs {
+		out = append(out, seq)
+	}
+	sendListResponse(w, out, len(out), listParams{limit: len(out)}, nil)
+}
+
+func (s *Server) getSequence(w http.ResponseWriter, r *http.Request) {
+	out, err := s.Sequences.Get(r.Context(), auth.OrgIDFromContext(r.Context()), chi.URLParam(r, "name"))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) createSequence(w http.ResponseWriter, r *http.Request) {
+	var in models.Sequence
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	out, err := s.Sequences.Create(r.Context(), auth.OrgIDFromContext(r.Context()), in)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// updateSequence changes the prefix or padding; the counter is not writable
+func (s *Server) updateSequence(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Prefix  *string `json:"prefix"`
+		Padding *int    `json:"padding"`
+	}
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	out, err := s.Sequences.Update(r.Context(), auth.OrgIDFromContext(r.Context()), chi.URLParam(r, "name"),
+		repo.SequencePatch{Prefix: in.Prefix, Padding: in.Padding})
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+func (s *Server) deleteSequence(w http.ResponseWriter, r *http.Request) {
+	if err := s.Sequences.Delete(r.Context(), auth.OrgIDFromContext(r.Context()), chi.URLParam(r, "name")); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// nextSequence allocates the next number of a sequence, or {"count": n}
+// consecutive ones. Allocated numbers are never handed out again.
+func (s *Server) nextSequence(w http.ResponseWriter, r *http.Request) {
+	in := struct {
+		Count int `json:"count"`
+	}{Count: 1}
+	if !s.decodeOptionalJSON(w, r, &in) {
+		return
+	}
+	out, err := s.Sequences.Next(r.Context(), auth.OrgIDFromContext(r.Context()), chi.URLParam(r, "name"), in.Count)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Allocating numbers consumes them for good, so it takes asset write access
+func TestNextSequenceRequiresAssetsWrite(t *testing.T) {
+	s := newRoutedServer()
+	viewer, _ := s.JWTManager.GenerateToken(4, 1, []string{"viewer"})
+	r := httptest.NewRequest("POST", "/sequences/asset/next", strings.NewReader(`{"count":1}`))
+	r.Header.Set("Authorization", "Bearer "+viewer)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("viewer allocating a number = %d, want 403: %s", w.Code, w.Body.String())
+	}
+}
@@ -6,11 +6,21 @@ import (
 	"embed"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"era-inventory-api/internal/auth"
 	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/health"
+	"era-inventory-api/internal/jobs"
+	"era-inventory-api/internal/mail"
+	"era-inventory-api/internal/outbox"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/repo"
+	"era-inventory-api/internal/requestid"
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/storage"
+	"era-inventory-api/internal/version"
+	"era-inventory-api/internal/webhook"
 
 	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -24,6 +34,94 @@ type Server struct {
 	Router     *chi.Mux
 	JWTManager *auth.JWTManager
 	Metrics    *Metrics
+	Jobs       *jobs.Runner
+	Storage    storage.Storage
+	Health     *health.Registry
+	// Status backs the public status page; nil when not running
+	Status *health.Monitor
+
+	// Business rules and data access per resource
+	Items    *service.Items
+	Sites    *service.Sites
+	Vendors  *service.Vendors
+	Sessions *service.Sessions
+	Roles    *service.Roles
+	APIKeys  *service.APIKeys
+	// Sequences numbers asset tags, POs and audits per org
+	Sequences *service.Sequences
+	// Limits enforces the per-org item and import limits
+	Limits *service.Limits
+
+	// RevokedTokens persists logouts; Revocations is the in-memory copy the
+	// JWTManager checks on every request
+	RevokedTokens repo.RevokedTokenRepo
+	Revocations   *auth.Revocations
+
+	// Admin serves /metrics, /healthz and /debug/pprof on the internal listener
+	Admin *chi.Mux
+
+	// downloadKey signs expiring export download links
+	downloadKey []byte
+
+	// ListScanBudget caps exact total counts on list endpoints (0 = unlimited)
+	ListScanBudget int
+	// ListDefaultLimit and ListMaxLimit override the page sizes of list
+	// endpoints (0 = built-in); ListMaxLimits caps single routes
+	ListDefaultLimit int
+	ListMaxLimit     int
+	ListMaxLimits    map[string]int
+	// Deprecations announces deprecated routes, by method and route pattern
+	Deprecations map[string]config.RouteDeprecation
+	// FieldDeprecations announces deprecated fields of routes, likewise
+	FieldDeprecations map[string][]config.RouteDeprecation
+	// ConfigRetention is how many config snapshots are kept per item (0 = all)
+	ConfigRetention int
+	// TrashRetention is how long soft-deleted records are kept (0 = forever)
+	TrashRetention time.Duration
+	// ExportRetention is how long export files are kept (0 = forever)
+	ExportRetention time.Duration
+	// RetentionDays and RetentionMinDays are the default and minimum days
+	// of history kept per retention class, where orgs did not choose
+	RetentionDays    map[string]int
+	RetentionMinDays map[string]int
+	// ArchiveAfterYears archives items decommissioned this long ago (0 = never)
+	ArchiveAfterYears int
+	// MainTenantOrgID is the org whose tokens may use X-Org-Context (0 = none)
+	MainTenantOrgID int64
+	// PerfBudgetP95 is the p95 latency budget reported by /admin/perf-baseline
+	PerfBudgetP95 time.Duration
+	// TopQueries serves GET /admin/db/top-queries to main tenant tokens
+	TopQueries bool
+	// Signup serves POST /signup and the main tenant's approval queue;
+	// SignupMaxPending caps the signups awaiting approval and
+	// SignupPerClient those from one client address
+	Signup           bool
+	SignupMaxPending int
+	SignupPerClient  int
+	// reportGate softly limits concurrent /reports requests per org
+	reportGate *orgGate
+	// MaxBodyBytes caps JSON request bodies (0 = defaultMaxBodyBytes)
+	MaxBodyBytes int64
+
+	// Outbox delivers the change events item writes record (see internal/outbox)
+	Outbox *outbox.Dispatcher
+	// Mail sends queued email; nil when MAIL_PROVIDER is unset
+	Mail *mail.Queue
+	// Webhooks posts the deliveries the outbox fans out to registered URLs
+	Webhooks *webhook.Sender
+
+	// purgeStop/purgeDone control the trash purger goroutine
+	purgeStop chan struct{}
+	purgeDone chan struct{}
+	// retentionStop/retentionDone control the history retention purger
+	retentionStop chan struct{}
+	retentionDone chan struct{}
+	// archiveStop/archiveDone control the archiver goroutine
+	archiveStop chan struct{}
+	archiveDone chan struct{}
+	// revocationStop/revocationDone control the revocation sync goroutine
+	revocationStop chan struct{}
+	revocationDone chan struct{}
 }
 
 func NewServer(dsn string, cfg *config.Config) *Server {
@@ -31,6 +129,15 @@ func NewServer(dsn string, cfg *config.Config) *Server {
 	if err != nil {
 		log.Fatal("Failed to open database connection:", err)
 	}
+	if cfg.DBMaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	}
+	if cfg.DBMaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	}
+	if cfg.DBConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -40,6 +147,14 @@ func NewServer(dsn string, cfg *config.Config) *Server {
 
 	// Initialize JWT manager
 	jwtManager := auth.NewJWTManager(cfg.JWTSecret, cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTExpiry)
+	jwtManager.SetLeeway(cfg.JWTLeeway)
+	if cfg.JWTPrivateKeyFile != "" {
+		keys, err := auth.LoadKeySet(cfg.JWTPrivateKeyFile, cfg.JWTPreviousKeyFiles)
+		if err != nil {
+			log.Fatal("Failed to load JWT signing keys:", err)
+		}
+		jwtManager.SetKeySet(keys)
+	}
 
 	// Validate JWT configuration
 	if err := jwtManager.ValidateConfig(); err != nil {
@@ -49,50 +164,226 @@ func NewServer(dsn string, cfg *config.Config) *Server {
 	// Initialize metrics
 	metrics := NewMetrics()
 
+	// Generated files (exports) live on local disk unless configured otherwise
+	storageDir := cfg.StorageDir
+	if storageDir == "" {
+		storageDir = "data"
+	}
+
 	s := &Server{
 		DB:         db,
 		Router:     chi.NewRouter(),
 		JWTManager: jwtManager,
 		Metrics:    metrics,
+		Jobs:       jobs.NewRunner(db),
+		Storage:    storage.NewLocal(storageDir),
+		Health:     health.NewRegistry(2 * time.Second),
+
+		downloadKey: exportSigningKey(cfg),
+
+		ListScanBudget:    cfg.ListScanBudget,
+		ListDefaultLimit:  cfg.ListDefaultLimit,
+		ListMaxLimit:      cfg.ListMaxLimit,
+		ListMaxLimits:     cfg.ListMaxLimits,
+		ConfigRetention:   cfg.ConfigRetention,
+		TrashRetention:    cfg.TrashRetention,
+		ExportRetention:   cfg.ExportRetention,
+		RetentionDays:     cfg.RetentionDays,
+		RetentionMinDays:  cfg.RetentionMinDays,
+		ArchiveAfterYears: cfg.ArchiveAfterYears,
+		MainTenantOrgID:   cfg.MainTenantOrgID,
+		PerfBudgetP95:     cfg.PerfBudgetP95,
+		TopQueries:        cfg.EnableTopQueries,
+		Signup:            cfg.SignupEnabled,
+		SignupMaxPending:  cfg.SignupMaxPending,
+		SignupPerClient:   cfg.SignupMaxPendingPerClient,
+		reportGate:        newOrgGate(cfg.ReportsPerOrg, cfg.ReportsQueueTimeout, cfg.ReportsQueueMax),
+		MaxBodyBytes:      int64(cfg.MaxBodyBytes),
 	}
-	// Mount public routes FIRST (no middleware)
-	s.Router.Get("/health", func(w http.ResponseWriter, _ *http.Request) { 
-		if _, err := w.Write([]byte("ok")); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	if len(cfg.DeprecatedRoutes) > 0 {
+		s.Deprecations = map[string]config.RouteDeprecation{}
+		s.FieldDeprecations = map[string][]config.RouteDeprecation{}
+		for _, d := range cfg.DeprecatedRoutes {
+			key := deprecationKey(d.Method, d.Route)
+			if len(d.Fields) > 0 {
+				s.FieldDeprecations[key] = append(s.FieldDeprecations[key], d)
+				continue
+			}
+			s.Deprecations[key] = d
 		}
-	})
-	s.Router.Get("/dbping", func(w http.ResponseWriter, _ *http.Request) { 
-		if _, err := w.Write([]byte("db: ok")); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	dbFunc := func(ctx context.Context) repo.Querier { return dbFrom(ctx, db) }
+	s.Items = service.NewItems(repo.NewItemRepo(dbFunc, cfg.ListScanBudget), itemAccess{s})
+	s.Sites = service.NewSites(repo.NewSiteRepo(dbFunc, cfg.ListScanBudget))
+	s.Vendors = service.NewVendors(repo.NewVendorRepo(dbFunc, cfg.ListScanBudget))
+	s.Sequences = service.NewSequences(repo.NewSequenceRepo(dbFunc))
+	s.Limits = service.NewLimits(repo.NewOrgLimitRepo(dbFunc))
+	s.Sessions = service.NewSessions(repo.NewRefreshTokenRepo(dbFunc), jwtManager, cfg.RefreshTokenTTL, cfg.SessionMaxAge)
+
+	// Revoked tokens are loaded before serving so a restart never readmits them
+	s.RevokedTokens = repo.NewRevokedTokenRepo(dbFunc)
+	s.Revocations = auth.NewRevocations()
+	jwtManager.SetRevocations(s.Revocations)
+	if err := s.syncRevocations(ctx); err != nil {
+		log.Printf("loading revoked tokens failed: %v", err)
+	}
+
+	// Custom roles likewise, so tokens naming them keep their permissions
+	roles := auth.NewRoleRegistry()
+	jwtManager.SetRoles(roles)
+	s.Roles = service.NewRoles(repo.NewRoleRepo(dbFunc), roles)
+	if err := s.Roles.Sync(ctx); err != nil {
+		log.Printf("loading roles failed: %v", err)
+	}
+	s.APIKeys = service.NewAPIKeys(repo.NewAPIKeyRepo(dbFunc), roles)
+	jwtManager.SetAPIKeys(s.APIKeys)
+
+	// Readiness checks; components with external dependencies register here
+	s.Health.Register("db", s.DB.PingContext)
+	if c, ok := s.Storage.(interface{ Check(context.Context) error }); ok {
+		s.Health.Register("storage", c.Check)
+	}
+
+	// Background jobs
+	s.Jobs.Register(exportItemsJob, s.runItemsExport)
+	s.Jobs.Register(exportServiceNowJob, s.runServiceNowExport)
+	s.Jobs.LimitPerOrg(cfg.JobsPerOrg)
+	s.Jobs.Start(2)
+	s.startTrashPurger()
+	s.startRetentionPurger()
+	s.startArchiver()
+	s.startRevocationSync(cfg.RevocationSyncInterval)
+	s.Outbox = outbox.NewDispatcher(db, cfg.OutboxPollInterval, cfg.OutboxRetention)
+	s.Outbox.Subscribe(metrics.CountOutboxEvent)
+	s.Outbox.Subscribe(webhook.Fanout(db, s.webhookItemGroups))
+	s.Outbox.Start()
+	s.Webhooks = webhook.NewSender(db, webhook.NewClient(cfg.WebhookAllowPrivate), cfg.WebhookPollInterval, cfg.WebhookMaxAttempts)
+	s.Webhooks.Start()
+	s.Status = s.newStatusMonitor(cfg)
+	s.Status.Start()
+	if mailer := newMailer(cfg); mailer != nil {
+		s.Mail = mail.NewQueue(db, mailer, cfg.MailPollInterval, cfg.MailMaxAttempts)
+		s.Mail.Start()
+	}
+
+	s.mountRoutes(cfg)
+
+	return s
+}
+
+// Close properly shuts down the server and cleans up resources
+func (s *Server) Close(ctx context.Context) error {
+	if s.Jobs != nil {
+		s.Jobs.Stop()
+	}
+	s.stopTrashPurger()
+	s.stopRetentionPurger()
+	s.stopArchiver()
+	s.stopRevocationSync()
+	if s.Status != nil {
+		s.Status.Stop()
+	}
+	if s.Outbox != nil {
+		s.Outbox.Stop()
+	}
+	if s.Mail != nil {
+		s.Mail.Stop()
+	}
+	if s.Webhooks != nil {
+		s.Webhooks.Stop()
+	}
+	if s.DB != nil {
+		return s.DB.Close()
+	}
+	return nil
+}
+
+// mountRoutes builds the public router. Every route is declared here; all but
+// the public probes and signed downloads sit behind JWT authentication.
+func (s *Server) mountRoutes(cfg *config.Config) {
+	// Every response, including CORS preflights and probes, carries a request ID
+	s.Router.Use(requestid.Middleware)
+
+	// CORS must wrap every route, including preflights for protected ones
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		s.Router.Use(corsMiddleware(cfg.CORSAllowedOrigins))
+	}
+
+	// Record request metrics; they are scraped from the admin listener only
+	if cfg.EnableMetrics {
+		s.Router.Use(s.Metrics.Middleware())
+	}
+	s.Admin = s.newAdminRouter(cfg.EnableMetrics)
+
+	// Deprecated routes say so, and when they go away, on every response;
+	// deprecated fields on the responses that carry them
+	if len(s.Deprecations) > 0 || len(s.FieldDeprecations) > 0 {
+		s.Router.Use(s.deprecationHeaders)
+	}
+
+	// Mount public routes FIRST (no middleware). The probes report no error
+	// detail here; that is only on the admin listener.
+	s.Router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := w.Write([]byte("ok")); err != nil {
+			problem.Internal(w, r, err)
 		}
 	})
-	s.mountDocs(s.Router)
+	s.Router.Method(http.MethodGet, "/healthz", health.LiveHandler())
+	s.Router.Method(http.MethodGet, "/readyz", s.Health.PublicHandler())
+	s.Router.Method(http.MethodGet, "/dbping", s.Health.PublicHandler("db"))
+	s.Router.Get("/version", s.getVersion)
+	s.Router.Get("/.well-known/jwks.json", s.getJWKS)
+	s.Router.Get("/status.json", s.getStatus)
+	if cfg.EnableSwagger {
+		s.mountDocs(s.Router)
+	}
 
-	// Mount metrics if enabled
-	if os.Getenv("ENABLE_METRICS") == "true" {
-		s.Router.Use(s.Metrics.Middleware())
-		s.Router.Get("/metrics", s.Metrics.Handler().ServeHTTP)
+	// Signed export downloads authenticate via the URL signature, not a JWT
+	s.Router.Get("/exports/{id}/download", s.downloadExport)
+
+	// Organization self-signup; the claim secret is the credential
+	if s.Signup {
+		s.Router.Post("/signup", s.signup)
+		s.Router.Post("/signup/{id}/claim", s.claimSignup)
+	}
+
+	// The refresh token in the body is the credential; access tokens may have expired
+	if cfg.RefreshTokenTTL > 0 {
+		s.Router.Post("/auth/refresh", s.refreshSession)
+		s.Router.Post("/auth/refresh/revoke", s.revokeSession)
 	}
 
 	// Create a protected route group with middleware
 	s.Router.Group(func(r chi.Router) {
 		// Apply middleware to this group only
 		r.Use(auth.AuthMiddleware(s.JWTManager))
+		r.Use(s.orgOverride)
+		r.Use(s.Metrics.TagOrg)
+		r.Use(auth.DenyReadOnlyWrites)
+		// reports wait for their org's slot before taking a connection
+		r.Use(s.reportGate.gatePrefix("/reports/"))
 		r.Use(s.withRLSSession)
+		r.Use(conditionalGET)
 
 		// Mount protected routes
 		s.mountProtectedRoutes(r)
 	})
 
-	return s
-}
-
-// Close properly shuts down the server and cleans up resources
-func (s *Server) Close(ctx context.Context) error {
-	if s.DB != nil {
-		return s.DB.Close()
-	}
-	return nil
+	// Token exchange, introspection, sessions and logout change no inventory data, so
+	// read-only roles may use them too
+	s.Router.Group(func(r chi.Router) {
+		r.Use(auth.AuthMiddleware(s.JWTManager))
+		r.Use(s.Metrics.TagOrg)
+		r.Use(s.withRLSSession)
+		r.Post("/auth/token/exchange", s.exchangeToken)
+		r.Post("/auth/logout", s.logout)
+		r.Post("/auth/introspect", s.introspectToken)
+		if cfg.RefreshTokenTTL > 0 {
+			r.Post("/auth/sessions", s.startSession)
+		}
+	})
 }
 
 // withRLSSession middleware for org isolation
@@ -101,35 +392,28 @@ func (s *Server) withRLSSession(next http.Handler) http.Handler {
 		orgID := auth.OrgIDFromContext(r.Context()) // from your JWT middleware
 		conn, ctx2, err := withDBConn(r.Context(), s.DB, orgID)
 		if err != nil {
-			http.Error(w, "db acquire: "+err.Error(), http.StatusInternalServerError)
+			problem.Write(w, r, http.StatusInternalServerError, "DB_ACQUIRE_FAILED", "db acquire: "+err.Error())
 			return
 		}
-		if conn != nil {
-			defer conn.Close()
-		}
+		defer releaseDBConn(conn)
 		next.ServeHTTP(w, r.WithContext(ctx2))
 	})
 }
 
 // mountDocs serves the OpenAPI spec and Swagger UI
 func (s *Server) mountDocs(mux *chi.Mux) {
-	// Check if Swagger is enabled
-	if os.Getenv("ENABLE_SWAGGER") != "true" {
-		return
-	}
-
 	// Serve the raw YAML
-	mux.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/openapi.yaml", conditionalGET(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data, err := openapiFS.ReadFile("openapi/openapi.yaml")
 		if err != nil {
-			http.Error(w, "Failed to read OpenAPI spec", http.StatusInternalServerError)
+			problem.Write(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to read OpenAPI spec")
 			return
 		}
 		w.Header().Set("Content-Type", "application/x-yaml")
-		if _, err := w.Write(data); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if _, err := w.Write(specWithVersion(data, version.Get().Version)); err != nil {
+			problem.Internal(w, r, err)
 		}
-	})
+	})))
 
 	// Serve a minimal Swagger UI page from CDN
 	mux.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
@@ -156,21 +440,66 @@ window.ui = SwaggerUIBundle({ url: '/openapi.yaml', dom_id: '#swagger-ui' });
 func (s *Server) mountProtectedRoutes(r chi.Router) {
 	// CRUD - require org_admin role for write operations
 	r.Get("/items", s.listItems)
+	r.Get("/items/warranty-alerts", s.listWarrantyAlerts)
+	r.Get("/items/export", s.exportItemsFile)
 	r.Get("/items/{id}", s.getItem)
 	r.Post("/items", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.createItem)).(http.HandlerFunc))
 	r.Put("/items/{id}", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.updateItem)).(http.HandlerFunc))
 	r.Delete("/items/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteItem)).(http.HandlerFunc))
 
+	// Items of a device type with details, with those details
+	r.Get("/routers", s.listRouters)
+	r.Get("/firewalls", s.listFirewalls)
+	r.Get("/access-points", s.listAccessPoints)
+	r.Get("/servers", s.listServers)
+
+	// Item configuration snapshots (network gear)
+	r.Get("/items/{id}/configs", s.listItemConfigs)
+	r.Get("/items/{id}/configs/diff", s.diffItemConfigs)
+	r.Get("/items/{id}/configs/{configID}", s.getItemConfig)
+	r.Post("/items/{id}/configs", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.createItemConfig)).(http.HandlerFunc))
+	r.Get("/configs/search", s.searchConfigs)
+
+	// Item relationships: containment and connectivity
+	r.Get("/items/{id}/links", s.listItemLinks)
+	r.Post("/items/{id}/links", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.createItemLink)).(http.HandlerFunc))
+	r.Delete("/items/{id}/links/{linkID}", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.deleteItemLink)).(http.HandlerFunc))
+	r.Get("/items/{id}/tags", s.listItemTags)
+	r.Post("/items/{id}/tags", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.addItemTags)).(http.HandlerFunc))
+	r.Delete("/items/{id}/tags/{tag}", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.deleteItemTag)).(http.HandlerFunc))
+	r.Get("/tags", s.listTags)
+
+	// Custom field definitions per device type - require org_admin role for write operations
+	r.Get("/custom-fields", s.listCustomFields)
+	r.Get("/custom-fields/{id}", s.getCustomField)
+	r.Post("/custom-fields", auth.MustRole("org_admin")(http.HandlerFunc(s.createCustomField)).(http.HandlerFunc))
+	r.Put("/custom-fields/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateCustomField)).(http.HandlerFunc))
+	r.Delete("/custom-fields/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteCustomField)).(http.HandlerFunc))
+
 	// Sites - require org_admin role for write operations
 	r.Get("/sites", s.listSites)
 	r.Get("/sites/{id}", s.getSite)
 	r.Post("/sites", auth.MustRole("org_admin")(http.HandlerFunc(s.createSite)).(http.HandlerFunc))
+	r.Post("/sites/import", auth.MustRole("org_admin")(http.HandlerFunc(s.importSites)).(http.HandlerFunc))
 	r.Put("/sites/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateSite)).(http.HandlerFunc))
 	r.Delete("/sites/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteSite)).(http.HandlerFunc))
 
+	// Roles - custom roles need the users:manage permission to change
+	r.Get("/roles", s.listRoles)
+	r.Get("/roles/{id}", s.getRole)
+	r.Post("/roles", auth.MustPermission(auth.PermUsersManage)(http.HandlerFunc(s.createRole)).(http.HandlerFunc))
+	r.Put("/roles/{id}", auth.MustPermission(auth.PermUsersManage)(http.HandlerFunc(s.updateRole)).(http.HandlerFunc))
+	r.Delete("/roles/{id}", auth.MustPermission(auth.PermUsersManage)(http.HandlerFunc(s.deleteRole)).(http.HandlerFunc))
+
+	// API keys for automation; issuing and revoking need users:manage
+	r.Get("/auth/api-keys", auth.MustPermission(auth.PermUsersManage)(http.HandlerFunc(s.listAPIKeys)).(http.HandlerFunc))
+	r.Post("/auth/api-keys", auth.MustPermission(auth.PermUsersManage)(http.HandlerFunc(s.createAPIKey)).(http.HandlerFunc))
+	r.Delete("/auth/api-keys/{id}", auth.MustPermission(auth.PermUsersManage)(http.HandlerFunc(s.revokeAPIKey)).(http.HandlerFunc))
+
 	// Vendors - require org_admin role for write operations
 	r.Get("/vendors", s.listVendors)
 	r.Get("/vendors/{id}", s.getVendor)
+	r.Get("/vendors/{id}/scorecard", s.getVendorScorecard)
 	r.Post("/vendors", auth.MustRole("org_admin")(http.HandlerFunc(s.createVendor)).(http.HandlerFunc))
 	r.Put("/vendors/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateVendor)).(http.HandlerFunc))
 	r.Delete("/vendors/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteVendor)).(http.HandlerFunc))
@@ -181,4 +510,129 @@ func (s *Server) mountProtectedRoutes(r chi.Router) {
 	r.Post("/projects", auth.MustRole("org_admin")(http.HandlerFunc(s.createProject)).(http.HandlerFunc))
 	r.Put("/projects/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateProject)).(http.HandlerFunc))
 	r.Delete("/projects/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteProject)).(http.HandlerFunc))
+	r.Get("/projects/{id}/assets", s.listProjectAssets)
+	r.Get("/projects/{id}/stats", s.getProjectStats)
+	r.Post("/projects/{id}/assets", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.attachProjectAssets)).(http.HandlerFunc))
+
+	// Asset groups: hand-picked or saved-filter collections of items
+	r.Get("/asset-groups", s.listAssetGroups)
+	r.Get("/asset-groups/{id}", s.getAssetGroup)
+	r.Post("/asset-groups", auth.MustRole("org_admin")(http.HandlerFunc(s.createAssetGroup)).(http.HandlerFunc))
+	r.Put("/asset-groups/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateAssetGroup)).(http.HandlerFunc))
+	r.Delete("/asset-groups/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteAssetGroup)).(http.HandlerFunc))
+	r.Get("/asset-groups/{id}/items", s.listAssetGroupItems)
+	r.Post("/asset-groups/{id}/items", auth.MustRole("org_admin")(http.HandlerFunc(s.addAssetGroupItems)).(http.HandlerFunc))
+	r.Delete("/asset-groups/{id}/items/{itemID}", auth.MustRole("org_admin")(http.HandlerFunc(s.removeAssetGroupItem)).(http.HandlerFunc))
+
+	// Sequences - named org counters; any writer may allocate numbers
+	r.Get("/sequences", s.listSequences)
+	r.Get("/sequences/{name}", s.getSequence)
+	r.Post("/sequences", auth.MustRole("org_admin")(http.HandlerFunc(s.createSequence)).(http.HandlerFunc))
+	r.Put("/sequences/{name}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateSequence)).(http.HandlerFunc))
+	r.Delete("/sequences/{name}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteSequence)).(http.HandlerFunc))
+	r.Post("/sequences/{name}/next", auth.MustPermission(auth.PermAssetsWrite)(http.HandlerFunc(s.nextSequence)).(http.HandlerFunc))
+
+	// Org branding (display name and logo for generated documents)
+	r.Get("/org/branding", s.getBranding)
+	r.Put("/org/branding", auth.MustRole("org_admin")(http.HandlerFunc(s.updateBranding)).(http.HandlerFunc))
+	r.Get("/org/branding/logo", s.getLogo)
+	r.Put("/org/branding/logo", auth.MustRole("org_admin")(http.HandlerFunc(s.uploadLogo)).(http.HandlerFunc))
+	r.Delete("/org/branding/logo", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteLogo)).(http.HandlerFunc))
+	r.Get("/org/retention", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getRetention)).(http.HandlerFunc))
+	r.Put("/org/retention", auth.MustRole("org_admin")(http.HandlerFunc(s.updateRetention)).(http.HandlerFunc))
+	r.Get("/org/usage", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getOrgUsage)).(http.HandlerFunc))
+
+	// Recycle bin for soft-deleted items, sites, vendors and projects
+	r.Get("/trash", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listTrash)).(http.HandlerFunc))
+	r.Post("/trash/{type}/{id}/restore", auth.MustRole("org_admin")(http.HandlerFunc(s.restoreTrash)).(http.HandlerFunc))
+
+	// Reconciliation against an external asset list; compares, never writes
+	r.Post("/reconcile", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.reconcile)).(http.HandlerFunc))
+
+	// Exports - asynchronous, polled via the returned job
+	r.Post("/exports", s.createExport)
+	r.Post("/exports/servicenow", s.createServiceNowExport)
+	r.Get("/exports/{id}", s.getExport)
+
+	// Filters, sort keys and limits of the list endpoints, for client builders
+	r.Get("/meta/resources", s.getResourceMeta)
+
+	// Landing page summary, activity feed and reports
+	r.Get("/dashboard", s.getDashboard)
+	r.Get("/changes", s.listChanges)
+	// reports scan whole tables: one org gets a few at a time (reportGate)
+	r.Get("/reports/aging", s.getAgingReport)
+	r.Get("/reports/warranty-expiring", s.getWarrantyExpiringReport)
+
+	// Per-user site grants (restrict contractors to their sites)
+	r.Get("/users/{id}/sites", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listUserSites)).(http.HandlerFunc))
+	r.Put("/users/{id}/sites", auth.MustRole("org_admin")(http.HandlerFunc(s.replaceUserSites)).(http.HandlerFunc))
+	r.Get("/users/{id}/projects", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listUserProjects)).(http.HandlerFunc))
+	r.Put("/users/{id}/projects", auth.MustRole("org_admin")(http.HandlerFunc(s.replaceUserProjects)).(http.HandlerFunc))
+
+	// Data integrity report and repairs for the caller's organization
+	r.Get("/admin/integrity", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getIntegrity)).(http.HandlerFunc))
+	r.Post("/admin/integrity/repair", auth.MustRole("org_admin")(http.HandlerFunc(s.repairIntegrity)).(http.HandlerFunc))
+
+	// Mail send log and dead letters
+	r.Get("/admin/emails", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listEmails)).(http.HandlerFunc))
+	r.Post("/admin/emails/test", auth.MustRole("org_admin")(http.HandlerFunc(s.sendTestEmail)).(http.HandlerFunc))
+	r.Post("/admin/emails/{id}/retry", auth.MustRole("org_admin")(http.HandlerFunc(s.retryEmail)).(http.HandlerFunc))
+
+	// Main tenant operators' requests in other orgs (X-Org-Context)
+	r.Get("/admin/access-log", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getAccessLog)).(http.HandlerFunc))
+
+	// Slowest statements from pg_stat_statements, for main tenant operators
+	if s.TopQueries {
+		r.Get("/admin/db/top-queries", auth.MustRole("org_admin")(http.HandlerFunc(s.getTopQueries)).(http.HandlerFunc))
+	}
+
+	// Self-signup approval queue, for main tenant operators
+	if s.Signup {
+		r.Get("/organizations/pending", auth.MustRole("org_admin")(http.HandlerFunc(s.listPendingOrgs)).(http.HandlerFunc))
+		r.Post("/organizations/{id}/approve", auth.MustRole("org_admin")(http.HandlerFunc(s.approveOrg)).(http.HandlerFunc))
+	}
+	// Per-org limits, set by main tenant operators
+	r.Put("/organizations/{id}/limits", auth.MustRole("org_admin")(http.HandlerFunc(s.setOrgLimits)).(http.HandlerFunc))
+
+	// Archived (cold) items
+	r.Get("/archive", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listArchive)).(http.HandlerFunc))
+	r.Get("/archive/{id}", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getArchivedItem)).(http.HandlerFunc))
+	r.Post("/archive/{id}/restore", auth.MustRole("org_admin")(http.HandlerFunc(s.restoreArchivedItem)).(http.HandlerFunc))
+	r.Post("/admin/archive", auth.MustRole("org_admin")(http.HandlerFunc(s.runArchive)).(http.HandlerFunc))
+
+	// Racks and rack elevations
+	r.Get("/racks", s.listRacks)
+	r.Post("/racks", auth.MustRole("org_admin")(http.HandlerFunc(s.createRack)).(http.HandlerFunc))
+	r.Get("/racks/{id}", s.getRack)
+	r.Put("/racks/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateRack)).(http.HandlerFunc))
+	r.Delete("/racks/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteRack)).(http.HandlerFunc))
+	r.Get("/racks/{id}/elevation", s.getRackElevation)
+
+	// IP address management
+	r.Get("/subnets", s.listSubnets)
+	r.Get("/subnets/lookup", s.lookupIP)
+	r.Get("/subnets/{id}", s.getSubnet)
+	r.Post("/subnets", auth.MustRole("org_admin")(http.HandlerFunc(s.createSubnet)).(http.HandlerFunc))
+	r.Put("/subnets/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateSubnet)).(http.HandlerFunc))
+	r.Delete("/subnets/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteSubnet)).(http.HandlerFunc))
+	r.Get("/subnets/{id}/ips", s.listSubnetIPs)
+	r.Post("/subnets/{id}/ips", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.reserveIP)).(http.HandlerFunc))
+	r.Delete("/subnets/{id}/ips/{ipID}", auth.MustRole("org_admin", "project_admin")(http.HandlerFunc(s.releaseIP)).(http.HandlerFunc))
+
+	// Webhooks and their delivery logs
+	r.Get("/webhooks", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listWebhooks)).(http.HandlerFunc))
+	r.Post("/webhooks", auth.MustRole("org_admin")(http.HandlerFunc(s.createWebhook)).(http.HandlerFunc))
+	r.Get("/webhooks/{id}", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getWebhook)).(http.HandlerFunc))
+	r.Put("/webhooks/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.updateWebhook)).(http.HandlerFunc))
+	r.Delete("/webhooks/{id}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteWebhook)).(http.HandlerFunc))
+	r.Get("/webhooks/{id}/deliveries", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listWebhookDeliveries)).(http.HandlerFunc))
+	r.Post("/webhooks/{id}/deliveries/{deliveryID}/retry", auth.MustRole("org_admin")(http.HandlerFunc(s.retryWebhookDelivery)).(http.HandlerFunc))
+
+	// Email templates
+	r.Get("/email-templates", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.listEmailTemplates)).(http.HandlerFunc))
+	r.Get("/email-templates/{key}", auth.MustRole("org_admin", "auditor")(http.HandlerFunc(s.getEmailTemplate)).(http.HandlerFunc))
+	r.Put("/email-templates/{key}", auth.MustRole("org_admin")(http.HandlerFunc(s.putEmailTemplate)).(http.HandlerFunc))
+	r.Delete("/email-templates/{key}", auth.MustRole("org_admin")(http.HandlerFunc(s.deleteEmailTemplate)).(http.HandlerFunc))
+	r.Post("/email-templates/{key}/preview", auth.MustRole("org_admin")(http.HandlerFunc(s.previewEmailTemplate)).(http.HandlerFunc))
 }
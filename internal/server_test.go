@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/health"
+	"era-inventory-api/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// publicRoutes are the only routes reachable without a JWT
+var publicRoutes = map[string]bool{
+	"GET /health":                true,
+	"GET /healthz":               true,
+	"GET /readyz":                true,
+	"GET /dbping":                true,
+	"GET /version":               true,
+	"GET /.well-known/jwks.json":  true,
+	"GET /status.json":            true,
+	"GET /exports/{id}/download": true, // authenticated by the URL signature
+	"POST /auth/refresh":         true, // authenticated by the refresh token
+	"POST /auth/refresh/revoke":  true,
+}
+
+func newRoutedServer() *Server {
+	s := &Server{
+		Router:     chi.NewRouter(),
+		JWTManager: auth.NewJWTManager("supersecretkeyforunittestingonly!", "era-inventory-api", "era-inventory-api", time.Hour),
+		Metrics:    NewMetrics(),
+		Health:     health.NewRegistry(time.Second),
+	}
+	s.mountRoutes(&config.Config{RefreshTokenTTL: 24 * time.Hour})
+	return s
+}
+
+// Every route other than the public ones must reject anonymous requests, and
+// the legacy X-Org-ID header must not stand in for a token.
+func TestRoutesRequireAuthentication(t *testing.T) {
+	s := newRoutedServer()
+
+	var checked int
+	err := chi.Walk(s.Router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if publicRoutes[method+" "+route] {
+			return nil
+		}
+		checked++
+		path := strings.NewReplacer("{id}", "1", "{configID}", "1", "{type}", "item").Replace(route)
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("X-Org-ID", "2")
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token = %d, want 401", method, route, w.Code)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatal("no protected routes mounted")
+	}
+}
+
+func TestItemRoutesMountedOnce(t *testing.T) {
+	s := newRoutedServer()
+
+	seen := map[string]int{}
+	_ = chi.Walk(s.Router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		seen[method+" "+route]++
+		return nil
+	})
+	for _, route := range []string{"GET /items", "POST /items", "GET /items/{id}", "PUT /items/{id}", "DELETE /items/{id}"} {
+		if seen[route] != 1 {
+			t.Errorf("%s mounted %d times, want 1", route, seen[route])
+		}
+	}
+}
+
+// Every response carries a request ID, and error bodies repeat it
+func TestRequestIDOnResponsesAndErrors(t *testing.T) {
+	s := newRoutedServer()
+
+	w := httptest.NewRecorder()
+	s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Error("GET /health has no X-Request-ID")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r.Header.Set("X-Request-ID", "client-abc123")
+	w = httptest.NewRecorder()
+	s.Router.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /items without a token = %d, want 401", w.Code)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "client-abc123" {
+		t.Errorf("X-Request-ID = %q, want the client's", got)
+	}
+	var body problem.Details
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID != "client-abc123" {
+		t.Errorf("problem request_id = %q, want client-abc123", body.RequestID)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to scan for
+const apiKeyPrefix = "era_"
+
+// ErrAPIKeyIssuer means an API key asked to issue another API key
+var ErrAPIKeyIssuer = errors.New("API keys cannot issue API keys; use a bearer token")
+
+// APIKeys issues and revokes API keys and authenticates requests that
+// present one. A key acts for the org it was issued in with its own roles,
+// which may grant no more than its issuer held.
+type APIKeys struct {
+	repo  repo.APIKeyRepo
+	roles *auth.RoleRegistry
+}
+
+// NewAPIKeys returns the API key service; roles resolves custom role names
+func NewAPIKeys(r repo.APIKeyRepo, roles *auth.RoleRegistry) *APIKeys {
+	return &APIKeys{repo: r, roles: roles}
+}
+
+// Create issues a key for the holder of issuer and returns it with its
+// secret, which is not stored and cannot be shown again
+func (s *APIKeys) Create(ctx context.Context, issuer *auth.Claims, in models.APIKey) (models.APIKey, string, error) {
+	if issuer.APIKeyID() != 0 {
+		return models.APIKey{}, "", ErrAPIKeyIssuer
+	}
+	if len(issuer.SiteIDs) > 0 {
+		return models.APIKey{}, "", ErrScopedToken
+	}
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || len(in.Name) > 100 {
+		return models.APIKey{}, "", ValidationError("name is required (at most 100 characters)")
+	}
+	if len(in.Roles) == 0 {
+		return models.APIKey{}, "", ValidationError("roles is required")
+	}
+	for _, role := range in.Roles {
+		perms, ok := s.roles.Lookup(issuer.OrgID, role)
+		if !ok {
+			return models.APIKey{}, "", ValidationError("unknown role " + role)
+		}
+		if !issuer.Can(perms...) {
+			return models.APIKey{}, "", fmt.Errorf("%w: role %s", auth.ErrScopeEscalation, role)
+		}
+	}
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(time.Now()) {
+		return models.APIKey{}, "", ValidationError("expires_at must be in the future")
+	}
+
+	raw, hash, err := newAPIKey()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	k, err := s.repo.Create(ctx, hash, models.APIKey{
+		Name:      in.Name,
+		Prefix:    raw[:len(apiKeyPrefix)+8],
+		UserID:    issuer.UserID,
+		OrgID:     issuer.OrgID,
+		Roles:     in.Roles,
+		ExpiresAt: in.ExpiresAt,
+	})
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	return k, raw, nil
+}
+
+// Bootstrap issues the first key of a newly approved org. It has org_admin
+// and belongs to no user (user 0), as the org has no one yet to issue it;
+// like every key, it cannot start a session (Sessions.Start).
+func (s *APIKeys) Bootstrap(ctx context.Context, orgID int64, name string) (models.APIKey, string, error) {
+	raw, hash, err := newAPIKey()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	k, err := s.repo.Create(ctx, hash, models.APIKey{
+		Name:   name,
+		Prefix: raw[:len(apiKeyPrefix)+8],
+		OrgID:  orgID,
+		Roles:  []string{"org_admin"},
+	})
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	return k, raw, nil
+}
+
+// List returns the org's keys without their secrets
+func (s *APIKeys) List(ctx context.Context, orgID int64) ([]models.APIKey, error) {
+	return s.repo.List(ctx, orgID)
+}
+
+// Revoke stops a key from authenticating, immediately
+func (s *APIKeys) Revoke(ctx context.Context, orgID, id int64) error {
+	return s.repo.Revoke(ctx, orgID, id)
+}
+
+// ValidateAPIKey implements auth.APIKeyValidator
+func (s *APIKeys) ValidateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	k, err := s.repo.GetByHash(ctx, hashRefreshToken(key))
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.RevokedAt != nil || (k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt)) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err := s.repo.Touch(ctx, k.ID); err != nil {
+		return nil, err
+	}
+	return auth.NewAPIKeyClaims(k.ID, k.UserID, k.OrgID, k.Roles, k.ExpiresAt), nil
+}
+
+// newAPIKey returns a random key and the hash it is stored under, which is
+// computed like a refresh token's
+func newAPIKey() (raw, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashRefreshToken(raw), nil
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// Items manages an org's inventory items
+type Items struct {
+	repo   repo.ItemRepo
+	access ItemAccess
+}
+
+// ItemAccess looks up the caller's site and project grants, which ctx
+// identifies, for the checks of item writes
+type ItemAccess interface {
+	// CanUseSite reports whether the caller may place items at the named site
+	CanUseSite(ctx context.Context, site string) (bool, error)
+	// CanUseProject reports whether projectID is a live project of the
+	// caller's org and whether the caller may place items in it
+	CanUseProject(ctx context.Context, projectID int64) (exists, member bool, err error)
+	// ProjectRestricted reports whether the caller only manages the items of
+	// the projects they are a member of
+	ProjectRestricted(ctx context.Context) bool
+}
+
+// NewItems returns the item service backed by r; writes are checked against
+// the grants access reports
+func NewItems(r repo.ItemRepo, access ItemAccess) *Items {
+	return &Items{repo: r, access: access}
+}
+
+// ContainsError refuses to delete an item that contains others unless the
+// delete cascades; it is the number of contained items
+type ContainsError int
+
+func (e ContainsError) Error() string {
+	return fmt.Sprintf("item contains %d other items; move or delete them first, or pass cascade=true", int(e))
+}
+
+// ValidItemStatus reports whether status is part of the item lifecycle vocabulary
+func ValidItemStatus(status string) bool {
+	for _, st := range models.ItemStatuses {
+		if st == status {
+			return true
+		}
+	}
+	return false
+}
+
+// errItemStatus rejects a status outside models.ItemStatuses
+var errItemStatus = ValidationError("status must be one of: " + strings.Join(models.ItemStatuses, ", "))
+
+func (s *Items) List(ctx context.Context, orgID int64, f repo.ItemFilter, opts repo.ItemListOptions, scope repo.Scope) (repo.ItemPage, error) {
+	return s.repo.List(ctx, orgID, f, opts, scope)
+}
+
+func (s *Items) Get(ctx context.Context, orgID, id int64, scope repo.Scope) (models.Item, error) {
+	return s.repo.Get(ctx, orgID, id, scope)
+}
+
+// Create adds an item. It needs an asset tag and a name, and its status
+// defaults to active. The caller must have access to its site, and its
+// project must be one of the org's; project admins must name one of theirs.
+func (s *Items) Create(ctx context.Context, orgID int64, in models.Item, details repo.DetailsStep) (models.Item, error) {
+	if in.AssetTag == "" || in.Name == "" {
+		return models.Item{}, ValidationError("asset_tag and name are required")
+	}
+	if in.Status == "" {
+		in.Status = models.ItemActive
+	} else if !ValidItemStatus(in.Status) {
+		return models.Item{}, errItemStatus
+	}
+	if err := CheckItemCoverage(in); err != nil {
+		return models.Item{}, err
+	}
+	if err := s.checkSite(ctx, in.Site); err != nil {
+		return models.Item{}, err
+	}
+	if err := CheckItemProject(ctx, s.access, in.ProjectID); err != nil {
+		return models.Item{}, err
+	}
+	out, err := s.repo.Create(ctx, orgID, in, details)
+	return out, itemWriteErr(err)
+}
+
+// ItemUpdate is a partial update of an item: the fields of Item left zero
+// are unchanged, except for the rack fields, which replace the stored
+// placement when Placed is set
+type ItemUpdate struct {
+	models.Item
+	Placed bool
+	// Details stores the item's device details along with the update
+	Details repo.DetailsStep
+}
+
+// Update applies a partial update. Blank strings are ignored, except that a
+// blank support contract or level clears it. Moving the item to another site
+// or project is checked as in Create; it only changes items in scope.
+func (s *Items) Update(ctx context.Context, orgID, id int64, in ItemUpdate, scope repo.Scope) (models.Item, error) {
+	p := repo.ItemPatch{
+		AssetTag:        nonBlank(in.AssetTag),
+		Name:            nonBlank(in.Name),
+		Manufacturer:    nonBlank(in.Manufacturer),
+		Model:           nonBlank(in.Model),
+		DeviceType:      nonBlank(in.DeviceType),
+		Site:            nonBlank(in.Site),
+		Notes:           nonBlank(in.Notes),
+		Status:          nonBlank(in.Status),
+		InstalledAt:     in.InstalledAt,
+		WarrantyStart:   in.WarrantyStart,
+		WarrantyEnd:     in.WarrantyEnd,
+		SupportEnd:      in.SupportEnd,
+		SupportContract: in.SupportContract,
+		SupportLevel:    in.SupportLevel,
+		ProjectID:       in.ProjectID,
+		CustomFields:    in.CustomFields,
+		Details:         in.Details,
+	}
+	if in.Placed {
+		p.Rack = &repo.ItemPlacement{RackID: in.RackID, Position: in.RackPosition, Units: in.RackUnits}
+	}
+	if p.Empty() {
+		return models.Item{}, ValidationError("no fields to update")
+	}
+	if err := CheckItemCoverage(in.Item); err != nil {
+		return models.Item{}, err
+	}
+	if p.Status != nil && !ValidItemStatus(*p.Status) {
+		return models.Item{}, errItemStatus
+	}
+	// moving an item to another project; restricted callers only between theirs
+	if p.ProjectID != nil {
+		if err := CheckItemProject(ctx, s.access, p.ProjectID); err != nil {
+			return models.Item{}, err
+		}
+	}
+	if p.Site != nil {
+		if err := s.checkSite(ctx, *p.Site); err != nil {
+			return models.Item{}, err
+		}
+	}
+	out, err := s.repo.Update(ctx, orgID, id, p, scope)
+	return out, itemWriteErr(err)
+}
+
+// Delete moves an item to the trash. An item that contains others is only
+// deleted with cascade, which trashes everything it contains along with it.
+func (s *Items) Delete(ctx context.Context, orgID, id int64, cascade bool, scope repo.Scope) error {
+	n, err := s.repo.Contained(ctx, orgID, id, scope)
+	if err != nil {
+		return err
+	}
+	if n > 0 && !cascade {
+		return ContainsError(n)
+	}
+	return s.repo.Delete(ctx, orgID, id, n > 0, scope)
+}
+
+// CheckItemCoverage checks the coverage dates of a write body
+func CheckItemCoverage(in models.Item) error {
+	if in.WarrantyStart != nil && in.WarrantyEnd != nil && in.WarrantyStart.After(*in.WarrantyEnd) {
+		return ValidationError(repo.ErrWarrantyRange.Error())
+	}
+	return nil
+}
+
+// CheckItemProject checks the project_id of an item write: it must name a
+// project of the org, and restricted callers must name one of theirs, as
+// items outside their projects would be out of their reach
+func CheckItemProject(ctx context.Context, access ItemAccess, projectID *int64) error {
+	if projectID == nil {
+		if access.ProjectRestricted(ctx) {
+			return ForbiddenError{"PROJECT_FORBIDDEN", "project_id is required: project admins only manage items of their projects"}
+		}
+		return nil
+	}
+	exists, member, err := access.CanUseProject(ctx, *projectID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ValidationError("project_id names an unknown project")
+	}
+	if !member {
+		return ForbiddenError{"PROJECT_FORBIDDEN", fmt.Sprintf("you are not a member of project %d", *projectID)}
+	}
+	return nil
+}
+
+// checkSite refuses to place items at a site the caller has no access to
+func (s *Items) checkSite(ctx context.Context, site string) error {
+	ok, err := s.access.CanUseSite(ctx, site)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ForbiddenError{"SITE_FORBIDDEN", "you do not have access to site " + strconv.Quote(site)}
+	}
+	return nil
+}
+
+// itemWriteErr names the key and check behind a refused item write
+func itemWriteErr(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrConflict):
+		return ConflictError("asset_tag already exists")
+	case errors.Is(err, repo.ErrWarrantyRange):
+		return ValidationError(err.Error())
+	}
+	return err
+}
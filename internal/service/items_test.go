@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// itemStub contains a fixed number of items and records writes
+type itemStub struct {
+	repo.ItemRepo
+	contained int
+	deleted   bool
+	cascade   bool
+	created   *models.Item
+	patch     *repo.ItemPatch
+	err       error
+}
+
+func (s *itemStub) Create(_ context.Context, _ int64, in models.Item, _ repo.DetailsStep) (models.Item, error) {
+	s.created = &in
+	return in, s.err
+}
+
+func (s *itemStub) Update(_ context.Context, _, id int64, p repo.ItemPatch, _ repo.Scope) (models.Item, error) {
+	s.patch = &p
+	return models.Item{ID: int(id)}, s.err
+}
+
+func (s *itemStub) Contained(context.Context, int64, int64, repo.Scope) (int, error) {
+	return s.contained, nil
+}
+
+func (s *itemStub) Delete(_ context.Context, _, _ int64, cascade bool, _ repo.Scope) error {
+	s.deleted, s.cascade = true, cascade
+	return nil
+}
+
+func TestItemsDeleteContainer(t *testing.T) {
+	stub := &itemStub{contained: 2}
+	svc := NewItems(stub, nil)
+
+	err := svc.Delete(context.Background(), 1, 5, false, nil)
+	var contains ContainsError
+	if !errors.As(err, &contains) || contains != 2 {
+		t.Fatalf("err = %v, want ContainsError(2)", err)
+	}
+	if stub.deleted {
+		t.Fatal("container was deleted without cascade")
+	}
+
+	if err := svc.Delete(context.Background(), 1, 5, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !stub.deleted || !stub.cascade {
+		t.Errorf("deleted = %v, cascade = %v; want a cascading delete", stub.deleted, stub.cascade)
+	}
+}
+
+func TestItemsDeleteLeafDoesNotCascade(t *testing.T) {
+	stub := &itemStub{}
+	if err := NewItems(stub, nil).Delete(context.Background(), 1, 5, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !stub.deleted || stub.cascade {
+		t.Errorf("deleted = %v, cascade = %v; want a plain delete", stub.deleted, stub.cascade)
+	}
+}
+
+// accessStub grants the sites in sites and the projects in projects, which
+// maps each known project to whether the caller is a member
+type accessStub struct {
+	sites      map[string]bool
+	projects   map[int64]bool
+	restricted bool
+}
+
+func (a accessStub) CanUseSite(_ context.Context, site string) (bool, error) {
+	return a.sites[site], nil
+}
+
+func (a accessStub) CanUseProject(_ context.Context, id int64) (bool, bool, error) {
+	member, ok := a.projects[id]
+	return ok, member, nil
+}
+
+func (a accessStub) ProjectRestricted(context.Context) bool { return a.restricted }
+
+// forbidden reports whether err is a ForbiddenError with code
+func forbidden(err error, code string) bool {
+	var f ForbiddenError
+	return errors.As(err, &f) && f.Code == code
+}
+
+func TestItemsCreate(t *testing.T) {
+	stub := &itemStub{}
+	svc := NewItems(stub, accessStub{sites: map[string]bool{"HQ": true}})
+
+	var invalid ValidationError
+	if _, err := svc.Create(context.Background(), 1, models.Item{Name: "Switch", Site: "HQ"}, nil); !errors.As(err, &invalid) {
+		t.Errorf("no asset_tag: err = %v, want a ValidationError", err)
+	}
+	if _, err := svc.Create(context.Background(), 1, models.Item{AssetTag: "A-1", Name: "Switch", Site: "HQ", Status: "lost"}, nil); !errors.As(err, &invalid) {
+		t.Errorf("unknown status: err = %v, want a ValidationError", err)
+	}
+	if stub.created != nil {
+		t.Fatal("an invalid item reached the repository")
+	}
+
+	if _, err := svc.Create(context.Background(), 1, models.Item{AssetTag: "A-1", Name: "Switch", Site: "HQ"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.created == nil || stub.created.Status != models.ItemActive {
+		t.Errorf("created %+v, want status %s", stub.created, models.ItemActive)
+	}
+
+	stub.err = repo.ErrConflict
+	var conflict ConflictError
+	if _, err := svc.Create(context.Background(), 1, models.Item{AssetTag: "A-1", Name: "Switch", Site: "HQ"}, nil); !errors.As(err, &conflict) {
+		t.Errorf("taken asset_tag: err = %v, want a ConflictError", err)
+	}
+	stub.err = repo.ErrWarrantyRange
+	if _, err := svc.Create(context.Background(), 1, models.Item{AssetTag: "A-2", Name: "Switch", Site: "HQ"}, nil); !errors.As(err, &invalid) {
+		t.Errorf("warranty range: err = %v, want a ValidationError", err)
+	}
+}
+
+func TestItemsCreateChecksGrants(t *testing.T) {
+	one, two, three := int64(1), int64(2), int64(3)
+	access := accessStub{
+		sites:      map[string]bool{"HQ": true},
+		projects:   map[int64]bool{1: true, 2: false},
+		restricted: true,
+	}
+	for _, tc := range []struct {
+		name  string
+		item  models.Item
+		check func(error) bool
+	}{
+		{"site without access", models.Item{Site: "Annex", ProjectID: &one},
+			func(err error) bool { return forbidden(err, "SITE_FORBIDDEN") }},
+		{"project admin without project", models.Item{Site: "HQ"},
+			func(err error) bool { return forbidden(err, "PROJECT_FORBIDDEN") }},
+		{"unknown project", models.Item{Site: "HQ", ProjectID: &three},
+			func(err error) bool { var v ValidationError; return errors.As(err, &v) }},
+		{"project of others", models.Item{Site: "HQ", ProjectID: &two},
+			func(err error) bool { return forbidden(err, "PROJECT_FORBIDDEN") }},
+		{"own project", models.Item{Site: "HQ", ProjectID: &one},
+			func(err error) bool { return err == nil }},
+	} {
+		stub := &itemStub{}
+		tc.item.AssetTag, tc.item.Name = "A-1", "Switch"
+		_, err := NewItems(stub, access).Create(context.Background(), 1, tc.item, nil)
+		if !tc.check(err) {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+		if (stub.created != nil) != (err == nil) {
+			t.Errorf("%s: created = %v with err %v", tc.name, stub.created != nil, err)
+		}
+	}
+}
+
+func TestItemsUpdatePatch(t *testing.T) {
+	stub := &itemStub{}
+	svc := NewItems(stub, accessStub{sites: map[string]bool{"HQ": true}})
+
+	blank, rack, pos := "", int64(4), 10
+	_, err := svc.Update(context.Background(), 1, 5, ItemUpdate{
+		Item:   models.Item{Name: "  ", Site: "HQ", SupportContract: &blank, RackID: &rack, RackPosition: &pos},
+		Placed: true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := stub.patch
+	switch {
+	case p.Name != nil:
+		t.Errorf("blank name is written: %q", *p.Name)
+	case p.Site == nil || *p.Site != "HQ":
+		t.Errorf("site = %v, want HQ", p.Site)
+	case p.SupportContract == nil || *p.SupportContract != "":
+		t.Errorf("support_contract = %v, want cleared", p.SupportContract)
+	case p.Rack == nil || p.Rack.RackID != &rack || p.Rack.Units != nil:
+		t.Errorf("rack = %+v, want rack 4 at 10", p.Rack)
+	}
+
+	// rack fields without Placed were not resolved and are left alone
+	stub.patch = nil
+	if _, err := svc.Update(context.Background(), 1, 5, ItemUpdate{Item: models.Item{RackID: &rack}}, nil); err == nil || stub.patch != nil {
+		t.Errorf("unresolved rack fields: err = %v, patch %+v", err, stub.patch)
+	}
+}
+
+func TestItemsUpdateChecks(t *testing.T) {
+	two := int64(2)
+	svc := NewItems(&itemStub{}, accessStub{sites: map[string]bool{"HQ": true}, projects: map[int64]bool{2: false}, restricted: true})
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dec := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+
+	var invalid ValidationError
+	for name, in := range map[string]models.Item{
+		"nothing":        {},
+		"unknown status": {Status: "lost"},
+		"warranty range": {WarrantyStart: &dec, WarrantyEnd: &jan},
+	} {
+		if _, err := svc.Update(context.Background(), 1, 5, ItemUpdate{Item: in}, nil); !errors.As(err, &invalid) {
+			t.Errorf("%s: err = %v, want a ValidationError", name, err)
+		}
+	}
+	if _, err := svc.Update(context.Background(), 1, 5, ItemUpdate{Item: models.Item{Site: "Annex"}}, nil); !forbidden(err, "SITE_FORBIDDEN") {
+		t.Errorf("move to a site without access: err = %v", err)
+	}
+	if _, err := svc.Update(context.Background(), 1, 5, ItemUpdate{Item: models.Item{ProjectID: &two}}, nil); !forbidden(err, "PROJECT_FORBIDDEN") {
+		t.Errorf("move to a project of others: err = %v", err)
+	}
+	// unlike creates, updates that leave the project alone need none
+	if _, err := svc.Update(context.Background(), 1, 5, ItemUpdate{Item: models.Item{Name: "Router"}}, nil); err != nil {
+		t.Errorf("rename by a project admin: %v", err)
+	}
+}
+
+func TestCheckItemCoverage(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dec := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		start, end *time.Time
+		ok         bool
+	}{
+		{nil, nil, true},
+		{&jan, nil, true},
+		{nil, &dec, true},
+		{&jan, &dec, true},
+		{&jan, &jan, true},
+		{&dec, &jan, false},
+	} {
+		err := CheckItemCoverage(models.Item{WarrantyStart: tc.start, WarrantyEnd: tc.end})
+		if (err == nil) != tc.ok {
+			t.Errorf("start %v end %v: err = %v", tc.start, tc.end, err)
+		}
+	}
+}
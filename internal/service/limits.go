@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// QuotaError is a write refused because it would take the org past one of
+// its limits; its message is safe to show clients
+type QuotaError struct {
+	Limit string
+	Max   int
+}
+
+func (e QuotaError) Error() string {
+	return fmt.Sprintf("the organization's %s limit of %d would be exceeded", e.Limit, e.Max)
+}
+
+// Limits enforces the per-org limits set by the main tenant. Orgs without
+// an organization record, known only from their tokens, are unlimited.
+type Limits struct {
+	repo repo.OrgLimitRepo
+}
+
+// NewLimits returns the limit service backed by r
+func NewLimits(r repo.OrgLimitRepo) *Limits {
+	return &Limits{repo: r}
+}
+
+// get is the org's limits, none when the org has no record
+func (s *Limits) get(ctx context.Context, orgID int64) (models.OrgLimits, error) {
+	l, err := s.repo.Get(ctx, orgID)
+	if errors.Is(err, repo.ErrNotFound) {
+		return models.OrgLimits{}, nil
+	}
+	return l, err
+}
+
+// Usage is the org's limits and its current item count
+func (s *Limits) Usage(ctx context.Context, orgID int64) (models.OrgUsage, error) {
+	l, err := s.get(ctx, orgID)
+	if err != nil {
+		return models.OrgUsage{}, err
+	}
+	n, err := s.repo.CountItems(ctx, orgID)
+	if err != nil {
+		return models.OrgUsage{}, err
+	}
+	return models.OrgUsage{Limits: l, Items: n}, nil
+}
+
+// Set replaces the org's limits. Lowering max_items below the current count
+// is allowed; the org then cannot add items until it is back under.
+func (s *Limits) Set(ctx context.Context, orgID int64, l models.OrgLimits) (models.OrgLimits, error) {
+	if l.MaxItems != nil && *l.MaxItems < 0 {
+		return models.OrgLimits{}, ValidationError("max_items must not be negative")
+	}
+	if l.MaxImportRows != nil && *l.MaxImportRows < 1 {
+		return models.OrgLimits{}, ValidationError("max_import_rows must be positive")
+	}
+	return s.repo.Set(ctx, orgID, l)
+}
+
+// CheckItems returns a QuotaError unless the org has room for n more items.
+// The count is not locked, so concurrent writes may overshoot the limit by a
+// few items.
+func (s *Limits) CheckItems(ctx context.Context, orgID int64, n int) error {
+	l, err := s.get(ctx, orgID)
+	if err != nil || l.MaxItems == nil {
+		return err
+	}
+	count, err := s.repo.CountItems(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if count+n > *l.MaxItems {
+		return QuotaError{Limit: "max_items", Max: *l.MaxItems}
+	}
+	return nil
+}
+
+// CheckImportRows returns a QuotaError when an import of rows rows is larger
+// than the org allows
+func (s *Limits) CheckImportRows(ctx context.Context, orgID int64, rows int) error {
+	l, err := s.get(ctx, orgID)
+	if err != nil || l.MaxImportRows == nil {
+		return err
+	}
+	if rows > *l.MaxImportRows {
+		return QuotaError{Limit: "max_import_rows", Max: *l.MaxImportRows}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+	"era-inventory-api/internal/testutil"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestLimitsCheckItems(t *testing.T) {
+	ctx := context.Background()
+	mem := testutil.NewMemOrgLimits()
+	limits := NewLimits(mem)
+	mem.SetItems(1, 9)
+
+	if err := limits.CheckItems(ctx, 1, 100); err != nil {
+		t.Errorf("unlimited org: %v", err)
+	}
+	if _, err := limits.Set(ctx, 1, models.OrgLimits{MaxItems: intPtr(10)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := limits.CheckItems(ctx, 1, 1); err != nil {
+		t.Errorf("the last item: %v", err)
+	}
+	var quota QuotaError
+	if err := limits.CheckItems(ctx, 1, 2); !errors.As(err, &quota) || quota.Limit != "max_items" || quota.Max != 10 {
+		t.Errorf("over the limit: err = %v", err)
+	}
+	if err := limits.CheckItems(ctx, 2, 100); err != nil {
+		t.Errorf("another org: %v", err)
+	}
+
+	usage, err := limits.Usage(ctx, 1)
+	if err != nil || usage.Items != 9 || usage.Limits.MaxItems == nil || *usage.Limits.MaxItems != 10 {
+		t.Errorf("usage = %+v, %v", usage, err)
+	}
+}
+
+func TestLimitsCheckImportRows(t *testing.T) {
+	ctx := context.Background()
+	limits := NewLimits(testutil.NewMemOrgLimits())
+	if _, err := limits.Set(ctx, 1, models.OrgLimits{MaxImportRows: intPtr(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := limits.CheckImportRows(ctx, 1, 100); err != nil {
+		t.Errorf("100 rows: %v", err)
+	}
+	var quota QuotaError
+	if err := limits.CheckImportRows(ctx, 1, 101); !errors.As(err, &quota) || quota.Limit != "max_import_rows" {
+		t.Errorf("101 rows: err = %v", err)
+	}
+}
+
+func TestLimitsSetValidates(t *testing.T) {
+	limits := NewLimits(testutil.NewMemOrgLimits())
+	for _, in := range []models.OrgLimits{
+		{MaxItems: intPtr(-1)},
+		{MaxImportRows: intPtr(0)},
+	} {
+		var invalid ValidationError
+		if _, err := limits.Set(context.Background(), 1, in); !errors.As(err, &invalid) {
+			t.Errorf("%+v: err = %v, want a validation error", in, err)
+		}
+	}
+}
+
+// missingOrg is the repository of an org that has no organization record
+type missingOrg struct {
+	repo.OrgLimitRepo
+}
+
+func (missingOrg) Get(context.Context, int64) (models.OrgLimits, error) {
+	return models.OrgLimits{}, repo.ErrNotFound
+}
+
+func TestLimitsUnknownOrgIsUnlimited(t *testing.T) {
+	if err := NewLimits(missingOrg{}).CheckImportRows(context.Background(), 7, 1_000_000); err != nil {
+		t.Errorf("err = %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// roleNamePattern is the shape of a custom role name, as enforced by the table
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// Roles manages an org's custom roles and keeps the registry the JWTManager
+// resolves permissions from in step with every write
+type Roles struct {
+	repo     repo.RoleRepo
+	registry *auth.RoleRegistry
+}
+
+// NewRoles returns the role service backed by r, updating registry
+func NewRoles(r repo.RoleRepo, registry *auth.RoleRegistry) *Roles {
+	return &Roles{repo: r, registry: registry}
+}
+
+// List returns the built-in roles followed by the org's custom roles, each by name
+func (s *Roles) List(ctx context.Context, orgID int64) ([]models.Role, error) {
+	custom, err := s.repo.List(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(auth.BuiltinRoles))
+	for name := range auth.BuiltinRoles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]models.Role, 0, len(names)+len(custom))
+	for _, name := range names {
+		out = append(out, models.Role{Name: name, Permissions: auth.BuiltinRoles[name], Builtin: true})
+	}
+	return append(out, custom...), nil
+}
+
+func (s *Roles) Get(ctx context.Context, orgID, id int64) (models.Role, error) {
+	return s.repo.Get(ctx, orgID, id)
+}
+
+// Create defines a custom role. The name must not shadow a built-in role and
+// the permissions must be known.
+func (s *Roles) Create(ctx context.Context, orgID int64, in models.Role) (models.Role, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	if !roleNamePattern.MatchString(in.Name) {
+		return models.Role{}, ValidationError("name must be 2-50 characters of a-z, 0-9 and _ starting with a letter")
+	}
+	if _, ok := auth.BuiltinRoles[in.Name]; ok {
+		return models.Role{}, ValidationError("name " + in.Name + " is a built-in role")
+	}
+	perms, err := checkPermissions(in.Permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+	in.Permissions = perms
+	out, err := s.repo.Create(ctx, orgID, in)
+	if err != nil {
+		return models.Role{}, err
+	}
+	s.registry.Set(orgID, out.Name, out.Permissions)
+	return out, nil
+}
+
+// Update replaces a role's description and permissions. Tokens name roles,
+// so a role cannot be renamed; a name in the input must match.
+func (s *Roles) Update(ctx context.Context, orgID, id int64, in models.Role) (models.Role, error) {
+	perms, err := checkPermissions(in.Permissions)
+	if err != nil {
+		return models.Role{}, err
+	}
+	in.Permissions = perms
+	if in.Name != "" {
+		cur, err := s.repo.Get(ctx, orgID, id)
+		if err != nil {
+			return models.Role{}, err
+		}
+		if in.Name != cur.Name {
+			return models.Role{}, ValidationError("name cannot be changed")
+		}
+	}
+	out, err := s.repo.Update(ctx, orgID, id, in)
+	if err != nil {
+		return models.Role{}, err
+	}
+	s.registry.Set(orgID, out.Name, out.Permissions)
+	return out, nil
+}
+
+// Delete removes a custom role; tokens naming it lose its permissions at once
+func (s *Roles) Delete(ctx context.Context, orgID, id int64) error {
+	name, err := s.repo.Delete(ctx, orgID, id)
+	if err != nil {
+		return err
+	}
+	s.registry.Delete(orgID, name)
+	return nil
+}
+
+// Sync reloads the registry from the store, picking up roles written by
+// other instances
+func (s *Roles) Sync(ctx context.Context) error {
+	all, err := s.repo.All(ctx)
+	if err != nil {
+		return err
+	}
+	s.registry.Replace(all)
+	return nil
+}
+
+// checkPermissions requires at least one permission, all known, and returns
+// them without duplicates
+func checkPermissions(perms []string) ([]string, error) {
+	if len(perms) == 0 {
+		return nil, ValidationError("permissions is required")
+	}
+	out := make([]string, 0, len(perms))
+	seen := map[string]bool{}
+	for _, p := range perms {
+		if !auth.ValidPermission(p) {
+			return nil, ValidationError("unknown permission " + p + "; valid: " + strings.Join(auth.Permissions, ", "))
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
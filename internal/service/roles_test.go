@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// roleStub keeps roles in memory
+type roleStub struct {
+	repo.RoleRepo
+	roles map[int64]models.Role
+}
+
+func (s *roleStub) Create(_ context.Context, _ int64, in models.Role) (models.Role, error) {
+	in.ID = int64(len(s.roles) + 1)
+	s.roles[in.ID] = in
+	return in, nil
+}
+
+func (s *roleStub) Get(_ context.Context, _, id int64) (models.Role, error) {
+	if r, ok := s.roles[id]; ok {
+		return r, nil
+	}
+	return models.Role{}, repo.ErrNotFound
+}
+
+func (s *roleStub) Update(_ context.Context, _, id int64, in models.Role) (models.Role, error) {
+	r := s.roles[id]
+	r.Permissions = in.Permissions
+	s.roles[id] = r
+	return r, nil
+}
+
+func (s *roleStub) Delete(_ context.Context, _, id int64) (string, error) {
+	r, ok := s.roles[id]
+	if !ok {
+		return "", repo.ErrNotFound
+	}
+	delete(s.roles, id)
+	return r.Name, nil
+}
+
+func TestRolesCreateValidates(t *testing.T) {
+	s := NewRoles(&roleStub{roles: map[int64]models.Role{}}, auth.NewRoleRegistry())
+	for _, in := range []models.Role{
+		{Name: "org_admin", Permissions: []string{auth.PermAssetsRead}},
+		{Name: "Bad Name", Permissions: []string{auth.PermAssetsRead}},
+		{Name: "clerk"},
+		{Name: "clerk", Permissions: []string{"assets:delete"}},
+	} {
+		var invalid ValidationError
+		if _, err := s.Create(context.Background(), 1, in); !errors.As(err, &invalid) {
+			t.Errorf("Create(%+v) err = %v, want ValidationError", in, err)
+		}
+	}
+}
+
+func TestRolesKeepRegistryInStep(t *testing.T) {
+	ctx := context.Background()
+	registry := auth.NewRoleRegistry()
+	s := NewRoles(&roleStub{roles: map[int64]models.Role{}}, registry)
+	jwt := auth.NewJWTManager("supersecretkeyforunittestingonly!", "era-inventory-api", "era-inventory-api", time.Hour)
+	jwt.SetRoles(registry)
+	token, _ := jwt.GenerateToken(1, 1, []string{"clerk"})
+	can := func(p string) bool {
+		claims, err := jwt.ValidateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims.Can(p)
+	}
+
+	role, err := s.Create(ctx, 1, models.Role{Name: "clerk", Permissions: []string{auth.PermAssetsRead, auth.PermAssetsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(role.Permissions) != 1 || !can(auth.PermAssetsRead) {
+		t.Errorf("created role = %+v", role)
+	}
+	if _, err := s.Update(ctx, 1, role.ID, models.Role{Name: "other", Permissions: []string{auth.PermImportsRun}}); err == nil {
+		t.Error("rename was accepted")
+	}
+	if _, err := s.Update(ctx, 1, role.ID, models.Role{Permissions: []string{auth.PermImportsRun}}); err != nil {
+		t.Fatal(err)
+	}
+	if can(auth.PermAssetsRead) || !can(auth.PermImportsRun) {
+		t.Error("update did not reach the registry")
+	}
+	if err := s.Delete(ctx, 1, role.ID); err != nil {
+		t.Fatal(err)
+	}
+	if can(auth.PermImportsRun) {
+		t.Error("delete did not reach the registry")
+	}
+}
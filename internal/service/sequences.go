@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// Limits of sequence settings and allocations
+const (
+	maxSequencePrefix  = 20
+	maxSequencePadding = 18
+	// MaxSequenceCount is the most numbers one Next call allocates
+	MaxSequenceCount = 1000
+)
+
+// sequenceNamePattern is the shape of a sequence name, as enforced by the table
+var sequenceNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// Sequences hands out org-scoped numbers (asset tags, PO numbers, audit
+// numbers) so clients need not number records themselves. Other services
+// and handlers allocate through Next as well.
+type Sequences struct {
+	repo repo.SequenceRepo
+}
+
+// NewSequences returns the sequence service backed by r
+func NewSequences(r repo.SequenceRepo) *Sequences {
+	return &Sequences{repo: r}
+}
+
+func (s *Sequences) List(ctx context.Context, orgID int64) ([]models.Sequence, error) {
+	return s.repo.List(ctx, orgID)
+}
+
+func (s *Sequences) Get(ctx context.Context, orgID int64, name string) (models.Sequence, error) {
+	return s.repo.Get(ctx, orgID, name)
+}
+
+// Create adds a sequence. LastValue lets an org continue numbering it did
+// elsewhere: the first allocation returns LastValue+1.
+func (s *Sequences) Create(ctx context.Context, orgID int64, in models.Sequence) (models.Sequence, error) {
+	in.Name = strings.TrimSpace(in.Name)
+	if !sequenceNamePattern.MatchString(in.Name) {
+		return models.Sequence{}, ValidationError("name must be 2-50 characters of a-z, 0-9 and _ starting with a letter")
+	}
+	if err := checkSequenceFormat(in.Prefix, in.Padding); err != nil {
+		return models.Sequence{}, err
+	}
+	if in.LastValue < 0 {
+		return models.Sequence{}, ValidationError("last_value must not be negative")
+	}
+	return s.repo.Create(ctx, orgID, in)
+}
+
+// Update changes how values are rendered; the counter itself only moves
+// through Next, so numbers already handed out are never repeated
+func (s *Sequences) Update(ctx context.Context, orgID int64, name string, p repo.SequencePatch) (models.Sequence, error) {
+	if p.Empty() {
+		return models.Sequence{}, ValidationError("no fields to update")
+	}
+	prefix, padding := "", 0
+	if p.Prefix != nil {
+		prefix = *p.Prefix
+	}
+	if p.Padding != nil {
+		padding = *p.Padding
+	}
+	if err := checkSequenceFormat(prefix, padding); err != nil {
+		return models.Sequence{}, err
+	}
+	return s.repo.Update(ctx, orgID, name, p)
+}
+
+func (s *Sequences) Delete(ctx context.Context, orgID int64, name string) error {
+	return s.repo.Delete(ctx, orgID, name)
+}
+
+// Next allocates count consecutive numbers of the named sequence
+func (s *Sequences) Next(ctx context.Context, orgID int64, name string, count int) (models.SequenceValues, error) {
+	if count < 1 || count > MaxSequenceCount {
+		return models.SequenceValues{}, ValidationError(fmt.Sprintf("count must be between 1 and %d", MaxSequenceCount))
+	}
+	seq, err := s.repo.Next(ctx, orgID, name, count)
+	if err != nil {
+		return models.SequenceValues{}, err
+	}
+	out := models.SequenceValues{
+		Sequence: seq.Name,
+		First:    seq.LastValue - int64(count) + 1,
+		Last:     seq.LastValue,
+		Values:   make([]string, 0, count),
+	}
+	for n := out.First; n <= out.Last; n++ {
+		out.Values = append(out.Values, FormatSequence(seq, n))
+	}
+	return out, nil
+}
+
+// FormatSequence renders number n of seq
+func FormatSequence(seq models.Sequence, n int64) string {
+	return fmt.Sprintf("%s%0*d", seq.Prefix, seq.Padding, n)
+}
+
+func checkSequenceFormat(prefix string, padding int) error {
+	if len(prefix) > maxSequencePrefix {
+		return ValidationError(fmt.Sprintf("prefix must be at most %d characters", maxSequencePrefix))
+	}
+	if padding < 0 || padding > maxSequencePadding {
+		return ValidationError(fmt.Sprintf("padding must be between 0 and %d", maxSequencePadding))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// sequenceStub is a single counter, like one row of the table
+type sequenceStub struct {
+	repo.SequenceRepo
+	seq     models.Sequence
+	created *models.Sequence
+}
+
+func (s *sequenceStub) Create(_ context.Context, _ int64, in models.Sequence) (models.Sequence, error) {
+	s.created = &in
+	return in, nil
+}
+
+func (s *sequenceStub) Next(_ context.Context, _ int64, name string, count int) (models.Sequence, error) {
+	if name != s.seq.Name {
+		return models.Sequence{}, repo.ErrNotFound
+	}
+	s.seq.LastValue += int64(count)
+	return s.seq, nil
+}
+
+func TestSequencesCreateValidates(t *testing.T) {
+	for _, in := range []models.Sequence{
+		{Name: "PO"},
+		{Name: "p"},
+		{Name: "po number"},
+		{Name: "po", Padding: 19},
+		{Name: "po", Padding: -1},
+		{Name: "po", Prefix: "A-VERY-LONG-PREFIX-OF-TAGS-"},
+		{Name: "po", LastValue: -1},
+	} {
+		stub := &sequenceStub{}
+		var invalid ValidationError
+		if _, err := NewSequences(stub).Create(context.Background(), 1, in); !errors.As(err, &invalid) {
+			t.Errorf("%+v: err = %v, want a validation error", in, err)
+		}
+		if stub.created != nil {
+			t.Errorf("%+v reached the repository", in)
+		}
+	}
+}
+
+func TestSequencesNextFormatsValues(t *testing.T) {
+	stub := &sequenceStub{seq: models.Sequence{Name: "asset_tag", Prefix: "ERA-", Padding: 5, LastValue: 41}}
+	svc := NewSequences(stub)
+
+	got, err := svc.Next(context.Background(), 1, "asset_tag", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ERA-00042", "ERA-00043", "ERA-00044"}
+	if got.First != 42 || got.Last != 44 || len(got.Values) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got.Values[i] != want[i] {
+			t.Errorf("value %d = %q, want %q", i, got.Values[i], want[i])
+		}
+	}
+
+	for _, count := range []int{0, MaxSequenceCount + 1} {
+		if _, err := svc.Next(context.Background(), 1, "asset_tag", count); err == nil {
+			t.Errorf("count %d: want a validation error", count)
+		}
+	}
+	if stub.seq.LastValue != 44 {
+		t.Errorf("rejected counts moved the counter to %d", stub.seq.LastValue)
+	}
+	if _, err := svc.Next(context.Background(), 1, "po", 1); !errors.Is(err, repo.ErrNotFound) {
+		t.Errorf("unknown sequence: err = %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+// Package service holds the business rules for API resources on top of the
+// repositories in package repo. Handlers decode requests, call a service and
+// map its errors to responses; the services never see HTTP.
+package service
+
+import "strings"
+
+// ValidationError is a rejected input; its message is safe to show clients
+type ValidationError string
+
+func (e ValidationError) Error() string { return string(e) }
+
+// ConflictError is a write that collides with an existing record; its
+// message is safe to show clients
+type ConflictError string
+
+func (e ConflictError) Error() string { return string(e) }
+
+// ForbiddenError is a write outside the caller's grants. Code is the
+// problem code clients see; the message is safe to show them.
+type ForbiddenError struct {
+	Code    string
+	Message string
+}
+
+func (e ForbiddenError) Error() string { return e.Message }
+
+// nonBlank returns s when it has non-space content, nil otherwise, for fields
+// where a blank value in a partial update means "leave unchanged"
+func nonBlank(s string) *string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return &s
+}
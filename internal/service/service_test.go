@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// siteStub records what reaches the repository
+type siteStub struct {
+	repo.SiteRepo
+	created *models.Site
+	patch   *repo.SitePatch
+}
+
+func (s *siteStub) Create(_ context.Context, _ int64, in models.Site) (models.Site, error) {
+	s.created = &in
+	return in, nil
+}
+
+func (s *siteStub) Update(_ context.Context, _, _ int64, p repo.SitePatch) (models.Site, error) {
+	s.patch = &p
+	return models.Site{}, nil
+}
+
+func TestSitesCreateRequiresName(t *testing.T) {
+	stub := &siteStub{}
+	_, err := NewSites(stub).Create(context.Background(), 1, models.Site{Name: "  "})
+	var invalid ValidationError
+	if !errors.As(err, &invalid) || invalid != "name is required" {
+		t.Fatalf("err = %v, want name is required", err)
+	}
+	if stub.created != nil {
+		t.Error("invalid site reached the repository")
+	}
+}
+
+func TestSitesUpdatePatch(t *testing.T) {
+	stub := &siteStub{}
+	svc := NewSites(stub)
+
+	if _, err := svc.Update(context.Background(), 1, 2, models.Site{Name: " "}); err != ValidationError("no fields to update") {
+		t.Fatalf("blank update: err = %v", err)
+	}
+
+	empty := ""
+	if _, err := svc.Update(context.Background(), 1, 2, models.Site{Notes: &empty}); err != nil {
+		t.Fatal(err)
+	}
+	if stub.patch.Name != nil || stub.patch.Notes == nil || stub.patch.Location != nil {
+		t.Errorf("patch = %+v, want only notes (cleared)", *stub.patch)
+	}
+}
+
+type vendorStub struct {
+	repo.VendorRepo
+	patch *repo.VendorPatch
+}
+
+func (s *vendorStub) Update(_ context.Context, _, _ int64, p repo.VendorPatch) (models.Vendor, error) {
+	s.patch = &p
+	return models.Vendor{}, nil
+}
+
+func TestVendorsUpdatePatch(t *testing.T) {
+	stub := &vendorStub{}
+	if _, err := NewVendors(stub).Update(context.Background(), 1, 2, models.Vendor{Name: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if stub.patch.Name == nil || *stub.patch.Name != "Acme" || stub.patch.Email != nil {
+		t.Errorf("patch = %+v, want only name", *stub.patch)
+	}
+	if _, err := NewVendors(stub).Create(context.Background(), 1, models.Vendor{}); err == nil {
+		t.Error("vendor without a name was accepted")
+	}
+}
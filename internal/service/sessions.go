@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/repo"
+)
+
+var (
+	// ErrInvalidRefreshToken covers unknown, expired, revoked and reused
+	// refresh tokens alike, so callers learn nothing about which it was
+	ErrInvalidRefreshToken = errors.New("refresh token is invalid, expired or revoked")
+	// ErrScopedToken means a down-scoped or exchanged token asked for a
+	// refresh token
+	ErrScopedToken = errors.New("down-scoped tokens cannot start a session")
+	// ErrAPIKeySession means an API key asked for a refresh token, which
+	// would outlive the key's revocation
+	ErrAPIKeySession = errors.New("API keys cannot start a session")
+)
+
+// Tokens is an access token with the refresh token that renews it
+type Tokens struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Sessions issues, rotates and revokes refresh tokens. Every refresh token
+// can be exchanged once; presenting one a second time means it leaked, so the
+// whole family minted from the same session is revoked.
+type Sessions struct {
+	repo   repo.RefreshTokenRepo
+	jwt    *auth.JWTManager
+	ttl    time.Duration
+	maxAge time.Duration
+}
+
+// NewSessions returns the session service; refresh tokens live for ttl after
+// they are issued or last rotated, and never past maxAge after the session
+// started. A maxAge of 0 lets sessions be refreshed indefinitely.
+func NewSessions(r repo.RefreshTokenRepo, jwt *auth.JWTManager, ttl, maxAge time.Duration) *Sessions {
+	return &Sessions{repo: r, jwt: jwt, ttl: ttl, maxAge: maxAge}
+}
+
+// Start opens a session for the holder of claims, returning a fresh access
+// token and the first refresh token of a new family
+func (s *Sessions) Start(ctx context.Context, claims *auth.Claims) (Tokens, error) {
+	if claims.APIKeyID() != 0 {
+		return Tokens{}, ErrAPIKeySession
+	}
+	if claims.Exchanged || len(claims.SiteIDs) > 0 {
+		return Tokens{}, ErrScopedToken
+	}
+	raw, hash, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	now := time.Now()
+	t, err := s.repo.Create(ctx, hash, repo.RefreshToken{
+		UserID:    claims.UserID,
+		OrgID:     claims.OrgID,
+		Roles:     claims.Roles,
+		StartedAt: now,
+		ExpiresAt: s.expiry(now),
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.tokens(t, raw)
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token, invalidating the one presented
+func (s *Sessions) Refresh(ctx context.Context, token string) (Tokens, error) {
+	t, err := s.lookup(ctx, token)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if t.UsedAt != nil {
+		return Tokens{}, s.revokeReused(ctx, t.FamilyID)
+	}
+
+	raw, hash, err := newRefreshToken()
+	if err != nil {
+		return Tokens{}, err
+	}
+	next, err := s.repo.Rotate(ctx, t.ID, hash, s.expiry(t.StartedAt))
+	if errors.Is(err, repo.ErrConflict) {
+		// a concurrent request exchanged the same token first
+		return Tokens{}, s.revokeReused(ctx, t.FamilyID)
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	return s.tokens(next, raw)
+}
+
+// Revoke ends the session token belongs to; access tokens already issued
+// stay valid until they expire
+func (s *Sessions) Revoke(ctx context.Context, token string) error {
+	t, err := s.lookup(ctx, token)
+	if err != nil {
+		return err
+	}
+	return s.repo.RevokeFamily(ctx, t.FamilyID)
+}
+
+// lookup returns the live stored token for a raw refresh token
+func (s *Sessions) lookup(ctx context.Context, token string) (repo.RefreshToken, error) {
+	if token == "" {
+		return repo.RefreshToken{}, ErrInvalidRefreshToken
+	}
+	t, err := s.repo.GetByHash(ctx, hashRefreshToken(token))
+	if errors.Is(err, repo.ErrNotFound) {
+		return repo.RefreshToken{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return repo.RefreshToken{}, err
+	}
+	now := time.Now()
+	if t.RevokedAt != nil || !now.Before(t.ExpiresAt) || (s.maxAge > 0 && !now.Before(t.StartedAt.Add(s.maxAge))) {
+		return repo.RefreshToken{}, ErrInvalidRefreshToken
+	}
+	return t, nil
+}
+
+// expiry is when a refresh token issued now for a session started at
+// started expires: ttl from now, but not past the session's max age
+func (s *Sessions) expiry(started time.Time) time.Time {
+	exp := time.Now().Add(s.ttl)
+	if s.maxAge > 0 && started.Add(s.maxAge).Before(exp) {
+		return started.Add(s.maxAge)
+	}
+	return exp
+}
+
+func (s *Sessions) revokeReused(ctx context.Context, familyID int64) error {
+	if err := s.repo.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+	return ErrInvalidRefreshToken
+}
+
+func (s *Sessions) tokens(t repo.RefreshToken, raw string) (Tokens, error) {
+	access, err := s.jwt.GenerateToken(t.UserID, t.OrgID, t.Roles)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:      access,
+		AccessExpiresAt:  time.Now().Add(s.jwt.Expiry()),
+		RefreshToken:     raw,
+		RefreshExpiresAt: t.ExpiresAt,
+	}, nil
+}
+
+// newRefreshToken returns a random token and the hash it is stored under
+func newRefreshToken() (raw, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashRefreshToken(raw), nil
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/testutil"
+)
+
+func newTestSessions() *Sessions {
+	jwt := auth.NewJWTManager("supersecretkeyforunittestingonly!", "era-inventory-api", "era-inventory-api", time.Hour)
+	return NewSessions(testutil.NewMemRefreshTokens(), jwt, 24*time.Hour, 0)
+}
+
+func TestSessionsRotate(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSessions()
+
+	first, err := s.Start(ctx, &auth.Claims{UserID: 7, OrgID: 2, Roles: []string{"org_admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refresh token was not rotated")
+	}
+	claims, err := s.jwt.ValidateToken(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != 7 || claims.OrgID != 2 || !claims.HasRole("org_admin") {
+		t.Errorf("refreshed claims = %+v", claims)
+	}
+	if !second.RefreshExpiresAt.After(time.Now().Add(23 * time.Hour)) {
+		t.Errorf("refresh token expires at %v, want ~24h from now", second.RefreshExpiresAt)
+	}
+}
+
+func TestSessionsReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSessions()
+
+	first, _ := s.Start(ctx, &auth.Claims{UserID: 1, OrgID: 1, Roles: []string{"viewer"}})
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Refresh(ctx, first.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reusing a rotated token: err = %v", err)
+	}
+	if _, err := s.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("token minted before the reuse still works: err = %v", err)
+	}
+}
+
+func TestSessionsRevoke(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSessions()
+
+	tokens, _ := s.Start(ctx, &auth.Claims{UserID: 1, OrgID: 1, Roles: []string{"viewer"}})
+	if err := s.Revoke(ctx, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh after revoke: err = %v", err)
+	}
+	if err := s.Revoke(ctx, "not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("revoking an unknown token: err = %v", err)
+	}
+}
+
+func TestSessionsRejectScopedTokens(t *testing.T) {
+	s := newTestSessions()
+	_, err := s.Start(context.Background(), &auth.Claims{UserID: 1, OrgID: 1, Roles: []string{"viewer"}, SiteIDs: []int64{3}})
+	if !errors.Is(err, ErrScopedToken) {
+		t.Errorf("err = %v, want ErrScopedToken", err)
+	}
+}
+
+func TestSessionsRejectAPIKeys(t *testing.T) {
+	s := newTestSessions()
+	_, err := s.Start(context.Background(), auth.NewAPIKeyClaims(5, 1, 1, []string{"org_admin"}, nil))
+	if !errors.Is(err, ErrAPIKeySession) {
+		t.Errorf("err = %v, want ErrAPIKeySession", err)
+	}
+}
+
+func TestSessionsRejectExchangedTokens(t *testing.T) {
+	s := newTestSessions()
+	parent := &auth.Claims{UserID: 1, OrgID: 1, Roles: []string{"org_admin", "viewer"}}
+	token, _, err := s.jwt.GenerateScopedToken(parent, []string{"viewer"}, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.jwt.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Start(context.Background(), claims); !errors.Is(err, ErrScopedToken) {
+		t.Errorf("err = %v, want ErrScopedToken", err)
+	}
+}
+
+func TestSessionsMaxAge(t *testing.T) {
+	ctx := context.Background()
+	jwt := auth.NewJWTManager("supersecretkeyforunittestingonly!", "era-inventory-api", "era-inventory-api", time.Hour)
+	s := NewSessions(testutil.NewMemRefreshTokens(), jwt, 24*time.Hour, 200*time.Millisecond)
+
+	first, err := s.Start(ctx, &auth.Claims{UserID: 1, OrgID: 1, Roles: []string{"viewer"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RefreshExpiresAt.After(time.Now().Add(200 * time.Millisecond)) {
+		t.Errorf("refresh token expires at %v, past the session's max age", first.RefreshExpiresAt)
+	}
+	second, err := s.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.RefreshExpiresAt.Equal(first.RefreshExpiresAt) {
+		t.Errorf("refreshing moved the session's end from %v to %v", first.RefreshExpiresAt, second.RefreshExpiresAt)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if _, err := s.Refresh(ctx, second.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh past the max age: err = %v", err)
+	}
+}
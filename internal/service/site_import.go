@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// MaxSiteImportRows is the most sites one import takes
+const MaxSiteImportRows = 5000
+
+// Outcomes of an imported row
+const (
+	SiteImportCreated     = "created"
+	SiteImportWouldCreate = "would_create"
+	SiteImportDuplicate   = "duplicate"
+	SiteImportInvalid     = "invalid"
+)
+
+// siteImportColumns are the CSV columns understood, by header name.
+// coordinates is "latitude,longitude" in one column, as maps copy them.
+var siteImportColumns = map[string]bool{
+	"name": true, "location": true, "notes": true, "parent": true,
+	"latitude": true, "longitude": true, "coordinates": true,
+}
+
+// SiteImportRow is one data line of a site CSV. Err is set when a value
+// could not be parsed.
+type SiteImportRow struct {
+	Line   int
+	Site   models.Site
+	Parent string
+	Err    string
+}
+
+// SiteImportOutcome is what happened (or would happen) to one row
+type SiteImportOutcome struct {
+	Line   int    `json:"line"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	ID     *int   `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SiteImportResult reports an import. Nothing is written when any row is
+// invalid or on a dry run.
+type SiteImportResult struct {
+	DryRun     bool                `json:"dry_run"`
+	Created    int                 `json:"created"`
+	Duplicates int                 `json:"duplicates"`
+	Invalid    int                 `json:"invalid"`
+	Rows       []SiteImportOutcome `json:"rows"`
+}
+
+// ParseSiteCSV reads a site CSV with a header line. name is required; the
+// other columns are optional and unknown ones are rejected, so a typo does
+// not silently drop data.
+func ParseSiteCSV(r io.Reader) ([]SiteImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, ValidationError("the CSV is empty")
+	}
+	if err != nil {
+		return nil, ValidationError("invalid CSV: " + err.Error())
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !siteImportColumns[h] {
+			return nil, ValidationError(fmt.Sprintf("unknown column %q; expected name, location, notes, latitude, longitude, coordinates or parent", h))
+		}
+		cols[h] = i
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil, ValidationError("the header must include a name column")
+	}
+
+	var rows []SiteImportRow
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ValidationError("invalid CSV: " + err.Error())
+		}
+		if len(rows) == MaxSiteImportRows {
+			return nil, ValidationError(fmt.Sprintf("at most %d sites can be imported at once", MaxSiteImportRows))
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, parseSiteRecord(line, rec, cols))
+	}
+	if len(rows) == 0 {
+		return nil, ValidationError("the CSV has no sites")
+	}
+	return rows, nil
+}
+
+func parseSiteRecord(line int, rec []string, cols map[string]int) SiteImportRow {
+	field := func(name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	optional := func(name string) *string {
+		if v := field(name); v != "" {
+			return &v
+		}
+		return nil
+	}
+	row := SiteImportRow{
+		Line:   line,
+		Site:   models.Site{Name: field("name"), Location: optional("location"), Notes: optional("notes")},
+		Parent: field("parent"),
+	}
+
+	lat, lon := field("latitude"), field("longitude")
+	if c := field("coordinates"); c != "" {
+		parts := strings.Split(c, ",")
+		if len(parts) != 2 {
+			row.Err = "coordinates must be \"latitude,longitude\""
+			return row
+		}
+		lat, lon = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+	for _, v := range []struct {
+		name, text string
+		dst        **float64
+	}{{"latitude", lat, &row.Site.Latitude}, {"longitude", lon, &row.Site.Longitude}} {
+		if v.text == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v.text, 64)
+		if err != nil {
+			row.Err = v.name + " must be a number"
+			return row
+		}
+		*v.dst = &f
+	}
+	return row
+}
+
+// Import creates the sites of rows that do not exist yet. A site whose name
+// (ignoring case) is already taken is reported as a duplicate and skipped. A
+// parent is named by an existing site or an earlier row. Either every new
+// site is created or, when a row is invalid, none is.
+func (s *Sites) Import(ctx context.Context, orgID int64, rows []SiteImportRow, dryRun bool) (SiteImportResult, error) {
+	names := make([]string, 0, 2*len(rows))
+	for _, row := range rows {
+		names = append(names, row.Site.Name, row.Parent)
+	}
+	found, err := s.repo.FindByNames(ctx, orgID, names)
+	if err != nil {
+		return SiteImportResult{}, err
+	}
+	existing := make(map[string]int, len(found))
+	for _, site := range found {
+		existing[strings.ToLower(site.Name)] = site.ID
+	}
+
+	res := SiteImportResult{DryRun: dryRun, Rows: make([]SiteImportOutcome, len(rows))}
+	seen := map[string]int{}    // row index by name
+	batchIndex := map[int]int{} // batch position by row index
+	var batch []repo.NewSite
+	for i, row := range rows {
+		out := &res.Rows[i]
+		*out = SiteImportOutcome{Line: row.Line, Name: row.Site.Name}
+		key := strings.ToLower(row.Site.Name)
+		invalid := func(msg string) {
+			out.Status, out.Error = SiteImportInvalid, msg
+			res.Invalid++
+		}
+
+		var ve ValidationError
+		switch {
+		case row.Err != "":
+			invalid(row.Err)
+		case row.Site.Name == "":
+			invalid("name is required")
+		case errors.As(checkCoordinates(row.Site.Latitude, row.Site.Longitude), &ve):
+			invalid(ve.Error())
+		}
+		if out.Status == SiteImportInvalid {
+			continue
+		}
+		if first, ok := seen[key]; ok {
+			invalid(fmt.Sprintf("duplicate of line %d", rows[first].Line))
+			continue
+		}
+		seen[key] = i
+		if id, ok := existing[key]; ok {
+			id := id
+			out.Status, out.ID = SiteImportDuplicate, &id
+			res.Duplicates++
+			continue
+		}
+
+		ns := repo.NewSite{Site: row.Site}
+		if row.Parent != "" {
+			parentKey := strings.ToLower(row.Parent)
+			if id, ok := existing[parentKey]; ok {
+				ns.Site.ParentID = &id
+			} else if p, ok := seen[parentKey]; ok && p != i {
+				pos, ok := batchIndex[p]
+				if !ok {
+					invalid(fmt.Sprintf("parent on line %d is invalid", rows[p].Line))
+					continue
+				}
+				ns.ParentIndex = &pos
+			} else {
+				invalid(fmt.Sprintf("parent %q is neither an existing site nor an earlier row", row.Parent))
+				continue
+			}
+		}
+		batchIndex[i] = len(batch)
+		batch = append(batch, ns)
+		out.Status = SiteImportWouldCreate
+	}
+
+	if res.Invalid > 0 || dryRun {
+		if res.Invalid == 0 {
+			res.Created = len(batch)
+		}
+		return res, nil
+	}
+	created, err := s.repo.CreateMany(ctx, orgID, batch)
+	if err != nil {
+		return SiteImportResult{}, err
+	}
+	for i, pos := range batchIndex {
+		id := created[pos].ID
+		res.Rows[i].Status, res.Rows[i].ID = SiteImportCreated, &id
+	}
+	res.Created = len(created)
+	return res, nil
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSiteCSV(t *testing.T) {
+	rows, err := ParseSiteCSV(strings.NewReader("\ufeffName, Latitude, Longitude, Parent\n" +
+		"HQ, 52.52, 13.40,\n" +
+		"Floor 1,,,HQ\n" +
+		"Annex,north,,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	if hq := rows[0]; hq.Line != 2 || hq.Site.Name != "HQ" || hq.Site.Latitude == nil || *hq.Site.Longitude != 13.40 {
+		t.Errorf("HQ = %+v", hq)
+	}
+	if rows[1].Parent != "HQ" || rows[1].Site.Latitude != nil {
+		t.Errorf("Floor 1 = %+v", rows[1])
+	}
+	if rows[2].Err != "latitude must be a number" {
+		t.Errorf("Annex error = %q", rows[2].Err)
+	}
+
+	for _, in := range []string{"", "name\n", "city\nBerlin\n", "name,site\nA,B\n"} {
+		if _, err := ParseSiteCSV(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: want an error", in)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// Sites manages an org's sites
+type Sites struct {
+	repo repo.SiteRepo
+}
+
+// NewSites returns the site service backed by r
+func NewSites(r repo.SiteRepo) *Sites {
+	return &Sites{repo: r}
+}
+
+func (s *Sites) List(ctx context.Context, orgID int64, opts repo.ListOptions) (repo.Page[models.Site], error) {
+	return s.repo.List(ctx, orgID, opts)
+}
+
+func (s *Sites) Get(ctx context.Context, orgID, id int64) (models.Site, error) {
+	return s.repo.Get(ctx, orgID, id)
+}
+
+// maxSiteDepth bounds the walk up a site's parents when checking for cycles
+const maxSiteDepth = 100
+
+// Create adds a site; a name is required, coordinates come in pairs and a
+// parent must be a site of the org
+func (s *Sites) Create(ctx context.Context, orgID int64, in models.Site) (models.Site, error) {
+	if strings.TrimSpace(in.Name) == "" {
+		return models.Site{}, ValidationError("name is required")
+	}
+	if err := checkCoordinates(in.Latitude, in.Longitude); err != nil {
+		return models.Site{}, err
+	}
+	if in.ParentID != nil && *in.ParentID == 0 {
+		in.ParentID = nil
+	}
+	if in.ParentID != nil {
+		if err := s.checkParent(ctx, orgID, 0, int64(*in.ParentID)); err != nil {
+			return models.Site{}, err
+		}
+	}
+	return s.repo.Create(ctx, orgID, in)
+}
+
+// Update applies a partial update: a blank name is ignored, and a location or
+// notes present in the input (even empty, which clears it) is written.
+// Coordinates change together; parent_id 0 detaches the site from its parent.
+func (s *Sites) Update(ctx context.Context, orgID, id int64, in models.Site) (models.Site, error) {
+	p := repo.SitePatch{
+		Name:      nonBlank(in.Name),
+		Location:  in.Location,
+		Notes:     in.Notes,
+		Latitude:  in.Latitude,
+		Longitude: in.Longitude,
+		ParentID:  in.ParentID,
+	}
+	if p.Empty() {
+		return models.Site{}, ValidationError("no fields to update")
+	}
+	if err := checkCoordinates(in.Latitude, in.Longitude); err != nil {
+		return models.Site{}, err
+	}
+	if p.ParentID != nil && *p.ParentID != 0 {
+		if err := s.checkParent(ctx, orgID, id, int64(*p.ParentID)); err != nil {
+			return models.Site{}, err
+		}
+	}
+	return s.repo.Update(ctx, orgID, id, p)
+}
+
+// checkParent rejects a parent outside the org and, for an existing site id,
+// one that is the site itself or below it
+func (s *Sites) checkParent(ctx context.Context, orgID, id, parentID int64) error {
+	for depth := 0; depth < maxSiteDepth; depth++ {
+		if parentID == id {
+			return ValidationError("parent_id must not be the site itself or one of its children")
+		}
+		parent, err := s.repo.Get(ctx, orgID, parentID)
+		if errors.Is(err, repo.ErrNotFound) {
+			if depth == 0 {
+				return ValidationError("parent_id does not match a site")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if parent.ParentID == nil {
+			return nil
+		}
+		parentID = int64(*parent.ParentID)
+	}
+	return ValidationError("sites must not be nested more than " + strconv.Itoa(maxSiteDepth) + " levels deep")
+}
+
+// checkCoordinates requires latitude and longitude together and within range
+func checkCoordinates(lat, lon *float64) error {
+	if (lat == nil) != (lon == nil) {
+		return ValidationError("latitude and longitude must be given together")
+	}
+	if lat != nil && (*lat < -90 || *lat > 90) {
+		return ValidationError("latitude must be between -90 and 90")
+	}
+	if lon != nil && (*lon < -180 || *lon > 180) {
+		return ValidationError("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// Delete moves a site to the trash
+func (s *Sites) Delete(ctx context.Context, orgID, id int64) error {
+	return s.repo.Delete(ctx, orgID, id)
+}
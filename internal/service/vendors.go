@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// Vendors manages an org's vendors
+type Vendors struct {
+	repo repo.VendorRepo
+}
+
+// NewVendors returns the vendor service backed by r
+func NewVendors(r repo.VendorRepo) *Vendors {
+	return &Vendors{repo: r}
+}
+
+func (s *Vendors) List(ctx context.Context, orgID int64, opts repo.ListOptions) (repo.Page[models.Vendor], error) {
+	return s.repo.List(ctx, orgID, opts)
+}
+
+func (s *Vendors) Get(ctx context.Context, orgID, id int64) (models.Vendor, error) {
+	return s.repo.Get(ctx, orgID, id)
+}
+
+// Create adds a vendor; a name is required
+func (s *Vendors) Create(ctx context.Context, orgID int64, in models.Vendor) (models.Vendor, error) {
+	if strings.TrimSpace(in.Name) == "" {
+		return models.Vendor{}, ValidationError("name is required")
+	}
+	return s.repo.Create(ctx, orgID, in)
+}
+
+// Update applies a partial update: a blank name is ignored, and contact
+// fields present in the input (even empty, which clears them) are written
+func (s *Vendors) Update(ctx context.Context, orgID, id int64, in models.Vendor) (models.Vendor, error) {
+	p := repo.VendorPatch{
+		Name:  nonBlank(in.Name),
+		Email: in.Email,
+		Phone: in.Phone,
+		Notes: in.Notes,
+	}
+	if p.Empty() {
+		return models.Vendor{}, ValidationError("no fields to update")
+	}
+	return s.repo.Update(ctx, orgID, id, p)
+}
+
+// Delete moves a vendor to the trash
+func (s *Vendors) Delete(ctx context.Context, orgID, id int64) error {
+	return s.repo.Delete(ctx, orgID, id)
+}
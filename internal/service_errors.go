@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/repo"
+	"era-inventory-api/internal/service"
+)
+
+// writeServiceError maps errors from the service layer to problem responses
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid service.ValidationError
+	var quota service.QuotaError
+	var contains service.ContainsError
+	var conflict service.ConflictError
+	var forbidden service.ForbiddenError
+	switch {
+	case errors.As(err, &invalid):
+		problem.BadRequest(w, r, invalid.Error())
+	case errors.As(err, &quota):
+		problem.Write(w, r, http.StatusPaymentRequired, "QUOTA_EXCEEDED", quota.Error())
+	case errors.As(err, &contains):
+		problem.Conflict(w, r, contains.Error())
+	case errors.As(err, &conflict):
+		problem.Conflict(w, r, conflict.Error())
+	case errors.As(err, &forbidden):
+		problem.Write(w, r, http.StatusForbidden, forbidden.Code, forbidden.Message)
+	case errors.Is(err, repo.ErrNotFound):
+		problem.NotFound(w, r)
+	case errors.Is(err, repo.ErrConflict):
+		problem.Conflict(w, r, "a record with the same unique key already exists")
+	default:
+		problem.Internal(w, r, err)
+	}
+}
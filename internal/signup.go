@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/requestid"
+)
+
+// Organization statuses: signed up and awaiting approval, or in use
+const (
+	orgPending = "pending"
+	orgActive  = "active"
+)
+
+// signupInput is the body of POST /signup
+type signupInput struct {
+	Name         string `json:"name"`
+	ContactName  string `json:"contact_name"`
+	ContactEmail string `json:"contact_email"`
+}
+
+// signupClaimInput is the body of POST /signup/{id}/claim
+type signupClaimInput struct {
+	Secret string `json:"secret"`
+}
+
+// signupOrg is an organization as the signup flow shows it. ClaimSecret is
+// only returned by POST /signup.
+type signupOrg struct {
+	ID           int64      `json:"id"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	ContactName  string     `json:"contact_name"`
+	ContactEmail string     `json:"contact_email"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ApprovedAt   *time.Time `json:"approved_at,omitempty"`
+	ClaimSecret  string     `json:"claim_secret,omitempty"`
+}
+
+// signupOrgColumns is what signup queries select, in scanSignupOrg order
+const signupOrgColumns = "id, name, status, COALESCE(contact_name, ''), COALESCE(contact_email, ''), created_at, approved_at"
+
+func scanSignupOrg(row interface{ Scan(...any) error }, extra ...any) (*signupOrg, error) {
+	var o signupOrg
+	dest := append([]any{&o.ID, &o.Name, &o.Status, &o.ContactName, &o.ContactEmail, &o.CreatedAt, &o.ApprovedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// checkSignup trims and validates a signup
+func checkSignup(in *signupInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.ContactName = strings.TrimSpace(in.ContactName)
+	in.ContactEmail = strings.TrimSpace(in.ContactEmail)
+	if in.Name == "" || len(in.Name) > 100 {
+		return errors.New("name must be 1 to 100 characters")
+	}
+	if in.ContactName == "" || len(in.ContactName) > 100 {
+		return errors.New("contact_name must be 1 to 100 characters")
+	}
+	addr, err := netmail.ParseAddress(in.ContactEmail)
+	if err != nil || addr.Address != in.ContactEmail || len(in.ContactEmail) > 254 {
+		return errors.New("contact_email must be an email address")
+	}
+	return nil
+}
+
+// newSignupSecret returns a random claim secret and the hash it is stored under
+func newSignupSecret() (raw, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashSignupSecret(raw), nil
+}
+
+func hashSignupSecret(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// signup records a pending organization. The response carries the claim
+// secret, shown only once, which fetches the org's first org_admin API key
+// after the main tenant approves it. A name already in use is accepted like
+// any other, so the route does not reveal which organizations exist; the
+// approval reports it instead.
+func (s *Server) signup(w http.ResponseWriter, r *http.Request) {
+	var in signupInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if err := checkSignup(&in); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+
+	// one client must not fill the queue for everyone
+	client := signupClient(r)
+	var pending, fromClient int
+	if err := s.DB.QueryRowContext(r.Context(),
+		`SELECT COUNT(*), COUNT(*) FILTER (WHERE signup_client = $2) FROM organizations WHERE status = $1`,
+		orgPending, client).Scan(&pending, &fromClient); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if fromClient >= s.SignupPerClient {
+		w.Header().Set("Retry-After", "3600")
+		problem.Write(w, r, http.StatusTooManyRequests, "SIGNUP_CLIENT_LIMIT", "too many signups from this address await approval; try again later")
+		return
+	}
+	if pending >= s.SignupMaxPending {
+		w.Header().Set("Retry-After", "3600")
+		problem.Write(w, r, http.StatusServiceUnavailable, "SIGNUP_QUEUE_FULL", "too many signups await approval; try again later")
+		return
+	}
+
+	secret, hash, err := newSignupSecret()
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	o, err := scanSignupOrg(s.DB.QueryRowContext(r.Context(), `
+		INSERT INTO organizations (name, status, contact_name, contact_email, signup_secret_hash, signup_client)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+signupOrgColumns, in.Name, orgPending, in.ContactName, in.ContactEmail, hash, client))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	log.Printf("signup: org=%d %q pending approval", o.ID, o.Name)
+	o.ClaimSecret = secret
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusAccepted, o)
+}
+
+// signupClient is the address a signup came from
+func signupClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// claimSignup exchanges the claim secret of an approved signup for the org's
+// first org_admin API key, once. Unknown orgs, wrong secrets and claimed
+// signups all answer 404.
+func (s *Server) claimSignup(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in signupClaimInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.Secret == "" {
+		problem.BadRequest(w, r, "secret is required")
+		return
+	}
+	hash := hashSignupSecret(in.Secret)
+
+	// clearing the hash first makes the claim single-use under concurrency
+	var status string
+	err := s.DB.QueryRowContext(r.Context(), `
+		UPDATE organizations SET
+		  signup_secret_hash = CASE WHEN status = $3 THEN NULL ELSE signup_secret_hash END,
+		  claimed_at = CASE WHEN status = $3 THEN NOW() ELSE claimed_at END
+		WHERE id = $1 AND signup_secret_hash = $2
+		RETURNING status`, id, hash, orgActive).Scan(&status)
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if status != orgActive {
+		problem.Write(w, r, http.StatusConflict, "SIGNUP_PENDING", "the organization awaits approval")
+		return
+	}
+
+	key, raw, err := s.APIKeys.Bootstrap(r.Context(), id, "initial org admin")
+	if err != nil {
+		// give the secret back so the claim can be retried
+		if _, rerr := s.DB.ExecContext(r.Context(),
+			`UPDATE organizations SET signup_secret_hash = $2, claimed_at = NULL WHERE id = $1`, id, hash); rerr != nil {
+			log.Printf("signup: restoring the claim of org=%d: %v", id, rerr)
+		}
+		writeServiceError(w, r, err)
+		return
+	}
+	log.Printf("signup: org=%d claimed its initial API key %s", id, key.Prefix)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(apiKeyCreated{APIKey: key, Key: raw}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// requireMainTenant writes 403 with msg unless the caller's token was issued
+// to the main tenant
+func (s *Server) requireMainTenant(w http.ResponseWriter, r *http.Request, msg string) bool {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil || s.MainTenantOrgID <= 0 || claims.OrgID != s.MainTenantOrgID {
+		problem.Write(w, r, http.StatusForbidden, "MAIN_TENANT_ONLY", msg)
+		return false
+	}
+	return true
+}
+
+// listPendingOrgs is the approval queue, oldest signup first. Organizations
+// are not tenant data, so the pool is used rather than the caller's tenant
+// connection.
+func (s *Server) listPendingOrgs(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMainTenant(w, r, "the signup queue is only available to main tenant tokens") {
+		return
+	}
+	params := s.parseListParams(r)
+	rows, err := s.DB.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER() as total_count
+		FROM organizations WHERE status = $1
+		ORDER BY created_at, id
+		LIMIT %d OFFSET %d`, signupOrgColumns, params.limit, params.offset), orgPending)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		o, err := scanSignupOrg(rows, &totalCount)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+// approveOrg activates a pending organization, after which its claim secret
+// fetches the first org_admin API key. Names are unique among active orgs,
+// so a signup under a name already in use is refused here with 409.
+func (s *Server) approveOrg(w http.ResponseWriter, r *http.Request) {
+	if !s.requireMainTenant(w, r, "the signup queue is only available to main tenant tokens") {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	o, err := scanSignupOrg(s.DB.QueryRowContext(r.Context(), `
+		UPDATE organizations SET status = $2, approved_at = NOW(), approved_by = $3
+		WHERE id = $1 AND status = $4
+		RETURNING `+signupOrgColumns, id, orgActive, auth.UserIDFromContext(r.Context()), orgPending))
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, "an active organization already uses this name")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	log.Printf("audit: signup approved org=%d by user=%d request_id=%s", id, auth.UserIDFromContext(r.Context()), requestid.FromContext(r.Context()))
+	writeJSON(w, r, http.StatusOK, o)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/testutil"
+)
+
+func TestCheckSignup(t *testing.T) {
+	in := signupInput{Name: "  Acme ", ContactName: " Ada ", ContactEmail: " ada@acme.test "}
+	if err := checkSignup(&in); err != nil {
+		t.Fatal(err)
+	}
+	if in.Name != "Acme" || in.ContactName != "Ada" || in.ContactEmail != "ada@acme.test" {
+		t.Errorf("Unexpected signup %+v", in)
+	}
+
+	for _, bad := range []signupInput{
+		{ContactName: "Ada", ContactEmail: "ada@acme.test"},
+		{Name: strings.Repeat("a", 101), ContactName: "Ada", ContactEmail: "ada@acme.test"},
+		{Name: "Acme", ContactEmail: "ada@acme.test"},
+		{Name: "Acme", ContactName: "Ada", ContactEmail: "ada"},
+		{Name: "Acme", ContactName: "Ada", ContactEmail: "Ada <ada@acme.test>"},
+	} {
+		if err := checkSignup(&bad); err == nil {
+			t.Errorf("signup %+v accepted", bad)
+		}
+	}
+}
+
+func TestNewSignupSecret(t *testing.T) {
+	raw, hash, err := newSignupSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) < 40 || hash != hashSignupSecret(raw) || hash == raw {
+		t.Errorf("Unexpected secret %q with hash %q", raw, hash)
+	}
+	other, _, _ := newSignupSecret()
+	if other == raw {
+		t.Error("secrets repeat")
+	}
+}
+
+func TestSignupClient(t *testing.T) {
+	for addr, want := range map[string]string{
+		"192.0.2.7:51234":   "192.0.2.7",
+		"[2001:db8::1]:443": "2001:db8::1",
+		"pipe":              "pipe",
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/signup", nil)
+		r.RemoteAddr = addr
+		if got := signupClient(r); got != want {
+			t.Errorf("signupClient(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestSignupValidation(t *testing.T) {
+	for body, want := range map[string]string{
+		`{}`: "name must be",
+		`{"name":"Acme","contact_name":"Ada","contact_email":"nope"}`: "contact_email",
+		`{"name":"Acme","plan":"gold"}`:                               "unknown field",
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		(&Server{}).signup(w, r)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: status = %d, body %s", body, w.Code, w.Body)
+		}
+	}
+}
+
+func TestSignupQueueMainTenantOnly(t *testing.T) {
+	handlers := map[string]func(*Server, http.ResponseWriter, *http.Request){
+		"list":    (*Server).listPendingOrgs,
+		"approve": (*Server).approveOrg,
+	}
+	for name, h := range handlers {
+		for _, tt := range []struct {
+			mainTenant, orgID int64
+		}{{0, 1}, {1, 2}} {
+			s := &Server{MainTenantOrgID: tt.mainTenant}
+			w := httptest.NewRecorder()
+			r := testutil.AsUser(httptest.NewRequest(http.MethodGet, "/organizations/pending", nil), tt.orgID, 1, "org_admin")
+			h(s, w, r)
+			if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "MAIN_TENANT_ONLY") {
+				t.Errorf("%s main=%d org=%d: status = %d, body %s", name, tt.mainTenant, tt.orgID, w.Code, w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// siteAccessInput is the body accepted by PUT /users/{id}/sites
+type siteAccessInput struct {
+	SiteIDs []int64 `json:"site_ids"`
+}
+
+// siteRestricted reports whether site grants apply to the caller. Org admins
+// and auditors always see the whole organization.
+func siteRestricted(ctx context.Context) bool {
+	claims := auth.ClaimsFromContext(ctx)
+	return claims == nil || !(claims.HasRole("org_admin", "auditor") || claims.ActsAs("org_admin", "auditor"))
+}
+
+// tokenSiteIDs returns the sites a down-scoped token is limited to, if any
+func tokenSiteIDs(ctx context.Context) []int64 {
+	if claims := auth.ClaimsFromContext(ctx); claims != nil {
+		return claims.SiteIDs
+	}
+	return nil
+}
+
+// siteAccessClause returns a condition limiting rows of table (inventory or
+// an alias of it) to the caller's granted sites and, for down-scoped tokens,
+// to the token's sites. Placeholders start at $arg; callers advance by the
+// number of returned args. It returns "" when the caller is not restricted.
+// Items match a site by site_id, or by site name while site_id is unset.
+// Project admins are further limited to their projects (projectAccessClause),
+// so every item query honours both kinds of grant.
+func siteAccessClause(ctx context.Context, table string, arg int) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	if siteRestricted(ctx) {
+		parts = append(parts, fmt.Sprintf(`(NOT EXISTS (SELECT 1 FROM user_site_access a WHERE a.org_id = %[1]s.org_id AND a.user_id = $%[2]d)
+		OR EXISTS (SELECT 1 FROM user_site_access a JOIN sites s ON s.id = a.site_id
+			WHERE a.org_id = %[1]s.org_id AND a.user_id = $%[2]d
+			  AND (%[1]s.site_id = s.id OR (%[1]s.site_id IS NULL AND lower(%[1]s.site) = lower(s.name)))))`,
+			table, arg))
+		args = append(args, auth.UserIDFromContext(ctx))
+		arg++
+	}
+	if ids := tokenSiteIDs(ctx); len(ids) > 0 {
+		parts = append(parts, fmt.Sprintf(`EXISTS (SELECT 1 FROM sites s WHERE s.id = ANY($%[2]d) AND s.org_id = %[1]s.org_id
+			AND (%[1]s.site_id = s.id OR (%[1]s.site_id IS NULL AND lower(%[1]s.site) = lower(s.name))))`,
+			table, arg))
+		args = append(args, ids)
+		arg++
+	}
+	if clause, projectArgs := projectAccessClause(ctx, table, arg); clause != "" {
+		parts = append(parts, clause)
+		args = append(args, projectArgs...)
+	}
+	return strings.Join(parts, " AND "), args
+}
+
+// siteRowAccessClause is siteAccessClause for rows of the sites table (or an
+// alias of it): the caller's granted sites and, for down-scoped tokens, the
+// token's sites. Project grants do not narrow sites.
+func siteRowAccessClause(ctx context.Context, table string, arg int) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	if siteRestricted(ctx) {
+		parts = append(parts, fmt.Sprintf(`(NOT EXISTS (SELECT 1 FROM user_site_access a WHERE a.org_id = %[1]s.org_id AND a.user_id = $%[2]d)
+		OR EXISTS (SELECT 1 FROM user_site_access a WHERE a.org_id = %[1]s.org_id AND a.user_id = $%[2]d AND a.site_id = %[1]s.id))`,
+			table, arg))
+		args = append(args, auth.UserIDFromContext(ctx))
+		arg++
+	}
+	if ids := tokenSiteIDs(ctx); len(ids) > 0 {
+		parts = append(parts, fmt.Sprintf(`%s.id = ANY($%d)`, table, arg))
+		args = append(args, ids)
+	}
+	return strings.Join(parts, " AND "), args
+}
+
+// canUseSite reports whether the caller may place an item at the named site
+func (s *Server) canUseSite(ctx context.Context, site string) (bool, error) {
+	orgID := auth.OrgIDFromContext(ctx)
+	q := dbFrom(ctx, s.DB)
+	if ids := tokenSiteIDs(ctx); len(ids) > 0 {
+		var ok bool
+		if err := q.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM sites WHERE org_id = $1 AND id = ANY($2) AND lower(name) = lower($3))`,
+			orgID, ids, site).Scan(&ok); err != nil || !ok {
+			return false, err
+		}
+	}
+	if !siteRestricted(ctx) {
+		return true, nil
+	}
+	var ok bool
+	err := q.QueryRowContext(ctx, `
+		SELECT NOT EXISTS (SELECT 1 FROM user_site_access WHERE org_id = $1 AND user_id = $2)
+		    OR EXISTS (SELECT 1 FROM user_site_access a JOIN sites s ON s.id = a.site_id
+		               WHERE a.org_id = $1 AND a.user_id = $2 AND lower(s.name) = lower($3))`,
+		orgID, auth.UserIDFromContext(ctx), site).Scan(&ok)
+	return ok, err
+}
+
+func (s *Server) listUserSites(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	q := dbFrom(r.Context(), s.DB)
+	rows, err := q.QueryContext(r.Context(), `
+		SELECT s.id, s.name, s.created_at, s.updated_at
+		FROM user_site_access a JOIN sites s ON s.id = a.site_id
+		WHERE a.org_id = $1 AND a.user_id = $2
+		ORDER BY s.name`, orgID, userID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	sites := []models.Site{}
+	for rows.Next() {
+		var st models.Site
+		if err := rows.Scan(&st.ID, &st.Name, &st.CreatedAt, &st.UpdatedAt); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		sites = append(sites, st)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": sites}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// replaceUserSites sets the user's site grants. An empty list lifts the restriction.
+func (s *Server) replaceUserSites(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in siteAccessInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	ids := uniqueIDs(in.SiteIDs)
+	orgID := auth.OrgIDFromContext(r.Context())
+
+	// a user without grants sees every site: the old grants must not be
+	// dropped unless the new ones are in place
+	tx, err := beginTx(r.Context(), s.DB)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var found int
+	if err := tx.QueryRowContext(r.Context(),
+		`SELECT COUNT(*) FROM sites WHERE org_id = $1 AND id = ANY($2) AND deleted_at IS NULL`, orgID, ids).Scan(&found); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if found != len(ids) {
+		problem.BadRequest(w, r, "site_ids contains unknown sites")
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `
+		DELETE FROM user_site_access
+		WHERE org_id = $1 AND user_id = $2 AND site_id <> ALL($3)`, orgID, userID, ids); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `
+		INSERT INTO user_site_access (org_id, user_id, site_id)
+		SELECT $1, $2, id FROM sites WHERE org_id = $1 AND id = ANY($3)
+		ON CONFLICT DO NOTHING`, orgID, userID, ids); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	s.listUserSites(w, r)
+}
+
+// uniqueIDs drops duplicates, keeping the first occurrence order
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/auth"
+)
+
+func TestSiteAccessClause(t *testing.T) {
+	admin := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 1, Roles: []string{"org_admin"}})
+	if clause, args := siteAccessClause(admin, "inventory", 3); clause != "" || args != nil {
+		t.Errorf("org_admin must not be restricted, got %q %v", clause, args)
+	}
+
+	ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 9, Roles: []string{"viewer"}})
+	ctx = context.WithValue(ctx, auth.UserIDKey, int64(9))
+	clause, args := siteAccessClause(ctx, "i", 4)
+	if !strings.Contains(clause, "a.user_id = $4") || !strings.Contains(clause, "i.site_id") {
+		t.Errorf("Unexpected clause %q", clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{int64(9)}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+func TestUniqueIDs(t *testing.T) {
+	got := uniqueIDs([]int64{3, 1, 3, 2, 1})
+	if !reflect.DeepEqual(got, []int64{3, 1, 2}) {
+		t.Errorf("uniqueIDs = %v", got)
+	}
+	if got := uniqueIDs(nil); got == nil || len(got) != 0 {
+		t.Errorf("uniqueIDs(nil) should be empty, got %v", got)
+	}
+}
+
+func TestSiteAccessClauseScopedToken(t *testing.T) {
+	ctx := context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 2, Roles: []string{"org_admin"}, SiteIDs: []int64{4}})
+	clause, args := siteAccessClause(ctx, "inventory", 2)
+	if !strings.Contains(clause, "s.id = ANY($2)") || strings.Contains(clause, "user_site_access") {
+		t.Errorf("Unexpected clause %q", clause)
+	}
+	if !reflect.DeepEqual(args, []interface{}{[]int64{4}}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+
+	ctx = context.WithValue(context.Background(), auth.ClaimsKey, &auth.Claims{UserID: 9, Roles: []string{"viewer"}, SiteIDs: []int64{4}})
+	ctx = context.WithValue(ctx, auth.UserIDKey, int64(9))
+	clause, args = siteAccessClause(ctx, "inventory", 2)
+	if !strings.Contains(clause, "a.user_id = $2") || !strings.Contains(clause, "ANY($3)") || len(args) != 2 {
+		t.Errorf("Expected grant and token conditions, got %q %v", clause, args)
+	}
+}
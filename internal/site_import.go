@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/service"
+)
+
+// maxSiteImportBytes bounds an uploaded site CSV
+const maxSiteImportBytes = 2 << 20
+
+// importSites creates sites from a CSV body (header line with name and any
+// of location, notes, latitude, longitude, coordinates and parent). Sites
+// whose name is taken are skipped as duplicates. ?dry_run=true reports what
+// would happen without writing. When a row is invalid nothing is written and
+// the report comes back with 422; a CSV with more rows than the org's
+// max_import_rows is refused with 402.
+func (s *Server) importSites(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			problem.BadRequest(w, r, "dry_run must be true or false")
+			return
+		}
+		dryRun = b
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSiteImportBytes))
+	if err != nil {
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", "site CSV must be at most 2MB")
+		return
+	}
+	rows, err := service.ParseSiteCSV(bytes.NewReader(data))
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	if err := s.Limits.CheckImportRows(r.Context(), auth.OrgIDFromContext(r.Context()), len(rows)); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	res, err := s.Sites.Import(r.Context(), auth.OrgIDFromContext(r.Context()), rows, dryRun)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case res.Invalid > 0 && !dryRun:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	case res.Created > 0 && !dryRun:
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -1,204 +1,97 @@
 package internal
 
 import (
-	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
 	"era-inventory-api/internal/auth"
 	"era-inventory-api/internal/models"
-
-	"github.com/go-chi/chi/v5"
+	"era-inventory-api/internal/problem"
 )
 
 // LIST with basic filters & pagination
 func (s *Server) listSites(w http.ResponseWriter, r *http.Request) {
-	params := parseListParams(r)
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	clauses := []string{}
-	args := []interface{}{}
-	arg := 1
-
-	// org filter - use context value instead of query param
-	clauses = append(clauses, fmt.Sprintf("org_id = $%d", arg))
-	args = append(args, orgID)
-	arg++
-
-	// optional text search on name
-	if params.q != "" {
-		clauses = append(clauses, fmt.Sprintf("name ILIKE $%d", arg))
-		args = append(args, "%"+params.q+"%")
-		arg++
-	}
-
-	whereClause := ""
-	if len(clauses) > 0 {
-		whereClause = " WHERE " + strings.Join(clauses, " AND ")
-	}
-
-	// Build the main query with COUNT(*) OVER() to get total count
-	sqlStr := fmt.Sprintf(`
-		SELECT id, name, location, notes, created_at, updated_at,
-		       COUNT(*) OVER() as total_count
-		FROM sites%s`, whereClause)
-
-	allowedSort := map[string]string{
-		"id":         "id",
-		"name":       "name",
-		"created_at": "created_at",
-		"updated_at": "updated_at",
-	}
-	sqlStr += buildOrderBy(params.sort, allowedSort)
-	sqlStr += fmt.Sprintf(" LIMIT %d OFFSET %d", params.limit, params.offset)
-
-	q := dbFrom(r.Context(), s.DB)
-	rows, err := q.QueryContext(r.Context(), sqlStr, args...)
+	params := s.parseListParams(r)
+	page, err := s.Sites.List(r.Context(), auth.OrgIDFromContext(r.Context()), params.options())
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeServiceError(w, r, err)
 		return
 	}
-	defer rows.Close()
 
-	sites := []interface{}{}
-	var totalCount int
-	for rows.Next() {
-		var sc models.Site
-		if err := rows.Scan(&sc.ID, &sc.Name, &sc.Location, &sc.Notes, &sc.CreatedAt, &sc.UpdatedAt, &totalCount); err != nil {
-			http.Error(w, err.Error(), 500)
-			return
-		}
-		sites = append(sites, sc)
+	sites := make([]interface{}, 0, len(page.Rows))
+	for _, v := range page.Rows {
+		sites = append(sites, v)
 	}
-
-	sendListResponse(w, sites, totalCount, params)
+	var meta *listMeta
+	if page.Estimated {
+		meta = s.estimateMeta(page.Total)
+	}
+	sendListResponse(w, sites, page.Total, params, meta)
 }
 
 func (s *Server) getSite(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	var sc models.Site
-	q := dbFrom(r.Context(), s.DB)
-	err := q.QueryRowContext(r.Context(), `
-		SELECT id, name, location, notes, created_at, updated_at
-		FROM sites WHERE id = $1 AND org_id = $2`, id, orgID).Scan(&sc.ID, &sc.Name, &sc.Location, &sc.Notes, &sc.CreatedAt, &sc.UpdatedAt)
-	if err == sql.ErrNoRows {
-		http.Error(w, "not found", http.StatusNotFound)
+	id, ok := pathID(w, r)
+	if !ok {
 		return
 	}
+	out, err := s.Sites.Get(r.Context(), auth.OrgIDFromContext(r.Context()), id)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeServiceError(w, r, err)
 		return
 	}
+	setLastModified(w, out.UpdatedAt)
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(sc); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
 	}
 }
 
 func (s *Server) createSite(w http.ResponseWriter, r *http.Request) {
 	var in models.Site
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "invalid JSON", 400)
-		return
-	}
-	if strings.TrimSpace(in.Name) == "" {
-		http.Error(w, "name is required", 400)
+	if !s.decodeJSON(w, r, &in) {
 		return
 	}
-
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	q := dbFrom(r.Context(), s.DB)
-	err := q.QueryRowContext(r.Context(), `
-		INSERT INTO sites (name, location, notes, org_id)
-		VALUES ($1,$2,$3,$4)
-		RETURNING id, name, location, notes, created_at, updated_at
-	`, in.Name, nullIfEmpty(in.Location), nullIfEmpty(in.Notes), orgID).Scan(&in.ID, &in.Name, &in.Location, &in.Notes, &in.CreatedAt, &in.UpdatedAt)
+	out, err := s.Sites.Create(r.Context(), auth.OrgIDFromContext(r.Context()), in)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeServiceError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(in); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
 	}
 }
 
 func (s *Server) updateSite(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	var in models.Site
-	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
-		http.Error(w, "invalid JSON", 400)
+	id, ok := pathID(w, r)
+	if !ok {
 		return
 	}
-
-	type set struct {
-		sql string
-		val interface{}
-	}
-	sets := make([]set, 0, 5)
-	if strings.TrimSpace(in.Name) != "" {
-		sets = append(sets, set{"name = $%d", in.Name})
-	}
-	if in.Location != nil {
-		sets = append(sets, set{"location = $%d", nullIfEmpty(in.Location)})
-	}
-	if in.Notes != nil {
-		sets = append(sets, set{"notes = $%d", nullIfEmpty(in.Notes)})
-	}
-	if len(sets) == 0 {
-		http.Error(w, "no fields to update", 400)
+	var in models.Site
+	if !s.decodeJSON(w, r, &in) {
 		return
 	}
-
-	args := make([]interface{}, 0, len(sets)+2)
-	sqlStr := "UPDATE sites SET "
-	for i, sset := range sets {
-		if i > 0 {
-			sqlStr += ", "
-		}
-		sqlStr += fmt.Sprintf(sset.sql, i+1)
-		args = append(args, sset.val)
-	}
-	sqlStr += fmt.Sprintf(" WHERE id = $%d AND org_id = $%d RETURNING id, name, location, notes, created_at, updated_at", len(args)+1, len(args)+2)
-	args = append(args, id, orgID)
-
-	q := dbFrom(r.Context(), s.DB)
-	var out models.Site
-	if err := q.QueryRowContext(r.Context(), sqlStr, args...).Scan(&out.ID, &out.Name, &out.Location, &out.Notes, &out.CreatedAt, &out.UpdatedAt); err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), 500)
+	out, err := s.Sites.Update(r.Context(), auth.OrgIDFromContext(r.Context()), id, in)
+	if err != nil {
+		writeServiceError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(out); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Internal(w, r, err)
 	}
 }
 
+// deleteSite soft-deletes; the site can be restored from the trash
 func (s *Server) deleteSite(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	orgID := auth.OrgIDFromContext(r.Context())
-
-	q := dbFrom(r.Context(), s.DB)
-	res, err := q.ExecContext(r.Context(), `DELETE FROM sites WHERE id = $1 AND org_id = $2`, id, orgID)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
+	id, ok := pathID(w, r)
+	if !ok {
 		return
 	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
-		http.Error(w, "not found", http.StatusNotFound)
+	if err := s.Sites.Delete(r.Context(), auth.OrgIDFromContext(r.Context()), id); err != nil {
+		writeServiceError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
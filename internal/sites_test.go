@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/service"
+	"era-inventory-api/internal/testutil"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// fixtureServer is a Server whose sites and vendors live in f
+func fixtureServer(f *testutil.Fixtures) *Server {
+	return &Server{Sites: service.NewSites(f.Sites), Vendors: service.NewVendors(f.Vendors), Limits: service.NewLimits(testutil.NewMemOrgLimits())}
+}
+
+func itoa(id int) string { return strconv.Itoa(id) }
+
+// serveAs routes one request through handler mounted at pattern, as a user of orgID
+func serveAs(orgID int64, method, pattern, path, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.Method(method, pattern, handler)
+	r := testutil.AsUser(httptest.NewRequest(method, path, strings.NewReader(body)), orgID, 1, "org_admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestListSitesIsOrgScoped(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	f.Site("Berlin HQ").Create()
+	f.Site("Hamburg").Create()
+	f.Site("Other org").InOrg(2).Create()
+	s := fixtureServer(f)
+
+	w := serveAs(1, http.MethodGet, "/sites", "/sites?q=berlin", "", s.listSites)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []models.Site `json:"data"`
+		Page pageInfo      `json:"page"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Name != "Berlin HQ" || resp.Page.Total != 1 {
+		t.Errorf("got %+v", resp)
+	}
+
+	w = serveAs(2, http.MethodGet, "/sites", "/sites", "", s.listSites)
+	if !strings.Contains(w.Body.String(), "Other org") || strings.Contains(w.Body.String(), "Hamburg") {
+		t.Errorf("org 2 sees %s", w.Body.String())
+	}
+}
+
+func TestSiteCRUD(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	hq := f.Site("HQ").Location("Berlin").Create()
+	s := fixtureServer(f)
+	path := "/sites/" + itoa(hq.ID)
+
+	if w := serveAs(1, http.MethodPost, "/sites", "/sites", `{"name":" "}`, s.createSite); w.Code != http.StatusBadRequest {
+		t.Errorf("create without name = %d, want 400", w.Code)
+	}
+	if w := serveAs(1, http.MethodPost, "/sites", "/sites", `{"name":"Annex"}`, s.createSite); w.Code != http.StatusCreated {
+		t.Errorf("create = %d, want 201", w.Code)
+	}
+
+	if w := serveAs(2, http.MethodGet, "/sites/{id}", path, "", s.getSite); w.Code != http.StatusNotFound {
+		t.Errorf("get from another org = %d, want 404", w.Code)
+	}
+	if w := serveAs(1, http.MethodGet, "/sites/{id}", "/sites/abc", "", s.getSite); w.Code != http.StatusNotFound {
+		t.Errorf("get with a malformed id = %d, want 404", w.Code)
+	}
+
+	w := serveAs(1, http.MethodPut, "/sites/{id}", path, `{"location":""}`, s.updateSite)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Berlin") {
+		t.Errorf("clearing location = %d: %s", w.Code, w.Body.String())
+	}
+	if w := serveAs(1, http.MethodPut, "/sites/{id}", path, `{}`, s.updateSite); w.Code != http.StatusBadRequest {
+		t.Errorf("empty update = %d, want 400", w.Code)
+	}
+
+	if w := serveAs(1, http.MethodDelete, "/sites/{id}", path, "", s.deleteSite); w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", w.Code)
+	}
+	if w := serveAs(1, http.MethodGet, "/sites/{id}", path, "", s.getSite); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete = %d, want 404", w.Code)
+	}
+}
+
+func TestSiteParents(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	campus := f.Site("Campus").Create()
+	other := f.Site("Elsewhere").InOrg(2).Create()
+	s := fixtureServer(f)
+
+	w := serveAs(1, http.MethodPost, "/sites", "/sites", `{"name":"Building A","parent_id":`+itoa(campus.ID)+`,"latitude":52.5,"longitude":13.4}`, s.createSite)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create child = %d: %s", w.Code, w.Body.String())
+	}
+	var building models.Site
+	json.Unmarshal(w.Body.Bytes(), &building)
+
+	for name, body := range map[string]string{
+		"parent in another org": `{"name":"X","parent_id":` + itoa(other.ID) + `}`,
+		"latitude alone":        `{"name":"X","latitude":52.5}`,
+		"latitude out of range": `{"name":"X","latitude":95,"longitude":13.4}`,
+	} {
+		if w := serveAs(1, http.MethodPost, "/sites", "/sites", body, s.createSite); w.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", name, w.Code)
+		}
+	}
+
+	// The campus must not move below its own building
+	cycle := `{"parent_id":` + itoa(building.ID) + `}`
+	if w := serveAs(1, http.MethodPut, "/sites/{id}", "/sites/"+itoa(campus.ID), cycle, s.updateSite); w.Code != http.StatusBadRequest {
+		t.Errorf("cycle = %d, want 400", w.Code)
+	}
+	w = serveAs(1, http.MethodPut, "/sites/{id}", "/sites/"+itoa(building.ID), `{"parent_id":0}`, s.updateSite)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "parent_id") {
+		t.Errorf("detach = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImportSites(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	f.Site("HQ").Create()
+	s := fixtureServer(f)
+	importCSV := func(query, body string) (*httptest.ResponseRecorder, service.SiteImportResult) {
+		w := serveAs(1, http.MethodPost, "/sites/import", "/sites/import"+query, body, s.importSites)
+		var res service.SiteImportResult
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w, res
+	}
+	count := func() int {
+		w := serveAs(1, http.MethodGet, "/sites", "/sites", "", s.listSites)
+		var resp struct{ Page struct{ Total int } }
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp.Page.Total
+	}
+
+	good := "name,location,coordinates,parent\n" +
+		"Campus North,Hamburg,\"53.55, 9.99\",\n" +
+		"Building 1,,,campus north\n" +
+		"hq,,,\n" +
+		"Lab,,,HQ\n"
+
+	w, res := importCSV("?dry_run=true", good)
+	if w.Code != http.StatusOK || res.Created != 3 || res.Duplicates != 1 || count() != 1 {
+		t.Fatalf("dry run = %d %+v, %d sites", w.Code, res, count())
+	}
+
+	bad := good + "Building 1,,,\nAnnex,,not-a-number,\n"
+	w, res = importCSV("", bad)
+	if w.Code != http.StatusUnprocessableEntity || res.Invalid != 2 || count() != 1 {
+		t.Fatalf("invalid import = %d %+v, %d sites", w.Code, res, count())
+	}
+
+	w, res = importCSV("", good)
+	if w.Code != http.StatusCreated || res.Created != 3 || count() != 4 {
+		t.Fatalf("import = %d %+v, %d sites", w.Code, res, count())
+	}
+	if res.Rows[0].Status != service.SiteImportCreated || res.Rows[2].Status != service.SiteImportDuplicate {
+		t.Errorf("rows = %+v", res.Rows)
+	}
+	child, err := f.Sites.Get(context.Background(), 1, int64(*res.Rows[1].ID))
+	if err != nil || child.ParentID == nil || *child.ParentID != *res.Rows[0].ID {
+		t.Errorf("Building 1 = %+v, want parent %d", child, *res.Rows[0].ID)
+	}
+
+	if w := serveAs(1, http.MethodPost, "/sites/import", "/sites/import", "site,city\nA,B\n", s.importSites); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown columns = %d, want 400", w.Code)
+	}
+
+	maxRows := 2
+	s.Limits.Set(context.Background(), 1, models.OrgLimits{MaxImportRows: &maxRows})
+	if w, _ := importCSV("?dry_run=true", good); w.Code != http.StatusPaymentRequired {
+		t.Errorf("import over max_import_rows = %d, want 402", w.Code)
+	}
+}
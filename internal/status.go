@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/health"
+	"era-inventory-api/internal/webhook"
+)
+
+// statusChangedEvent is the X-Era-Event of status transition posts
+const statusChangedEvent = "status.changed"
+
+// newStatusMonitor checks the components of the public status page: the
+// readiness checks plus the job queue and webhook delivery backlogs, which
+// must not take instances out of rotation and so are not readiness checks
+func (s *Server) newStatusMonitor(cfg *config.Config) *health.Monitor {
+	checks := health.NewRegistry(5 * time.Second)
+	checks.Register("db", s.DB.PingContext)
+	if c, ok := s.Storage.(interface{ Check(context.Context) error }); ok {
+		checks.Register("storage", c.Check)
+	}
+	checks.Register("jobs", backlogCheck(s.DB,
+		`SELECT COUNT(*) FROM jobs WHERE status = 'queued'`, cfg.StatusJobBacklog, "jobs queued"))
+	checks.Register("webhooks", backlogCheck(s.DB,
+		`SELECT COUNT(*) FROM webhook_deliveries WHERE status = 'pending' AND attempts > 0`, cfg.StatusWebhookBacklog, "webhook deliveries awaiting a retry"))
+
+	monitor := health.NewMonitor(checks, cfg.StatusInterval)
+	if cfg.StatusWebhookURL != "" {
+		monitor.Subscribe(postStatusTransition(webhook.NewClient(true), cfg.StatusWebhookURL, cfg.StatusWebhookSecret))
+	}
+	return monitor
+}
+
+// backlogCheck fails when count, a query over all orgs, exceeds limit
+func backlogCheck(db *sql.DB, count string, limit int, what string) health.Checker {
+	return func(ctx context.Context) error {
+		var n int
+		if err := db.QueryRowContext(ctx, count).Scan(&n); err != nil {
+			return err
+		}
+		if n > limit {
+			return fmt.Errorf("%d %s, above %d", n, what, limit)
+		}
+		return nil
+	}
+}
+
+// postStatusTransition posts each transition to url as JSON, signed like
+// webhook deliveries when secret is set. Failures are logged, not retried:
+// the next transition supersedes the state anyway.
+func postStatusTransition(client *http.Client, url, secret string) func(health.Transition) {
+	return func(t health.Transition) {
+		body, err := json.Marshal(t)
+		if err != nil {
+			log.Printf("status webhook: %v", err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("status webhook: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "era-inventory-status")
+		req.Header.Set(webhook.EventHeader, statusChangedEvent)
+		if secret != "" {
+			req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, time.Now(), body))
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("status webhook: %s %s->%s not delivered: %v", t.Component, t.From, t.To, err)
+			return
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			log.Printf("status webhook: %s %s->%s answered %s", t.Component, t.From, t.To, resp.Status)
+		}
+	}
+}
+
+// getStatus serves the public status page from the monitor's last check
+func (s *Server) getStatus(w http.ResponseWriter, r *http.Request) {
+	monitor := s.Status
+	if monitor == nil {
+		monitor = health.NewMonitor(health.NewRegistry(time.Second), 0)
+	}
+	monitor.Handler().ServeHTTP(w, r)
+}
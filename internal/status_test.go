@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/health"
+	"era-inventory-api/internal/webhook"
+)
+
+func TestPostStatusTransition(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer endpoint.Close()
+
+	post := postStatusTransition(endpoint.Client(), endpoint.URL, "whsec_test")
+	post(health.Transition{Component: "db", From: health.StatusOK, To: health.StatusFail, Error: "connection refused", At: time.Now()})
+
+	r, body := <-received, <-bodies
+	var got health.Transition
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Component != "db" || got.To != health.StatusFail || r.Header.Get(webhook.EventHeader) != statusChangedEvent {
+		t.Errorf("posted %s with event %q", body, r.Header.Get(webhook.EventHeader))
+	}
+	if !strings.HasPrefix(r.Header.Get(webhook.SignatureHeader), "t=") {
+		t.Errorf("signature = %q", r.Header.Get(webhook.SignatureHeader))
+	}
+}
+
+func TestGetStatusWithoutMonitor(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).getStatus(w, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+	var page health.StatusPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || page.Status != health.StatusUnknown {
+		t.Errorf("status %d, page %+v", w.Code, page)
+	}
+}
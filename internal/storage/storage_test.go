@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalPutOpenDelete(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocal(t.TempDir())
+
+	n, err := store.Put(ctx, "exports/1/42.csv", strings.NewReader("id,name\n1,Switch\n"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if n != 17 {
+		t.Errorf("Expected 17 bytes written, got %d", n)
+	}
+
+	obj, err := store.Open(ctx, "exports/1/42.csv")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if string(data) != "id,name\n1,Switch\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+	if obj.Size() != 17 {
+		t.Errorf("Expected size 17, got %d", obj.Size())
+	}
+
+	if err := store.Delete(ctx, "exports/1/42.csv"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Open(ctx, "exports/1/42.csv"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "exports/1/42.csv"); err != nil {
+		t.Errorf("Deleting a missing object should succeed, got %v", err)
+	}
+}
+
+func TestLocalRejectsInvalidKeys(t *testing.T) {
+	store := NewLocal(t.TempDir())
+	for _, key := range []string{"", "/", "../etc/passwd", "exports/../../x"} {
+		if _, err := store.Put(context.Background(), key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestObjectServesRangesAndConditionals(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocal(t.TempDir())
+	if _, err := store.Put(ctx, "exports/1/7.csv", strings.NewReader("0123456789")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		obj, err := store.Open(ctx, "exports/1/7.csv")
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer obj.Close()
+		req := httptest.NewRequest("GET", "/exports/7/download", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		w.Header().Set("ETag", ETag(obj))
+		http.ServeContent(w, req, "7.csv", obj.ModTime(), obj)
+		return w
+	}
+
+	full := serve("", "")
+	etag := full.Header().Get("ETag")
+	if full.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Unexpected full response %d etag=%q", full.Code, etag)
+	}
+
+	if w := serve("Range", "bytes=4-"); w.Code != http.StatusPartialContent || w.Body.String() != "456789" {
+		t.Errorf("Expected resumed download, got %d %q", w.Code, w.Body.String())
+	}
+	if w := serve("If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for matching ETag, got %d", w.Code)
+	}
+
+	// Replacing the object changes its ETag
+	time.Sleep(10 * time.Millisecond)
+	if _, err := store.Put(ctx, "exports/1/7.csv", strings.NewReader("abcdefghijk")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if w := serve("If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected full response after replacement, got %d", w.Code)
+	}
+}
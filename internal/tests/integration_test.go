@@ -3,18 +3,30 @@
 package tests
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"era-inventory-api/internal"
 	"era-inventory-api/internal/auth"
 	"era-inventory-api/internal/config"
+	"era-inventory-api/internal/health"
+	"era-inventory-api/internal/mail"
+	"era-inventory-api/internal/outbox"
 	"era-inventory-api/internal/testutil"
+	"era-inventory-api/internal/webhook"
 )
 
 var testServer *internal.Server
@@ -31,6 +43,14 @@ func TestMain(m *testing.M) {
 		JWTIssuer:   "era-inventory-api",
 		JWTAudience: "era-inventory-api",
 		JWTExpiry:   24 * time.Hour,
+
+		MainTenantOrgID:  1,
+		RefreshTokenTTL:  30 * 24 * time.Hour,
+		EnableTopQueries: true,
+		SignupEnabled:    true,
+		SignupMaxPending: 100,
+
+		SignupMaxPendingPerClient: 100,
 	}
 
 	// Create test server with explicit database URL
@@ -194,3 +214,3174 @@ func TestInsufficientPermissions(t *testing.T) {
 		t.Errorf("Expected status 403, got %d", w.Code)
 	}
 }
+
+func TestAuditorIsReadOnly(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"auditor"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{"GET", "/items", http.StatusOK},
+		{"GET", "/sites", http.StatusOK},
+		{"GET", "/admin/integrity", http.StatusOK},
+		{"POST", "/items", http.StatusForbidden},
+		{"PUT", "/items/1", http.StatusForbidden},
+		{"DELETE", "/items/1", http.StatusForbidden},
+		{"POST", "/exports", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+
+		testServer.Router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestItemSoftDelete(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	tag := fmt.Sprintf("SOFT-%d", time.Now().UnixNano())
+	w := do("POST", "/items", `{"asset_tag":"`+tag+`","name":"Soft delete","status":"in_stock"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var item struct {
+		ID     int    `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&item); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if item.Status != "in_stock" {
+		t.Errorf("expected status in_stock, got %q", item.Status)
+	}
+
+	if w := do("POST", "/items", `{"asset_tag":"X-`+tag+`","name":"Bad","status":"lost"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: expected 400, got %d", w.Code)
+	}
+
+	path := fmt.Sprintf("/items/%d", item.ID)
+	if w := do("DELETE", path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected status 204, got %d", w.Code)
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: expected 404, got %d", w.Code)
+	}
+	if w := do("DELETE", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("second delete: expected 404, got %d", w.Code)
+	}
+	if w := do("GET", "/items?q="+tag, ""); strings.Contains(w.Body.String(), tag) {
+		t.Errorf("deleted item still listed: %s", w.Body.String())
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	name := fmt.Sprintf("Trash site %d", time.Now().UnixNano())
+	w := do("POST", "/sites", `{"name":"`+name+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var site struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&site); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	path := fmt.Sprintf("/sites/%d", site.ID)
+
+	if w := do("DELETE", path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected status 204, got %d", w.Code)
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("get after delete: expected 404, got %d", w.Code)
+	}
+	if w := do("GET", "/trash?type=site", ""); !strings.Contains(w.Body.String(), name) {
+		t.Errorf("deleted site missing from trash: %s", w.Body.String())
+	}
+
+	restore := fmt.Sprintf("/trash/site/%d/restore", site.ID)
+	if w := do("POST", restore, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("restore: expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusOK {
+		t.Errorf("get after restore: expected 200, got %d", w.Code)
+	}
+	if w := do("POST", restore, ""); w.Code != http.StatusNotFound {
+		t.Errorf("second restore: expected 404, got %d", w.Code)
+	}
+}
+
+func TestOrgOverride(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+
+	do := func(orgID int64, orgContext string) *httptest.ResponseRecorder {
+		token, err := jwtManager.GenerateToken(int64(1), orgID, []string{"org_admin"})
+		if err != nil {
+			t.Fatalf("Failed to generate test token: %v", err)
+		}
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("X-Org-Context", orgContext)
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(1, "1"); w.Code != http.StatusOK {
+		t.Errorf("main tenant, own org: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(1, "999999"); w.Code != http.StatusNotFound {
+		t.Errorf("main tenant, unknown org: expected 404, got %d", w.Code)
+	}
+	if w := do(2, "1"); w.Code != http.StatusForbidden {
+		t.Errorf("other tenant: expected 403, got %d", w.Code)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin", "viewer"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearer))
+		}
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	var session struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	w := do("/auth/sessions", token, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start session: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	json.NewDecoder(w.Body).Decode(&session)
+	first := session.RefreshToken
+
+	w = do("/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, first))
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.NewDecoder(w.Body).Decode(&session)
+	claims, err := jwtManager.ValidateToken(session.Token)
+	if err != nil || !claims.HasRole("viewer") {
+		t.Errorf("refreshed token: claims %+v, err %v", claims, err)
+	}
+
+	if w := do("/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, first)); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused refresh token: expected 401, got %d", w.Code)
+	}
+	if w := do("/auth/refresh", "", fmt.Sprintf(`{"refresh_token":%q}`, session.RefreshToken)); w.Code != http.StatusUnauthorized {
+		t.Errorf("rotated token after reuse: expected 401, got %d", w.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("GET", "/items"); w.Code != http.StatusOK {
+		t.Fatalf("before logout: expected 200, got %d", w.Code)
+	}
+	if w := do("POST", "/auth/logout"); w.Code != http.StatusNoContent {
+		t.Fatalf("logout: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/items"); w.Code != http.StatusUnauthorized {
+		t.Errorf("after logout: expected 401, got %d", w.Code)
+	}
+
+	// the revocation is persisted for other instances and restarts
+	claims, _ := jwtManager.ValidateToken(token)
+	var n int
+	if err := testServer.DB.QueryRow(`SELECT COUNT(*) FROM revoked_tokens WHERE jti = $1`, claims.ID).Scan(&n); err != nil || n != 1 {
+		t.Errorf("revoked_tokens rows for the token = %d, err %v", n, err)
+	}
+}
+
+func TestItemCursorPagination(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	prefix := fmt.Sprintf("CURSOR-%d", time.Now().UnixNano())
+	for i := 0; i < 5; i++ {
+		body := fmt.Sprintf(`{"asset_tag":"%s-%d","name":"%s item %d"}`, prefix, i, prefix, i)
+		if w := do("POST", "/items", body); w.Code != http.StatusCreated {
+			t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	seen := map[int]bool{}
+	path := "/items?limit=2&sort=-name&q=" + prefix
+	for pages := 0; path != ""; pages++ {
+		if pages > 5 {
+			t.Fatal("cursor pagination does not terminate")
+		}
+		w := do("GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []struct {
+				ID int `json:"id"`
+			} `json:"data"`
+			Page struct {
+				Total      int    `json:"total"`
+				NextCursor string `json:"next_cursor"`
+			} `json:"page"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp.Page.Total != 5 {
+			t.Errorf("page.total = %d, want 5", resp.Page.Total)
+		}
+		for _, it := range resp.Data {
+			if seen[it.ID] {
+				t.Errorf("item %d returned twice", it.ID)
+			}
+			seen[it.ID] = true
+		}
+		path = ""
+		if resp.Page.NextCursor != "" {
+			path = "/items?limit=2&sort=-name&q=" + prefix + "&cursor=" + resp.Page.NextCursor
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("paged through %d items, want 5", len(seen))
+	}
+
+	if w := do("GET", "/items?after_id=1&offset=10", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("after_id with offset: expected 400, got %d", w.Code)
+	}
+}
+
+func TestCrossOrgAccessIsNotFound(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+
+	do := func(orgID int64, method, path, body string) *httptest.ResponseRecorder {
+		token, err := jwtManager.GenerateToken(int64(1), orgID, []string{"org_admin"})
+		if err != nil {
+			t.Fatalf("Failed to generate test token: %v", err)
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().UnixNano()
+	w := do(1, "POST", "/items", fmt.Sprintf(`{"asset_tag":"XORG-%d","name":"Cross org"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var item struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&item); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	w = do(1, "POST", "/projects", fmt.Sprintf(`{"code":"XORG-%d","name":"Cross org"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var project struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&project); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	paths := []string{fmt.Sprintf("/items/%d", item.ID), fmt.Sprintf("/projects/%d", project.ID)}
+	for _, path := range paths {
+		for _, method := range []string{"GET", "PUT", "DELETE"} {
+			if w := do(2, method, path, `{"name":"Taken"}`); w.Code != http.StatusNotFound {
+				t.Errorf("%s %s from another org: expected 404, got %d: %s", method, path, w.Code, w.Body.String())
+			}
+		}
+		if w := do(1, "GET", path, ""); w.Code != http.StatusOK {
+			t.Errorf("GET %s from its own org after the attempts: expected 200, got %d", path, w.Code)
+		}
+	}
+	for _, path := range []string{"/items/abc", "/projects/abc", "/items/0/configs"} {
+		if w := do(1, "GET", path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestItemExportFile(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	prefix := fmt.Sprintf("EXPORT-%d", time.Now().UnixNano())
+	for i, status := range []string{"active", "retired"} {
+		body := fmt.Sprintf(`{"asset_tag":"%s-%d","name":"%s item","status":%q}`, prefix, i, prefix, status)
+		if w := do("POST", "/items", body); w.Code != http.StatusCreated {
+			t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	w := do("GET", "/items/export?q="+prefix+"&status=active", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("csv export: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id,asset_tag,") || !strings.Contains(lines[1], prefix+"-0") {
+		t.Errorf("csv export = %q", lines)
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), ".csv") {
+		t.Errorf("Content-Disposition = %q", w.Header().Get("Content-Disposition"))
+	}
+
+	w = do("GET", "/items/export?format=xlsx&q="+prefix, "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "PK") {
+		t.Errorf("xlsx export: expected a zip, got %d", w.Code)
+	}
+}
+
+func TestExportSiteScope(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	admin, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+	viewerID := 100000 + time.Now().UnixNano()%1000000
+	viewer, err := jwtManager.GenerateToken(viewerID, int64(1), []string{"viewer"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().UnixNano()
+	var granted int64
+	for _, name := range []string{"granted", "other"} {
+		site := fmt.Sprintf("Scope %s %d", name, suffix)
+		w := do(admin, "POST", "/sites", fmt.Sprintf(`{"name":%q}`, site))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create site: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var st struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if name == "granted" {
+			granted = st.ID
+		}
+		body := fmt.Sprintf(`{"asset_tag":"SCOPE-%d-%s","name":"scope %s","site":%q}`, suffix, name, name, site)
+		if w := do(admin, "POST", "/items", body); w.Code != http.StatusCreated {
+			t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := do(admin, "PUT", fmt.Sprintf("/users/%d/sites", viewerID), fmt.Sprintf(`{"site_ids":[%d]}`, granted)); w.Code != http.StatusOK {
+		t.Fatalf("grant site: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do(viewer, "POST", "/exports", fmt.Sprintf(`{"q":"SCOPE-%d"}`, suffix))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create export: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job struct {
+		ID          int64  `json:"id"`
+		Status      string `json:"status"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); job.DownloadURL == ""; {
+		if time.Now().After(deadline) {
+			t.Fatalf("export %d did not finish, status %s", job.ID, job.Status)
+		}
+		time.Sleep(100 * time.Millisecond)
+		w := do(viewer, "GET", fmt.Sprintf("/exports/%d", job.ID), "")
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if job.Status == "failed" {
+			t.Fatalf("export %d failed", job.ID)
+		}
+	}
+
+	w = do(viewer, "GET", job.DownloadURL, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("download: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	csv := w.Body.String()
+	if !strings.Contains(csv, fmt.Sprintf("SCOPE-%d-granted", suffix)) || strings.Contains(csv, fmt.Sprintf("SCOPE-%d-other", suffix)) {
+		t.Errorf("site-restricted export must hold the granted site's items only, got %q", csv)
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	admin, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", admin))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	tag := fmt.Sprintf("XLSX-%d", time.Now().UnixNano())
+	if w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":%q,"name":"xlsx export"}`, tag)); w.Code != http.StatusCreated {
+		t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	w := do("POST", "/exports", fmt.Sprintf(`{"format":"xlsx","q":%q}`, tag))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create export: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job struct {
+		ID          int64  `json:"id"`
+		Status      string `json:"status"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); job.DownloadURL == ""; {
+		if time.Now().After(deadline) {
+			t.Fatalf("export %d did not finish, status %s", job.ID, job.Status)
+		}
+		time.Sleep(100 * time.Millisecond)
+		w := do("GET", fmt.Sprintf("/exports/%d", job.ID), "")
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if job.Status == "failed" {
+			t.Fatalf("export %d failed", job.ID)
+		}
+	}
+
+	w = do("GET", job.DownloadURL, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), ".xlsx") {
+		t.Fatalf("download: expected an xlsx file, got %d %q", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("download is not a workbook: %v", err)
+	}
+	var sheet []byte
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sheet, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !bytes.Contains(sheet, []byte(tag)) {
+		t.Errorf("workbook does not list item %s", tag)
+	}
+}
+
+func TestItemLinks(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	create := func(name string) int {
+		w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"LINK-%d-%s","name":%q}`, time.Now().UnixNano(), name, name))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: expected 201, got %d: %s", name, w.Code, w.Body.String())
+		}
+		var it struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&it); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return it.ID
+	}
+	link := func(from, to int, kind string) *httptest.ResponseRecorder {
+		return do("POST", fmt.Sprintf("/items/%d/links", from), fmt.Sprintf(`{"kind":%q,"item_id":%d}`, kind, to))
+	}
+
+	chassis, card, other, ap := create("chassis"), create("card"), create("other"), create("ap")
+	if w := link(chassis, card, "contains"); w.Code != http.StatusCreated {
+		t.Fatalf("contains: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := link(other, card, "contains"); w.Code != http.StatusConflict {
+		t.Errorf("second parent: expected 409, got %d", w.Code)
+	}
+	if w := link(card, chassis, "contains"); w.Code != http.StatusConflict {
+		t.Errorf("cycle: expected 409, got %d", w.Code)
+	}
+	if w := link(ap, chassis, "uplinks_to"); w.Code != http.StatusCreated {
+		t.Errorf("uplink: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := link(ap, ap, "connected_to"); w.Code != http.StatusBadRequest {
+		t.Errorf("self link: expected 400, got %d", w.Code)
+	}
+
+	w := do("GET", fmt.Sprintf("/items/%d/links", chassis), "")
+	var list struct {
+		Data []struct {
+			Kind      string `json:"kind"`
+			Direction string `json:"direction"`
+			Item      struct {
+				ID int `json:"id"`
+			} `json:"item"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list.Data) != 2 || list.Data[0].Kind != "contains" || list.Data[0].Direction != "outgoing" || list.Data[0].Item.ID != card ||
+		list.Data[1].Direction != "incoming" || list.Data[1].Item.ID != ap {
+		t.Errorf("chassis links = %+v", list.Data)
+	}
+
+	if w := do("DELETE", fmt.Sprintf("/items/%d", chassis), ""); w.Code != http.StatusConflict {
+		t.Errorf("delete container: expected 409, got %d", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("/items/%d?cascade=true", chassis), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("cascade delete: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", fmt.Sprintf("/items/%d", card), ""); w.Code != http.StatusNotFound {
+		t.Errorf("contained item after cascade: expected 404, got %d", w.Code)
+	}
+	if w := do("GET", fmt.Sprintf("/items/%d/links", ap), ""); !strings.Contains(w.Body.String(), `"data":[]`) {
+		t.Errorf("links to trashed items should be hidden: %s", w.Body.String())
+	}
+}
+
+func TestItemWritesPublishOutboxEvents(t *testing.T) {
+	testutil.RequireIntegration(t)
+	// the server's own dispatcher would race this test for the events
+	testServer.Outbox.Stop()
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"OUTBOX-%d","name":"Outbox item"}`, time.Now().UnixNano()))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var it struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&it); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if w := do("PUT", fmt.Sprintf("/items/%d", it.ID), `{"notes":"moved"}`); w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", fmt.Sprintf("/items/%d", it.ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	// a rejected write records nothing
+	if w := do("PUT", fmt.Sprintf("/items/%d", it.ID), `{"notes":"gone"}`); w.Code != http.StatusNotFound {
+		t.Fatalf("update trashed: expected 404, got %d", w.Code)
+	}
+
+	var topics []string
+	failOnce := true
+	d := outbox.NewDispatcher(testServer.DB, 0, 0)
+	d.Subscribe(func(_ context.Context, e outbox.Event) error {
+		var payload struct {
+			ID int `json:"id"`
+		}
+		if err := json.Unmarshal(e.Payload, &payload); err != nil || payload.ID != it.ID {
+			return nil
+		}
+		if failOnce {
+			failOnce = false
+			return fmt.Errorf("subscriber unavailable")
+		}
+		topics = append(topics, e.Topic)
+		return nil
+	})
+	for i := 0; i < 100; i++ {
+		n, err := d.DispatchOnce(context.Background())
+		if err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	want := []string{"item.updated", "item.deleted"}
+	if strings.Join(topics, ",") != strings.Join(want, ",") {
+		t.Errorf("delivered topics = %v, want %v", topics, want)
+	}
+
+	// the failed delivery stays pending with a backoff
+	var attempts int
+	var lastError string
+	var pending bool
+	if err := testServer.DB.QueryRow(`
+		SELECT attempts, last_error, dispatched_at IS NULL AND next_attempt_at > NOW()
+		FROM outbox WHERE topic = 'item.created' AND (payload->>'id')::int = $1`, it.ID).Scan(&attempts, &lastError, &pending); err != nil {
+		t.Fatalf("read created event: %v", err)
+	}
+	if attempts != 1 || lastError != "subscriber unavailable" || !pending {
+		t.Errorf("created event: attempts=%d last_error=%q pending=%v", attempts, lastError, pending)
+	}
+}
+
+func TestProjectAssets(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	idOf := func(w *httptest.ResponseRecorder) int {
+		var v struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return v.ID
+	}
+
+	suffix := time.Now().UnixNano()
+	w := do("POST", "/projects", fmt.Sprintf(`{"code":"PA-%d","name":"Rollout"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	project := idOf(w)
+	var items []int
+	for i, status := range []string{"active", "active", "in_stock"} {
+		w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"PA-%d-%d","name":"Rollout AP %d","status":%q}`, suffix, i, suffix, status))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		items = append(items, idOf(w))
+	}
+
+	attach := func(body string) (int, int) {
+		w := do("POST", fmt.Sprintf("/projects/%d/assets", project), body)
+		var res struct {
+			Attached int `json:"attached"`
+		}
+		_ = json.NewDecoder(w.Body).Decode(&res)
+		return w.Code, res.Attached
+	}
+	if code, _ := attach(fmt.Sprintf(`{"item_ids":[%d,999999999]}`, items[0])); code != http.StatusBadRequest {
+		t.Errorf("unknown id: expected 400, got %d", code)
+	}
+	if code, _ := attach(`{}`); code != http.StatusBadRequest {
+		t.Errorf("empty body: expected 400, got %d", code)
+	}
+	if code, n := attach(fmt.Sprintf(`{"item_ids":[%d]}`, items[0])); code != http.StatusOK || n != 1 {
+		t.Errorf("attach by id: got %d, attached %d", code, n)
+	}
+	if code, n := attach(fmt.Sprintf(`{"filter":{"q":"Rollout AP %d","status":"active"}}`, suffix)); code != http.StatusOK || n != 1 {
+		t.Errorf("attach by filter: got %d, attached %d (want the one active item not yet attached)", code, n)
+	}
+
+	w = do("GET", fmt.Sprintf("/projects/%d/assets?sort=id", project), "")
+	var list struct {
+		Data []struct {
+			ID int `json:"id"`
+		} `json:"data"`
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if list.Total != 2 || len(list.Data) != 2 || list.Data[0].ID != items[0] || list.Data[1].ID != items[1] {
+		t.Errorf("project assets = %+v", list)
+	}
+	if w := do("GET", "/projects/999999999/assets", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown project: expected 404, got %d", w.Code)
+	}
+}
+
+func TestCustomFields(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	deviceType := fmt.Sprintf("cf-switch-%d", time.Now().UnixNano())
+	for _, def := range []string{
+		`{"device_type":%q,"key":"ports","type":"int","required":true}`,
+		`{"device_type":%q,"key":"band","type":"enum","options":["2.4GHz","5GHz"]}`,
+	} {
+		if w := do("POST", "/custom-fields", fmt.Sprintf(def, deviceType)); w.Code != http.StatusCreated {
+			t.Fatalf("define field: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := do("POST", "/custom-fields", fmt.Sprintf(`{"device_type":%q,"key":"ports","type":"text"}`, deviceType)); w.Code != http.StatusConflict {
+		t.Errorf("duplicate field: expected 409, got %d", w.Code)
+	}
+
+	tag := fmt.Sprintf("CF-%d", time.Now().UnixNano())
+	item := fmt.Sprintf(`{"asset_tag":%q,"name":"Access switch","device_type":%q,"custom_fields":%%s}`, tag, deviceType)
+	if w := do("POST", "/items", fmt.Sprintf(item, `{"band":"5GHz"}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("missing required field: expected 400, got %d", w.Code)
+	}
+	if w := do("POST", "/items", fmt.Sprintf(item, `{"ports":"48"}`)); w.Code != http.StatusBadRequest {
+		t.Errorf("wrong type: expected 400, got %d", w.Code)
+	}
+	w := do("POST", "/items", fmt.Sprintf(item, `{"ports":48}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID           int                    `json:"id"`
+		CustomFields map[string]interface{} `json:"custom_fields"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if w := do("PUT", fmt.Sprintf("/items/%d", created.ID), `{"custom_fields":{"band":"6GHz"}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("bad enum value: expected 400, got %d", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("/items/%d", created.ID), `{"custom_fields":{"ports":null}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("removing a required field: expected 400, got %d", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("/items/%d", created.ID), `{"custom_fields":{"band":"2.4GHz"}}`); w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", fmt.Sprintf("/items/%d", created.ID), "")
+	var got struct {
+		CustomFields map[string]interface{} `json:"custom_fields"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.CustomFields["ports"] != float64(48) || got.CustomFields["band"] != "2.4GHz" {
+		t.Errorf("custom_fields = %v, want ports merged with band", got.CustomFields)
+	}
+
+	w = do("GET", "/custom-fields?device_type="+deviceType, "")
+	if !strings.Contains(w.Body.String(), `"total":2`) {
+		t.Errorf("list definitions: %s", w.Body.String())
+	}
+}
+
+func TestProjectStats(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	idOf := func(w *httptest.ResponseRecorder) int {
+		var v struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return v.ID
+	}
+
+	suffix := time.Now().UnixNano()
+	w := do("POST", "/projects", fmt.Sprintf(`{"code":"PS-%d","name":"Stats"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	project := idOf(w)
+
+	var ids []string
+	for i, item := range []string{
+		`"device_type":"switch","status":"active"`,
+		`"device_type":"switch","status":"in_repair"`,
+		`"device_type":"ap","status":"active"`,
+		`"status":"ordered"`,
+	} {
+		w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"PS-%d-%d","name":"Stats item",%s}`, suffix, i, item))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		ids = append(ids, fmt.Sprint(idOf(w)))
+	}
+	if w := do("POST", fmt.Sprintf("/projects/%d/assets", project), `{"item_ids":[`+strings.Join(ids, ",")+`]}`); w.Code != http.StatusOK {
+		t.Fatalf("attach: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", "/items/"+ids[3], ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", w.Code)
+	}
+
+	w = do("GET", fmt.Sprintf("/projects/%d/stats", project), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var stats struct {
+		Assets       int            `json:"assets"`
+		ByDeviceType map[string]int `json:"by_device_type"`
+		ByStatus     map[string]int `json:"by_status"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stats.Assets != 3 || stats.ByDeviceType["switch"] != 2 || stats.ByDeviceType["ap"] != 1 ||
+		stats.ByStatus["active"] != 2 || stats.ByStatus["in_repair"] != 1 || stats.ByStatus["ordered"] != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if w := do("GET", "/projects/999999999/stats", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown project: expected 404, got %d", w.Code)
+	}
+}
+
+func TestItemTags(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().UnixNano()
+	core, prod := fmt.Sprintf("core-%d", suffix), fmt.Sprintf("prod-%d", suffix)
+	var ids []int
+	for i, tags := range [][]string{{core, prod}, {core}, {prod}} {
+		w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"TAG-%d-%d","name":"Tagged"}`, suffix, i))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var it struct {
+			ID int `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&it); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		ids = append(ids, it.ID)
+		body, _ := json.Marshal(map[string][]string{"tags": append(tags, strings.ToUpper(tags[0]))})
+		if w := do("POST", fmt.Sprintf("/items/%d/tags", it.ID), string(body)); w.Code != http.StatusOK {
+			t.Fatalf("tag: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	listIDs := func(path string) []int {
+		w := do("GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+		var list struct {
+			Data []struct {
+				ID int `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var out []int
+		for _, it := range list.Data {
+			out = append(out, it.ID)
+		}
+		return out
+	}
+	if got := listIDs("/items?sort=id&tag=" + core); fmt.Sprint(got) != fmt.Sprint(ids[:2]) {
+		t.Errorf("tag=core: got %v, want %v", got, ids[:2])
+	}
+	if got := listIDs("/items?sort=id&tag=" + core + "&tag=" + prod); fmt.Sprint(got) != fmt.Sprint(ids[:1]) {
+		t.Errorf("tag=core&tag=prod: got %v, want %v", got, ids[:1])
+	}
+
+	w := do("GET", fmt.Sprintf("/tags?q=core-%d", suffix), "")
+	if !strings.Contains(w.Body.String(), fmt.Sprintf(`{"tag":%q,"count":2}`, core)) {
+		t.Errorf("tag counts: %s", w.Body.String())
+	}
+
+	if w := do("DELETE", fmt.Sprintf("/items/%d/tags/%s", ids[1], core), ""); w.Code != http.StatusNoContent {
+		t.Errorf("untag: expected 204, got %d", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("/items/%d/tags/%s", ids[1], core), ""); w.Code != http.StatusNotFound {
+		t.Errorf("untag again: expected 404, got %d", w.Code)
+	}
+	w = do("GET", fmt.Sprintf("/items/%d/tags", ids[0]), "")
+	if !strings.Contains(w.Body.String(), fmt.Sprintf(`"tags":[%q,%q]`, core, prod)) {
+		t.Errorf("item tags: %s", w.Body.String())
+	}
+}
+
+func TestCustomRoles(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	adminToken, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+	suffix := time.Now().UnixNano()
+	role := fmt.Sprintf("clerk_%d", suffix)
+	clerkToken, err := jwtManager.GenerateToken(int64(2), int64(1), []string{role})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(clerkToken, "POST", "/items", fmt.Sprintf(`{"asset_tag":"ROLE-%d-0","name":"Clerk"}`, suffix)); w.Code != http.StatusForbidden {
+		t.Fatalf("undefined role: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(adminToken, "POST", "/roles", `{"name":"viewer","permissions":["assets:read"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("built-in name: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(adminToken, "POST", "/roles", `{"name":"x_bad","permissions":["assets:delete"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown permission: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do(adminToken, "POST", "/roles", fmt.Sprintf(`{"name":%q,"description":"Stock clerk","permissions":["assets:read","assets:write"]}`, role))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create role: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	defer do(adminToken, "DELETE", fmt.Sprintf("/roles/%d", created.ID), "")
+	if w := do(adminToken, "POST", "/roles", fmt.Sprintf(`{"name":%q,"permissions":["assets:read"]}`, role)); w.Code != http.StatusConflict {
+		t.Errorf("duplicate role: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// the role passes routes guarded by project_admin but not org_admin ones
+	if w := do(clerkToken, "POST", "/items", fmt.Sprintf(`{"asset_tag":"ROLE-%d-1","name":"Clerk"}`, suffix)); w.Code != http.StatusCreated {
+		t.Fatalf("custom role write: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(clerkToken, "POST", "/roles", `{"name":"x_escalate","permissions":["users:manage"]}`); w.Code != http.StatusForbidden {
+		t.Errorf("role management without users:manage: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(adminToken, "GET", "/roles", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"org_admin"`) || !strings.Contains(w.Body.String(), role) {
+		t.Errorf("list roles: %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do(adminToken, "PUT", fmt.Sprintf("/roles/%d", created.ID), `{"permissions":["assets:read"]}`); w.Code != http.StatusOK {
+		t.Fatalf("update role: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(clerkToken, "POST", "/items", fmt.Sprintf(`{"asset_tag":"ROLE-%d-2","name":"Clerk"}`, suffix)); w.Code != http.StatusForbidden {
+		t.Errorf("after dropping assets:write: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(clerkToken, "GET", "/items?limit=1", ""); w.Code != http.StatusOK {
+		t.Errorf("read with assets:read: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do(adminToken, "DELETE", fmt.Sprintf("/roles/%d", created.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete role: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestVendorScorecard(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := time.Now().UnixNano()
+	w := do("POST", "/vendors", fmt.Sprintf(`{"name":"Scorecard %d"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create vendor: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var vendor struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&vendor); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	future := time.Now().AddDate(1, 0, 0).Format(time.RFC3339)
+	past := time.Now().AddDate(-1, 0, 0).Format(time.RFC3339)
+	for i, it := range []struct{ status, warranty string }{
+		{"active", future}, {"active", past}, {"active", ""}, {"in_repair", future}, {"retired", past},
+	} {
+		body := fmt.Sprintf(`{"asset_tag":"VSC-%d-%d","name":"Scored","status":%q`, suffix, i, it.status)
+		if it.warranty != "" {
+			body += fmt.Sprintf(`,"warranty_end":%q`, it.warranty)
+		}
+		w := do("POST", "/items", body+"}")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var item struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&item); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		// items have no vendor field in the API yet
+		if _, err := testServer.DB.Exec(`UPDATE inventory SET vendor_id = $1 WHERE id = $2`, vendor.ID, item.ID); err != nil {
+			t.Fatalf("assign vendor: %v", err)
+		}
+	}
+
+	w = do("GET", fmt.Sprintf("/vendors/%d/scorecard", vendor.ID), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("scorecard: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var card struct {
+		Assets      int            `json:"assets"`
+		ByStatus    map[string]int `json:"by_status"`
+		FailureRate float64        `json:"failure_rate"`
+		Warranty    struct {
+			Covered      int     `json:"covered"`
+			Expired      int     `json:"expired"`
+			Unknown      int     `json:"unknown"`
+			CoverageRate float64 `json:"coverage_rate"`
+		} `json:"warranty"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&card); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if card.Assets != 5 || card.ByStatus["active"] != 3 || card.FailureRate != 0.25 {
+		t.Errorf("counts = %+v", card)
+	}
+	if card.Warranty.Covered != 2 || card.Warranty.Expired != 1 || card.Warranty.Unknown != 1 || card.Warranty.CoverageRate != 0.5 {
+		t.Errorf("warranty = %+v", card.Warranty)
+	}
+
+	if w := do("GET", "/vendors/999999999/scorecard", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown vendor: expected 404, got %d", w.Code)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		} else {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/auth/api-keys", "", `{"name":"integration","roles":["viewer"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create key: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID  int64  `json:"id"`
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if w := do("GET", "/items?limit=1", created.Key, ""); w.Code != http.StatusOK {
+		t.Errorf("read with key: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/items", created.Key, `{"asset_tag":"KEY-1","name":"Denied"}`); w.Code != http.StatusForbidden {
+		t.Errorf("viewer key write: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("GET", "/auth/api-keys", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"last_used_at"`) || strings.Contains(w.Body.String(), created.Key) {
+		t.Errorf("list keys: %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("DELETE", fmt.Sprintf("/auth/api-keys/%d", created.ID), "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke key: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/items?limit=1", created.Key, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: expected 401, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// mailerFunc adapts a function to mail.Mailer
+type mailerFunc func(ctx context.Context, m mail.Message) error
+
+func (f mailerFunc) Send(ctx context.Context, m mail.Message) error { return f(ctx, m) }
+
+func TestMailQueue(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	good := fmt.Sprintf("ok-%d@example.com", suffix)
+	bad := fmt.Sprintf("bounce-%d@example.com", suffix)
+	var sent []string
+	fail := true
+	queue := mail.NewQueue(testServer.DB, mailerFunc(func(_ context.Context, m mail.Message) error {
+		if m.To[0] == bad && fail {
+			return mail.Permanent(fmt.Errorf("mailbox unavailable"))
+		}
+		sent = append(sent, m.To[0])
+		return nil
+	}), 0, 3)
+
+	var badID int64
+	for _, to := range []string{good, bad} {
+		id, err := mail.Enqueue(ctx, testServer.DB, 1, mail.KindTest, mail.Message{To: []string{to}, Subject: "Queue test", Text: "Hello"})
+		if err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+		if to == bad {
+			badID = id
+		}
+	}
+	for {
+		n, err := queue.SendOnce(ctx)
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	logFor := func(status string) string {
+		w := do("GET", "/admin/emails?kind=test&limit=200&status="+status, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("send log: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+	if log := logFor("sent"); !strings.Contains(log, good) || strings.Contains(log, `"body"`) {
+		t.Errorf("sent log: %s", log)
+	}
+	if log := logFor("dead"); !strings.Contains(log, bad) || !strings.Contains(log, "mailbox unavailable") {
+		t.Errorf("dead letters: %s", log)
+	}
+
+	fail = false
+	if w := do("POST", fmt.Sprintf("/admin/emails/%d/retry", badID), ""); w.Code != http.StatusAccepted {
+		t.Fatalf("retry: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", fmt.Sprintf("/admin/emails/%d/retry", badID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("retry of a pending message: expected 404, got %d", w.Code)
+	}
+	if _, err := queue.SendOnce(ctx); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(sent) != 2 || sent[1] != bad {
+		t.Errorf("sent = %v", sent)
+	}
+}
+
+func TestEmailTemplates(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	do("DELETE", "/email-templates/report", "")
+
+	w := do("GET", "/email-templates", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list = %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"key":"password_reset"`) {
+		t.Errorf("list lacks built-in templates: %s", w.Body.String())
+	}
+
+	if w := do("PUT", "/email-templates/report", `{"subject":"{{.ReportNam}}","body":"x"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("override with unknown field = %d, want 422", w.Code)
+	}
+	if w := do("PUT", "/email-templates/nope", `{"subject":"s","body":"b"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown key = %d, want 404", w.Code)
+	}
+	w = do("PUT", "/email-templates/report", `{"subject":"Report: {{.ReportName}}","body":"Get it at {{.DownloadURL}}"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"overridden":true`) {
+		t.Fatalf("override = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/email-templates/report/preview", `{"data":{"ReportName":"Q3 spend"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview = %d: %s", w.Code, w.Body.String())
+	}
+	var preview struct{ Subject, Body string }
+	if err := json.NewDecoder(w.Body).Decode(&preview); err != nil {
+		t.Fatal(err)
+	}
+	if preview.Subject != "Report: Q3 spend" || !strings.HasPrefix(preview.Body, "Get it at https://") {
+		t.Errorf("preview = %+v", preview)
+	}
+	if w := do("POST", "/email-templates/report/preview", `{"body":"{{.Nope}}"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("preview of a broken draft = %d, want 422", w.Code)
+	}
+
+	if w := do("DELETE", "/email-templates/report", ""); w.Code != http.StatusNoContent {
+		t.Errorf("revert = %d, want 204", w.Code)
+	}
+	w = do("GET", "/email-templates/report", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"overridden":false`) {
+		t.Errorf("after revert = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+
+	do := func(orgID int64, method, path, orgContext string) *httptest.ResponseRecorder {
+		token, err := jwtManager.GenerateToken(int64(7), orgID, []string{"org_admin"})
+		if err != nil {
+			t.Fatalf("Failed to generate test token: %v", err)
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		if orgContext != "" {
+			req.Header.Set("X-Org-Context", orgContext)
+		}
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	var orgID int64
+	if err := testServer.DB.QueryRow(`INSERT INTO organizations (name) VALUES ($1) RETURNING id`,
+		fmt.Sprintf("access-log-%d", time.Now().UnixNano())).Scan(&orgID); err != nil {
+		t.Fatalf("create org: %v", err)
+	}
+	target := strconv.FormatInt(orgID, 10)
+	do(1, "GET", "/org/branding", target)
+	do(1, "PUT", "/org/branding", target)
+
+	if w := do(2, "GET", "/admin/access-log", ""); w.Code != http.StatusForbidden {
+		t.Errorf("other tenant = %d, want 403", w.Code)
+	}
+	w := do(1, "GET", "/admin/access-log?org_id="+target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("access log = %d: %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Data []struct {
+			UserID    int64    `json:"user_id"`
+			OrgID     int64    `json:"org_id"`
+			Requests  int      `json:"requests"`
+			Writes    int      `json:"writes"`
+			Resources []string `json:"resources"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Data) != 1 {
+		t.Fatalf("entries = %+v, want one", out.Data)
+	}
+	if e := out.Data[0]; e.UserID != 7 || e.OrgID != orgID || e.Requests != 2 || e.Writes != 1 ||
+		len(e.Resources) != 1 || e.Resources[0] != "org" {
+		t.Errorf("entry = %+v", e)
+	}
+	if w := do(1, "GET", "/admin/access-log?since=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("bad since = %d, want 400", w.Code)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	type received struct {
+		signature string
+		body      []byte
+	}
+	var got []received
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, received{r.Header.Get(webhook.SignatureHeader), body})
+	}))
+	defer endpoint.Close()
+
+	if w := do("POST", "/webhooks", `{"url":"`+endpoint.URL+`","events":["import.completed"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown event = %d, want 400", w.Code)
+	}
+	w := do("POST", "/webhooks", `{"url":"`+endpoint.URL+`","events":["item.created"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	var hook webhook.Webhook
+	if err := json.NewDecoder(w.Body).Decode(&hook); err != nil || hook.Secret == "" {
+		t.Fatalf("created webhook %+v, err %v", hook, err)
+	}
+	defer do("DELETE", fmt.Sprintf("/webhooks/%d", hook.ID), "")
+	if strings.Contains(do("GET", fmt.Sprintf("/webhooks/%d", hook.ID), "").Body.String(), hook.Secret) {
+		t.Error("secret is returned after creation")
+	}
+
+	tag := fmt.Sprintf("HOOK-%d", time.Now().UnixNano())
+	if w := do("POST", "/items", `{"asset_tag":"`+tag+`","name":"Webhook item","status":"in_stock"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create item = %d: %s", w.Code, w.Body.String())
+	}
+
+	ctx := context.Background()
+	d := outbox.NewDispatcher(testServer.DB, 0, 0)
+	d.Subscribe(webhook.Fanout(testServer.DB, nil))
+	for i := 0; i < 100; i++ {
+		if n, err := d.DispatchOnce(ctx); err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		} else if n == 0 {
+			break
+		}
+	}
+	sender := webhook.NewSender(testServer.DB, webhook.NewClient(true), 0, 3)
+	for {
+		n, err := sender.SendOnce(ctx)
+		if err != nil {
+			t.Fatalf("SendOnce: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	var delivered *received
+	for i := range got {
+		if strings.Contains(string(got[i].body), tag) {
+			delivered = &got[i]
+		}
+	}
+	if delivered == nil {
+		t.Fatalf("no delivery for %s among %d requests", tag, len(got))
+	}
+	var ts int64
+	fmt.Sscanf(delivered.signature, "t=%d,", &ts)
+	if want := webhook.Sign(hook.Secret, time.Unix(ts, 0), delivered.body); delivered.signature != want {
+		t.Errorf("signature = %s, want %s", delivered.signature, want)
+	}
+
+	w = do("GET", fmt.Sprintf("/webhooks/%d/deliveries?status=delivered", hook.ID), "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"event":"item.created"`) {
+		t.Errorf("deliveries = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("PUT", fmt.Sprintf("/webhooks/%d", hook.ID), `{"active":false}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":false`) {
+		t.Errorf("deactivate = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIPAM(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	// a /29 in 10.<a>.<b>.0/16 unlikely to clash with earlier runs
+	n := time.Now().UnixNano()
+	base := fmt.Sprintf("10.%d.%d", n%250+1, (n/250)%250)
+	cidr := base + ".0/29"
+	w := do("POST", "/subnets", `{"cidr":"`+cidr+`","name":"mgmt","vlan_id":10,"gateway":"`+base+`.1"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create subnet = %d: %s", w.Code, w.Body.String())
+	}
+	var sn struct {
+		ID   int64  `json:"id"`
+		Size string `json:"size"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&sn); err != nil || sn.Size != "6" {
+		t.Fatalf("subnet %+v, err %v", sn, err)
+	}
+	defer func() {
+		testServer.DB.Exec(`DELETE FROM subnets WHERE id = $1`, sn.ID)
+	}()
+
+	if w := do("POST", "/subnets", `{"cidr":"`+base+`.0/28","name":"overlap"}`); w.Code != http.StatusConflict ||
+		!strings.Contains(w.Body.String(), "SUBNET_OVERLAP") {
+		t.Errorf("overlapping subnet = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/subnets", `{"cidr":"`+base+`.1/29","name":"host bits"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("cidr with host bits = %d, want 400", w.Code)
+	}
+
+	// site_id must name a live site of the caller's org
+	var foreignSite, trashedSite int64
+	if err := testServer.DB.QueryRow(`INSERT INTO sites (org_id, name) VALUES (2, 'ipam foreign') RETURNING id`).Scan(&foreignSite); err != nil {
+		t.Fatal(err)
+	}
+	if err := testServer.DB.QueryRow(`INSERT INTO sites (org_id, name, deleted_at) VALUES (1, 'ipam trashed', NOW()) RETURNING id`).Scan(&trashedSite); err != nil {
+		t.Fatal(err)
+	}
+	defer testServer.DB.Exec(`DELETE FROM sites WHERE id IN ($1, $2)`, foreignSite, trashedSite)
+	for _, site := range []int64{foreignSite, trashedSite} {
+		if w := do("POST", "/subnets", fmt.Sprintf(`{"cidr":"%s.8/29","name":"elsewhere","site_id":%d}`, base, site)); w.Code != http.StatusBadRequest {
+			t.Errorf("create with site %d = %d, want 400", site, w.Code)
+		}
+		if w := do("PUT", fmt.Sprintf("/subnets/%d", sn.ID), fmt.Sprintf(`{"site_id":%d}`, site)); w.Code != http.StatusBadRequest {
+			t.Errorf("update with site %d = %d, want 400", site, w.Code)
+		}
+	}
+
+	ips := fmt.Sprintf("/subnets/%d/ips", sn.ID)
+	if w := do("POST", ips, `{"address":"`+base+`.3","hostname":"sw1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("reserve = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", ips, `{"address":"`+base+`.3"}`); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "IP_IN_USE") {
+		t.Errorf("duplicate reservation = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", ips, `{"address":"`+base+`.7"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("broadcast address = %d, want 400", w.Code)
+	}
+
+	// next free skips the gateway (.1) and the reservation (.3)
+	var allocated []string
+	for i := 0; i < 4; i++ {
+		w := do("POST", ips, `{}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("allocate = %d: %s", w.Code, w.Body.String())
+		}
+		var ip struct{ Address string }
+		json.NewDecoder(w.Body).Decode(&ip)
+		allocated = append(allocated, strings.TrimPrefix(ip.Address, base))
+	}
+	if got := strings.Join(allocated, ","); got != ".2,.4,.5,.6" {
+		t.Errorf("allocated %s, want .2,.4,.5,.6", got)
+	}
+	if w := do("POST", ips, `{}`); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "SUBNET_FULL") {
+		t.Errorf("full subnet = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("GET", "/subnets/lookup?address="+base+".3", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"hostname":"sw1"`) || !strings.Contains(w.Body.String(), cidr) {
+		t.Errorf("lookup = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", fmt.Sprintf("/subnets/%d", sn.ID), ""); w.Code != http.StatusConflict {
+		t.Errorf("delete non-empty subnet = %d, want 409", w.Code)
+	}
+}
+
+func TestProjectAdminScope(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	admin, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+	memberID := 200000 + time.Now().UnixNano()%1000000
+	member, err := jwtManager.GenerateToken(memberID, int64(1), []string{"project_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	id := func(w *httptest.ResponseRecorder) int64 {
+		var v struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return v.ID
+	}
+
+	suffix := time.Now().UnixNano()
+	w := do(admin, "POST", "/projects", fmt.Sprintf(`{"code":"PSC-%d","name":"Scoped"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	project := id(w)
+	w = do(admin, "POST", "/items", fmt.Sprintf(`{"asset_tag":"PSC-%d-in","name":"In project","project_id":%d}`, suffix, project))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	inside := id(w)
+	w = do(admin, "POST", "/items", fmt.Sprintf(`{"asset_tag":"PSC-%d-out","name":"Outside"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create item: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	outside := id(w)
+	if w := do(admin, "PUT", fmt.Sprintf("/users/%d/projects", memberID), fmt.Sprintf(`{"project_ids":[%d]}`, project)); w.Code != http.StatusOK {
+		t.Fatalf("add member: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	n := time.Now().UnixNano()
+	base := fmt.Sprintf("10.%d.%d", n%250+1, (n/250)%250)
+	w = do(admin, "POST", "/subnets", `{"cidr":"`+base+`.0/29","name":"scoped"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create subnet = %d: %s", w.Code, w.Body.String())
+	}
+	subnet := id(w)
+	defer func() {
+		testServer.DB.Exec(`DELETE FROM ip_addresses WHERE subnet_id = $1`, subnet)
+		testServer.DB.Exec(`DELETE FROM subnets WHERE id = $1`, subnet)
+	}()
+	ips := fmt.Sprintf("/subnets/%d/ips", subnet)
+	if w := do(member, "POST", ips, fmt.Sprintf(`{"item_id":%d}`, outside)); w.Code != http.StatusBadRequest {
+		t.Errorf("reserve for an item outside the member's projects: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	w = do(admin, "POST", ips, fmt.Sprintf(`{"item_id":%d}`, outside))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("reserve as org_admin = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(member, "DELETE", fmt.Sprintf("%s/%d", ips, id(w)), ""); w.Code != http.StatusNotFound {
+		t.Errorf("release an address of an item outside the member's projects: expected 404, got %d", w.Code)
+	}
+	if w := do(member, "POST", ips, fmt.Sprintf(`{"item_id":%d}`, inside)); w.Code != http.StatusCreated {
+		t.Errorf("reserve for an item of the member's project: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do(member, "POST", "/exports", fmt.Sprintf(`{"q":"PSC-%d"}`, suffix))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("create export: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var job struct {
+		ID          int64  `json:"id"`
+		Status      string `json:"status"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for deadline := time.Now().Add(10 * time.Second); job.DownloadURL == ""; {
+		if time.Now().After(deadline) || job.Status == "failed" {
+			t.Fatalf("export %d did not succeed, status %s", job.ID, job.Status)
+		}
+		time.Sleep(100 * time.Millisecond)
+		w := do(member, "GET", fmt.Sprintf("/exports/%d", job.ID), "")
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	csv := do(member, "GET", job.DownloadURL, "").Body.String()
+	if !strings.Contains(csv, fmt.Sprintf("PSC-%d-in", suffix)) || strings.Contains(csv, fmt.Sprintf("PSC-%d-out", suffix)) {
+		t.Errorf("project admin export must hold their projects' items only, got %q", csv)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	tag := fmt.Sprintf("COLD-%d", time.Now().UnixNano())
+	w := do("POST", "/items", `{"asset_tag":"`+tag+`","name":"Cold switch","status":"retired"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d: %s", w.Code, w.Body.String())
+	}
+	var item struct {
+		ID int `json:"id"`
+	}
+	json.NewDecoder(w.Body).Decode(&item)
+	defer func() {
+		testServer.DB.Exec(`DELETE FROM inventory_archive WHERE id = $1`, item.ID)
+		testServer.DB.Exec(`DELETE FROM inventory WHERE id = $1`, item.ID)
+	}()
+
+	// backdate the last change; the updated_at trigger would overwrite it
+	tx, err := testServer.DB.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`ALTER TABLE inventory DISABLE TRIGGER trg_inventory_updated_at`,
+		`UPDATE inventory SET updated_at = NOW() - INTERVAL '6 years' WHERE id = ` + strconv.Itoa(item.ID),
+		`ALTER TABLE inventory ENABLE TRIGGER trg_inventory_updated_at`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			tx.Rollback()
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := do("POST", "/admin/archive", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("archive without an age = %d, want 400", w.Code)
+	}
+	w = do("POST", "/admin/archive", `{"older_than_years":5}`)
+	var run struct{ Archived int }
+	if json.NewDecoder(w.Body).Decode(&run); w.Code != http.StatusOK || run.Archived < 1 {
+		t.Fatalf("archive = %d, archived %d", w.Code, run.Archived)
+	}
+
+	path := fmt.Sprintf("/items/%d", item.ID)
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("archived item = %d, want 404", w.Code)
+	}
+	w = do("GET", "/archive?q="+tag, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Cold switch"`) {
+		t.Errorf("archive list = %d: %s", w.Code, w.Body.String())
+	}
+	w = do("GET", fmt.Sprintf("/archive/%d", item.ID), "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"asset_tag":"`+tag+`"`) {
+		t.Errorf("archived item = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", fmt.Sprintf("/archive/%d/restore", item.ID), "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"retired"`) {
+		t.Fatalf("restore = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusOK {
+		t.Errorf("restored item = %d, want 200", w.Code)
+	}
+	if w := do("POST", fmt.Sprintf("/archive/%d/restore", item.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("second restore = %d, want 404", w.Code)
+	}
+}
+
+func TestItemDetails(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	tag := fmt.Sprintf("AP-%d", time.Now().UnixNano())
+	w := do("POST", "/items", `{"asset_tag":"`+tag+`","name":"Lobby AP","device_type":"access_point",
+		"details":{"wifi_standards":["802.11ac","802.11ax"],"max_clients":150}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d: %s", w.Code, w.Body.String())
+	}
+	var item struct {
+		ID      int `json:"id"`
+		Details struct {
+			WifiStandards []string `json:"wifi_standards"`
+			MaxClients    int      `json:"max_clients"`
+			Outdoor       *bool    `json:"outdoor"`
+		} `json:"details"`
+	}
+	json.NewDecoder(w.Body).Decode(&item)
+	defer testServer.DB.Exec(`DELETE FROM inventory WHERE id = $1`, item.ID)
+	if item.Details.MaxClients != 150 || len(item.Details.WifiStandards) != 2 {
+		t.Errorf("created details = %+v", item.Details)
+	}
+
+	path := fmt.Sprintf("/items/%d", item.ID)
+	if w := do("PUT", path, `{"details":{"outdoor":true}}`); w.Code != http.StatusOK {
+		t.Fatalf("update details: %d: %s", w.Code, w.Body.String())
+	}
+	json.NewDecoder(do("GET", path, "").Body).Decode(&item)
+	if item.Details.MaxClients != 150 || item.Details.Outdoor == nil || !*item.Details.Outdoor {
+		t.Errorf("details after update = %+v", item.Details)
+	}
+
+	if w := do("PUT", path, `{"details":{"ram_gb":64}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("server details on an access point = %d, want 400", w.Code)
+	}
+	if w := do("POST", "/items", `{"asset_tag":"X-`+tag+`","name":"Switch","device_type":"switch","details":{}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("details on a switch = %d, want 400", w.Code)
+	}
+
+	w = do("GET", "/access-points?q="+tag, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"max_clients":150`) {
+		t.Errorf("access points = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/servers?q="+tag, ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), tag) {
+		t.Errorf("servers = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRacks(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	w := do("POST", "/sites", `{"name":"DC `+suffix+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create site: %d: %s", w.Code, w.Body.String())
+	}
+	var site struct{ ID int }
+	json.NewDecoder(w.Body).Decode(&site)
+	defer testServer.DB.Exec(`DELETE FROM sites WHERE id = $1`, site.ID)
+
+	w = do("POST", "/racks", fmt.Sprintf(`{"site_id":%d,"name":"A01","units":10}`, site.ID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create rack: %d: %s", w.Code, w.Body.String())
+	}
+	var rack struct{ ID int64 }
+	json.NewDecoder(w.Body).Decode(&rack)
+
+	var itemIDs []int
+	defer func() {
+		for _, id := range itemIDs {
+			testServer.DB.Exec(`DELETE FROM inventory WHERE id = $1`, id)
+		}
+	}()
+	place := func(tag string, position, units int) *httptest.ResponseRecorder {
+		w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"%s-%s","name":"%s","rack_id":%d,"rack_position":%d,"rack_units":%d}`,
+			tag, suffix, tag, rack.ID, position, units))
+		if w.Code == http.StatusCreated {
+			var it struct{ ID int }
+			json.Unmarshal(w.Body.Bytes(), &it)
+			itemIDs = append(itemIDs, it.ID)
+		}
+		return w
+	}
+	if w := place("core", 8, 2); w.Code != http.StatusCreated {
+		t.Fatalf("rack item: %d: %s", w.Code, w.Body.String())
+	}
+	if w := place("ups", 1, 3); w.Code != http.StatusCreated {
+		t.Fatalf("rack item: %d: %s", w.Code, w.Body.String())
+	}
+	if w := place("clash", 9, 1); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "RACK_UNITS_TAKEN") {
+		t.Errorf("overlapping item = %d: %s", w.Code, w.Body.String())
+	}
+	if w := place("tall", 9, 4); w.Code != http.StatusBadRequest {
+		t.Errorf("item above the top = %d, want 400", w.Code)
+	}
+
+	w = do("GET", fmt.Sprintf("/racks/%d/elevation", rack.ID), "")
+	var elev struct {
+		FreeUnits int `json:"free_units"`
+		Slots     []struct {
+			Position int
+			Units    int
+			Item     *struct{ Name string }
+		}
+	}
+	if err := json.NewDecoder(w.Body).Decode(&elev); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("elevation = %d, %v", w.Code, err)
+	}
+	var layout []string
+	for _, sl := range elev.Slots {
+		name := "-"
+		if sl.Item != nil {
+			name = sl.Item.Name
+		}
+		layout = append(layout, fmt.Sprintf("%s@%d+%d", name, sl.Position, sl.Units))
+	}
+	if got := strings.Join(layout, " "); got != "-@10+1 core@8+2 -@4+4 ups@1+3" || elev.FreeUnits != 5 {
+		t.Errorf("elevation = %s, free %d", got, elev.FreeUnits)
+	}
+
+	if w := do("PUT", fmt.Sprintf("/racks/%d", rack.ID), `{"units":8}`); w.Code != http.StatusConflict {
+		t.Errorf("shrink below an item = %d, want 409", w.Code)
+	}
+	if w := do("DELETE", fmt.Sprintf("/racks/%d", rack.ID), ""); w.Code != http.StatusConflict {
+		t.Errorf("delete non-empty rack = %d, want 409", w.Code)
+	}
+	for _, id := range itemIDs {
+		if w := do("PUT", fmt.Sprintf("/items/%d", id), `{"rack_id":0}`); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "rack_position") {
+			t.Errorf("unrack = %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if w := do("DELETE", fmt.Sprintf("/racks/%d", rack.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete empty rack = %d, want 204", w.Code)
+	}
+}
+
+func TestWarrantyExpiringReport(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	site := "Coverage " + suffix
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	day := func(n int) string { return today.AddDate(0, 0, n).Format(time.RFC3339) }
+
+	var itemIDs []int
+	defer func() {
+		for _, id := range itemIDs {
+			testServer.DB.Exec(`DELETE FROM inventory WHERE id = $1`, id)
+		}
+	}()
+	create := func(tag, fields string) int {
+		w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"%s-%s","name":"%s","site":"%s",%s}`, tag, suffix, tag, site, fields))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d: %s", tag, w.Code, w.Body.String())
+		}
+		var it struct{ ID int }
+		json.Unmarshal(w.Body.Bytes(), &it)
+		itemIDs = append(itemIDs, it.ID)
+		return it.ID
+	}
+	create("soon", `"warranty_start":"`+day(-700)+`","warranty_end":"`+day(10)+`"`)
+	create("contract", `"warranty_end":"`+day(-30)+`","support_contract":"SC-1","support_level":"next business day","support_end":"`+day(30)+`"`)
+	create("later", `"warranty_end":"`+day(200)+`"`)
+	create("renewed", `"warranty_end":"`+day(5)+`","support_end":"`+day(400)+`"`)
+	create("retired", `"warranty_end":"`+day(5)+`","status":"retired"`)
+
+	if w := do("POST", "/items", `{"asset_tag":"bad-`+suffix+`","name":"bad","warranty_start":"`+day(10)+`","warranty_end":"`+day(1)+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("warranty_start after warranty_end = %d, want 400", w.Code)
+	}
+	if w := do("PUT", fmt.Sprintf("/items/%d", itemIDs[0]), `{"warranty_start":"`+day(20)+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("update warranty_start after stored warranty_end = %d, want 400: %s", w.Code, w.Body.String())
+	}
+
+	w := do("GET", "/reports/warranty-expiring?days=90", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("report: %d: %s", w.Code, w.Body.String())
+	}
+	var report struct {
+		Days   int
+		Groups []struct {
+			Site  string
+			Count int
+			Items []struct {
+				AssetTag        string `json:"asset_tag"`
+				SupportContract string `json:"support_contract"`
+				CoverageEnd     string `json:"coverage_end"`
+				DaysLeft        int    `json:"days_left"`
+			}
+		}
+	}
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Days != 90 {
+		t.Errorf("days = %d, want 90", report.Days)
+	}
+	var got []string
+	for _, g := range report.Groups {
+		if g.Site != site {
+			continue
+		}
+		for _, it := range g.Items {
+			got = append(got, fmt.Sprintf("%s:%d:%s", strings.TrimSuffix(it.AssetTag, "-"+suffix), it.DaysLeft, it.SupportContract))
+		}
+	}
+	if want := "soon:10: contract:30:SC-1"; strings.Join(got, " ") != want {
+		t.Errorf("expiring = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if w := do("GET", "/reports/warranty-expiring?days=-1", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("days=-1 = %d, want 400", w.Code)
+	}
+}
+
+func TestTopQueries(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	get := func(orgID int64, path string) *httptest.ResponseRecorder {
+		token, err := jwtManager.GenerateToken(int64(1), orgID, []string{"org_admin"})
+		if err != nil {
+			t.Fatalf("Failed to generate test token: %v", err)
+		}
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(2, "/admin/db/top-queries"); w.Code != http.StatusForbidden {
+		t.Errorf("other org = %d, want 403", w.Code)
+	}
+
+	w := get(1, "/admin/db/top-queries?limit=5")
+	switch w.Code {
+	case http.StatusServiceUnavailable:
+		// the test database does not preload pg_stat_statements
+		if !strings.Contains(w.Body.String(), "PG_STAT_STATEMENTS_UNAVAILABLE") {
+			t.Errorf("unavailable body = %s", w.Body.String())
+		}
+	case http.StatusOK:
+		var resp struct {
+			Data []struct {
+				Query string  `json:"query"`
+				Calls int64   `json:"calls"`
+				Total float64 `json:"total_ms"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Data) > 5 {
+			t.Errorf("got %d queries, want at most 5", len(resp.Data))
+		}
+		for i := 1; i < len(resp.Data); i++ {
+			if resp.Data[i].Total > resp.Data[i-1].Total {
+				t.Errorf("queries not ordered by total time: %+v", resp.Data)
+			}
+		}
+	default:
+		t.Fatalf("top queries = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSequences(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	name := "po_" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	defer testServer.DB.Exec(`DELETE FROM sequences WHERE name = $1`, name)
+
+	if w := do("POST", "/sequences", fmt.Sprintf(`{"name":"%s","prefix":"PO-","padding":4,"last_value":99}`, name)); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/sequences", fmt.Sprintf(`{"name":"%s"}`, name)); w.Code != http.StatusConflict {
+		t.Errorf("duplicate name = %d, want 409", w.Code)
+	}
+
+	type values struct {
+		First  int64    `json:"first"`
+		Last   int64    `json:"last"`
+		Values []string `json:"values"`
+	}
+	next := func(body string) values {
+		w := do("POST", "/sequences/"+name+"/next", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("next: %d: %s", w.Code, w.Body.String())
+		}
+		var v values
+		if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if v := next(""); v.First != 100 || len(v.Values) != 1 || v.Values[0] != "PO-0100" {
+		t.Errorf("first allocation = %+v, want PO-0100", v)
+	}
+	if v := next(`{"count":3}`); v.First != 101 || v.Last != 103 || len(v.Values) != 3 || v.Values[2] != "PO-0103" {
+		t.Errorf("batch allocation = %+v, want PO-0101..PO-0103", v)
+	}
+
+	// Concurrent callers never share a number
+	const callers = 20
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		seen = make(map[string]bool)
+	)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := do("POST", "/sequences/"+name+"/next", "")
+			var v values
+			if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&v) != nil || len(v.Values) != 1 {
+				t.Errorf("concurrent next: %d: %s", w.Code, w.Body.String())
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[v.Values[0]] {
+				t.Errorf("%s handed out twice", v.Values[0])
+			}
+			seen[v.Values[0]] = true
+		}()
+	}
+	wg.Wait()
+
+	w := do("PUT", "/sequences/"+name, `{"prefix":"PO/2026/"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d: %s", w.Code, w.Body.String())
+	}
+	var seq struct {
+		Prefix    string `json:"prefix"`
+		LastValue int64  `json:"last_value"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &seq)
+	if seq.Prefix != "PO/2026/" || seq.LastValue != 103+callers {
+		t.Errorf("after update = %+v, want prefix PO/2026/ and last_value %d", seq, 103+callers)
+	}
+
+	if w := do("POST", "/sequences/nosuch_sequence/next", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown sequence = %d, want 404", w.Code)
+	}
+	if w := do("DELETE", "/sequences/"+name, ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", w.Code)
+	}
+}
+
+func TestChangesFeed(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	since := time.Now().UTC().Add(-time.Second).Format(time.RFC3339Nano)
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":"CHG-%s","name":"feed item"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create item: %d: %s", w.Code, w.Body.String())
+	}
+	var item struct{ ID int }
+	json.Unmarshal(w.Body.Bytes(), &item)
+	defer testServer.DB.Exec(`DELETE FROM inventory WHERE id = $1`, item.ID)
+
+	if w := do("PUT", fmt.Sprintf("/items/%d", item.ID), `{"name":"feed item renamed"}`); w.Code != http.StatusOK {
+		t.Fatalf("update item: %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("DELETE", fmt.Sprintf("/items/%d", item.ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete item: %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/sites", fmt.Sprintf(`{"name":"Feed %s"}`, suffix))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create site: %d: %s", w.Code, w.Body.String())
+	}
+	var site struct{ ID int }
+	json.Unmarshal(w.Body.Bytes(), &site)
+	defer testServer.DB.Exec(`DELETE FROM sites WHERE id = $1`, site.ID)
+
+	type entry struct {
+		Type   string `json:"type"`
+		ID     int    `json:"id"`
+		Name   string `json:"name"`
+		Action string `json:"action"`
+	}
+	feed := func(query string) []entry {
+		w := do("GET", "/changes?since="+since+"&limit=200"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("changes: %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []entry `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data
+	}
+
+	var itemActions []string
+	for _, e := range feed("&type=item") {
+		if e.Type != "item" {
+			t.Errorf("type=item returned %+v", e)
+		}
+		if e.ID == item.ID {
+			itemActions = append(itemActions, e.Action)
+			if e.Name != "feed item renamed" {
+				t.Errorf("item entry name = %q", e.Name)
+			}
+		}
+	}
+	if strings.Join(itemActions, ",") != "deleted,updated,created" {
+		t.Errorf("item actions = %v, want newest first: deleted, updated, created", itemActions)
+	}
+
+	found := false
+	for _, e := range feed("") {
+		if e.Type == "site" && e.ID == site.ID {
+			found = e.Action == "created"
+		}
+	}
+	if !found {
+		t.Error("site creation missing from the feed")
+	}
+}
+
+func TestSiteImport(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "text/csv")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	defer testServer.DB.Exec(`DELETE FROM sites WHERE name LIKE $1`, "%"+suffix)
+
+	// Parents come before their children, as the import requires
+	csv := "name,location,latitude,longitude,parent\n" +
+		"Campus " + suffix + ",Hamburg,53.55,9.99,\n" +
+		"Building " + suffix + ",,,,campus " + suffix + "\n" +
+		"Floor " + suffix + ",,,,Building " + suffix + "\n"
+
+	w := do("POST", "/sites/import?dry_run=true", csv)
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: %d: %s", w.Code, w.Body.String())
+	}
+	var n int
+	testServer.DB.QueryRow(`SELECT COUNT(*) FROM sites WHERE name LIKE $1`, "%"+suffix).Scan(&n)
+	if n != 0 {
+		t.Fatalf("dry run wrote %d sites", n)
+	}
+
+	w = do("POST", "/sites/import", csv)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: %d: %s", w.Code, w.Body.String())
+	}
+	var res struct {
+		Created int `json:"created"`
+		Rows    []struct {
+			ID     int    `json:"id"`
+			Status string `json:"status"`
+		} `json:"rows"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 3 || len(res.Rows) != 3 {
+		t.Fatalf("result = %+v", res)
+	}
+	for i, parent := range []int{0, res.Rows[0].ID, res.Rows[1].ID} {
+		var got *int
+		testServer.DB.QueryRow(`SELECT parent_id FROM sites WHERE id = $1`, res.Rows[i].ID).Scan(&got)
+		if (parent == 0) != (got == nil) || (got != nil && *got != parent) {
+			t.Errorf("row %d parent = %v, want %d", i, got, parent)
+		}
+	}
+
+	// A second run finds every site already there
+	w = do("POST", "/sites/import", csv)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicates":3`) {
+		t.Errorf("re-import = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	testServer.Status.Poll(context.Background())
+
+	w := httptest.NewRecorder()
+	testServer.Router.ServeHTTP(w, httptest.NewRequest("GET", "/status.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status.json: %d: %s", w.Code, w.Body.String())
+	}
+	var page health.StatusPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for _, c := range page.Components {
+		names[c.Name] = c.Status
+	}
+	for _, name := range []string{"db", "jobs", "webhooks"} {
+		if names[name] != health.StatusOK {
+			t.Errorf("component %s = %q, want ok (page %+v)", name, names[name], page)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	admin, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+	auditor, err := jwtManager.GenerateToken(int64(2), int64(1), []string{"auditor"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(token, method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	site := "Reconcile " + suffix
+	for _, tag := range []string{"REC-A-" + suffix, "REC-B-" + suffix, "REC-C-" + suffix} {
+		body := fmt.Sprintf(`{"asset_tag":%q,"name":"rack switch","site":%q}`, tag, site)
+		if w := do(admin, "POST", "/items", "application/json", body); w.Code != http.StatusCreated {
+			t.Fatalf("create item: %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	csv := "asset_tag,name\n" +
+		"rec-a-" + suffix + ",rack switch\n" +
+		"REC-B-" + suffix + ",core switch\n" +
+		"REC-Z-" + suffix + ",spare\n"
+	w := do(auditor, "POST", "/reconcile?site="+url.QueryEscape(site), "text/csv", csv)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reconcile: %d: %s", w.Code, w.Body.String())
+	}
+	var res struct {
+		Summary map[string]int `json:"summary"`
+		Extra   []struct {
+			AssetTag string `json:"asset_tag"`
+		} `json:"extra"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Summary["identical"] != 1 || res.Summary["differing"] != 1 || res.Summary["missing"] != 1 || res.Summary["extra"] != 1 {
+		t.Errorf("summary = %v", res.Summary)
+	}
+	if len(res.Extra) != 1 || res.Extra[0].AssetTag != "REC-C-"+suffix {
+		t.Errorf("extra = %+v", res.Extra)
+	}
+
+	// Reconciling never writes
+	w = do(admin, "GET", "/items?q=REC-B-"+suffix, "application/json", "")
+	if !strings.Contains(w.Body.String(), "rack switch") {
+		t.Errorf("item changed by reconcile: %s", w.Body.String())
+	}
+}
+
+func TestOrgRetention(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	admin, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/org/retention", strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", admin))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	defer do("PUT", `{"audit":null,"jobs":null}`)
+
+	w := do("PUT", `{"audit":400,"jobs":0}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT /org/retention: %d: %s", w.Code, w.Body.String())
+	}
+	var out struct {
+		Data []struct {
+			Class         string `json:"class"`
+			Days          *int   `json:"days"`
+			EffectiveDays int    `json:"effective_days"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Data) != 4 || out.Data[0].Class != "audit" || out.Data[0].Days == nil || *out.Data[0].Days != 400 ||
+		out.Data[1].Days == nil || *out.Data[1].Days != 0 || out.Data[2].Days != nil {
+		t.Errorf("Unexpected retention: %s", w.Body.String())
+	}
+
+	if w := do("PUT", `{"logs":30}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown class: status = %d, want 400", w.Code)
+	}
+}
+
+func TestAssetGroups(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	create := func(path, body string) int64 {
+		t.Helper()
+		w := do("POST", path, body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("POST %s = %d: %s", path, w.Code, w.Body.String())
+		}
+		var out struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.ID
+	}
+	listed := func(path string) []string {
+		t.Helper()
+		w := do("GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", path, w.Code, w.Body.String())
+		}
+		var out struct {
+			Data []struct {
+				AssetTag string `json:"asset_tag"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		var tags []string
+		for _, it := range out.Data {
+			tags = append(tags, it.AssetTag)
+		}
+		return tags
+	}
+
+	suffix := time.Now().UnixNano()
+	site := fmt.Sprintf("GroupSite-%d", suffix)
+	first := create("/items", fmt.Sprintf(`{"asset_tag":"GRP-A-%d","name":"Group A","site":"%s","status":"in_stock"}`, suffix, site))
+	create("/items", fmt.Sprintf(`{"asset_tag":"GRP-B-%d","name":"Group B","site":"%s","status":"active"}`, suffix, site))
+
+	manual := create("/asset-groups", fmt.Sprintf(`{"name":"Manual %d"}`, suffix))
+	defer do("DELETE", fmt.Sprintf("/asset-groups/%d", manual), "")
+	filtered := create("/asset-groups", fmt.Sprintf(`{"name":"Filter %d","filter":{"site":"%s"}}`, suffix, strings.ToLower(site)))
+	defer do("DELETE", fmt.Sprintf("/asset-groups/%d", filtered), "")
+
+	if w := do("POST", "/asset-groups", fmt.Sprintf(`{"name":"Manual %d"}`, suffix)); w.Code != http.StatusConflict {
+		t.Errorf("duplicate name = %d, want 409", w.Code)
+	}
+	w := do("POST", fmt.Sprintf("/asset-groups/%d/items", manual), fmt.Sprintf(`{"item_ids":[%d]}`, first))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"added":1`) {
+		t.Fatalf("add items = %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", fmt.Sprintf("/asset-groups/%d/items", filtered), fmt.Sprintf(`{"item_ids":[%d]}`, first)); w.Code != http.StatusConflict {
+		t.Errorf("add to a filter group = %d, want 409", w.Code)
+	}
+
+	if got := listed(fmt.Sprintf("/asset-groups/%d/items", manual)); len(got) != 1 || got[0] != fmt.Sprintf("GRP-A-%d", suffix) {
+		t.Errorf("manual group items = %v", got)
+	}
+	if got := listed(fmt.Sprintf("/items?group=%d&sort=asset_tag", filtered)); len(got) != 2 {
+		t.Errorf("filter group items = %v", got)
+	}
+	if got := listed(fmt.Sprintf("/items?group=%d&status=active", filtered)); len(got) != 1 || got[0] != fmt.Sprintf("GRP-B-%d", suffix) {
+		t.Errorf("filter group narrowed by status = %v", got)
+	}
+	if w := do("GET", fmt.Sprintf("/reports/aging?group=%d", filtered), ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":2`) {
+		t.Errorf("aging report of the group = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = do("POST", "/webhooks", fmt.Sprintf(`{"url":"https://example.com/hook","events":["item.updated"],"group_id":%d}`, manual))
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), fmt.Sprintf(`"group_id":%d`, manual)) {
+		t.Fatalf("scoped webhook = %d: %s", w.Code, w.Body.String())
+	}
+	var hook webhook.Webhook
+	if err := json.Unmarshal(w.Body.Bytes(), &hook); err != nil {
+		t.Fatal(err)
+	}
+	if w := do("DELETE", fmt.Sprintf("/asset-groups/%d", manual), ""); w.Code != http.StatusConflict {
+		t.Errorf("delete a group used by a webhook = %d, want 409", w.Code)
+	}
+	do("DELETE", fmt.Sprintf("/webhooks/%d", hook.ID), "")
+
+	if w := do("DELETE", fmt.Sprintf("/asset-groups/%d/items/%d", manual, first), ""); w.Code != http.StatusNoContent {
+		t.Errorf("remove item = %d", w.Code)
+	}
+	if got := listed(fmt.Sprintf("/items?group=%d", manual)); len(got) != 0 {
+		t.Errorf("emptied group items = %v", got)
+	}
+}
+
+func TestOrgSignup(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	mainTenant, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+	other, err := jwtManager.GenerateToken(int64(1), int64(2), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	// signups of earlier runs stay pending, so this run signs up from its own address
+	n := time.Now().UnixNano()
+	client := fmt.Sprintf("[2001:db8::%x:%x]:4000", n>>16&0xffff, n&0xffff)
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = client
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+
+	name := fmt.Sprintf("Signup %d", n)
+	w := do("POST", "/signup", "", fmt.Sprintf(`{"name":%q,"contact_name":"Ada","contact_email":"ada@example.com"}`, name))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("signup: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var signup struct {
+		ID          int64  `json:"id"`
+		Status      string `json:"status"`
+		ClaimSecret string `json:"claim_secret"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&signup); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if signup.Status != "pending" || signup.ClaimSecret == "" {
+		t.Fatalf("Unexpected signup %+v", signup)
+	}
+	// a taken name is not revealed to the public route
+	w = do("POST", "/signup", "", fmt.Sprintf(`{"name":%q,"contact_name":"Bob","contact_email":"bob@example.com"}`, name))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("duplicate signup: expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var duplicate struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&duplicate); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	defer testServer.DB.Exec(`DELETE FROM organizations WHERE id = $1`, duplicate.ID)
+
+	// two signups from this address await approval
+	testServer.SignupPerClient = 2
+	w = do("POST", "/signup", "", fmt.Sprintf(`{"name":"%s third","contact_name":"Eve","contact_email":"eve@example.com"}`, name))
+	testServer.SignupPerClient = 100
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "SIGNUP_CLIENT_LIMIT") {
+		t.Errorf("signup over the client limit: expected 429, got %d: %s", w.Code, w.Body.String())
+	}
+
+	claim := func(secret string) *httptest.ResponseRecorder {
+		return do("POST", fmt.Sprintf("/signup/%d/claim", signup.ID), "", fmt.Sprintf(`{"secret":%q}`, secret))
+	}
+	if w := claim(signup.ClaimSecret); w.Code != http.StatusConflict {
+		t.Errorf("claim before approval: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("GET", "/organizations/pending?limit=100", other, ""); w.Code != http.StatusForbidden {
+		t.Errorf("pending list of another org: expected 403, got %d", w.Code)
+	}
+	if w := do("GET", "/organizations/pending?limit=100", mainTenant, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), name) {
+		t.Errorf("pending list: %d: %s", w.Code, w.Body.String())
+	}
+	approve := fmt.Sprintf("/organizations/%d/approve", signup.ID)
+	if w := do("POST", approve, other, ""); w.Code != http.StatusForbidden {
+		t.Errorf("approval by another org: expected 403, got %d", w.Code)
+	}
+	if w := do("POST", approve, mainTenant, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"active"`) {
+		t.Fatalf("approve: %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", approve, mainTenant, ""); w.Code != http.StatusNotFound {
+		t.Errorf("second approval: expected 404, got %d", w.Code)
+	}
+	if w := do("POST", fmt.Sprintf("/organizations/%d/approve", duplicate.ID), mainTenant, ""); w.Code != http.StatusConflict {
+		t.Errorf("approving a taken name: expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := claim("wrong"); w.Code != http.StatusNotFound {
+		t.Errorf("claim with a wrong secret: expected 404, got %d", w.Code)
+	}
+	w = claim(signup.ClaimSecret)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("claim: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var key struct {
+		Key   string   `json:"key"`
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&key); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(key.Roles) != 1 || key.Roles[0] != "org_admin" {
+		t.Errorf("initial key roles = %v", key.Roles)
+	}
+	if w := claim(signup.ClaimSecret); w.Code != http.StatusNotFound {
+		t.Errorf("second claim: expected 404, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/items?limit=1", nil)
+	req.Header.Set("X-API-Key", key.Key)
+	w = httptest.NewRecorder()
+	testServer.Router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("read with the initial key: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOrgLimits(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	token, err := jwtManager.GenerateToken(int64(1), int64(1), []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	t.Cleanup(func() { do("PUT", "/organizations/1/limits", `{}`) })
+
+	w := do("GET", "/org/usage", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("usage: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var usage struct {
+		Items int `json:"items"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&usage); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if w := do("PUT", "/organizations/1/limits", fmt.Sprintf(`{"max_items":%d,"max_import_rows":1}`, usage.Items)); w.Code != http.StatusOK {
+		t.Fatalf("set limits: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	tag := fmt.Sprintf("QUOTA-%d", time.Now().UnixNano())
+	if w := do("POST", "/items", fmt.Sprintf(`{"asset_tag":%q,"name":"Over quota"}`, tag)); w.Code != http.StatusPaymentRequired {
+		t.Errorf("item over max_items: expected 402, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/sites/import?dry_run=true", "name\nA\nB\n"); w.Code != http.StatusPaymentRequired {
+		t.Errorf("import over max_import_rows: expected 402, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", "/organizations/1/limits", `{}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"max_items":null`) {
+		t.Fatalf("clear limits: %d: %s", w.Code, w.Body.String())
+	}
+	w = do("POST", "/items", fmt.Sprintf(`{"asset_tag":%q,"name":"Under quota"}`, tag))
+	if w.Code != http.StatusCreated {
+		t.Errorf("item without limits: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIntegrityRepair(t *testing.T) {
+	testutil.RequireIntegration(t)
+
+	jwtManager := auth.NewJWTManager(
+		"supersecretkeyforintegrationtestingonly",
+		"era-inventory-api",
+		"era-inventory-api",
+		24*time.Hour,
+	)
+	// a fresh org, so items left by other tests add no findings
+	suffix := time.Now().UnixNano()
+	orgID, otherOrg := 900000+suffix%50000*2, 900001+suffix%50000*2
+	token, err := jwtManager.GenerateToken(int64(1), orgID, []string{"org_admin"})
+	if err != nil {
+		t.Fatalf("Failed to generate test token: %v", err)
+	}
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		w := httptest.NewRecorder()
+		testServer.Router.ServeHTTP(w, req)
+		return w
+	}
+	insert := func(query string, args ...any) int64 {
+		t.Helper()
+		var id int64
+		if err := testServer.DB.QueryRow(query+" RETURNING id", args...).Scan(&id); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		return id
+	}
+
+	siteName := fmt.Sprintf("Integrity HQ %d", suffix)
+	ownSite := insert(`INSERT INTO sites (org_id, name) VALUES ($1, $2)`, orgID, siteName)
+	otherSite := insert(`INSERT INTO sites (org_id, name) VALUES ($1, 'foreign')`, otherOrg)
+	otherVendor := insert(`INSERT INTO vendors (org_id, name) VALUES ($1, 'foreign')`, otherOrg)
+	otherProject := insert(`INSERT INTO projects (org_id, name) VALUES ($1, 'foreign')`, otherOrg)
+
+	item := func(kind, column string, value any) int64 {
+		tag := fmt.Sprintf("INT-%d-%s", suffix, kind)
+		return insert(fmt.Sprintf(`INSERT INTO inventory (org_id, asset_tag, name, %s) VALUES ($1, $2, 'orphan', $3)`, column), orgID, tag, value)
+	}
+	want := map[string]int64{
+		"items_foreign_site":    item("site", "site_id", otherSite),
+		"items_foreign_vendor":  item("vendor", "vendor_id", otherVendor),
+		"items_foreign_project": item("project", "project_id", otherProject),
+		"items_unlinked_site":   item("unlinked", "site", strings.ToUpper(siteName)),
+		"items_unknown_site":    item("unknown", "site", fmt.Sprintf("Nowhere %d", suffix)),
+	}
+	item("clean", "site_id", ownSite)
+
+	type report struct {
+		Findings []struct {
+			Check   string  `json:"check"`
+			Count   int     `json:"count"`
+			ItemIDs []int64 `json:"item_ids"`
+			Fixable bool    `json:"fixable"`
+		} `json:"findings"`
+		Repaired map[string]int64 `json:"repaired"`
+	}
+	decode := func(w *httptest.ResponseRecorder) report {
+		t.Helper()
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var r report
+		if err := json.NewDecoder(w.Body).Decode(&r); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return r
+	}
+
+	before := decode(do("GET", "/admin/integrity"))
+	if len(before.Findings) != len(want) {
+		t.Errorf("expected %d findings, got %+v", len(want), before.Findings)
+	}
+	for _, f := range before.Findings {
+		if f.Count != 1 || len(f.ItemIDs) != 1 || f.ItemIDs[0] != want[f.Check] {
+			t.Errorf("%s: expected item %d only, got %+v", f.Check, want[f.Check], f)
+		}
+		if f.Fixable != (f.Check != "items_unknown_site") {
+			t.Errorf("%s: fixable = %v", f.Check, f.Fixable)
+		}
+	}
+
+	after := decode(do("POST", "/admin/integrity/repair"))
+	for check := range want {
+		if check == "items_unknown_site" {
+			continue
+		}
+		if after.Repaired[check] != 1 {
+			t.Errorf("%s: expected 1 repaired, got %d", check, after.Repaired[check])
+		}
+	}
+	if len(after.Findings) != 1 || after.Findings[0].Check != "items_unknown_site" {
+		t.Errorf("only the manual finding should remain, got %+v", after.Findings)
+	}
+
+	var siteID, vendorID, projectID *int64
+	if err := testServer.DB.QueryRow(`SELECT site_id FROM inventory WHERE id = $1`, want["items_unlinked_site"]).Scan(&siteID); err != nil || siteID == nil || *siteID != ownSite {
+		t.Errorf("unlinked item: expected site_id %d, got %v (%v)", ownSite, siteID, err)
+	}
+	if err := testServer.DB.QueryRow(`
+		SELECT (SELECT site_id FROM inventory WHERE id = $1), (SELECT vendor_id FROM inventory WHERE id = $2),
+		       (SELECT project_id FROM inventory WHERE id = $3)`,
+		want["items_foreign_site"], want["items_foreign_vendor"], want["items_foreign_project"]).Scan(&siteID, &vendorID, &projectID); err != nil {
+		t.Fatal(err)
+	}
+	if siteID != nil || vendorID != nil || projectID != nil {
+		t.Errorf("foreign references must be cleared, got site %v vendor %v project %v", siteID, vendorID, projectID)
+	}
+}
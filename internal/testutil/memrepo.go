@@ -0,0 +1,506 @@
+package testutil
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/repo"
+)
+
+// memTable is an org-partitioned, soft-deleting table shared by the
+// in-memory repositories. meta exposes the fields every record has.
+type memTable[T any] struct {
+	mu     sync.Mutex
+	nextID int
+	rows   map[int]*memRow[T]
+	meta   func(*T) (id *int, name *string, created, updated *time.Time)
+}
+
+type memRow[T any] struct {
+	orgID   int64
+	v       T
+	deleted bool
+}
+
+func newMemTable[T any](meta func(*T) (*int, *string, *time.Time, *time.Time)) *memTable[T] {
+	return &memTable[T]{rows: map[int]*memRow[T]{}, meta: meta}
+}
+
+func (t *memTable[T]) list(orgID int64, opts repo.ListOptions) repo.Page[T] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var all []T
+	for _, row := range t.rows {
+		_, name, _, _ := t.meta(&row.v)
+		if row.orgID != orgID || row.deleted {
+			continue
+		}
+		if opts.Query != "" && !strings.Contains(strings.ToLower(*name), strings.ToLower(opts.Query)) {
+			continue
+		}
+		all = append(all, row.v)
+	}
+
+	key, desc := strings.TrimPrefix(strings.Split(opts.Sort, ",")[0], "-"), strings.HasPrefix(opts.Sort, "-")
+	sort.Slice(all, func(i, j int) bool {
+		a, b := &all[i], &all[j]
+		if desc {
+			a, b = b, a
+		}
+		aID, aName, aCreated, aUpdated := t.meta(a)
+		bID, bName, bCreated, bUpdated := t.meta(b)
+		switch key {
+		case "name":
+			return *aName < *bName
+		case "created_at":
+			return aCreated.Before(*bCreated)
+		case "updated_at":
+			return aUpdated.Before(*bUpdated)
+		}
+		return *aID < *bID
+	})
+
+	page := repo.Page[T]{Rows: []T{}, Total: len(all)}
+	if opts.Offset < len(all) {
+		all = all[opts.Offset:]
+		if opts.Limit > 0 && opts.Limit < len(all) {
+			all = all[:opts.Limit]
+		}
+		page.Rows = append(page.Rows, all...)
+	}
+	return page
+}
+
+func (t *memTable[T]) get(orgID int64, id int64) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[int(id)]
+	if !ok || row.orgID != orgID || row.deleted {
+		var zero T
+		return zero, repo.ErrNotFound
+	}
+	return row.v, nil
+}
+
+func (t *memTable[T]) create(orgID int64, v T) T {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	id, _, created, updated := t.meta(&v)
+	*id = t.nextID
+	*created = time.Now().UTC()
+	*updated = *created
+	t.rows[t.nextID] = &memRow[T]{orgID: orgID, v: v}
+	return v
+}
+
+func (t *memTable[T]) update(orgID int64, id int64, apply func(*T)) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[int(id)]
+	if !ok || row.orgID != orgID || row.deleted {
+		var zero T
+		return zero, repo.ErrNotFound
+	}
+	apply(&row.v)
+	_, _, _, updated := t.meta(&row.v)
+	*updated = time.Now().UTC()
+	return row.v, nil
+}
+
+func (t *memTable[T]) delete(orgID int64, id int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	row, ok := t.rows[int(id)]
+	if !ok || row.orgID != orgID || row.deleted {
+		return repo.ErrNotFound
+	}
+	row.deleted = true
+	return nil
+}
+
+// emptyToNil mirrors the Postgres repositories storing blank optional text as NULL
+func emptyToNil(s *string) *string {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+// MemSites is an in-memory repo.SiteRepo
+type MemSites struct {
+	t *memTable[models.Site]
+}
+
+// NewMemSites returns an empty MemSites
+func NewMemSites() *MemSites {
+	return &MemSites{t: newMemTable(func(s *models.Site) (*int, *string, *time.Time, *time.Time) {
+		return &s.ID, &s.Name, &s.CreatedAt, &s.UpdatedAt
+	})}
+}
+
+func (m *MemSites) List(_ context.Context, orgID int64, opts repo.ListOptions) (repo.Page[models.Site], error) {
+	return m.t.list(orgID, opts), nil
+}
+
+func (m *MemSites) Get(_ context.Context, orgID, id int64) (models.Site, error) {
+	return m.t.get(orgID, id)
+}
+
+func (m *MemSites) Create(_ context.Context, orgID int64, in models.Site) (models.Site, error) {
+	in.Location, in.Notes = emptyToNil(in.Location), emptyToNil(in.Notes)
+	return m.t.create(orgID, in), nil
+}
+
+func (m *MemSites) Update(_ context.Context, orgID, id int64, p repo.SitePatch) (models.Site, error) {
+	return m.t.update(orgID, id, func(s *models.Site) {
+		if p.Name != nil {
+			s.Name = *p.Name
+		}
+		if p.Location != nil {
+			s.Location = emptyToNil(p.Location)
+		}
+		if p.Notes != nil {
+			s.Notes = emptyToNil(p.Notes)
+		}
+		if p.Latitude != nil {
+			s.Latitude = p.Latitude
+		}
+		if p.Longitude != nil {
+			s.Longitude = p.Longitude
+		}
+		if p.ParentID != nil {
+			s.ParentID = p.ParentID
+			if *p.ParentID == 0 {
+				s.ParentID = nil
+			}
+		}
+	})
+}
+
+func (m *MemSites) Delete(_ context.Context, orgID, id int64) error {
+	return m.t.delete(orgID, id)
+}
+
+func (m *MemSites) FindByNames(_ context.Context, orgID int64, names []string) ([]models.Site, error) {
+	want := map[string]bool{}
+	for _, n := range names {
+		want[strings.ToLower(n)] = true
+	}
+	out := []models.Site{}
+	for _, s := range m.t.list(orgID, repo.ListOptions{}).Rows {
+		if want[strings.ToLower(s.Name)] {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemSites) CreateMany(ctx context.Context, orgID int64, in []repo.NewSite) ([]models.Site, error) {
+	out := make([]models.Site, 0, len(in))
+	for _, ns := range in {
+		site := ns.Site
+		if ns.ParentIndex != nil {
+			parentID := out[*ns.ParentIndex].ID
+			site.ParentID = &parentID
+		}
+		created, err := m.Create(ctx, orgID, site)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, created)
+	}
+	return out, nil
+}
+
+// MemVendors is an in-memory repo.VendorRepo
+type MemVendors struct {
+	t *memTable[models.Vendor]
+}
+
+// NewMemVendors returns an empty MemVendors
+func NewMemVendors() *MemVendors {
+	return &MemVendors{t: newMemTable(func(v *models.Vendor) (*int, *string, *time.Time, *time.Time) {
+		return &v.ID, &v.Name, &v.CreatedAt, &v.UpdatedAt
+	})}
+}
+
+func (m *MemVendors) List(_ context.Context, orgID int64, opts repo.ListOptions) (repo.Page[models.Vendor], error) {
+	return m.t.list(orgID, opts), nil
+}
+
+func (m *MemVendors) Get(_ context.Context, orgID, id int64) (models.Vendor, error) {
+	return m.t.get(orgID, id)
+}
+
+func (m *MemVendors) Create(_ context.Context, orgID int64, in models.Vendor) (models.Vendor, error) {
+	in.Email, in.Phone, in.Notes = emptyToNil(in.Email), emptyToNil(in.Phone), emptyToNil(in.Notes)
+	return m.t.create(orgID, in), nil
+}
+
+func (m *MemVendors) Update(_ context.Context, orgID, id int64, p repo.VendorPatch) (models.Vendor, error) {
+	return m.t.update(orgID, id, func(v *models.Vendor) {
+		if p.Name != nil {
+			v.Name = *p.Name
+		}
+		if p.Email != nil {
+			v.Email = emptyToNil(p.Email)
+		}
+		if p.Phone != nil {
+			v.Phone = emptyToNil(p.Phone)
+		}
+		if p.Notes != nil {
+			v.Notes = emptyToNil(p.Notes)
+		}
+	})
+}
+
+func (m *MemVendors) Delete(_ context.Context, orgID, id int64) error {
+	return m.t.delete(orgID, id)
+}
+
+// MemRefreshTokens is an in-memory repo.RefreshTokenRepo
+type MemRefreshTokens struct {
+	mu     sync.Mutex
+	nextID int64
+	byHash map[string]*repo.RefreshToken
+}
+
+// NewMemRefreshTokens returns an empty MemRefreshTokens
+func NewMemRefreshTokens() *MemRefreshTokens {
+	return &MemRefreshTokens{byHash: map[string]*repo.RefreshToken{}}
+}
+
+func (m *MemRefreshTokens) insert(hash string, t repo.RefreshToken) (repo.RefreshToken, error) {
+	if _, taken := m.byHash[hash]; taken {
+		return repo.RefreshToken{}, repo.ErrConflict
+	}
+	m.nextID++
+	t.ID = m.nextID
+	if t.FamilyID == 0 {
+		t.FamilyID = t.ID
+	}
+	t.Roles = append([]string(nil), t.Roles...)
+	m.byHash[hash] = &t
+	return t, nil
+}
+
+func (m *MemRefreshTokens) Create(_ context.Context, hash string, t repo.RefreshToken) (repo.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t.FamilyID, t.UsedAt, t.RevokedAt = 0, nil, nil
+	return m.insert(hash, t)
+}
+
+func (m *MemRefreshTokens) GetByHash(_ context.Context, hash string) (repo.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.byHash[hash]
+	if !ok {
+		return repo.RefreshToken{}, repo.ErrNotFound
+	}
+	return *t, nil
+}
+
+func (m *MemRefreshTokens) Rotate(_ context.Context, id int64, hash string, expiresAt time.Time) (repo.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range m.byHash {
+		if t.ID != id {
+			continue
+		}
+		if t.UsedAt != nil || t.RevokedAt != nil {
+			return repo.RefreshToken{}, repo.ErrConflict
+		}
+		now := time.Now()
+		t.UsedAt = &now
+		return m.insert(hash, repo.RefreshToken{
+			FamilyID: t.FamilyID, UserID: t.UserID, OrgID: t.OrgID, Roles: t.Roles,
+			StartedAt: t.StartedAt, ExpiresAt: expiresAt,
+		})
+	}
+	return repo.RefreshToken{}, repo.ErrConflict
+}
+
+func (m *MemRefreshTokens) RevokeFamily(_ context.Context, familyID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, t := range m.byHash {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// MemRevokedTokens is an in-memory repo.RevokedTokenRepo
+type MemRevokedTokens struct {
+	mu  sync.Mutex
+	ids map[string]time.Time
+}
+
+// NewMemRevokedTokens returns an empty MemRevokedTokens
+func NewMemRevokedTokens() *MemRevokedTokens {
+	return &MemRevokedTokens{ids: map[string]time.Time{}}
+}
+
+func (m *MemRevokedTokens) Revoke(_ context.Context, jti string, _, _ int64, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ids[jti]; !ok {
+		m.ids[jti] = expiresAt
+	}
+	return nil
+}
+
+func (m *MemRevokedTokens) Active(_ context.Context) (map[string]time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string]time.Time{}
+	for jti, expiresAt := range m.ids {
+		if expiresAt.After(time.Now()) {
+			out[jti] = expiresAt
+		}
+	}
+	return out, nil
+}
+
+func (m *MemRevokedTokens) Prune(_ context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for jti, expiresAt := range m.ids {
+		if expiresAt.Before(cutoff) {
+			delete(m.ids, jti)
+			n++
+		}
+	}
+	return n, nil
+}
+
+var (
+	_ repo.SiteRepo         = (*MemSites)(nil)
+	_ repo.VendorRepo       = (*MemVendors)(nil)
+	_ repo.RefreshTokenRepo = (*MemRefreshTokens)(nil)
+	_ repo.RevokedTokenRepo = (*MemRevokedTokens)(nil)
+	_ repo.OrgLimitRepo     = (*MemOrgLimits)(nil)
+)
+
+// MemAPIKeys is an in-memory repo.APIKeyRepo
+type MemAPIKeys struct {
+	mu     sync.Mutex
+	nextID int64
+	byHash map[string]*models.APIKey
+}
+
+// NewMemAPIKeys returns an empty MemAPIKeys
+func NewMemAPIKeys() *MemAPIKeys {
+	return &MemAPIKeys{byHash: map[string]*models.APIKey{}}
+}
+
+func (m *MemAPIKeys) Create(_ context.Context, hash string, k models.APIKey) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, taken := m.byHash[hash]; taken {
+		return models.APIKey{}, repo.ErrConflict
+	}
+	m.nextID++
+	k.ID, k.CreatedAt, k.LastUsedAt, k.RevokedAt = m.nextID, time.Now(), nil, nil
+	k.Roles = append([]string(nil), k.Roles...)
+	m.byHash[hash] = &k
+	return k, nil
+}
+
+func (m *MemAPIKeys) GetByHash(_ context.Context, hash string) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.byHash[hash]
+	if !ok {
+		return models.APIKey{}, repo.ErrNotFound
+	}
+	return *k, nil
+}
+
+func (m *MemAPIKeys) List(_ context.Context, orgID int64) ([]models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []models.APIKey{}
+	for _, k := range m.byHash {
+		if k.OrgID == orgID {
+			out = append(out, *k)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+func (m *MemAPIKeys) Revoke(_ context.Context, orgID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.byHash {
+		if k.ID == id && k.OrgID == orgID && k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+	return repo.ErrNotFound
+}
+
+func (m *MemAPIKeys) Touch(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.byHash {
+		if k.ID == id {
+			now := time.Now()
+			k.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+// MemOrgLimits is an in-memory repo.OrgLimitRepo. Every org exists and is
+// unlimited until Set; item counts are whatever SetItems recorded.
+type MemOrgLimits struct {
+	mu     sync.Mutex
+	limits map[int64]models.OrgLimits
+	items  map[int64]int
+}
+
+// NewMemOrgLimits returns a MemOrgLimits without limits or items
+func NewMemOrgLimits() *MemOrgLimits {
+	return &MemOrgLimits{limits: map[int64]models.OrgLimits{}, items: map[int64]int{}}
+}
+
+// SetItems records how many live items the org holds
+func (m *MemOrgLimits) SetItems(orgID int64, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[orgID] = n
+}
+
+func (m *MemOrgLimits) Get(_ context.Context, orgID int64) (models.OrgLimits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.limits[orgID], nil
+}
+
+func (m *MemOrgLimits) Set(_ context.Context, orgID int64, l models.OrgLimits) (models.OrgLimits, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limits[orgID] = l
+	return l, nil
+}
+
+func (m *MemOrgLimits) CountItems(_ context.Context, orgID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.items[orgID], nil
+}
@@ -0,0 +1,283 @@
+// Package textdiff produces line-based unified diffs (Myers' algorithm).
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OpKind identifies a line operation in an edit script
+type OpKind byte
+
+const (
+	Equal  OpKind = ' '
+	Insert OpKind = '+'
+	Delete OpKind = '-'
+)
+
+// Op is a single line of an edit script
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// Stats summarises an edit script
+type Stats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// Lines splits text into lines, ignoring a trailing newline
+func Lines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// ErrTooDifferent is returned by DiffLimit when the inputs differ in more
+// lines than it was allowed to work through
+var ErrTooDifferent = errors.New("textdiff: inputs are too different to diff")
+
+// Diff returns the shortest edit script turning a into b
+func Diff(a, b []string) []Op {
+	ops, _ := DiffLimit(a, b, -1)
+	return ops
+}
+
+// DiffLimit is Diff giving up with ErrTooDifferent when the shortest edit
+// script changes more than maxEdits lines; a negative maxEdits has no limit.
+// Time grows with the size of the inputs times the number of changed lines,
+// so callers diffing untrusted input set a limit. Memory is linear in the
+// size of the inputs.
+func DiffLimit(a, b []string, maxEdits int) ([]Op, error) {
+	if len(a)+len(b) == 0 {
+		return nil, nil
+	}
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	d := &differ{a: a, b: b, limit: maxEdits, vf: make([]int, size), vb: make([]int, size)}
+	if !d.compare(0, len(a), 0, len(b)) {
+		return nil, ErrTooDifferent
+	}
+	return d.ops, nil
+}
+
+// differ is Myers' linear-space refinement: find the middle snake of the
+// shortest edit script, then solve the halves on either side of it. Only
+// the furthest reaching paths of the current step are kept, in vf (forward)
+// and vb (backward), instead of one copy per step.
+type differ struct {
+	a, b   []string
+	limit  int // applies to the first middle snake, whose D is the whole script's
+	vf, vb []int
+	ops    []Op
+}
+
+// compare appends the edit script turning a[aLo:aHi] into b[bLo:bHi]. It
+// returns false when the script is longer than the limit.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) bool {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, Op{Equal, d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	aEnd, bEnd := aHi, bHi
+	for aLo < aEnd && bLo < bEnd && d.a[aEnd-1] == d.b[bEnd-1] {
+		aEnd--
+		bEnd--
+	}
+
+	switch {
+	case aLo == aEnd:
+		for _, line := range d.b[bLo:bEnd] {
+			d.ops = append(d.ops, Op{Insert, line})
+		}
+	case bLo == bEnd:
+		for _, line := range d.a[aLo:aEnd] {
+			d.ops = append(d.ops, Op{Delete, line})
+		}
+	default:
+		x, y, u, v, ok := d.middleSnake(aLo, aEnd, bLo, bEnd)
+		if !ok {
+			return false
+		}
+		d.compare(aLo, x, bLo, y)
+		for _, line := range d.a[x:u] {
+			d.ops = append(d.ops, Op{Equal, line})
+		}
+		d.compare(u, aEnd, v, bEnd)
+	}
+
+	for _, line := range d.a[aEnd:aHi] {
+		d.ops = append(d.ops, Op{Equal, line})
+	}
+	return true
+}
+
+// middleSnake runs the shortest path search from both ends of
+// a[aLo:aHi] / b[bLo:bHi] until the paths overlap, and returns the snake
+// (x, y)-(u, v) where they meet. Both ranges are non-empty and differ at
+// either end, so the script has at least two edits and each half is shorter.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int, ok bool) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta&1 != 0
+	max := (n + m + 1) / 2
+	off := max + 1
+	vf, vb := d.vf, d.vb
+	vf[off+1], vb[off+1] = 0, 0
+
+	limit := d.limit
+	d.limit = -1
+	for step := 0; step <= max; step++ {
+		if limit >= 0 && 2*step-1 > limit {
+			return 0, 0, 0, 0, false
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kr := delta - k; odd && kr >= -(step-1) && kr <= step-1 && x+vb[off+kr] >= n {
+				if limit >= 0 && 2*step-1 > limit {
+					return 0, 0, 0, 0, false
+				}
+				return aLo + x0, bLo + y0, aLo + x, bLo + y, true
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -step && kf <= step && vf[off+kf]+x >= n {
+				if limit >= 0 && 2*step > limit {
+					return 0, 0, 0, 0, false
+				}
+				return aHi - x, bHi - y, aHi - x0, bHi - y0, true
+			}
+		}
+	}
+	panic("textdiff: no middle snake")
+}
+
+// Count tallies added and removed lines in an edit script
+func Count(ops []Op) Stats {
+	var st Stats
+	for _, op := range ops {
+		switch op.Kind {
+		case Insert:
+			st.Added++
+		case Delete:
+			st.Removed++
+		}
+	}
+	return st
+}
+
+// Unified renders an edit script as unified diff hunks with the given
+// number of context lines. It returns "" when there are no changes.
+func Unified(fromName, toName string, ops []Op, context int) string {
+	var sb strings.Builder
+	aLine, bLine := 1, 1
+	i := 0
+	for i < len(ops) {
+		// Skip to the next change
+		for i < len(ops) && ops[i].Kind == Equal {
+			i++
+			aLine++
+			bLine++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Hunk starts `context` lines before the change
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		hunkA := aLine - (i - start)
+		hunkB := bLine - (i - start)
+
+		// Extend the hunk while changes are within 2*context of each other
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].Kind != Equal {
+				end = j
+				continue
+			}
+			if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		var body strings.Builder
+		countA, countB := 0, 0
+		for _, op := range ops[start:stop] {
+			body.WriteByte(byte(op.Kind))
+			body.WriteString(op.Line)
+			body.WriteByte('\n')
+			if op.Kind != Insert {
+				countA++
+			}
+			if op.Kind != Delete {
+				countB++
+			}
+		}
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(hunkA, countA), hunkRange(hunkB, countB))
+		sb.WriteString(body.String())
+
+		// Advance line counters past the hunk
+		for _, op := range ops[i:stop] {
+			if op.Kind != Insert {
+				aLine++
+			}
+			if op.Kind != Delete {
+				bLine++
+			}
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
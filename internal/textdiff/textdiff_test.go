@@ -0,0 +1,175 @@
+package textdiff
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func apply(a []string, ops []Op) []string {
+	var out []string
+	i := 0
+	for _, op := range ops {
+		switch op.Kind {
+		case Equal:
+			out = append(out, a[i])
+			i++
+		case Delete:
+			i++
+		case Insert:
+			out = append(out, op.Line)
+		}
+	}
+	return out
+}
+
+func TestDiffProducesValidEditScript(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"identical", "a\nb\nc\n", "a\nb\nc\n"},
+		{"empty to text", "", "a\nb\n"},
+		{"text to empty", "a\nb\n", ""},
+		{"change middle", "hostname sw1\nvlan 10\nend\n", "hostname sw1\nvlan 20\nend\n"},
+		{"reorder", "a\nb\nc\nd\n", "d\na\nc\nb\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := Lines(tt.a), Lines(tt.b)
+			ops := Diff(a, b)
+			if got := strings.Join(apply(a, ops), "\n"); got != strings.Join(b, "\n") {
+				t.Errorf("applying diff gave %q, want %q", got, strings.Join(b, "\n"))
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := Lines("hostname sw1\ninterface g0/1\n vlan 10\n!\nend\n")
+	b := Lines("hostname sw1\ninterface g0/1\n vlan 20\n!\nend\n")
+	ops := Diff(a, b)
+
+	want := "--- a\n+++ b\n@@ -1,5 +1,5 @@\n hostname sw1\n interface g0/1\n- vlan 10\n+ vlan 20\n !\n end\n"
+	if got := Unified("a", "b", ops, 3); got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+
+	st := Count(ops)
+	if st.Added != 1 || st.Removed != 1 {
+		t.Errorf("Count() = %+v, want 1 added 1 removed", st)
+	}
+
+	if got := Unified("a", "b", Diff(a, a), 3); got != "" {
+		t.Errorf("Expected empty diff for identical input, got %q", got)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		line := "line " + string(rune('a'+i))
+		a = append(a, line)
+		b = append(b, line)
+	}
+	b[1] = "changed b"
+	b[18] = "changed s"
+
+	got := Unified("a", "b", Diff(a, b), 1)
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Fatalf("Expected 2 hunks, got %d:\n%s", n, got)
+	}
+	if !strings.Contains(got, "@@ -1,3 +1,3 @@") || !strings.Contains(got, "@@ -18,3 +18,3 @@") {
+		t.Errorf("Unexpected hunk headers:\n%s", got)
+	}
+}
+
+// lcs is the textbook quadratic LCS length, against which Diff's edit count
+// is checked to be minimal
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiffIsShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "d"}
+	for i := 0; i < 500; i++ {
+		var a, b []string
+		for n := rng.Intn(30); n > 0; n-- {
+			a = append(a, words[rng.Intn(len(words))])
+		}
+		for n := rng.Intn(30); n > 0; n-- {
+			b = append(b, words[rng.Intn(len(words))])
+		}
+		ops := Diff(a, b)
+		if got := apply(a, ops); strings.Join(got, "\n") != strings.Join(b, "\n") {
+			t.Fatalf("%q -> %q: applying diff gave %q", a, b, got)
+		}
+		st := Count(ops)
+		if want := len(a) + len(b) - 2*lcs(a, b); st.Added+st.Removed != want {
+			t.Fatalf("%q -> %q: %d edits, shortest is %d", a, b, st.Added+st.Removed, want)
+		}
+	}
+}
+
+// Two large configs sharing no line: the limit stops the search early
+// instead of working through every step
+func TestDiffLimitLargeDissimilar(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 100000; i++ {
+		a = append(a, fmt.Sprintf("interface g0/%d description old uplink %d", i, i))
+		b = append(b, fmt.Sprintf("interface g1/%d description new uplink %d", i, i))
+	}
+	start := time.Now()
+	if _, err := DiffLimit(a, b, 2000); !errors.Is(err, ErrTooDifferent) {
+		t.Fatalf("err = %v, want ErrTooDifferent", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("giving up took %v", elapsed)
+	}
+}
+
+// Many scattered changes used to keep a copy of the search state per step,
+// O((N+M)·D) memory; it is now linear in the input
+func TestDiffMemoryIsLinear(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20000; i++ {
+		line := fmt.Sprintf("set system line %d", i)
+		a = append(a, line)
+		if i%10 == 0 {
+			line += " changed"
+		}
+		b = append(b, line)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops, err := DiffLimit(a, b, 5000)
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := Count(ops); st.Added != 2000 || st.Removed != 2000 {
+		t.Errorf("Count() = %+v, want 2000 added and 2000 removed", st)
+	}
+	// the old trace alone took 4000 steps × 80k ints ≈ 2.5 GB
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 32<<20 {
+		t.Errorf("diffing allocated %d MB", alloc>>20)
+	}
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+const (
+	// defaultExchangeTTL is the lifetime of an exchanged token when none is requested
+	defaultExchangeTTL = 15 * time.Minute
+	// maxExchangeTTL caps the lifetime of an exchanged token
+	maxExchangeTTL = time.Hour
+)
+
+// tokenExchangeRequest is the body accepted by POST /auth/token/exchange
+type tokenExchangeRequest struct {
+	Roles     []string `json:"roles,omitempty"`
+	SiteIDs   []int64  `json:"site_ids,omitempty"`
+	ExpiresIn int      `json:"expires_in,omitempty"` // seconds
+}
+
+// tokenExchangeResponse is the down-scoped token handed back to the caller
+type tokenExchangeResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ExpiresIn int       `json:"expires_in"`
+	Roles     []string  `json:"roles"`
+	SiteIDs   []int64   `json:"site_ids,omitempty"`
+}
+
+// exchangeToken trades the presented token for a short-lived one limited to a
+// subset of its roles and, optionally, to specific sites of the same org.
+// API keys cannot exchange: the minted JWT would outlive the key's revocation.
+func (s *Server) exchangeToken(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil {
+		problem.Write(w, r, http.StatusUnauthorized, "AUTHENTICATION_REQUIRED", "Authentication required")
+		return
+	}
+	if claims.APIKeyID() != 0 {
+		problem.Write(w, r, http.StatusForbidden, "API_KEY_NOT_ALLOWED", "API keys cannot be exchanged for tokens")
+		return
+	}
+
+	var in tokenExchangeRequest
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	ttl := defaultExchangeTTL
+	if in.ExpiresIn != 0 {
+		ttl = time.Duration(in.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxExchangeTTL {
+		problem.BadRequest(w, r, "expires_in must be between 1 and 3600 seconds")
+		return
+	}
+
+	siteIDs := uniqueIDs(in.SiteIDs)
+	if len(siteIDs) > 0 {
+		var found int
+		q := dbFrom(r.Context(), s.DB)
+		if err := q.QueryRowContext(r.Context(),
+			`SELECT COUNT(*) FROM sites WHERE org_id = $1 AND id = ANY($2) AND deleted_at IS NULL`, claims.OrgID, siteIDs).Scan(&found); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if found != len(siteIDs) {
+			problem.BadRequest(w, r, "site_ids contains unknown sites")
+			return
+		}
+	}
+
+	token, expiresAt, err := s.JWTManager.GenerateScopedToken(claims, in.Roles, siteIDs, ttl)
+	if errors.Is(err, auth.ErrScopeEscalation) {
+		problem.Write(w, r, http.StatusForbidden, "SCOPE_ESCALATION", err.Error())
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	out := tokenExchangeResponse{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+		ExpiresIn: int(time.Until(expiresAt).Seconds()),
+		Roles:     in.Roles,
+		SiteIDs:   siteIDs,
+	}
+	if len(out.Roles) == 0 {
+		out.Roles = claims.Roles
+	}
+	if len(out.SiteIDs) == 0 {
+		out.SiteIDs = claims.SiteIDs
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// introspectRequest is the body accepted by POST /auth/introspect
+type introspectRequest struct {
+	Token string `json:"token"`
+}
+
+// introspection describes a presented token, after RFC 7662. Only active
+// tokens carry claims; inactive ones say why in reason.
+type introspection struct {
+	Active    bool     `json:"active"`
+	Reason    string   `json:"reason,omitempty"`
+	UserID    int64    `json:"sub,omitempty"`
+	OrgID     int64    `json:"org_id,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	SiteIDs   []int64  `json:"site_ids,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	ExpiresIn int      `json:"expires_in,omitempty"` // seconds
+}
+
+// introspectToken reports whether the token in the body is active (valid,
+// unexpired and not revoked) and, if so, its claims and remaining lifetime,
+// so gateways and debugging tools need not hold the signing secret. Tokens
+// of other orgs are reported inactive, except to main tenant tokens.
+func (s *Server) introspectToken(w http.ResponseWriter, r *http.Request) {
+	caller := auth.ClaimsFromContext(r.Context())
+	if caller == nil {
+		problem.Write(w, r, http.StatusUnauthorized, "AUTHENTICATION_REQUIRED", "Authentication required")
+		return
+	}
+
+	var in introspectRequest
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.Token == "" {
+		problem.BadRequest(w, r, "token is required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(s.introspect(caller, in.Token)); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// introspect validates token on behalf of caller
+func (s *Server) introspect(caller *auth.Claims, token string) introspection {
+	claims, err := s.JWTManager.ValidateToken(token)
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return introspection{Reason: "expired"}
+	case errors.Is(err, auth.ErrTokenNotValidYet):
+		return introspection{Reason: "not_yet_valid"}
+	case errors.Is(err, auth.ErrTokenRevoked):
+		return introspection{Reason: "revoked"}
+	case err != nil:
+		return introspection{Reason: "invalid"}
+	}
+	mainTenant := s.MainTenantOrgID > 0 && caller.OrgID == s.MainTenantOrgID
+	if claims.OrgID != caller.OrgID && !mainTenant {
+		return introspection{Reason: "invalid"}
+	}
+
+	out := introspection{
+		Active:   true,
+		UserID:   claims.UserID,
+		OrgID:    claims.OrgID,
+		Roles:    claims.Roles,
+		SiteIDs:  claims.SiteIDs,
+		Issuer:   claims.Issuer,
+		Audience: claims.Audience,
+		TokenID:  claims.ID,
+	}
+	if claims.IssuedAt != nil {
+		out.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		out.NotBefore = claims.NotBefore.Unix()
+	}
+	if claims.ExpiresAt != nil {
+		out.ExpiresAt = claims.ExpiresAt.Unix()
+		out.ExpiresIn = max(int(time.Until(claims.ExpiresAt.Time).Seconds()), 0)
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"era-inventory-api/internal/auth"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	jwtManager := auth.NewJWTManager("supersecretkeyforunittestingonly!", "era-inventory-api", "era-inventory-api", time.Hour)
+	revocations := auth.NewRevocations()
+	jwtManager.SetRevocations(revocations)
+	s := &Server{JWTManager: jwtManager, MainTenantOrgID: 9}
+
+	own, err := jwtManager.GenerateToken(5, 1, []string{"viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := serveAs(1, http.MethodPost, "/auth/introspect", "/auth/introspect", `{"token":"`+own+`"}`, s.introspectToken)
+	var got introspection
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !got.Active || got.UserID != 5 || got.OrgID != 1 || got.ExpiresIn < 3500 || got.ExpiresAt == 0 {
+		t.Errorf("status %d, introspection %+v", w.Code, got)
+	}
+
+	if w := serveAs(1, http.MethodPost, "/auth/introspect", "/auth/introspect", `{}`, s.introspectToken); w.Code != http.StatusBadRequest {
+		t.Errorf("missing token = %d, want 400", w.Code)
+	}
+
+	other, err := jwtManager.GenerateToken(6, 2, []string{"viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.introspect(&auth.Claims{OrgID: 1}, other); got.Active || got.UserID != 0 {
+		t.Errorf("another org's token = %+v, want inactive without claims", got)
+	}
+	if got := s.introspect(&auth.Claims{OrgID: 9}, other); !got.Active || got.OrgID != 2 {
+		t.Errorf("main tenant sees %+v, want the token's claims", got)
+	}
+
+	claims, err := jwtManager.ValidateToken(own)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations.Revoke(claims.ID, claims.ExpiresAt.Time)
+	if got := s.introspect(&auth.Claims{OrgID: 1}, own); got.Active || got.Reason != "revoked" {
+		t.Errorf("revoked token = %+v", got)
+	}
+	if got := s.introspect(&auth.Claims{OrgID: 1}, "not.a.token"); got.Active || got.Reason != "invalid" {
+		t.Errorf("garbage = %+v", got)
+	}
+}
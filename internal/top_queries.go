@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+)
+
+// Bounds of ?limit= on GET /admin/db/top-queries
+const (
+	defaultTopQueries = 20
+	maxTopQueries     = 100
+)
+
+// topQuery is one normalized statement from pg_stat_statements. Literals are
+// replaced by $n placeholders there, so no tenant data is exposed.
+type topQuery struct {
+	QueryID     int64   `json:"query_id"`
+	Query       string  `json:"query"`
+	Calls       int64   `json:"calls"`
+	TotalMs     float64 `json:"total_ms"`
+	MeanMs      float64 `json:"mean_ms"`
+	MaxMs       float64 `json:"max_ms"`
+	Rows        int64   `json:"rows"`
+	PercentTime float64 `json:"percent_time"`
+	// CacheHitRatio is the share of shared blocks found in the buffer cache;
+	// a low ratio on a hot query often means a sequential scan
+	CacheHitRatio *float64 `json:"cache_hit_ratio"`
+}
+
+// getTopQueries lists the statements of this database that took the most
+// total execution time, from pg_stat_statements, to spot missing indexes
+// without database access. Main tenant tokens only; ?limit= (default 20,
+// at most 100) bounds the list.
+func (s *Server) getTopQueries(w http.ResponseWriter, r *http.Request) {
+	claims := auth.ClaimsFromContext(r.Context())
+	if claims == nil || s.MainTenantOrgID <= 0 || claims.OrgID != s.MainTenantOrgID {
+		problem.Write(w, r, http.StatusForbidden, "MAIN_TENANT_ONLY", "top queries are only available to main tenant tokens")
+		return
+	}
+	limit := defaultTopQueries
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTopQueries {
+			problem.BadRequest(w, r, fmt.Sprintf("limit must be an integer between 1 and %d", maxTopQueries))
+			return
+		}
+		limit = n
+	}
+
+	// Statistics are server-wide, so the pool is used directly rather than
+	// the caller's tenant connection
+	rows, err := s.DB.QueryContext(r.Context(), `
+		SELECT queryid, query, calls, total_exec_time, mean_exec_time, max_exec_time, rows,
+		       100 * total_exec_time / NULLIF(SUM(total_exec_time) OVER (), 0),
+		       shared_blks_hit::float8 / NULLIF(shared_blks_hit + shared_blks_read, 0)
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+		  AND queryid IS NOT NULL
+		ORDER BY total_exec_time DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		if topQueriesUnavailable(err) {
+			problem.Write(w, r, http.StatusServiceUnavailable, "PG_STAT_STATEMENTS_UNAVAILABLE",
+				"pg_stat_statements is not installed in this database; add it to shared_preload_libraries and run CREATE EXTENSION pg_stat_statements")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	queries := []topQuery{}
+	for rows.Next() {
+		var q topQuery
+		var percent *float64
+		if err := rows.Scan(&q.QueryID, &q.Query, &q.Calls, &q.TotalMs, &q.MeanMs, &q.MaxMs, &q.Rows,
+			&percent, &q.CacheHitRatio); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if percent != nil {
+			q.PercentTime = *percent
+		}
+		queries = append(queries, q)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": queries}); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// topQueriesUnavailable reports whether err means pg_stat_statements is
+// missing or not loaded
+func topQueriesUnavailable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, `"pg_stat_statements" does not exist`) ||
+		strings.Contains(msg, "pg_stat_statements must be loaded")
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"era-inventory-api/internal/testutil"
+)
+
+func TestTopQueriesMainTenantOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		mainTenant int64
+		orgID      int64
+		path       string
+		want       int
+	}{
+		{"no main tenant", 0, 1, "/admin/db/top-queries", http.StatusForbidden},
+		{"other org", 1, 2, "/admin/db/top-queries", http.StatusForbidden},
+		{"limit too large", 1, 1, "/admin/db/top-queries?limit=101", http.StatusBadRequest},
+		{"limit zero", 1, 1, "/admin/db/top-queries?limit=0", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{MainTenantOrgID: tt.mainTenant}
+			w := httptest.NewRecorder()
+			r := testutil.AsUser(httptest.NewRequest(http.MethodGet, tt.path, nil), tt.orgID, 1, "org_admin")
+			s.getTopQueries(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTopQueriesUnavailable(t *testing.T) {
+	for msg, want := range map[string]bool{
+		`ERROR: relation "pg_stat_statements" does not exist (SQLSTATE 42P01)`:                     true,
+		`ERROR: pg_stat_statements must be loaded via "shared_preload_libraries" (SQLSTATE 55000)`: true,
+		`ERROR: permission denied for view pg_stat_statements`:                                     false,
+	} {
+		if got := topQueriesUnavailable(errors.New(msg)); got != want {
+			t.Errorf("%s: got %v, want %v", msg, got, want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// trashPurgeInterval is how often expired trash is purged
+const trashPurgeInterval = time.Hour
+
+// trashType is a soft-deletable resource as exposed by the trash endpoints
+type trashType struct {
+	name  string // {type} in URLs and the "type" of entries
+	table string
+}
+
+// trashTypes are purged in this order; items go first so nothing references
+// a purged site, vendor or project for longer than necessary
+var trashTypes = []trashType{
+	{"item", "inventory"},
+	{"site", "sites"},
+	{"vendor", "vendors"},
+	{"project", "projects"},
+}
+
+func lookupTrashType(name string) (trashType, bool) {
+	for _, t := range trashTypes {
+		if t.name == name {
+			return t, true
+		}
+	}
+	return trashType{}, false
+}
+
+// trashEntry is one soft-deleted record in GET /trash
+type trashEntry struct {
+	Type      string     `json:"type"`
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+// listTrash lists soft-deleted items, sites, vendors and projects of the
+// org, most recently deleted first. ?type= narrows it to one resource.
+func (s *Server) listTrash(w http.ResponseWriter, r *http.Request) {
+	params := s.parseListParams(r)
+	ctx := r.Context()
+
+	types := trashTypes
+	if name := r.URL.Query().Get("type"); name != "" {
+		t, ok := lookupTrashType(name)
+		if !ok {
+			problem.BadRequest(w, r, "type must be one of: item, site, vendor, project")
+			return
+		}
+		types = []trashType{t}
+	}
+
+	args := []interface{}{auth.OrgIDFromContext(ctx)}
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		where := "org_id = $1 AND deleted_at IS NOT NULL"
+		if t.table == "inventory" {
+			if clause, siteArgs := siteAccessClause(ctx, "inventory", len(args)+1); clause != "" {
+				where += " AND " + clause
+				args = append(args, siteArgs...)
+			}
+		}
+		parts = append(parts, fmt.Sprintf(
+			`SELECT '%s' AS type, id, name, deleted_at FROM %s WHERE %s`, t.name, t.table, where))
+	}
+
+	q := dbFrom(ctx, s.DB)
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`
+		SELECT type, id, name, deleted_at, COUNT(*) OVER()
+		FROM (%s) trash
+		ORDER BY deleted_at DESC, type, id
+		LIMIT %d OFFSET %d`, strings.Join(parts, " UNION ALL "), params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	entries := []interface{}{}
+	var totalCount int
+	for rows.Next() {
+		var e trashEntry
+		if err := rows.Scan(&e.Type, &e.ID, &e.Name, &e.DeletedAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		if s.TrashRetention > 0 {
+			purgeAt := e.DeletedAt.Add(s.TrashRetention)
+			e.PurgeAt = &purgeAt
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	sendListResponse(w, entries, totalCount, params, nil)
+}
+
+// restoreTrash brings a soft-deleted record back
+func (s *Server) restoreTrash(w http.ResponseWriter, r *http.Request) {
+	t, ok := lookupTrashType(chi.URLParam(r, "type"))
+	if !ok {
+		problem.NotFound(w, r)
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	if t.table == "inventory" && !s.checkItemQuota(w, r, 1) {
+		return
+	}
+
+	sqlStr := fmt.Sprintf(`UPDATE %s SET deleted_at = NULL WHERE id = $1 AND org_id = $2 AND deleted_at IS NOT NULL`, t.table)
+	args := []interface{}{id, auth.OrgIDFromContext(ctx)}
+	if t.table == "inventory" {
+		if clause, siteArgs := siteAccessClause(ctx, "inventory", 3); clause != "" {
+			sqlStr += " AND " + clause
+			args = append(args, siteArgs...)
+		}
+	}
+
+	q := dbFrom(ctx, s.DB)
+	res, err := q.ExecContext(ctx, sqlStr, args...)
+	if err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "unique") {
+			problem.Conflict(w, r, "a live "+t.name+" with the same unique key exists")
+			return
+		}
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startTrashPurger permanently deletes trash older than TrashRetention every
+// trashPurgeInterval until Close. A zero retention keeps trash forever.
+func (s *Server) startTrashPurger() {
+	if s.TrashRetention <= 0 {
+		return
+	}
+	s.purgeStop = make(chan struct{})
+	s.purgeDone = make(chan struct{})
+	go func() {
+		defer close(s.purgeDone)
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.purgeStop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				n, err := s.purgeTrash(ctx, time.Now().Add(-s.TrashRetention))
+				cancel()
+				if err != nil {
+					log.Printf("trash purge failed: %v", err)
+				} else if n > 0 {
+					log.Printf("trash purge removed %d records", n)
+				}
+			}
+		}
+	}()
+}
+
+// stopTrashPurger stops the purger started by startTrashPurger and waits for it
+func (s *Server) stopTrashPurger() {
+	if s.purgeStop == nil {
+		return
+	}
+	close(s.purgeStop)
+	<-s.purgeDone
+	s.purgeStop = nil
+}
+
+// purgeTrash deletes records soft-deleted before the cutoff, org by org so
+// RLS and schema tenancy apply as they do for requests
+func (s *Server) purgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id FROM organizations ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orgIDs = append(orgIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, orgID := range orgIDs {
+		n, err := s.purgeOrgTrash(ctx, orgID, before)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("org %d: %w", orgID, err)
+		}
+	}
+	return total, nil
+}
+
+func (s *Server) purgeOrgTrash(ctx context.Context, orgID int64, before time.Time) (int64, error) {
+	conn, ctx, err := withDBConn(ctx, s.DB, orgID)
+	if err != nil {
+		return 0, err
+	}
+	defer releaseDBConn(conn)
+
+	q := dbFrom(ctx, s.DB)
+	var total int64
+	for _, t := range trashTypes {
+		res, err := q.ExecContext(ctx,
+			`DELETE FROM `+t.table+` WHERE org_id = $1 AND deleted_at < $2`, orgID, before)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestListTrashRejectsUnknownType(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&Server{}).listTrash(w, httptest.NewRequest(http.MethodGet, "/trash?type=widget", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+}
+
+func TestRestoreTrashUnknownType(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/trash/widget/1/restore", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("type", "widget")
+	rctx.URLParams.Add("id", "1")
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	(&Server{}).restoreTrash(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+}
+
+func TestTrashPurgerStops(t *testing.T) {
+	s := &Server{}
+	s.startTrashPurger() // zero retention: nothing started
+	s.stopTrashPurger()
+
+	s.TrashRetention = time.Hour
+	s.startTrashPurger()
+	done := make(chan struct{})
+	go func() {
+		s.stopTrashPurger()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stopTrashPurger did not return")
+	}
+}
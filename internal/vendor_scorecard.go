@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/models"
+	"era-inventory-api/internal/problem"
+)
+
+// vendorScorecard is the GET /vendors/{id}/scorecard summary of the items
+// supplied by a vendor
+type vendorScorecard struct {
+	VendorID int64          `json:"vendor_id"`
+	Assets   int            `json:"assets"`
+	ByStatus map[string]int `json:"by_status"`
+	// FailureRate is the share of in-service items (active or in_repair)
+	// that are in repair
+	FailureRate float64          `json:"failure_rate"`
+	Warranty    warrantyCoverage `json:"warranty"`
+	GeneratedAt time.Time        `json:"generated_at"`
+}
+
+// warrantyCoverage splits items that are not retired or disposed by warranty
+// state; CoverageRate is the share still under warranty
+type warrantyCoverage struct {
+	Covered      int     `json:"covered"`
+	Expired      int     `json:"expired"`
+	Unknown      int     `json:"unknown"`
+	CoverageRate float64 `json:"coverage_rate"`
+}
+
+// getVendorScorecard aggregates the vendor's live items, limited to the sites
+// the caller may see
+func (s *Server) getVendorScorecard(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	orgID := auth.OrgIDFromContext(ctx)
+	if _, err := s.Vendors.Get(ctx, orgID, id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+
+	where := "org_id = $1 AND vendor_id = $2 AND deleted_at IS NULL"
+	args := []interface{}{orgID, id}
+	if clause, siteArgs := siteAccessClause(ctx, "inventory", 3); clause != "" {
+		where += " AND " + clause
+		args = append(args, siteArgs...)
+	}
+
+	rows, err := dbFrom(ctx, s.DB).QueryContext(ctx, `
+		SELECT status, COUNT(*),
+		       COUNT(*) FILTER (WHERE warranty_end >= NOW()),
+		       COUNT(*) FILTER (WHERE warranty_end < NOW()),
+		       COUNT(*) FILTER (WHERE warranty_end IS NULL)
+		FROM inventory WHERE `+where+`
+		GROUP BY status`, args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := vendorScorecard{VendorID: id, ByStatus: map[string]int{}, GeneratedAt: time.Now().UTC()}
+	for rows.Next() {
+		var status string
+		var n, covered, expired, unknown int
+		if err := rows.Scan(&status, &n, &covered, &expired, &unknown); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out.Assets += n
+		out.ByStatus[status] = n
+		if status != models.ItemRetired && status != models.ItemDisposed {
+			out.Warranty.Covered += covered
+			out.Warranty.Expired += expired
+			out.Warranty.Unknown += unknown
+		}
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	out.FailureRate = ratio(out.ByStatus[models.ItemInRepair], out.ByStatus[models.ItemActive]+out.ByStatus[models.ItemInRepair])
+	out.Warranty.CoverageRate = ratio(out.Warranty.Covered, out.Warranty.Covered+out.Warranty.Expired+out.Warranty.Unknown)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		problem.Internal(w, r, err)
+	}
+}
+
+// ratio is n/total rounded to four places, 0 when total is 0
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*1e4) / 1e4
+}
@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"era-inventory-api/internal/testutil"
+)
+
+func TestVendorHandlers(t *testing.T) {
+	f := testutil.NewFixtures(t)
+	acme := f.Vendor("Acme").Email("sales@acme.test").Create()
+	f.Vendor("Globex").InOrg(2).Create()
+	s := fixtureServer(f)
+	path := "/vendors/" + itoa(acme.ID)
+
+	w := serveAs(1, http.MethodGet, "/vendors", "/vendors?sort=-name", "", s.listVendors)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Acme") || strings.Contains(w.Body.String(), "Globex") {
+		t.Errorf("list = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = serveAs(1, http.MethodPut, "/vendors/{id}", path, `{"phone":"+49 30 1234"}`, s.updateVendor)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "sales@acme.test") || !strings.Contains(w.Body.String(), "+49 30 1234") {
+		t.Errorf("partial update = %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := serveAs(2, http.MethodDelete, "/vendors/{id}", path, "", s.deleteVendor); w.Code != http.StatusNotFound {
+		t.Errorf("delete from another org = %d, want 404", w.Code)
+	}
+	if w := serveAs(1, http.MethodDelete, "/vendors/{id}", path, "", s.deleteVendor); w.Code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", w.Code)
+	}
+}
@@ -0,0 +1,56 @@
+// Package version exposes build metadata injected at link time:
+//
+//	go build -ldflags "-X era-inventory-api/internal/version.Version=v1.4.0 \
+//	  -X era-inventory-api/internal/version.Commit=$(git rev-parse HEAD) \
+//	  -X era-inventory-api/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// `make build` and the Dockerfile set these. Binaries built without them fall
+// back to the VCS stamp the Go toolchain embeds, where available.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set via -ldflags -X
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build metadata of the running binary
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "unknown":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildTime == "unknown":
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// String formats the build as key=value pairs for log lines
+func (i Info) String() string {
+	return fmt.Sprintf("version=%s commit=%s build_time=%s go=%s", i.Version, i.Commit, i.BuildTime, i.GoVersion)
+}
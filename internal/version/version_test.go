@@ -0,0 +1,23 @@
+package version
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	old := Version
+	Version = "v1.2.3"
+	defer func() { Version = old }()
+
+	info := Get()
+	if info.Version != "v1.2.3" {
+		t.Errorf("Version = %q, want v1.2.3", info.Version)
+	}
+	if info.GoVersion == "" {
+		t.Error("GoVersion is empty")
+	}
+	if !strings.Contains(info.String(), "version=v1.2.3") {
+		t.Errorf("String() = %q, want it to contain version=v1.2.3", info.String())
+	}
+}
@@ -0,0 +1,255 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"era-inventory-api/internal/outbox"
+)
+
+// batchSize is how many deliveries one send pass claims
+const batchSize = 50
+
+// maxErrorLen caps the response excerpt kept as a delivery's last error
+const maxErrorLen = 512
+
+// envelope is the JSON body of a delivery
+type envelope struct {
+	ID        int64           `json:"id"`
+	Event     string          `json:"event"`
+	OrgID     int64           `json:"org_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// GroupFilter returns which of groups, the asset groups the webhooks
+// subscribed to an event are scoped to, hold the event's item
+type GroupFilter func(ctx context.Context, e outbox.Event, groups []int64) ([]int64, error)
+
+// Fanout returns an outbox subscriber recording a delivery of each event for
+// every active webhook of its org subscribed to the event's topic. A webhook
+// scoped to an asset group only gets the events of its members, as told by
+// inGroups; with a nil inGroups, scoped webhooks get nothing. Replays of an
+// event are ignored, so each webhook gets it once.
+func Fanout(db *sql.DB, inGroups GroupFilter) outbox.Handler {
+	return func(ctx context.Context, e outbox.Event) error {
+		if !ValidEvent(e.Topic) {
+			return nil
+		}
+		body, err := json.Marshal(envelope{ID: e.ID, Event: e.Topic, OrgID: e.OrgID, CreatedAt: e.CreatedAt, Data: e.Payload})
+		if err != nil {
+			return err
+		}
+		matched := []int64{}
+		if inGroups != nil {
+			groups, err := scopedGroups(ctx, db, e)
+			if err != nil {
+				return err
+			}
+			if len(groups) > 0 {
+				if matched, err = inGroups(ctx, e, groups); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = db.ExecContext(ctx, `
+			INSERT INTO webhook_deliveries (webhook_id, org_id, event_id, event, payload)
+			SELECT id, org_id, $2, $3, $4 FROM webhooks
+			WHERE org_id = $1 AND active AND $3 = ANY(events) AND (group_id IS NULL OR group_id = ANY($5))
+			ON CONFLICT (webhook_id, event_id) DO NOTHING`, e.OrgID, e.ID, e.Topic, body, matched)
+		return err
+	}
+}
+
+// scopedGroups lists the asset groups of the webhooks subscribed to e
+func scopedGroups(ctx context.Context, db *sql.DB, e outbox.Event) ([]int64, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT group_id FROM webhooks
+		WHERE org_id = $1 AND active AND $2 = ANY(events) AND group_id IS NOT NULL`, e.OrgID, e.Topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var groups []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		groups = append(groups, id)
+	}
+	return groups, rows.Err()
+}
+
+// Sender posts pending deliveries to their webhooks
+type Sender struct {
+	db          *sql.DB
+	client      *http.Client
+	interval    time.Duration
+	maxAttempts int
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSender sends due deliveries every interval once started. A delivery
+// that has failed maxAttempts times becomes dead.
+func NewSender(db *sql.DB, client *http.Client, interval time.Duration, maxAttempts int) *Sender {
+	return &Sender{db: db, client: client, interval: interval, maxAttempts: maxAttempts}
+}
+
+// Start runs send passes until Stop; a zero interval leaves it stopped
+func (s *Sender) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.interval <= 0 || s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(stop <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.pass()
+			}
+		}
+	}(s.stop, s.done)
+}
+
+// Stop ends the loop started by Start and waits for the current pass
+func (s *Sender) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+func (s *Sender) pass() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	for {
+		n, err := s.SendOnce(ctx)
+		if err != nil {
+			log.Printf("webhook send failed: %v", err)
+			return
+		}
+		if n < batchSize {
+			return
+		}
+	}
+}
+
+// SendOnce claims up to batchSize due deliveries, oldest first, and posts
+// each. Claimed rows are locked, so several instances can send concurrently
+// without posting a delivery twice in one pass. It returns the number of
+// deliveries claimed.
+func (s *Sender) SendOnce(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = 'pending' AND d.next_attempt_at <= NOW()
+		ORDER BY d.id
+		LIMIT $1
+		FOR UPDATE OF d SKIP LOCKED`, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	type claimed struct {
+		id          int64
+		event       string
+		payload     []byte
+		attempts    int
+		url, secret string
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		if err := rows.Scan(&c.id, &c.event, &c.payload, &c.attempts, &c.url, &c.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range batch {
+		code, sendErr := s.post(ctx, c.id, c.event, c.url, c.secret, c.payload)
+		var status interface{}
+		if code != 0 {
+			status = code
+		}
+		switch {
+		case sendErr == nil:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, response_code = $2,
+				       last_error = NULL, delivered_at = NOW()
+				WHERE id = $1`, c.id, status)
+		case c.attempts+1 >= s.maxAttempts:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE webhook_deliveries SET status = 'dead', attempts = attempts + 1, response_code = $2, last_error = $3
+				WHERE id = $1`, c.id, status, sendErr.Error())
+		default:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE webhook_deliveries SET attempts = attempts + 1, response_code = $2, last_error = $3,
+				       next_attempt_at = NOW() + $4 * INTERVAL '1 second'
+				WHERE id = $1`, c.id, status, sendErr.Error(), outbox.Backoff(c.attempts+1).Seconds())
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), tx.Commit()
+}
+
+// post sends one delivery and returns the response status, 0 when there was
+// no response. Any status other than 2xx is a failure.
+func (s *Sender) post(ctx context.Context, id int64, event, url, secret string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "era-inventory-webhooks")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(id))
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLen))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s: %s", resp.Status, bytes.TrimSpace(excerpt))
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	got := Sign("whsec_test", time.Unix(1700000000, 0), body)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(body)))
+	if want := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for u, ok := range map[string]bool{
+		"https://hooks.example.com/era":  true,
+		"http://hooks.example.com:8080/": true,
+		"ftp://hooks.example.com":        false,
+		"/relative":                      false,
+		"https://user:pw@example.com/":   false,
+		"not a url":                      false,
+	} {
+		if err := ValidateURL(u); (err == nil) != ok {
+			t.Errorf("ValidateURL(%q) = %v, want ok=%v", u, err, ok)
+		}
+	}
+}
+
+func TestPostSignsAndChecksStatus(t *testing.T) {
+	var gotSig, gotEvent string
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig, gotEvent = r.Header.Get(SignatureHeader), r.Header.Get(EventHeader)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("nope"))
+	}))
+	defer srv.Close()
+
+	s := &Sender{client: NewClient(true)}
+	code, err := s.post(context.Background(), 9, "item.created", srv.URL, "whsec_test", []byte(`{"id":1}`))
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("post = %d, %v", code, err)
+	}
+	if gotEvent != "item.created" || string(gotBody) != `{"id":1}` || !strings.HasPrefix(gotSig, "t=") {
+		t.Errorf("request: event %q, body %s, signature %q", gotEvent, gotBody, gotSig)
+	}
+
+	status = http.StatusInternalServerError
+	if code, err := s.post(context.Background(), 9, "item.created", srv.URL, "whsec_test", []byte(`{}`)); err == nil || code != 500 {
+		t.Errorf("5xx: code %d, err %v", code, err)
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	s := &Sender{client: NewClient(false)}
+	if _, err := s.post(context.Background(), 1, "item.created", srv.URL, "k", []byte(`{}`)); !errors.Is(err, errPrivateAddress) {
+		t.Errorf("loopback endpoint: err = %v, want errPrivateAddress", err)
+	}
+}
@@ -0,0 +1,342 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"era-inventory-api/internal/auth"
+	"era-inventory-api/internal/problem"
+	"era-inventory-api/internal/webhook"
+)
+
+// webhookColumns is what webhook queries select, in scanWebhook order
+const webhookColumns = "id, url, to_json(events), group_id, active, created_at, updated_at"
+
+// webhookInput is the body of POST /webhooks and PUT /webhooks/{id}; on
+// update, omitted fields are left unchanged. GroupID scopes the webhook to
+// the items of an asset group, 0 removing the scope on update.
+type webhookInput struct {
+	URL     *string  `json:"url"`
+	Events  []string `json:"events"`
+	GroupID *int64   `json:"group_id"`
+	Active  *bool    `json:"active"`
+}
+
+// checkWebhookGroup writes 400 unless groupID is 0 or names an asset group
+// of the caller's org
+func (s *Server) checkWebhookGroup(w http.ResponseWriter, r *http.Request, groupID int64) bool {
+	if groupID == 0 {
+		return true
+	}
+	ok, err := s.assetGroupExists(r.Context(), groupID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return false
+	}
+	if !ok {
+		problem.BadRequest(w, r, "group_id does not name an asset group")
+		return false
+	}
+	return true
+}
+
+// normalizeEvents checks, dedupes and sorts subscribed events
+func normalizeEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("events must name at least one of %s", strings.Join(webhook.Events, ", "))
+	}
+	seen := map[string]bool{}
+	out := make([]string, 0, len(events))
+	for _, e := range events {
+		if !webhook.ValidEvent(e) {
+			return nil, fmt.Errorf("unknown event %q; expected one of %s", e, strings.Join(webhook.Events, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func scanWebhook(row interface{ Scan(...any) error }) (*webhook.Webhook, error) {
+	var h webhook.Webhook
+	var events []byte
+	if err := row.Scan(&h.ID, &h.URL, &events, &h.GroupID, &h.Active, &h.CreatedAt, &h.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(events, &h.Events); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := dbFrom(r.Context(), s.DB).QueryContext(r.Context(),
+		`SELECT `+webhookColumns+` FROM webhooks WHERE org_id = $1 ORDER BY id`, auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, h)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, len(out), listParams{limit: len(out)}, nil)
+}
+
+// createWebhook registers a URL for events. The response carries the signing
+// secret, which is not shown again.
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var in webhookInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.URL == nil {
+		problem.BadRequest(w, r, "url is required")
+		return
+	}
+	url := strings.TrimSpace(*in.URL)
+	if err := webhook.ValidateURL(url); err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	events, err := normalizeEvents(in.Events)
+	if err != nil {
+		problem.BadRequest(w, r, err.Error())
+		return
+	}
+	var groupID *int64
+	if in.GroupID != nil && *in.GroupID != 0 {
+		if !s.checkWebhookGroup(w, r, *in.GroupID) {
+			return
+		}
+		groupID = in.GroupID
+	}
+	active := in.Active == nil || *in.Active
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	h, err := scanWebhook(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		INSERT INTO webhooks (org_id, url, events, secret, active, group_id) VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+webhookColumns, auth.OrgIDFromContext(r.Context()), url, events, secret, active, groupID))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	h.Secret = secret
+	writeJSON(w, r, http.StatusCreated, h)
+}
+
+func (s *Server) getWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	h, err := scanWebhook(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(),
+		`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1 AND org_id = $2`, id, auth.OrgIDFromContext(r.Context())))
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, h)
+}
+
+// updateWebhook changes the URL, events, group or active flag; deliveries
+// already recorded are still sent to the new URL
+func (s *Server) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var in webhookInput
+	if !s.decodeJSON(w, r, &in) {
+		return
+	}
+	if in.URL == nil && in.Events == nil && in.GroupID == nil && in.Active == nil {
+		problem.BadRequest(w, r, "no fields to update")
+		return
+	}
+	args := []interface{}{id, auth.OrgIDFromContext(r.Context())}
+	var sets []string
+	if in.URL != nil {
+		url := strings.TrimSpace(*in.URL)
+		if err := webhook.ValidateURL(url); err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+		args = append(args, url)
+		sets = append(sets, "url = $"+strconv.Itoa(len(args)))
+	}
+	if in.Events != nil {
+		events, err := normalizeEvents(in.Events)
+		if err != nil {
+			problem.BadRequest(w, r, err.Error())
+			return
+		}
+		args = append(args, events)
+		sets = append(sets, "events = $"+strconv.Itoa(len(args)))
+	}
+	if in.GroupID != nil {
+		if !s.checkWebhookGroup(w, r, *in.GroupID) {
+			return
+		}
+		var groupID *int64
+		if *in.GroupID != 0 {
+			groupID = in.GroupID
+		}
+		args = append(args, groupID)
+		sets = append(sets, "group_id = $"+strconv.Itoa(len(args)))
+	}
+	if in.Active != nil {
+		args = append(args, *in.Active)
+		sets = append(sets, "active = $"+strconv.Itoa(len(args)))
+	}
+
+	h, err := scanWebhook(dbFrom(r.Context(), s.DB).QueryRowContext(r.Context(), `
+		UPDATE webhooks SET `+strings.Join(sets, ", ")+`
+		WHERE id = $1 AND org_id = $2 RETURNING `+webhookColumns, args...))
+	if err == sql.ErrNoRows {
+		problem.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, h)
+}
+
+// deleteWebhook removes a webhook and its delivery log
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(),
+		`DELETE FROM webhooks WHERE id = $1 AND org_id = $2`, id, auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries is a webhook's delivery log, newest first; ?status=
+// narrows it to pending, delivered or dead deliveries
+func (s *Server) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	params := s.parseListParams(r)
+	orgID := auth.OrgIDFromContext(r.Context())
+	q := dbFrom(r.Context(), s.DB)
+
+	var exists bool
+	if err := q.QueryRowContext(r.Context(),
+		`SELECT EXISTS (SELECT 1 FROM webhooks WHERE id = $1 AND org_id = $2)`, id, orgID).Scan(&exists); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if !exists {
+		problem.NotFound(w, r)
+		return
+	}
+
+	args := []interface{}{id}
+	cond := "webhook_id = $1"
+	if status := r.URL.Query().Get("status"); status != "" {
+		if status != webhook.StatusPending && status != webhook.StatusDelivered && status != webhook.StatusDead {
+			problem.BadRequest(w, r, "status must be pending, delivered or dead")
+			return
+		}
+		args = append(args, status)
+		cond += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	rows, err := q.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT id, webhook_id, event_id, event, status, attempts, response_code, last_error,
+		       next_attempt_at, created_at, delivered_at, COUNT(*) OVER() as total_count
+		FROM webhook_deliveries WHERE %s
+		ORDER BY id DESC
+		LIMIT %d OFFSET %d`, cond, params.limit, params.offset), args...)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	out := []interface{}{}
+	totalCount := 0
+	for rows.Next() {
+		var d webhook.Delivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Status, &d.Attempts, &d.ResponseCode,
+			&d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.DeliveredAt, &totalCount); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	sendListResponse(w, out, totalCount, params, nil)
+}
+
+// retryWebhookDelivery puts a dead delivery back in the queue with a fresh
+// set of attempts
+func (s *Server) retryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(chi.URLParam(r, "deliveryID"), 10, 64)
+	if err != nil {
+		problem.NotFound(w, r)
+		return
+	}
+	res, err := dbFrom(r.Context(), s.DB).ExecContext(r.Context(), `
+		UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND webhook_id = $2 AND org_id = $3 AND status = 'dead'`,
+		deliveryID, id, auth.OrgIDFromContext(r.Context()))
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		problem.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,277 @@
+// Package xlsx writes single-sheet Office Open XML spreadsheets. Rows are
+// streamed into the zip as they are written, so exports of any size use
+// constant memory. WriteRow stores every cell as an inline string;
+// WriteCells adds numbers, dates and a fixed set of styles for reports that
+// are read in Excel rather than re-imported.
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ContentType is the media type of the files Writer produces
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// staticParts are the package parts that do not depend on the data
+var staticParts = []struct{ name, body string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+		`<fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+		`<borders count="3"><border><left/><right/><top/><bottom/><diagonal/></border>` +
+		`<border><left/><right/><top/><bottom style="thin"><color auto="1"/></bottom><diagonal/></border>` +
+		`<border><left/><right/><top style="thin"><color auto="1"/></top><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="7">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="2" borderId="1" xfId="0" applyFont="1" applyFill="1" applyBorder="1"/>` +
+		`<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="10" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="3" fontId="1" fillId="0" borderId="2" xfId="0" applyNumberFormat="1" applyFont="1" applyBorder="1"/>` +
+		`</cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`},
+}
+
+// Style is a cell format of the built-in stylesheet
+type Style int
+
+// The styles of the built-in stylesheet, in cellXfs order
+const (
+	StyleDefault Style = iota
+	StyleHeader        // bold on a shaded fill with a bottom border
+	StyleInteger       // #,##0
+	StyleDecimal       // #,##0.00
+	StyleDate          // the reader's short date format
+	StylePercent       // 0.00%
+	StyleTotal         // bold #,##0 below a top border
+)
+
+// Cell is one typed, styled cell for WriteCells. The zero Cell is blank.
+type Cell struct {
+	text  string
+	num   float64
+	isNum bool
+	style Style
+}
+
+// Text is a string cell
+func Text(s string) Cell { return Cell{text: s} }
+
+// Int is an integer cell with thousands separators
+func Int(n int) Cell { return Cell{num: float64(n), isNum: true, style: StyleInteger} }
+
+// Number is a decimal cell with two decimals
+func Number(f float64) Cell { return Cell{num: f, isNum: true, style: StyleDecimal} }
+
+// Percent is a ratio cell shown as a percentage (0.25 is 25.00%)
+func Percent(f float64) Cell { return Cell{num: f, isNum: true, style: StylePercent} }
+
+// Date is a date cell, stored as a spreadsheet serial date so it sorts and
+// filters as a date; nil is a blank cell
+func Date(t *time.Time) Cell {
+	if t == nil {
+		return Cell{}
+	}
+	d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return Cell{num: d.Sub(excelEpoch).Hours() / 24, isNum: true, style: StyleDate}
+}
+
+// excelEpoch is day 0 of the 1900 date system, as readers count it
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Styled returns c with style s
+func (c Cell) Styled(s Style) Cell {
+	c.style = s
+	return c
+}
+
+// Layout is the sheet setup written before the first row
+type Layout struct {
+	// Widths are column widths in characters, from column A; 0 keeps the default
+	Widths []float64
+	// FreezeRows keeps this many top rows (the header) in view while scrolling
+	FreezeRows int
+}
+
+// Writer streams rows into the single worksheet of an .xlsx file
+type Writer struct {
+	zw     *zip.Writer
+	sheet  *bufio.Writer
+	closed bool
+}
+
+// NewWriter starts a workbook whose only sheet is called sheetName
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	return NewWriterLayout(w, sheetName, Layout{})
+}
+
+// NewWriterLayout is NewWriter with column widths and frozen header rows
+func NewWriterLayout(w io.Writer, sheetName string, layout Layout) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, p := range staticParts {
+		if err := writePart(zw, p.name, p.body); err != nil {
+			return nil, err
+		}
+	}
+	var name bytes.Buffer
+	_ = xml.EscapeText(&name, []byte(sheetName))
+	if err := writePart(zw, "xl/workbook.xml", xml.Header+
+		`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<sheets><sheet name="`+name.String()+`" sheetId="1" r:id="rId1"/></sheets></workbook>`); err != nil {
+		return nil, err
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(xml.Header +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + layout.xml() + `<sheetData>`); err != nil {
+		return nil, err
+	}
+	return &Writer{zw: zw, sheet: sheet}, nil
+}
+
+// xml renders the sheetViews and cols elements, which precede sheetData
+func (l Layout) xml() string {
+	var b bytes.Buffer
+	if l.FreezeRows > 0 {
+		fmt.Fprintf(&b, `<sheetViews><sheetView workbookViewId="0">`+
+			`<pane ySplit="%d" topLeftCell="A%d" activePane="bottomLeft" state="frozen"/>`+
+			`<selection pane="bottomLeft"/></sheetView></sheetViews>`, l.FreezeRows, l.FreezeRows+1)
+	}
+	cols := 0
+	for i, width := range l.Widths {
+		if width <= 0 {
+			continue
+		}
+		if cols == 0 {
+			b.WriteString("<cols>")
+		}
+		cols++
+		fmt.Fprintf(&b, `<col min="%d" max="%d" width="%s" customWidth="1"/>`,
+			i+1, i+1, strconv.FormatFloat(width, 'f', -1, 64))
+	}
+	if cols > 0 {
+		b.WriteString("</cols>")
+	}
+	return b.String()
+}
+
+// WriteHeader appends a row of header cells
+func (w *Writer) WriteHeader(names []string) error {
+	cells := make([]Cell, len(names))
+	for i, n := range names {
+		cells[i] = Text(n).Styled(StyleHeader)
+	}
+	return w.WriteCells(cells)
+}
+
+// WriteCells appends one row of typed cells
+func (w *Writer) WriteCells(cells []Cell) error {
+	if w.closed {
+		return errors.New("xlsx: write after close")
+	}
+	if _, err := w.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+	for _, c := range cells {
+		var err error
+		switch {
+		case c.isNum:
+			_, err = fmt.Fprintf(w.sheet, `<c s="%d"><v>%s</v></c>`, c.style, strconv.FormatFloat(c.num, 'f', -1, 64))
+		case c.text == "":
+			_, err = fmt.Fprintf(w.sheet, `<c s="%d"/>`, c.style)
+		default:
+			if _, err = fmt.Fprintf(w.sheet, `<c t="inlineStr" s="%d"><is><t xml:space="preserve">`, c.style); err == nil {
+				if err = xml.EscapeText(w.sheet, []byte(c.text)); err == nil {
+					_, err = w.sheet.WriteString("</t></is></c>")
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+// WriteRow appends one row; empty strings leave their cell blank
+func (w *Writer) WriteRow(cells []string) error {
+	if w.closed {
+		return errors.New("xlsx: write after close")
+	}
+	if _, err := w.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+	for _, c := range cells {
+		if c == "" {
+			if _, err := w.sheet.WriteString("<c/>"); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(w.sheet, []byte(c)); err != nil {
+			return err
+		}
+		if _, err := w.sheet.WriteString("</t></is></c>"); err != nil {
+			return err
+		}
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+// Close finishes the sheet and the zip; it does not close the underlying writer
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if _, err := w.sheet.WriteString("</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+func writePart(zw *zip.Writer, name, body string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, body)
+	return err
+}
@@ -0,0 +1,189 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, `Items & "more"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{
+		{"id", "name", "notes"},
+		{"1", "Core <switch>", ""},
+		{"2", " padded ", "a\x01b"},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]string{"late"}); err == nil {
+		t.Error("WriteRow after Close succeeded")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = data
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	var wb struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(parts["xl/workbook.xml"], &wb); err != nil || len(wb.Sheets) != 1 || wb.Sheets[0].Name != `Items & "more"` {
+		t.Errorf("workbook = %+v, %v", wb, err)
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Text string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	var got [][]string
+	for _, row := range sheet.Rows {
+		var cells []string
+		for _, c := range row.Cells {
+			cells = append(cells, c.Text)
+		}
+		got = append(got, cells)
+	}
+	want := [][]string{
+		{"id", "name", "notes"},
+		{"1", "Core <switch>", ""},
+		{"2", " padded ", "a�b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestWriterLayoutAndTypedCells(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriterLayout(&buf, "Report", Layout{Widths: []float64{24, 0, 10.5}, FreezeRows: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2026, 3, 1, 15, 4, 0, 0, time.UTC)
+	if err := w.WriteHeader([]string{"site", "items", "since"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteCells([]Cell{Text("Berlin"), Int(1234), Date(&day), Cell{}, Percent(0.25)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteCells([]Cell{Text("TOTAL").Styled(StyleTotal), Int(1234).Styled(StyleTotal), Date(nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		parts[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	var styles struct {
+		CellXfs struct {
+			Count int `xml:"count,attr"`
+			Xfs   []struct {
+				NumFmtID int `xml:"numFmtId,attr"`
+			} `xml:"xf"`
+		} `xml:"cellXfs"`
+	}
+	if err := xml.Unmarshal(parts["xl/styles.xml"], &styles); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(styles.CellXfs.Xfs); n != int(StyleTotal)+1 || styles.CellXfs.Count != n {
+		t.Errorf("stylesheet has %d cell formats (count %d), want %d", n, styles.CellXfs.Count, int(StyleTotal)+1)
+	}
+
+	var sheet struct {
+		Pane struct {
+			YSplit int    `xml:"ySplit,attr"`
+			State  string `xml:"state,attr"`
+		} `xml:"sheetViews>sheetView>pane"`
+		Cols []struct {
+			Min   int     `xml:"min,attr"`
+			Width float64 `xml:"width,attr"`
+		} `xml:"cols>col"`
+		Rows []struct {
+			Cells []struct {
+				Style int    `xml:"s,attr"`
+				Type  string `xml:"t,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Pane.YSplit != 1 || sheet.Pane.State != "frozen" {
+		t.Errorf("pane = %+v, want the first row frozen", sheet.Pane)
+	}
+	if len(sheet.Cols) != 2 || sheet.Cols[0].Min != 1 || sheet.Cols[0].Width != 24 || sheet.Cols[1].Min != 3 || sheet.Cols[1].Width != 10.5 {
+		t.Errorf("cols = %+v", sheet.Cols)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(sheet.Rows))
+	}
+	if c := sheet.Rows[0].Cells[0]; c.Style != int(StyleHeader) || c.Text != "site" {
+		t.Errorf("header cell = %+v", c)
+	}
+	row := sheet.Rows[1].Cells
+	if row[1].Value != "1234" || row[1].Style != int(StyleInteger) || row[1].Type != "" {
+		t.Errorf("integer cell = %+v", row[1])
+	}
+	// 2026-03-01 is serial day 46082 in the 1900 date system
+	if row[2].Value != "46082" || row[2].Style != int(StyleDate) {
+		t.Errorf("date cell = %+v", row[2])
+	}
+	if row[3].Value != "" || row[3].Text != "" {
+		t.Errorf("blank cell = %+v", row[3])
+	}
+	if row[4].Value != "0.25" || row[4].Style != int(StylePercent) {
+		t.Errorf("percent cell = %+v", row[4])
+	}
+	if c := sheet.Rows[2].Cells[1]; c.Style != int(StyleTotal) {
+		t.Errorf("total cell = %+v", c)
+	}
+}